@@ -1,8 +1,10 @@
 package main
 
 import (
-	"github.com/BurntSushi/toml"
 	"log"
+
+	"github.com/BurntSushi/toml"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/backend"
 )
 
 type Cfg_database struct {
@@ -31,12 +33,22 @@ type Config struct {
 	Loglevel             string
 	AccessLog            string
 	Synconly             []int64
+	NewGroupActive       bool `toml:"newgroupactive"`
 	Backup               Backup
 	DB                   Cfg_database `toml:"database"`
 	GroupCacheExpiration string       `toml:"groupcacheexpiration"`
 	S3                   S3           `toml:"s3"`
 }
 
+// storeConfig is the database configuration for backend.OpenStore.
+func (cfg *Config) storeConfig() backend.Config {
+	return backend.Config{
+		ServerType:     cfg.DB.ServerType,
+		DSN:            cfg.DB.DSN,
+		NewGroupActive: cfg.NewGroupActive,
+	}
+}
+
 func LoadConfig(filepath string) Config {
 	var conf Config
 	_, err := toml.DecodeFile(filepath, &conf)
@@ -6,9 +6,8 @@ import (
 	"log"
 	"os"
 
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/je4/zsync/v2/pkg/filesystem"
-	"github.com/je4/zsync/v2/pkg/zotero/storage"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/backend"
 	"github.com/je4/zsync/v2/pkg/zotero/sync"
 	"github.com/op/go-logging"
 	"github.com/rs/zerolog"
@@ -44,14 +43,19 @@ type ZotField struct {
 	Localized string `json:"localized"`
 }
 
-func backup(ctx context.Context, cfg *Config, db *pgxpool.Pool, fs filesystem.FileSystem, logger *logging.Logger) {
+func backup(ctx context.Context, cfg *Config, fs filesystem.FileSystem, logger *logging.Logger) {
 	backupFs, err := filesystem.NewLocalFs(cfg.Backup.Path, logger)
 	if err != nil {
 		logger.Panicf("not a git repo: %v", cfg.Backup.Path)
 	}
 
 	zlog := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
-	zotStorage := storage.NewStorage(db, false, &zlog)
+	zotStorage, closeStorage, err := backend.OpenStore(ctx, cfg.storeConfig(), &zlog)
+	if err != nil {
+		logger.Errorf("cannot open database: %v", err)
+		return
+	}
+	defer closeStorage()
 	syncer := sync.NewSyncer(nil, zotStorage, fs, &zlog)
 
 	grps, err := zotStorage.GetGroups(ctx)
@@ -86,18 +90,6 @@ func main() {
 	flag.Parse()
 	cfg := LoadConfig(*cfgfile)
 
-	// get database connection handle
-	db, err := pgxpool.New(context.Background(), cfg.DB.DSN)
-	if err != nil {
-		log.Fatalf("error opening database: %v", err)
-	}
-	defer db.Close()
-
-	// Validate DSN connection:
-	err = db.Ping(context.Background())
-	if err != nil {
-		log.Fatalf("error pinging database: %v", err)
-	}
 	logger, lf := CreateLogger(cfg.Service, cfg.Logfile, cfg.Loglevel)
 	defer lf.Close()
 
@@ -106,5 +98,5 @@ func main() {
 		log.Fatalf("cannot connect to s3 instance: %v", err)
 	}
 
-	backup(context.Background(), &cfg, db, fs, logger)
+	backup(context.Background(), &cfg, fs, logger)
 }
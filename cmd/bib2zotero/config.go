@@ -0,0 +1,30 @@
+package main
+
+import (
+	"log"
+
+	"github.com/BurntSushi/toml"
+	"github.com/je4/utils/v2/pkg/config"
+)
+
+type Cfg_database struct {
+	ServerType string
+	DSN        config.EnvString
+	ConnMax    int `toml:"connection_max"`
+}
+
+type Config struct {
+	Service  string
+	Logfile  string
+	Loglevel string
+	DB       Cfg_database `toml:"database"`
+}
+
+func LoadConfig(filepath string) Config {
+	var conf Config
+	_, err := toml.DecodeFile(filepath, &conf)
+	if err != nil {
+		log.Fatalln("Error on loading config: ", err)
+	}
+	return conf
+}
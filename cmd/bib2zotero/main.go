@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json/v2"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/je4/zsync/v2/pkg/zotero/importer"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+	"github.com/rs/zerolog"
+)
+
+type report struct {
+	File        string                `json:"file"`
+	Diagnostics []importer.Diagnostic `json:"diagnostics"`
+	Results     []importer.Result     `json:"results,omitempty"`
+}
+
+func parseFile(name string, format importer.Format) ([]*importer.Record, []importer.Diagnostic, error) {
+	if format == "" {
+		var ok bool
+		if format, ok = importer.FormatFromFilename(name); !ok {
+			return nil, nil, fmt.Errorf("cannot detect format of %s, use -format", name)
+		}
+	}
+	fp, err := os.Open(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open %s: %w", name, err)
+	}
+	defer fp.Close()
+	return importer.Parse(format, fp)
+}
+
+func main() {
+	cfgfile := flag.String("c", "zoterosync.toml", "location of config file")
+	groupid := flag.Int64("group", 0, "id of target zotero group")
+	format := flag.String("format", "", "input format (bibtex, ris, csljson); detected from file extension if empty")
+	prefix := flag.String("prefix", "", "prefix for the stored source identifiers (oldid)")
+	dry := flag.Bool("dry", false, "parse and validate only, do not write to database")
+	jsonReport := flag.Bool("json", false, "write report as json to stdout")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		log.Fatalf("usage: bib2zotero -group <id> [options] <file>...")
+	}
+	if *groupid == 0 && !*dry {
+		log.Fatalf("no target group given")
+	}
+
+	cfg := LoadConfig(*cfgfile)
+
+	var out io.Writer = os.Stderr
+	if cfg.Logfile != "" {
+		fp, err := os.OpenFile(cfg.Logfile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalf("cannot open logfile %s: %v", cfg.Logfile, err)
+		}
+		defer fp.Close()
+		out = fp
+	}
+	output := zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339}
+	_logger := zerolog.New(output).With().Timestamp().Logger()
+	_logger.Level(zLogger.LogLevel(cfg.Loglevel))
+	var logger zLogger.ZLogger = &_logger
+
+	var imp *importer.Importer
+	if !*dry {
+		db, err := pgxpool.New(context.Background(), cfg.DB.DSN.String())
+		if err != nil {
+			log.Fatalf("error opening database: %v", err)
+		}
+		defer db.Close()
+		if err := db.Ping(context.Background()); err != nil {
+			log.Fatalf("error pinging database: %v", err)
+		}
+		imp = importer.NewImporter(storage.NewStorage(db, false, logger), *prefix, logger)
+	}
+
+	ctx := context.Background()
+	var reports []report
+	failed := false
+	for _, name := range flag.Args() {
+		records, diags, err := parseFile(name, importer.Format(*format))
+		if err != nil {
+			logger.Error().Err(err).Msgf("cannot parse %s", name)
+			failed = true
+			continue
+		}
+		rep := report{File: filepath.Base(name), Diagnostics: diags}
+		if importer.HasErrors(diags) {
+			failed = true
+		}
+		if imp != nil {
+			results, err := imp.Import(ctx, *groupid, records)
+			if err != nil {
+				logger.Error().Err(err).Msgf("import of %s aborted", name)
+				failed = true
+			}
+			for _, r := range results {
+				if r.Error != "" {
+					failed = true
+				}
+			}
+			rep.Results = results
+		}
+		if !*jsonReport {
+			for _, d := range diags {
+				fmt.Printf("%s: %s\n", name, d)
+			}
+			created, updated, errs := 0, 0, 0
+			for _, r := range rep.Results {
+				switch {
+				case r.Error != "":
+					errs++
+				case r.Updated:
+					updated++
+				default:
+					created++
+				}
+			}
+			fmt.Printf("%s: %d records parsed, %d created, %d updated, %d failed\n", name, len(records), created, updated, errs)
+		}
+		reports = append(reports, rep)
+	}
+	if *jsonReport {
+		if err := json.MarshalWrite(os.Stdout, reports); err != nil {
+			log.Fatalf("cannot write report: %v", err)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -17,7 +17,6 @@ limitations under the License.
 package main
 
 import (
-	"fmt"
 	"github.com/BurntSushi/toml"
 	"log"
 )
@@ -49,10 +48,9 @@ type Config struct {
 
 func LoadConfig(filepath string) Config {
 	var conf Config
-	m, err := toml.DecodeFile(filepath, &conf)
+	_, err := toml.DecodeFile(filepath, &conf)
 	if err != nil {
 		log.Fatalln("Error on loading config: ", err)
 	}
-	fmt.Sprintf("%v", m)
 	return conf
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+	"github.com/rs/zerolog"
+)
+
+const usage = `usage: migrate [-c config] up [version]
+       migrate [-c config] down [steps]
+       migrate [-c config] status`
+
+func printStatus(ctx context.Context, zotStorage *storage.Storage, out io.Writer) error {
+	states, err := zotStorage.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		applied := "pending"
+		if state.Applied != nil {
+			applied = state.Applied.Format(time.RFC3339)
+		}
+		if state.Unknown {
+			applied += " (unknown to this release)"
+		}
+		fmt.Fprintf(out, "%04d %-20s %s\n", state.Version, state.Name, applied)
+	}
+	return nil
+}
+
+func main() {
+	cfgfile := flag.String("c", "zoterosync.toml", "location of config file")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var arg int64
+	if flag.NArg() == 2 {
+		var err error
+		if arg, err = strconv.ParseInt(flag.Arg(1), 10, 64); err != nil || arg < 1 {
+			log.Fatalf("invalid argument %q", flag.Arg(1))
+		}
+	}
+
+	cfg := LoadConfig(*cfgfile)
+
+	_logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).With().Timestamp().Logger()
+	_logger = _logger.Level(zLogger.LogLevel(cfg.Loglevel))
+	var logger zLogger.ZLogger = &_logger
+
+	ctx := context.Background()
+	db, err := pgxpool.New(ctx, cfg.DB.DSN.String())
+	if err != nil {
+		log.Fatalf("error opening database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Ping(ctx); err != nil {
+		log.Fatalf("error pinging database: %v", err)
+	}
+
+	zotStorage := storage.NewStorage(db, false, logger)
+	switch flag.Arg(0) {
+	case "up":
+		migrations, err := zotStorage.MigrateUp(ctx, arg)
+		if err != nil {
+			log.Fatalf("cannot migrate: %v", err)
+		}
+		fmt.Printf("%d migrations applied\n", len(migrations))
+	case "down":
+		if arg == 0 {
+			arg = 1
+		}
+		migrations, err := zotStorage.MigrateDown(ctx, int(arg))
+		if err != nil {
+			log.Fatalf("cannot migrate: %v", err)
+		}
+		fmt.Printf("%d migrations reverted\n", len(migrations))
+	case "status":
+		if err := printStatus(ctx, zotStorage, os.Stdout); err != nil {
+			log.Fatalf("cannot get migration status: %v", err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
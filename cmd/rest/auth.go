@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+var (
+	errUnauthorized = errors.New("unauthorized")
+	errForbidden    = errors.New("forbidden")
+)
+
+type ctxKey int
+
+const ctxKeyApiKey ctxKey = iota
+
+// configKey is an AuthKey from the configuration with its token hash.
+type configKey struct {
+	tokenHash string
+	key       *model.ApiKey
+}
+
+func newConfigKeys(keys []AuthKey) []configKey {
+	result := make([]configKey, 0, len(keys))
+	for _, k := range keys {
+		access := model.Access{Groups: map[string]model.AccessElements{}}
+		for _, g := range k.Read {
+			elem := access.Groups[g]
+			elem.Library = true
+			access.Groups[g] = elem
+		}
+		for _, g := range k.Write {
+			elem := access.Groups[g]
+			elem.Library = true
+			elem.Write = true
+			access.Groups[g] = elem
+		}
+		result = append(result, configKey{
+			tokenHash: storage.HashApiToken(k.Token),
+			key: &model.ApiKey{
+				UserId:   k.UserId,
+				Username: k.Username,
+				Access:   access,
+			},
+		})
+	}
+	return result
+}
+
+// tokenFromRequest reads the token from the Zotero-API-Key header or a bearer
+// Authorization header.
+func tokenFromRequest(r *http.Request) string {
+	if token := r.Header.Get("Zotero-API-Key"); token != "" {
+		return token
+	}
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// lookupKey resolves token against the configured keys and, if enabled, the
+// apikeys table. It returns nil if the token is unknown.
+func (handlers *Handlers) lookupKey(ctx context.Context, token string) (*model.ApiKey, error) {
+	hash := storage.HashApiToken(token)
+	for _, k := range handlers.keys {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(k.tokenHash)) == 1 {
+			return k.key, nil
+		}
+	}
+	if !handlers.cfg.Auth.Database {
+		return nil, nil
+	}
+	if key, ok := handlers.dbKeys.GetIfPresent(hash); ok {
+		return key, nil
+	}
+	key, err := handlers.storage.GetApiKey(ctx, token)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot load api key")
+	}
+	if key != nil {
+		handlers.dbKeys.Set(hash, key)
+	}
+	return key, nil
+}
+
+// authMiddleware rejects requests without a valid key and stores the key in
+// the request context.
+func (handlers *Handlers) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := tokenFromRequest(r)
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="zsync"`)
+			respondWithError(w, http.StatusUnauthorized, "no api key")
+			return
+		}
+		key, err := handlers.lookupKey(r.Context(), token)
+		if err != nil {
+			handlers.logger.Errorf("cannot check api key: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "cannot check api key")
+			return
+		}
+		if key == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="zsync", error="invalid_token"`)
+			respondWithError(w, http.StatusUnauthorized, "invalid api key")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyApiKey, key)))
+	})
+}
+
+// apiKeyFromContext returns the key of the authenticated request.
+func apiKeyFromContext(ctx context.Context) *model.ApiKey {
+	key, _ := ctx.Value(ctxKeyApiKey).(*model.ApiKey)
+	return key
+}
+
+// checkAccess verifies that the acting key may read or write group groupId.
+func checkAccess(ctx context.Context, groupId int64, write bool) error {
+	key := apiKeyFromContext(ctx)
+	if key == nil {
+		return errUnauthorized
+	}
+	if write {
+		if !key.Access.CanWrite(groupId) {
+			return errors.Wrapf(errForbidden, "no write access to group %d", groupId)
+		}
+		return nil
+	}
+	if !key.Access.CanRead(groupId) {
+		return errors.Wrapf(errForbidden, "no read access to group %d", groupId)
+	}
+	return nil
+}
+
+// actingUser returns the user of the acting key for ItemMeta.CreatedByUser.
+func actingUser(ctx context.Context) model.User {
+	key := apiKeyFromContext(ctx)
+	if key == nil {
+		return model.User{}
+	}
+	return model.User{
+		Id:       key.UserId,
+		Username: key.Username,
+	}
+}
+
+// groupErrorStatus maps errors of groupFromVars to HTTP status codes.
+func groupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, errForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, errNoGroup):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -18,6 +18,24 @@ type S3 struct {
 	SecretAccessKey string `toml:"secretAccessKey"`
 	UseSSL          bool   `toml:"useSSL"`
 }
+
+// AuthKey is a locally configured API key. Read and Write list group ids;
+// "all" grants access to every group.
+type AuthKey struct {
+	Token    string   `toml:"token"`
+	UserId   int64    `toml:"userid"`
+	Username string   `toml:"username"`
+	Read     []string `toml:"read"`
+	Write    []string `toml:"write"`
+}
+
+type Auth struct {
+	// Database enables lookup of keys in the apikeys table
+	Database       bool      `toml:"database"`
+	AllowedOrigins []string  `toml:"allowedorigins"`
+	Keys           []AuthKey `toml:"key"`
+}
+
 type Config struct {
 	Service              string
 	Listen               string
@@ -34,7 +52,11 @@ type Config struct {
 	DB                   Cfg_database `toml:"database"`
 	GroupCacheExpiration string       `toml:"groupcacheexpiration"`
 	SyncSleep            string       `toml:"syncsleep"`
+	SyncParallel         int          `toml:"syncparallel"`
+	SyncStaleAfter       string       `toml:"syncstaleafter"`
+	WebhookInterval      string       `toml:"webhookinterval"`
 	S3                   S3           `toml:"s3"`
+	Auth                 Auth         `toml:"auth"`
 }
 
 func LoadConfig(filepath string) Config {
@@ -0,0 +1,874 @@
+// generator writes the OpenAPI document of the rest service. Item types,
+// fields and creator types are taken from zotero_schema.json, the same
+// source pkg/zotero/model/generator uses for the Go item types.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/je4/zsync/v2/pkg/zotero/dedup"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+type FieldSchema struct {
+	Field     string `json:"field"`
+	BaseField string `json:"baseField,omitempty"`
+}
+
+type CreatorTypeSchema struct {
+	CreatorType string `json:"creatorType"`
+	Primary     bool   `json:"primary,omitempty"`
+}
+
+type ItemTypeSchema struct {
+	ItemType     string              `json:"itemType"`
+	Fields       []FieldSchema       `json:"fields"`
+	CreatorTypes []CreatorTypeSchema `json:"creatorTypes"`
+}
+
+type LocaleSchema struct {
+	ItemTypes    map[string]string `json:"itemTypes"`
+	Fields       map[string]string `json:"fields"`
+	CreatorTypes map[string]string `json:"creatorTypes"`
+}
+
+type Schema struct {
+	Version   int                     `json:"version"`
+	ItemTypes []ItemTypeSchema        `json:"itemTypes"`
+	Locales   map[string]LocaleSchema `json:"locales,omitempty"`
+}
+
+// obj is a JSON object of the document; encoding/json sorts the keys, so
+// the output is deterministic.
+type obj map[string]any
+
+func ref(name string) obj {
+	return obj{"$ref": "#/components/schemas/" + name}
+}
+
+func toPascalCase(s string) string {
+	if s == "" {
+		return ""
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// itemTypeSchemaName matches the struct names of pkg/zotero/model.
+func itemTypeSchemaName(itemType string) string {
+	return "Item" + toPascalCase(itemType)
+}
+
+func findSchemaFile(schemaFlag string) (string, error) {
+	if schemaFlag != "" {
+		if _, err := os.Stat(schemaFlag); err == nil {
+			return schemaFlag, nil
+		}
+	}
+	candidates := []string{
+		"../../pkg/zotero/model/zotero_schema.json",
+		"pkg/zotero/model/zotero_schema.json",
+		"./zotero_schema.json",
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("could not find zotero_schema.json in candidate locations")
+}
+
+func findOutputDir(outFlag string) (string, error) {
+	if outFlag != "" {
+		return outFlag, nil
+	}
+	candidates := []string{
+		"cmd/rest",
+		".",
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(filepath.Join(c, "openapi.go")); err == nil {
+			return c, nil
+		}
+	}
+	return ".", nil
+}
+
+func main() {
+	schemaFlag := flag.String("schema", "", "Path to zotero_schema.json")
+	outFlag := flag.String("out", "", "Output directory for openapi.json")
+	flag.Parse()
+
+	schemaPath, err := findSchemaFile(*schemaFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	outDir, err := findOutputDir(*outFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	schemaBytes, err := os.ReadFile(schemaPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read schema file %s: %v\n", schemaPath, err)
+		os.Exit(1)
+	}
+
+	var schema Schema
+	if err := json.Unmarshal(schemaBytes, &schema); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse schema JSON: %v\n", err)
+		os.Exit(1)
+	}
+
+	doc := obj{
+		"openapi": "3.0.3",
+		"info": obj{
+			"title":       "zsync rest service",
+			"description": fmt.Sprintf("Local Zotero group mirror. Item types and fields follow Zotero schema version %d.", schema.Version),
+			"version":     "2",
+		},
+		"security": []any{
+			obj{"apiKey": []string{}},
+			obj{"bearer": []string{}},
+		},
+		"paths":      buildPaths(),
+		"components": buildComponents(&schema),
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode openapi document: %v\n", err)
+		os.Exit(1)
+	}
+
+	outPath := filepath.Join(outDir, "openapi.json")
+	if err := os.WriteFile(outPath, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", outPath, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Successfully generated %s\n", outPath)
+}
+
+// operation describes one route of cmd/rest/main.go
+type operation struct {
+	method      string
+	path        string
+	id          string
+	summary     string
+	params      []string
+	body        obj
+	bodyType    string
+	response    obj
+	contentType string
+	// status of the success response, default 200
+	status int
+	errors []int
+}
+
+func jsonBody(schema obj) obj {
+	return obj{
+		"required": true,
+		"content":  obj{"application/json": obj{"schema": schema}},
+	}
+}
+
+func arrayOf(schema obj) obj {
+	return obj{"type": "array", "items": schema}
+}
+
+var operations = []operation{
+	{method: "get", path: "/openapi.json", id: "getOpenAPI", summary: "This document",
+		response: obj{"type": "object"}},
+
+	{method: "post", path: "/{groupid}/items", id: "createItem", summary: "Create an item",
+		params: []string{"groupid"}, body: jsonBody(ref("ItemGeneric")), response: ref("Item"), errors: []int{400, 422}},
+	{method: "get", path: "/{groupid}/items", id: "listItems", summary: "List and search items",
+		params:   []string{"groupid", "itemType", "tag", "collection", "q", "since", "sort", "direction", "start", "limit"},
+		response: arrayOf(ref("Item")), errors: []int{400}},
+	{method: "get", path: "/{groupid}/search", id: "searchItems", summary: "Full-text search in title, creators, tags, abstract, notes and attachment text",
+		params:   []string{"groupid", "searchQuery", "itemType", "tag", "collection", "includeTrashed", "language", "start", "limit"},
+		response: arrayOf(ref("SearchResult")), errors: []int{400}},
+	{method: "get", path: "/{groupid}/duplicates", id: "listDuplicates", summary: "Clusters of probably duplicate items with scores",
+		params: []string{"groupid", "threshold"}, response: arrayOf(ref("DuplicateCluster")), errors: []int{400}},
+	{method: "get", path: "/{groupid}/items/{key}", id: "getItem", summary: "Get an item",
+		params: []string{"groupid", "key"}, response: ref("Item"), errors: []int{404}},
+	{method: "put", path: "/{groupid}/items/{key}", id: "replaceItem", summary: "Replace the data of an item",
+		params: []string{"groupid", "key", "If-Match", "If-Unmodified-Since-Version"},
+		body:   jsonBody(ref("ItemGeneric")), response: ref("Item"), errors: []int{400, 404, 412, 428}},
+	{method: "patch", path: "/{groupid}/items/{key}", id: "patchItem", summary: "Change fields of an item (JSON merge patch on the top level fields)",
+		params: []string{"groupid", "key", "If-Match", "If-Unmodified-Since-Version"},
+		body:   jsonBody(obj{"type": "object"}), response: ref("Item"), errors: []int{400, 404, 412, 428}},
+	{method: "delete", path: "/{groupid}/items/{key}", id: "deleteItem", summary: "Mark an item as deleted",
+		params: []string{"groupid", "key"}, response: ref("Item"), errors: []int{404}},
+	{method: "post", path: "/{groupid}/olditems/{oldid}", id: "createOldItem", summary: "Create an item with a legacy id",
+		params: []string{"groupid", "oldid"}, body: jsonBody(ref("ItemGeneric")), response: ref("Item"), errors: []int{400, 422}},
+	{method: "get", path: "/{groupid}/olditems/{oldid}", id: "getOldItem", summary: "Get an item by legacy id",
+		params: []string{"groupid", "oldid"}, response: ref("Item"), errors: []int{404}},
+	{method: "delete", path: "/{groupid}/olditems/{oldid}", id: "deleteOldItem", summary: "Mark an item with legacy id as deleted",
+		params: []string{"groupid", "oldid"}, response: ref("Item"), errors: []int{404}},
+	{method: "post", path: "/{groupid}/items/{key}/attachment", id: "uploadAttachment", summary: "Upload the file of an attachment item",
+		params: []string{"groupid", "key"}, bodyType: "application/octet-stream", response: obj{"type": "string"}, errors: []int{403, 404}},
+	{method: "post", path: "/{groupid}/items/{key}/merge", id: "mergeItems", summary: "Merge duplicates into an item and move them to the trash",
+		params: []string{"groupid", "key"}, body: jsonBody(ref("ItemMerge")), response: ref("Item"), errors: []int{400, 404}},
+	{method: "get", path: "/{groupid}/items/{key}/file", id: "downloadAttachment", summary: "Download the file of an attachment item",
+		params: []string{"groupid", "key", "download"}, contentType: "application/octet-stream", errors: []int{404, 416}},
+	{method: "head", path: "/{groupid}/items/{key}/file", id: "headAttachment", summary: "Check the file of an attachment item",
+		params: []string{"groupid", "key"}, contentType: "application/octet-stream", errors: []int{404}},
+
+	{method: "post", path: "/{groupid}/collections", id: "createCollection", summary: "Create a collection",
+		params: []string{"groupid"}, body: jsonBody(ref("CollectionData")), response: ref("Collection"), errors: []int{400, 422}},
+	{method: "get", path: "/{groupid}/collections", id: "listCollections", summary: "List all collections",
+		params: []string{"groupid"}, response: arrayOf(ref("Collection"))},
+	{method: "get", path: "/{groupid}/collections/top", id: "listTopCollections", summary: "List top level collections",
+		params: []string{"groupid"}, response: arrayOf(ref("Collection"))},
+	{method: "get", path: "/{groupid}/collections/tree", id: "getCollectionForest", summary: "Get the tree of all collections",
+		params: []string{"groupid"}, response: arrayOf(ref("CollectionNode"))},
+	{method: "get", path: "/{groupid}/collectionnames/{name}", id: "getTopCollectionByName", summary: "Get a top level collection by name",
+		params: []string{"groupid", "name"}, response: ref("Collection"), errors: []int{404}},
+	{method: "get", path: "/{groupid}/collections/{key}", id: "getCollection", summary: "Get a collection",
+		params: []string{"groupid", "key"}, response: ref("Collection"), errors: []int{404}},
+	{method: "put", path: "/{groupid}/collections/{key}", id: "replaceCollection", summary: "Rename and move a collection",
+		params: []string{"groupid", "key", "If-Unmodified-Since-Version"},
+		body:   jsonBody(ref("CollectionUpdate")), response: ref("Collection"), errors: []int{400, 404, 409, 412}},
+	{method: "patch", path: "/{groupid}/collections/{key}", id: "patchCollection", summary: "Rename or move a collection",
+		params: []string{"groupid", "key", "If-Unmodified-Since-Version"},
+		body:   jsonBody(ref("CollectionUpdate")), response: ref("Collection"), errors: []int{400, 404, 409, 412}},
+	{method: "delete", path: "/{groupid}/collections/{key}", id: "deleteCollection", summary: "Delete a collection",
+		params: []string{"groupid", "key", "recursive"}, response: ref("DeletedCollections"), errors: []int{404, 409}},
+	{method: "get", path: "/{groupid}/collections/{key}/collections", id: "listSubcollections", summary: "List the subcollections of a collection",
+		params: []string{"groupid", "key"}, response: arrayOf(ref("Collection"))},
+	{method: "get", path: "/{groupid}/collections/{key}/collectionnames/{name}", id: "getSubcollectionByName", summary: "Get a subcollection by name",
+		params: []string{"groupid", "key", "name"}, response: ref("Collection"), errors: []int{404}},
+	{method: "get", path: "/{groupid}/collections/{key}/tree", id: "getCollectionTree", summary: "Get the subtree of a collection",
+		params: []string{"groupid", "key"}, response: arrayOf(ref("CollectionNode")), errors: []int{404}},
+	{method: "get", path: "/{groupid}/collections/{key}/items", id: "listCollectionItems", summary: "List the items of a collection",
+		params: []string{"groupid", "key", "recursive"}, response: arrayOf(ref("Item")), errors: []int{404}},
+
+	{method: "get", path: "/groups", id: "listGroups", summary: "List the readable groups with sync settings and cursors",
+		response: arrayOf(ref("GroupInfo"))},
+	{method: "get", path: "/{groupid}/group", id: "getGroup", summary: "Get the sync settings and cursors of the group",
+		params: []string{"groupid"}, response: ref("GroupInfo")},
+	{method: "patch", path: "/{groupid}/group", id: "updateGroup", summary: "Change the sync settings of the group",
+		params: []string{"groupid"}, body: jsonBody(ref("GroupSettings")), response: ref("GroupInfo"), errors: []int{400}},
+	{method: "post", path: "/{groupid}/group/reset", id: "resetGroup", summary: "Reset the sync cursors of the group",
+		params: []string{"groupid"}, response: ref("GroupInfo"), errors: []int{409}},
+
+	{method: "post", path: "/{groupid}/sync", id: "startSync", summary: "Start a synchronization of the group with Zotero",
+		params: []string{"groupid"}, status: 202, response: ref("SyncRun"), errors: []int{409, 503}},
+	{method: "get", path: "/{groupid}/sync", id: "getSyncState", summary: "Current and latest synchronization runs",
+		params: []string{"groupid", "limit"}, response: ref("SyncState"), errors: []int{400}},
+
+	{method: "get", path: "/{groupid}/changes", id: "streamChanges", summary: "Stream the changes of items and collections as Server-Sent Events",
+		params: []string{"groupid", "Last-Event-ID", "after"}, contentType: "text/event-stream",
+		response: obj{"type": "string", "description": "events \"item\" and \"collection\" with the change sequence as id and a Change as data"},
+		errors:   []int{400}},
+
+	{method: "get", path: "/{groupid}/webhooks", id: "listWebhooks", summary: "List the webhooks of the group",
+		params: []string{"groupid"}, response: arrayOf(ref("Webhook"))},
+	{method: "post", path: "/{groupid}/webhooks", id: "createWebhook", summary: "Subscribe a url to events of the group; the response contains the signing secret",
+		params: []string{"groupid"}, body: jsonBody(ref("WebhookCreate")), status: 201, response: ref("Webhook"), errors: []int{400}},
+	{method: "get", path: "/{groupid}/webhooks/{id}", id: "getWebhook", summary: "Get a webhook",
+		params: []string{"groupid", "id"}, response: ref("Webhook"), errors: []int{404}},
+	{method: "patch", path: "/{groupid}/webhooks/{id}", id: "updateWebhook", summary: "Change url, events or active state of a webhook",
+		params: []string{"groupid", "id"}, body: jsonBody(ref("WebhookUpdate")), response: ref("Webhook"), errors: []int{400, 404}},
+	{method: "delete", path: "/{groupid}/webhooks/{id}", id: "deleteWebhook", summary: "Delete a webhook and its pending deliveries",
+		params: []string{"groupid", "id"}, response: ref("Webhook"), errors: []int{404}},
+	{method: "get", path: "/{groupid}/webhooks/{id}/deliveries", id: "listWebhookDeliveries", summary: "Latest deliveries of a webhook",
+		params: []string{"groupid", "id", "limit"}, response: arrayOf(ref("WebhookDelivery")), errors: []int{400, 404}},
+}
+
+func buildPaths() obj {
+	paths := obj{}
+	for _, op := range operations {
+		item, ok := paths[op.path].(obj)
+		if !ok {
+			item = obj{}
+			paths[op.path] = item
+		}
+		params := []any{}
+		for _, p := range op.params {
+			params = append(params, obj{"$ref": "#/components/parameters/" + p})
+		}
+		o := obj{
+			"operationId": op.id,
+			"summary":     op.summary,
+			"tags":        []string{operationTag(op.path)},
+		}
+		if len(params) > 0 {
+			o["parameters"] = params
+		}
+		if op.path == "/openapi.json" {
+			o["security"] = []any{}
+		}
+		if op.body != nil {
+			o["requestBody"] = op.body
+		}
+		if op.bodyType != "" {
+			o["requestBody"] = obj{
+				"required": true,
+				"content":  obj{op.bodyType: obj{"schema": obj{"type": "string", "format": "binary"}}},
+			}
+		}
+		status := op.status
+		if status == 0 {
+			status = 200
+		}
+		ok200 := obj{"description": http.StatusText(status)}
+		switch {
+		case op.contentType != "" && op.response != nil:
+			ok200["content"] = obj{op.contentType: obj{"schema": op.response}}
+		case op.contentType != "":
+			ok200["content"] = obj{op.contentType: obj{"schema": obj{"type": "string", "format": "binary"}}}
+		case op.response != nil:
+			ok200["content"] = obj{"application/json": obj{"schema": op.response}}
+		}
+		responses := obj{fmt.Sprint(status): ok200}
+		if op.path != "/openapi.json" {
+			for _, code := range []int{401, 403} {
+				responses[fmt.Sprint(code)] = obj{"$ref": fmt.Sprintf("#/components/responses/%d", code)}
+			}
+		}
+		for _, code := range op.errors {
+			responses[fmt.Sprint(code)] = obj{"$ref": fmt.Sprintf("#/components/responses/%d", code)}
+		}
+		o["responses"] = responses
+		item[op.method] = o
+	}
+	return paths
+}
+
+// operationTag groups the operations by the resource of the path
+func operationTag(path string) string {
+	switch {
+	case path == "/openapi.json":
+		return "meta"
+	case strings.HasSuffix(path, "/sync"):
+		return "sync"
+	case strings.HasSuffix(path, "/changes"):
+		return "changes"
+	case strings.HasPrefix(path, "/{groupid}/webhooks"):
+		return "webhooks"
+	case path == "/groups" || strings.HasPrefix(path, "/{groupid}/group"):
+		return "groups"
+	case strings.HasPrefix(path, "/{groupid}/collection"):
+		return "collections"
+	default:
+		return "items"
+	}
+}
+
+func queryParam(name, description string, schema obj) obj {
+	return obj{"name": name, "in": "query", "description": description, "schema": schema}
+}
+
+func headerParam(name, description string) obj {
+	return obj{"name": name, "in": "header", "description": description, "schema": obj{"type": "string"}}
+}
+
+func buildComponents(schema *Schema) obj {
+	sortFields := make([]string, 0, len(storage.ItemQuerySortFields))
+	for name := range storage.ItemQuerySortFields {
+		sortFields = append(sortFields, name)
+	}
+	sort.Strings(sortFields)
+
+	directions := make([]string, 0, len(model.SyncDirectionId))
+	for name := range model.SyncDirectionId {
+		directions = append(directions, name)
+	}
+	sort.Strings(directions)
+	syncStates := make([]string, 0, len(model.SyncStatusId))
+	for name := range model.SyncStatusId {
+		syncStates = append(syncStates, name)
+	}
+	sort.Strings(syncStates)
+	searchLanguages := make([]string, 0, len(storage.SearchLanguages))
+	for name := range storage.SearchLanguages {
+		searchLanguages = append(searchLanguages, name)
+	}
+	sort.Strings(searchLanguages)
+	webhookEvents := make([]string, 0, len(model.WebhookEvents))
+	for _, event := range model.WebhookEvents {
+		webhookEvents = append(webhookEvents, string(event))
+	}
+
+	parameters := obj{
+		"groupid":                     obj{"name": "groupid", "in": "path", "required": true, "schema": obj{"type": "integer", "format": "int64"}},
+		"key":                         obj{"name": "key", "in": "path", "required": true, "schema": obj{"type": "string"}},
+		"oldid":                       obj{"name": "oldid", "in": "path", "required": true, "schema": obj{"type": "string"}},
+		"name":                        obj{"name": "name", "in": "path", "required": true, "schema": obj{"type": "string"}},
+		"id":                          obj{"name": "id", "in": "path", "required": true, "schema": obj{"type": "integer", "format": "int64"}},
+		"itemType":                    queryParam("itemType", "item type, negated with a leading '-', alternatives separated by '||'", obj{"type": "string"}),
+		"tag":                         obj{"name": "tag", "in": "query", "description": "tag filter, repeatable (all must match)", "schema": arrayOf(obj{"type": "string"}), "explode": true},
+		"collection":                  queryParam("collection", "key of a collection containing the items", obj{"type": "string"}),
+		"q":                           queryParam("q", "quick search in title and creators", obj{"type": "string"}),
+		"searchQuery":                 obj{"name": "q", "in": "query", "required": true, "description": "web search syntax: words, \"quoted phrases\", or, -excluded", "schema": obj{"type": "string", "minLength": 1}},
+		"includeTrashed":              queryParam("includeTrashed", "include items in the trash", obj{"type": "boolean"}),
+		"threshold":                   queryParam("threshold", "lowest score of a reported match", obj{"type": "number", "minimum": 0, "maximum": 1, "default": dedup.DefaultThreshold}),
+		"language":                    queryParam("language", "stem the query words in this language, e.g. en or german; default is exact words", obj{"type": "string", "enum": searchLanguages}),
+		"since":                       queryParam("since", "only items with a higher version", obj{"type": "integer", "format": "int64", "minimum": 0}),
+		"sort":                        queryParam("sort", "sort field", obj{"type": "string", "enum": sortFields}),
+		"direction":                   queryParam("direction", "sort direction", obj{"type": "string", "enum": []string{"asc", "desc"}}),
+		"start":                       queryParam("start", "offset of the first result", obj{"type": "integer", "minimum": 0}),
+		"limit":                       queryParam("limit", "maximum number of results", obj{"type": "integer", "minimum": 0, "maximum": storage.MaxQueryLimit}),
+		"recursive":                   queryParam("recursive", "include subcollections", obj{"type": "boolean"}),
+		"download":                    queryParam("download", "send as attachment instead of inline", obj{"type": "boolean"}),
+		"If-Match":                    headerParam("If-Match", "ETag of the stored item"),
+		"If-Unmodified-Since-Version": headerParam("If-Unmodified-Since-Version", "version of the stored object"),
+		"Last-Event-ID":               headerParam("Last-Event-ID", "sequence of the last received change, sent by reconnecting EventSource clients"),
+		"after":                       queryParam("after", "sequence of the last known change, default is the newest change", obj{"type": "integer", "format": "int64", "minimum": 0}),
+	}
+
+	responses := obj{}
+	for code, description := range map[int]string{
+		400: "Bad request or body does not match the schema",
+		401: "Missing or unknown API key",
+		403: "No access to the group",
+		404: "Not found",
+		409: "Conflict",
+		412: "Precondition failed",
+		416: "Range not satisfiable",
+		422: "Cannot store the object",
+		428: "Precondition required",
+		503: "Service unavailable",
+	} {
+		schemaName := "Error"
+		if code == 400 {
+			schemaName = "ValidationError"
+		}
+		responses[fmt.Sprint(code)] = obj{
+			"description": description,
+			"content":     obj{"application/json": obj{"schema": ref(schemaName)}},
+		}
+	}
+
+	stringType := obj{"type": "string"}
+	stringList := arrayOf(stringType)
+	schemas := obj{
+		"Error": obj{
+			"type":       "object",
+			"required":   []string{"error"},
+			"properties": obj{"error": stringType},
+		},
+		"ValidationError": obj{
+			"type":     "object",
+			"required": []string{"error"},
+			"properties": obj{
+				"error": stringType,
+				"details": arrayOf(obj{
+					"type":     "object",
+					"required": []string{"path", "message"},
+					"properties": obj{
+						"path":    obj{"type": "string", "description": "JSON pointer into the request body"},
+						"message": stringType,
+					},
+				}),
+			},
+		},
+		"Library": obj{
+			"type": "object",
+			"properties": obj{
+				"type":  stringType,
+				"id":    obj{"type": "integer", "format": "int64"},
+				"name":  stringType,
+				"links": obj{"type": "object"},
+			},
+		},
+		"User": obj{
+			"type": "object",
+			"properties": obj{
+				"id":       obj{"type": "integer", "format": "int64"},
+				"username": stringType,
+				"links":    obj{"type": "object"},
+			},
+		},
+		"ItemMeta": obj{
+			"type": "object",
+			"properties": obj{
+				"createdByUser":  ref("User"),
+				"creatorSummary": stringType,
+				"parsedDate":     stringType,
+				"numChildren":    obj{"type": "integer", "format": "int64"},
+			},
+		},
+		"Tag": obj{
+			"type":                 "object",
+			"required":             []string{"tag"},
+			"additionalProperties": false,
+			"properties": obj{
+				"tag":  obj{"type": "string", "minLength": 1},
+				"type": obj{"type": "integer", "enum": []int{0, 1}},
+			},
+		},
+		"Relations": obj{
+			"description": "predicate to object URI or list of URIs; an empty list is accepted for no relations",
+			"oneOf": []any{
+				obj{
+					"type":                 "object",
+					"additionalProperties": obj{"oneOf": []any{stringType, stringList}},
+				},
+				obj{"type": "array", "maxItems": 0},
+			},
+		},
+		"Item": obj{
+			"type": "object",
+			"properties": obj{
+				"key":     stringType,
+				"version": obj{"type": "integer", "format": "int64"},
+				"library": ref("Library"),
+				"links":   obj{"type": "object"},
+				"meta":    ref("ItemMeta"),
+				"data":    ref("ItemGeneric"),
+			},
+		},
+		"SearchResult": obj{
+			"type": "object",
+			"properties": obj{
+				"item": ref("Item"),
+				"rank": obj{"type": "number"},
+				"highlights": obj{
+					"type":        "object",
+					"description": "matching words are marked with <b> and </b>",
+					"properties": obj{
+						"title":   stringType,
+						"snippet": obj{"type": "string", "description": "excerpt of abstract, notes or attachment text"},
+					},
+				},
+			},
+		},
+		"DuplicateCluster": obj{
+			"type": "object",
+			"properties": obj{
+				"master": obj{"type": "string", "description": "key of the oldest item"},
+				"score":  obj{"type": "number", "description": "lowest score of the matches"},
+				"items":  arrayOf(ref("Item")),
+				"matches": arrayOf(obj{
+					"type": "object",
+					"properties": obj{
+						"keys":    obj{"type": "array", "items": stringType, "minItems": 2, "maxItems": 2},
+						"score":   obj{"type": "number"},
+						"reasons": arrayOf(obj{"type": "string", "enum": []string{"doi", "isbn", "title", "year", "creators"}}),
+					},
+				}),
+			},
+		},
+		"ItemMerge": obj{
+			"type":                 "object",
+			"additionalProperties": false,
+			"required":             []string{"keys"},
+			"properties": obj{
+				"keys": obj{"type": "array", "items": stringType, "minItems": 1, "description": "keys of the items merged into the item of the path"},
+			},
+		},
+		"CollectionMeta": obj{
+			"type": "object",
+			"properties": obj{
+				"numCollections": obj{"type": "integer", "format": "int64"},
+				"numItems":       obj{"type": "integer", "format": "int64"},
+			},
+		},
+		"ParentCollection": obj{
+			"description": "key of the parent collection or false for top level collections",
+			"oneOf": []any{
+				obj{"type": "string"},
+				obj{"type": "boolean", "enum": []bool{false}},
+			},
+		},
+		"CollectionData": obj{
+			"type":                 "object",
+			"required":             []string{"name"},
+			"additionalProperties": false,
+			"properties": obj{
+				"key":              stringType,
+				"name":             obj{"type": "string", "minLength": 1},
+				"version":          obj{"type": "integer", "format": "int64", "minimum": 0},
+				"relations":        obj{"oneOf": []any{obj{"type": "object", "additionalProperties": stringType}, obj{"type": "array", "maxItems": 0}}},
+				"parentCollection": ref("ParentCollection"),
+			},
+		},
+		"CollectionUpdate": obj{
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties": obj{
+				"name":             obj{"type": "string", "minLength": 1},
+				"parentCollection": obj{"allOf": []any{ref("ParentCollection")}, "nullable": true},
+			},
+		},
+		"Collection": obj{
+			"type": "object",
+			"properties": obj{
+				"key":     stringType,
+				"version": obj{"type": "integer", "format": "int64"},
+				"library": ref("Library"),
+				"links":   obj{"type": "object"},
+				"meta":    ref("CollectionMeta"),
+				"data":    ref("CollectionData"),
+			},
+		},
+		"CollectionNode": obj{
+			"type": "object",
+			"properties": obj{
+				"collection": ref("Collection"),
+				"children":   arrayOf(ref("CollectionNode")),
+			},
+		},
+		"GroupInfo": obj{
+			"type": "object",
+			"properties": obj{
+				"id":                obj{"type": "integer", "format": "int64"},
+				"name":              stringType,
+				"version":           obj{"type": "integer", "format": "int64"},
+				"deleted":           obj{"type": "boolean"},
+				"active":            obj{"type": "boolean"},
+				"direction":         ref("SyncDirection"),
+				"syncTags":          obj{"type": "boolean"},
+				"itemVersion":       obj{"type": "integer", "format": "int64"},
+				"collectionVersion": obj{"type": "integer", "format": "int64"},
+				"tagVersion":        obj{"type": "integer", "format": "int64"},
+				"gitlab":            obj{"type": "string", "format": "date-time"},
+			},
+		},
+		"GroupSettings": obj{
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties": obj{
+				"active":    obj{"type": "boolean"},
+				"direction": ref("SyncDirection"),
+				"syncTags":  obj{"type": "boolean"},
+			},
+		},
+		"SyncDirection": obj{"type": "string", "enum": directions},
+		"SyncRun": obj{
+			"type": "object",
+			"properties": obj{
+				"id":          obj{"type": "integer", "format": "int64"},
+				"groupId":     obj{"type": "integer", "format": "int64"},
+				"status":      obj{"type": "string", "enum": []string{"queued", "running", "succeeded", "failed"}},
+				"trigger":     stringType,
+				"requestedBy": stringType,
+				"requested":   obj{"type": "string", "format": "date-time"},
+				"started":     obj{"type": "string", "format": "date-time"},
+				"finished":    obj{"type": "string", "format": "date-time"},
+				"stage":       obj{"type": "string", "description": "current stage, or failed stage of failed runs"},
+				"collections": obj{"type": "integer", "format": "int64"},
+				"uploaded":    obj{"type": "integer", "format": "int64"},
+				"downloaded":  obj{"type": "integer", "format": "int64"},
+				"tags":        obj{"type": "integer", "format": "int64"},
+				"deleted":     obj{"type": "integer", "format": "int64"},
+				"error":       stringType,
+			},
+		},
+		"SyncState": obj{
+			"type": "object",
+			"properties": obj{
+				"current": obj{"allOf": []any{ref("SyncRun")}, "nullable": true},
+				"runs":    arrayOf(ref("SyncRun")),
+			},
+		},
+		"Change": obj{
+			"type": "object",
+			"properties": obj{
+				"seq":        obj{"type": "integer", "format": "int64"},
+				"library":    obj{"type": "integer", "format": "int64"},
+				"objectType": obj{"type": "string", "enum": []string{"item", "collection"}},
+				"key":        stringType,
+				"version":    obj{"type": "integer", "format": "int64"},
+				"sync":       obj{"type": "string", "enum": syncStates},
+				"changeType": obj{"type": "string", "enum": []string{string(model.ChangeType_Create), string(model.ChangeType_Update), string(model.ChangeType_Delete)}},
+				"changed":    obj{"type": "string", "format": "date-time"},
+			},
+		},
+		"WebhookEvent": obj{"type": "string", "enum": webhookEvents},
+		"Webhook": obj{
+			"type": "object",
+			"properties": obj{
+				"id":      obj{"type": "integer", "format": "int64"},
+				"groupId": obj{"type": "integer", "format": "int64"},
+				"url":     obj{"type": "string", "format": "uri"},
+				"secret":  obj{"type": "string", "description": "HMAC-SHA256 key of the X-Zsync-Signature header, only returned on creation"},
+				"events":  arrayOf(ref("WebhookEvent")),
+				"active":  obj{"type": "boolean"},
+				"created": obj{"type": "string", "format": "date-time"},
+			},
+		},
+		"WebhookCreate": obj{
+			"type":                 "object",
+			"additionalProperties": false,
+			"required":             []string{"url", "events"},
+			"properties": obj{
+				"url":    obj{"type": "string", "format": "uri", "minLength": 1},
+				"events": arrayOf(ref("WebhookEvent")),
+				"active": obj{"type": "boolean"},
+			},
+		},
+		"WebhookUpdate": obj{
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties": obj{
+				"url":    obj{"type": "string", "format": "uri", "minLength": 1},
+				"events": arrayOf(ref("WebhookEvent")),
+				"active": obj{"type": "boolean"},
+			},
+		},
+		"WebhookDelivery": obj{
+			"type": "object",
+			"properties": obj{
+				"id":             obj{"type": "integer", "format": "int64"},
+				"webhookId":      obj{"type": "integer", "format": "int64"},
+				"event":          ref("WebhookEvent"),
+				"status":         obj{"type": "string", "enum": []string{string(model.WebhookDeliveryStatus_Pending), string(model.WebhookDeliveryStatus_Delivered), string(model.WebhookDeliveryStatus_Failed)}},
+				"attempts":       obj{"type": "integer", "format": "int64"},
+				"nextAttempt":    obj{"type": "string", "format": "date-time"},
+				"responseStatus": obj{"type": "integer"},
+				"lastError":      stringType,
+				"created":        obj{"type": "string", "format": "date-time"},
+				"delivered":      obj{"type": "string", "format": "date-time"},
+			},
+		},
+		"DeletedCollections": obj{
+			"type":       "object",
+			"properties": obj{"deleted": stringList},
+		},
+	}
+
+	var enUS LocaleSchema
+	if schema.Locales != nil {
+		enUS = schema.Locales["en-US"]
+	}
+
+	itemTypes := make([]ItemTypeSchema, len(schema.ItemTypes))
+	copy(itemTypes, schema.ItemTypes)
+	sort.Slice(itemTypes, func(i, j int) bool {
+		return itemTypes[i].ItemType < itemTypes[j].ItemType
+	})
+
+	itemTypeNames := []string{}
+	fieldNames := map[string]struct{}{}
+	creatorTypeNames := map[string]struct{}{}
+	mapping := obj{}
+	oneOf := []any{}
+	for _, it := range itemTypes {
+		name := itemTypeSchemaName(it.ItemType)
+		itemTypeNames = append(itemTypeNames, it.ItemType)
+		mapping[it.ItemType] = "#/components/schemas/" + name
+		oneOf = append(oneOf, ref(name))
+
+		creatorTypes := []string{}
+		for _, ct := range it.CreatorTypes {
+			creatorTypes = append(creatorTypes, ct.CreatorType)
+			creatorTypeNames[ct.CreatorType] = struct{}{}
+		}
+		sort.Strings(creatorTypes)
+		creator := obj{
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties": obj{
+				"firstName": stringType,
+				"lastName":  stringType,
+				"name":      stringType,
+			},
+		}
+		creators := arrayOf(creator)
+		if len(creatorTypes) > 0 {
+			creator["required"] = []string{"creatorType"}
+			creator["properties"].(obj)["creatorType"] = obj{"type": "string", "enum": creatorTypes}
+		} else {
+			creators["maxItems"] = 0
+		}
+
+		properties := obj{
+			"key":          stringType,
+			"version":      obj{"type": "integer", "format": "int64", "minimum": 0},
+			"itemType":     obj{"type": "string", "enum": []string{it.ItemType}},
+			"tags":         arrayOf(ref("Tag")),
+			"relations":    ref("Relations"),
+			"parentItem":   stringType,
+			"collections":  stringList,
+			"dateAdded":    stringType,
+			"dateModified": stringType,
+			"creators":     creators,
+		}
+		fields := make([]FieldSchema, len(it.Fields))
+		copy(fields, it.Fields)
+		switch it.ItemType {
+		case "attachment":
+			fields = append(fields, FieldSchema{Field: "linkMode"}, FieldSchema{Field: "note"}, FieldSchema{Field: "contentType"},
+				FieldSchema{Field: "charset"}, FieldSchema{Field: "filename"}, FieldSchema{Field: "md5"})
+			properties["mtime"] = obj{"type": "integer", "format": "int64"}
+		case "note":
+			fields = append(fields, FieldSchema{Field: "note"})
+		}
+		for _, f := range fields {
+			field := obj{"type": "string"}
+			if label := enUS.Fields[f.Field]; label != "" {
+				field["description"] = label
+			}
+			properties[f.Field] = field
+			fieldNames[f.Field] = struct{}{}
+		}
+		if _, ok := properties["mtime"]; ok {
+			fieldNames["mtime"] = struct{}{}
+		}
+		s := obj{
+			"type":                 "object",
+			"required":             []string{"itemType"},
+			"additionalProperties": false,
+			"properties":           properties,
+		}
+		if label := enUS.ItemTypes[it.ItemType]; label != "" {
+			s["description"] = label
+		}
+		schemas[name] = s
+	}
+
+	schemas["ItemGeneric"] = obj{
+		"description": "item data; the allowed fields and creator types depend on itemType",
+		"type":        "object",
+		"required":    []string{"itemType"},
+		"oneOf":       oneOf,
+		"discriminator": obj{
+			"propertyName": "itemType",
+			"mapping":      mapping,
+		},
+	}
+	schemas["ItemType"] = obj{"type": "string", "enum": itemTypeNames}
+	schemas["ItemField"] = obj{"type": "string", "enum": sortedKeys(fieldNames)}
+	schemas["CreatorType"] = obj{"type": "string", "enum": sortedKeys(creatorTypeNames)}
+
+	return obj{
+		"securitySchemes": obj{
+			"apiKey": obj{"type": "apiKey", "in": "header", "name": "Zotero-API-Key"},
+			"bearer": obj{"type": "http", "scheme": "bearer"},
+		},
+		"parameters": parameters,
+		"responses":  responses,
+		"schemas":    schemas,
+	}
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/md5"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -14,6 +16,7 @@ import (
 	"github.com/je4/zsync/v2/pkg/zotero/client"
 	"github.com/je4/zsync/v2/pkg/zotero/model"
 	"github.com/je4/zsync/v2/pkg/zotero/storage"
+	zotsync "github.com/je4/zsync/v2/pkg/zotero/sync"
 	"github.com/maypok86/otter/v2"
 	"github.com/op/go-logging"
 )
@@ -22,12 +25,18 @@ type Handlers struct {
 	groups  *otter.Cache[int64, *model.Group]
 	cfg     *Config
 	logger  *logging.Logger
-	storage *storage.Storage
+	storage storage.Store
 	client  *client.Client
 	fs      filesystem.FileSystem
+	keys    []configKey
+	dbKeys  *otter.Cache[string, *model.ApiKey]
+	runner  *zotsync.Runner
+	changes *changeBroker
 }
 
-func NewHandler(storage *storage.Storage, client *client.Client, fs filesystem.FileSystem, cfg *Config, logger *logging.Logger) *Handlers {
+// NewHandler creates the handlers of the rest service. runner may be nil if
+// no zotero endpoint is configured.
+func NewHandler(storage storage.Store, client *client.Client, fs filesystem.FileSystem, runner *zotsync.Runner, cfg *Config, logger *logging.Logger) *Handlers {
 	exp, err := time.ParseDuration(cfg.GroupCacheExpiration)
 	if err != nil {
 		log.Fatalf("error parsing expiration: %v", err)
@@ -41,6 +50,14 @@ func NewHandler(storage *storage.Storage, client *client.Client, fs filesystem.F
 		log.Fatalf("error initializing otter cache: %v", err)
 	}
 
+	keyCache, err := otter.New(&otter.Options[string, *model.ApiKey]{
+		MaximumSize:      500,
+		ExpiryCalculator: otter.ExpiryWriting[string, *model.ApiKey](exp),
+	})
+	if err != nil {
+		log.Fatalf("error initializing otter cache: %v", err)
+	}
+
 	handlers := &Handlers{
 		storage: storage,
 		client:  client,
@@ -48,6 +65,10 @@ func NewHandler(storage *storage.Storage, client *client.Client, fs filesystem.F
 		cfg:     cfg,
 		logger:  logger,
 		groups:  cache,
+		keys:    newConfigKeys(cfg.Auth.Keys),
+		dbKeys:  keyCache,
+		runner:  runner,
+		changes: newChangeBroker(),
 	}
 	return handlers
 }
@@ -64,6 +85,16 @@ func respondWithJSON(w http.ResponseWriter, code int, payload any) {
 	w.Write(response)
 }
 
+// clearWriteDeadline lifts the server's write timeout for long responses.
+// The access log writer does not implement Unwrap, so http.ResponseController
+// needs the wrapped writer.
+func clearWriteDeadline(w http.ResponseWriter) error {
+	if lw, ok := w.(interface{ WrappedWriter() http.ResponseWriter }); ok {
+		w = lw.WrappedWriter()
+	}
+	return http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
+
 func (handlers *Handlers) getGroup(ctx context.Context, groupId int64) (*model.Group, error) {
 	group, ok := handlers.groups.GetIfPresent(groupId)
 	if !ok {
@@ -77,14 +108,38 @@ func (handlers *Handlers) getGroup(ctx context.Context, groupId int64) (*model.G
 	return group, nil
 }
 
-func (handlers *Handlers) groupFromVars(ctx context.Context, vars map[string]string) (*model.Group, error) {
+var errNoGroup = errors.New("invalid group")
+
+// groupFromVars loads the group of the request and checks that the acting key
+// may read it, or modify it if write is set.
+func (handlers *Handlers) groupFromVars(ctx context.Context, vars map[string]string, write bool) (*model.Group, error) {
 	groupidstr, ok := vars["groupid"]
 	if !ok {
-		return nil, errors.New("no groupid")
+		return nil, errors.Wrap(errNoGroup, "no groupid")
 	}
 	groupid, err := strconv.ParseInt(groupidstr, 10, 64)
 	if err != nil {
-		return nil, errors.Wrapf(err, "groupid not a number #%v", groupidstr)
+		return nil, errors.Wrapf(errNoGroup, "groupid not a number #%v", groupidstr)
+	}
+	if err := checkAccess(ctx, groupid, write); err != nil {
+		return nil, err
 	}
 	return handlers.getGroup(ctx, groupid)
 }
+
+// itemETag identifies the stored state of item. Local changes keep the Zotero
+// version until the next sync, so the data is hashed as well.
+func itemETag(item *model.Item) string {
+	data, err := json.Marshal(item.Data)
+	if err != nil {
+		return fmt.Sprintf(`"%d"`, item.Version)
+	}
+	// ItemGeneric marshals extra fields from a map, so normalize the order
+	var canonical any
+	if err := json.Unmarshal(data, &canonical); err == nil {
+		if normalized, err := json.Marshal(canonical, json.Deterministic(true)); err == nil {
+			data = normalized
+		}
+	}
+	return fmt.Sprintf(`"%d-%x"`, item.Version, md5.Sum(data))
+}
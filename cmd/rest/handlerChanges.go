@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+	"github.com/op/go-logging"
+)
+
+const (
+	// changesBatch is the number of changes read per query
+	changesBatch = 100
+	// changesKeepAlive is the interval of comments on idle streams, which
+	// keep proxies from closing the connection
+	changesKeepAlive = 15 * time.Second
+	// changesRetry is the reconnection delay suggested to clients
+	changesRetry = 5 * time.Second
+	// changesReconnect is the delay before listening again after a failed
+	// database connection
+	changesReconnect = 5 * time.Second
+)
+
+// changeBroker listens for change notifications of the database and wakes
+// the change streams of the notified group.
+type changeBroker struct {
+	mu          sync.Mutex
+	subscribers map[int64]map[chan struct{}]struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+func newChangeBroker() *changeBroker {
+	return &changeBroker{
+		subscribers: map[int64]map[chan struct{}]struct{}{},
+		done:        make(chan struct{}),
+	}
+}
+
+// subscribe returns a channel, which receives a value after changes of the
+// group, and a function to cancel the subscription.
+func (b *changeBroker) subscribe(groupId int64) (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[groupId] == nil {
+		b.subscribers[groupId] = map[chan struct{}]struct{}{}
+	}
+	b.subscribers[groupId][wake] = struct{}{}
+	return wake, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers[groupId], wake)
+		if len(b.subscribers[groupId]) == 0 {
+			delete(b.subscribers, groupId)
+		}
+	}
+}
+
+// notify wakes the subscribers of groupId. A subscriber which has not yet
+// handled its last wake-up is not woken twice.
+func (b *changeBroker) notify(groupId int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for wake := range b.subscribers[groupId] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notifyAll wakes all subscribers, e.g. after notifications may have been
+// lost.
+func (b *changeBroker) notifyAll() {
+	b.mu.Lock()
+	groupIds := make([]int64, 0, len(b.subscribers))
+	for groupId := range b.subscribers {
+		groupIds = append(groupIds, groupId)
+	}
+	b.mu.Unlock()
+	for _, groupId := range groupIds {
+		b.notify(groupId)
+	}
+}
+
+// close ends all change streams
+func (b *changeBroker) close() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+// run listens for notifications until ctx is done and reconnects after
+// database errors. onChange, if not nil, is called with every notification,
+// e.g. to deliver the webhook events written with the change.
+func (b *changeBroker) run(ctx context.Context, st storage.Store, onChange func(), logger *logging.Logger) {
+	for {
+		err := st.ListenChanges(ctx, func(library int64, seq int64) {
+			b.notify(library)
+			if onChange != nil {
+				onChange()
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Errorf("cannot listen for changes: %v", err)
+		// streams catch up with the changes missed while disconnected
+		b.notifyAll()
+		if onChange != nil {
+			onChange()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(changesReconnect):
+		}
+	}
+}
+
+// changeCursor returns the sequence number after which the stream starts: the
+// Last-Event-ID header of a reconnecting client, the parameter after or, for
+// new clients, the newest change of the group.
+func (handlers *Handlers) changeCursor(ctx context.Context, r *http.Request, groupId int64) (int64, bool, error) {
+	str := r.Header.Get("Last-Event-ID")
+	if str == "" {
+		str = r.URL.Query().Get("after")
+	}
+	if str == "" {
+		seq, err := handlers.storage.LatestChangeSeq(ctx, groupId)
+		return seq, true, err
+	}
+	seq, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, false, nil
+	}
+	return seq, true, nil
+}
+
+// makeChangesHandler serves GET /{groupid}/changes as Server-Sent Events
+// stream. Every change of an item or collection is sent as event "item" or
+// "collection" with the sequence number as id, so EventSource clients resume
+// after reconnects without gaps.
+func (handlers *Handlers) makeChangesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		// get groups object from cache
+		group, err := handlers.groupFromVars(ctx, vars, false)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		// subscribe before reading the cursor, so no change is missed
+		wake, unsubscribe := handlers.changes.subscribe(group.Id)
+		defer unsubscribe()
+		after, ok, err := handlers.changeCursor(ctx, r, group.Id)
+		if err != nil {
+			handlers.logger.Errorf("cannot get latest change of group %v: %v", group.Id, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot get latest change of group %v: %v", group.Id, err))
+			return
+		}
+		if !ok {
+			respondWithError(w, http.StatusBadRequest, "invalid Last-Event-ID or after")
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		if err := clearWriteDeadline(w); err != nil {
+			handlers.logger.Debugf("cannot clear write deadline: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if _, err := fmt.Fprintf(w, "retry: %d\n\n", changesRetry.Milliseconds()); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			handlers.logger.Errorf("cannot flush change stream: %v", err)
+			return
+		}
+
+		keepAlive := time.NewTicker(changesKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			for {
+				changes, err := handlers.storage.GetChanges(ctx, group.Id, after, changesBatch)
+				if err != nil {
+					if ctx.Err() == nil {
+						handlers.logger.Errorf("cannot get changes of group %v: %v", group.Id, err)
+					}
+					return
+				}
+				for _, change := range changes {
+					data, err := json.Marshal(change)
+					if err != nil {
+						handlers.logger.Errorf("cannot marshal change %v: %v", change.Seq, err)
+						return
+					}
+					if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", change.Seq, change.ObjectType, data); err != nil {
+						return
+					}
+					after = change.Seq
+				}
+				if len(changes) < changesBatch {
+					break
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-handlers.changes.done:
+				return
+			case <-wake:
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/mux"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+// boolParam reports whether the query parameter name is set to a true value.
+// A parameter without value counts as true.
+func boolParam(r *http.Request, name string) bool {
+	values, ok := r.URL.Query()[name]
+	if !ok {
+		return false
+	}
+	if len(values) == 0 || values[0] == "" {
+		return true
+	}
+	b, _ := strconv.ParseBool(values[0])
+	return b
+}
+
+// makeCollectionListHandler lists subcollections of {key}. Without key it
+// lists the top-level collections if top is set and all collections otherwise.
+func (handlers *Handlers) makeCollectionListHandler(top bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		// get groups object from cache
+		group, err := handlers.groupFromVars(ctx, vars, false)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		key, hasKey := vars["key"]
+		var colls []*model.Collection
+		if hasKey || top {
+			colls, err = handlers.storage.GetCollectionChildren(ctx, group.Id, key)
+		} else {
+			colls = []*model.Collection{}
+			err = handlers.storage.IterateCollections(ctx, group.Id, nil, func(coll *model.Collection) error {
+				colls = append(colls, coll)
+				return nil
+			})
+		}
+		if err != nil {
+			handlers.logger.Errorf("cannot list collections of %v.%v: %v", group.Id, key, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot list collections of %v.%v: %v", group.Id, key, err))
+			return
+		}
+		w.Header().Set("Total-Results", strconv.Itoa(len(colls)))
+		respondWithJSON(w, http.StatusOK, colls)
+	}
+}
+
+// makeCollectionKeyHandler returns the collection {key}.
+func (handlers *Handlers) makeCollectionKeyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		// get groups object from cache
+		group, err := handlers.groupFromVars(ctx, vars, false)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		key := vars["key"]
+		coll, err := handlers.storage.GetCollectionByKey(ctx, group.Id, key)
+		if err != nil {
+			handlers.logger.Errorf("cannot get collection %v.%v: %v", group.Id, key, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot get collection %v.%v: %v", group.Id, key, err))
+			return
+		}
+		if coll == nil || coll.Deleted {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("collection %v.%v not found", group.Id, key))
+			return
+		}
+		respondWithJSON(w, http.StatusOK, coll)
+	}
+}
+
+// makeCollectionTreeHandler returns the subtree of {key}, or the trees of all
+// top-level collections.
+func (handlers *Handlers) makeCollectionTreeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		// get groups object from cache
+		group, err := handlers.groupFromVars(ctx, vars, false)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		key := vars["key"]
+		tree, err := handlers.storage.GetCollectionTree(ctx, group.Id, key)
+		if err != nil {
+			handlers.logger.Errorf("cannot get collection tree %v.%v: %v", group.Id, key, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot get collection tree %v.%v: %v", group.Id, key, err))
+			return
+		}
+		if key != "" && len(tree) == 0 {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("collection %v.%v not found", group.Id, key))
+			return
+		}
+		respondWithJSON(w, http.StatusOK, tree)
+	}
+}
+
+// makeCollectionItemsHandler returns the items of {key}; with the parameter
+// recursive the items of all subcollections are included.
+func (handlers *Handlers) makeCollectionItemsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		// get groups object from cache
+		group, err := handlers.groupFromVars(ctx, vars, false)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		key := vars["key"]
+		items, err := handlers.storage.GetItemsInCollection(ctx, group.Id, key, boolParam(r, "recursive"))
+		if err != nil {
+			handlers.logger.Errorf("cannot get items of collection %v.%v: %v", group.Id, key, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot get items of collection %v.%v: %v", group.Id, key, err))
+			return
+		}
+		w.Header().Set("Total-Results", strconv.Itoa(len(items)))
+		respondWithJSON(w, http.StatusOK, items)
+	}
+}
+
+// collectionChanges holds the fields of a collection update. Nil fields are
+// left unchanged.
+type collectionChanges struct {
+	name   *string
+	parent *model.Parent
+}
+
+// parseCollectionChanges reads name and parentCollection from body. The parent
+// may be a collection key or false for the top level.
+func parseCollectionChanges(body []byte) (*collectionChanges, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, errors.Wrap(err, "cannot decode json")
+	}
+	changes := &collectionChanges{}
+	if v, ok := raw["name"]; ok {
+		name, ok := v.(string)
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, errors.New("name must be a non-empty string")
+		}
+		changes.name = &name
+	}
+	if v, ok := raw["parentCollection"]; ok {
+		var parent model.Parent
+		switch p := v.(type) {
+		case string:
+			parent = model.Parent(p)
+		case bool:
+			if p {
+				return nil, errors.New("parentCollection must be a key or false")
+			}
+		case nil:
+		default:
+			return nil, errors.New("parentCollection must be a key or false")
+		}
+		changes.parent = &parent
+	}
+	return changes, nil
+}
+
+// makeCollectionUpdateHandler renames or moves the collection {key}. PUT
+// requires the name, PATCH changes only the given fields. An
+// If-Unmodified-Since-Version header is checked against the stored version.
+func (handlers *Handlers) makeCollectionUpdateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		// get groups object from cache
+		group, err := handlers.groupFromVars(ctx, vars, true)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		key := vars["key"]
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxItemBody))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("cannot read body: %v", err))
+			return
+		}
+		if err := validateBody("CollectionUpdate", body); err != nil {
+			var ve *validationError
+			if errors.As(err, &ve) {
+				respondWithValidationError(w, ve)
+				return
+			}
+			handlers.logger.Errorf("cannot validate collection: %v", err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot validate collection: %v", err))
+			return
+		}
+		changes, err := parseCollectionChanges(body)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if r.Method == http.MethodPut && changes.name == nil {
+			respondWithError(w, http.StatusBadRequest, "name required")
+			return
+		}
+
+		coll, err := handlers.storage.ModifyCollection(ctx, group.Id, key, func(coll *model.Collection) error {
+			if coll.Deleted {
+				return newStatusError(http.StatusNotFound, "collection %v.%v is marked as deleted", group.Id, key)
+			}
+			if ifVersion := r.Header.Get("If-Unmodified-Since-Version"); ifVersion != "" {
+				version, err := strconv.ParseInt(strings.TrimSpace(ifVersion), 10, 64)
+				if err != nil {
+					return newStatusError(http.StatusBadRequest, "invalid If-Unmodified-Since-Version %q", ifVersion)
+				}
+				if version != coll.Version {
+					return newStatusError(http.StatusPreconditionFailed, "collection %s has version %d", coll.Key, coll.Version)
+				}
+			}
+			if changes.name != nil {
+				coll.Data.Name = *changes.name
+			}
+			if changes.parent != nil {
+				coll.Data.ParentCollection = *changes.parent
+			}
+			if coll.Status != model.SyncStatus_New {
+				coll.Status = model.SyncStatus_Modified
+			}
+			return nil
+		})
+		if err != nil {
+			var se *statusError
+			switch {
+			case errors.As(err, &se):
+				respondWithError(w, se.code, se.msg)
+			case errors.Is(err, storage.ErrCollectionCycle):
+				respondWithError(w, http.StatusConflict, err.Error())
+			case errors.Is(err, storage.ErrInvalidParent):
+				respondWithError(w, http.StatusBadRequest, err.Error())
+			default:
+				handlers.logger.Errorf("cannot update collection %v.%v: %v", group.Id, key, err)
+				respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot update collection %v.%v: %v", group.Id, key, err))
+			}
+			return
+		}
+		if coll == nil {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("collection %v.%v not found", group.Id, key))
+			return
+		}
+		respondWithJSON(w, http.StatusOK, coll)
+	}
+}
+
+// makeCollectionDeleteHandler deletes the collection {key}. Collections with
+// subcollections are only deleted with the parameter recursive.
+func (handlers *Handlers) makeCollectionDeleteHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		// get groups object from cache
+		group, err := handlers.groupFromVars(ctx, vars, true)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		key := vars["key"]
+		keys, err := handlers.storage.DeleteCollectionTree(ctx, group.Id, key, boolParam(r, "recursive"))
+		if err != nil {
+			if errors.Is(err, storage.ErrCollectionNotEmpty) {
+				respondWithError(w, http.StatusConflict, err.Error())
+				return
+			}
+			handlers.logger.Errorf("cannot delete collection %v.%v: %v", group.Id, key, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot delete collection %v.%v: %v", group.Id, key, err))
+			return
+		}
+		if keys == nil {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("collection %v.%v not found", group.Id, key))
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string][]string{"deleted": keys})
+	}
+}
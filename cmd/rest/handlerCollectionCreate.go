@@ -3,8 +3,10 @@ package main
 import (
 	"encoding/json/v2"
 	"fmt"
+	"io"
 	"net/http"
 
+	"emperror.dev/errors"
 	"github.com/gorilla/mux"
 	"github.com/je4/zsync/v2/pkg/zotero/model"
 )
@@ -14,14 +16,29 @@ func (handlers *Handlers) makeCollectionCreateHandler() http.HandlerFunc {
 		ctx := r.Context()
 		vars := mux.Vars(r)
 		// get groups object from cache
-		group, err := handlers.groupFromVars(ctx, vars)
+		group, err := handlers.groupFromVars(ctx, vars, true)
 		if err != nil {
 			handlers.logger.Errorf("no group: %v", err)
-			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("no group: %v", err))
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxItemBody))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("cannot read body: %v", err))
+			return
+		}
+		if err := validateBody("CollectionData", body); err != nil {
+			var ve *validationError
+			if errors.As(err, &ve) {
+				respondWithValidationError(w, ve)
+				return
+			}
+			handlers.logger.Errorf("cannot validate collection: %v", err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot validate collection: %v", err))
 			return
 		}
 		var collectionData model.CollectionData
-		if err := json.UnmarshalRead(r.Body, &collectionData); err != nil {
+		if err := json.Unmarshal(body, &collectionData); err != nil {
 			handlers.logger.Errorf("cannot decode json: %v", err)
 			respondWithError(w, http.StatusUnprocessableEntity, fmt.Sprintf("cannot decode json: %v", err))
 			return
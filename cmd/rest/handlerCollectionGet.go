@@ -7,15 +7,17 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// makeCollectionGetHandler finds a collection by name below the collection
+// key, or at the top level if the url has no key.
 func (handlers *Handlers) makeCollectionGetHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		vars := mux.Vars(r)
 		// get groups object from cache
-		group, err := handlers.groupFromVars(ctx, vars)
+		group, err := handlers.groupFromVars(ctx, vars, false)
 		if err != nil {
 			handlers.logger.Errorf("no group: %v", err)
-			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("no group: %v", err))
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
 			return
 		}
 		parentKey, ok := vars["key"]
@@ -24,8 +26,8 @@ func (handlers *Handlers) makeCollectionGetHandler() http.HandlerFunc {
 		}
 		name, ok := vars["name"]
 		if !ok {
-			handlers.logger.Errorf("no name: %v", err)
-			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("no name: %v", err))
+			handlers.logger.Errorf("no name in url")
+			respondWithError(w, http.StatusBadRequest, "no name in url")
 			return
 		}
 
@@ -36,7 +38,7 @@ func (handlers *Handlers) makeCollectionGetHandler() http.HandlerFunc {
 			return
 		}
 		if coll == nil {
-			respondWithJSON(w, http.StatusNotFound, fmt.Sprintf("collection %v.%v <- %v not found", group.Id, name, parentKey))
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("collection %v.%v <- %v not found", group.Id, name, parentKey))
 			return
 		}
 
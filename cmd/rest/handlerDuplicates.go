@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/mux"
+	"github.com/je4/zsync/v2/pkg/zotero/dedup"
+)
+
+type itemMerge struct {
+	Keys []string `json:"keys"`
+}
+
+// makeDuplicatesHandler serves GET /{groupid}/duplicates. The optional
+// threshold is the lowest score of a reported match.
+func (handlers *Handlers) makeDuplicatesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		group, err := handlers.groupFromVars(ctx, vars, false)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		dedupe := dedup.NewDeduplicator(handlers.storage, nil)
+		if str := r.URL.Query().Get("threshold"); str != "" {
+			if dedupe.Threshold, err = strconv.ParseFloat(str, 64); err != nil || dedupe.Threshold < 0 || dedupe.Threshold > 1 {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid threshold: %s", str))
+				return
+			}
+		}
+		clusters, err := dedupe.Find(ctx, group.Id)
+		if err != nil {
+			handlers.logger.Errorf("cannot find duplicates of group %v: %v", group.Id, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot find duplicates of group %v: %v", group.Id, err))
+			return
+		}
+		if clusters == nil {
+			clusters = []*dedup.Cluster{}
+		}
+		respondWithJSON(w, http.StatusOK, clusters)
+	}
+}
+
+// makeItemMergeHandler serves POST /{groupid}/items/{key}/merge. The items
+// of the body are merged into item {key} and moved to the trash.
+func (handlers *Handlers) makeItemMergeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		group, err := handlers.groupFromVars(ctx, vars, true)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxItemBody))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("cannot read body: %v", err))
+			return
+		}
+		if err := validateBody("ItemMerge", body); err != nil {
+			var ve *validationError
+			if errors.As(err, &ve) {
+				respondWithValidationError(w, ve)
+				return
+			}
+			handlers.logger.Errorf("cannot validate merge: %v", err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot validate merge: %v", err))
+			return
+		}
+		var merge itemMerge
+		if err := json.Unmarshal(body, &merge); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("cannot decode json: %v", err))
+			return
+		}
+
+		item, err := dedup.NewDeduplicator(handlers.storage, nil).Merge(ctx, group.Id, vars["key"], merge.Keys)
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, dedup.ErrItemNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, dedup.ErrInvalidMerge):
+				status = http.StatusBadRequest
+			}
+			handlers.logger.Errorf("cannot merge items into %v.%v: %v", group.Id, vars["key"], err)
+			respondWithError(w, status, fmt.Sprintf("cannot merge items into %v.%v: %v", group.Id, vars["key"], err))
+			return
+		}
+		respondWithJSON(w, http.StatusOK, item)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/mux"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// groupInfo shows the sync settings and cursors of a group, which are not
+// part of the Zotero representation of model.Group.
+type groupInfo struct {
+	Id                int64      `json:"id"`
+	Name              string     `json:"name"`
+	Version           int64      `json:"version"`
+	Deleted           bool       `json:"deleted"`
+	Active            bool       `json:"active"`
+	Direction         string     `json:"direction"`
+	SyncTags          bool       `json:"syncTags"`
+	ItemVersion       int64      `json:"itemVersion"`
+	CollectionVersion int64      `json:"collectionVersion"`
+	TagVersion        int64      `json:"tagVersion"`
+	Gitlab            *time.Time `json:"gitlab,omitempty"`
+}
+
+func newGroupInfo(group *model.Group) *groupInfo {
+	return &groupInfo{
+		Id:                group.Id,
+		Name:              group.Data.Name,
+		Version:           group.Version,
+		Deleted:           group.Deleted,
+		Active:            group.Active,
+		Direction:         model.SyncDirectionString[group.Direction],
+		SyncTags:          group.SyncTags,
+		ItemVersion:       group.ItemVersion,
+		CollectionVersion: group.CollectionVersion,
+		TagVersion:        group.TagVersion,
+		Gitlab:            group.Gitlab,
+	}
+}
+
+// groupSettings is the body of PATCH /{groupid}/group
+type groupSettings struct {
+	Active    *bool   `json:"active"`
+	Direction *string `json:"direction"`
+	SyncTags  *bool   `json:"syncTags"`
+}
+
+// makeGroupListHandler serves GET /groups with all groups the acting key may
+// read.
+func (handlers *Handlers) makeGroupListHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		key := apiKeyFromContext(ctx)
+		if key == nil {
+			respondWithError(w, http.StatusUnauthorized, errUnauthorized.Error())
+			return
+		}
+		groups, err := handlers.storage.ListGroups(ctx)
+		if err != nil {
+			handlers.logger.Errorf("cannot list groups: %v", err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot list groups: %v", err))
+			return
+		}
+		result := []*groupInfo{}
+		for _, group := range groups {
+			if key.Access.CanRead(group.Id) {
+				result = append(result, newGroupInfo(group))
+			}
+		}
+		respondWithJSON(w, http.StatusOK, result)
+	}
+}
+
+// makeGroupGetHandler serves GET /{groupid}/group
+func (handlers *Handlers) makeGroupGetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		group, err := handlers.groupFromVars(ctx, vars, false)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		// the cursors of the cached group may be outdated
+		group, err = handlers.storage.GetGroup(ctx, group.Id)
+		if err != nil {
+			handlers.logger.Errorf("cannot load group: %v", err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot load group: %v", err))
+			return
+		}
+		respondWithJSON(w, http.StatusOK, newGroupInfo(group))
+	}
+}
+
+// makeGroupUpdateHandler serves PATCH /{groupid}/group, which changes the
+// fields active, direction and syncTags.
+func (handlers *Handlers) makeGroupUpdateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		group, err := handlers.groupFromVars(ctx, vars, true)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxItemBody))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("cannot read body: %v", err))
+			return
+		}
+		if err := validateBody("GroupSettings", body); err != nil {
+			var ve *validationError
+			if errors.As(err, &ve) {
+				respondWithValidationError(w, ve)
+				return
+			}
+			handlers.logger.Errorf("cannot validate group settings: %v", err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot validate group settings: %v", err))
+			return
+		}
+		var settings groupSettings
+		if err := json.Unmarshal(body, &settings); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("cannot decode json: %v", err))
+			return
+		}
+
+		group, err = handlers.storage.GetGroup(ctx, group.Id)
+		if err != nil {
+			handlers.logger.Errorf("cannot load group: %v", err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot load group: %v", err))
+			return
+		}
+		if settings.Active != nil {
+			group.Active = *settings.Active
+		}
+		if settings.Direction != nil {
+			direction, ok := model.SyncDirectionId[*settings.Direction]
+			if !ok {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid direction %q", *settings.Direction))
+				return
+			}
+			group.Direction = direction
+		}
+		if settings.SyncTags != nil {
+			group.SyncTags = *settings.SyncTags
+		}
+		if err := handlers.storage.UpdateSyncGroup(ctx, group); err != nil {
+			handlers.logger.Errorf("cannot update group %v: %v", group.Id, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot update group %v: %v", group.Id, err))
+			return
+		}
+		handlers.groups.Invalidate(group.Id)
+		respondWithJSON(w, http.StatusOK, newGroupInfo(group))
+	}
+}
+
+// makeGroupResetHandler serves POST /{groupid}/group/reset, which resets the
+// sync cursors so that the next sync compares all objects with the cloud.
+func (handlers *Handlers) makeGroupResetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		group, err := handlers.groupFromVars(ctx, vars, true)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		// a running sync would store its cursors afterwards
+		runs, err := handlers.storage.GetSyncRuns(ctx, group.Id, 1)
+		if err != nil {
+			handlers.logger.Errorf("cannot get sync runs of group %v: %v", group.Id, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot get sync runs of group %v: %v", group.Id, err))
+			return
+		}
+		if len(runs) > 0 && runs[0].Status.Active() {
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("group %v is being synced", group.Id))
+			return
+		}
+		if err := handlers.storage.ClearGroup(ctx, group.Id); err != nil {
+			handlers.logger.Errorf("cannot reset group %v: %v", group.Id, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot reset group %v: %v", group.Id, err))
+			return
+		}
+		handlers.groups.Invalidate(group.Id)
+		group, err = handlers.storage.GetGroup(ctx, group.Id)
+		if err != nil {
+			handlers.logger.Errorf("cannot load group: %v", err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot load group: %v", err))
+			return
+		}
+		respondWithJSON(w, http.StatusOK, newGroupInfo(group))
+	}
+}
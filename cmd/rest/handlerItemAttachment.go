@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/je4/zsync/v2/pkg/filesystem"
 	"github.com/je4/zsync/v2/pkg/zotero/model"
+	zotsync "github.com/je4/zsync/v2/pkg/zotero/sync"
 )
 
 func (handlers *Handlers) makeItemAttachmentHandler() http.HandlerFunc {
@@ -14,10 +20,10 @@ func (handlers *Handlers) makeItemAttachmentHandler() http.HandlerFunc {
 		ctx := r.Context()
 		vars := mux.Vars(r)
 		// get groups object from cache
-		group, err := handlers.groupFromVars(ctx, vars)
+		group, err := handlers.groupFromVars(ctx, vars, true)
 		if err != nil {
 			handlers.logger.Errorf("no group: %v", err)
-			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("no group: %v", err))
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
 			return
 		}
 		key, ok := vars["key"]
@@ -45,14 +51,14 @@ func (handlers *Handlers) makeItemAttachmentHandler() http.HandlerFunc {
 		}
 		bucket := fmt.Sprintf("zotero-%v", group.Id)
 		if handlers.fs != nil {
-			found, err := handlers.fs.FolderExists(bucket)
+			found, err := handlers.fs.FolderExists(ctx, bucket)
 			if err != nil {
 				handlers.logger.Errorf("cannot check bucket existence")
 				respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot check bucket existence: %v", err))
 				return
 			}
 			if !found {
-				if err := handlers.fs.FolderCreate(bucket, filesystem.FolderCreateOptions{}); err != nil {
+				if err := handlers.fs.FolderCreate(ctx, bucket, filesystem.FolderCreateOptions{}); err != nil {
 					handlers.logger.Errorf("cannot create bucket %s", bucket)
 					respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot create bucket %s: %v", bucket, err))
 					return
@@ -61,11 +67,14 @@ func (handlers *Handlers) makeItemAttachmentHandler() http.HandlerFunc {
 			opts := filesystem.FilePutOptions{
 				ContentType: r.Header.Get("Content-Type"),
 			}
-			if err := handlers.fs.FileWrite(bucket, key, r.Body, -1, opts); err != nil {
+			// the new checksum makes the store announce the file to the webhooks
+			sum := md5.New()
+			if err := handlers.fs.FileWrite(ctx, bucket, key, io.TeeReader(r.Body, sum), -1, opts); err != nil {
 				handlers.logger.Errorf("cannot write %v/%v: %v", bucket, key, err)
 				respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot write %v/%v: %v", bucket, key, err))
 				return
 			}
+			item.MD5 = hex.EncodeToString(sum.Sum(nil))
 		}
 
 		item.Status = model.SyncStatus_Modified
@@ -74,7 +83,31 @@ func (handlers *Handlers) makeItemAttachmentHandler() http.HandlerFunc {
 			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot update status of %v.%v: %v", group.Id, item.Key, err))
 			return
 		}
+		if handlers.fs != nil {
+			handlers.indexAttachment(ctx, group.Id, &item, bucket, r.Header.Get("Content-Type"))
+		}
 
 		respondWithJSON(w, http.StatusOK, fmt.Sprintf("data written to %v/%v", bucket, key))
 	}
 }
+
+// indexAttachment stores the text of an uploaded attachment file for the
+// full-text search. The upload has succeeded, so failures are only logged.
+func (handlers *Handlers) indexAttachment(ctx context.Context, groupId int64, item *model.Item, bucket, contentType string) {
+	if item.Data.ContentType != "" {
+		contentType = item.Data.ContentType
+	}
+	var r io.Reader = strings.NewReader("")
+	if zotsync.FulltextContentType(contentType) {
+		file, err := handlers.fs.FileOpenRead(ctx, bucket, item.Key, filesystem.FileGetOptions{})
+		if err != nil {
+			handlers.logger.Errorf("cannot read %v/%v: %v", bucket, item.Key, err)
+			return
+		}
+		defer file.Close()
+		r = file
+	}
+	if err := zotsync.StoreFulltext(ctx, handlers.storage, groupId, item.Key, contentType, r); err != nil {
+		handlers.logger.Errorf("cannot index %v.%v: %v", groupId, item.Key, err)
+	}
+}
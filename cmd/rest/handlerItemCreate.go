@@ -3,8 +3,10 @@ package main
 import (
 	"encoding/json/v2"
 	"fmt"
+	"io"
 	"net/http"
 
+	"emperror.dev/errors"
 	"github.com/gorilla/mux"
 	"github.com/je4/zsync/v2/pkg/zotero/model"
 )
@@ -14,10 +16,10 @@ func (handlers *Handlers) makeItemCreateHandler() http.HandlerFunc {
 		ctx := r.Context()
 		vars := mux.Vars(r)
 		// get groups object from cache
-		group, err := handlers.groupFromVars(ctx, vars)
+		group, err := handlers.groupFromVars(ctx, vars, true)
 		if err != nil {
 			handlers.logger.Errorf("no group: %v", err)
-			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("no group: %v", err))
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
 			return
 		}
 		oldid, ok := vars["oldid"]
@@ -25,19 +27,29 @@ func (handlers *Handlers) makeItemCreateHandler() http.HandlerFunc {
 			oldid = ""
 		}
 
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxItemBody))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("cannot read body: %v", err))
+			return
+		}
+		if err := validateBody("ItemGeneric", body); err != nil {
+			var ve *validationError
+			if errors.As(err, &ve) {
+				respondWithValidationError(w, ve)
+				return
+			}
+			handlers.logger.Errorf("cannot validate item: %v", err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot validate item: %v", err))
+			return
+		}
 		var itemData model.ItemGeneric
-		if err := json.UnmarshalRead(r.Body, &itemData); err != nil {
+		if err := json.Unmarshal(body, &itemData); err != nil {
 			handlers.logger.Errorf("cannot decode json: %v", err)
 			respondWithError(w, http.StatusUnprocessableEntity, fmt.Sprintf("cannot decode json: %v", err))
 			return
 		}
-		itemMeta := model.ItemMeta{}
-		if handlers.client != nil && handlers.client.CurrentKey != nil {
-			itemMeta.CreatedByUser = model.User{
-				Id:       handlers.client.CurrentKey.UserId,
-				Username: handlers.client.CurrentKey.Username,
-				Links:    nil,
-			}
+		itemMeta := model.ItemMeta{
+			CreatedByUser: actingUser(ctx),
 		}
 		item, err := handlers.storage.CreateItem(ctx, group.Id, &itemData, &itemMeta, oldid)
 		if err != nil {
@@ -13,10 +13,10 @@ func (handlers *Handlers) makeItemDeleteHandler() http.HandlerFunc {
 		ctx := r.Context()
 		vars := mux.Vars(r)
 		// get groups object from cache
-		group, err := handlers.groupFromVars(ctx, vars)
+		group, err := handlers.groupFromVars(ctx, vars, true)
 		if err != nil {
 			handlers.logger.Errorf("no group: %v", err)
-			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("no group: %v", err))
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
 			return
 		}
 		oldid, ok := vars["oldid"]
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/mux"
+	"github.com/je4/zsync/v2/pkg/filesystem"
+)
+
+// makeItemFileHandler serves GET and HEAD on /{groupid}/items/{key}/file. The
+// stored attachment is streamed from the group bucket; Range, If-None-Match
+// and If-Range requests are handled by http.ServeContent.
+func (handlers *Handlers) makeItemFileHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		// get groups object from cache
+		group, err := handlers.groupFromVars(ctx, vars, false)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		key := vars["key"]
+		item, err := handlers.storage.GetItemByKey(ctx, group.Id, key)
+		if err != nil {
+			handlers.logger.Errorf("cannot get item %v.%v: %v", group.Id, key, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot get item %v.%v: %v", group.Id, key, err))
+			return
+		}
+		if item == nil || item.Deleted {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("item %v.%v not found", group.Id, key))
+			return
+		}
+		if item.Data.ItemType != "attachment" {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("item %v.%v is not an attachment", group.Id, key))
+			return
+		}
+		if handlers.fs == nil {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("no file storage for item %v.%v", group.Id, key))
+			return
+		}
+
+		bucket := fmt.Sprintf("zotero-%v", group.Id)
+		info, err := handlers.fs.FileStat(ctx, bucket, item.Key, filesystem.FileStatOptions{})
+		if err != nil {
+			if filesystem.IsNotFoundError(err) || errors.Is(err, iofs.ErrNotExist) {
+				respondWithError(w, http.StatusNotFound, fmt.Sprintf("no file for item %v.%v", group.Id, key))
+				return
+			}
+			handlers.logger.Errorf("cannot stat %v/%v: %v", bucket, item.Key, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot stat %v/%v: %v", bucket, item.Key, err))
+			return
+		}
+
+		contentType := item.Data.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Accept-Ranges", "bytes")
+		if item.Data.Filename != "" {
+			disposition := "inline"
+			if _, ok := r.URL.Query()["download"]; ok {
+				disposition = "attachment"
+			}
+			w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": item.Data.Filename}))
+		}
+		md5str := item.MD5
+		if md5str == "" {
+			md5str = item.Data.MD5
+		}
+		if md5str != "" {
+			w.Header().Set("ETag", strconv.Quote(md5str))
+			if sum, err := hex.DecodeString(md5str); err == nil {
+				w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum))
+			}
+		}
+
+		rc, err := handlers.fs.FileOpenRead(ctx, bucket, item.Key, filesystem.FileGetOptions{})
+		if err != nil {
+			handlers.logger.Errorf("cannot open %v/%v: %v", bucket, item.Key, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot open %v/%v: %v", bucket, item.Key, err))
+			return
+		}
+		defer rc.Close()
+		// large files and video playback take longer than the server's
+		// write timeout
+		if err := clearWriteDeadline(w); err != nil {
+			handlers.logger.Debugf("cannot clear write deadline: %v", err)
+		}
+		if rs, ok := rc.(io.ReadSeeker); ok {
+			http.ServeContent(w, r, "", info.ModTime(), rs)
+			return
+		}
+		// without seeking only complete responses are possible
+		w.Header().Set("Accept-Ranges", "none")
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return
+		}
+		if _, err := io.Copy(w, rc); err != nil {
+			handlers.logger.Errorf("cannot send %v/%v: %v", bucket, item.Key, err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/mux"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+// makeItemListHandler serves GET /{groupid}/items with the Zotero query
+// parameters itemType, tag (repeatable), collection, q, since, sort,
+// direction, start and limit.
+func (handlers *Handlers) makeItemListHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		// get groups object from cache
+		group, err := handlers.groupFromVars(ctx, vars, false)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		values := r.URL.Query()
+		query := &storage.ItemQuery{
+			ItemType:   values.Get("itemType"),
+			Tags:       values["tag"],
+			Collection: values.Get("collection"),
+			Q:          values.Get("q"),
+			Sort:       values.Get("sort"),
+			Direction:  values.Get("direction"),
+		}
+		for name, target := range map[string]*int64{
+			"since": &query.Since,
+			"start": &query.Start,
+			"limit": &query.Limit,
+		} {
+			str := values.Get(name)
+			if str == "" {
+				continue
+			}
+			if *target, err = strconv.ParseInt(str, 10, 64); err != nil || *target < 0 {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %s", name, str))
+				return
+			}
+		}
+
+		items, total, err := handlers.storage.QueryItems(ctx, group.Id, query)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, storage.ErrInvalidQuery) {
+				status = http.StatusBadRequest
+			}
+			handlers.logger.Errorf("cannot query items of group %v: %v", group.Id, err)
+			respondWithError(w, status, fmt.Sprintf("cannot query items of group %v: %v", group.Id, err))
+			return
+		}
+		w.Header().Set("Total-Results", strconv.FormatInt(total, 10))
+		respondWithJSON(w, http.StatusOK, items)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/mux"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+// makeItemSearchHandler serves GET /{groupid}/search with the full-text
+// query q and the filters itemType, tag (repeatable), collection,
+// includeTrashed and language. Results are ordered by rank and paged with
+// start and limit.
+func (handlers *Handlers) makeItemSearchHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		group, err := handlers.groupFromVars(ctx, vars, false)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		values := r.URL.Query()
+		query := values.Get("q")
+		if query == "" {
+			respondWithError(w, http.StatusBadRequest, "missing search query q")
+			return
+		}
+		filter := &storage.SearchFilter{
+			ItemType:       values.Get("itemType"),
+			Tags:           values["tag"],
+			Collection:     values.Get("collection"),
+			IncludeTrashed: boolParam(r, "includeTrashed"),
+			Language:       values.Get("language"),
+		}
+		page := &storage.Page{}
+		for name, target := range map[string]*int64{
+			"start": &page.Start,
+			"limit": &page.Limit,
+		} {
+			str := values.Get(name)
+			if str == "" {
+				continue
+			}
+			if *target, err = strconv.ParseInt(str, 10, 64); err != nil || *target < 0 {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %s", name, str))
+				return
+			}
+		}
+
+		results, total, err := handlers.storage.SearchItems(ctx, group.Id, query, filter, page)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, storage.ErrInvalidQuery) {
+				status = http.StatusBadRequest
+			}
+			handlers.logger.Errorf("cannot search items of group %v: %v", group.Id, err)
+			respondWithError(w, status, fmt.Sprintf("cannot search items of group %v: %v", group.Id, err))
+			return
+		}
+		w.Header().Set("Total-Results", strconv.FormatInt(total, 10))
+		respondWithJSON(w, http.StatusOK, results)
+	}
+}
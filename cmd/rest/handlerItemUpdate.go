@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/mux"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// maxItemBody limits the size of item update requests
+const maxItemBody = 10 << 20
+
+// statusError carries the HTTP status of a failed update out of
+// storage.ModifyItem.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+func newStatusError(code int, format string, args ...any) error {
+	return &statusError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// checkPreconditions compares the If-Match and If-Unmodified-Since-Version
+// headers with the stored item. One of them is required.
+func checkPreconditions(r *http.Request, item *model.Item) error {
+	ifMatch := r.Header.Get("If-Match")
+	ifVersion := r.Header.Get("If-Unmodified-Since-Version")
+	if ifMatch == "" && ifVersion == "" {
+		return newStatusError(http.StatusPreconditionRequired, "If-Match or If-Unmodified-Since-Version header required")
+	}
+	if ifVersion != "" {
+		version, err := strconv.ParseInt(strings.TrimSpace(ifVersion), 10, 64)
+		if err != nil {
+			return newStatusError(http.StatusBadRequest, "invalid If-Unmodified-Since-Version %q", ifVersion)
+		}
+		if version != item.Version {
+			return newStatusError(http.StatusPreconditionFailed, "item %s has version %d", item.Key, item.Version)
+		}
+	}
+	if ifMatch != "" {
+		etag := itemETag(item)
+		matched := false
+		for _, tag := range strings.Split(ifMatch, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return newStatusError(http.StatusPreconditionFailed, "item %s has been modified (ETag %s)", item.Key, etag)
+		}
+	}
+	return nil
+}
+
+// mergeItemData applies patch to data as JSON merge patch (RFC 7396) on the
+// top level fields: given fields replace stored ones, null removes them. The
+// merged JSON document is returned.
+func mergeItemData(data *model.ItemGeneric, patch []byte) ([]byte, error) {
+	var changes map[string]any
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, errors.Wrap(err, "cannot decode json")
+	}
+	current, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal item data")
+	}
+	var merged map[string]any
+	if err := json.Unmarshal(current, &merged); err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal item data")
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(merged, name)
+			continue
+		}
+		merged[name] = value
+	}
+	mergedBytes, err := json.Marshal(merged)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal merged data")
+	}
+	return mergedBytes, nil
+}
+
+// makeItemUpdateHandler serves PUT (full replace) and PATCH (merge) on
+// /{groupid}/items/{key}. Changed items are marked as modified so that the
+// next sync uploads them.
+func (handlers *Handlers) makeItemUpdateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		// get groups object from cache
+		group, err := handlers.groupFromVars(ctx, vars, true)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		key := vars["key"]
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxItemBody))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("cannot read body: %v", err))
+			return
+		}
+
+		item, err := handlers.storage.ModifyItem(ctx, group.Id, key, func(item *model.Item) error {
+			if item.Deleted {
+				return newStatusError(http.StatusNotFound, "item %v.%v is marked as deleted", group.Id, key)
+			}
+			if err := checkPreconditions(r, item); err != nil {
+				return err
+			}
+			newData := body
+			if r.Method == http.MethodPatch {
+				merged, err := mergeItemData(&item.Data, body)
+				if err != nil {
+					return newStatusError(http.StatusBadRequest, "%v", err)
+				}
+				newData = merged
+			}
+			if err := validateBody("ItemGeneric", newData); err != nil {
+				return err
+			}
+			data := &model.ItemGeneric{}
+			if err := json.Unmarshal(newData, data); err != nil {
+				return newStatusError(http.StatusBadRequest, "cannot decode json: %v", err)
+			}
+			if data.Key != "" && data.Key != item.Key {
+				return newStatusError(http.StatusBadRequest, "key %s does not match item %s", data.Key, item.Key)
+			}
+			if data.Version != 0 && data.Version != item.Version {
+				return newStatusError(http.StatusPreconditionFailed, "item %s has version %d", item.Key, item.Version)
+			}
+			if err := model.ValidateItem(data); err != nil {
+				return newStatusError(http.StatusBadRequest, "invalid item: %v", err)
+			}
+			data.Key = item.Key
+			data.Version = item.Version
+			if data.DateAdded == "" {
+				data.DateAdded = item.Data.DateAdded
+			}
+			data.DateModified = time.Now().UTC().Format(time.RFC3339)
+			item.Data = *data
+			if item.Status != model.SyncStatus_New {
+				item.Status = model.SyncStatus_Modified
+			}
+			return nil
+		})
+		if err != nil {
+			var se *statusError
+			if errors.As(err, &se) {
+				respondWithError(w, se.code, se.msg)
+				return
+			}
+			var ve *validationError
+			if errors.As(err, &ve) {
+				respondWithValidationError(w, ve)
+				return
+			}
+			handlers.logger.Errorf("cannot update item %v.%v: %v", group.Id, key, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot update item %v.%v: %v", group.Id, key, err))
+			return
+		}
+		if item == nil {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("item %v.%v not found", group.Id, key))
+			return
+		}
+		w.Header().Set("ETag", itemETag(item))
+		respondWithJSON(w, http.StatusOK, item)
+	}
+}
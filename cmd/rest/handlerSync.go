@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/mux"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+const (
+	defaultSyncRuns = 20
+	maxSyncRuns     = 100
+)
+
+// syncState is the response of GET /{groupid}/sync
+type syncState struct {
+	// Current is the queued or running sync run, if any
+	Current *model.SyncRun   `json:"current"`
+	Runs    []*model.SyncRun `json:"runs"`
+}
+
+// makeSyncStartHandler serves POST /{groupid}/sync. The sync run is queued
+// and executed in the background; its state is available with GET.
+func (handlers *Handlers) makeSyncStartHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		// get groups object from cache
+		group, err := handlers.groupFromVars(ctx, vars, true)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		if handlers.runner == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "no zotero endpoint configured")
+			return
+		}
+		// the cached group may have outdated cursors
+		group, err = handlers.storage.GetGroup(ctx, group.Id)
+		if err != nil {
+			handlers.logger.Errorf("cannot load group: %v", err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot load group: %v", err))
+			return
+		}
+		if !group.Active {
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("group %v is not active", group.Id))
+			return
+		}
+		run, err := handlers.runner.Enqueue(ctx, group, "rest", actingUser(ctx).Username)
+		if err != nil {
+			if errors.Is(err, storage.ErrSyncRunActive) {
+				respondWithError(w, http.StatusConflict, fmt.Sprintf("group %v is already being synced", group.Id))
+				return
+			}
+			handlers.logger.Errorf("cannot start sync of group %v: %v", group.Id, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot start sync of group %v: %v", group.Id, err))
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/%v/sync", group.Id))
+		respondWithJSON(w, http.StatusAccepted, run)
+	}
+}
+
+// makeSyncStatusHandler serves GET /{groupid}/sync with the current run and
+// the latest runs (parameter limit).
+func (handlers *Handlers) makeSyncStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		// get groups object from cache
+		group, err := handlers.groupFromVars(ctx, vars, false)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		var limit int64 = defaultSyncRuns
+		if str := r.URL.Query().Get("limit"); str != "" {
+			limit, err = strconv.ParseInt(str, 10, 64)
+			if err != nil || limit < 1 || limit > maxSyncRuns {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %s", str))
+				return
+			}
+		}
+		runs, err := handlers.storage.GetSyncRuns(ctx, group.Id, limit)
+		if err != nil {
+			handlers.logger.Errorf("cannot get sync runs of group %v: %v", group.Id, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot get sync runs of group %v: %v", group.Id, err))
+			return
+		}
+		state := syncState{Runs: runs}
+		// only one run per group can be active, and it is the newest one
+		if len(runs) > 0 && runs[0].Status.Active() {
+			state.Current = runs[0]
+		}
+		respondWithJSON(w, http.StatusOK, state)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/mux"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/webhook"
+)
+
+const (
+	defaultWebhookDeliveries = 20
+	maxWebhookDeliveries     = 100
+)
+
+// webhookSettings is the body of POST and PATCH /{groupid}/webhooks/{id}
+type webhookSettings struct {
+	Url    *string              `json:"url"`
+	Events []model.WebhookEvent `json:"events"`
+	Active *bool                `json:"active"`
+}
+
+// readWebhookSettings reads and validates the body against schemaName. It
+// responds itself if the body is invalid.
+func (handlers *Handlers) readWebhookSettings(w http.ResponseWriter, r *http.Request, schemaName string) (*webhookSettings, bool) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxItemBody))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("cannot read body: %v", err))
+		return nil, false
+	}
+	if err := validateBody(schemaName, body); err != nil {
+		var ve *validationError
+		if errors.As(err, &ve) {
+			respondWithValidationError(w, ve)
+			return nil, false
+		}
+		handlers.logger.Errorf("cannot validate webhook: %v", err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot validate webhook: %v", err))
+		return nil, false
+	}
+	var settings webhookSettings
+	if err := json.Unmarshal(body, &settings); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("cannot decode json: %v", err))
+		return nil, false
+	}
+	if settings.Url != nil {
+		if err := webhook.CheckUrl(r.Context(), *settings.Url); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return nil, false
+		}
+	}
+	return &settings, true
+}
+
+// webhookFromVars loads the webhook {id} of the group. It responds itself if
+// there is no such webhook.
+func (handlers *Handlers) webhookFromVars(w http.ResponseWriter, r *http.Request, groupId int64) (*model.Webhook, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid webhook id %q", mux.Vars(r)["id"]))
+		return nil, false
+	}
+	hook, err := handlers.storage.GetWebhook(r.Context(), id)
+	if err != nil {
+		handlers.logger.Errorf("cannot load webhook %v: %v", id, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot load webhook %v: %v", id, err))
+		return nil, false
+	}
+	if hook == nil || hook.GroupId != groupId {
+		respondWithError(w, http.StatusNotFound, fmt.Sprintf("webhook %v.%v not found", groupId, id))
+		return nil, false
+	}
+	// the secret is only shown on creation
+	hook.Secret = ""
+	return hook, true
+}
+
+// makeWebhookListHandler serves GET /{groupid}/webhooks
+func (handlers *Handlers) makeWebhookListHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		// webhooks reveal urls of other systems, so write access is required
+		group, err := handlers.groupFromVars(ctx, vars, true)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		hooks, err := handlers.storage.GetWebhooks(ctx, group.Id)
+		if err != nil {
+			handlers.logger.Errorf("cannot get webhooks of group %v: %v", group.Id, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot get webhooks of group %v: %v", group.Id, err))
+			return
+		}
+		for _, hook := range hooks {
+			hook.Secret = ""
+		}
+		respondWithJSON(w, http.StatusOK, hooks)
+	}
+}
+
+// makeWebhookCreateHandler serves POST /{groupid}/webhooks. The response
+// contains the generated secret, which is not shown again.
+func (handlers *Handlers) makeWebhookCreateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		group, err := handlers.groupFromVars(ctx, vars, true)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		settings, ok := handlers.readWebhookSettings(w, r, "WebhookCreate")
+		if !ok {
+			return
+		}
+		hook := &model.Webhook{
+			GroupId: group.Id,
+			Url:     *settings.Url,
+			Secret:  webhook.NewSecret(),
+			Events:  settings.Events,
+			Active:  true,
+		}
+		if settings.Active != nil {
+			hook.Active = *settings.Active
+		}
+		if err := handlers.storage.CreateWebhook(ctx, hook); err != nil {
+			handlers.logger.Errorf("cannot create webhook for group %v: %v", group.Id, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot create webhook for group %v: %v", group.Id, err))
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/%v/webhooks/%v", group.Id, hook.Id))
+		respondWithJSON(w, http.StatusCreated, hook)
+	}
+}
+
+// makeWebhookGetHandler serves GET /{groupid}/webhooks/{id}
+func (handlers *Handlers) makeWebhookGetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		group, err := handlers.groupFromVars(ctx, vars, true)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		hook, ok := handlers.webhookFromVars(w, r, group.Id)
+		if !ok {
+			return
+		}
+		respondWithJSON(w, http.StatusOK, hook)
+	}
+}
+
+// makeWebhookUpdateHandler serves PATCH /{groupid}/webhooks/{id}, which
+// changes url, events and active.
+func (handlers *Handlers) makeWebhookUpdateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		group, err := handlers.groupFromVars(ctx, vars, true)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		hook, ok := handlers.webhookFromVars(w, r, group.Id)
+		if !ok {
+			return
+		}
+		settings, ok := handlers.readWebhookSettings(w, r, "WebhookUpdate")
+		if !ok {
+			return
+		}
+		if settings.Url != nil {
+			hook.Url = *settings.Url
+		}
+		if settings.Events != nil {
+			hook.Events = settings.Events
+		}
+		if settings.Active != nil {
+			hook.Active = *settings.Active
+		}
+		if err := handlers.storage.UpdateWebhook(ctx, hook); err != nil {
+			handlers.logger.Errorf("cannot update webhook %v: %v", hook.Id, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot update webhook %v: %v", hook.Id, err))
+			return
+		}
+		respondWithJSON(w, http.StatusOK, hook)
+	}
+}
+
+// makeWebhookDeleteHandler serves DELETE /{groupid}/webhooks/{id}. Pending
+// deliveries are dropped.
+func (handlers *Handlers) makeWebhookDeleteHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		group, err := handlers.groupFromVars(ctx, vars, true)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		hook, ok := handlers.webhookFromVars(w, r, group.Id)
+		if !ok {
+			return
+		}
+		if err := handlers.storage.DeleteWebhook(ctx, hook.Id); err != nil {
+			handlers.logger.Errorf("cannot delete webhook %v: %v", hook.Id, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot delete webhook %v: %v", hook.Id, err))
+			return
+		}
+		respondWithJSON(w, http.StatusOK, hook)
+	}
+}
+
+// makeWebhookDeliveriesHandler serves GET /{groupid}/webhooks/{id}/deliveries
+// with the latest deliveries (parameter limit).
+func (handlers *Handlers) makeWebhookDeliveriesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		group, err := handlers.groupFromVars(ctx, vars, true)
+		if err != nil {
+			handlers.logger.Errorf("no group: %v", err)
+			respondWithError(w, groupErrorStatus(err), fmt.Sprintf("no group: %v", err))
+			return
+		}
+		hook, ok := handlers.webhookFromVars(w, r, group.Id)
+		if !ok {
+			return
+		}
+		var limit int64 = defaultWebhookDeliveries
+		if str := r.URL.Query().Get("limit"); str != "" {
+			limit, err = strconv.ParseInt(str, 10, 64)
+			if err != nil || limit < 1 || limit > maxWebhookDeliveries {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %s", str))
+				return
+			}
+		}
+		deliveries, err := handlers.storage.GetWebhookDeliveries(ctx, hook.Id, limit)
+		if err != nil {
+			handlers.logger.Errorf("cannot get deliveries of webhook %v: %v", hook.Id, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("cannot get deliveries of webhook %v: %v", hook.Id, err))
+			return
+		}
+		respondWithJSON(w, http.StatusOK, deliveries)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
@@ -17,6 +18,8 @@ import (
 	"github.com/je4/zsync/v2/pkg/filesystem"
 	"github.com/je4/zsync/v2/pkg/zotero/client"
 	"github.com/je4/zsync/v2/pkg/zotero/storage"
+	zotsync "github.com/je4/zsync/v2/pkg/zotero/sync"
+	"github.com/je4/zsync/v2/pkg/zotero/webhook"
 	"github.com/mash/go-accesslog"
 	"github.com/op/go-logging"
 	"github.com/rs/zerolog"
@@ -83,6 +86,9 @@ func main() {
 
 	zlog := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
 	zotStorage := storage.NewStorage(db, cfg.NewGroupActive, &zlog)
+	if err := zotStorage.VerifySchema(context.Background()); err != nil {
+		logger.Fatalf("%v: run \"migrate up\"", err)
+	}
 	var zotClient *client.Client
 	if cfg.Endpoint != "" {
 		zotClient, err = client.NewClient(context.Background(), cfg.Endpoint, cfg.Apikey, &zlog)
@@ -93,17 +99,80 @@ func main() {
 		}
 	}
 
-	handler := NewHandler(zotStorage, zotClient, fs, &cfg, logger)
+	if len(cfg.Auth.Keys) == 0 && !cfg.Auth.Database {
+		logger.Fatal("no api keys configured: add [[auth.key]] entries or enable auth.database")
+	}
+
+	var runner *zotsync.Runner
+	if zotClient != nil {
+		var staleAfter time.Duration
+		if cfg.SyncStaleAfter != "" {
+			if staleAfter, err = time.ParseDuration(cfg.SyncStaleAfter); err != nil {
+				logger.Fatalf("invalid syncstaleafter %q: %v", cfg.SyncStaleAfter, err)
+			}
+		}
+		syncer := zotsync.NewSyncer(zotClient, zotStorage, fs, &zlog)
+		runner = zotsync.NewRunner(syncer, cfg.SyncParallel, staleAfter)
+	}
+
+	var webhookInterval time.Duration
+	if cfg.WebhookInterval != "" {
+		if webhookInterval, err = time.ParseDuration(cfg.WebhookInterval); err != nil {
+			logger.Fatalf("invalid webhookinterval %q: %v", cfg.WebhookInterval, err)
+		}
+	}
+	dispatcher := webhook.NewDispatcher(zotStorage, nil, &zlog)
 
-	router := mux.NewRouter()
+	handler := NewHandler(zotStorage, zotClient, fs, runner, &cfg, logger)
+
+	root := mux.NewRouter()
+	// the api description is public
+	root.HandleFunc("/openapi.json", handler.makeOpenAPIHandler()).Methods("GET")
+	router := root.NewRoute().Subrouter()
+	router.Use(handler.authMiddleware)
 	router.HandleFunc("/{groupid}/items", handler.makeItemCreateHandler()).Methods("POST")
+	router.HandleFunc("/{groupid}/items", handler.makeItemListHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/search", handler.makeItemSearchHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/duplicates", handler.makeDuplicatesHandler()).Methods("GET")
 	router.HandleFunc("/{groupid}/items/{key}", handler.makeItemGetHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/items/{key}", handler.makeItemUpdateHandler()).Methods("PUT", "PATCH")
 	router.HandleFunc("/{groupid}/items/{key}", handler.makeItemDeleteHandler()).Methods("DELETE")
 	router.HandleFunc("/{groupid}/olditems/{oldid}", handler.makeItemCreateHandler()).Methods("POST")
 	router.HandleFunc("/{groupid}/olditems/{oldid}", handler.makeItemGetHandler()).Methods("GET")
 	router.HandleFunc("/{groupid}/olditems/{oldid}", handler.makeItemDeleteHandler()).Methods("DELETE")
 	router.HandleFunc("/{groupid}/collections", handler.makeCollectionCreateHandler()).Methods("POST")
+	router.HandleFunc("/{groupid}/collections", handler.makeCollectionListHandler(false)).Methods("GET")
+	router.HandleFunc("/{groupid}/collections/top", handler.makeCollectionListHandler(true)).Methods("GET")
+	router.HandleFunc("/{groupid}/collections/tree", handler.makeCollectionTreeHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/collectionnames/{name}", handler.makeCollectionGetHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/collections/{key}", handler.makeCollectionKeyHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/collections/{key}", handler.makeCollectionUpdateHandler()).Methods("PUT", "PATCH")
+	router.HandleFunc("/{groupid}/collections/{key}", handler.makeCollectionDeleteHandler()).Methods("DELETE")
+	router.HandleFunc("/{groupid}/collections/{key}/collections", handler.makeCollectionListHandler(false)).Methods("GET")
+	router.HandleFunc("/{groupid}/collections/{key}/collectionnames/{name}", handler.makeCollectionGetHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/collections/{key}/tree", handler.makeCollectionTreeHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/collections/{key}/items", handler.makeCollectionItemsHandler()).Methods("GET")
 	router.HandleFunc("/{groupid}/items/{key}/attachment", handler.makeItemAttachmentHandler()).Methods("POST")
+	router.HandleFunc("/{groupid}/items/{key}/merge", handler.makeItemMergeHandler()).Methods("POST")
+	router.HandleFunc("/{groupid}/items/{key}/file", handler.makeItemFileHandler()).Methods("GET", "HEAD")
+	router.HandleFunc("/groups", handler.makeGroupListHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/group", handler.makeGroupGetHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/group", handler.makeGroupUpdateHandler()).Methods("PATCH")
+	router.HandleFunc("/{groupid}/group/reset", handler.makeGroupResetHandler()).Methods("POST")
+	router.HandleFunc("/{groupid}/sync", handler.makeSyncStartHandler()).Methods("POST")
+	router.HandleFunc("/{groupid}/sync", handler.makeSyncStatusHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/changes", handler.makeChangesHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/webhooks", handler.makeWebhookListHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/webhooks", handler.makeWebhookCreateHandler()).Methods("POST")
+	router.HandleFunc("/{groupid}/webhooks/{id}", handler.makeWebhookGetHandler()).Methods("GET")
+	router.HandleFunc("/{groupid}/webhooks/{id}", handler.makeWebhookUpdateHandler()).Methods("PATCH")
+	router.HandleFunc("/{groupid}/webhooks/{id}", handler.makeWebhookDeleteHandler()).Methods("DELETE")
+	router.HandleFunc("/{groupid}/webhooks/{id}/deliveries", handler.makeWebhookDeliveriesHandler()).Methods("GET")
+
+	listenCtx, stopListen := context.WithCancel(context.Background())
+	defer stopListen()
+	go handler.changes.run(listenCtx, zotStorage, dispatcher.Notify, logger)
+	go dispatcher.Run(listenCtx, webhookInterval)
 
 	var f *os.File
 	if cfg.AccessLog == "" {
@@ -116,24 +185,32 @@ func main() {
 	}
 	defer f.Close()
 	l := alogger{handle: f}
-	headersOk := handlers.AllowedHeaders([]string{"Origin", "X-Requested-With", "Content-Type", "Accept", "Access-Control-Request-Method", "Authorization"})
-	originsOk := handlers.AllowedOrigins([]string{"*"})
-	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS", "DELETE"})
-	credentialsOk := handlers.AllowCredentials()
-	ignoreOptions := handlers.IgnoreOptions()
+	// authentication uses headers, not cookies, so credentials are not allowed
+	// and preflight requests are answered by the CORS handler without a key
+	headersOk := handlers.AllowedHeaders([]string{"Origin", "X-Requested-With", "Content-Type", "Accept", "Access-Control-Request-Method", "Authorization", "Zotero-API-Key", "If-Match", "If-Unmodified-Since-Version", "If-None-Match", "If-Range", "Range", "Last-Event-ID"})
+	// without configured origins cross-origin requests are rejected
+	originsOk := handlers.AllowedOriginValidator(func(origin string) bool {
+		return slices.Contains(cfg.Auth.AllowedOrigins, origin) || slices.Contains(cfg.Auth.AllowedOrigins, "*")
+	})
+	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "PATCH", "OPTIONS", "DELETE"})
+	exposedOk := handlers.ExposedHeaders([]string{"Total-Results", "ETag", "Content-Disposition", "Content-MD5", "Content-Range", "Accept-Ranges"})
 
 	server := &http.Server{
 		Handler: accesslog.NewLoggingHandler(handlers.CORS(
 			originsOk,
 			headersOk,
 			methodsOk,
-			credentialsOk,
-			ignoreOptions,
-		)(router), l),
+			exposedOk,
+		)(root), l),
 		Addr:         cfg.Listen,
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
 	}
+	// change streams do not end by themselves
+	server.RegisterOnShutdown(func() {
+		stopListen()
+		handler.changes.close()
+	})
 
 	go func() {
 		sigint := make(chan os.Signal, 1)
@@ -146,6 +223,13 @@ func main() {
 		if err = server.Shutdown(context.Background()); err != nil {
 			logger.Errorf("error shutting down server: %v", err)
 		}
+		if runner != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := runner.Shutdown(ctx); err != nil {
+				logger.Errorf("error stopping sync runs: %v", err)
+			}
+			cancel()
+		}
 	}()
 
 	logger.Infof("Rest Service listening on %s", cfg.Listen)
@@ -0,0 +1,290 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json/v2"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+)
+
+//go:generate go run ./generator
+
+// openapiJSON is the OpenAPI document of this service, generated from the
+// route table in generator/main.go and zotero_schema.json
+//
+//go:embed openapi.json
+var openapiJSON []byte
+
+// openapiSchemas returns components.schemas of the embedded document
+var openapiSchemas = sync.OnceValues(func() (map[string]any, error) {
+	var doc struct {
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openapiJSON, &doc); err != nil {
+		return nil, errors.Wrap(err, "cannot decode openapi.json")
+	}
+	return doc.Components.Schemas, nil
+})
+
+// makeOpenAPIHandler serves GET /openapi.json
+func (handlers *Handlers) makeOpenAPIHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(openapiJSON)
+	}
+}
+
+// validationIssue is one violation of the schema. Path is a JSON pointer
+// into the request body.
+type validationIssue struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// validationError is returned if a request body does not match its schema
+type validationError struct {
+	schema  string
+	details []validationIssue
+}
+
+func (e *validationError) Error() string {
+	msgs := make([]string, 0, len(e.details))
+	for _, d := range e.details {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", d.Path, d.Message))
+	}
+	return fmt.Sprintf("request body does not match schema %s: %s", e.schema, strings.Join(msgs, "; "))
+}
+
+func respondWithValidationError(w http.ResponseWriter, err *validationError) {
+	respondWithJSON(w, http.StatusBadRequest, map[string]any{
+		"error":   fmt.Sprintf("request body does not match schema %s", err.schema),
+		"details": err.details,
+	})
+}
+
+// validateBody checks the JSON document body against the schema with the
+// given name from the OpenAPI document. A *validationError is returned for
+// invalid bodies.
+func validateBody(schemaName string, body []byte) error {
+	schemas, err := openapiSchemas()
+	if err != nil {
+		return err
+	}
+	schema, ok := schemas[schemaName].(map[string]any)
+	if !ok {
+		return errors.Errorf("unknown schema %s", schemaName)
+	}
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return &validationError{schema: schemaName, details: []validationIssue{{Path: "", Message: fmt.Sprintf("invalid json: %v", err)}}}
+	}
+	v := &schemaValidator{schemas: schemas}
+	v.validate(schema, value, "")
+	if len(v.issues) > 0 {
+		return &validationError{schema: schemaName, details: v.issues}
+	}
+	return nil
+}
+
+// schemaValidator implements the subset of the OpenAPI 3.0 schema object
+// used by openapi.json: $ref, type, nullable, enum, required, properties,
+// additionalProperties, items, minLength, minimum, maximum, maxItems, allOf,
+// oneOf and discriminator.
+type schemaValidator struct {
+	schemas map[string]any
+	issues  []validationIssue
+}
+
+func (v *schemaValidator) addIssue(path, format string, args ...any) {
+	v.issues = append(v.issues, validationIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *schemaValidator) resolve(schema map[string]any) map[string]any {
+	for {
+		r, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+		resolved, ok := v.schemas[strings.TrimPrefix(r, "#/components/schemas/")].(map[string]any)
+		if !ok {
+			return map[string]any{}
+		}
+		schema = resolved
+	}
+}
+
+// matches reports whether value is valid for schema without recording issues
+func (v *schemaValidator) matches(schema map[string]any, value any, path string) bool {
+	sub := &schemaValidator{schemas: v.schemas}
+	sub.validate(schema, value, path)
+	return len(sub.issues) == 0
+}
+
+func jsonType(value any) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func (v *schemaValidator) validate(schema map[string]any, value any, path string) {
+	schema = v.resolve(schema)
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return
+		}
+	}
+
+	if t, ok := schema["type"].(string); ok {
+		actual := jsonType(value)
+		if actual != t && !(t == "number" && actual == "integer") {
+			v.addIssue(path, "must be of type %s, not %s", t, actual)
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		if len(enum) == 1 {
+			v.addIssue(path, "must be %v", enum[0])
+		} else {
+			v.addIssue(path, "%v is not one of the allowed values", value)
+		}
+	}
+
+	switch val := value.(type) {
+	case string:
+		if minLength, ok := schema["minLength"].(float64); ok && float64(len([]rune(val))) < minLength {
+			v.addIssue(path, "must have at least %v characters", minLength)
+		}
+	case float64:
+		if minimum, ok := schema["minimum"].(float64); ok && val < minimum {
+			v.addIssue(path, "must be at least %v", minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && val > maximum {
+			v.addIssue(path, "must be at most %v", maximum)
+		}
+	case []any:
+		if maxItems, ok := schema["maxItems"].(float64); ok && float64(len(val)) > maxItems {
+			v.addIssue(path, "must have at most %v elements", maxItems)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, elem := range val {
+				v.validate(items, elem, fmt.Sprintf("%s/%d", path, i))
+			}
+		}
+	case map[string]any:
+		v.validateObject(schema, val, path)
+	}
+
+	if allOf, ok := schema["allOf"].([]any); ok {
+		for _, s := range allOf {
+			if sub, ok := s.(map[string]any); ok {
+				v.validate(sub, value, path)
+			}
+		}
+	}
+
+	if discriminator, ok := schema["discriminator"].(map[string]any); ok {
+		// the discriminator selects the schema, so the issues of that schema
+		// are reported instead of a failed oneOf
+		v.validateDiscriminated(discriminator, value, path)
+		return
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		matched := 0
+		for _, s := range oneOf {
+			if sub, ok := s.(map[string]any); ok && v.matches(sub, value, path) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.addIssue(path, "must match exactly one of %d alternatives, matches %d", len(oneOf), matched)
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(schema map[string]any, value map[string]any, path string) {
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := value[name]; !ok {
+				v.addIssue(path+"/"+escapePointer(name), "required property missing")
+			}
+		}
+	}
+	properties, _ := schema["properties"].(map[string]any)
+	// sorted names for stable messages
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		propPath := path + "/" + escapePointer(name)
+		if prop, ok := properties[name].(map[string]any); ok {
+			v.validate(prop, value[name], propPath)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.addIssue(propPath, "unknown property")
+			}
+		case map[string]any:
+			v.validate(additional, value[name], propPath)
+		}
+	}
+}
+
+func (v *schemaValidator) validateDiscriminated(discriminator map[string]any, value any, path string) {
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return
+	}
+	propertyName, _ := discriminator["propertyName"].(string)
+	mapping, _ := discriminator["mapping"].(map[string]any)
+	propPath := path + "/" + escapePointer(propertyName)
+	name, ok := obj[propertyName].(string)
+	if !ok {
+		// missing or wrongly typed property is reported by required/type
+		if _, exists := obj[propertyName]; exists {
+			v.addIssue(propPath, "must be of type string")
+		}
+		return
+	}
+	target, ok := mapping[name].(string)
+	if !ok {
+		v.addIssue(propPath, "unknown %s %q", propertyName, name)
+		return
+	}
+	v.validate(map[string]any{"$ref": target}, value, path)
+}
+
+// escapePointer escapes a property name for a JSON pointer (RFC 6901)
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
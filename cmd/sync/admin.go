@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+// groupChanges are the group administration flags; empty strings keep the
+// current value.
+type groupChanges struct {
+	active    string
+	direction string
+	syncTags  string
+	reset     bool
+}
+
+func (c groupChanges) empty() bool {
+	return c.active == "" && c.direction == "" && c.syncTags == "" && !c.reset
+}
+
+// listGroups writes all groups with their sync settings and cursors as table.
+func listGroups(ctx context.Context, st storage.GroupStore, out io.Writer) error {
+	groups, err := st.ListGroups(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot list groups")
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tACTIVE\tDIRECTION\tTAGS\tVERSION\tCOLLECTIONS\tITEMS\tTAGVERSION")
+	for _, g := range groups {
+		fmt.Fprintf(tw, "%d\t%s\t%v\t%s\t%v\t%d\t%d\t%d\t%d\n", g.Id, g.Data.Name, g.Active, model.SyncDirectionString[g.Direction], g.SyncTags,
+			g.Version, g.CollectionVersion, g.ItemVersion, g.TagVersion)
+	}
+	return tw.Flush()
+}
+
+// changeGroup applies the administration flags to group groupId.
+func changeGroup(ctx context.Context, st storage.GroupStore, groupId int64, changes groupChanges) error {
+	group, err := st.GetGroup(ctx, groupId)
+	if err != nil {
+		return errors.Wrapf(err, "cannot load group %v", groupId)
+	}
+	if changes.active != "" {
+		if group.Active, err = strconv.ParseBool(changes.active); err != nil {
+			return errors.Wrapf(err, "invalid value for active: %s", changes.active)
+		}
+	}
+	if changes.direction != "" {
+		direction, ok := model.SyncDirectionId[changes.direction]
+		if !ok {
+			return errors.Errorf("invalid direction %q", changes.direction)
+		}
+		group.Direction = direction
+	}
+	if changes.syncTags != "" {
+		if group.SyncTags, err = strconv.ParseBool(changes.syncTags); err != nil {
+			return errors.Wrapf(err, "invalid value for synctags: %s", changes.syncTags)
+		}
+	}
+	if err := st.UpdateSyncGroup(ctx, group); err != nil {
+		return errors.Wrapf(err, "cannot update group %v", groupId)
+	}
+	if changes.reset {
+		if err := st.ClearGroup(ctx, groupId); err != nil {
+			return errors.Wrapf(err, "cannot reset cursors of group %v", groupId)
+		}
+	}
+	return nil
+}
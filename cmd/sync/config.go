@@ -5,6 +5,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/je4/utils/v2/pkg/config"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/backend"
 )
 
 type Cfg_database struct {
@@ -40,10 +41,20 @@ type Config struct {
 	Attachmentfolder     string
 	DB                   Cfg_database `toml:"database"`
 	GroupCacheExpiration string       `toml:"groupcacheexpiration"`
+	SyncStaleAfter       string       `toml:"syncstaleafter"`
 	Gitlab               Cfg_gitlab   `tomal:"gitlab"`
 	S3                   S3           `toml:"s3"`
 }
 
+// storeConfig is the database configuration for backend.OpenStore.
+func (cfg *Config) storeConfig() backend.Config {
+	return backend.Config{
+		ServerType:     cfg.DB.ServerType,
+		DSN:            cfg.DB.DSN.String(),
+		NewGroupActive: cfg.NewGroupActive,
+	}
+}
+
 func LoadConfig(filepath string) Config {
 	var conf Config
 	_, err := toml.DecodeFile(filepath, &conf)
@@ -10,12 +10,14 @@ import (
 	"slices"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"emperror.dev/errors"
 	"github.com/je4/utils/v2/pkg/zLogger"
 	"github.com/je4/zsync/v2/pkg/filesystem"
 	"github.com/je4/zsync/v2/pkg/zotero/client"
 	"github.com/je4/zsync/v2/pkg/zotero/storage"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/backend"
 	"github.com/je4/zsync/v2/pkg/zotero/sync"
+	"github.com/je4/zsync/v2/pkg/zotero/webhook"
 	"github.com/rs/zerolog"
 )
 
@@ -24,15 +26,34 @@ type ZotField struct {
 	Localized string `json:"localized"`
 }
 
-func doSync(ctx context.Context, cfg *Config, db *pgxpool.Pool, fs filesystem.FileSystem, logger zLogger.ZLogger) {
+func doSync(ctx context.Context, cfg *Config, zotStorage storage.Store, fs filesystem.FileSystem, logger zLogger.ZLogger) {
 	zotClient, err := client.NewClient(ctx, cfg.Endpoint, cfg.Apikey.String(), logger)
 	if err != nil {
 		logger.Error().Msgf("cannot create zotero client: %v", err)
 		return
 	}
 
-	zotStorage := storage.NewStorage(db, cfg.NewGroupActive, logger)
 	syncer := sync.NewSyncer(zotClient, zotStorage, fs, logger)
+	// deliver the webhook events of this sync; failed deliveries are retried
+	// by the next sync or the rest service
+	defer func() {
+		num, err := webhook.NewDispatcher(zotStorage, nil, logger).DeliverPending(ctx)
+		if err != nil {
+			logger.Error().Msgf("cannot deliver webhooks: %v", err)
+		}
+		if num > 0 {
+			logger.Info().Msgf("%d webhook events delivered", num)
+		}
+	}()
+	var staleAfter time.Duration
+	if cfg.SyncStaleAfter != "" {
+		if staleAfter, err = time.ParseDuration(cfg.SyncStaleAfter); err != nil {
+			logger.Error().Msgf("invalid syncstaleafter %q: %v", cfg.SyncStaleAfter, err)
+			return
+		}
+	}
+	// runs are recorded in sync_runs, next to the runs started by the rest service
+	runner := sync.NewRunner(syncer, 1, staleAfter)
 
 	logger.Info().Msgf("current key: %v", zotClient.CurrentKey)
 
@@ -70,10 +91,15 @@ func doSync(ctx context.Context, cfg *Config, db *pgxpool.Pool, fs filesystem.Fi
 			}
 			group.CollectionVersion = 0
 			group.ItemVersion = 0
+			group.TagVersion = 0
 			group.Version = 0
 		}
 
-		if err := syncer.SyncGroup(ctx, group); err != nil {
+		if _, err := runner.Run(ctx, group, "cli", ""); err != nil {
+			if errors.Is(err, storage.ErrSyncRunActive) {
+				logger.Info().Msgf("group #%v is already being synced", group.Id)
+				continue
+			}
 			logger.Error().Msgf("cannot sync group #%v: %v", group.Id, err)
 			continue
 		}
@@ -112,6 +138,15 @@ func main() {
 	cfgfile := flag.String("c", "", "location of config file")
 	clear := flag.Bool("clear", false, "clear all data of group")
 	groupid := flag.Int64("group", 0, "id of zotero group to sync")
+	list := flag.Bool("list", false, "list groups with sync settings and cursors")
+	active := flag.String("active", "", "set active flag of group (true/false) without syncing")
+	direction := flag.String("direction", "", "set sync direction of group (none, tocloud, tolocal, bothcloud, bothlocal, bothmanual) without syncing")
+	syncTags := flag.String("synctags", "", "set tag sync of group (true/false) without syncing")
+	reset := flag.Bool("reset", false, "reset sync cursors of group without syncing")
+	purgeDays := flag.Int("purge", 0, "remove deleted and synced items and collections older than this number of days without syncing")
+	gc := flag.Bool("gc", false, "remove attachment files without attachment item without syncing")
+	gcGrace := flag.Duration("gcgrace", 24*time.Hour, "keep attachment files younger than this in -gc")
+	dryRun := flag.Bool("dryrun", false, "only report what -gc would remove and skip -purge")
 
 	flag.Parse()
 
@@ -142,17 +177,30 @@ func main() {
 		}
 	}
 
-	// get database connection handle
-	db, err := pgxpool.New(context.Background(), cfg.DB.DSN.String())
-	if err != nil {
-		log.Fatalf("error opening database: %v", err)
+	changes := groupChanges{
+		active:    *active,
+		direction: *direction,
+		syncTags:  *syncTags,
+		reset:     *reset,
 	}
-	defer db.Close()
-
-	// Validate DSN data:
-	err = db.Ping(context.Background())
-	if err != nil {
-		log.Fatalf("error pinging database: %v", err)
+	if *list || !changes.empty() {
+		zotStorage, closeStorage, err := backend.OpenStore(context.Background(), cfg.storeConfig(), nil)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer closeStorage()
+		if !changes.empty() {
+			if *groupid == 0 {
+				log.Fatalf("group administration needs -group")
+			}
+			if err := changeGroup(context.Background(), zotStorage, *groupid, changes); err != nil {
+				log.Fatalf("cannot change group %v: %v", *groupid, err)
+			}
+		}
+		if err := listGroups(context.Background(), zotStorage, os.Stdout); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
 	}
 
 	var out io.Writer = os.Stdout
@@ -175,5 +223,29 @@ func main() {
 		log.Fatalf("cannot connect to s3 instance: %v", err)
 	}
 
-	doSync(context.Background(), &cfg, db, fs, logger)
+	zotStorage, closeStorage, err := backend.OpenStore(context.Background(), cfg.storeConfig(), logger)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer closeStorage()
+
+	tasks := maintenance{
+		purgeDays: *purgeDays,
+		gc:        *gc,
+		gcGrace:   *gcGrace,
+		dryRun:    *dryRun,
+	}
+	if !tasks.empty() {
+		var groupIds []int64
+		if *groupid > 0 {
+			groupIds = []int64{*groupid}
+		}
+		syncer := sync.NewSyncer(nil, zotStorage, fs, logger)
+		if err := runMaintenance(context.Background(), syncer, zotStorage, groupIds, tasks, os.Stdout); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+
+	doSync(context.Background(), &cfg, zotStorage, fs, logger)
 }
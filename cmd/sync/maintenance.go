@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"io"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+	"github.com/je4/zsync/v2/pkg/zotero/sync"
+)
+
+// maintenance are the flags of the purge and the attachment garbage
+// collection, which run instead of a sync.
+type maintenance struct {
+	purgeDays int
+	gc        bool
+	gcGrace   time.Duration
+	dryRun    bool
+}
+
+func (m maintenance) empty() bool {
+	return m.purgeDays <= 0 && !m.gc
+}
+
+// purgeReport is written as JSON for each group
+type purgeReport struct {
+	GroupId     int64          `json:"groupId"`
+	Items       int64          `json:"purgedItems"`
+	Collections int64          `json:"purgedCollections"`
+	GC          *sync.GCReport `json:"gc,omitempty"`
+}
+
+// runMaintenance purges and collects the groups groupIds, or all groups if
+// groupIds is empty, and writes a report per group to out. With dryRun
+// nothing is purged and the garbage collection only reports.
+func runMaintenance(ctx context.Context, syncer *sync.Syncer, st storage.Store, groupIds []int64, m maintenance, out io.Writer) error {
+	if len(groupIds) == 0 {
+		groups, err := st.ListGroups(ctx)
+		if err != nil {
+			return errors.Wrap(err, "cannot list groups")
+		}
+		for _, group := range groups {
+			groupIds = append(groupIds, group.Id)
+		}
+	}
+	for _, groupId := range groupIds {
+		report := purgeReport{GroupId: groupId}
+		var err error
+		if m.purgeDays > 0 && !m.dryRun {
+			report.Items, report.Collections, err = syncer.PurgeDeleted(ctx, groupId, time.Duration(m.purgeDays)*24*time.Hour)
+			if err != nil {
+				return err
+			}
+		}
+		if m.gc {
+			if report.GC, err = syncer.CollectGarbage(ctx, groupId, m.gcGrace, m.dryRun); err != nil {
+				return errors.Wrapf(err, "cannot collect garbage of group %v", groupId)
+			}
+		}
+		if err := json.MarshalWrite(out, report, jsontext.Multiline(true)); err != nil {
+			return errors.Wrap(err, "cannot write report")
+		}
+		if _, err := io.WriteString(out, "\n"); err != nil {
+			return errors.Wrap(err, "cannot write report")
+		}
+	}
+	return nil
+}
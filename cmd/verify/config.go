@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log"
+
+	"github.com/BurntSushi/toml"
+	"github.com/je4/utils/v2/pkg/config"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/backend"
+)
+
+type Cfg_database struct {
+	ServerType string
+	DSN        config.EnvString
+	ConnMax    int `toml:"connection_max"`
+}
+
+type S3 struct {
+	Endpoint        string           `toml:"endpoint"`
+	AccessKeyId     config.EnvString `toml:"accessKeyId"`
+	SecretAccessKey config.EnvString `toml:"secretAccessKey"`
+	UseSSL          bool             `toml:"useSSL"`
+}
+
+type Config struct {
+	Synconly       []int64
+	Endpoint       string
+	Apikey         config.EnvString
+	Logfile        string
+	Loglevel       string
+	NewGroupActive bool         `toml:"newgroupactive"`
+	DB             Cfg_database `toml:"database"`
+	S3             S3           `toml:"s3"`
+}
+
+// storeConfig is the database configuration for backend.OpenStore.
+func (cfg *Config) storeConfig() backend.Config {
+	return backend.Config{
+		ServerType:     cfg.DB.ServerType,
+		DSN:            cfg.DB.DSN.String(),
+		NewGroupActive: cfg.NewGroupActive,
+	}
+}
+
+func LoadConfig(filepath string) Config {
+	var conf Config
+	_, err := toml.DecodeFile(filepath, &conf)
+	if err != nil {
+		log.Fatalln("Error on loading config: ", err)
+	}
+	return conf
+}
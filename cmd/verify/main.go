@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/je4/zsync/v2/pkg/filesystem"
+	"github.com/je4/zsync/v2/pkg/zotero/client"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/backend"
+	"github.com/je4/zsync/v2/pkg/zotero/sync"
+	"github.com/rs/zerolog"
+)
+
+// exitIssues is the exit status if inconsistencies were found
+const exitIssues = 2
+
+// verify checks the groups groupIds, or all groups if groupIds is empty,
+// and writes a report per group to out. It returns the number of issues.
+func verify(ctx context.Context, syncer *sync.Syncer, st storage.Store, groupIds []int64, repair bool, out io.Writer) (int, error) {
+	if len(groupIds) == 0 {
+		groups, err := st.ListGroups(ctx)
+		if err != nil {
+			return 0, errors.Wrap(err, "cannot list groups")
+		}
+		for _, group := range groups {
+			groupIds = append(groupIds, group.Id)
+		}
+	}
+	var issues int
+	for _, groupId := range groupIds {
+		report, err := syncer.Verify(ctx, groupId, repair)
+		if err != nil {
+			return issues, errors.Wrapf(err, "cannot verify group %v", groupId)
+		}
+		issues += len(report.Issues)
+		if err := json.MarshalWrite(out, report, jsontext.Multiline(true)); err != nil {
+			return issues, errors.Wrap(err, "cannot write report")
+		}
+		if _, err := io.WriteString(out, "\n"); err != nil {
+			return issues, errors.Wrap(err, "cannot write report")
+		}
+	}
+	return issues, nil
+}
+
+func main() {
+	cfgfile := flag.String("c", "", "location of config file")
+	groupid := flag.Int64("group", 0, "id of zotero group to verify")
+	repair := flag.Bool("repair", false, "schedule a new download of objects that differ from the zotero cloud")
+	offline := flag.Bool("offline", false, "do not compare with the zotero cloud")
+	noFiles := flag.Bool("nofiles", false, "do not check attachment files")
+
+	flag.Parse()
+
+	var configFile = *cfgfile
+	if configFile == "" {
+		if _, err := os.Stat("zoterosync.toml"); err == nil {
+			configFile = "zoterosync.toml"
+		} else {
+			ex, err := os.Executable()
+			if err != nil {
+				panic(err)
+			}
+			exPath := filepath.Dir(ex)
+			if _, err := os.Stat(filepath.Join(exPath, "zoterosync.toml")); err == nil {
+				configFile = filepath.Join(exPath, "zoterosync.toml")
+			}
+		}
+	}
+
+	cfg := LoadConfig(configFile)
+
+	// the report goes to stdout, so the log defaults to stderr
+	var out io.Writer = os.Stderr
+	if cfg.Logfile != "" {
+		fp, err := os.OpenFile(cfg.Logfile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalf("cannot open logfile %s: %v", cfg.Logfile, err)
+		}
+		defer fp.Close()
+		out = fp
+	}
+
+	output := zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339}
+	_logger := zerolog.New(output).With().Timestamp().Logger()
+	_logger.Level(zLogger.LogLevel(cfg.Loglevel))
+	var logger zLogger.ZLogger = &_logger
+
+	ctx := context.Background()
+	zotStorage, closeStorage, err := backend.OpenStore(ctx, cfg.storeConfig(), logger)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer closeStorage()
+
+	syncer := sync.NewSyncer(nil, zotStorage, nil, logger)
+	if !*offline {
+		if syncer.Client, err = client.NewClient(ctx, cfg.Endpoint, cfg.Apikey.String(), logger); err != nil {
+			log.Fatalf("cannot create zotero client: %v", err)
+		}
+	}
+	if !*noFiles {
+		if syncer.Fs, err = filesystem.NewS3Fs(cfg.S3.Endpoint, cfg.S3.AccessKeyId.String(), cfg.S3.SecretAccessKey.String(), cfg.S3.UseSSL); err != nil {
+			log.Fatalf("cannot connect to s3 instance: %v", err)
+		}
+	}
+
+	groupIds := slices.Clone(cfg.Synconly)
+	if *groupid > 0 {
+		groupIds = []int64{*groupid}
+	}
+	issues, err := verify(ctx, syncer, zotStorage, groupIds, *repair, os.Stdout)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if issues > 0 {
+		closeStorage()
+		os.Exit(exitIssues)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json/v2"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/je4/zsync/v2/pkg/zotero/importer"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+	"github.com/rs/zerolog"
+)
+
+type report struct {
+	Mapping     string                `json:"mapping"`
+	Group       int64                 `json:"group"`
+	Results     []importer.Result     `json:"results"`
+	Diagnostics []importer.Diagnostic `json:"diagnostics"`
+}
+
+// openSource creates the row source configured in the mapping. The returned
+// function releases its resources.
+func openSource(ctx context.Context, cfg importer.SourceConfig) (importer.Source, func(), error) {
+	switch cfg.Type {
+	case "sql", "":
+		db, err := sql.Open(cfg.Driver, cfg.DSN.String())
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot open source database: %w", err)
+		}
+		if err := db.PingContext(ctx); err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("cannot ping source database: %w", err)
+		}
+		return importer.NewSQLSource(db, cfg.Query), func() { db.Close() }, nil
+	case "csv":
+		var r io.Reader = os.Stdin
+		closeFn := func() {}
+		if cfg.File != "" && cfg.File != "-" {
+			fp, err := os.Open(cfg.File)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot open %s: %w", cfg.File, err)
+			}
+			r = fp
+			closeFn = func() { fp.Close() }
+		}
+		src, err := importer.NewCSVSource(r, cfg.Delimiter)
+		if err != nil {
+			closeFn()
+			return nil, nil, err
+		}
+		return src, closeFn, nil
+	}
+	return nil, nil, fmt.Errorf("unknown source type %q", cfg.Type)
+}
+
+// writeReport writes one line per source row with its status and all
+// messages reported for it.
+func writeReport(filename string, results []importer.Result, diags []importer.Diagnostic) error {
+	fp, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	messages := map[int][]string{}
+	for _, d := range diags {
+		messages[d.Entry] = append(messages[d.Entry], fmt.Sprintf("%s: %s", d.Severity, d.Message))
+	}
+	w := csv.NewWriter(fp)
+	if err := w.Write([]string{"row", "id", "status", "key", "messages"}); err != nil {
+		return err
+	}
+	for _, r := range results {
+		status := "created"
+		switch {
+		case r.Error != "":
+			status = "failed"
+		case r.Key == "":
+			status = "valid"
+		case r.Updated:
+			status = "updated"
+		}
+		if err := w.Write([]string{
+			strconv.Itoa(r.Row),
+			r.SourceId,
+			status,
+			r.Key,
+			strings.Join(messages[r.Row], "\n"),
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func main() {
+	cfgfile := flag.String("c", "zoterosync.toml", "location of config file")
+	mappingfile := flag.String("m", "", "location of mapping file")
+	groupid := flag.Int64("group", 0, "id of target zotero group, overrides the mapping")
+	dry := flag.Bool("dry", false, "render and validate only, do not write to database")
+	check := flag.Bool("check", false, "validate all rows first and write nothing if a row has errors")
+	input := flag.String("input", "", "input file for csv sources, overrides the mapping")
+	jsonReport := flag.Bool("json", false, "write report as json to stdout")
+	csvReport := flag.String("report", "", "write per-row report as csv to this file")
+	flag.Parse()
+
+	if *mappingfile == "" {
+		log.Fatalf("no mapping file given")
+	}
+	mapping, err := importer.LoadMapping(*mappingfile)
+	if err != nil {
+		log.Fatalf("cannot load mapping: %v", err)
+	}
+	if *groupid != 0 {
+		mapping.Group = *groupid
+	}
+	if *input != "" {
+		mapping.Source.File = *input
+	}
+	if mapping.Group == 0 && !*dry {
+		log.Fatalf("no target group given")
+	}
+
+	cfg := LoadConfig(*cfgfile)
+
+	var out io.Writer = os.Stderr
+	if cfg.Logfile != "" {
+		fp, err := os.OpenFile(cfg.Logfile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalf("cannot open logfile %s: %v", cfg.Logfile, err)
+		}
+		defer fp.Close()
+		out = fp
+	}
+	output := zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339}
+	_logger := zerolog.New(output).With().Timestamp().Logger()
+	_logger.Level(zLogger.LogLevel(cfg.Loglevel))
+	var logger zLogger.ZLogger = &_logger
+
+	ctx := context.Background()
+
+	var zotStorage *storage.Storage
+	if !*dry {
+		db, err := pgxpool.New(ctx, cfg.DB.DSN.String())
+		if err != nil {
+			log.Fatalf("error opening database: %v", err)
+		}
+		defer db.Close()
+		if err := db.Ping(ctx); err != nil {
+			log.Fatalf("error pinging database: %v", err)
+		}
+		zotStorage = storage.NewStorage(db, false, logger)
+	}
+
+	imp, err := importer.NewMappingImporter(zotStorage, mapping, *dry, logger)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	imp.CheckFirst = *check
+
+	src, closeSource, err := openSource(ctx, mapping.Source)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer closeSource()
+
+	results, diags, err := imp.Run(ctx, src)
+	if err != nil {
+		logger.Error().Err(err).Msg("import aborted")
+	}
+	failed := err != nil || importer.HasErrors(diags)
+
+	if *csvReport != "" {
+		if err := writeReport(*csvReport, results, diags); err != nil {
+			log.Fatalf("cannot write report: %v", err)
+		}
+	}
+
+	if *jsonReport {
+		if err := json.MarshalWrite(os.Stdout, report{
+			Mapping:     *mappingfile,
+			Group:       mapping.Group,
+			Results:     results,
+			Diagnostics: diags,
+		}); err != nil {
+			log.Fatalf("cannot write report: %v", err)
+		}
+	} else {
+		for _, d := range diags {
+			fmt.Println(d)
+		}
+		created, updated, errs := 0, 0, 0
+		for _, r := range results {
+			switch {
+			case r.Error != "":
+				errs++
+			case r.Updated:
+				updated++
+			default:
+				created++
+			}
+		}
+		fmt.Printf("%d rows, %d created, %d updated, %d failed\n", len(results), created, updated, errs)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -1,17 +1,23 @@
 package filesystem
 
 import (
+	"context"
 	"emperror.dev/errors"
 	"fmt"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/op/go-logging"
 	"io"
+	"iter"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
+var _ FileSystem = (*GitFs)(nil)
+
 type GitFs struct {
 	localFs *LocalFs
 	repo    *git.Repository
@@ -41,6 +47,10 @@ func (fs *GitFs) String() string {
 	return fs.localFs.basepath
 }
 
+func (fs *GitFs) Protocol() string {
+	return "git://"
+}
+
 func (fs *GitFs) Open() error {
 	var err error
 	fs.repo, err = git.PlainOpen(fs.localFs.basepath)
@@ -50,32 +60,32 @@ func (fs *GitFs) Open() error {
 	return nil
 }
 
-func (fs *GitFs) FileStat(folder, name string, opts FileStatOptions) (os.FileInfo, error) {
-	return fs.localFs.FileStat(folder, name, opts)
+func (fs *GitFs) FileStat(ctx context.Context, folder, name string, opts FileStatOptions) (os.FileInfo, error) {
+	return fs.localFs.FileStat(ctx, folder, name, opts)
 }
 
-func (fs *GitFs) FileExists(folder, name string) (bool, error) {
-	return fs.localFs.FileExists(folder, name)
+func (fs *GitFs) FileExists(ctx context.Context, folder, name string) (bool, error) {
+	return fs.localFs.FileExists(ctx, folder, name)
 }
 
-func (fs *GitFs) FolderExists(folder string) (bool, error) {
-	return fs.localFs.FolderExists(folder)
+func (fs *GitFs) FolderExists(ctx context.Context, folder string) (bool, error) {
+	return fs.localFs.FolderExists(ctx, folder)
 }
 
-func (fs *GitFs) FolderCreate(folder string, opts FolderCreateOptions) error {
-	return fs.localFs.FolderCreate(folder, opts)
+func (fs *GitFs) FolderCreate(ctx context.Context, folder string, opts FolderCreateOptions) error {
+	return fs.localFs.FolderCreate(ctx, folder, opts)
 }
 
-func (fs *GitFs) FileGet(folder, name string, opts FileGetOptions) ([]byte, error) {
-	return fs.localFs.FileGet(folder, name, opts)
+func (fs *GitFs) FileGet(ctx context.Context, folder, name string, opts FileGetOptions) ([]byte, error) {
+	return fs.localFs.FileGet(ctx, folder, name, opts)
 }
 
-func (fs *GitFs) FilePut(folder, name string, data []byte, opts FilePutOptions) error {
-	isUpdate, err := fs.FileExists(folder, name)
+func (fs *GitFs) FilePut(ctx context.Context, folder, name string, data []byte, opts FilePutOptions) error {
+	isUpdate, err := fs.FileExists(ctx, folder, name)
 	if err != nil {
 		return errors.Wrapf(err, "cannot stat file %v/%v", folder, name)
 	}
-	if err := fs.localFs.FilePut(folder, name, data, opts); err != nil {
+	if err := fs.localFs.FilePut(ctx, folder, name, data, opts); err != nil {
 		return err
 	}
 	if !isUpdate {
@@ -90,12 +100,12 @@ func (fs *GitFs) FilePut(folder, name string, data []byte, opts FilePutOptions)
 	return nil
 }
 
-func (fs *GitFs) FileWrite(folder, name string, r io.Reader, size int64, opts FilePutOptions) error {
-	isUpdate, err := fs.FileExists(folder, name)
+func (fs *GitFs) FileWrite(ctx context.Context, folder, name string, r io.Reader, size int64, opts FilePutOptions) error {
+	isUpdate, err := fs.FileExists(ctx, folder, name)
 	if err != nil {
 		return errors.Wrapf(err, "cannot stat file %v/%v", folder, name)
 	}
-	if err := fs.localFs.FileWrite(folder, name, r, size, opts); err != nil {
+	if err := fs.localFs.FileWrite(ctx, folder, name, r, size, opts); err != nil {
 		return err
 	}
 	if !isUpdate {
@@ -113,12 +123,100 @@ func (fs *GitFs) FileWrite(folder, name string, r io.Reader, size int64, opts Fi
 	return nil
 }
 
-func (fs *GitFs) FileRead(folder, name string, w io.Writer, size int64, opts FileGetOptions) error {
-	return fs.localFs.FileRead(folder, name, w, size, opts)
+func (fs *GitFs) FileRead(ctx context.Context, folder, name string, w io.Writer, size int64, opts FileGetOptions) error {
+	return fs.localFs.FileRead(ctx, folder, name, w, size, opts)
+}
+
+func (fs *GitFs) FileOpenRead(ctx context.Context, folder, name string, opts FileGetOptions) (io.ReadCloser, error) {
+	return fs.localFs.FileOpenRead(ctx, folder, name, opts)
+}
+
+func (fs *GitFs) FolderDelete(ctx context.Context, folder string) error {
+	var names []string
+	for entry, err := range fs.localFs.FileList(ctx, folder, "") {
+		if err != nil {
+			if IsNotFoundError(err) {
+				return nil
+			}
+			return err
+		}
+		names = append(names, entry.Name)
+	}
+	if err := fs.localFs.FolderDelete(ctx, folder); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := fs.remove(folder, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *GitFs) FileDelete(ctx context.Context, folder, name string) error {
+	if err := fs.localFs.FileDelete(ctx, folder, name); err != nil {
+		return err
+	}
+	return fs.remove(folder, name)
+}
+
+// FileList lists the files of the work tree without the repository itself
+func (fs *GitFs) FileList(ctx context.Context, folder, prefix string) iter.Seq2[FileEntry, error] {
+	return func(yield func(FileEntry, error) bool) {
+		for entry, err := range fs.localFs.FileList(ctx, folder, prefix) {
+			if err == nil && folder == "" && (entry.Name == ".git" || strings.HasPrefix(entry.Name, ".git/")) {
+				continue
+			}
+			if !yield(entry, err) {
+				return
+			}
+		}
+	}
 }
 
-func (fs *GitFs) FileOpenRead(folder, name string, opts FileGetOptions) (io.ReadCloser, error) {
-	return fs.localFs.FileOpenRead(folder, name, opts)
+func (fs *GitFs) FileCopy(ctx context.Context, srcFolder, srcName, dstFolder, dstName string) error {
+	if err := fs.localFs.FileCopy(ctx, srcFolder, srcName, dstFolder, dstName); err != nil {
+		return err
+	}
+	return fs.add(dstFolder, dstName)
+}
+
+func (fs *GitFs) FileMove(ctx context.Context, srcFolder, srcName, dstFolder, dstName string) error {
+	// removing the source from the index would remove the destination
+	if same, err := fs.localFs.samePath(srcFolder, srcName, dstFolder, dstName); err != nil || same {
+		return err
+	}
+	if err := fs.localFs.FileMove(ctx, srcFolder, srcName, dstFolder, dstName); err != nil {
+		return err
+	}
+	if err := fs.add(dstFolder, dstName); err != nil {
+		return err
+	}
+	return fs.remove(srcFolder, srcName)
+}
+
+// add stages a file
+func (fs *GitFs) add(folder, name string) error {
+	w, err := fs.repo.Worktree()
+	if err != nil {
+		return errors.Wrapf(err, "cannot open worktree of %v", fs.localFs.basepath)
+	}
+	if _, err := w.Add(filepath.Join(folder, name)); err != nil {
+		return errors.Wrapf(err, "cannot add %v/%v/%v to repository", fs.localFs.basepath, folder, name)
+	}
+	return nil
+}
+
+// remove stages the removal of a file, files that were never added are ignored
+func (fs *GitFs) remove(folder, name string) error {
+	w, err := fs.repo.Worktree()
+	if err != nil {
+		return errors.Wrapf(err, "cannot open worktree of %v", fs.localFs.basepath)
+	}
+	if _, err := w.Remove(filepath.Join(folder, name)); err != nil && !errors.Is(err, index.ErrEntryNotFound) {
+		return errors.Wrapf(err, "cannot remove %v/%v/%v from repository", fs.localFs.basepath, folder, name)
+	}
+	return nil
 }
 
 func (fs *GitFs) Commit(msg, name, email string) error {
@@ -1,14 +1,21 @@
 package filesystem
 
 import (
-	"emperror.dev/errors"
+	"context"
 	"fmt"
-	"github.com/op/go-logging"
 	"io"
+	iofs "io/fs"
+	"iter"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/op/go-logging"
 )
 
+var _ FileSystem = (*LocalFs)(nil)
+
 type LocalFs struct {
 	basepath string
 	logger   *logging.Logger
@@ -45,47 +52,112 @@ func (fs *LocalFs) String() string {
 	return fs.basepath
 }
 
-func (fs *LocalFs) FileStat(folder, name string, opts FileStatOptions) (os.FileInfo, error) {
-	path := filepath.Join(folder, name)
-	return os.Stat(filepath.Join(fs.basepath, path))
+// path joins the elements to a path below basepath. Absolute paths and
+// paths that leave basepath with ".." are refused.
+func (fs *LocalFs) path(elem ...string) (string, error) {
+	rel := filepath.Join(elem...)
+	if rel != "" && !filepath.IsLocal(rel) {
+		return "", errors.Wrapf(ErrInvalidPath, "%v is not below %v", filepath.Join(elem...), fs.basepath)
+	}
+	return filepath.Join(fs.basepath, rel), nil
+}
+
+// filePath is path for files, which need a name
+func (fs *LocalFs) filePath(folder, name string) (string, error) {
+	if name == "" {
+		return "", errors.Wrapf(ErrInvalidPath, "no file name in folder %v", folder)
+	}
+	return fs.path(folder, name)
 }
 
-func (fs *LocalFs) FileExists(folder, name string) (bool, error) {
-	path := filepath.Join(folder, name)
-	return FileExists(filepath.Join(fs.basepath, path)), nil
+// notFound converts errors of missing files to NotFoundError
+func notFound(err error, format string, args ...any) error {
+	if errors.Is(err, iofs.ErrNotExist) {
+		return &NotFoundError{err: err}
+	}
+	return errors.Wrapf(err, format, args...)
 }
 
-func (fs *LocalFs) FolderExists(folder string) (bool, error) {
-	return FolderExists(filepath.Join(fs.basepath, folder)), nil
+func (fs *LocalFs) FileStat(ctx context.Context, folder, name string, opts FileStatOptions) (os.FileInfo, error) {
+	path, err := fs.filePath(folder, name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, notFound(err, "cannot stat file %v", path)
+	}
+	return info, nil
+}
+
+func (fs *LocalFs) FileExists(ctx context.Context, folder, name string) (bool, error) {
+	path, err := fs.filePath(folder, name)
+	if err != nil {
+		return false, err
+	}
+	return FileExists(path), nil
+}
+
+func (fs *LocalFs) FolderExists(ctx context.Context, folder string) (bool, error) {
+	path, err := fs.path(folder)
+	if err != nil {
+		return false, err
+	}
+	return FolderExists(path), nil
 }
 
-func (fs *LocalFs) FolderCreate(folder string, opts FolderCreateOptions) error {
-	path := filepath.Join(fs.basepath, folder)
+func (fs *LocalFs) FolderCreate(ctx context.Context, folder string, opts FolderCreateOptions) error {
+	path, err := fs.path(folder)
+	if err != nil {
+		return err
+	}
 	if FolderExists(path) {
 		return nil
 	}
 	fs.logger.Debugf("create folder %v", path)
-	err := os.MkdirAll(path, 0755)
-	if err != nil {
+	if err := os.MkdirAll(path, 0755); err != nil {
 		return errors.Wrapf(err, "cannot create folder %v", path)
 	}
 	return nil
 }
 
-func (fs *LocalFs) FileGet(folder, name string, opts FileGetOptions) ([]byte, error) {
-	path := filepath.Join(folder, name)
-	data, err := os.ReadFile(filepath.Join(fs.basepath, path))
+// FolderDelete removes folder with all its files. The base path itself
+// cannot be removed.
+func (fs *LocalFs) FolderDelete(ctx context.Context, folder string) error {
+	path, err := fs.path(folder)
+	if err != nil {
+		return err
+	}
+	if path == filepath.Clean(fs.basepath) {
+		return errors.Wrapf(ErrInvalidPath, "cannot remove base path %v", fs.basepath)
+	}
+	fs.logger.Debugf("remove folder %v", path)
+	if err := os.RemoveAll(path); err != nil {
+		return errors.Wrapf(err, "cannot remove folder %v", path)
+	}
+	return nil
+}
+
+func (fs *LocalFs) FileGet(ctx context.Context, folder, name string, opts FileGetOptions) ([]byte, error) {
+	path, err := fs.filePath(folder, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, errors.Wrapf(err, "cannot read file %v", path)
+		return nil, notFound(err, "cannot read file %v", path)
 	}
 	return data, nil
 }
 
-func (fs *LocalFs) FilePut(folder, name string, data []byte, opts FilePutOptions) error {
-	if err := fs.FolderCreate(folder, FolderCreateOptions{}); err != nil {
-		return errors.Wrapf(err, "cannot create folder %v", folder)
+func (fs *LocalFs) FilePut(ctx context.Context, folder, name string, data []byte, opts FilePutOptions) error {
+	path, err := fs.filePath(folder, name)
+	if err != nil {
+		return err
+	}
+	if err := fs.mkdir(path); err != nil {
+		return err
 	}
-	path := filepath.Join(fs.basepath, filepath.Join(folder, name))
 	fs.logger.Debugf("writing data to: %v", path)
 	if err := os.WriteFile(path, data, 0644); err != nil {
 		return errors.Wrapf(err, "cannot write data to %v", path)
@@ -93,16 +165,20 @@ func (fs *LocalFs) FilePut(folder, name string, data []byte, opts FilePutOptions
 	return nil
 }
 
-func (fs *LocalFs) FileWrite(folder, name string, r io.Reader, size int64, opts FilePutOptions) error {
-	if err := fs.FolderCreate(folder, FolderCreateOptions{}); err != nil {
-		return errors.Wrapf(err, "cannot create folder %v", folder)
+func (fs *LocalFs) FileWrite(ctx context.Context, folder, name string, r io.Reader, size int64, opts FilePutOptions) error {
+	path, err := fs.filePath(folder, name)
+	if err != nil {
+		return err
+	}
+	if err := fs.mkdir(path); err != nil {
+		return err
 	}
-	path := filepath.Join(folder, name)
-	file, err := os.OpenFile(filepath.Join(fs.basepath, path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return errors.Wrapf(err, "cannot open file %v", path)
 	}
 	defer file.Close()
+	r = &contextReader{ctx: ctx, r: r}
 	if size == -1 {
 		if _, err := io.Copy(file, r); err != nil {
 			return errors.Wrapf(err, "cannot write to file %v", path)
@@ -117,30 +193,159 @@ func (fs *LocalFs) FileWrite(folder, name string, r io.Reader, size int64, opts
 	return nil
 }
 
-func (fs *LocalFs) FileRead(folder, name string, w io.Writer, size int64, opts FileGetOptions) error {
-	path := filepath.Join(folder, name)
-	file, err := os.OpenFile(filepath.Join(fs.basepath, path), os.O_RDONLY, 0644)
+func (fs *LocalFs) FileRead(ctx context.Context, folder, name string, w io.Writer, size int64, opts FileGetOptions) error {
+	path, err := fs.filePath(folder, name)
 	if err != nil {
-		return errors.Wrapf(err, "cannot open file %v", path)
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return notFound(err, "cannot open file %v", path)
 	}
 	defer file.Close()
+	r := &contextReader{ctx: ctx, r: file}
 	if size == -1 {
-		if _, err := io.Copy(w, file); err != nil {
-			return errors.Wrapf(err, "cannot read from %v/%v", path, name)
+		if _, err := io.Copy(w, r); err != nil {
+			return errors.Wrapf(err, "cannot read from %v", path)
 		}
 	} else {
-		if _, err := io.CopyN(w, file, size); err != nil {
-			return errors.Wrapf(err, "cannot read from %v/%v", path, name)
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return errors.Wrapf(err, "cannot read from %v", path)
 		}
 	}
 	return nil
 }
 
-func (fs *LocalFs) FileOpenRead(folder, name string, opts FileGetOptions) (io.ReadCloser, error) {
-	path := filepath.Join(folder, name)
-	file, err := os.OpenFile(filepath.Join(fs.basepath, path), os.O_RDONLY, 0644)
+func (fs *LocalFs) FileOpenRead(ctx context.Context, folder, name string, opts FileGetOptions) (io.ReadCloser, error) {
+	path, err := fs.filePath(folder, name)
 	if err != nil {
-		return nil, errors.Wrapf(err, "cannot open file %v", path)
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, notFound(err, "cannot open file %v", path)
 	}
 	return file, nil
 }
+
+func (fs *LocalFs) FileDelete(ctx context.Context, folder, name string) error {
+	path, err := fs.filePath(folder, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "cannot remove file %v", path)
+	}
+	return nil
+}
+
+// FileList walks folder and its subfolders; names of files in subfolders
+// contain the subfolder.
+func (fs *LocalFs) FileList(ctx context.Context, folder, prefix string) iter.Seq2[FileEntry, error] {
+	return func(yield func(FileEntry, error) bool) {
+		root, err := fs.path(folder)
+		if err != nil {
+			yield(FileEntry{}, err)
+			return
+		}
+		if _, err := os.Stat(root); err != nil {
+			yield(FileEntry{}, notFound(err, "cannot read folder %v", root))
+			return
+		}
+		stop := errors.New("stop")
+		err = filepath.WalkDir(root, func(path string, d iofs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			name := filepath.ToSlash(rel)
+			if !strings.HasPrefix(name, prefix) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !yield(FileEntry{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil) {
+				return stop
+			}
+			return nil
+		})
+		if err != nil && err != stop {
+			yield(FileEntry{}, errors.Wrapf(err, "cannot list folder %v", root))
+		}
+	}
+}
+
+// FileCopy copies the content through a reader. A copy onto the source
+// leaves the file unchanged, FileWrite would truncate it.
+func (fs *LocalFs) FileCopy(ctx context.Context, srcFolder, srcName, dstFolder, dstName string) error {
+	if same, err := fs.samePath(srcFolder, srcName, dstFolder, dstName); err != nil || same {
+		return err
+	}
+	src, err := fs.FileOpenRead(ctx, srcFolder, srcName, FileGetOptions{})
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return fs.FileWrite(ctx, dstFolder, dstName, src, -1, FilePutOptions{})
+}
+
+func (fs *LocalFs) FileMove(ctx context.Context, srcFolder, srcName, dstFolder, dstName string) error {
+	src, err := fs.filePath(srcFolder, srcName)
+	if err != nil {
+		return err
+	}
+	dst, err := fs.filePath(dstFolder, dstName)
+	if err != nil {
+		return err
+	}
+	if err := fs.mkdir(dst); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return notFound(err, "cannot move %v to %v", src, dst)
+	}
+	return nil
+}
+
+// samePath reports whether source and destination are the same file. The
+// file must exist.
+func (fs *LocalFs) samePath(srcFolder, srcName, dstFolder, dstName string) (bool, error) {
+	src, err := fs.filePath(srcFolder, srcName)
+	if err != nil {
+		return false, err
+	}
+	dst, err := fs.filePath(dstFolder, dstName)
+	if err != nil {
+		return false, err
+	}
+	if src != dst {
+		return false, nil
+	}
+	if _, err := os.Stat(src); err != nil {
+		return false, notFound(err, "cannot stat file %v", src)
+	}
+	return true, nil
+}
+
+// mkdir creates the folder of the file path
+func (fs *LocalFs) mkdir(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "cannot create folder %v", dir)
+	}
+	return nil
+}
@@ -0,0 +1,380 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"iter"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+// ErrSimulated is the default error of the failures simulated by MemFs.
+var ErrSimulated = errors.New("simulated failure")
+
+// MemFsFaults are the failures simulated by MemFs. The zero value
+// simulates nothing.
+type MemFsFaults struct {
+	// Latency delays every call; a done context ends the delay
+	Latency time.Duration
+	// FailCall is the number of the call that fails, counting from 1 since
+	// the faults were set
+	FailCall int64
+	// Err is returned by the failing call, ErrSimulated if nil
+	Err error
+	// PartialWrite makes FilePut and FileWrite store only the first
+	// PartialWrite bytes and fail
+	PartialWrite int64
+}
+
+var _ FileSystem = (*MemFs)(nil)
+
+// MemFs keeps files in memory, for tests and dry runs. Folders are flat
+// like S3 buckets; writing a file creates its folder. MemFs is safe for
+// concurrent use.
+type MemFs struct {
+	mu      sync.Mutex
+	folders map[string]map[string]*memFile
+	faults  MemFsFaults
+	calls   int64
+}
+
+type memFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemFs() *MemFs {
+	return &MemFs{
+		folders: map[string]map[string]*memFile{},
+	}
+}
+
+func (fs *MemFs) Protocol() string {
+	return "mem://"
+}
+
+func (fs *MemFs) String() string {
+	return "mem://"
+}
+
+// SetFaults replaces the simulated failures and restarts counting calls.
+func (fs *MemFs) SetFaults(faults MemFsFaults) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.faults = faults
+	fs.calls = 0
+}
+
+// Calls returns the number of calls since the faults were set.
+func (fs *MemFs) Calls() int64 {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.calls
+}
+
+// SetModTime changes the modification time of a file.
+func (fs *MemFs) SetModTime(folder, name string, modTime time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	file, err := fs.file(folder, name)
+	if err != nil {
+		return err
+	}
+	file.modTime = modTime
+	return nil
+}
+
+// call counts a call and simulates latency and the failing call
+func (fs *MemFs) call(ctx context.Context) error {
+	fs.mu.Lock()
+	fs.calls++
+	faults, calls := fs.faults, fs.calls
+	fs.mu.Unlock()
+
+	if faults.Latency > 0 {
+		timer := time.NewTimer(faults.Latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if faults.FailCall > 0 && calls == faults.FailCall {
+		return faults.err()
+	}
+	return nil
+}
+
+func (faults MemFsFaults) err() error {
+	if faults.Err != nil {
+		return faults.Err
+	}
+	return ErrSimulated
+}
+
+// file returns a file, fs.mu must be held
+func (fs *MemFs) file(folder, name string) (*memFile, error) {
+	file, ok := fs.folders[folder][name]
+	if !ok {
+		return nil, &NotFoundError{err: errors.Errorf("%s/%s", folder, name)}
+	}
+	return file, nil
+}
+
+// store writes a file and creates its folder, fs.mu must be held
+func (fs *MemFs) store(folder, name string, data []byte) {
+	if fs.folders[folder] == nil {
+		fs.folders[folder] = map[string]*memFile{}
+	}
+	fs.folders[folder][name] = &memFile{data: data, modTime: time.Now()}
+}
+
+// write stores data honoring PartialWrite
+func (fs *MemFs) write(folder, name string, data []byte) error {
+	if folder == "" || name == "" {
+		return errors.Wrapf(ErrInvalidPath, "no folder or name in %s/%s", folder, name)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	partial := fs.faults.PartialWrite
+	if partial > 0 && partial < int64(len(data)) {
+		fs.store(folder, name, bytes.Clone(data[:partial]))
+		return errors.Wrapf(fs.faults.err(), "partial write of %s/%s", folder, name)
+	}
+	fs.store(folder, name, bytes.Clone(data))
+	return nil
+}
+
+// read returns a copy of the content of a file
+func (fs *MemFs) read(folder, name string) ([]byte, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	file, err := fs.file(folder, name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(file.data), nil
+}
+
+func (fs *MemFs) FolderExists(ctx context.Context, folder string) (bool, error) {
+	if err := fs.call(ctx); err != nil {
+		return false, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	_, ok := fs.folders[folder]
+	return ok, nil
+}
+
+func (fs *MemFs) FolderCreate(ctx context.Context, folder string, opts FolderCreateOptions) error {
+	if err := fs.call(ctx); err != nil {
+		return err
+	}
+	if folder == "" {
+		return errors.Wrap(ErrInvalidPath, "no folder name")
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.folders[folder] == nil {
+		fs.folders[folder] = map[string]*memFile{}
+	}
+	return nil
+}
+
+func (fs *MemFs) FolderDelete(ctx context.Context, folder string) error {
+	if err := fs.call(ctx); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.folders, folder)
+	return nil
+}
+
+func (fs *MemFs) FileExists(ctx context.Context, folder, name string) (bool, error) {
+	if err := fs.call(ctx); err != nil {
+		return false, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	_, ok := fs.folders[folder][name]
+	return ok, nil
+}
+
+func (fs *MemFs) FileGet(ctx context.Context, folder, name string, opts FileGetOptions) ([]byte, error) {
+	if err := fs.call(ctx); err != nil {
+		return nil, err
+	}
+	return fs.read(folder, name)
+}
+
+func (fs *MemFs) FilePut(ctx context.Context, folder, name string, data []byte, opts FilePutOptions) error {
+	if err := fs.call(ctx); err != nil {
+		return err
+	}
+	return fs.write(folder, name, data)
+}
+
+func (fs *MemFs) FileWrite(ctx context.Context, folder, name string, r io.Reader, size int64, opts FilePutOptions) error {
+	if err := fs.call(ctx); err != nil {
+		return err
+	}
+	r = &contextReader{ctx: ctx, r: r}
+	if size != -1 {
+		r = io.LimitReader(r, size)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return errors.Wrapf(err, "cannot read data for %s/%s", folder, name)
+	}
+	return fs.write(folder, name, data)
+}
+
+func (fs *MemFs) FileRead(ctx context.Context, folder, name string, w io.Writer, size int64, opts FileGetOptions) error {
+	if err := fs.call(ctx); err != nil {
+		return err
+	}
+	data, err := fs.read(folder, name)
+	if err != nil {
+		return err
+	}
+	if size != -1 && size < int64(len(data)) {
+		data = data[:size]
+	}
+	if _, err := w.Write(data); err != nil {
+		return errors.Wrapf(err, "cannot read from %s/%s", folder, name)
+	}
+	return nil
+}
+
+func (fs *MemFs) FileOpenRead(ctx context.Context, folder, name string, opts FileGetOptions) (io.ReadCloser, error) {
+	if err := fs.call(ctx); err != nil {
+		return nil, err
+	}
+	data, err := fs.read(folder, name)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (fs *MemFs) FileStat(ctx context.Context, folder, name string, opts FileStatOptions) (os.FileInfo, error) {
+	if err := fs.call(ctx); err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	file, err := fs.file(folder, name)
+	if err != nil {
+		return nil, err
+	}
+	return &memFileInfo{name: path.Base(name), size: int64(len(file.data)), modTime: file.modTime}, nil
+}
+
+func (fs *MemFs) FileDelete(ctx context.Context, folder, name string) error {
+	if err := fs.call(ctx); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.folders[folder], name)
+	return nil
+}
+
+// FileList lists the files as they were when the listing started.
+func (fs *MemFs) FileList(ctx context.Context, folder, prefix string) iter.Seq2[FileEntry, error] {
+	return func(yield func(FileEntry, error) bool) {
+		if err := fs.call(ctx); err != nil {
+			yield(FileEntry{}, err)
+			return
+		}
+		fs.mu.Lock()
+		files, ok := fs.folders[folder]
+		if !ok {
+			fs.mu.Unlock()
+			yield(FileEntry{}, &NotFoundError{err: errors.Errorf("folder %s", folder)})
+			return
+		}
+		var entries []FileEntry
+		for name, file := range files {
+			if strings.HasPrefix(name, prefix) {
+				entries = append(entries, FileEntry{Name: name, Size: int64(len(file.data)), ModTime: file.modTime})
+			}
+		}
+		fs.mu.Unlock()
+		slices.SortFunc(entries, func(a, b FileEntry) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				yield(FileEntry{}, err)
+				return
+			}
+			if !yield(entry, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (fs *MemFs) FileCopy(ctx context.Context, srcFolder, srcName, dstFolder, dstName string) error {
+	if err := fs.call(ctx); err != nil {
+		return err
+	}
+	if dstFolder == "" || dstName == "" {
+		return errors.Wrapf(ErrInvalidPath, "no folder or name in %s/%s", dstFolder, dstName)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	file, err := fs.file(srcFolder, srcName)
+	if err != nil {
+		return err
+	}
+	fs.store(dstFolder, dstName, bytes.Clone(file.data))
+	return nil
+}
+
+func (fs *MemFs) FileMove(ctx context.Context, srcFolder, srcName, dstFolder, dstName string) error {
+	if err := fs.call(ctx); err != nil {
+		return err
+	}
+	if dstFolder == "" || dstName == "" {
+		return errors.Wrapf(ErrInvalidPath, "no folder or name in %s/%s", dstFolder, dstName)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	file, err := fs.file(srcFolder, srcName)
+	if err != nil {
+		return err
+	}
+	delete(fs.folders[srcFolder], srcName)
+	if fs.folders[dstFolder] == nil {
+		fs.folders[dstFolder] = map[string]*memFile{}
+	}
+	fs.folders[dstFolder][dstName] = file
+	return nil
+}
+
+// memFileInfo is the os.FileInfo of a MemFs file
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (mfi *memFileInfo) Name() string       { return mfi.name }
+func (mfi *memFileInfo) Size() int64        { return mfi.size }
+func (mfi *memFileInfo) Mode() os.FileMode  { return 0644 }
+func (mfi *memFileInfo) ModTime() time.Time { return mfi.modTime }
+func (mfi *memFileInfo) IsDir() bool        { return false }
+func (mfi *memFileInfo) Sys() any           { return nil }
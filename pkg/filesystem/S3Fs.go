@@ -8,10 +8,14 @@ import (
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"io"
+	"iter"
 	"net/http"
 	"os"
+	"strings"
 )
 
+var _ FileSystem = (*S3Fs)(nil)
+
 type S3Fs struct {
 	s3       *minio.Client
 	endpoint string
@@ -40,8 +44,8 @@ func (fs *S3Fs) String() string {
 	return fs.s3.EndpointURL().String()
 }
 
-func (fs *S3Fs) FileStat(folder, name string, opts FileStatOptions) (os.FileInfo, error) {
-	sinfo, err := fs.s3.StatObject(context.Background(), folder, name, minio.StatObjectOptions{})
+func (fs *S3Fs) FileStat(ctx context.Context, folder, name string, opts FileStatOptions) (os.FileInfo, error) {
+	sinfo, err := fs.s3.StatObject(ctx, folder, name, minio.StatObjectOptions{})
 	if err != nil {
 		// no file no error
 		s3Err, ok := err.(minio.ErrorResponse)
@@ -55,8 +59,8 @@ func (fs *S3Fs) FileStat(folder, name string, opts FileStatOptions) (os.FileInfo
 	return NewS3FileInfo(folder, name, sinfo), nil
 }
 
-func (fs *S3Fs) FileExists(folder, name string) (bool, error) {
-	_, err := fs.FileStat(folder, name, FileStatOptions{})
+func (fs *S3Fs) FileExists(ctx context.Context, folder, name string) (bool, error) {
+	_, err := fs.FileStat(ctx, folder, name, FileStatOptions{})
 	if err != nil {
 		// no file no error
 		if IsNotFoundError(err) {
@@ -67,23 +71,23 @@ func (fs *S3Fs) FileExists(folder, name string) (bool, error) {
 	return true, nil
 }
 
-func (fs *S3Fs) FolderExists(folder string) (bool, error) {
-	found, err := fs.s3.BucketExists(context.Background(), folder)
+func (fs *S3Fs) FolderExists(ctx context.Context, folder string) (bool, error) {
+	found, err := fs.s3.BucketExists(ctx, folder)
 	if err != nil {
 		return false, errors.Wrapf(err, "cannot get check for folder %v", folder)
 	}
 	return found, nil
 }
 
-func (fs *S3Fs) FolderCreate(folder string, opts FolderCreateOptions) error {
-	if err := fs.s3.MakeBucket(context.Background(), folder, minio.MakeBucketOptions{ObjectLocking: opts.ObjectLocking}); err != nil {
+func (fs *S3Fs) FolderCreate(ctx context.Context, folder string, opts FolderCreateOptions) error {
+	if err := fs.s3.MakeBucket(ctx, folder, minio.MakeBucketOptions{ObjectLocking: opts.ObjectLocking}); err != nil {
 		return errors.Wrapf(err, "cannot create bucket %s", folder)
 	}
 	return nil
 }
 
-func (fs *S3Fs) FileGet(folder, name string, opts FileGetOptions) ([]byte, error) {
-	object, err := fs.s3.GetObject(context.Background(), folder, name, minio.GetObjectOptions{VersionID: opts.VersionID})
+func (fs *S3Fs) FileGet(ctx context.Context, folder, name string, opts FileGetOptions) ([]byte, error) {
+	object, err := fs.s3.GetObject(ctx, folder, name, minio.GetObjectOptions{VersionID: opts.VersionID})
 	if err != nil {
 		// no file no error
 		s3Err, ok := err.(minio.ErrorResponse)
@@ -95,16 +99,21 @@ func (fs *S3Fs) FileGet(folder, name string, opts FileGetOptions) ([]byte, error
 		return nil, errors.Wrapf(err, "cannot get file info for %v/%v", folder, name)
 	}
 
+	defer object.Close()
 	var b = &bytes.Buffer{}
 	if _, err := io.Copy(b, object); err != nil {
+		// GetObject is lazy, missing objects show up on read
+		if isS3NotFound(err) {
+			return nil, &NotFoundError{err: err}
+		}
 		return nil, errors.Wrapf(err, "cannot copy data from %v/%v", folder, name)
 	}
 	return b.Bytes(), nil
 }
 
-func (fs *S3Fs) FilePut(folder, name string, data []byte, opts FilePutOptions) error {
+func (fs *S3Fs) FilePut(ctx context.Context, folder, name string, data []byte, opts FilePutOptions) error {
 	if _, err := fs.s3.PutObject(
-		context.Background(),
+		ctx,
 		folder,
 		name,
 		bytes.NewReader(data),
@@ -116,9 +125,9 @@ func (fs *S3Fs) FilePut(folder, name string, data []byte, opts FilePutOptions) e
 	return nil
 }
 
-func (fs *S3Fs) FileWrite(folder, name string, r io.Reader, size int64, opts FilePutOptions) error {
+func (fs *S3Fs) FileWrite(ctx context.Context, folder, name string, r io.Reader, size int64, opts FilePutOptions) error {
 	if _, err := fs.s3.PutObject(
-		context.Background(),
+		ctx,
 		folder,
 		name,
 		r,
@@ -130,9 +139,9 @@ func (fs *S3Fs) FileWrite(folder, name string, r io.Reader, size int64, opts Fil
 	return nil
 }
 
-func (fs *S3Fs) FileRead(folder, name string, w io.Writer, size int64, opts FileGetOptions) error {
+func (fs *S3Fs) FileRead(ctx context.Context, folder, name string, w io.Writer, size int64, opts FileGetOptions) error {
 	object, err := fs.s3.GetObject(
-		context.Background(),
+		ctx,
 		folder,
 		name,
 		minio.GetObjectOptions{},
@@ -141,6 +150,12 @@ func (fs *S3Fs) FileRead(folder, name string, w io.Writer, size int64, opts File
 		return errors.Wrapf(err, "cannot get object %v/%v", folder, name)
 	}
 	defer object.Close()
+	if _, err := object.Stat(); err != nil {
+		if isS3NotFound(err) {
+			return &NotFoundError{err: err}
+		}
+		return errors.Wrapf(err, "cannot get object %v/%v", folder, name)
+	}
 	if size == -1 {
 		if _, err := io.Copy(w, object); err != nil {
 			return errors.Wrapf(err, "cannot read from obect %v/%v", folder, name)
@@ -155,9 +170,9 @@ func (fs *S3Fs) FileRead(folder, name string, w io.Writer, size int64, opts File
 	return nil
 }
 
-func (fs *S3Fs) FileOpenRead(folder, name string, opts FileGetOptions) (io.ReadCloser, error) {
+func (fs *S3Fs) FileOpenRead(ctx context.Context, folder, name string, opts FileGetOptions) (io.ReadCloser, error) {
 	object, err := fs.s3.GetObject(
-		context.Background(),
+		ctx,
 		folder,
 		name,
 		minio.GetObjectOptions{},
@@ -165,5 +180,144 @@ func (fs *S3Fs) FileOpenRead(folder, name string, opts FileGetOptions) (io.ReadC
 	if err != nil {
 		return nil, errors.Wrapf(err, "cannot get object %v/%v", folder, name)
 	}
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if isS3NotFound(err) {
+			return nil, &NotFoundError{err: err}
+		}
+		return nil, errors.Wrapf(err, "cannot get object %v/%v", folder, name)
+	}
 	return object, nil
 }
+
+// FileList lists the objects of bucket folder. A missing bucket yields a
+// NotFoundError.
+func (fs *S3Fs) FileList(ctx context.Context, folder, prefix string) iter.Seq2[FileEntry, error] {
+	return func(yield func(FileEntry, error) bool) {
+		// stops the listing if the loop ends early
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		for object := range fs.s3.ListObjects(ctx, folder, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if object.Err != nil {
+				if isS3NotFound(object.Err) {
+					yield(FileEntry{}, &NotFoundError{err: object.Err})
+				} else {
+					yield(FileEntry{}, errors.Wrapf(object.Err, "cannot list objects of %v", folder))
+				}
+				return
+			}
+			if strings.HasSuffix(object.Key, "/") {
+				continue
+			}
+			if !yield(FileEntry{Name: object.Key, Size: object.Size, ModTime: object.LastModified}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// FileDelete removes an object. S3 does not report missing objects.
+func (fs *S3Fs) FileDelete(ctx context.Context, folder, name string) error {
+	if err := fs.s3.RemoveObject(ctx, folder, name, minio.RemoveObjectOptions{}); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchBucket" {
+			return nil
+		}
+		return errors.Wrapf(err, "cannot remove %v/%v", folder, name)
+	}
+	return nil
+}
+
+// FolderDelete removes all objects of bucket folder and the bucket.
+func (fs *S3Fs) FolderDelete(ctx context.Context, folder string) error {
+	found, err := fs.FolderExists(ctx, folder)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var listErr error
+	objects := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objects)
+		for object := range fs.s3.ListObjects(ctx, folder, minio.ListObjectsOptions{Recursive: true}) {
+			if object.Err != nil {
+				listErr = object.Err
+				return
+			}
+			select {
+			case objects <- object:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for rErr := range fs.s3.RemoveObjects(ctx, folder, objects, minio.RemoveObjectsOptions{}) {
+		cancel()
+		// drain the listing
+		for range objects {
+		}
+		return errors.Wrapf(rErr.Err, "cannot remove %v/%v", folder, rErr.ObjectName)
+	}
+	if listErr != nil {
+		return errors.Wrapf(listErr, "cannot list objects of %v", folder)
+	}
+	if err := fs.s3.RemoveBucket(ctx, folder); err != nil {
+		return errors.Wrapf(err, "cannot remove bucket %v", folder)
+	}
+	return nil
+}
+
+// maxCopyObjectSize is the largest object S3 copies with a single
+// CopyObject request.
+const maxCopyObjectSize = 5 << 30
+
+// FileCopy copies an object on the server. S3 refuses to copy an object
+// onto itself without changes, so such a copy only checks the source.
+// Objects larger than 5 GiB are copied in parts with ComposeObject.
+func (fs *S3Fs) FileCopy(ctx context.Context, srcFolder, srcName, dstFolder, dstName string) error {
+	info, err := fs.FileStat(ctx, srcFolder, srcName, FileStatOptions{})
+	if err != nil {
+		return err
+	}
+	if srcFolder == dstFolder && srcName == dstName {
+		return nil
+	}
+	dst := minio.CopyDestOptions{Bucket: dstFolder, Object: dstName}
+	src := minio.CopySrcOptions{Bucket: srcFolder, Object: srcName}
+	if info.Size() > maxCopyObjectSize {
+		_, err = fs.s3.ComposeObject(ctx, dst, src)
+	} else {
+		_, err = fs.s3.CopyObject(ctx, dst, src)
+	}
+	if err != nil {
+		if isS3NotFound(err) {
+			return &NotFoundError{err: err}
+		}
+		return errors.Wrapf(err, "cannot copy %v/%v to %v/%v", srcFolder, srcName, dstFolder, dstName)
+	}
+	return nil
+}
+
+// FileMove copies an object on the server and removes the source. S3 has
+// no rename.
+func (fs *S3Fs) FileMove(ctx context.Context, srcFolder, srcName, dstFolder, dstName string) error {
+	if err := fs.FileCopy(ctx, srcFolder, srcName, dstFolder, dstName); err != nil {
+		return err
+	}
+	if srcFolder == dstFolder && srcName == dstName {
+		return nil
+	}
+	if err := fs.s3.RemoveObject(ctx, srcFolder, srcName, minio.RemoveObjectOptions{}); err != nil {
+		return errors.Wrapf(err, "cannot remove %v/%v", srcFolder, srcName)
+	}
+	return nil
+}
+
+// isS3NotFound reports whether err is a missing bucket or object
+func isS3NotFound(err error) bool {
+	resp := minio.ToErrorResponse(err)
+	return resp.StatusCode == http.StatusNotFound || resp.Code == "NoSuchBucket" || resp.Code == "NoSuchKey"
+}
@@ -1,11 +1,20 @@
 package filesystem
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"iter"
 	"os"
+	"time"
+
+	"emperror.dev/errors"
 )
 
+// ErrInvalidPath is returned for folders and names that leave the base path
+// of a file system.
+var ErrInvalidPath = errors.New("invalid path")
+
 type NotFoundError struct {
 	err error
 }
@@ -14,9 +23,15 @@ func (nf *NotFoundError) Error() string {
 	return fmt.Sprintf("file not found: %v", nf.err)
 }
 
+func (nf *NotFoundError) Unwrap() error {
+	return nf.err
+}
+
+// IsNotFoundError reports whether err or an error it wraps is a
+// NotFoundError.
 func IsNotFoundError(err error) bool {
-	_, ok := err.(*NotFoundError)
-	return ok
+	var nf *NotFoundError
+	return errors.As(err, &nf)
 }
 
 // PutObjectOptions represents options specified by user for PutObject call
@@ -37,16 +52,53 @@ type FolderCreateOptions struct {
 	ObjectLocking bool
 }
 
+// FileEntry is a file returned by FileList. Name is relative to the folder
+// and uses slashes as separator.
+type FileEntry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// FileSystem stores files in folders, which are buckets on S3. Missing
+// files are reported as NotFoundError by FileGet, FileRead, FileOpenRead,
+// FileStat, FileCopy and FileMove; deleting a missing file or folder is no
+// error.
 type FileSystem interface {
-	FolderExists(folder string) (bool, error)
-	FolderCreate(folder string, opts FolderCreateOptions) error
-	FileExists(folder, name string) (bool, error)
-	FileGet(folder, name string, opts FileGetOptions) ([]byte, error)
-	FilePut(folder, name string, data []byte, opts FilePutOptions) error
-	FileWrite(folder, name string, r io.Reader, size int64, opts FilePutOptions) error
-	FileRead(folder, name string, w io.Writer, size int64, opts FileGetOptions) error
-	FileOpenRead(folder, name string, opts FileGetOptions) (io.ReadCloser, error)
-	FileStat(folder, name string, opts FileStatOptions) (os.FileInfo, error)
+	FolderExists(ctx context.Context, folder string) (bool, error)
+	FolderCreate(ctx context.Context, folder string, opts FolderCreateOptions) error
+	// FolderDelete removes folder with all its files
+	FolderDelete(ctx context.Context, folder string) error
+	FileExists(ctx context.Context, folder, name string) (bool, error)
+	FileGet(ctx context.Context, folder, name string, opts FileGetOptions) ([]byte, error)
+	FilePut(ctx context.Context, folder, name string, data []byte, opts FilePutOptions) error
+	FileWrite(ctx context.Context, folder, name string, r io.Reader, size int64, opts FilePutOptions) error
+	FileRead(ctx context.Context, folder, name string, w io.Writer, size int64, opts FileGetOptions) error
+	FileOpenRead(ctx context.Context, folder, name string, opts FileGetOptions) (io.ReadCloser, error)
+	FileStat(ctx context.Context, folder, name string, opts FileStatOptions) (os.FileInfo, error)
+	FileDelete(ctx context.Context, folder, name string) error
+	// FileList iterates over the files of folder and its subfolders whose
+	// name starts with prefix. A missing folder yields a NotFoundError.
+	FileList(ctx context.Context, folder, prefix string) iter.Seq2[FileEntry, error]
+	// FileCopy copies a file; an existing destination is replaced. A copy
+	// onto the source leaves the file unchanged.
+	FileCopy(ctx context.Context, srcFolder, srcName, dstFolder, dstName string) error
+	// FileMove renames a file; an existing destination is replaced. A move
+	// onto the source leaves the file unchanged.
+	FileMove(ctx context.Context, srcFolder, srcName, dstFolder, dstName string) error
 	String() string
 	Protocol() string
 }
+
+// contextReader stops reading when its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -0,0 +1,404 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/op/go-logging"
+)
+
+var testCtx = context.Background()
+
+func newTestLocalFs(t *testing.T) *LocalFs {
+	t.Helper()
+	fs, err := NewLocalFs(t.TempDir(), logging.MustGetLogger("test"))
+	if err != nil {
+		t.Fatalf("NewLocalFs: %v", err)
+	}
+	return fs
+}
+
+func listNames(t *testing.T, fs FileSystem, folder, prefix string) []string {
+	t.Helper()
+	names := []string{}
+	for entry, err := range fs.FileList(testCtx, folder, prefix) {
+		if err != nil {
+			t.Fatalf("FileList(%q, %q): %v", folder, prefix, err)
+		}
+		names = append(names, entry.Name)
+	}
+	return names
+}
+
+// testConformance checks the behavior all FileSystem implementations share.
+// folder must not exist.
+func testConformance(t *testing.T, fs FileSystem, folder string) {
+	if err := fs.FolderCreate(testCtx, folder, FolderCreateOptions{}); err != nil {
+		t.Fatalf("FolderCreate: %v", err)
+	}
+	defer fs.FolderDelete(testCtx, folder)
+	for _, name := range []string{"ATTACH01", "ATTACH02"} {
+		if err := fs.FilePut(testCtx, folder, name, []byte("content of "+name), FilePutOptions{}); err != nil {
+			t.Fatalf("FilePut: %v", err)
+		}
+	}
+	content := func(name string) string {
+		t.Helper()
+		data, err := fs.FileGet(testCtx, folder, name, FileGetOptions{})
+		if err != nil {
+			t.Fatalf("FileGet(%s): %v", name, err)
+		}
+		return string(data)
+	}
+
+	// copy and move onto the source keep the file
+	if err := fs.FileCopy(testCtx, folder, "ATTACH01", folder, "ATTACH01"); err != nil {
+		t.Errorf("FileCopy onto itself: %v", err)
+	}
+	if got := content("ATTACH01"); got != "content of ATTACH01" {
+		t.Errorf("FileCopy onto itself left %q", got)
+	}
+	if err := fs.FileMove(testCtx, folder, "ATTACH01", folder, "ATTACH01"); err != nil {
+		t.Errorf("FileMove onto itself: %v", err)
+	}
+	if got := content("ATTACH01"); got != "content of ATTACH01" {
+		t.Errorf("FileMove onto itself left %q", got)
+	}
+	for _, err := range []error{
+		fs.FileCopy(testCtx, folder, "MISSING1", folder, "MISSING1"),
+		fs.FileMove(testCtx, folder, "MISSING1", folder, "MISSING1"),
+		fs.FileCopy(testCtx, folder, "MISSING1", folder, "COPY0001"),
+	} {
+		if !IsNotFoundError(err) {
+			t.Errorf("copy or move of missing file = %v, want NotFoundError", err)
+		}
+	}
+
+	// copy and move replace the destination
+	if err := fs.FileCopy(testCtx, folder, "ATTACH01", folder, "COPY0001"); err != nil {
+		t.Fatalf("FileCopy: %v", err)
+	}
+	if err := fs.FileMove(testCtx, folder, "ATTACH02", folder, "ATTACH01"); err != nil {
+		t.Fatalf("FileMove: %v", err)
+	}
+	if got := content("COPY0001"); got != "content of ATTACH01" {
+		t.Errorf("copy contains %q", got)
+	}
+	if got := content("ATTACH01"); got != "content of ATTACH02" {
+		t.Errorf("moved file contains %q", got)
+	}
+	if _, err := fs.FileStat(testCtx, folder, "ATTACH02", FileStatOptions{}); !IsNotFoundError(err) {
+		t.Errorf("FileStat of moved file = %v, want NotFoundError", err)
+	}
+
+	// deleting a missing file is no error
+	if err := fs.FileDelete(testCtx, folder, "MISSING1"); err != nil {
+		t.Errorf("FileDelete of missing file: %v", err)
+	}
+	if names := listNames(t, fs, folder, ""); !slices.Equal(names, []string{"ATTACH01", "COPY0001"}) {
+		t.Errorf("unexpected files %v", names)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	t.Run("LocalFs", func(t *testing.T) {
+		testConformance(t, newTestLocalFs(t), "bucket")
+	})
+	t.Run("GitFs", func(t *testing.T) {
+		basepath := t.TempDir()
+		if _, err := git.PlainInit(basepath, false); err != nil {
+			t.Fatalf("PlainInit: %v", err)
+		}
+		fs, err := NewGitFs(basepath, logging.MustGetLogger("test"))
+		if err != nil {
+			t.Fatalf("NewGitFs: %v", err)
+		}
+		testConformance(t, fs, "bucket")
+	})
+	t.Run("MemFs", func(t *testing.T) {
+		testConformance(t, NewMemFs(), "bucket")
+	})
+	t.Run("S3Fs", func(t *testing.T) {
+		endpoint := os.Getenv("S3_TEST_ENDPOINT")
+		if endpoint == "" {
+			t.Skip("S3_TEST_ENDPOINT not set")
+		}
+		fs, err := NewS3Fs(endpoint, os.Getenv("S3_TEST_ACCESS_KEY"), os.Getenv("S3_TEST_SECRET_KEY"), os.Getenv("S3_TEST_SSL") == "true")
+		if err != nil {
+			t.Fatalf("NewS3Fs: %v", err)
+		}
+		testConformance(t, fs, fmt.Sprintf("zsync-test-%d", time.Now().UnixNano()))
+	})
+}
+
+func TestLocalFsPathEscape(t *testing.T) {
+	fs := newTestLocalFs(t)
+	for _, path := range [][2]string{
+		{"..", "secret"},
+		{"bucket", "../../secret"},
+		{"/etc", "passwd"},
+		{"bucket", ""},
+	} {
+		if err := fs.FilePut(testCtx, path[0], path[1], []byte("x"), FilePutOptions{}); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("FilePut(%q, %q) = %v, want ErrInvalidPath", path[0], path[1], err)
+		}
+	}
+	if err := fs.FolderDelete(testCtx, "bucket/.."); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("FolderDelete of base path = %v, want ErrInvalidPath", err)
+	}
+	if err := fs.FilePut(testCtx, "bucket", "sub/../file", []byte("x"), FilePutOptions{}); err != nil {
+		t.Errorf("FilePut with local dot-dot: %v", err)
+	}
+}
+
+func TestLocalFsFiles(t *testing.T) {
+	fs := newTestLocalFs(t)
+	for _, name := range []string{"ATTACH01", "ATTACH02", "BOOK0001", "sub/ATTACH03"} {
+		if err := fs.FilePut(testCtx, "bucket", name, []byte(name), FilePutOptions{}); err != nil {
+			t.Fatalf("FilePut: %v", err)
+		}
+	}
+
+	if names := listNames(t, fs, "bucket", ""); len(names) != 4 {
+		t.Errorf("unexpected files %v", names)
+	}
+	if names := listNames(t, fs, "bucket", "ATTACH"); !slices.Equal(names, []string{"ATTACH01", "ATTACH02"}) {
+		t.Errorf("unexpected files with prefix %v", names)
+	}
+	if names := listNames(t, fs, "bucket", "sub/"); !slices.Equal(names, []string{"sub/ATTACH03"}) {
+		t.Errorf("unexpected files in subfolder %v", names)
+	}
+	for _, err := range fs.FileList(testCtx, "missing", "") {
+		if !IsNotFoundError(err) {
+			t.Errorf("FileList of missing folder = %v, want NotFoundError", err)
+		}
+	}
+
+	if err := fs.FileCopy(testCtx, "bucket", "ATTACH01", "copy", "ATTACH01"); err != nil {
+		t.Fatalf("FileCopy: %v", err)
+	}
+	if err := fs.FileMove(testCtx, "bucket", "ATTACH02", "bucket", "ATTACH01"); err != nil {
+		t.Fatalf("FileMove: %v", err)
+	}
+	if data, err := fs.FileGet(testCtx, "copy", "ATTACH01", FileGetOptions{}); err != nil || string(data) != "ATTACH01" {
+		t.Errorf("copy contains %q (%v)", data, err)
+	}
+	if data, err := fs.FileGet(testCtx, "bucket", "ATTACH01", FileGetOptions{}); err != nil || string(data) != "ATTACH02" {
+		t.Errorf("moved file contains %q (%v)", data, err)
+	}
+	if _, err := fs.FileStat(testCtx, "bucket", "ATTACH02", FileStatOptions{}); !IsNotFoundError(err) {
+		t.Errorf("FileStat of moved file = %v, want NotFoundError", err)
+	}
+	if err := fs.FileCopy(testCtx, "bucket", "ATTACH02", "copy", "ATTACH02"); !IsNotFoundError(err) {
+		t.Errorf("FileCopy of missing file = %v, want NotFoundError", err)
+	}
+
+	if err := fs.FileDelete(testCtx, "bucket", "BOOK0001"); err != nil {
+		t.Errorf("FileDelete: %v", err)
+	}
+	if err := fs.FileDelete(testCtx, "bucket", "BOOK0001"); err != nil {
+		t.Errorf("FileDelete of missing file: %v", err)
+	}
+	if names := listNames(t, fs, "bucket", ""); !slices.Equal(names, []string{"ATTACH01", "sub/ATTACH03"}) {
+		t.Errorf("unexpected files after delete %v", names)
+	}
+
+	if err := fs.FolderDelete(testCtx, "bucket"); err != nil {
+		t.Fatalf("FolderDelete: %v", err)
+	}
+	if found, _ := fs.FolderExists(testCtx, "bucket"); found {
+		t.Errorf("folder exists after FolderDelete")
+	}
+	if _, err := os.Stat(filepath.Join(fs.basepath, "copy", "ATTACH01")); err != nil {
+		t.Errorf("FolderDelete removed another folder: %v", err)
+	}
+	if err := fs.FolderDelete(testCtx, "bucket"); err != nil {
+		t.Errorf("FolderDelete of missing folder: %v", err)
+	}
+}
+
+func TestLocalFsContext(t *testing.T) {
+	fs := newTestLocalFs(t)
+	if err := fs.FilePut(testCtx, "bucket", "file", []byte("data"), FilePutOptions{}); err != nil {
+		t.Fatalf("FilePut: %v", err)
+	}
+	ctx, cancel := context.WithCancel(testCtx)
+	cancel()
+	if err := fs.FileCopy(ctx, "bucket", "file", "bucket", "copy"); !errors.Is(err, context.Canceled) {
+		t.Errorf("FileCopy with canceled context = %v", err)
+	}
+	for _, err := range fs.FileList(ctx, "bucket", "") {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("FileList with canceled context = %v", err)
+		}
+	}
+}
+
+func TestGitFsFiles(t *testing.T) {
+	basepath := t.TempDir()
+	repo, err := git.PlainInit(basepath, false)
+	if err != nil {
+		t.Fatalf("PlainInit: %v", err)
+	}
+	fs, err := NewGitFs(basepath, logging.MustGetLogger("test"))
+	if err != nil {
+		t.Fatalf("NewGitFs: %v", err)
+	}
+	for _, name := range []string{"ATTACH01", "ATTACH02"} {
+		if err := fs.FilePut(testCtx, "bucket", name, []byte(name), FilePutOptions{}); err != nil {
+			t.Fatalf("FilePut: %v", err)
+		}
+	}
+	if err := fs.FileMove(testCtx, "bucket", "ATTACH01", "bucket", "MOVED001"); err != nil {
+		t.Fatalf("FileMove: %v", err)
+	}
+	if err := fs.FileDelete(testCtx, "bucket", "ATTACH02"); err != nil {
+		t.Fatalf("FileDelete: %v", err)
+	}
+	if names := listNames(t, fs, "", ""); !slices.Equal(names, []string{"bucket/MOVED001"}) {
+		t.Errorf("unexpected files %v", names)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Worktree: %v", err)
+	}
+	status, err := w.Status()
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if len(status) != 1 || status.File("bucket/MOVED001").Staging != git.Added {
+		t.Errorf("unexpected status %v", status)
+	}
+
+	if err := fs.FolderDelete(testCtx, "bucket"); err != nil {
+		t.Fatalf("FolderDelete: %v", err)
+	}
+	if status, _ := w.Status(); !status.IsClean() {
+		t.Errorf("index not clean after FolderDelete: %v", status)
+	}
+}
+
+func TestMemFsFiles(t *testing.T) {
+	fs := NewMemFs()
+	for _, name := range []string{"ATTACH01", "ATTACH02", "BOOK0001"} {
+		if err := fs.FilePut(testCtx, "bucket", name, []byte(name), FilePutOptions{}); err != nil {
+			t.Fatalf("FilePut: %v", err)
+		}
+	}
+	if found, _ := fs.FolderExists(testCtx, "bucket"); !found {
+		t.Errorf("FilePut did not create the folder")
+	}
+	if names := listNames(t, fs, "bucket", "ATTACH"); !slices.Equal(names, []string{"ATTACH01", "ATTACH02"}) {
+		t.Errorf("unexpected files with prefix %v", names)
+	}
+	for _, err := range fs.FileList(testCtx, "missing", "") {
+		if !IsNotFoundError(err) {
+			t.Errorf("FileList of missing folder = %v, want NotFoundError", err)
+		}
+	}
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := fs.SetModTime("bucket", "ATTACH01", modTime); err != nil {
+		t.Fatalf("SetModTime: %v", err)
+	}
+	info, err := fs.FileStat(testCtx, "bucket", "ATTACH01", FileStatOptions{})
+	if err != nil {
+		t.Fatalf("FileStat: %v", err)
+	}
+	if info.Name() != "ATTACH01" || info.Size() != 8 || !info.ModTime().Equal(modTime) || info.IsDir() {
+		t.Errorf("unexpected file info %v %v %v", info.Name(), info.Size(), info.ModTime())
+	}
+
+	if err := fs.FileMove(testCtx, "bucket", "ATTACH01", "other", "MOVED001"); err != nil {
+		t.Fatalf("FileMove: %v", err)
+	}
+	if err := fs.FileCopy(testCtx, "bucket", "ATTACH02", "other", "COPY0001"); err != nil {
+		t.Fatalf("FileCopy: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := fs.FileRead(testCtx, "other", "MOVED001", &buf, 6, FileGetOptions{}); err != nil || buf.String() != "ATTACH" {
+		t.Errorf("FileRead = %q (%v)", buf.String(), err)
+	}
+	for _, name := range []string{"ATTACH01", "MISSING1"} {
+		if _, err := fs.FileGet(testCtx, "bucket", name, FileGetOptions{}); !IsNotFoundError(err) {
+			t.Errorf("FileGet(%s) = %v, want NotFoundError", name, err)
+		}
+		if _, err := fs.FileOpenRead(testCtx, "bucket", name, FileGetOptions{}); !IsNotFoundError(err) {
+			t.Errorf("FileOpenRead(%s) = %v, want NotFoundError", name, err)
+		}
+	}
+	if err := fs.FileDelete(testCtx, "bucket", "MISSING1"); err != nil {
+		t.Errorf("FileDelete of missing file: %v", err)
+	}
+	if err := fs.FolderDelete(testCtx, "other"); err != nil {
+		t.Errorf("FolderDelete: %v", err)
+	}
+	if names := listNames(t, fs, "bucket", ""); !slices.Equal(names, []string{"ATTACH02", "BOOK0001"}) {
+		t.Errorf("unexpected files %v", names)
+	}
+}
+
+func TestMemFsFaults(t *testing.T) {
+	fs := NewMemFs()
+	failure := errors.New("disk full")
+	fs.SetFaults(MemFsFaults{FailCall: 2, Err: failure})
+	for i, expected := range []error{nil, failure, nil} {
+		if err := fs.FilePut(testCtx, "bucket", "file", []byte("data"), FilePutOptions{}); !errors.Is(err, expected) {
+			t.Errorf("call %d = %v, want %v", i+1, err, expected)
+		}
+	}
+	if fs.Calls() != 3 {
+		t.Errorf("counted %d calls", fs.Calls())
+	}
+
+	fs.SetFaults(MemFsFaults{PartialWrite: 3})
+	if err := fs.FileWrite(testCtx, "bucket", "file", strings.NewReader("content"), -1, FilePutOptions{}); !errors.Is(err, ErrSimulated) {
+		t.Errorf("partial write = %v, want ErrSimulated", err)
+	}
+	if data, _ := fs.FileGet(testCtx, "bucket", "file", FileGetOptions{}); string(data) != "con" {
+		t.Errorf("partial write stored %q", data)
+	}
+
+	fs.SetFaults(MemFsFaults{Latency: time.Hour})
+	ctx, cancel := context.WithTimeout(testCtx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := fs.FileExists(ctx, "bucket", "file"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("FileExists with latency = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestMemFsConcurrent(t *testing.T) {
+	fs := NewMemFs()
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("FILE%04d", i)
+			for range 50 {
+				if err := fs.FilePut(testCtx, "bucket", name, []byte(name), FilePutOptions{}); err != nil {
+					t.Errorf("FilePut: %v", err)
+				}
+				if _, err := fs.FileGet(testCtx, "bucket", name, FileGetOptions{}); err != nil {
+					t.Errorf("FileGet: %v", err)
+				}
+				for range fs.FileList(testCtx, "bucket", "") {
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if names := listNames(t, fs, "bucket", ""); len(names) != 8 {
+		t.Errorf("unexpected files %v", names)
+	}
+}
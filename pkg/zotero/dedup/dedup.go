@@ -0,0 +1,434 @@
+package dedup
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+// DefaultThreshold is the lowest score of a reported match. Two items with
+// the same title and neither year nor creators reach it.
+const DefaultThreshold = 0.85
+
+// maxBlockSize is the largest number of items compared because they share a
+// title word or title prefix. Larger blocks come from common words like
+// "report" and would make the comparisons grow quadratically; their items
+// are only compared through their other blocks.
+const maxBlockSize = 100
+
+// titlePrefixLength is the number of runes of the title prefix block
+const titlePrefixLength = 12
+
+// minTitleSimilarity is the lowest title similarity of items without a
+// common DOI or ISBN that are still compared.
+const minTitleSimilarity = 0.8
+
+// weights of the title, year and creator similarity in the score
+const (
+	titleWeight   = 0.7
+	yearWeight    = 0.15
+	creatorWeight = 0.15
+)
+
+// Match is a pair of items that are probably duplicates. Score is between 0
+// and 1; Reasons lists the fields that agree (doi, isbn, title, year,
+// creators).
+type Match struct {
+	Keys    [2]string `json:"keys"`
+	Score   float64   `json:"score"`
+	Reasons []string  `json:"reasons"`
+}
+
+// Cluster is a set of items that all match the oldest of them. Items are
+// ordered by dateAdded; Master is the key of the oldest item, the one Zotero
+// proposes to keep. Matches are the matches between the items and Score is
+// the lowest of their scores.
+type Cluster struct {
+	Master  string        `json:"master"`
+	Score   float64       `json:"score"`
+	Items   []*model.Item `json:"items"`
+	Matches []Match       `json:"matches"`
+}
+
+// Deduplicator finds and merges duplicate items of a group.
+type Deduplicator struct {
+	Storage   storage.Store
+	Threshold float64
+	Logger    zLogger.ZLogger
+}
+
+func NewDeduplicator(storage storage.Store, logger zLogger.ZLogger) *Deduplicator {
+	return &Deduplicator{
+		Storage:   storage,
+		Threshold: DefaultThreshold,
+		Logger:    logger,
+	}
+}
+
+// Find returns the duplicate clusters of group groupId with a score of at
+// least Threshold.
+func (d *Deduplicator) Find(ctx context.Context, groupId int64) ([]*Cluster, error) {
+	var items []*model.Item
+	if err := d.Storage.IterateItems(ctx, groupId, nil, func(item *model.Item) error {
+		items = append(items, item)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "cannot read items of group %v", groupId)
+	}
+	clusters := FindClusters(items, d.Threshold)
+	if d.Logger != nil {
+		d.Logger.Info().Msgf("%v duplicate clusters in %v items of group %v", len(clusters), len(items), groupId)
+	}
+	return clusters, nil
+}
+
+// FindClusters groups items into duplicate clusters. Only regular items are
+// considered; notes, attachments, annotations, trashed and deleted items are
+// skipped. Items of the same type are compared if they share a DOI, an ISBN,
+// the title, a title word of at least four letters or the title prefix;
+// words and prefixes shared by more than maxBlockSize items are ignored.
+// Every item of a cluster matches its master, so a series whose neighbors
+// match, like yearly reports, is not chained into one cluster.
+func FindClusters(items []*model.Item, threshold float64) []*Cluster {
+	prints := fingerprints(items)
+
+	matches := map[[2]int]Match{}
+	compared := map[[2]int]bool{}
+	for _, candidates := range blocks(prints) {
+		for n, i := range candidates {
+			for _, j := range candidates[n+1:] {
+				pair := [2]int{min(i, j), max(i, j)}
+				if i == j || compared[pair] {
+					continue
+				}
+				compared[pair] = true
+				score, reasons := compare(prints[pair[0]], prints[pair[1]])
+				if score < threshold {
+					continue
+				}
+				keys := [2]string{prints[pair[0]].item.Key, prints[pair[1]].item.Key}
+				slices.Sort(keys[:])
+				matches[pair] = Match{Keys: keys, Score: score, Reasons: reasons}
+			}
+		}
+	}
+	match := func(i, j int) (Match, bool) {
+		m, ok := matches[[2]int{min(i, j), max(i, j)}]
+		return m, ok
+	}
+
+	// the oldest unassigned item is the master of the items matching it
+	order := make([]int, len(prints))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		return cmp.Or(compareDateAdded(prints[a].item.Data.DateAdded, prints[b].item.Data.DateAdded), strings.Compare(prints[a].item.Key, prints[b].item.Key))
+	})
+	assigned := make([]bool, len(prints))
+	var clusters []*Cluster
+	for n, master := range order {
+		if assigned[master] {
+			continue
+		}
+		members := []int{master}
+		for _, i := range order[n+1:] {
+			if _, ok := match(master, i); ok && !assigned[i] {
+				members = append(members, i)
+			}
+		}
+		if len(members) < 2 {
+			continue
+		}
+		cluster := &Cluster{Master: prints[master].item.Key, Score: 1}
+		for k, i := range members {
+			assigned[i] = true
+			cluster.Items = append(cluster.Items, prints[i].item)
+			for _, j := range members[k+1:] {
+				if m, ok := match(i, j); ok {
+					cluster.Matches = append(cluster.Matches, m)
+					cluster.Score = min(cluster.Score, m.Score)
+				}
+			}
+		}
+		slices.SortFunc(cluster.Matches, func(a, b Match) int {
+			return cmp.Or(strings.Compare(a.Keys[0], b.Keys[0]), strings.Compare(a.Keys[1], b.Keys[1]))
+		})
+		clusters = append(clusters, cluster)
+	}
+	slices.SortFunc(clusters, func(a, b *Cluster) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), strings.Compare(a.Master, b.Master))
+	})
+	return clusters
+}
+
+// fingerprints returns the fingerprints of the regular items
+func fingerprints(items []*model.Item) []*fingerprint {
+	var prints []*fingerprint
+	for _, item := range items {
+		if item.Deleted || item.Trashed || !isRegular(&item.Data) {
+			continue
+		}
+		fp := newFingerprint(&item.Data)
+		fp.item = item
+		prints = append(prints, fp)
+	}
+	return prints
+}
+
+// blocks returns sets of indexes of prints whose items are compared with
+// each other
+func blocks(prints []*fingerprint) [][]int {
+	index := map[string][]int{}
+	for i, fp := range prints {
+		for _, token := range fp.tokens() {
+			key := fp.itemType + "\x00" + token
+			index[key] = append(index[key], i)
+		}
+	}
+	var result [][]int
+	for key, candidates := range index {
+		if len(candidates) < 2 {
+			continue
+		}
+		// identifiers and whole titles are compared in any case, only words
+		// and prefixes are capped
+		_, token, _ := strings.Cut(key, "\x00")
+		if len(candidates) > maxBlockSize && (strings.HasPrefix(token, "word:") || strings.HasPrefix(token, "prefix:")) {
+			continue
+		}
+		result = append(result, candidates)
+	}
+	return result
+}
+
+// Compare scores two items. Items with the same DOI or a common ISBN score
+// 1, items with different DOIs, different types, dissimilar titles, years
+// more than one apart or without a common creator score 0. Otherwise the
+// score weighs the title similarity with the agreement of year and
+// creators; a missing year or creator list counts half.
+func Compare(a, b *model.ItemGeneric) (float64, []string) {
+	return compare(newFingerprint(a), newFingerprint(b))
+}
+
+func compare(a, b *fingerprint) (float64, []string) {
+	if a.itemType != b.itemType {
+		return 0, nil
+	}
+	if a.doi != "" && b.doi != "" {
+		if a.doi == b.doi {
+			return 1, []string{"doi"}
+		}
+		return 0, nil
+	}
+	for _, isbn := range a.isbns {
+		if slices.Contains(b.isbns, isbn) {
+			return 1, []string{"isbn"}
+		}
+	}
+	if len(a.title) == 0 || len(b.title) == 0 {
+		return 0, nil
+	}
+	// the edit distance is at least the difference of the lengths
+	if float64(min(len(a.title), len(b.title)))/float64(max(len(a.title), len(b.title))) < minTitleSimilarity {
+		return 0, nil
+	}
+	titleScore := similarity(a.title, b.title)
+	if titleScore < minTitleSimilarity {
+		return 0, nil
+	}
+	reasons := []string{"title"}
+	yearScore := 0.5
+	if a.year != 0 && b.year != 0 {
+		switch diff := a.year - b.year; {
+		case diff == 0:
+			yearScore = 1
+			reasons = append(reasons, "year")
+		case diff < -1 || diff > 1:
+			return 0, nil
+		}
+	}
+	creatorScore := 0.5
+	if len(a.creators) > 0 && len(b.creators) > 0 {
+		var common int
+		for _, name := range a.creators {
+			if slices.Contains(b.creators, name) {
+				common++
+			}
+		}
+		if common == 0 {
+			return 0, nil
+		}
+		creatorScore = float64(common) / float64(min(len(a.creators), len(b.creators)))
+		reasons = append(reasons, "creators")
+	}
+	score := titleWeight*titleScore + yearWeight*yearScore + creatorWeight*creatorScore
+	return math.Round(score*1000) / 1000, reasons
+}
+
+// fingerprint holds the normalized fields of an item that are compared
+type fingerprint struct {
+	item     *model.Item
+	itemType string
+	title    []rune
+	doi      string
+	isbns    []string
+	year     int
+	creators []string
+}
+
+var (
+	markupRegexp = regexp.MustCompile(`<[^>]*>`)
+	doiRegexp    = regexp.MustCompile(`10\.\d{4,9}/\S+`)
+	yearRegexp   = regexp.MustCompile(`\b\d{4}\b`)
+)
+
+func newFingerprint(data *model.ItemGeneric) *fingerprint {
+	fp := &fingerprint{
+		itemType: data.ItemType,
+		title:    []rune(normalize(markupRegexp.ReplaceAllString(data.Title, ""))),
+		doi:      normalizeDOI(data.GetString("DOI")),
+		isbns:    normalizeISBNs(data.GetString("ISBN")),
+	}
+	if year := yearRegexp.FindString(data.Date); year != "" {
+		fp.year, _ = strconv.Atoi(year)
+	}
+	for _, creator := range data.Creators {
+		name := creator.LastName
+		if name == "" {
+			name = creator.Name
+		}
+		if name = normalize(name); name != "" && !slices.Contains(fp.creators, name) {
+			fp.creators = append(fp.creators, name)
+		}
+	}
+	return fp
+}
+
+// tokens returns the index keys of candidates for a comparison
+func (fp *fingerprint) tokens() []string {
+	var tokens []string
+	if fp.doi != "" {
+		tokens = append(tokens, "doi:"+fp.doi)
+	}
+	for _, isbn := range fp.isbns {
+		tokens = append(tokens, "isbn:"+isbn)
+	}
+	for _, word := range strings.Fields(string(fp.title)) {
+		if len([]rune(word)) >= 4 && !slices.Contains(tokens, "word:"+word) {
+			tokens = append(tokens, "word:"+word)
+		}
+	}
+	if len(fp.title) > 0 {
+		tokens = append(tokens, "title:"+string(fp.title))
+		tokens = append(tokens, "prefix:"+string(fp.title[:min(len(fp.title), titlePrefixLength)]))
+	}
+	return tokens
+}
+
+func isRegular(data *model.ItemGeneric) bool {
+	switch data.ItemType {
+	case "note", "attachment", "annotation":
+		return false
+	}
+	return data.ParentItem == ""
+}
+
+// normalize lowercases str and reduces it to words of letters and digits
+func normalize(str string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(str), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+func normalizeDOI(str string) string {
+	doi := doiRegexp.FindString(strings.ToLower(str))
+	return strings.TrimRight(doi, ".,;")
+}
+
+// normalizeISBNs returns the ISBNs of str as ISBN-13
+func normalizeISBNs(str string) []string {
+	var isbns []string
+	for _, field := range strings.FieldsFunc(str, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ',' || r == ';'
+	}) {
+		isbn := strings.ToUpper(strings.ReplaceAll(field, "-", ""))
+		switch len(isbn) {
+		case 10:
+			isbn = "978" + isbn[:9]
+			isbn += isbn13CheckDigit(isbn)
+		case 13:
+		default:
+			continue
+		}
+		if strings.Trim(isbn[:12], "0123456789") != "" || slices.Contains(isbns, isbn) {
+			continue
+		}
+		isbns = append(isbns, isbn)
+	}
+	return isbns
+}
+
+func isbn13CheckDigit(digits string) string {
+	var sum int
+	for i, r := range digits[:12] {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(r-'0')
+	}
+	return strconv.Itoa((10 - sum%10) % 10)
+}
+
+// similarity is one minus the edit distance relative to the longer string
+func similarity(a, b []rune) float64 {
+	longest := max(len(a), len(b))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// compareDateAdded sorts items without dateAdded last
+func compareDateAdded(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	return strings.Compare(a, b)
+}
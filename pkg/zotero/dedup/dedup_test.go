@@ -0,0 +1,233 @@
+package dedup_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/je4/zsync/v2/pkg/zotero/dedup"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/memory"
+)
+
+const testGroup int64 = 4711
+
+func book(key, title, date string, lastNames ...string) *model.Item {
+	item := &model.Item{Key: key, Data: model.ItemGeneric{
+		ItemDataBase: model.ItemDataBase{Key: key, ItemType: "book", DateAdded: "2024-01-01T00:00:00Z"},
+		Title:        title,
+		Date:         date,
+	}}
+	for _, name := range lastNames {
+		item.Data.Creators = append(item.Data.Creators, model.ItemDataPerson{CreatorType: "author", LastName: name})
+	}
+	return item
+}
+
+func TestCompare(t *testing.T) {
+	withField := func(item *model.Item, field, value string) *model.Item {
+		item.Data.Set(field, value)
+		return item
+	}
+	tests := []struct {
+		name    string
+		a, b    *model.Item
+		score   float64
+		reasons []string
+	}{
+		{"same title year creators", book("A", "The Art of Computer Programming", "1968", "Knuth"),
+			book("B", "The art of computer programming.", "1968-01", "Knuth", "Other"), 1, []string{"title", "year", "creators"}},
+		{"typo in title", book("A", "Structure and Interpretation of Computer Programs", "1985", "Abelson"),
+			book("B", "Structure and Interpretaton of Computer Programs", "1985", "Abelson"), 0.986, []string{"title", "year", "creators"}},
+		{"title only", book("A", "Gödel, Escher, Bach", ""), book("B", "<i>Gödel, Escher, Bach</i>", ""), 0.85, []string{"title"}},
+		{"years too far apart", book("A", "Collected Papers", "1990"), book("B", "Collected Papers", "1995"), 0, nil},
+		{"adjacent years", book("A", "Collected Papers", "1990"), book("B", "Collected Papers", "1991"), 0.85, []string{"title"}},
+		{"no common creator", book("A", "Introduction", "", "Smith"), book("B", "Introduction", "", "Jones"), 0, nil},
+		{"different titles", book("A", "Databases", ""), book("B", "Networks", ""), 0, nil},
+		{"same doi", withField(book("A", "One", ""), "DOI", "https://doi.org/10.1000/XYZ"),
+			withField(book("B", "Other", ""), "DOI", "doi:10.1000/xyz."), 1, []string{"doi"}},
+		{"different doi", withField(book("A", "Same", ""), "DOI", "10.1000/1"),
+			withField(book("B", "Same", ""), "DOI", "10.1000/2"), 0, nil},
+		{"isbn 10 and 13", withField(book("A", "One", ""), "ISBN", "0-306-40615-2"),
+			withField(book("B", "Two", ""), "ISBN", "978-0-306-40615-7 1234567890123"), 1, []string{"isbn"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, reasons := dedup.Compare(&tt.a.Data, &tt.b.Data)
+			if score != tt.score || !slices.Equal(reasons, tt.reasons) {
+				t.Errorf("got %v %v, expected %v %v", score, reasons, tt.score, tt.reasons)
+			}
+		})
+	}
+
+	article := book("C", "The Art of Computer Programming", "1968", "Knuth")
+	article.Data.ItemType = "journalArticle"
+	if score, _ := dedup.Compare(&book("A", "The Art of Computer Programming", "1968", "Knuth").Data, &article.Data); score != 0 {
+		t.Errorf("items of different types scored %v", score)
+	}
+}
+
+func TestFindClusters(t *testing.T) {
+	first := book("AAAAAAAA", "Distributed Systems", "2017", "Tanenbaum")
+	second := book("BBBBBBBB", "Distributed systems", "2017", "Tanenbaum", "Steen")
+	second.Data.DateAdded = "2023-01-01T00:00:00Z"
+	third := book("CCCCCCCC", "Distributed Systemss", "", "Tanenbaum")
+	trashed := book("DDDDDDDD", "Distributed Systems", "2017", "Tanenbaum")
+	trashed.Trashed = true
+	note := book("EEEEEEEE", "Distributed Systems", "2017", "Tanenbaum")
+	note.Data.ItemType = "note"
+	other := book("FFFFFFFF", "Operating Systems", "2017", "Tanenbaum")
+
+	clusters := dedup.FindClusters([]*model.Item{first, second, third, trashed, note, other}, dedup.DefaultThreshold)
+	if len(clusters) != 1 {
+		t.Fatalf("expected 1 cluster, got %d", len(clusters))
+	}
+	cluster := clusters[0]
+	var keys []string
+	for _, item := range cluster.Items {
+		keys = append(keys, item.Key)
+	}
+	if !slices.Equal(keys, []string{"BBBBBBBB", "AAAAAAAA", "CCCCCCCC"}) || cluster.Master != "BBBBBBBB" {
+		t.Errorf("unexpected cluster %v with master %s", keys, cluster.Master)
+	}
+	if len(cluster.Matches) != 3 || cluster.Score != 0.89 {
+		t.Errorf("unexpected matches %+v with score %v", cluster.Matches, cluster.Score)
+	}
+}
+
+func TestFindClusters_CommonWord(t *testing.T) {
+	// every title contains "annual report of the committee", only the
+	// number tells them apart
+	const count = 3000
+	var items []*model.Item
+	for i := range count {
+		items = append(items, book(fmt.Sprintf("K%07d", i), fmt.Sprintf("Annual report of the committee %04d", i), "2020"))
+	}
+	duplicate := book("DUPLICAT", "Annual Report of the Committee 0042.", "2020")
+	items = append(items, duplicate)
+
+	if pairs := dedup.CandidatePairs(items); pairs > count {
+		t.Errorf("%d candidate pairs for %d items", pairs, len(items))
+	}
+	clusters := dedup.FindClusters(items, dedup.DefaultThreshold)
+	if len(clusters) != 1 || len(clusters[0].Items) != 2 || !slices.ContainsFunc(clusters[0].Items, func(item *model.Item) bool { return item.Key == "K0000042" }) {
+		t.Errorf("unexpected clusters %+v", clusters)
+	}
+}
+
+func TestFindClusters_CommonTitle(t *testing.T) {
+	// more items share the title than maxBlockSize, but they have no
+	// common creator
+	var items []*model.Item
+	for i := range 150 {
+		items = append(items, book(fmt.Sprintf("K%07d", i), "Annual Report", "2020", fmt.Sprintf("Publisher%d", i)))
+	}
+	items = append(items, book("MUSEUM01", "Annual Report", "2020", "Museum"), book("MUSEUM02", "Annual Report", "2020", "Museum"))
+
+	clusters := dedup.FindClusters(items, dedup.DefaultThreshold)
+	if len(clusters) != 1 || clusters[0].Master != "MUSEUM01" || len(clusters[0].Items) != 2 || clusters[0].Score != 1 {
+		t.Errorf("unexpected clusters %+v", clusters)
+	}
+}
+
+func TestFindClusters_Series(t *testing.T) {
+	// neighboring years match, years further apart do not
+	var items []*model.Item
+	for year := 2015; year < 2025; year++ {
+		items = append(items, book(fmt.Sprintf("YEAR%04d", year), fmt.Sprintf("Annual Report %d", year), strconv.Itoa(year), "Museum"))
+	}
+	clusters := dedup.FindClusters(items, dedup.DefaultThreshold)
+	if len(clusters) == 0 {
+		t.Fatal("neighboring years are not clustered")
+	}
+	for _, cluster := range clusters {
+		if len(cluster.Items) != 2 || len(cluster.Matches) != 1 {
+			t.Errorf("cluster of %s has %d items and %d matches", cluster.Master, len(cluster.Items), len(cluster.Matches))
+		}
+		for _, item := range cluster.Items[1:] {
+			if score, _ := dedup.Compare(&cluster.Items[0].Data, &item.Data); score < dedup.DefaultThreshold {
+				t.Errorf("item %s does not match master %s: %v", item.Key, cluster.Master, score)
+			}
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	ctx := context.Background()
+	st := memory.NewStore(false, nil)
+	create := func(item *model.Item) *model.Item {
+		created, err := st.CreateItem(ctx, testGroup, &item.Data, nil, "")
+		if err != nil {
+			t.Fatalf("CreateItem: %v", err)
+		}
+		if _, err := st.ModifyItem(ctx, testGroup, created.Key, func(item *model.Item) error {
+			item.Status = model.SyncStatus_Synced
+			return nil
+		}); err != nil {
+			t.Fatalf("ModifyItem: %v", err)
+		}
+		return created
+	}
+	masterData := book("MASTER01", "Distributed Systems", "2017", "Tanenbaum")
+	masterData.Data.Collections = []string{"COLL0001"}
+	masterData.Data.Tags = []model.ItemTag{{Tag: "systems"}}
+	master := create(masterData)
+	dupData := book("DUPLICA1", "Distributed systems", "2017", "Tanenbaum")
+	dupData.Data.Collections = []string{"COLL0001", "COLL0002"}
+	dupData.Data.Tags = []model.ItemTag{{Tag: "systems"}, {Tag: "distributed", Type: 1}}
+	dupData.Data.Relations = model.Relations{"dc:relation": {dedup.ItemURI(testGroup, "RELATED1"), dedup.ItemURI(testGroup, master.Key)}}
+	dup := create(dupData)
+	note := book("NOTE0001", "", "")
+	note.Data.ItemType = "note"
+	note.Data.ParentItem = dup.Key
+	create(note)
+	related := book("RELATED1", "Consensus", "")
+	related.Data.Relations = model.Relations{"dc:relation": {dedup.ItemURI(testGroup, dup.Key)}}
+	create(related)
+
+	d := dedup.NewDeduplicator(st, nil)
+	clusters, err := d.Find(ctx, testGroup)
+	if err != nil || len(clusters) != 1 {
+		t.Fatalf("Find: %v, %v", clusters, err)
+	}
+
+	if _, err := d.Merge(ctx, testGroup, master.Key, []string{"NOTE0001"}); !errors.Is(err, dedup.ErrInvalidMerge) {
+		t.Errorf("expected ErrInvalidMerge for a note, got %v", err)
+	}
+	if _, err := d.Merge(ctx, testGroup, master.Key, []string{"MISSING1"}); !errors.Is(err, dedup.ErrItemNotFound) {
+		t.Errorf("expected ErrItemNotFound, got %v", err)
+	}
+
+	merged, err := d.Merge(ctx, testGroup, master.Key, []string{dup.Key})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if merged.Status != model.SyncStatus_Modified ||
+		!slices.Equal(merged.Data.Collections, []string{"COLL0001", "COLL0002"}) ||
+		len(merged.Data.Tags) != 2 ||
+		!slices.Equal(merged.Data.Relations["dc:relation"], model.ZoteroStringList{dedup.ItemURI(testGroup, "RELATED1")}) ||
+		!slices.Equal(merged.Data.Relations[dedup.RelationReplaces], model.ZoteroStringList{dedup.ItemURI(testGroup, dup.Key)}) {
+		t.Errorf("unexpected master %+v", merged)
+	}
+
+	trashed, _ := st.GetItemByKey(ctx, testGroup, dup.Key)
+	if !trashed.Trashed || trashed.Data.GetString("deleted") != "1" || trashed.Status != model.SyncStatus_Modified ||
+		!slices.Equal(trashed.Data.Relations[dedup.RelationSameAs], model.ZoteroStringList{dedup.ItemURI(testGroup, master.Key)}) {
+		t.Errorf("unexpected merged item %+v", trashed)
+	}
+	child, _ := st.GetItemByKey(ctx, testGroup, "NOTE0001")
+	if child.Data.ParentItem != master.Key || child.Status != model.SyncStatus_Modified {
+		t.Errorf("note not moved: %+v", child)
+	}
+	rel, _ := st.GetItemByKey(ctx, testGroup, "RELATED1")
+	if !slices.Equal(rel.Data.Relations["dc:relation"], model.ZoteroStringList{dedup.ItemURI(testGroup, master.Key)}) {
+		t.Errorf("relation not moved: %v", rel.Data.Relations)
+	}
+
+	if clusters, err := d.Find(ctx, testGroup); err != nil || len(clusters) != 0 {
+		t.Errorf("expected no duplicates after merge, got %v, %v", clusters, err)
+	}
+}
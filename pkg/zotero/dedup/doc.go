@@ -0,0 +1,3 @@
+// Package dedup finds duplicate items of a group and merges them into one
+// master item the way the duplicate pane of the Zotero client does.
+package dedup
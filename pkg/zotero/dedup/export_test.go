@@ -0,0 +1,16 @@
+package dedup
+
+import "github.com/je4/zsync/v2/pkg/zotero/model"
+
+// CandidatePairs returns the number of item pairs FindClusters compares.
+func CandidatePairs(items []*model.Item) int {
+	pairs := map[[2]int]bool{}
+	for _, candidates := range blocks(fingerprints(items)) {
+		for n, i := range candidates {
+			for _, j := range candidates[n+1:] {
+				pairs[[2]int{min(i, j), max(i, j)}] = true
+			}
+		}
+	}
+	return len(pairs)
+}
@@ -0,0 +1,206 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// relation predicates written by Merge
+const (
+	RelationSameAs   = "owl:sameAs"
+	RelationReplaces = "dc:replaces"
+)
+
+var (
+	ErrItemNotFound = errors.New("item not found")
+	ErrInvalidMerge = errors.New("invalid merge")
+)
+
+// ItemURI returns the URI of an item in relations of the Zotero cloud.
+func ItemURI(groupId int64, key string) string {
+	return fmt.Sprintf("http://zotero.org/groups/%d/items/%s", groupId, key)
+}
+
+// Merge merges the items keys into the item masterKey. The master keeps its
+// fields and gets the collections, tags and relations of the merged items
+// and a dc:replaces relation to each of them. Child notes and attachments
+// are moved to the master and relations of other items that point to a
+// merged item point to the master afterwards. The merged items are moved to
+// the trash with an owl:sameAs relation to the master. All changed items are
+// marked modified, so the next sync uploads the merge.
+//
+// The items must be regular items of the same type. The changes are not
+// atomic; the merged items are trashed last, so a failed merge can be
+// repeated.
+func (d *Deduplicator) Merge(ctx context.Context, groupId int64, masterKey string, keys []string) (*model.Item, error) {
+	master, err := d.getItem(ctx, groupId, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	var others []*model.Item
+	uris := map[string]bool{}
+	for _, key := range keys {
+		if key == masterKey {
+			return nil, errors.Wrapf(ErrInvalidMerge, "cannot merge item %s into itself", key)
+		}
+		if uris[ItemURI(groupId, key)] {
+			continue
+		}
+		other, err := d.getItem(ctx, groupId, key)
+		if err != nil {
+			return nil, err
+		}
+		if other.Data.ItemType != master.Data.ItemType {
+			return nil, errors.Wrapf(ErrInvalidMerge, "item %s is of type %s, not %s", key, other.Data.ItemType, master.Data.ItemType)
+		}
+		others = append(others, other)
+		uris[ItemURI(groupId, key)] = true
+	}
+	if len(others) == 0 {
+		return nil, errors.Wrap(ErrInvalidMerge, "no items to merge")
+	}
+	if d.Logger != nil {
+		d.Logger.Info().Msgf("merging %v items into %s of group %v", len(others), masterKey, groupId)
+	}
+	masterURI := ItemURI(groupId, masterKey)
+
+	for _, other := range others {
+		children, err := d.Storage.GetChildren(ctx, groupId, other.Key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get children of item %s", other.Key)
+		}
+		for _, child := range children {
+			if err := d.modifyItem(ctx, groupId, child.Key, func(item *model.Item) {
+				item.Data.ParentItem = masterKey
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var related []string
+	if err := d.Storage.IterateItems(ctx, groupId, nil, func(item *model.Item) error {
+		if item.Key == masterKey || uris[ItemURI(groupId, item.Key)] {
+			return nil
+		}
+		for _, objects := range item.Data.Relations {
+			if slices.ContainsFunc(objects, func(object string) bool { return uris[object] }) {
+				related = append(related, item.Key)
+				break
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "cannot read items of group %v", groupId)
+	}
+	for _, key := range related {
+		if err := d.modifyItem(ctx, groupId, key, func(item *model.Item) {
+			relations := model.Relations{}
+			for predicate, objects := range item.Data.Relations {
+				for _, object := range objects {
+					if uris[object] {
+						object = masterURI
+					}
+					addRelation(&relations, predicate, object)
+				}
+			}
+			item.Data.Relations = relations
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.modifyItem(ctx, groupId, masterKey, func(item *model.Item) {
+		relations := model.Relations{}
+		for _, data := range append([]*model.ItemGeneric{&item.Data}, dataOf(others)...) {
+			for predicate, objects := range data.Relations {
+				for _, object := range objects {
+					// relations between the merged items are dropped
+					if object != masterURI && !uris[object] {
+						addRelation(&relations, predicate, object)
+					}
+				}
+			}
+		}
+		for _, other := range others {
+			for _, coll := range other.Data.Collections {
+				item.Data.Collections = model.AppendIfMissing(item.Data.Collections, coll)
+			}
+			for _, tag := range other.Data.Tags {
+				if !slices.ContainsFunc(item.Data.Tags, func(t model.ItemTag) bool { return t.Tag == tag.Tag }) {
+					item.Data.Tags = append(item.Data.Tags, tag)
+				}
+			}
+			addRelation(&relations, RelationReplaces, ItemURI(groupId, other.Key))
+		}
+		item.Data.Relations = relations
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, other := range others {
+		if err := d.modifyItem(ctx, groupId, other.Key, func(item *model.Item) {
+			item.Trashed = true
+			item.Data.Set("deleted", "1")
+			delete(item.Data.Relations, RelationReplaces)
+			addRelation(&item.Data.Relations, RelationSameAs, masterURI)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return d.getItem(ctx, groupId, masterKey)
+}
+
+// getItem loads a regular item that is not deleted
+func (d *Deduplicator) getItem(ctx context.Context, groupId int64, key string) (*model.Item, error) {
+	item, err := d.Storage.GetItemByKey(ctx, groupId, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get item %s", key)
+	}
+	if item == nil || item.Deleted {
+		return nil, errors.Wrapf(ErrItemNotFound, "item %s of group %v", key, groupId)
+	}
+	if !isRegular(&item.Data) {
+		return nil, errors.Wrapf(ErrInvalidMerge, "item %s is a child or %s item", key, item.Data.ItemType)
+	}
+	return item, nil
+}
+
+// modifyItem changes an item and marks it modified unless it is new
+func (d *Deduplicator) modifyItem(ctx context.Context, groupId int64, key string, f func(item *model.Item)) error {
+	item, err := d.Storage.ModifyItem(ctx, groupId, key, func(item *model.Item) error {
+		f(item)
+		if item.Status != model.SyncStatus_New {
+			item.Status = model.SyncStatus_Modified
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "cannot modify item %s", key)
+	}
+	if item == nil {
+		return errors.Wrapf(ErrItemNotFound, "item %s of group %v", key, groupId)
+	}
+	return nil
+}
+
+func addRelation(relations *model.Relations, predicate, object string) {
+	if *relations == nil {
+		*relations = model.Relations{}
+	}
+	if !slices.Contains((*relations)[predicate], object) {
+		(*relations)[predicate] = append((*relations)[predicate], object)
+	}
+}
+
+func dataOf(items []*model.Item) []*model.ItemGeneric {
+	data := make([]*model.ItemGeneric, 0, len(items))
+	for _, item := range items {
+		data = append(data, &item.Data)
+	}
+	return data
+}
@@ -0,0 +1,623 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+var bibtexTypes = map[string]string{
+	"article":       "journalArticle",
+	"book":          "book",
+	"booklet":       "book",
+	"manual":        "book",
+	"proceedings":   "book",
+	"inbook":        "bookSection",
+	"incollection":  "bookSection",
+	"inproceedings": "conferencePaper",
+	"conference":    "conferencePaper",
+	"phdthesis":     "thesis",
+	"mastersthesis": "thesis",
+	"thesis":        "thesis",
+	"techreport":    "report",
+	"report":        "report",
+	"unpublished":   "manuscript",
+	"misc":          "document",
+	"online":        "webpage",
+	"electronic":    "webpage",
+	"www":           "webpage",
+	"patent":        "patent",
+	"dataset":       "dataset",
+	"software":      "computerProgram",
+}
+
+// bibtexFields maps BibTeX fields to candidate Zotero (base) fields.
+var bibtexFields = map[string][]string{
+	"title":        {"title"},
+	"shorttitle":   {"shortTitle"},
+	"abstract":     {"abstractNote"},
+	"journal":      {"publicationTitle"},
+	"journaltitle": {"publicationTitle"},
+	"booktitle":    {"publicationTitle"},
+	"publisher":    {"publisher"},
+	"institution":  {"publisher"},
+	"school":       {"publisher"},
+	"organization": {"publisher", "authority"},
+	"address":      {"place"},
+	"location":     {"place"},
+	"volume":       {"volume"},
+	"issue":        {"issue"},
+	"series":       {"series", "seriesTitle"},
+	"edition":      {"edition"},
+	"isbn":         {"ISBN"},
+	"issn":         {"ISSN"},
+	"doi":          {"DOI"},
+	"url":          {"url"},
+	"urldate":      {"accessDate"},
+	"language":     {"language"},
+	"type":         {"type"},
+	"note":         {"extra"},
+	"annote":       {"extra"},
+	"howpublished": {"medium", "extra"},
+}
+
+var bibtexCreators = map[string]string{
+	"author":     "author",
+	"editor":     "editor",
+	"translator": "translator",
+}
+
+// ParseBibTeX reads BibTeX entries. @string macros are expanded, @comment and
+// @preamble blocks are skipped. Every entry yields a record or at least one
+// error diagnostic.
+func ParseBibTeX(r io.Reader) ([]*Record, []Diagnostic, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot read bibtex data")
+	}
+	p := &bibParser{
+		src:  []rune(string(data)),
+		line: 1,
+		macros: map[string]string{
+			"jan": "1", "feb": "2", "mar": "3", "apr": "4", "may": "5", "jun": "6",
+			"jul": "7", "aug": "8", "sep": "9", "oct": "10", "nov": "11", "dec": "12",
+		},
+	}
+	var records []*Record
+	var diags []Diagnostic
+	entry := 0
+	for p.skipTo('@') {
+		line := p.line
+		p.next()
+		kind := strings.ToLower(p.ident())
+		p.skipSpace()
+		open := p.peek()
+		if open != '{' && open != '(' {
+			continue
+		}
+		switch kind {
+		case "comment", "preamble":
+			p.skipBalanced()
+			continue
+		case "string":
+			p.next()
+			if err := p.parseMacro(closing(open)); err != nil {
+				diags = append(diags, Diagnostic{Entry: entry, Line: line, Severity: Severity_Warning, Message: fmt.Sprintf("invalid @string: %v", err)})
+			}
+			continue
+		}
+		entry++
+		p.next()
+		raw, err := p.parseEntry(closing(open))
+		if err != nil {
+			diags = append(diags, Diagnostic{Entry: entry, Line: line, SourceId: raw.key, Severity: Severity_Error, Message: fmt.Sprintf("syntax error: %v", err)})
+			continue
+		}
+		rec, d := bibtexRecord(entry, line, kind, raw)
+		diags = append(diags, d...)
+		if rec != nil {
+			records = append(records, rec)
+		}
+	}
+	return records, diags, nil
+}
+
+type bibEntry struct {
+	key    string
+	fields map[string]string // raw values, braces retained
+	order  []string
+}
+
+func bibtexRecord(entry, line int, kind string, raw *bibEntry) (*Record, []Diagnostic) {
+	itemType, ok := bibtexTypes[kind]
+	if !ok {
+		itemType = "document"
+	}
+	b := newEntryBuilder(entry, line, raw.key, itemType)
+	if !ok {
+		b.warnf("unknown entry type @%s imported as %q", kind, itemType)
+	}
+	b.set(raw.key, "citationKey")
+	switch kind {
+	case "phdthesis":
+		b.set("PhD Thesis", "type")
+	case "mastersthesis":
+		b.set("Master's Thesis", "type")
+	}
+
+	var year string
+	var month, day int
+	for _, name := range raw.order {
+		value := raw.fields[name]
+		if ct, ok := bibtexCreators[name]; ok {
+			for _, n := range splitBibNames(value) {
+				b.addCreator(ct, n)
+			}
+			continue
+		}
+		text := latexToText(value)
+		switch name {
+		case "year":
+			year = text
+		case "month":
+			month = monthNumber(text)
+		case "day":
+			fmt.Sscanf(text, "%d", &day)
+		case "date":
+			b.set(text, "date")
+		case "number":
+			if itemType == "journalArticle" || itemType == "magazineArticle" || itemType == "newspaperArticle" {
+				b.set(text, "issue")
+			} else {
+				b.set(text, "number", "seriesNumber", "issue")
+			}
+		case "pages":
+			text = strings.ReplaceAll(text, "–", "-")
+			if itemType == "book" || itemType == "thesis" || itemType == "manuscript" {
+				b.set(text, "numPages")
+			} else {
+				b.set(text, "pages")
+			}
+		case "keywords":
+			for _, kw := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ';' }) {
+				b.addTag(kw)
+			}
+		default:
+			fields, ok := bibtexFields[name]
+			if !ok {
+				b.warnf("unsupported bibtex field %q dropped", name)
+				continue
+			}
+			b.set(text, fields...)
+		}
+	}
+	b.set(joinDate(year, month, day), "date")
+	return b.finish()
+}
+
+// splitBibNames splits a BibTeX name list on top-level "and". Names fully
+// enclosed in braces are corporate names and kept as a single field.
+func splitBibNames(value string) []model.ItemDataPerson {
+	var result []model.ItemDataPerson
+	for _, part := range splitTopLevel(value, "and") {
+		part = strings.TrimSpace(part)
+		if part == "" || strings.EqualFold(part, "others") {
+			continue
+		}
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") && braceDepthZeroAt(part, len(part)-1) {
+			result = append(result, model.ItemDataPerson{Name: latexToText(part)})
+			continue
+		}
+		result = append(result, splitName(latexToText(protectCommas(part))))
+	}
+	return result
+}
+
+// protectCommas removes commas inside braces so that only top-level commas
+// separate last and first name.
+func protectCommas(s string) string {
+	var sb strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth > 0 {
+				continue
+			}
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// braceDepthZeroAt reports whether the brace opened at position 0 closes at
+// position pos.
+func braceDepthZeroAt(s string, pos int) bool {
+	depth := 0
+	for i, r := range s {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i == pos
+			}
+		}
+	}
+	return false
+}
+
+// splitTopLevel splits s on the whitespace-delimited word sep outside braces.
+func splitTopLevel(s string, sep string) []string {
+	var parts []string
+	var cur strings.Builder
+	depth := 0
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+		if depth == 0 && unicode.IsSpace(r) {
+			rest := string(runes[i+1:])
+			if len(rest) > len(sep) && strings.EqualFold(rest[:len(sep)], sep) && unicode.IsSpace([]rune(rest[len(sep):])[0]) {
+				parts = append(parts, cur.String())
+				cur.Reset()
+				i += len([]rune(sep)) + 1
+				continue
+			}
+		}
+		cur.WriteRune(r)
+	}
+	parts = append(parts, cur.String())
+	return parts
+}
+
+type bibParser struct {
+	src    []rune
+	pos    int
+	line   int
+	macros map[string]string
+}
+
+func closing(open rune) rune {
+	if open == '(' {
+		return ')'
+	}
+	return '}'
+}
+
+func (p *bibParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *bibParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *bibParser) next() rune {
+	if p.eof() {
+		return 0
+	}
+	r := p.src[p.pos]
+	p.pos++
+	if r == '\n' {
+		p.line++
+	}
+	return r
+}
+
+func (p *bibParser) skipTo(r rune) bool {
+	for !p.eof() {
+		if p.peek() == r {
+			return true
+		}
+		p.next()
+	}
+	return false
+}
+
+func (p *bibParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.next()
+	}
+}
+
+func (p *bibParser) ident() string {
+	start := p.pos
+	for !p.eof() {
+		r := p.peek()
+		if unicode.IsSpace(r) || strings.ContainsRune("{}(),=#\"@", r) {
+			break
+		}
+		p.next()
+	}
+	return string(p.src[start:p.pos])
+}
+
+func (p *bibParser) skipBalanced() {
+	open := p.next()
+	close := closing(open)
+	depth := 1
+	for !p.eof() && depth > 0 {
+		switch p.next() {
+		case open:
+			depth++
+		case close:
+			depth--
+		}
+	}
+}
+
+func (p *bibParser) parseMacro(close rune) error {
+	p.skipSpace()
+	name := strings.ToLower(p.ident())
+	p.skipSpace()
+	if p.next() != '=' {
+		return errors.Errorf("expected '=' after %q", name)
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.next() != close {
+		return errors.Errorf("unterminated @string %q", name)
+	}
+	p.macros[name] = value
+	return nil
+}
+
+func (p *bibParser) parseEntry(close rune) (*bibEntry, error) {
+	e := &bibEntry{fields: map[string]string{}}
+	p.skipSpace()
+	start := p.pos
+	for !p.eof() && p.peek() != ',' && p.peek() != close {
+		p.next()
+	}
+	e.key = strings.TrimSpace(string(p.src[start:p.pos]))
+	if p.next() == close {
+		return e, nil
+	}
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return e, errors.New("unexpected end of input")
+		}
+		if p.peek() == close {
+			p.next()
+			return e, nil
+		}
+		name := strings.ToLower(p.ident())
+		if name == "" {
+			err := errors.Errorf("unexpected character %q", p.peek())
+			p.recover()
+			return e, err
+		}
+		p.skipSpace()
+		if p.next() != '=' {
+			p.recover()
+			return e, errors.Errorf("expected '=' after field %q", name)
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			p.recover()
+			return e, errors.Wrapf(err, "field %q", name)
+		}
+		if _, ok := e.fields[name]; !ok {
+			e.order = append(e.order, name)
+		}
+		e.fields[name] = value
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.next()
+		case close:
+		default:
+			p.recover()
+			return e, errors.Errorf("expected ',' after field %q", name)
+		}
+	}
+}
+
+// recover skips to the next entry after a syntax error.
+func (p *bibParser) recover() {
+	for !p.eof() {
+		if p.peek() == '@' && p.pos > 0 && p.src[p.pos-1] == '\n' {
+			return
+		}
+		p.next()
+	}
+}
+
+// parseValue reads a value made of braced, quoted, numeric and macro parts
+// joined with '#'.
+func (p *bibParser) parseValue() (string, error) {
+	var sb strings.Builder
+	for {
+		p.skipSpace()
+		switch r := p.peek(); {
+		case r == '{':
+			p.next()
+			s, err := p.readUntilBrace('}')
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(s)
+		case r == '"':
+			p.next()
+			s, err := p.readUntilBrace('"')
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(s)
+		case r == 0:
+			return "", errors.New("unexpected end of input")
+		default:
+			id := p.ident()
+			if id == "" {
+				return "", errors.Errorf("unexpected character %q", r)
+			}
+			if m, ok := p.macros[strings.ToLower(id)]; ok {
+				sb.WriteString(m)
+			} else if isDigits(id) {
+				sb.WriteString(id)
+			} else {
+				return "", errors.Errorf("undefined macro %q", id)
+			}
+		}
+		p.skipSpace()
+		if p.peek() != '#' {
+			return sb.String(), nil
+		}
+		p.next()
+	}
+}
+
+// readUntilBrace reads up to the terminator at brace depth zero. Nested braces
+// are kept in the result.
+func (p *bibParser) readUntilBrace(term rune) (string, error) {
+	var sb strings.Builder
+	depth := 0
+	for !p.eof() {
+		r := p.next()
+		switch {
+		case r == '\\' && !p.eof():
+			sb.WriteRune(r)
+			sb.WriteRune(p.next())
+			continue
+		case r == '@' && p.pos > 1 && p.src[p.pos-2] == '\n':
+			// an entry start at the beginning of a line almost always means
+			// that a brace or quote was not closed
+			p.pos--
+			return "", errors.Errorf("unterminated value before line %d, missing %q", p.line, term)
+		case r == '{':
+			depth++
+		case r == '}' && depth > 0:
+			depth--
+		case r == term && depth == 0:
+			return sb.String(), nil
+		}
+		sb.WriteRune(r)
+	}
+	return "", errors.Errorf("unterminated value, missing %q", term)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+var latexAccents = map[string]map[rune]rune{
+	`"`: {'a': 'ä', 'e': 'ë', 'i': 'ï', 'o': 'ö', 'u': 'ü', 'y': 'ÿ', 'A': 'Ä', 'E': 'Ë', 'I': 'Ï', 'O': 'Ö', 'U': 'Ü'},
+	`'`: {'a': 'á', 'c': 'ć', 'e': 'é', 'i': 'í', 'n': 'ń', 'o': 'ó', 's': 'ś', 'u': 'ú', 'y': 'ý', 'z': 'ź', 'A': 'Á', 'C': 'Ć', 'E': 'É', 'I': 'Í', 'O': 'Ó', 'S': 'Ś', 'U': 'Ú'},
+	"`": {'a': 'à', 'e': 'è', 'i': 'ì', 'o': 'ò', 'u': 'ù', 'A': 'À', 'E': 'È', 'I': 'Ì', 'O': 'Ò', 'U': 'Ù'},
+	"^": {'a': 'â', 'e': 'ê', 'i': 'î', 'o': 'ô', 'u': 'û', 'A': 'Â', 'E': 'Ê', 'I': 'Î', 'O': 'Ô', 'U': 'Û'},
+	"~": {'a': 'ã', 'n': 'ñ', 'o': 'õ', 'A': 'Ã', 'N': 'Ñ', 'O': 'Õ'},
+	"c": {'c': 'ç', 's': 'ş', 'C': 'Ç', 'S': 'Ş'},
+	"v": {'c': 'č', 's': 'š', 'z': 'ž', 'r': 'ř', 'e': 'ě', 'C': 'Č', 'S': 'Š', 'Z': 'Ž', 'R': 'Ř'},
+}
+
+var latexSymbols = map[string]string{
+	"ss": "ß", "ae": "æ", "AE": "Æ", "oe": "œ", "OE": "Œ", "o": "ø", "O": "Ø",
+	"aa": "å", "AA": "Å", "l": "ł", "L": "Ł", "i": "ı",
+	"&": "&", "%": "%", "_": "_", "$": "$", "#": "#", "{": "{", "}": "}", " ": " ",
+}
+
+// latexToText converts a raw BibTeX value to plain text: common accent and
+// symbol commands are decoded, other commands are removed while keeping their
+// arguments, and braces are dropped.
+func latexToText(s string) string {
+	runes := []rune(s)
+	var sb strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch r {
+		case '{', '}':
+			continue
+		case '~':
+			sb.WriteRune(' ')
+			continue
+		case '\\':
+		default:
+			sb.WriteRune(r)
+			continue
+		}
+		if i+1 >= len(runes) {
+			break
+		}
+		// read command name
+		j := i + 1
+		var cmd string
+		if unicode.IsLetter(runes[j]) {
+			for j < len(runes) && unicode.IsLetter(runes[j]) {
+				j++
+			}
+			cmd = string(runes[i+1 : j])
+		} else {
+			cmd = string(runes[j])
+			j++
+		}
+		if table, ok := latexAccents[cmd]; ok {
+			k := j
+			for k < len(runes) && runes[k] == ' ' {
+				k++
+			}
+			braced := k < len(runes) && runes[k] == '{'
+			if braced {
+				k++
+			}
+			if k < len(runes) && runes[k] == '\\' && k+1 < len(runes) && runes[k+1] == 'i' {
+				k++ // dotless i
+			}
+			if k < len(runes) {
+				base := runes[k]
+				if acc, ok := table[base]; ok {
+					sb.WriteRune(acc)
+				} else {
+					sb.WriteRune(base)
+				}
+				k++
+				if braced && k < len(runes) && runes[k] == '}' {
+					k++
+				}
+				i = k - 1
+				continue
+			}
+		}
+		if sym, ok := latexSymbols[cmd]; ok {
+			sb.WriteString(sym)
+		}
+		i = j - 1
+		// skip a single space terminating a letter command
+		if unicode.IsLetter([]rune(cmd)[0]) && i+1 < len(runes) && runes[i+1] == ' ' {
+			i++
+		}
+	}
+	text := sb.String()
+	text = strings.ReplaceAll(text, "---", "—")
+	text = strings.ReplaceAll(text, "--", "–")
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,294 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+var cslTypes = map[string]string{
+	"article":                "preprint",
+	"article-journal":        "journalArticle",
+	"article-magazine":       "magazineArticle",
+	"article-newspaper":      "newspaperArticle",
+	"book":                   "book",
+	"chapter":                "bookSection",
+	"paper-conference":       "conferencePaper",
+	"thesis":                 "thesis",
+	"report":                 "report",
+	"manuscript":             "manuscript",
+	"document":               "document",
+	"webpage":                "webpage",
+	"post-weblog":            "blogPost",
+	"post":                   "forumPost",
+	"motion_picture":         "film",
+	"broadcast":              "tvBroadcast",
+	"song":                   "audioRecording",
+	"map":                    "map",
+	"patent":                 "patent",
+	"graphic":                "artwork",
+	"dataset":                "dataset",
+	"software":               "computerProgram",
+	"legal_case":             "case",
+	"legislation":            "statute",
+	"bill":                   "bill",
+	"hearing":                "hearing",
+	"personal_communication": "letter",
+	"interview":              "interview",
+	"entry-encyclopedia":     "encyclopediaArticle",
+	"entry-dictionary":       "dictionaryEntry",
+	"speech":                 "presentation",
+	"standard":               "standard",
+}
+
+var cslFields = map[string][]string{
+	"title":                  {"title"},
+	"title-short":            {"shortTitle"},
+	"shortTitle":             {"shortTitle"},
+	"container-title":        {"publicationTitle"},
+	"container-title-short":  {"journalAbbreviation"},
+	"journalAbbreviation":    {"journalAbbreviation"},
+	"collection-title":       {"series", "seriesTitle"},
+	"abstract":               {"abstractNote"},
+	"publisher":              {"publisher"},
+	"publisher-place":        {"place"},
+	"event-place":            {"place"},
+	"event":                  {"conferenceName", "meetingName"},
+	"event-title":            {"conferenceName", "meetingName"},
+	"volume":                 {"volume"},
+	"issue":                  {"issue"},
+	"number":                 {"number", "issue"},
+	"page":                   {"pages"},
+	"number-of-pages":        {"numPages"},
+	"edition":                {"edition"},
+	"ISBN":                   {"ISBN"},
+	"ISSN":                   {"ISSN"},
+	"DOI":                    {"DOI"},
+	"URL":                    {"url"},
+	"language":               {"language"},
+	"medium":                 {"medium"},
+	"genre":                  {"type"},
+	"archive":                {"archive"},
+	"archive_location":       {"archiveLocation"},
+	"call-number":            {"callNumber"},
+	"source":                 {"libraryCatalog"},
+	"note":                   {"extra"},
+	"dimensions":             {"runningTime", "artworkSize", "extra"},
+	"scale":                  {"scale"},
+	"version":                {"versionNumber"},
+	"references":             {"history", "extra"},
+	"section":                {"section"},
+	"authority":              {"authority", "court"},
+	"number-of-volumes":      {"numberOfVolumes"},
+	"collection-number":      {"seriesNumber"},
+	"original-title":         {"extra"},
+	"status":                 {"extra"},
+	"citation-label":         {"extra"},
+	"citation-key":           {"citationKey"},
+	"PMID":                   {"extra"},
+	"PMCID":                  {"extra"},
+	"title-translated":       {"extra"},
+	"container-title-suffix": {"extra"},
+}
+
+var cslCreators = map[string]string{
+	"author":            "author",
+	"editor":            "editor",
+	"translator":        "translator",
+	"container-author":  "bookAuthor",
+	"collection-editor": "seriesEditor",
+	"director":          "director",
+	"interviewer":       "interviewer",
+	"recipient":         "recipient",
+	"reviewed-author":   "reviewedAuthor",
+	"composer":          "composer",
+	"illustrator":       "illustrator",
+	"contributor":       "contributor",
+}
+
+var cslDates = map[string]string{
+	"issued":   "date",
+	"accessed": "accessDate",
+}
+
+// ParseCSLJSON reads CSL-JSON as an array of items or a single item object.
+// The item id is used as source identifier.
+func ParseCSLJSON(r io.Reader) ([]*Record, []Diagnostic, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot read csl-json data")
+	}
+	data = bytes.TrimSpace(data)
+	var entries []map[string]any
+	if len(data) > 0 && data[0] == '{' {
+		var entry map[string]any
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, nil, errors.Wrap(err, "cannot unmarshal csl-json object")
+		}
+		entries = append(entries, entry)
+	} else {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, nil, errors.Wrap(err, "cannot unmarshal csl-json array")
+		}
+	}
+	var records []*Record
+	var diags []Diagnostic
+	for i, entry := range entries {
+		rec, d := cslRecord(i+1, entry)
+		diags = append(diags, d...)
+		if rec != nil {
+			records = append(records, rec)
+		}
+	}
+	return records, diags, nil
+}
+
+func cslRecord(entry int, data map[string]any) (*Record, []Diagnostic) {
+	var sourceId string
+	switch id := data["id"].(type) {
+	case string:
+		sourceId = strings.TrimSpace(id)
+	case float64:
+		sourceId = fmt.Sprintf("%v", id)
+	}
+	kind, _ := data["type"].(string)
+	itemType, ok := cslTypes[kind]
+	if !ok {
+		itemType = "document"
+	}
+	b := newEntryBuilder(entry, 0, sourceId, itemType)
+	if !ok {
+		b.warnf("unknown csl type %q imported as %q", kind, itemType)
+	}
+	// sorted keys keep diagnostics and field precedence reproducible
+	for _, key := range slices.Sorted(maps.Keys(data)) {
+		value := data[key]
+		switch key {
+		case "id", "type":
+			continue
+		case "keyword":
+			if s, ok := value.(string); ok {
+				for _, kw := range strings.Split(s, ",") {
+					b.addTag(kw)
+				}
+			}
+			continue
+		}
+		if ct, ok := cslCreators[key]; ok {
+			names, ok := value.([]any)
+			if !ok {
+				b.warnf("creator field %q is not a list", key)
+				continue
+			}
+			for _, n := range names {
+				name, ok := n.(map[string]any)
+				if !ok {
+					b.warnf("invalid name in %q", key)
+					continue
+				}
+				b.addCreator(ct, cslName(name))
+			}
+			continue
+		}
+		if field, ok := cslDates[key]; ok {
+			d, ok := value.(map[string]any)
+			if !ok {
+				b.warnf("date field %q is not an object", key)
+				continue
+			}
+			b.set(cslDate(d), field)
+			continue
+		}
+		fields, ok := cslFields[key]
+		if !ok {
+			b.warnf("unsupported csl field %q dropped", key)
+			continue
+		}
+		var str string
+		switch v := value.(type) {
+		case string:
+			str = v
+		case float64:
+			str = fmt.Sprintf("%v", v)
+		default:
+			b.warnf("field %q has unsupported value type %T", key, value)
+			continue
+		}
+		if key != "note" && len(fields) == 1 && fields[0] == "extra" {
+			// keep unmapped csl variables in Zotero's "key: value" extra syntax
+			b.set(key+": "+str, "extra")
+			continue
+		}
+		b.set(str, fields...)
+	}
+	return b.finish()
+}
+
+func cslName(n map[string]any) (p model.ItemDataPerson) {
+	str := func(key string) string {
+		s, _ := n[key].(string)
+		return strings.TrimSpace(s)
+	}
+	if literal := str("literal"); literal != "" {
+		p.Name = literal
+		return p
+	}
+	family := str("family")
+	if particle := str("non-dropping-particle"); particle != "" {
+		family = particle + " " + family
+	}
+	given := str("given")
+	if particle := str("dropping-particle"); particle != "" {
+		given = strings.TrimSpace(given + " " + particle)
+	}
+	if suffix := str("suffix"); suffix != "" {
+		given = strings.TrimSpace(given + ", " + suffix)
+	}
+	if family == "" {
+		p.Name = given
+		return p
+	}
+	p.LastName = family
+	p.FirstName = given
+	return p
+}
+
+// cslDate accepts date-parts, raw and literal dates.
+func cslDate(d map[string]any) string {
+	if parts, ok := d["date-parts"].([]any); ok && len(parts) > 0 {
+		if first, ok := parts[0].([]any); ok && len(first) > 0 {
+			num := func(i int) int {
+				if i >= len(first) {
+					return 0
+				}
+				switch v := first[i].(type) {
+				case float64:
+					return int(v)
+				case string:
+					var n int
+					fmt.Sscanf(v, "%d", &n)
+					return n
+				}
+				return 0
+			}
+			year := num(0)
+			if year != 0 {
+				return joinDate(fmt.Sprintf("%d", year), num(1), num(2))
+			}
+		}
+	}
+	if raw, ok := d["raw"].(string); ok {
+		return raw
+	}
+	if literal, ok := d["literal"].(string); ok {
+		return literal
+	}
+	return ""
+}
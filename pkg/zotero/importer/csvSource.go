@@ -0,0 +1,83 @@
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"emperror.dev/errors"
+)
+
+// CSVSource reads rows from CSV data with a header line. Column names are
+// taken from the header; the row number passed to Iterate is the line of the
+// record in the file, as a spreadsheet would show it.
+type CSVSource struct {
+	r     io.Reader
+	comma rune
+}
+
+// NewCSVSource creates a CSV source. An empty delimiter defaults to ",".
+func NewCSVSource(r io.Reader, delimiter string) (*CSVSource, error) {
+	comma := ','
+	if delimiter != "" {
+		if delimiter == `\t` {
+			delimiter = "\t"
+		}
+		var size int
+		comma, size = utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) {
+			return nil, errors.Errorf("invalid csv delimiter %q", delimiter)
+		}
+	}
+	return &CSVSource{
+		r:     r,
+		comma: comma,
+	}, nil
+}
+
+func (src *CSVSource) Iterate(ctx context.Context, f func(rowNum int, row Row) error) error {
+	reader := csv.NewReader(src.r)
+	reader.Comma = src.comma
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return errors.Wrap(err, "cannot read csv header")
+	}
+	for i, name := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF"))
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "cannot read csv record")
+		}
+		line, _ := reader.FieldPos(0)
+		empty := true
+		row := make(Row, len(header))
+		for i, name := range header {
+			if i < len(record) {
+				row[name] = record[i]
+				if strings.TrimSpace(record[i]) != "" {
+					empty = false
+				}
+			}
+		}
+		if empty {
+			continue
+		}
+		if err := f(line, row); err != nil {
+			return err
+		}
+	}
+}
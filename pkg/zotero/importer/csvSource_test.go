@@ -0,0 +1,114 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const testCSVMapping = `
+group = 1
+
+[source]
+type = "csv"
+delimiter = ";"
+
+[item]
+id = "{{.Signatur}}"
+itemtype = "{{default \"book\" .Typ}}"
+
+[item.fields]
+title = "{{.Titel}}"
+date = "{{.Jahr}}"
+publisher = "{{.Verlag}}"
+
+[[item.creator]]
+type = "author"
+value = "{{index . \"Autor/innen\"}}"
+separator = "|"
+
+[[item.tag]]
+value = "{{.Schlagworte}}"
+separator = ","
+`
+
+func TestCSVImport(t *testing.T) {
+	data := "\uFEFFSignatur;Typ;Titel;Jahr;Verlag;Autor/innen;Schlagworte\n" +
+		"A1;;Ein Buch;2001;Verlag;Muster, Hans|Beispiel, Anna;Kunst, Design\n" +
+		";;;;;;\n" +
+		"A2;film;Ein Film;2002;Verlag;Regie, Rita;\n" +
+		"A3;journalArticle;\"Mehrzeiliger\nTitel\";2003;;Autor, Alex;\n"
+	src, err := NewCSVSource(strings.NewReader(data), ";")
+	if err != nil {
+		t.Fatalf("NewCSVSource failed: %v", err)
+	}
+	imp, err := NewMappingImporter(nil, loadTestMapping(t, testCSVMapping), true, nil)
+	if err != nil {
+		t.Fatalf("NewMappingImporter failed: %v", err)
+	}
+	results, diags, err := imp.Run(context.Background(), src)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, empty row skipped, got %d", len(results))
+	}
+	if results[0].Row != 2 || results[0].Error != "" {
+		t.Errorf("unexpected first result %+v", results[0])
+	}
+	// film has no author creator type; publisher maps to distributor
+	if results[1].Row != 4 || results[1].Error != "" {
+		t.Errorf("unexpected second result %+v", results[1])
+	}
+	warnings := 0
+	for _, d := range diags {
+		if d.Entry == 4 && d.Severity == Severity_Warning {
+			warnings++
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("expected 1 warning for row 4, got %v", diags)
+	}
+	if results[2].Row != 5 {
+		t.Errorf("expected multi-line record to report its start line, got %+v", results[2])
+	}
+
+	rows := map[int]Row{}
+	src, _ = NewCSVSource(strings.NewReader(data), ";")
+	if err := src.Iterate(context.Background(), func(rowNum int, row Row) error {
+		rows[rowNum] = row
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	rec, _, d := imp.renderItem(2, rows[2])
+	if rec == nil {
+		t.Fatalf("renderItem failed: %v", d)
+	}
+	if len(rec.Item.Creators) != 2 || rec.Item.Creators[1].LastName != "Beispiel" {
+		t.Errorf("unexpected creators %+v", rec.Item.Creators)
+	}
+	if len(rec.Item.Tags) != 2 || rec.Item.Tags[1].Tag != "Design" {
+		t.Errorf("unexpected tags %+v", rec.Item.Tags)
+	}
+}
+
+func TestCSVDelimiter(t *testing.T) {
+	if _, err := NewCSVSource(strings.NewReader(""), ";;"); err == nil {
+		t.Error("expected error for multi-character delimiter")
+	}
+	src, err := NewCSVSource(strings.NewReader("a\tb\n1\t2\n"), `\t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Row
+	if err := src.Iterate(context.Background(), func(rowNum int, row Row) error {
+		got = row
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got["b"] != "2" {
+		t.Errorf("unexpected row %v", got)
+	}
+}
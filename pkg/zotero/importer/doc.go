@@ -0,0 +1,4 @@
+// Package importer converts bibliographic exchange formats and mapped tabular
+// sources into validated Zotero items and writes them to storage with stable
+// source identifiers.
+package importer
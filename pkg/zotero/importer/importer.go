@@ -0,0 +1,194 @@
+package importer
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+type Format string
+
+const (
+	FormatBibTeX  Format = "bibtex"
+	FormatRIS     Format = "ris"
+	FormatCSLJSON Format = "csljson"
+)
+
+// FormatFromFilename guesses the format from the file extension.
+func FormatFromFilename(name string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".bib", ".bibtex":
+		return FormatBibTeX, true
+	case ".ris":
+		return FormatRIS, true
+	case ".json", ".csl", ".csljson":
+		return FormatCSLJSON, true
+	}
+	return "", false
+}
+
+// Parse reads r in the given format.
+func Parse(format Format, r io.Reader) ([]*Record, []Diagnostic, error) {
+	switch format {
+	case FormatBibTeX:
+		return ParseBibTeX(r)
+	case FormatRIS:
+		return ParseRIS(r)
+	case FormatCSLJSON:
+		return ParseCSLJSON(r)
+	}
+	return nil, nil, errors.Errorf("unknown import format %q", format)
+}
+
+// Result is the outcome of writing one record.
+type Result struct {
+	Row      int    `json:"row,omitempty"`
+	SourceId string `json:"sourceId"`
+	Key      string `json:"key,omitempty"`
+	Updated  bool   `json:"updated"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Importer writes parsed records into a group. Records are stored with
+// Prefix+SourceId as oldid, so importing the same source again updates the
+// items created by the previous run instead of duplicating them.
+type Importer struct {
+	Storage storage.Store
+	Prefix  string
+	Logger  zLogger.ZLogger
+}
+
+func NewImporter(storage storage.Store, prefix string, logger zLogger.ZLogger) *Importer {
+	return &Importer{
+		Storage: storage,
+		Prefix:  prefix,
+		Logger:  logger,
+	}
+}
+
+// Import stores records in group groupId. A failing record does not stop the
+// import; its error is returned in the corresponding Result. The returned error
+// is only set if the context is cancelled.
+func (imp *Importer) Import(ctx context.Context, groupId int64, records []*Record) ([]Result, error) {
+	results := make([]Result, 0, len(records))
+	for _, rec := range records {
+		if err := ctx.Err(); err != nil {
+			return results, errors.Wrap(err, "import cancelled")
+		}
+		result := Result{SourceId: rec.SourceId}
+		item, updated, err := upsertItem(ctx, imp.Storage, groupId, imp.Prefix+rec.SourceId, &rec.Item)
+		if err != nil {
+			result.Error = err.Error()
+			if imp.Logger != nil {
+				imp.Logger.Error().Err(err).Msgf("cannot import %s", rec.SourceId)
+			}
+		} else {
+			result.Key = item.Key
+			result.Updated = updated
+			if imp.Logger != nil {
+				imp.Logger.Debug().Msgf("imported %s as %s (updated: %v)", rec.SourceId, item.Key, result.Updated)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ErrItemRemoved is returned for records whose item has been deleted or moved
+// to the trash since the previous import. Such items are not restored.
+var ErrItemRemoved = errors.New("item has been removed")
+
+// upsertItem creates the item with the given oldid or merges data into the
+// item previously imported under this oldid. Updated items are marked as
+// modified so that the syncer uploads them. Items deleted or moved to the
+// trash since the last import are not changed; the merged data must be
+// valid.
+func upsertItem(ctx context.Context, st storage.Store, groupId int64, oldId string, data *model.ItemGeneric) (*model.Item, bool, error) {
+	item, err := st.GetItemByOldid(ctx, groupId, oldId)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "cannot load item by oldid %s", oldId)
+	}
+	if item == nil {
+		item, err = st.CreateItem(ctx, groupId, data, &model.ItemMeta{}, oldId)
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "cannot create item %s", oldId)
+		}
+		return item, false, nil
+	}
+	switch {
+	case item.Deleted:
+		return nil, false, errors.Wrapf(ErrItemRemoved, "item %s of %s has been deleted", item.Key, oldId)
+	case item.Trashed:
+		return nil, false, errors.Wrapf(ErrItemRemoved, "item %s of %s is in the trash", item.Key, oldId)
+	}
+	mergeItemData(&item.Data, data)
+	if err := model.ValidateItem(&item.Data); err != nil {
+		return nil, false, errors.Wrapf(err, "invalid item %s after merge", item.Key)
+	}
+	item.Status = model.SyncStatus_Modified
+	if err := st.UpdateItem(ctx, groupId, item); err != nil {
+		return nil, false, errors.Wrapf(err, "cannot update item %s", item.Key)
+	}
+	return item, true, nil
+}
+
+// mergeItemData copies the fields set by the import from src to dst. Empty
+// fields keep the stored value; tags, collections and relations added since
+// the last import, e.g. in Zotero, are kept.
+func mergeItemData(dst, src *model.ItemGeneric) {
+	for _, field := range []struct{ dst, src *string }{
+		{&dst.ItemType, &src.ItemType},
+		{&dst.ParentItem, &src.ParentItem},
+		{&dst.Title, &src.Title},
+		{&dst.AbstractNote, &src.AbstractNote},
+		{&dst.Date, &src.Date},
+		{&dst.Url, &src.Url},
+		{&dst.Extra, &src.Extra},
+		{&dst.ShortTitle, &src.ShortTitle},
+		{&dst.LinkMode, &src.LinkMode},
+		{&dst.Note, &src.Note},
+		{&dst.ContentType, &src.ContentType},
+		{&dst.Charset, &src.Charset},
+		{&dst.Filename, &src.Filename},
+	} {
+		if *field.src != "" {
+			*field.dst = *field.src
+		}
+	}
+	if len(src.Creators) > 0 {
+		dst.Creators = src.Creators
+	}
+	for name, value := range src.ExtraFields {
+		if dst.ExtraFields == nil {
+			dst.ExtraFields = map[string]string{}
+		}
+		dst.ExtraFields[name] = value
+	}
+	for _, tag := range src.Tags {
+		if !slices.ContainsFunc(dst.Tags, func(t model.ItemTag) bool { return t.Tag == tag.Tag }) {
+			dst.Tags = append(dst.Tags, tag)
+		}
+	}
+	for _, coll := range src.Collections {
+		if !slices.Contains(dst.Collections, coll) {
+			dst.Collections = append(dst.Collections, coll)
+		}
+	}
+	for predicate, objects := range src.Relations {
+		if dst.Relations == nil {
+			dst.Relations = model.Relations{}
+		}
+		for _, object := range objects {
+			if !slices.Contains(dst.Relations[predicate], object) {
+				dst.Relations[predicate] = append(dst.Relations[predicate], object)
+			}
+		}
+	}
+}
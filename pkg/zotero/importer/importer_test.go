@@ -0,0 +1,352 @@
+package importer_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/je4/zsync/v2/pkg/zotero/importer"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/memory"
+)
+
+func field(t *testing.T, item *model.ItemGeneric, name string) string {
+	t.Helper()
+	v, _ := item.Get(name)
+	return v
+}
+
+func TestParseBibTeX(t *testing.T) {
+	src := `
+@string{jcl = "Journal of Computational Linguistics"}
+@comment{ignored}
+@article{smith2020,
+  author  = {Smith, John and van der Berg, Anna and {ACME Corporation}},
+  title   = {On the {T}heory of Caf{\'e}s},
+  journal = jcl # " Letters",
+  year    = 2020,
+  month   = mar,
+  pages   = {10--20},
+  doi     = {10.1000/xyz},
+  keywords = {alpha, beta},
+  foo     = {unknown},
+}
+@incollection{doe1999,
+  author    = "Jane Doe",
+  editor    = "Max Mustermann",
+  title     = "A Chapter",
+  booktitle = "Collected Works",
+  publisher = "Press",
+  year      = "1999"
+}
+@phdthesis{roe2001,
+  author = {Roe, Richard},
+  title  = {Dissertation},
+  school = {University of Basel},
+  year   = {2001}
+}
+`
+	records, diags, err := importer.ParseBibTeX(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseBibTeX failed: %v", err)
+	}
+	if importer.HasErrors(diags) {
+		t.Fatalf("unexpected errors: %v", diags)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+
+	art := records[0]
+	if art.SourceId != "smith2020" {
+		t.Errorf("expected source id smith2020, got %q", art.SourceId)
+	}
+	if art.Item.ItemType != "journalArticle" {
+		t.Errorf("expected journalArticle, got %q", art.Item.ItemType)
+	}
+	if got := field(t, &art.Item, "title"); got != "On the Theory of Cafés" {
+		t.Errorf("unexpected title %q", got)
+	}
+	if got := field(t, &art.Item, "publicationTitle"); got != "Journal of Computational Linguistics Letters" {
+		t.Errorf("unexpected publicationTitle %q", got)
+	}
+	if got := field(t, &art.Item, "date"); got != "2020-03" {
+		t.Errorf("unexpected date %q", got)
+	}
+	if got := field(t, &art.Item, "pages"); got != "10-20" {
+		t.Errorf("unexpected pages %q", got)
+	}
+	if len(art.Item.Creators) != 3 {
+		t.Fatalf("expected 3 creators, got %d", len(art.Item.Creators))
+	}
+	if c := art.Item.Creators[1]; c.LastName != "van der Berg" || c.FirstName != "Anna" {
+		t.Errorf("unexpected creator %+v", c)
+	}
+	if c := art.Item.Creators[2]; c.Name != "ACME Corporation" {
+		t.Errorf("expected corporate creator, got %+v", c)
+	}
+	if len(art.Item.Tags) != 2 {
+		t.Errorf("expected 2 tags, got %v", art.Item.Tags)
+	}
+	found := false
+	for _, d := range diags {
+		if d.SourceId == "smith2020" && d.Severity == importer.Severity_Warning && strings.Contains(d.Message, "foo") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected warning for unsupported field, got %v", diags)
+	}
+
+	sec := records[1]
+	if sec.Item.ItemType != "bookSection" {
+		t.Errorf("expected bookSection, got %q", sec.Item.ItemType)
+	}
+	if got := field(t, &sec.Item, "bookTitle"); got != "Collected Works" {
+		t.Errorf("expected booktitle mapped to bookTitle, got %q", got)
+	}
+	if len(sec.Item.Creators) != 2 || sec.Item.Creators[1].CreatorType != "editor" {
+		t.Errorf("unexpected creators %+v", sec.Item.Creators)
+	}
+
+	thesis := records[2]
+	if got := field(t, &thesis.Item, "university"); got != "University of Basel" {
+		t.Errorf("expected school mapped to university, got %q", got)
+	}
+}
+
+func TestParseBibTeXSyntaxError(t *testing.T) {
+	src := `
+@article{broken,
+  title = {Unclosed
+@book{ok,
+  title = {Fine},
+  year = 2000
+}
+`
+	records, diags, err := importer.ParseBibTeX(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseBibTeX failed: %v", err)
+	}
+	if !importer.HasErrors(diags) {
+		t.Fatal("expected error diagnostic for broken entry")
+	}
+	if len(records) != 1 || records[0].SourceId != "ok" {
+		t.Fatalf("expected parser to recover with entry ok, got %d records", len(records))
+	}
+}
+
+func TestParseRIS(t *testing.T) {
+	src := `TY  - JOUR
+ID  - r1
+AU  - Smith, John
+AU  - Doe, Jane
+TI  - A Study
+  of Things
+T2  - Journal of Things
+PY  - 2019/05/17/
+SP  - 5
+EP  - 9
+SN  - 1234-5678
+KW  - things
+ER  -
+
+TY  - BOOK
+AU  - Roe, Richard
+TI  - The Book
+PB  - Publisher
+SN  - 978-3-16-148410-0
+ER  -
+`
+	records, diags, err := importer.ParseRIS(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseRIS failed: %v", err)
+	}
+	if importer.HasErrors(diags) {
+		t.Fatalf("unexpected errors: %v", diags)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	art := records[0]
+	if art.SourceId != "r1" || art.Item.ItemType != "journalArticle" {
+		t.Errorf("unexpected record %q/%q", art.SourceId, art.Item.ItemType)
+	}
+	if got := field(t, &art.Item, "title"); got != "A Study of Things" {
+		t.Errorf("unexpected title %q", got)
+	}
+	if got := field(t, &art.Item, "date"); got != "2019-05-17" {
+		t.Errorf("unexpected date %q", got)
+	}
+	if got := field(t, &art.Item, "pages"); got != "5-9" {
+		t.Errorf("unexpected pages %q", got)
+	}
+	if got := field(t, &art.Item, "ISSN"); got != "1234-5678" {
+		t.Errorf("unexpected ISSN %q", got)
+	}
+	book := records[1]
+	if !strings.HasPrefix(book.SourceId, "sha1:") {
+		t.Errorf("expected derived source id, got %q", book.SourceId)
+	}
+	if got := field(t, &book.Item, "ISBN"); got != "978-3-16-148410-0" {
+		t.Errorf("unexpected ISBN %q", got)
+	}
+}
+
+func TestParseCSLJSON(t *testing.T) {
+	src := `[
+  {
+    "id": "c1",
+    "type": "article-journal",
+    "title": "Networks",
+    "container-title": "Science",
+    "author": [{"family": "Beethoven", "given": "Ludwig", "non-dropping-particle": "van"}, {"literal": "WHO"}],
+    "issued": {"date-parts": [[2021, 7]]},
+    "DOI": "10.1/abc",
+    "PMID": "12345",
+    "keyword": "a, b"
+  },
+  {
+    "type": "book",
+    "title": "No id"
+  }
+]`
+	records, diags, err := importer.ParseCSLJSON(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseCSLJSON failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	if !importer.HasErrors(diags) {
+		t.Error("expected error for entry without id")
+	}
+	rec := records[0]
+	if rec.Item.ItemType != "journalArticle" {
+		t.Errorf("unexpected item type %q", rec.Item.ItemType)
+	}
+	if got := field(t, &rec.Item, "date"); got != "2021-07" {
+		t.Errorf("unexpected date %q", got)
+	}
+	if got := field(t, &rec.Item, "extra"); got != "PMID: 12345" {
+		t.Errorf("unexpected extra %q", got)
+	}
+	if len(rec.Item.Creators) != 2 || rec.Item.Creators[0].LastName != "van Beethoven" || rec.Item.Creators[1].Name != "WHO" {
+		t.Errorf("unexpected creators %+v", rec.Item.Creators)
+	}
+	if len(rec.Item.Tags) != 2 {
+		t.Errorf("unexpected tags %v", rec.Item.Tags)
+	}
+}
+
+func TestFormatFromFilename(t *testing.T) {
+	for name, want := range map[string]importer.Format{
+		"refs.bib":   importer.FormatBibTeX,
+		"export.RIS": importer.FormatRIS,
+		"items.json": importer.FormatCSLJSON,
+	} {
+		got, ok := importer.FormatFromFilename(name)
+		if !ok || got != want {
+			t.Errorf("FormatFromFilename(%q) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+	if _, ok := importer.FormatFromFilename("data.txt"); ok {
+		t.Error("expected unknown extension to be rejected")
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	st := memory.NewStore(false, nil)
+	imp := importer.NewImporter(st, "bib:", nil)
+	parse := func(title string) []*importer.Record {
+		records, diags, err := importer.ParseBibTeX(strings.NewReader(`@book{key1, title = {` + title + `}, year = {2001}}`))
+		if err != nil || importer.HasErrors(diags) {
+			t.Fatalf("ParseBibTeX: %v, %v", err, diags)
+		}
+		return records
+	}
+
+	results, err := imp.Import(ctx, 1, parse("First"))
+	if err != nil || len(results) != 1 || results[0].Error != "" || results[0].Updated {
+		t.Fatalf("Import: %v, %v", results, err)
+	}
+	key := results[0].Key
+
+	// collections and tags added in Zotero survive the next import
+	item, err := st.GetItemByOldid(ctx, 1, "bib:key1")
+	if err != nil || item == nil {
+		t.Fatalf("GetItemByOldid: %v, %v", item, err)
+	}
+	item.Data.Collections = append(item.Data.Collections, "COLL0001")
+	item.Data.Tags = append(item.Data.Tags, model.ItemTag{Tag: "reviewed"})
+	if err := st.UpdateItem(ctx, 1, item); err != nil {
+		t.Fatalf("UpdateItem: %v", err)
+	}
+
+	// importing the same source again updates the item
+	results, err = imp.Import(ctx, 1, parse("Second"))
+	if err != nil || len(results) != 1 || results[0].Key != key || !results[0].Updated {
+		t.Fatalf("re-Import: %v, %v", results, err)
+	}
+	item, err = st.GetItemByOldid(ctx, 1, "bib:key1")
+	if err != nil || item == nil {
+		t.Fatalf("GetItemByOldid: %v, %v", item, err)
+	}
+	if item.Key != key || item.Data.Title != "Second" || item.Status != model.SyncStatus_Modified {
+		t.Errorf("unexpected item %s %q (%v)", item.Key, item.Data.Title, item.Status)
+	}
+	if item.Data.Date != "2001" || !slices.Contains(item.Data.Collections, "COLL0001") || !slices.ContainsFunc(item.Data.Tags, func(tag model.ItemTag) bool { return tag.Tag == "reviewed" }) {
+		t.Errorf("re-import lost data: date %q, collections %v, tags %v", item.Data.Date, item.Data.Collections, item.Data.Tags)
+	}
+}
+
+func TestImportRefused(t *testing.T) {
+	ctx := context.Background()
+	st := memory.NewStore(false, nil)
+	imp := importer.NewImporter(st, "bib:", nil)
+	parse := func(src string) []*importer.Record {
+		records, diags, err := importer.ParseBibTeX(strings.NewReader(src))
+		if err != nil || importer.HasErrors(diags) {
+			t.Fatalf("ParseBibTeX: %v, %v", err, diags)
+		}
+		return records
+	}
+
+	results, err := imp.Import(ctx, 1, parse(`@book{key1, title = {First}, edition = {2}}
+@book{key2, title = {Trashed}}`))
+	if err != nil || len(results) != 2 || results[0].Error != "" || results[1].Error != "" {
+		t.Fatalf("Import: %v, %v", results, err)
+	}
+	item, err := st.GetItemByOldid(ctx, 1, "bib:key2")
+	if err != nil || item == nil {
+		t.Fatalf("GetItemByOldid: %v, %v", item, err)
+	}
+	item.Trashed = true
+	if err := st.UpdateItem(ctx, 1, item); err != nil {
+		t.Fatalf("UpdateItem: %v", err)
+	}
+
+	// the edition of the book is not a field of a journal article and the
+	// trashed item is not restored
+	results, err = imp.Import(ctx, 1, parse(`@article{key1, title = {Second}}
+@book{key2, title = {Restored}}`))
+	if err != nil || len(results) != 2 {
+		t.Fatalf("re-Import: %v, %v", results, err)
+	}
+	for _, result := range results {
+		if result.Error == "" || result.Updated {
+			t.Errorf("expected re-import of %s to fail, got %+v", result.SourceId, result)
+		}
+	}
+	for oldId, title := range map[string]string{"bib:key1": "First", "bib:key2": "Trashed"} {
+		item, err := st.GetItemByOldid(ctx, 1, oldId)
+		if err != nil || item == nil {
+			t.Fatalf("GetItemByOldid: %v, %v", item, err)
+		}
+		if item.Data.Title != title {
+			t.Errorf("item %s changed to %q", oldId, item.Data.Title)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/BurntSushi/toml"
+	"github.com/je4/utils/v2/pkg/config"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// Mapping describes how the rows of a tabular source become Zotero items.
+// All string values except the source settings are text/template expressions
+// evaluated against the row, e.g. "{{.Titel}}" or
+// "{{printf \"%s - %s\" .Titel1 .Titel2}}".
+type Mapping struct {
+	Group       int64               `toml:"group"`
+	Prefix      string              `toml:"prefix"`
+	Source      SourceConfig        `toml:"source"`
+	Item        ItemMapping         `toml:"item"`
+	Notes       []NoteMapping       `toml:"note"`
+	Attachments []AttachmentMapping `toml:"attachment"`
+}
+
+// SourceConfig selects the rows to import. Type "sql" uses Driver, DSN and
+// Query; type "csv" reads File (or standard input) split at Delimiter.
+type SourceConfig struct {
+	Type      string           `toml:"type"`
+	Driver    string           `toml:"driver"`
+	DSN       config.EnvString `toml:"dsn"`
+	Query     string           `toml:"query"`
+	File      string           `toml:"file"`
+	Delimiter string           `toml:"delimiter"`
+}
+
+type ItemMapping struct {
+	Id          string              `toml:"id"`
+	ItemType    string              `toml:"itemtype"`
+	Fields      map[string]string   `toml:"fields"`
+	Creators    []CreatorMapping    `toml:"creator"`
+	Tags        []ListMapping       `toml:"tag"`
+	Collections []CollectionMapping `toml:"collection"`
+}
+
+// CreatorMapping produces creators of one type. The rendered value is split
+// at Separator; Format "name" stores each part as single-field name, the
+// default splits "Last, First" and "First Last".
+type CreatorMapping struct {
+	Type      string `toml:"type"`
+	Value     string `toml:"value"`
+	Separator string `toml:"separator"`
+	Format    string `toml:"format"`
+}
+
+// ListMapping renders Value and splits it at Separator.
+type ListMapping struct {
+	Value     string `toml:"value"`
+	Separator string `toml:"separator"`
+}
+
+// CollectionMapping renders a collection path. Empty levels are skipped.
+// If Separator is set, the last level is split and the item is added to one
+// collection per part.
+type CollectionMapping struct {
+	Path      []string `toml:"path"`
+	Separator string   `toml:"separator"`
+}
+
+type NoteMapping struct {
+	Id   string `toml:"id"`
+	Note string `toml:"note"`
+}
+
+// AttachmentMapping creates linked URL attachments. Without Query one
+// attachment is created per row; with Query the statement is run with the
+// rendered Params and one attachment is created per result row. Columns of the
+// result row are available next to the columns of the parent row.
+type AttachmentMapping struct {
+	Id          string   `toml:"id"`
+	Title       string   `toml:"title"`
+	Url         string   `toml:"url"`
+	Note        string   `toml:"note"`
+	ContentType string   `toml:"contenttype"`
+	Query       string   `toml:"query"`
+	Params      []string `toml:"params"`
+}
+
+// LoadMapping reads a mapping file.
+func LoadMapping(filename string) (*Mapping, error) {
+	var m Mapping
+	if _, err := toml.DecodeFile(filename, &m); err != nil {
+		return nil, errors.Wrapf(err, "cannot decode mapping %s", filename)
+	}
+	return &m, nil
+}
+
+// Row is one source record, column name to value.
+type Row map[string]string
+
+var templateFuncs = template.FuncMap{
+	"trim":    strings.TrimSpace,
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"split":   strings.Split,
+	"join":    func(sep string, s []string) string { return strings.Join(s, sep) },
+	"default": func(def, s string) string {
+		if strings.TrimSpace(s) == "" {
+			return def
+		}
+		return s
+	},
+	"int": func(s string) int64 {
+		i, _ := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		return i
+	},
+	"div": func(a, b int64) int64 {
+		if b == 0 {
+			return 0
+		}
+		return a / b
+	},
+	"mod": func(a, b int64) int64 {
+		if b == 0 {
+			return 0
+		}
+		return a % b
+	},
+	// duration formats a number of seconds as h:mm:ss
+	"duration": func(s string) string {
+		sec, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil || sec <= 0 {
+			return ""
+		}
+		return model.FmtDuration(time.Duration(sec) * time.Second)
+	},
+	// nl2br escapes s and converts line breaks for Zotero's HTML notes
+	"nl2br": func(s string) string {
+		return strings.ReplaceAll(html.EscapeString(s), "\n", "<br />\n")
+	},
+}
+
+// expr is a compiled mapping expression. The zero value renders as "".
+type expr struct {
+	tpl *template.Template
+}
+
+func compileExpr(name, text string) (expr, error) {
+	if text == "" {
+		return expr{}, nil
+	}
+	tpl, err := template.New(name).Option("missingkey=zero").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return expr{}, errors.Wrapf(err, "cannot parse expression %s", name)
+	}
+	return expr{tpl: tpl}, nil
+}
+
+func (e expr) render(row Row) (string, error) {
+	if e.tpl == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := e.tpl.Execute(&buf, row); err != nil {
+		return "", errors.Wrapf(err, "cannot evaluate expression %s", e.tpl.Name())
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+type compiledCreator struct {
+	creatorType string
+	value       expr
+	separator   string
+	format      string
+}
+
+type compiledList struct {
+	value     expr
+	separator string
+}
+
+type compiledCollection struct {
+	path      []expr
+	separator string
+}
+
+type compiledNote struct {
+	id   expr
+	note expr
+}
+
+type compiledAttachment struct {
+	id, title, url, note, contentType expr
+	query                             string
+	params                            []expr
+}
+
+type compiledMapping struct {
+	id          expr
+	itemType    expr
+	fieldNames  []string
+	fields      map[string]expr
+	creators    []compiledCreator
+	tags        []compiledList
+	collections []compiledCollection
+	notes       []compiledNote
+	attachments []compiledAttachment
+}
+
+// compile parses all expressions so that template errors surface before the
+// first row is read.
+func (m *Mapping) compile() (*compiledMapping, error) {
+	if m.Item.Id == "" {
+		return nil, errors.New("mapping has no item id expression")
+	}
+	if m.Item.ItemType == "" {
+		return nil, errors.New("mapping has no item type expression")
+	}
+	var err error
+	cm := &compiledMapping{fields: map[string]expr{}}
+	if cm.id, err = compileExpr("item.id", m.Item.Id); err != nil {
+		return nil, err
+	}
+	if cm.itemType, err = compileExpr("item.itemtype", m.Item.ItemType); err != nil {
+		return nil, err
+	}
+	if err := m.checkSchema(); err != nil {
+		return nil, err
+	}
+	cm.fieldNames = slices.Sorted(maps.Keys(m.Item.Fields))
+	for _, name := range cm.fieldNames {
+		if cm.fields[name], err = compileExpr("item.fields."+name, m.Item.Fields[name]); err != nil {
+			return nil, err
+		}
+	}
+	for i, c := range m.Item.Creators {
+		if c.Type == "" {
+			return nil, errors.Errorf("creator #%d has no type", i)
+		}
+		cc := compiledCreator{creatorType: c.Type, separator: c.Separator, format: c.Format}
+		if cc.value, err = compileExpr(fmt.Sprintf("item.creator[%d]", i), c.Value); err != nil {
+			return nil, err
+		}
+		cm.creators = append(cm.creators, cc)
+	}
+	for i, t := range m.Item.Tags {
+		cl := compiledList{separator: t.Separator}
+		if cl.value, err = compileExpr(fmt.Sprintf("item.tag[%d]", i), t.Value); err != nil {
+			return nil, err
+		}
+		cm.tags = append(cm.tags, cl)
+	}
+	for i, c := range m.Item.Collections {
+		cc := compiledCollection{separator: c.Separator}
+		for j, level := range c.Path {
+			e, err := compileExpr(fmt.Sprintf("item.collection[%d].path[%d]", i, j), level)
+			if err != nil {
+				return nil, err
+			}
+			cc.path = append(cc.path, e)
+		}
+		cm.collections = append(cm.collections, cc)
+	}
+	for i, n := range m.Notes {
+		if n.Id == "" {
+			return nil, errors.Errorf("note #%d has no id expression", i)
+		}
+		var cn compiledNote
+		if cn.id, err = compileExpr(fmt.Sprintf("note[%d].id", i), n.Id); err != nil {
+			return nil, err
+		}
+		if cn.note, err = compileExpr(fmt.Sprintf("note[%d].note", i), n.Note); err != nil {
+			return nil, err
+		}
+		cm.notes = append(cm.notes, cn)
+	}
+	for i, a := range m.Attachments {
+		if a.Id == "" {
+			return nil, errors.Errorf("attachment #%d has no id expression", i)
+		}
+		if a.Url == "" {
+			return nil, errors.Errorf("attachment #%d has no url expression", i)
+		}
+		ca := compiledAttachment{query: a.Query}
+		for name, e := range map[string]struct {
+			text   string
+			target *expr
+		}{
+			"id":          {a.Id, &ca.id},
+			"title":       {a.Title, &ca.title},
+			"url":         {a.Url, &ca.url},
+			"note":        {a.Note, &ca.note},
+			"contenttype": {a.ContentType, &ca.contentType},
+		} {
+			if *e.target, err = compileExpr(fmt.Sprintf("attachment[%d].%s", i, name), e.text); err != nil {
+				return nil, err
+			}
+		}
+		for j, p := range a.Params {
+			e, err := compileExpr(fmt.Sprintf("attachment[%d].params[%d]", i, j), p)
+			if err != nil {
+				return nil, err
+			}
+			ca.params = append(ca.params, e)
+		}
+		cm.attachments = append(cm.attachments, ca)
+	}
+	return cm, nil
+}
+
+// checkSchema verifies field names and creator types against the schema if
+// the item type is a constant. Item types computed per row are checked when
+// the row is validated.
+func (m *Mapping) checkSchema() error {
+	itemType := strings.TrimSpace(m.Item.ItemType)
+	if strings.Contains(itemType, "{{") {
+		return nil
+	}
+	if !model.IsValidItemType(itemType) {
+		return errors.Errorf("invalid item type %q", itemType)
+	}
+	var problems []string
+	for _, name := range slices.Sorted(maps.Keys(m.Item.Fields)) {
+		if _, ok := resolveField(itemType, name); !ok {
+			problems = append(problems, fmt.Sprintf("field %q", name))
+		}
+	}
+	for _, c := range m.Item.Creators {
+		if c.Type != "" && !model.IsValidCreatorType(itemType, c.Type) {
+			problems = append(problems, fmt.Sprintf("creator type %q (valid: %s)", c.Type, strings.Join(model.GetValidCreatorTypes(itemType), ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.Errorf("mapping does not match item type %q: invalid %s; valid fields: %s",
+			itemType, strings.Join(problems, ", "), strings.Join(model.GetValidFields(itemType), ", "))
+	}
+	return nil
+}
+
+// splitList splits s at sep and drops empty parts. An empty sep returns s as
+// single element.
+func splitList(s, sep string) []string {
+	var parts []string
+	if sep == "" {
+		parts = []string{s}
+	} else {
+		parts = strings.Split(s, sep)
+	}
+	var result []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
@@ -0,0 +1,374 @@
+package importer
+
+import (
+	"context"
+	"maps"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+// MappingImporter imports the rows of a Source according to a Mapping. Items
+// are stored with Mapping.Prefix plus the rendered id as oldid; existing items
+// are found with GetItemByOldid and updated in place.
+type MappingImporter struct {
+	Storage storage.Store
+	Mapping *Mapping
+	DryRun  bool
+	// CheckFirst validates all rows before the first write. If any row has
+	// an error, nothing is written.
+	CheckFirst bool
+	Logger     zLogger.ZLogger
+
+	compiled    *compiledMapping
+	collections map[string]string
+}
+
+// NewMappingImporter compiles the expressions of mapping. With dryRun set rows
+// are rendered and validated, but nothing is written and storage may be nil.
+func NewMappingImporter(storage storage.Store, mapping *Mapping, dryRun bool, logger zLogger.ZLogger) (*MappingImporter, error) {
+	compiled, err := mapping.compile()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot compile mapping")
+	}
+	if storage == nil && !dryRun {
+		return nil, errors.New("no storage given")
+	}
+	return &MappingImporter{
+		Storage:     storage,
+		Mapping:     mapping,
+		DryRun:      dryRun,
+		Logger:      logger,
+		compiled:    compiled,
+		collections: map[string]string{},
+	}, nil
+}
+
+// Run imports all rows of src into the mapping's group. Problems with single
+// rows are reported as diagnostics and do not stop the import; the returned
+// error is reserved for source and context failures.
+func (mi *MappingImporter) Run(ctx context.Context, src Source) ([]Result, []Diagnostic, error) {
+	if mi.CheckFirst && !mi.DryRun {
+		return mi.runChecked(ctx, src)
+	}
+	var results []Result
+	var diags []Diagnostic
+	err := src.Iterate(ctx, func(rowNum int, row Row) error {
+		if err := ctx.Err(); err != nil {
+			return errors.Wrap(err, "import cancelled")
+		}
+		result, d := mi.importRow(ctx, src, rowNum, row, mi.DryRun)
+		results = append(results, result)
+		diags = append(diags, d...)
+		return nil
+	})
+	if err != nil {
+		return results, diags, errors.Wrap(err, "cannot read source")
+	}
+	return results, diags, nil
+}
+
+// runChecked reads all rows, validates them in dry-run mode and writes them
+// only if no row produced an error.
+func (mi *MappingImporter) runChecked(ctx context.Context, src Source) ([]Result, []Diagnostic, error) {
+	type numberedRow struct {
+		num int
+		row Row
+	}
+	var rows []numberedRow
+	var results []Result
+	var diags []Diagnostic
+	err := src.Iterate(ctx, func(rowNum int, row Row) error {
+		rows = append(rows, numberedRow{num: rowNum, row: row})
+		result, d := mi.importRow(ctx, src, rowNum, row, true)
+		results = append(results, result)
+		diags = append(diags, d...)
+		return nil
+	})
+	if err != nil {
+		return results, diags, errors.Wrap(err, "cannot read source")
+	}
+	if HasErrors(diags) {
+		if mi.Logger != nil {
+			mi.Logger.Warn().Msg("validation failed, nothing written")
+		}
+		return results, diags, nil
+	}
+	results = results[:0]
+	diags = diags[:0]
+	for _, r := range rows {
+		if err := ctx.Err(); err != nil {
+			return results, diags, errors.Wrap(err, "import cancelled")
+		}
+		result, d := mi.importRow(ctx, src, r.num, r.row, false)
+		results = append(results, result)
+		diags = append(diags, d...)
+	}
+	return results, diags, nil
+}
+
+func (mi *MappingImporter) importRow(ctx context.Context, src Source, rowNum int, row Row, dryRun bool) (Result, []Diagnostic) {
+	result := Result{Row: rowNum}
+	rec, paths, diags := mi.renderItem(rowNum, row)
+	if rec == nil {
+		result.Error = "invalid item"
+		for _, d := range diags {
+			if d.Severity == Severity_Error {
+				result.SourceId = d.SourceId
+				result.Error = d.Message
+				break
+			}
+		}
+		return result, diags
+	}
+	sourceId := rec.SourceId
+	result.SourceId = sourceId
+	fail := func(err error) (Result, []Diagnostic) {
+		result.Error = err.Error()
+		return result, append(diags, Diagnostic{Entry: rowNum, SourceId: sourceId, Severity: Severity_Error, Message: err.Error()})
+	}
+	if dryRun {
+		_, d := mi.children(ctx, src, rowNum, row, "")
+		result.Error = childError(d)
+		return result, append(diags, d...)
+	}
+
+	for _, path := range paths {
+		key, err := mi.ensureCollectionPath(ctx, path)
+		if err != nil {
+			return fail(err)
+		}
+		rec.Item.Collections = model.AppendIfMissing(rec.Item.Collections, key)
+	}
+	item, updated, err := upsertItem(ctx, mi.Storage, mi.Mapping.Group, mi.Mapping.Prefix+sourceId, &rec.Item)
+	if err != nil {
+		return fail(err)
+	}
+	result.Key = item.Key
+	result.Updated = updated
+	if mi.Logger != nil {
+		mi.Logger.Debug().Msgf("row %d: imported %s as %s (updated: %v)", rowNum, sourceId, item.Key, updated)
+	}
+	_, d := mi.children(ctx, src, rowNum, row, item.Key)
+	result.Error = childError(d)
+	return result, append(diags, d...)
+}
+
+// childError is the result error of a row whose item has been written but
+// whose notes or attachments failed, empty if there is none.
+func childError(diags []Diagnostic) string {
+	for _, d := range diags {
+		if d.Severity == Severity_Error {
+			if d.SourceId == "" {
+				return "child: " + d.Message
+			}
+			return "child " + d.SourceId + ": " + d.Message
+		}
+	}
+	return ""
+}
+
+// renderItem evaluates the item expressions for row. It returns the record
+// (nil on errors) and the collection paths the item belongs to.
+func (mi *MappingImporter) renderItem(rowNum int, row Row) (*Record, [][]string, []Diagnostic) {
+	cm := mi.compiled
+	fail := func(sourceId string, err error) (*Record, [][]string, []Diagnostic) {
+		return nil, nil, []Diagnostic{{Entry: rowNum, SourceId: sourceId, Severity: Severity_Error, Message: err.Error()}}
+	}
+	sourceId, err := cm.id.render(row)
+	if err != nil {
+		return fail("", err)
+	}
+	itemType, err := cm.itemType.render(row)
+	if err != nil {
+		return fail(sourceId, err)
+	}
+	b := newEntryBuilder(rowNum, 0, sourceId, itemType)
+	for _, name := range cm.fieldNames {
+		value, err := cm.fields[name].render(row)
+		if err != nil {
+			b.errorf("%v", err)
+			continue
+		}
+		b.set(value, name)
+	}
+	for _, c := range cm.creators {
+		value, err := c.value.render(row)
+		if err != nil {
+			b.errorf("%v", err)
+			continue
+		}
+		for _, name := range splitList(value, c.separator) {
+			if c.format == "name" {
+				b.addCreator(c.creatorType, model.ItemDataPerson{Name: name})
+			} else {
+				b.addCreator(c.creatorType, splitName(name))
+			}
+		}
+	}
+	for _, t := range cm.tags {
+		value, err := t.value.render(row)
+		if err != nil {
+			b.errorf("%v", err)
+			continue
+		}
+		for _, tag := range splitList(value, t.separator) {
+			b.addTag(tag)
+		}
+	}
+	var paths [][]string
+	for _, c := range cm.collections {
+		var path []string
+		for _, level := range c.path {
+			name, err := level.render(row)
+			if err != nil {
+				b.errorf("%v", err)
+				continue
+			}
+			if name != "" {
+				path = append(path, name)
+			}
+		}
+		if len(path) == 0 {
+			continue
+		}
+		if c.separator == "" {
+			paths = append(paths, path)
+			continue
+		}
+		for _, leaf := range splitList(path[len(path)-1], c.separator) {
+			paths = append(paths, append(append([]string{}, path[:len(path)-1]...), leaf))
+		}
+	}
+	rec, diags := b.finish()
+	if rec == nil {
+		return nil, nil, diags
+	}
+	return rec, paths, diags
+}
+
+// children writes the notes and attachments of the item parentKey. With an
+// empty parentKey (dry run) they are only rendered and validated.
+func (mi *MappingImporter) children(ctx context.Context, src Source, rowNum int, row Row, parentKey string) ([]*Record, []Diagnostic) {
+	var records []*Record
+	var diags []Diagnostic
+	errorf := func(sourceId string, err error) {
+		diags = append(diags, Diagnostic{Entry: rowNum, SourceId: sourceId, Severity: Severity_Error, Message: err.Error()})
+	}
+	for _, n := range mi.compiled.notes {
+		id, err := n.id.render(row)
+		if err != nil {
+			errorf("", err)
+			continue
+		}
+		note, err := n.note.render(row)
+		if err != nil {
+			errorf(id, err)
+			continue
+		}
+		if note == "" {
+			continue
+		}
+		b := newEntryBuilder(rowNum, 0, id, "note")
+		b.rec.Item.Note = note
+		b.rec.Item.ParentItem = parentKey
+		rec, d := b.finish()
+		diags = append(diags, d...)
+		if rec != nil {
+			records = append(records, rec)
+		}
+	}
+	for _, a := range mi.compiled.attachments {
+		rows := []Row{row}
+		if a.query != "" {
+			querier, ok := src.(Querier)
+			if !ok {
+				errorf("", errors.New("attachment query needs a source that supports queries"))
+				continue
+			}
+			args := make([]any, 0, len(a.params))
+			var paramErr error
+			for _, p := range a.params {
+				v, err := p.render(row)
+				if err != nil {
+					paramErr = err
+					break
+				}
+				args = append(args, v)
+			}
+			if paramErr != nil {
+				errorf("", paramErr)
+				continue
+			}
+			rows = nil
+			if err := querier.QueryRows(ctx, a.query, args, func(sub Row) error {
+				merged := maps.Clone(row)
+				maps.Copy(merged, sub)
+				rows = append(rows, merged)
+				return nil
+			}); err != nil {
+				errorf("", err)
+				continue
+			}
+		}
+		for _, r := range rows {
+			rec, d := renderAttachment(a, rowNum, r, parentKey)
+			diags = append(diags, d...)
+			if rec != nil {
+				records = append(records, rec)
+			}
+		}
+	}
+	if parentKey == "" {
+		return records, diags
+	}
+	for _, rec := range records {
+		if _, _, err := upsertItem(ctx, mi.Storage, mi.Mapping.Group, mi.Mapping.Prefix+rec.SourceId, &rec.Item); err != nil {
+			errorf(rec.SourceId, err)
+		}
+	}
+	return records, diags
+}
+
+func renderAttachment(a compiledAttachment, rowNum int, row Row, parentKey string) (*Record, []Diagnostic) {
+	values := map[string]string{}
+	for name, e := range map[string]expr{"id": a.id, "title": a.title, "url": a.url, "note": a.note, "contentType": a.contentType} {
+		v, err := e.render(row)
+		if err != nil {
+			return nil, []Diagnostic{{Entry: rowNum, Severity: Severity_Error, Message: err.Error()}}
+		}
+		values[name] = v
+	}
+	if values["url"] == "" {
+		return nil, nil
+	}
+	b := newEntryBuilder(rowNum, 0, values["id"], "attachment")
+	b.rec.Item.LinkMode = "linked_url"
+	b.rec.Item.ParentItem = parentKey
+	b.rec.Item.Url = values["url"]
+	b.rec.Item.Title = values["title"]
+	b.rec.Item.Note = values["note"]
+	b.rec.Item.ContentType = values["contentType"]
+	if b.rec.Item.Title == "" {
+		b.rec.Item.Title = b.rec.Item.Url
+	}
+	return b.finish()
+}
+
+// ensureCollectionPath returns the key of the collection at path and creates
+// missing levels. Keys are cached for the lifetime of the importer.
+func (mi *MappingImporter) ensureCollectionPath(ctx context.Context, path []string) (string, error) {
+	cacheKey := strings.Join(path, "\x00")
+	if key, ok := mi.collections[cacheKey]; ok {
+		return key, nil
+	}
+	key, err := mi.Storage.EnsureCollectionPath(ctx, mi.Mapping.Group, path)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot ensure collection path %s", strings.Join(path, "/"))
+	}
+	mi.collections[cacheKey] = key
+	return key, nil
+}
@@ -0,0 +1,225 @@
+package importer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/je4/zsync/v2/pkg/zotero/storage/memory"
+)
+
+type testSource struct {
+	rows []Row
+	sub  []Row
+	args [][]any
+}
+
+func (src *testSource) Iterate(ctx context.Context, f func(rowNum int, row Row) error) error {
+	for i, row := range src.rows {
+		if err := f(i+1, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (src *testSource) QueryRows(ctx context.Context, query string, args []any, f func(row Row) error) error {
+	src.args = append(src.args, args)
+	for _, row := range src.sub {
+		if err := f(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const testMapping = `
+group = 42
+prefix = "films:"
+
+[source]
+type = "sql"
+query = "SELECT * FROM films"
+
+[item]
+id = "{{.nr}}"
+itemtype = "film"
+
+[item.fields]
+title = "{{.titel1}}{{if and .titel1 .titel2}} - {{end}}{{.titel2}}"
+runningTime = "{{duration .sekunden}}"
+
+[[item.creator]]
+type = "director"
+value = "{{.regie}}"
+separator = ";"
+
+[[item.creator]]
+type = "contributor"
+value = "{{.firma}}"
+format = "name"
+
+[[item.tag]]
+value = "{{.kategorie}}"
+separator = ";"
+
+[[item.collection]]
+path = ["Filme", "{{.kategorie}}"]
+separator = ";"
+
+[[note]]
+id = "{{.nr}}.tech"
+note = "{{nl2br .technik}}"
+
+[[attachment]]
+id = "{{.nr}}-{{.masterid}}"
+title = "{{.signature}}"
+url = "https://media.example.org/{{.signature}}"
+query = "SELECT * FROM master WHERE signature LIKE ?"
+params = ["{{$n := int .nr}}{{printf \"%02d_%02d%%\" (div $n 100) (mod $n 100)}}"]
+`
+
+func loadTestMapping(t *testing.T, text string) *Mapping {
+	t.Helper()
+	fn := filepath.Join(t.TempDir(), "mapping.toml")
+	if err := os.WriteFile(fn, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadMapping(fn)
+	if err != nil {
+		t.Fatalf("LoadMapping failed: %v", err)
+	}
+	return m
+}
+
+func TestMappingRender(t *testing.T) {
+	m := loadTestMapping(t, testMapping)
+	if m.Group != 42 || m.Prefix != "films:" {
+		t.Fatalf("unexpected mapping header %d/%q", m.Group, m.Prefix)
+	}
+	imp, err := NewMappingImporter(nil, m, true, nil)
+	if err != nil {
+		t.Fatalf("NewMappingImporter failed: %v", err)
+	}
+	row := Row{
+		"nr":        "1234",
+		"titel1":    "Titel",
+		"titel2":    "Untertitel",
+		"sekunden":  "3725",
+		"regie":     "Muster, Hans; Anna Beispiel",
+		"firma":     "ACME Film AG",
+		"kategorie": "Dokumentar; Kurzfilm",
+		"technik":   "16mm\nsw & Ton",
+	}
+	src := &testSource{
+		rows: []Row{row, {"nr": "", "titel1": "no id"}},
+		sub:  []Row{{"masterid": "7", "signature": "12_34_a"}},
+	}
+	results, diags, err := imp.Run(context.Background(), src)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Error != "" || results[0].SourceId != "1234" {
+		t.Errorf("unexpected result %+v", results[0])
+	}
+	if results[1].Error == "" || results[1].Row != 2 {
+		t.Errorf("expected error for row without id, got %+v", results[1])
+	}
+
+	rec, paths, d := imp.renderItem(1, row)
+	if rec == nil {
+		t.Fatalf("renderItem failed: %v", d)
+	}
+	if got := rec.Item.Title; got != "Titel - Untertitel" {
+		t.Errorf("unexpected title %q", got)
+	}
+	if got := rec.Item.GetString("runningTime"); got != "1:02:05" {
+		t.Errorf("unexpected runningTime %q", got)
+	}
+	if len(rec.Item.Creators) != 3 || rec.Item.Creators[0].LastName != "Muster" || rec.Item.Creators[1].LastName != "Beispiel" || rec.Item.Creators[2].Name != "ACME Film AG" {
+		t.Errorf("unexpected creators %+v", rec.Item.Creators)
+	}
+	if len(rec.Item.Tags) != 2 {
+		t.Errorf("unexpected tags %+v", rec.Item.Tags)
+	}
+	if len(paths) != 2 || paths[0][0] != "Filme" || paths[0][1] != "Dokumentar" || paths[1][1] != "Kurzfilm" {
+		t.Errorf("unexpected collection paths %v", paths)
+	}
+	if len(diags) != 1 || diags[0].Entry != 2 {
+		t.Errorf("expected a single diagnostic for row 2, got %v", diags)
+	}
+
+	children, d := imp.children(context.Background(), src, 1, row, "")
+	if HasErrors(d) {
+		t.Fatalf("unexpected child errors: %v", d)
+	}
+	if len(children) != 2 {
+		t.Fatalf("expected note and attachment, got %d children", len(children))
+	}
+	if got := children[0].Item.Note; got != "16mm<br />\nsw &amp; Ton" {
+		t.Errorf("unexpected note %q", got)
+	}
+	att := children[1]
+	if att.SourceId != "1234-7" || att.Item.Url != "https://media.example.org/12_34_a" || att.Item.LinkMode != "linked_url" {
+		t.Errorf("unexpected attachment %s %+v", att.SourceId, att.Item)
+	}
+	if len(src.args) == 0 || src.args[0][0] != "12_34%" {
+		t.Errorf("unexpected query params %v", src.args)
+	}
+}
+
+func TestMappingCompileErrors(t *testing.T) {
+	for name, text := range map[string]string{
+		"no id":       "[item]\nitemtype = \"book\"\n",
+		"bad expr":    "[item]\nid = \"{{.id\"\nitemtype = \"book\"\n",
+		"no url":      "[item]\nid = \"{{.id}}\"\nitemtype = \"book\"\n[[attachment]]\nid = \"x\"\n",
+		"no cr. type": "[item]\nid = \"{{.id}}\"\nitemtype = \"book\"\n[[item.creator]]\nvalue = \"x\"\n",
+		"bad type":    "[item]\nid = \"{{.id}}\"\nitemtype = \"novel\"\n",
+		"bad field":   "[item]\nid = \"{{.id}}\"\nitemtype = \"book\"\n[item.fields]\nrunningTime = \"x\"\n",
+		"bad creator": "[item]\nid = \"{{.id}}\"\nitemtype = \"book\"\n[[item.creator]]\ntype = \"director\"\nvalue = \"x\"\n",
+	} {
+		m := loadTestMapping(t, text)
+		if _, err := NewMappingImporter(nil, m, true, nil); err == nil {
+			t.Errorf("%s: expected compile error", name)
+		}
+	}
+}
+
+func TestMappingChildError(t *testing.T) {
+	ctx := context.Background()
+	st := memory.NewStore(false, nil)
+	imp, err := NewMappingImporter(st, loadTestMapping(t, testMapping), false, nil)
+	if err != nil {
+		t.Fatalf("NewMappingImporter failed: %v", err)
+	}
+	src := &testSource{
+		rows: []Row{{"nr": "1234", "titel1": "Titel", "technik": "16mm"}},
+		sub:  []Row{{"masterid": "7", "signature": "12_34_a"}},
+	}
+	results, _, err := imp.Run(ctx, src)
+	if err != nil || len(results) != 1 || results[0].Error != "" {
+		t.Fatalf("Run: %v, %v", results, err)
+	}
+
+	// the attachment moved to the trash cannot be written again
+	att, err := st.GetItemByOldid(ctx, 42, "films:1234-7")
+	if err != nil || att == nil {
+		t.Fatalf("GetItemByOldid: %v, %v", att, err)
+	}
+	att.Trashed = true
+	if err := st.UpdateItem(ctx, 42, att); err != nil {
+		t.Fatalf("UpdateItem: %v", err)
+	}
+	results, _, err = imp.Run(ctx, src)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("re-Run: %v, %v", results, err)
+	}
+	if !strings.HasPrefix(results[0].Error, "child 1234-7: ") || results[0].Key == "" {
+		t.Errorf("expected child error, got %+v", results[0])
+	}
+}
@@ -0,0 +1,302 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+type Severity int64
+
+const (
+	Severity_Warning Severity = 1 // value dropped or adjusted, record still imported
+	Severity_Error   Severity = 2 // record cannot be imported
+)
+
+var SeverityString = map[Severity]string{
+	Severity_Warning: "warning",
+	Severity_Error:   "error",
+}
+
+func (s Severity) String() string {
+	return SeverityString[s]
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Diagnostic reports a problem with a single source entry.
+type Diagnostic struct {
+	Entry    int      `json:"entry"` // 1-based position of the entry in the source
+	Line     int      `json:"line,omitempty"`
+	SourceId string   `json:"sourceId,omitempty"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	var loc string
+	if d.Line > 0 {
+		loc = fmt.Sprintf("entry %d (line %d)", d.Entry, d.Line)
+	} else {
+		loc = fmt.Sprintf("entry %d", d.Entry)
+	}
+	if d.SourceId != "" {
+		loc += fmt.Sprintf(" [%s]", d.SourceId)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, d.Severity, d.Message)
+}
+
+// HasErrors reports whether diags contains at least one error.
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == Severity_Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Record is one parsed source entry. SourceId is used as the item's oldid so
+// that a re-import updates the existing item.
+type Record struct {
+	SourceId string
+	Line     int
+	Item     model.ItemGeneric
+}
+
+// entryBuilder collects the values of one source entry into an ItemGeneric.
+// Values that do not fit the item type are reported instead of silently
+// producing an item that fails validation.
+type entryBuilder struct {
+	entry int
+	rec   *Record
+	diags []Diagnostic
+}
+
+func newEntryBuilder(entry int, line int, sourceId string, itemType string) *entryBuilder {
+	rec := &Record{
+		SourceId: sourceId,
+		Line:     line,
+	}
+	rec.Item.ItemType = itemType
+	rec.Item.Tags = []model.ItemTag{}
+	rec.Item.Relations = model.Relations{}
+	rec.Item.Collections = []string{}
+	rec.Item.Creators = []model.ItemDataPerson{}
+	return &entryBuilder{
+		entry: entry,
+		rec:   rec,
+	}
+}
+
+func (b *entryBuilder) report(severity Severity, format string, args ...any) {
+	b.diags = append(b.diags, Diagnostic{
+		Entry:    b.entry,
+		Line:     b.rec.Line,
+		SourceId: b.rec.SourceId,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (b *entryBuilder) warnf(format string, args ...any) {
+	b.report(Severity_Warning, format, args...)
+}
+
+func (b *entryBuilder) errorf(format string, args ...any) {
+	b.report(Severity_Error, format, args...)
+}
+
+// resolveField maps field to a field of itemType. Zotero renames some base
+// fields per item type (publicationTitle becomes bookTitle for book sections,
+// publisher becomes university for theses), so the schema's base-field table is
+// consulted when field itself is not valid.
+func resolveField(itemType, field string) (string, bool) {
+	if model.IsValidField(itemType, field) {
+		return field, true
+	}
+	its, ok := model.GetItemTypeSchema(itemType)
+	if !ok {
+		return "", false
+	}
+	for _, f := range its.Fields {
+		if f.BaseField == field {
+			return f.Field, true
+		}
+	}
+	return "", false
+}
+
+// set stores value in the first of fields that the item type supports.
+func (b *entryBuilder) set(value string, fields ...string) {
+	value = strings.TrimSpace(value)
+	if value == "" || len(fields) == 0 {
+		return
+	}
+	for _, field := range fields {
+		target, ok := resolveField(b.rec.Item.ItemType, field)
+		if !ok {
+			continue
+		}
+		if old, found := b.rec.Item.Get(target); found && old != "" {
+			if target == "extra" {
+				b.rec.Item.Set(target, old+"\n"+value)
+				return
+			}
+			if old != value {
+				b.warnf("duplicate value for field %q ignored: %q", target, value)
+			}
+			return
+		}
+		b.rec.Item.Set(target, value)
+		return
+	}
+	b.warnf("field %q is not valid for item type %q; value dropped: %q", fields[0], b.rec.Item.ItemType, value)
+}
+
+// addCreator appends a creator. An unsupported creator type falls back to the
+// item type's primary creator type.
+func (b *entryBuilder) addCreator(creatorType string, person model.ItemDataPerson) {
+	if person.Name == "" && person.LastName == "" && person.FirstName == "" {
+		return
+	}
+	itemType := b.rec.Item.ItemType
+	if !model.IsValidCreatorType(itemType, creatorType) {
+		primary := primaryCreatorType(itemType)
+		if primary == "" {
+			b.warnf("item type %q does not support creators; %q dropped", itemType, personName(person))
+			return
+		}
+		b.warnf("creator type %q is not valid for item type %q; using %q for %q", creatorType, itemType, primary, personName(person))
+		creatorType = primary
+	}
+	person.CreatorType = creatorType
+	b.rec.Item.Creators = append(b.rec.Item.Creators, person)
+}
+
+func (b *entryBuilder) addTag(tag string) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return
+	}
+	for _, t := range b.rec.Item.Tags {
+		if t.Tag == tag {
+			return
+		}
+	}
+	b.rec.Item.Tags = append(b.rec.Item.Tags, model.ItemTag{Tag: tag})
+}
+
+// finish validates the item. The record is nil if the entry produced an error.
+func (b *entryBuilder) finish() (*Record, []Diagnostic) {
+	if b.rec.SourceId == "" {
+		b.errorf("entry has no identifier")
+	}
+	if err := model.ValidateItem(&b.rec.Item); err != nil {
+		b.errorf("invalid item: %v", err)
+	}
+	if HasErrors(b.diags) {
+		return nil, b.diags
+	}
+	return b.rec, b.diags
+}
+
+func primaryCreatorType(itemType string) string {
+	its, ok := model.GetItemTypeSchema(itemType)
+	if !ok {
+		return ""
+	}
+	for _, ct := range its.CreatorTypes {
+		if ct.Primary {
+			return ct.CreatorType
+		}
+	}
+	if len(its.CreatorTypes) > 0 {
+		return its.CreatorTypes[0].CreatorType
+	}
+	return ""
+}
+
+func personName(p model.ItemDataPerson) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return strings.TrimSpace(p.FirstName + " " + p.LastName)
+}
+
+// splitName splits a personal name written as "Last, First" or "First Last".
+func splitName(name string) model.ItemDataPerson {
+	name = strings.Join(strings.Fields(name), " ")
+	if last, first, ok := strings.Cut(name, ","); ok {
+		return model.ItemDataPerson{
+			FirstName: strings.TrimSpace(first),
+			LastName:  strings.TrimSpace(last),
+		}
+	}
+	parts := strings.Fields(name)
+	switch len(parts) {
+	case 0:
+		return model.ItemDataPerson{}
+	case 1:
+		return model.ItemDataPerson{LastName: parts[0]}
+	}
+	// lowercase particles (von, van, de) belong to the last name
+	i := len(parts) - 1
+	for i > 1 && isLowerWord(parts[i-1]) {
+		i--
+	}
+	return model.ItemDataPerson{
+		FirstName: strings.Join(parts[:i], " "),
+		LastName:  strings.Join(parts[i:], " "),
+	}
+}
+
+func isLowerWord(s string) bool {
+	for _, r := range s {
+		return r >= 'a' && r <= 'z'
+	}
+	return false
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+// monthNumber parses a month given as number or (abbreviated) English name.
+func monthNumber(s string) int {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0
+	}
+	var n int
+	if _, err := fmt.Sscanf(s, "%d", &n); err == nil {
+		if n >= 1 && n <= 12 {
+			return n
+		}
+		return 0
+	}
+	if len(s) >= 3 {
+		return monthNames[s[:3]]
+	}
+	return 0
+}
+
+// joinDate builds a Zotero date string from its parts. Missing trailing parts
+// are omitted.
+func joinDate(year string, month, day int) string {
+	year = strings.TrimSpace(year)
+	if year == "" {
+		return ""
+	}
+	if month == 0 {
+		return year
+	}
+	if day == 0 {
+		return fmt.Sprintf("%s-%02d", year, month)
+	}
+	return fmt.Sprintf("%s-%02d-%02d", year, month, day)
+}
@@ -0,0 +1,290 @@
+package importer
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+var risTypes = map[string]string{
+	"JOUR":    "journalArticle",
+	"JFULL":   "journalArticle",
+	"EJOUR":   "journalArticle",
+	"MGZN":    "magazineArticle",
+	"NEWS":    "newspaperArticle",
+	"BOOK":    "book",
+	"EBOOK":   "book",
+	"EDBOOK":  "book",
+	"CHAP":    "bookSection",
+	"ECHAP":   "bookSection",
+	"CONF":    "conferencePaper",
+	"CPAPER":  "conferencePaper",
+	"THES":    "thesis",
+	"RPRT":    "report",
+	"UNPB":    "manuscript",
+	"MANSCPT": "manuscript",
+	"GEN":     "document",
+	"ELEC":    "webpage",
+	"WEB":     "webpage",
+	"BLOG":    "blogPost",
+	"VIDEO":   "videoRecording",
+	"MPCT":    "film",
+	"SOUND":   "audioRecording",
+	"MAP":     "map",
+	"PAT":     "patent",
+	"ART":     "artwork",
+	"DATA":    "dataset",
+	"COMP":    "computerProgram",
+	"CASE":    "case",
+	"STAT":    "statute",
+	"BILL":    "bill",
+	"HEAR":    "hearing",
+	"PCOMM":   "letter",
+	"ENCYC":   "encyclopediaArticle",
+	"DICT":    "dictionaryEntry",
+	"SLIDE":   "presentation",
+	"STAND":   "standard",
+}
+
+var risFields = map[string][]string{
+	"TI": {"title"},
+	"T1": {"title"},
+	"ST": {"shortTitle"},
+	"T2": {"publicationTitle", "series", "seriesTitle"},
+	"JO": {"publicationTitle"},
+	"JF": {"publicationTitle"},
+	"BT": {"publicationTitle", "title"},
+	"JA": {"journalAbbreviation"},
+	"J2": {"journalAbbreviation"},
+	"T3": {"series", "seriesTitle"},
+	"AB": {"abstractNote"},
+	"N2": {"abstractNote"},
+	"VL": {"volume"},
+	"IS": {"issue", "number"},
+	"M1": {"number", "issue"},
+	"PB": {"publisher"},
+	"CY": {"place"},
+	"DO": {"DOI"},
+	"UR": {"url"},
+	"L2": {"url"},
+	"LA": {"language"},
+	"ET": {"edition"},
+	"N1": {"extra"},
+	"M3": {"type", "medium"},
+	"DB": {"libraryCatalog"},
+	"AN": {"callNumber"},
+	"CN": {"callNumber"},
+	"Y2": {"accessDate"},
+}
+
+var risCreators = map[string]string{
+	"AU": "author",
+	"A1": "author",
+	"A2": "editor",
+	"ED": "editor",
+	"A3": "seriesEditor",
+	"A4": "translator",
+}
+
+var risLine = regexp.MustCompile(`^([A-Z][A-Z0-9])  -(?: (.*))?$`)
+var issnPattern = regexp.MustCompile(`^\d{4}-?\d{3}[\dXx]$`)
+
+type risTag struct {
+	tag   string
+	value string
+}
+
+// ParseRIS reads RIS records delimited by TY and ER tags. The ID tag is used as
+// source identifier; records without ID fall back to the DOI or to a hash of
+// their content.
+func ParseRIS(r io.Reader) ([]*Record, []Diagnostic, error) {
+	var records []*Record
+	var diags []Diagnostic
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	lineNo := 0
+	entry := 0
+	start := 0
+	var tags []risTag
+	inRecord := false
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(strings.TrimPrefix(scanner.Text(), "\uFEFF"), "\r ")
+		m := risLine.FindStringSubmatch(line)
+		if m == nil {
+			// continuation of a multi-line value
+			if inRecord && len(tags) > 0 && strings.TrimSpace(line) != "" {
+				tags[len(tags)-1].value += " " + strings.TrimSpace(line)
+			}
+			continue
+		}
+		tag, value := m[1], strings.TrimSpace(m[2])
+		switch tag {
+		case "TY":
+			if inRecord {
+				diags = append(diags, Diagnostic{Entry: entry, Line: start, Severity: Severity_Warning, Message: "record without ER tag"})
+				rec, d := risRecord(entry, start, tags)
+				diags = append(diags, d...)
+				if rec != nil {
+					records = append(records, rec)
+				}
+			}
+			entry++
+			start = lineNo
+			inRecord = true
+			tags = []risTag{{tag: tag, value: value}}
+		case "ER":
+			if !inRecord {
+				continue
+			}
+			rec, d := risRecord(entry, start, tags)
+			diags = append(diags, d...)
+			if rec != nil {
+				records = append(records, rec)
+			}
+			inRecord = false
+			tags = nil
+		default:
+			if inRecord {
+				tags = append(tags, risTag{tag: tag, value: value})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, "cannot read ris data")
+	}
+	if inRecord {
+		diags = append(diags, Diagnostic{Entry: entry, Line: start, Severity: Severity_Warning, Message: "record without ER tag"})
+		rec, d := risRecord(entry, start, tags)
+		diags = append(diags, d...)
+		if rec != nil {
+			records = append(records, rec)
+		}
+	}
+	return records, diags, nil
+}
+
+func risRecord(entry, line int, tags []risTag) (*Record, []Diagnostic) {
+	kind := strings.ToUpper(tags[0].value)
+	itemType, ok := risTypes[kind]
+	if !ok {
+		itemType = "document"
+	}
+	var sourceId, doi string
+	for _, t := range tags {
+		switch t.tag {
+		case "ID":
+			if sourceId == "" {
+				sourceId = t.value
+			}
+		case "DO":
+			if doi == "" {
+				doi = t.value
+			}
+		}
+	}
+	derived := false
+	switch {
+	case sourceId != "":
+	case doi != "":
+		sourceId = "doi:" + strings.ToLower(doi)
+	default:
+		h := sha1.New()
+		for _, t := range tags {
+			fmt.Fprintf(h, "%s\x00%s\x00", t.tag, t.value)
+		}
+		sourceId = "sha1:" + hex.EncodeToString(h.Sum(nil))
+		derived = true
+	}
+
+	b := newEntryBuilder(entry, line, sourceId, itemType)
+	if !ok {
+		b.warnf("unknown record type %q imported as %q", kind, itemType)
+	}
+	if derived {
+		b.warnf("record has neither ID nor DO; source id derived from content, changed records will be imported as new items")
+	}
+	var startPage, endPage string
+	for _, t := range tags[1:] {
+		if t.value == "" {
+			continue
+		}
+		if ct, ok := risCreators[t.tag]; ok {
+			if strings.Contains(t.value, ",") {
+				b.addCreator(ct, splitName(t.value))
+			} else {
+				b.addCreator(ct, splitRISName(t.value))
+			}
+			continue
+		}
+		switch t.tag {
+		case "TY", "ID":
+		case "PY", "Y1", "DA":
+			b.set(risDate(t.value), "date")
+		case "KW":
+			b.addTag(t.value)
+		case "SP":
+			startPage = t.value
+		case "EP":
+			endPage = t.value
+		case "SN":
+			if issnPattern.MatchString(t.value) {
+				b.set(t.value, "ISSN", "ISBN")
+			} else {
+				b.set(t.value, "ISBN", "ISSN")
+			}
+		default:
+			fields, ok := risFields[t.tag]
+			if !ok {
+				b.warnf("unsupported ris tag %q dropped", t.tag)
+				continue
+			}
+			b.set(t.value, fields...)
+		}
+	}
+	pages := startPage
+	if endPage != "" && endPage != startPage {
+		pages = strings.TrimSuffix(startPage+"-"+endPage, "-")
+		pages = strings.TrimPrefix(pages, "-")
+	}
+	if itemType == "book" || itemType == "thesis" || itemType == "manuscript" {
+		b.set(pages, "numPages")
+	} else {
+		b.set(pages, "pages")
+	}
+	return b.finish()
+}
+
+// splitRISName handles RIS names without comma. A single word is treated as a
+// corporate name.
+func splitRISName(name string) (p model.ItemDataPerson) {
+	if len(strings.Fields(name)) == 1 {
+		p.Name = strings.TrimSpace(name)
+		return p
+	}
+	return splitName(name)
+}
+
+// risDate converts "YYYY/MM/DD/other" to a Zotero date.
+func risDate(s string) string {
+	parts := strings.Split(s, "/")
+	year := strings.TrimSpace(parts[0])
+	var month, day int
+	if len(parts) > 1 {
+		month = monthNumber(parts[1])
+	}
+	if len(parts) > 2 && month > 0 {
+		fmt.Sscanf(strings.TrimSpace(parts[2]), "%d", &day)
+	}
+	if day < 0 || day > 31 {
+		day = 0
+	}
+	return joinDate(year, month, day)
+}
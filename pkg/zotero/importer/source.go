@@ -0,0 +1,75 @@
+package importer
+
+import (
+	"context"
+	"database/sql"
+
+	"emperror.dev/errors"
+)
+
+// Source delivers the rows of a mapping import. The row number passed to f is
+// 1-based and used in diagnostics.
+type Source interface {
+	Iterate(ctx context.Context, f func(rowNum int, row Row) error) error
+}
+
+// Querier is implemented by sources that can run the sub-queries of
+// attachment mappings.
+type Querier interface {
+	QueryRows(ctx context.Context, query string, args []any, f func(row Row) error) error
+}
+
+// SQLSource reads rows from a database/sql connection. NULL values become
+// empty strings.
+type SQLSource struct {
+	DB    *sql.DB
+	Query string
+}
+
+func NewSQLSource(db *sql.DB, query string) *SQLSource {
+	return &SQLSource{
+		DB:    db,
+		Query: query,
+	}
+}
+
+func (src *SQLSource) Iterate(ctx context.Context, f func(rowNum int, row Row) error) error {
+	rowNum := 0
+	return src.QueryRows(ctx, src.Query, nil, func(row Row) error {
+		rowNum++
+		return f(rowNum, row)
+	})
+}
+
+func (src *SQLSource) QueryRows(ctx context.Context, query string, args []any, f func(row Row) error) error {
+	rows, err := src.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrapf(err, "cannot execute %s: %v", query, args)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return errors.Wrapf(err, "cannot get columns of %s", query)
+	}
+	values := make([]sql.NullString, len(cols))
+	dest := make([]any, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return errors.Wrapf(err, "cannot scan row of %s", query)
+		}
+		row := make(Row, len(cols))
+		for i, col := range cols {
+			row[col] = values[i].String
+		}
+		if err := f(row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrapf(err, "cannot iterate rows of %s", query)
+	}
+	return nil
+}
@@ -1,5 +1,7 @@
 package model
 
+import "strconv"
+
 type AccessElements struct {
 	Library bool `json:"library,omitempty"`
 	Files   bool `json:"files,omitempty"`
@@ -22,3 +24,24 @@ type LocalAuthResponse struct {
 	Key      string `json:"key"`
 	Remember bool   `json:"remember"`
 }
+
+// CanRead reports whether the access rights allow reading group groupId. As in
+// the Zotero API, the group "all" applies to every group.
+func (a Access) CanRead(groupId int64) bool {
+	elem, ok := a.group(groupId)
+	return ok && (elem.Library || elem.Write)
+}
+
+// CanWrite reports whether the access rights allow modifying group groupId.
+func (a Access) CanWrite(groupId int64) bool {
+	elem, ok := a.group(groupId)
+	return ok && elem.Write
+}
+
+func (a Access) group(groupId int64) (AccessElements, bool) {
+	if elem, ok := a.Groups[strconv.FormatInt(groupId, 10)]; ok {
+		return elem, true
+	}
+	elem, ok := a.Groups["all"]
+	return elem, ok
+}
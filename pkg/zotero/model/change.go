@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// ChangeType is the kind of a Change
+type ChangeType string
+
+const (
+	ChangeType_Create ChangeType = "create"
+	ChangeType_Update ChangeType = "update"
+	ChangeType_Delete ChangeType = "delete"
+)
+
+// Change is an entry of the changes table, which is written by triggers on
+// items and collections. Seq grows monotonically in commit order per library.
+type Change struct {
+	Seq        int64      `json:"seq"`
+	Library    int64      `json:"library"`
+	ObjectType string     `json:"objectType"`
+	Key        string     `json:"key"`
+	Version    int64      `json:"version"`
+	Sync       string     `json:"sync,omitempty"`
+	Type       ChangeType `json:"changeType"`
+	Changed    time.Time  `json:"changed"`
+}
@@ -28,6 +28,12 @@ type Collection struct {
 	Gitlab  *time.Time     `json:"-"`
 }
 
+// CollectionNode is a collection with its subcollections.
+type CollectionNode struct {
+	Collection *Collection       `json:"collection"`
+	Children   []*CollectionNode `json:"children,omitempty"`
+}
+
 type CollectionGitlab struct {
 	LibraryId int64          `json:"libraryid"`
 	Key       string         `json:"key"`
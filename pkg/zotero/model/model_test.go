@@ -563,3 +563,25 @@ func TestItemGenericValidation(t *testing.T) {
 		t.Error("expected invalid creatorType for book to fail validation")
 	}
 }
+
+func TestAccessGroups(t *testing.T) {
+	access := Access{
+		Groups: map[string]AccessElements{
+			"42":  {Library: true, Write: true},
+			"43":  {Library: true},
+			"all": {Library: true},
+		},
+	}
+	if !access.CanRead(42) || !access.CanWrite(42) {
+		t.Error("expected read and write access to group 42")
+	}
+	if !access.CanRead(43) || access.CanWrite(43) {
+		t.Error("expected read-only access to group 43")
+	}
+	if !access.CanRead(99) || access.CanWrite(99) {
+		t.Error("expected read-only access to group 99 via all")
+	}
+	if (Access{}).CanRead(42) {
+		t.Error("expected no access without groups")
+	}
+}
@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// SyncRunStatus is the state of a SyncRun
+type SyncRunStatus string
+
+const (
+	SyncRunStatus_Queued    SyncRunStatus = "queued"
+	SyncRunStatus_Running   SyncRunStatus = "running"
+	SyncRunStatus_Succeeded SyncRunStatus = "succeeded"
+	SyncRunStatus_Failed    SyncRunStatus = "failed"
+)
+
+// Active reports whether the run is queued or running
+func (s SyncRunStatus) Active() bool {
+	return s == SyncRunStatus_Queued || s == SyncRunStatus_Running
+}
+
+// SyncRun is one synchronization of a group, stored in the sync_runs table.
+// Stage and the counters are updated while the run is in progress.
+type SyncRun struct {
+	Id          int64         `json:"id"`
+	GroupId     int64         `json:"groupId"`
+	Status      SyncRunStatus `json:"status"`
+	Trigger     string        `json:"trigger"`
+	RequestedBy string        `json:"requestedBy,omitempty"`
+	Requested   time.Time     `json:"requested"`
+	Started     *time.Time    `json:"started,omitempty"`
+	Finished    *time.Time    `json:"finished,omitempty"`
+	Stage       string        `json:"stage,omitempty"`
+	Collections int64         `json:"collections"`
+	Uploaded    int64         `json:"uploaded"`
+	Downloaded  int64         `json:"downloaded"`
+	Tags        int64         `json:"tags"`
+	Deleted     int64         `json:"deleted"`
+	Error       string        `json:"error,omitempty"`
+}
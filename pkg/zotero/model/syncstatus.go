@@ -22,3 +22,14 @@ var SyncStatusId = map[string]SyncStatus{
 	"modified":   SyncStatus_Modified,
 	"incomplete": SyncStatus_Incomplete,
 }
+
+// ObjectState is the sync state of a stored item or collection without its
+// data. It is also returned for empty objects that are not downloaded yet.
+// Collections are never trashed.
+type ObjectState struct {
+	Key     string     `json:"key"`
+	Version int64      `json:"version"`
+	Status  SyncStatus `json:"status"`
+	Trashed bool       `json:"trashed,omitempty"`
+	Deleted bool       `json:"deleted,omitempty"`
+}
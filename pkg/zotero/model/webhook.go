@@ -0,0 +1,101 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// WebhookEvent is the kind of change a webhook subscribes to
+type WebhookEvent string
+
+const (
+	WebhookEvent_Created    WebhookEvent = "created"
+	WebhookEvent_Updated    WebhookEvent = "updated"
+	WebhookEvent_Deleted    WebhookEvent = "deleted"
+	WebhookEvent_Attachment WebhookEvent = "attachment"
+)
+
+// WebhookEvents lists all webhook events
+var WebhookEvents = []WebhookEvent{
+	WebhookEvent_Created,
+	WebhookEvent_Updated,
+	WebhookEvent_Deleted,
+	WebhookEvent_Attachment,
+}
+
+const (
+	// WebhookSource_Sync is the source of changes of objects in sync with
+	// Zotero, e.g. downloaded by the syncer
+	WebhookSource_Sync = "sync"
+	// WebhookSource_Local is the source of local changes, which have not
+	// been uploaded yet, e.g. of the rest service or an import
+	WebhookSource_Local = "local"
+)
+
+// WebhookSource returns the source of the events of an object with the
+// given sync status
+func WebhookSource(status SyncStatus) string {
+	if status == SyncStatus_Synced {
+		return WebhookSource_Sync
+	}
+	return WebhookSource_Local
+}
+
+// Webhook is a subscription of a url to events of a group, stored in the
+// webhooks table. Secret signs the payloads; it is only shown on creation.
+type Webhook struct {
+	Id      int64          `json:"id"`
+	GroupId int64          `json:"groupId"`
+	Url     string         `json:"url"`
+	Secret  string         `json:"secret,omitempty"`
+	Events  []WebhookEvent `json:"events"`
+	Active  bool           `json:"active"`
+	Created time.Time      `json:"created"`
+}
+
+// Subscribes reports whether the webhook is active and subscribed to event
+func (w *Webhook) Subscribes(event WebhookEvent) bool {
+	return w.Active && slices.Contains(w.Events, event)
+}
+
+// WebhookPayload is the body of a webhook request. Item or Collection is set
+// depending on ObjectType.
+type WebhookPayload struct {
+	Event      WebhookEvent `json:"event"`
+	GroupId    int64        `json:"groupId"`
+	ObjectType string       `json:"objectType"`
+	Key        string       `json:"key"`
+	Version    int64        `json:"version"`
+	// Source is WebhookSource_Sync or WebhookSource_Local
+	Source     string      `json:"source"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Item       *Item       `json:"item,omitempty"`
+	Collection *Collection `json:"collection,omitempty"`
+}
+
+// WebhookDeliveryStatus is the state of a WebhookDelivery
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatus_Pending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatus_Delivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryStatus_Failed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is an entry of the webhook outbox. Url and Secret are
+// copied from the webhook when the delivery is claimed.
+type WebhookDelivery struct {
+	Id             int64                 `json:"id"`
+	WebhookId      int64                 `json:"webhookId"`
+	Event          WebhookEvent          `json:"event"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int64                 `json:"attempts"`
+	NextAttempt    time.Time             `json:"nextAttempt"`
+	ResponseStatus int64                 `json:"responseStatus,omitempty"`
+	LastError      string                `json:"lastError,omitempty"`
+	Created        time.Time             `json:"created"`
+	Delivered      *time.Time            `json:"delivered,omitempty"`
+	Payload        []byte                `json:"-"`
+	Url            string                `json:"-"`
+	Secret         string                `json:"-"`
+}
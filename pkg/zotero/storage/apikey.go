@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json/v2"
+
+	"emperror.dev/errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// HashApiToken returns the hex encoded SHA-256 hash under which token is
+// stored in the apikeys table. Tokens themselves are never stored.
+func HashApiToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetApiKey returns the active local API key for token, or nil if there is
+// none. The access column holds the rights in the Zotero key format, e.g.
+// {"groups": {"all": {"library": true}, "1234": {"library": true, "write": true}}}.
+func (s *Storage) GetApiKey(ctx context.Context, token string) (*model.ApiKey, error) {
+	params := pgx.NamedArgs{
+		"tokenhash": HashApiToken(token),
+	}
+	key := &model.ApiKey{}
+	var username sql.NullString
+	var accessstr sql.NullString
+	if err := s.db.QueryRow(ctx, SQLGetApiKey, params).Scan(&key.UserId, &username, &accessstr); err != nil {
+		if IsEmptyResult(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetApiKey)
+	}
+	key.Username = username.String
+	if accessstr.Valid {
+		if err := json.Unmarshal([]byte(accessstr.String), &key.Access); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal access %s", accessstr.String)
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,52 @@
+package backend
+
+import (
+	"context"
+
+	"emperror.dev/errors"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/sqlite"
+)
+
+// Config is the database part of a command configuration.
+type Config struct {
+	// ServerType is "sqlite" or "postgres"; empty means "postgres"
+	ServerType string
+	// DSN is the SQLite database file or the PostgreSQL connection string
+	DSN string
+	// NewGroupActive is the active state of newly discovered groups
+	NewGroupActive bool
+}
+
+// OpenStore opens the database of cfg. SQLite databases are migrated when
+// opened; PostgreSQL databases must have the current schema. The returned
+// function closes the database.
+func OpenStore(ctx context.Context, cfg Config, logger zLogger.ZLogger) (storage.Store, func(), error) {
+	switch cfg.ServerType {
+	case "sqlite":
+		st, err := sqlite.Open(ctx, cfg.DSN, cfg.NewGroupActive, logger)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "cannot open sqlite database")
+		}
+		return st, func() { st.Close() }, nil
+	case "", "postgres":
+		db, err := pgxpool.New(ctx, cfg.DSN)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error opening database")
+		}
+		if err := db.Ping(ctx); err != nil {
+			db.Close()
+			return nil, nil, errors.Wrap(err, "error pinging database")
+		}
+		st := storage.NewStorage(db, cfg.NewGroupActive, logger)
+		// refuse to work on a database without the current schema
+		if err := st.VerifySchema(ctx); err != nil {
+			db.Close()
+			return nil, nil, errors.Wrap(err, "run \"migrate up\"")
+		}
+		return st, db.Close, nil
+	}
+	return nil, nil, errors.Errorf("unknown database servertype %q", cfg.ServerType)
+}
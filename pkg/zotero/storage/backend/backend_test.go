@@ -0,0 +1,39 @@
+package backend_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/je4/zsync/v2/pkg/zotero/storage/backend"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/sqlite"
+)
+
+func TestOpenStore_SQLite(t *testing.T) {
+	ctx := context.Background()
+	st, closeStore, err := backend.OpenStore(ctx, backend.Config{
+		ServerType:     "sqlite",
+		DSN:            filepath.Join(t.TempDir(), "zotero.db"),
+		NewGroupActive: true,
+	}, nil)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	defer closeStore()
+	if _, ok := st.(*sqlite.Storage); !ok {
+		t.Fatalf("unexpected store %T", st)
+	}
+	active, _, err := st.CreateEmptyGroup(ctx, 4711)
+	if err != nil {
+		t.Fatalf("CreateEmptyGroup: %v", err)
+	}
+	if !active {
+		t.Error("new group is not active")
+	}
+}
+
+func TestOpenStore_UnknownServerType(t *testing.T) {
+	if _, _, err := backend.OpenStore(context.Background(), backend.Config{ServerType: "oracle"}, nil); err == nil {
+		t.Error("expected error for unknown servertype")
+	}
+}
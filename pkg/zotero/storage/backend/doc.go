@@ -0,0 +1,4 @@
+// Package backend opens the storage.Store of a command configuration. It
+// is separate from storage because it imports the sqlite implementation,
+// which in turn imports storage.
+package backend
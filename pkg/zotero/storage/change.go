@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json/v2"
+
+	"emperror.dev/errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// ChangesChannel is the notification channel of the changes triggers
+// (changes.sql).
+const ChangesChannel = "zsync_changes"
+
+// changeNotification is the payload of a notification on ChangesChannel
+type changeNotification struct {
+	Library int64 `json:"library"`
+	Seq     int64 `json:"seq"`
+}
+
+func changeFromRow(row pgx.Row) (*model.Change, error) {
+	change := &model.Change{}
+	var sync sql.NullString
+	var changeType string
+	if err := row.Scan(&change.Seq, &change.Library, &change.ObjectType, &change.Key, &change.Version, &sync, &changeType, &change.Changed); err != nil {
+		return nil, errors.Wrap(err, "cannot scan change")
+	}
+	change.Sync = sync.String
+	change.Type = model.ChangeType(changeType)
+	return change, nil
+}
+
+// GetChanges returns at most limit changes of the group with a sequence
+// number greater than after, oldest first.
+func (s *Storage) GetChanges(ctx context.Context, groupId int64, after int64, limit int64) ([]*model.Change, error) {
+	params := pgx.NamedArgs{
+		"library": groupId,
+		"after":   after,
+		"limit":   limit,
+	}
+	rows, err := s.db.Query(ctx, SQLGetChanges, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetChanges)
+	}
+	defer rows.Close()
+	changes := []*model.Change{}
+	for rows.Next() {
+		change, err := changeFromRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate changes")
+	}
+	return changes, nil
+}
+
+// LatestChangeSeq returns the sequence number of the newest change of the
+// group or 0 if there is none.
+func (s *Storage) LatestChangeSeq(ctx context.Context, groupId int64) (int64, error) {
+	params := pgx.NamedArgs{"library": groupId}
+	var seq int64
+	if err := s.db.QueryRow(ctx, SQLLatestChangeSeq, params).Scan(&seq); err != nil {
+		return 0, errors.Wrapf(err, "cannot execute %s", SQLLatestChangeSeq)
+	}
+	return seq, nil
+}
+
+// ListenChanges listens on ChangesChannel with a dedicated connection and
+// calls fn with library and sequence number of every committed change. It
+// blocks until ctx is done or the connection fails; callers reconnect by
+// calling it again and catch up with GetChanges.
+func (s *Storage) ListenChanges(ctx context.Context, fn func(library int64, seq int64)) error {
+	pooled, err := s.db.Acquire(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot acquire connection")
+	}
+	// the listening connection must not return to the pool
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, SQLListenChanges); err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLListenChanges)
+	}
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.Wrap(err, "cannot wait for notification")
+		}
+		var payload changeNotification
+		if err := json.Unmarshal([]byte(notification.Payload), &payload); err != nil {
+			if s.Logger != nil {
+				s.Logger.Warn().Err(err).Msgf("invalid change notification %q", notification.Payload)
+			}
+			continue
+		}
+		fn(payload.Library, payload.Seq)
+	}
+}
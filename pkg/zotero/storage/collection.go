@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json/v2"
+	"strings"
 	"time"
 
 	"emperror.dev/errors"
@@ -226,6 +227,10 @@ func (s *Storage) UpdateCollection(ctx context.Context, groupId int64, collectio
 	if s.Logger != nil {
 		s.Logger.Info().Msgf("Updating Collection [#%s]", collection.Key)
 	}
+	return updateCollection(ctx, s.db, groupId, collection)
+}
+
+func updateCollection(ctx context.Context, db dbConn, groupId int64, collection *model.Collection) error {
 	data, err := json.Marshal(collection.Data)
 	if err != nil {
 		return errors.Wrapf(err, "cannot marshal data %v", collection.Data)
@@ -243,7 +248,7 @@ func (s *Storage) UpdateCollection(ctx context.Context, groupId int64, collectio
 		"library": groupId,
 		"key":     collection.Key,
 	}
-	_, err = s.db.Exec(ctx, SQLUpdateCollection, params)
+	_, err = db.Exec(ctx, SQLUpdateCollection, params)
 	if err != nil {
 		return errors.Wrapf(err, "cannot execute %s: %v", SQLUpdateCollection, params)
 	}
@@ -384,3 +389,373 @@ func (s *Storage) UpdateCollectionsGitlabTimestamp(ctx context.Context, groupId
 	}
 	return nil
 }
+
+// walkCollectionPath follows path from the top level as far as it exists. It
+// returns the key of the deepest existing level and the number of levels found.
+func walkCollectionPath(ctx context.Context, db dbConn, sqlstr string, groupId int64, path []string) (string, int, error) {
+	parent := ""
+	for i, name := range path {
+		params := pgx.NamedArgs{
+			"library": groupId,
+			"name":    name,
+			"parent":  parent,
+		}
+		var key string
+		if err := db.QueryRow(ctx, sqlstr, params).Scan(&key); err != nil {
+			if IsEmptyResult(err) {
+				return parent, i, nil
+			}
+			return "", 0, errors.Wrapf(err, "cannot execute %s: %v", sqlstr, params)
+		}
+		parent = strings.TrimSpace(key)
+	}
+	return parent, len(path), nil
+}
+
+// EnsureCollectionPath returns the key of the collection at path, e.g.
+// []string{"Videos", "1998", "Class A"}, creating missing levels with
+// SyncStatus_New. Concurrent calls for the same group are serialized with a
+// transaction-scoped advisory lock, so a path is never created twice.
+func (s *Storage) EnsureCollectionPath(ctx context.Context, groupId int64, path []string) (string, error) {
+	if len(path) == 0 {
+		return "", errors.New("empty collection path")
+	}
+	for _, name := range path {
+		if strings.TrimSpace(name) == "" {
+			return "", errors.Errorf("empty collection name in path %v", path)
+		}
+	}
+	key, found, err := walkCollectionPath(ctx, s.db, SQLGetCollectionKeyByNameHier, groupId, path)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot resolve collection path %v", path)
+	}
+	if found == len(path) {
+		return key, nil
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback(ctx)
+	params := pgx.NamedArgs{"library": groupId}
+	if _, err := tx.Exec(ctx, SQLLockCollections, params); err != nil {
+		return "", errors.Wrapf(err, "cannot execute %s: %v", SQLLockCollections, params)
+	}
+	// collection_name_hier may lag behind collections created by concurrent
+	// callers, so the table itself is consulted while holding the lock
+	key, found, err = walkCollectionPath(ctx, tx, SQLGetCollectionKeyByName, groupId, path)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot resolve collection path %v", path)
+	}
+	for _, name := range path[found:] {
+		data := &model.CollectionData{
+			Key:              model.CreateKey(),
+			Name:             name,
+			Relations:        model.RelationList{},
+			ParentCollection: model.Parent(key),
+		}
+		jsonstr, err := json.Marshal(data)
+		if err != nil {
+			return "", errors.Wrapf(err, "cannot marshal collection data %v", data)
+		}
+		params := pgx.NamedArgs{
+			"key":     data.Key,
+			"version": 0,
+			"library": groupId,
+			"sync":    model.SyncStatusString[model.SyncStatus_New],
+			"data":    string(jsonstr),
+		}
+		if _, err := tx.Exec(ctx, SQLInsertCollection, params); err != nil {
+			return "", errors.Wrapf(err, "cannot execute %s: %v", SQLInsertCollection, params)
+		}
+		if s.Logger != nil {
+			s.Logger.Info().Msgf("created collection %s [#%s]", name, data.Key)
+		}
+		key = data.Key
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", errors.Wrap(err, "cannot commit transaction")
+	}
+	if found < len(path) {
+		if err := s.RefreshCollectionNameHier(ctx); err != nil {
+			return "", err
+		}
+	}
+	return key, nil
+}
+
+// GetCollectionTree returns the collection key with all its descendants. With
+// an empty key the trees of all top-level collections are returned. Deleted
+// collections and their subtrees are left out.
+func (s *Storage) GetCollectionTree(ctx context.Context, groupId int64, key string) ([]*model.CollectionNode, error) {
+	sqlstr := SQLGetCollectionTree
+	params := pgx.NamedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	if key == "" {
+		sqlstr = SQLGetCollectionTreeTop
+	}
+	rows, err := s.db.Query(ctx, sqlstr, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", sqlstr, params)
+	}
+	defer rows.Close()
+	// rows are ordered by depth, so parents are always seen before children
+	nodes := map[string]*model.CollectionNode{}
+	roots := []*model.CollectionNode{}
+	for rows.Next() {
+		coll, err := s.collectionFromRow(groupId, rows)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot scan row")
+		}
+		if coll == nil {
+			continue
+		}
+		node := &model.CollectionNode{Collection: coll}
+		nodes[coll.Key] = node
+		if parent, ok := nodes[string(coll.Data.ParentCollection)]; ok && coll.Key != key {
+			parent.Children = append(parent.Children, node)
+			continue
+		}
+		roots = append(roots, node)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "cannot read rows of %s", sqlstr)
+	}
+	return roots, nil
+}
+
+// GetCollectionPath returns the ancestors of the collection key starting at
+// the top level and ending with the collection itself. If the collection does
+// not exist, the result is empty.
+func (s *Storage) GetCollectionPath(ctx context.Context, groupId int64, key string) ([]*model.Collection, error) {
+	return s.collectionPath(ctx, s.db, groupId, key)
+}
+
+func (s *Storage) collectionPath(ctx context.Context, db dbConn, groupId int64, key string) ([]*model.Collection, error) {
+	params := pgx.NamedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	rows, err := db.Query(ctx, SQLGetCollectionPath, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetCollectionPath, params)
+	}
+	defer rows.Close()
+	result := []*model.Collection{}
+	for rows.Next() {
+		coll, err := s.collectionFromRow(groupId, rows)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot scan row")
+		}
+		if coll == nil {
+			continue
+		}
+		result = append(result, coll)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "cannot read rows of %s", SQLGetCollectionPath)
+	}
+	return result, nil
+}
+
+// GetItemsInCollection returns the items of the collection key. With recursive
+// set, items of all descendant collections are included; an item that belongs
+// to several of them is returned once. Trashed and deleted items are skipped.
+func (s *Storage) GetItemsInCollection(ctx context.Context, groupId int64, key string, recursive bool) ([]*model.Item, error) {
+	sqlstr := SQLGetItemsInCollection
+	if recursive {
+		sqlstr = SQLGetItemsInCollectionRecursive
+	}
+	params := pgx.NamedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	rows, err := s.db.Query(ctx, sqlstr, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", sqlstr, params)
+	}
+	defer rows.Close()
+	items := []*model.Item{}
+	for rows.Next() {
+		item, err := s.itemFromRow(groupId, rows)
+		if err != nil {
+			if errors.Is(err, errEmptyItem) {
+				if s.Logger != nil {
+					s.Logger.Warn().Err(err).Msg("item is empty. skipping")
+				}
+				continue
+			}
+			return nil, errors.Wrapf(err, "cannot scan row")
+		}
+		if item == nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "cannot read rows of %s", sqlstr)
+	}
+	return items, nil
+}
+
+var (
+	// ErrCollectionCycle is returned when a collection would become its own
+	// ancestor.
+	ErrCollectionCycle = errors.New("collection cycle")
+	// ErrInvalidParent is returned when a parent collection does not exist or
+	// is deleted.
+	ErrInvalidParent = errors.New("invalid parent collection")
+	// ErrCollectionNotEmpty is returned when a collection with subcollections
+	// is deleted without recursion.
+	ErrCollectionNotEmpty = errors.New("collection has subcollections")
+)
+
+// GetCollectionChildren returns the subcollections of parentKey ordered by
+// name. An empty parentKey returns the top-level collections.
+func (s *Storage) GetCollectionChildren(ctx context.Context, groupId int64, parentKey string) ([]*model.Collection, error) {
+	params := pgx.NamedArgs{
+		"library": groupId,
+		"parent":  parentKey,
+	}
+	rows, err := s.db.Query(ctx, SQLGetCollectionChildren, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetCollectionChildren, params)
+	}
+	defer rows.Close()
+	result := []*model.Collection{}
+	for rows.Next() {
+		coll, err := s.collectionFromRow(groupId, rows)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot scan row")
+		}
+		if coll == nil {
+			continue
+		}
+		result = append(result, coll)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "cannot read rows of %s", SQLGetCollectionChildren)
+	}
+	return result, nil
+}
+
+// ModifyCollection loads the collection key and calls f to change it. If f
+// moves the collection, the new parent must exist and must not be the
+// collection itself or one of its descendants. Collection changes of the
+// group are serialized, so concurrent moves cannot create a cycle. It returns
+// nil if the collection does not exist.
+func (s *Storage) ModifyCollection(ctx context.Context, groupId int64, key string, f func(coll *model.Collection) error) (*model.Collection, error) {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("modifying collection [#%s]", key)
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback(ctx)
+	params := pgx.NamedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	if _, err := tx.Exec(ctx, SQLLockCollections, params); err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLLockCollections, params)
+	}
+	coll, err := s.collectionFromRow(groupId, tx.QueryRow(ctx, SQLGetCollectionByKey, params))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetCollectionByKey, params)
+	}
+	if coll == nil {
+		return nil, nil
+	}
+	oldParent := coll.Data.ParentCollection
+	if err := f(coll); err != nil {
+		return nil, err
+	}
+	if parent := string(coll.Data.ParentCollection); parent != "" && coll.Data.ParentCollection != oldParent {
+		path, err := s.collectionPath(ctx, tx, groupId, parent)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot load path of %s", parent)
+		}
+		if len(path) == 0 || path[len(path)-1].Key != parent {
+			return nil, errors.Wrapf(ErrInvalidParent, "collection %s not found", parent)
+		}
+		for _, ancestor := range path {
+			if ancestor.Key == coll.Key {
+				return nil, errors.Wrapf(ErrCollectionCycle, "%s is a descendant of %s", parent, coll.Key)
+			}
+			if ancestor.Deleted {
+				return nil, errors.Wrapf(ErrInvalidParent, "collection %s is deleted", ancestor.Key)
+			}
+		}
+	}
+	if err := updateCollection(ctx, tx, groupId, coll); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "cannot commit transaction")
+	}
+	if err := s.RefreshCollectionNameHier(ctx); err != nil {
+		return nil, err
+	}
+	return coll, nil
+}
+
+// DeleteCollectionTree marks the collection key as deleted and removes it
+// from its items, which are marked as modified. With recursive set all
+// descendants are deleted as well; otherwise a collection with
+// subcollections is rejected with ErrCollectionNotEmpty. It returns the keys
+// of the deleted collections, or nil if the collection does not exist.
+func (s *Storage) DeleteCollectionTree(ctx context.Context, groupId int64, key string, recursive bool) ([]string, error) {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("deleting collection [#%s] (recursive: %v)", key, recursive)
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback(ctx)
+	params := pgx.NamedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	if _, err := tx.Exec(ctx, SQLLockCollections, params); err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLLockCollections, params)
+	}
+	rows, err := tx.Query(ctx, SQLGetCollectionSubtreeKeys, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetCollectionSubtreeKeys, params)
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read rows of %s", SQLGetCollectionSubtreeKeys)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if len(keys) > 1 && !recursive {
+		return nil, errors.Wrapf(ErrCollectionNotEmpty, "collection %s has %d descendants", key, len(keys)-1)
+	}
+	params = pgx.NamedArgs{
+		"library":      groupId,
+		"keys":         keys,
+		"sync":         model.SyncStatusString[model.SyncStatus_Modified],
+		"syncNew":      model.SyncStatusString[model.SyncStatus_New],
+		"syncModified": model.SyncStatusString[model.SyncStatus_Modified],
+	}
+	if _, err := tx.Exec(ctx, SQLDeleteCollections, params); err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLDeleteCollections, params)
+	}
+	if _, err := tx.Exec(ctx, SQLRemoveCollectionsFromItems, params); err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLRemoveCollectionsFromItems, params)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "cannot commit transaction")
+	}
+	if err := s.RefreshCollectionNameHier(ctx); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
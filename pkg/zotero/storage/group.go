@@ -148,6 +148,67 @@ func (s *Storage) CreateEmptyGroup(ctx context.Context, groupId int64) (bool, mo
 	return active, direction, nil
 }
 
+// ListGroups returns all groups with their sync settings and cursors,
+// including inactive ones.
+func (s *Storage) ListGroups(ctx context.Context) ([]*model.Group, error) {
+	rows, err := s.db.Query(ctx, SQLListGroups)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLListGroups)
+	}
+	defer rows.Close()
+	grps := []*model.Group{}
+	for rows.Next() {
+		group := &model.Group{}
+		var datastr sql.NullString
+		var directionstr string
+		var gitlab sql.NullTime
+		if err := rows.Scan(&group.Id, &group.Version, &group.Meta.Created, &group.Meta.LastModified, &datastr, &group.Deleted,
+			&group.Active, &directionstr, &group.SyncTags, &group.ItemVersion, &group.CollectionVersion, &group.TagVersion, &gitlab); err != nil {
+			return nil, errors.Wrap(err, "cannot scan row")
+		}
+		if datastr.Valid {
+			if err := json.Unmarshal([]byte(datastr.String), &group.Data); err != nil {
+				return nil, errors.Wrapf(err, "cannot unmarshal Group data %s", datastr.String)
+			}
+		}
+		if gitlab.Valid {
+			group.Gitlab = &gitlab.Time
+		}
+		group.Direction = model.SyncDirectionId[directionstr]
+		group.Init()
+		grps = append(grps, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate groups")
+	}
+	return grps, nil
+}
+
+// UpdateSyncGroup stores the sync settings Active, Direction and SyncTags of
+// group.
+func (s *Storage) UpdateSyncGroup(ctx context.Context, group *model.Group) error {
+	direction, ok := model.SyncDirectionString[group.Direction]
+	if !ok {
+		return errors.Errorf("invalid sync direction %v", group.Direction)
+	}
+	params := pgx.NamedArgs{
+		"id":        group.Id,
+		"active":    group.Active,
+		"direction": direction,
+		"tags":      group.SyncTags,
+	}
+	tag, err := s.db.Exec(ctx, SQLUpdateSyncGroup, params)
+	if err != nil {
+		return errors.Wrapf(err, "cannot execute %s: %v", SQLUpdateSyncGroup, params)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.Errorf("no sync settings for group %v", group.Id)
+	}
+	return nil
+}
+
+// ClearGroup resets the sync cursors of the group, so that the next sync
+// compares all objects with the cloud.
 func (s *Storage) ClearGroup(ctx context.Context, groupId int64) error {
 	params := pgx.NamedArgs{"id": groupId}
 	_, err := s.db.Exec(ctx, SQLClearGroup, params)
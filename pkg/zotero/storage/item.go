@@ -264,6 +264,45 @@ func (s *Storage) UpdateItem(ctx context.Context, groupId int64, item *model.Ite
 	if s.Logger != nil {
 		s.Logger.Info().Msgf("updating item [#%s]", item.Key)
 	}
+	return updateItem(ctx, s.db, groupId, item)
+}
+
+// ModifyItem loads the item key, locks it and calls f to change it. The item
+// is written only if f returns nil, and no other ModifyItem call can change it
+// in between. It returns nil if the item does not exist.
+func (s *Storage) ModifyItem(ctx context.Context, groupId int64, key string, f func(item *model.Item) error) (*model.Item, error) {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("modifying item [#%s]", key)
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback(ctx)
+	params := pgx.NamedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	item, err := s.itemFromRow(groupId, tx.QueryRow(ctx, SQLGetItemByKeyForUpdate, params))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetItemByKeyForUpdate, params)
+	}
+	if item == nil {
+		return nil, nil
+	}
+	if err := f(item); err != nil {
+		return nil, err
+	}
+	if err := updateItem(ctx, tx, groupId, item); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "cannot commit transaction")
+	}
+	return item, nil
+}
+
+func updateItem(ctx context.Context, db dbConn, groupId int64, item *model.Item) error {
 	var md5val sql.NullString
 	if item.MD5 == "" {
 		if item.Data.ItemType == "attachment" {
@@ -301,7 +340,7 @@ func (s *Storage) UpdateItem(ctx context.Context, groupId int64, item *model.Ite
 	} else {
 		sqlstr = SQLUpdateItemVersion0
 	}
-	_, err = s.db.Exec(ctx, sqlstr, params)
+	_, err = db.Exec(ctx, sqlstr, params)
 	if err != nil {
 		return errors.Wrapf(err, "cannot execute %s: %v", sqlstr, params)
 	}
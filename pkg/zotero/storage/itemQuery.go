@@ -0,0 +1,342 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+const (
+	DefaultQueryLimit = 25
+	MaxQueryLimit     = 100
+)
+
+// ItemQuery filters items the way the Zotero web API does. ItemType and each
+// entry of Tags may combine alternatives with " || " and be negated with a
+// leading "-"; all entries of Tags must match.
+type ItemQuery struct {
+	ItemType   string
+	Tags       []string
+	Collection string
+	// Q matches title, creator names and date
+	Q              string
+	Since          int64
+	IncludeTrashed bool
+	// Sort is one of the keys of ItemQuerySortFields, default dateModified
+	Sort string
+	// Direction is "asc" or "desc", default depends on Sort
+	Direction string
+	Start     int64
+	Limit     int64
+}
+
+// ErrInvalidQuery is returned by QueryItems for invalid filter, sort or paging
+// values.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ItemQuerySortFields maps sort parameters to SQL expressions.
+var ItemQuerySortFields = map[string]string{
+	"dateAdded":    "data->>'dateAdded'",
+	"dateModified": "data->>'dateModified'",
+	"title":        "lower(data->>'title')",
+	"creator":      "lower(meta->>'creatorSummary')",
+	"itemType":     "data->>'itemType'",
+	"date":         "data->>'date'",
+	"version":      "version",
+}
+
+// queryTerm is a filter value with its alternatives and negation.
+type queryTerm struct {
+	values []string
+	negate bool
+}
+
+func parseQueryTerm(s string) queryTerm {
+	s = strings.TrimSpace(s)
+	var t queryTerm
+	if strings.HasPrefix(s, "-") {
+		t.negate = true
+		s = s[1:]
+	}
+	for _, v := range strings.Split(s, "||") {
+		if v = strings.TrimSpace(v); v != "" {
+			t.values = append(t.values, v)
+		}
+	}
+	return t
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// where builds the filter clause appended to SQLQueryItems and
+// SQLQueryItemsCount.
+func (q *ItemQuery) where(params pgx.NamedArgs) (string, error) {
+	var clauses []string
+	if !q.IncludeTrashed {
+		clauses = append(clauses, "trashed = false")
+	}
+	if q.ItemType != "" {
+		t := parseQueryTerm(q.ItemType)
+		for _, v := range t.values {
+			if !model.IsValidItemType(v) {
+				return "", errors.Wrapf(ErrInvalidQuery, "invalid item type %q", v)
+			}
+		}
+		if len(t.values) > 0 {
+			params["itemTypes"] = t.values
+			clause := "data->>'itemType' = ANY(@itemTypes)"
+			if t.negate {
+				clause = "NOT " + clause
+			}
+			clauses = append(clauses, clause)
+		}
+	}
+	for i, tag := range q.Tags {
+		t := parseQueryTerm(tag)
+		if len(t.values) == 0 {
+			continue
+		}
+		var alternatives []string
+		for j, v := range t.values {
+			name := fmt.Sprintf("tag%d_%d", i, j)
+			params[name] = v
+			alternatives = append(alternatives, fmt.Sprintf("data->'tags' @> jsonb_build_array(jsonb_build_object('tag', @%s::text))", name))
+		}
+		clause := "(" + strings.Join(alternatives, " OR ") + ")"
+		if t.negate {
+			clause = "NOT " + clause
+		}
+		clauses = append(clauses, clause)
+	}
+	if q.Collection != "" {
+		params["collection"] = q.Collection
+		clauses = append(clauses, "data->'collections' ? @collection::text")
+	}
+	if q.Q != "" {
+		params["q"] = "%" + escapeLike(strings.TrimSpace(q.Q)) + "%"
+		clauses = append(clauses, "(data->>'title' ILIKE @q OR data->>'date' ILIKE @q OR EXISTS (SELECT 1 FROM jsonb_array_elements(CASE WHEN jsonb_typeof(data->'creators') = 'array' THEN data->'creators' ELSE '[]'::jsonb END) c WHERE c->>'lastName' ILIKE @q OR c->>'firstName' ILIKE @q OR c->>'name' ILIKE @q))")
+	}
+	if q.Since > 0 {
+		params["since"] = q.Since
+		clauses = append(clauses, "version > @since")
+	}
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return " AND " + strings.Join(clauses, " AND "), nil
+}
+
+// sortOrder returns sort field and direction of q with the defaults applied.
+func (q *ItemQuery) sortOrder() (string, string, error) {
+	sort := q.Sort
+	if sort == "" {
+		sort = "dateModified"
+	}
+	if _, ok := ItemQuerySortFields[sort]; !ok {
+		return "", "", errors.Wrapf(ErrInvalidQuery, "invalid sort field %q", sort)
+	}
+	direction := strings.ToLower(q.Direction)
+	switch direction {
+	case "":
+		// Zotero sorts dates descending and everything else ascending
+		direction = "asc"
+		if sort == "dateAdded" || sort == "dateModified" || sort == "version" {
+			direction = "desc"
+		}
+	case "asc", "desc":
+	default:
+		return "", "", errors.Wrapf(ErrInvalidQuery, "invalid sort direction %q", q.Direction)
+	}
+	return sort, direction, nil
+}
+
+// orderBy returns the ORDER BY clause. Keys break ties so that paging is
+// stable.
+func (q *ItemQuery) orderBy() (string, error) {
+	sort, direction, err := q.sortOrder()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(" ORDER BY %s %s NULLS LAST, key %s", ItemQuerySortFields[sort], direction, direction), nil
+}
+
+// PageLimit returns Limit bounded by DefaultQueryLimit and MaxQueryLimit.
+func (q *ItemQuery) PageLimit() int64 {
+	return pageLimit(q.Limit)
+}
+
+func pageLimit(limit int64) int64 {
+	switch {
+	case limit <= 0:
+		return DefaultQueryLimit
+	case limit > MaxQueryLimit:
+		return MaxQueryLimit
+	}
+	return limit
+}
+
+// Validate checks paging, item types and sort of q. Stores which filter with
+// Match and Compare call it first.
+func (q *ItemQuery) Validate() error {
+	if q.Start < 0 {
+		return errors.Wrapf(ErrInvalidQuery, "invalid start %d", q.Start)
+	}
+	for _, v := range parseQueryTerm(q.ItemType).values {
+		if !model.IsValidItemType(v) {
+			return errors.Wrapf(ErrInvalidQuery, "invalid item type %q", v)
+		}
+	}
+	_, _, err := q.sortOrder()
+	return err
+}
+
+// Match reports whether item passes the filters of q. It is the counterpart
+// of the SQL filter of QueryItems for stores without SQL.
+func (q *ItemQuery) Match(item *model.Item) bool {
+	if item.Deleted || (item.Trashed && !q.IncludeTrashed) {
+		return false
+	}
+	if q.ItemType != "" {
+		if t := parseQueryTerm(q.ItemType); len(t.values) > 0 && slices.Contains(t.values, item.Data.ItemType) == t.negate {
+			return false
+		}
+	}
+	for _, tag := range q.Tags {
+		t := parseQueryTerm(tag)
+		if len(t.values) == 0 {
+			continue
+		}
+		found := slices.ContainsFunc(item.Data.Tags, func(it model.ItemTag) bool {
+			return slices.Contains(t.values, it.Tag)
+		})
+		if found == t.negate {
+			return false
+		}
+	}
+	if q.Collection != "" && !slices.Contains(item.Data.Collections, q.Collection) {
+		return false
+	}
+	if q.Q != "" {
+		needle := strings.ToLower(strings.TrimSpace(q.Q))
+		contains := func(s string) bool { return strings.Contains(strings.ToLower(s), needle) }
+		if !contains(item.Data.Title) && !contains(item.Data.Date) && !slices.ContainsFunc(item.Data.Creators, func(c model.ItemDataPerson) bool {
+			return contains(c.LastName) || contains(c.FirstName) || contains(c.Name)
+		}) {
+			return false
+		}
+	}
+	return q.Since <= 0 || item.Version > q.Since
+}
+
+// sortValue returns the value item is sorted by; empty values sort last.
+func sortValue(sort string, item *model.Item) string {
+	switch sort {
+	case "dateAdded":
+		return item.Data.DateAdded
+	case "dateModified":
+		return item.Data.DateModified
+	case "title":
+		return strings.ToLower(item.Data.Title)
+	case "creator":
+		return strings.ToLower(item.Meta.CreatorSummary)
+	case "itemType":
+		return item.Data.ItemType
+	case "date":
+		return item.Data.Date
+	}
+	return ""
+}
+
+// Compare orders items like the ORDER BY clause of QueryItems. q must be
+// valid.
+func (q *ItemQuery) Compare(a, b *model.Item) int {
+	sort, direction, _ := q.sortOrder()
+	var result int
+	if sort == "version" {
+		result = cmp.Compare(a.Version, b.Version)
+	} else {
+		va, vb := sortValue(sort, a), sortValue(sort, b)
+		switch {
+		case va == "" && vb != "":
+			return 1
+		case va != "" && vb == "":
+			return -1
+		}
+		result = strings.Compare(va, vb)
+	}
+	if result == 0 {
+		result = strings.Compare(a.Key, b.Key)
+	}
+	if direction == "desc" {
+		return -result
+	}
+	return result
+}
+
+// QueryItems returns one page of the items of group groupId matching q and the
+// total number of matching items.
+func (s *Storage) QueryItems(ctx context.Context, groupId int64, q *ItemQuery) ([]*model.Item, int64, error) {
+	if q.Start < 0 {
+		return nil, 0, errors.Wrapf(ErrInvalidQuery, "invalid start %d", q.Start)
+	}
+	limit := q.PageLimit()
+	params := pgx.NamedArgs{
+		"library": groupId,
+	}
+	where, err := q.where(params)
+	if err != nil {
+		return nil, 0, err
+	}
+	orderBy, err := q.orderBy()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	countstr := SQLQueryItemsCount + where
+	var total int64
+	if err := s.db.QueryRow(ctx, countstr, params).Scan(&total); err != nil {
+		return nil, 0, errors.Wrapf(err, "cannot execute %s: %v", countstr, params)
+	}
+	if total == 0 || q.Start >= total {
+		return []*model.Item{}, total, nil
+	}
+
+	params["start"] = q.Start
+	params["limit"] = limit
+	sqlstr := SQLQueryItems + where + orderBy + " OFFSET @start LIMIT @limit"
+	rows, err := s.db.Query(ctx, sqlstr, params)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "cannot execute %s: %v", sqlstr, params)
+	}
+	defer rows.Close()
+	items := []*model.Item{}
+	for rows.Next() {
+		item, err := s.itemFromRow(groupId, rows)
+		if err != nil {
+			if errors.Is(err, errEmptyItem) {
+				if s.Logger != nil {
+					s.Logger.Warn().Err(err).Msg("item is empty. skipping")
+				}
+				continue
+			}
+			return nil, 0, errors.Wrapf(err, "cannot scan row")
+		}
+		if item == nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, errors.Wrapf(err, "cannot read rows of %s", sqlstr)
+	}
+	return items, total, nil
+}
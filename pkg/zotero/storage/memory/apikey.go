@@ -0,0 +1,41 @@
+package memory
+
+import (
+	"context"
+	"maps"
+
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+func copyApiKey(key *model.ApiKey) *model.ApiKey {
+	result := *key
+	result.Access.Groups = maps.Clone(key.Access.Groups)
+	return &result
+}
+
+// AddApiKey registers key for token. Like the apikeys table only the hash of
+// token is kept.
+func (s *Store) AddApiKey(token string, key *model.ApiKey) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.apiKeys[storage.HashApiToken(token)] = copyApiKey(key)
+}
+
+// RemoveApiKey revokes the key for token.
+func (s *Store) RemoveApiKey(token string) {
+	s.mu.Lock()
+	defer s.unlock()
+	delete(s.apiKeys, storage.HashApiToken(token))
+}
+
+// GetApiKey returns the local API key for token, or nil if there is none.
+func (s *Store) GetApiKey(ctx context.Context, token string) (*model.ApiKey, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	key, ok := s.apiKeys[storage.HashApiToken(token)]
+	if !ok {
+		return nil, nil
+	}
+	return copyApiKey(key), nil
+}
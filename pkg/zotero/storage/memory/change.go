@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// logChange appends a change to the feed like the changes triggers. Listeners
+// are notified by unlock.
+func (s *Store) logChange(groupId int64, objectType, key string, version int64, sync model.SyncStatus, changeType model.ChangeType) {
+	s.lastChange++
+	change := &model.Change{
+		Seq:        s.lastChange,
+		Library:    groupId,
+		ObjectType: objectType,
+		Key:        key,
+		Version:    version,
+		Sync:       model.SyncStatusString[sync],
+		Type:       changeType,
+		Changed:    time.Now(),
+	}
+	s.changes = append(s.changes, change)
+	s.pending = append(s.pending, change)
+}
+
+// unlock releases the store and notifies the listeners of the changes made
+// while it was locked, so listeners may call the store.
+func (s *Store) unlock() {
+	pending := s.pending
+	s.pending = nil
+	var listeners []func(library int64, seq int64)
+	if len(pending) > 0 {
+		listeners = slices.Collect(maps.Values(s.listeners))
+	}
+	s.mu.Unlock()
+	for _, change := range pending {
+		for _, fn := range listeners {
+			fn(change.Library, change.Seq)
+		}
+	}
+}
+
+// GetChanges returns at most limit changes of the group with a sequence
+// number greater than after, oldest first.
+func (s *Store) GetChanges(ctx context.Context, groupId int64, after int64, limit int64) ([]*model.Change, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	changes := []*model.Change{}
+	for _, change := range s.changes {
+		if int64(len(changes)) >= limit {
+			break
+		}
+		if change.Library == groupId && change.Seq > after {
+			c := *change
+			changes = append(changes, &c)
+		}
+	}
+	return changes, nil
+}
+
+// LatestChangeSeq returns the sequence number of the newest change of the
+// group or 0 if there is none.
+func (s *Store) LatestChangeSeq(ctx context.Context, groupId int64) (int64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	for _, change := range slices.Backward(s.changes) {
+		if change.Library == groupId {
+			return change.Seq, nil
+		}
+	}
+	return 0, nil
+}
+
+// ListenChanges calls fn with library and sequence number of every change
+// until ctx is done.
+func (s *Store) ListenChanges(ctx context.Context, fn func(library int64, seq int64)) error {
+	s.mu.Lock()
+	s.lastListener++
+	id := s.lastListener
+	s.listeners[id] = fn
+	s.unlock()
+	<-ctx.Done()
+	s.mu.Lock()
+	delete(s.listeners, id)
+	s.unlock()
+	return ctx.Err()
+}
@@ -0,0 +1,619 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+func collectionFromRow(groupId int64, row *collectionRow) (*model.Collection, error) {
+	coll := &model.Collection{
+		Key:     row.key,
+		Version: row.version,
+		Deleted: row.deleted,
+		Status:  row.sync,
+	}
+	if row.gitlab != nil {
+		gitlab := *row.gitlab
+		coll.Gitlab = &gitlab
+	}
+	if row.data == nil {
+		if coll.Deleted || coll.Status == model.SyncStatus_Incomplete {
+			return nil, nil
+		}
+		return nil, errors.Errorf("collection has no data %v.%v", groupId, coll.Key)
+	}
+	if err := json.Unmarshal(row.data, &coll.Data); err != nil {
+		return nil, errors.Wrapf(err, "cannot unmarshal data %s", row.data)
+	}
+	if row.meta != nil {
+		if err := json.Unmarshal(row.meta, &coll.Meta); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal meta %s", row.meta)
+		}
+	}
+	if coll.Data.Name == "" {
+		coll.Data.Name = coll.Key
+	}
+	coll.Library.Id = groupId
+	coll.Library.Type = "group"
+	return coll, nil
+}
+
+// collections decodes the rows selected by filter ordered by key
+func (s *Store) collections(groupId int64, filter func(row *collectionRow) bool) ([]*model.Collection, error) {
+	rows := make([]*collectionRow, 0)
+	for _, row := range s.library(groupId).collections {
+		if filter == nil || filter(row) {
+			rows = append(rows, row)
+		}
+	}
+	slices.SortFunc(rows, func(a, b *collectionRow) int {
+		return strings.Compare(a.key, b.key)
+	})
+	colls := []*model.Collection{}
+	for _, row := range rows {
+		coll, err := collectionFromRow(groupId, row)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot decode collection %s", row.key)
+		}
+		if coll == nil {
+			continue
+		}
+		colls = append(colls, coll)
+	}
+	return colls, nil
+}
+
+// insertCollection adds row to the library and logs the change
+func (s *Store) insertCollection(groupId int64, row *collectionRow) error {
+	lib := s.library(groupId)
+	if _, ok := lib.collections[row.key]; ok {
+		return errors.Errorf("collection %v.%v already exists", groupId, row.key)
+	}
+	row.modified = time.Now()
+	lib.collections[row.key] = row
+	s.logChange(groupId, "collection", row.key, row.version, row.sync, model.ChangeType_Create)
+	s.collectionEvents(groupId, nil, row)
+	return nil
+}
+
+// updateCollectionRow applies f to row, logs the change and writes its
+// webhook events
+func (s *Store) updateCollectionRow(groupId int64, row *collectionRow, f func(row *collectionRow)) {
+	old := *row
+	f(row)
+	if objectChanged(old.version, row.version, old.sync, row.sync, old.deleted, row.deleted, old.data, row.data) {
+		s.logChange(groupId, "collection", row.key, row.version, row.sync, changeType(old.deleted, row.deleted))
+	}
+	s.collectionEvents(groupId, &old, row)
+}
+
+func (s *Store) CreateCollection(ctx context.Context, groupId int64, collectionData *model.CollectionData) (*model.Collection, error) {
+	if collectionData.Key == "" {
+		collectionData.Key = model.CreateKey()
+	}
+	coll := &model.Collection{
+		Key:     collectionData.Key,
+		Version: 0,
+		Library: model.Library{
+			Id:   groupId,
+			Type: "group",
+		},
+		Meta: model.CollectionMeta{},
+		Data: *collectionData,
+	}
+	data, err := json.Marshal(collectionData)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot marshal collection data %v", collectionData)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	if err := s.insertCollection(groupId, &collectionRow{key: coll.Key, data: data, sync: model.SyncStatus_New}); err != nil {
+		return nil, err
+	}
+	return coll, nil
+}
+
+// RefreshCollectionNameHier does nothing, names are resolved from the
+// collection data.
+func (s *Store) RefreshCollectionNameHier(ctx context.Context) error {
+	return nil
+}
+
+func (s *Store) CreateEmptyCollection(ctx context.Context, groupId int64, collectionId string) error {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.insertCollection(groupId, &collectionRow{key: collectionId, sync: model.SyncStatus_Incomplete})
+}
+
+func (s *Store) GetCollectionVersion(ctx context.Context, groupId int64, collectionId string) (int64, model.SyncStatus, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	if row, ok := s.library(groupId).collections[collectionId]; ok {
+		return row.version, row.sync, nil
+	}
+	if err := s.insertCollection(groupId, &collectionRow{key: collectionId, sync: model.SyncStatus_Incomplete}); err != nil {
+		return 0, model.SyncStatus_Incomplete, errors.Wrapf(err, "cannot create new collection")
+	}
+	return 0, model.SyncStatus_Incomplete, nil
+}
+
+func (s *Store) GetCollectionsByKey(ctx context.Context, groupId int64, objectKeys []string) ([]model.Collection, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	colls, err := s.collections(groupId, func(row *collectionRow) bool {
+		return slices.Contains(objectKeys, row.key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]model.Collection, 0, len(colls))
+	for _, coll := range colls {
+		result = append(result, *coll)
+	}
+	return result, nil
+}
+
+func (s *Store) GetCollectionVersions(ctx context.Context, groupId int64, sinceVersion int64) (map[string]int64, int64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	objects := map[string]int64{}
+	lastModifiedVersion := sinceVersion
+	for _, row := range s.library(groupId).collections {
+		if row.version > sinceVersion {
+			objects[row.key] = row.version
+			lastModifiedVersion = max(lastModifiedVersion, row.version)
+		}
+	}
+	return objects, lastModifiedVersion, nil
+}
+
+func (s *Store) GetCollectionByKey(ctx context.Context, groupId int64, key string) (*model.Collection, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	row, ok := s.library(groupId).collections[key]
+	if !ok {
+		return nil, nil
+	}
+	return collectionFromRow(groupId, row)
+}
+
+// collectionByName returns the first collection, which is not deleted, with
+// name below parentKey
+func (s *Store) collectionByName(groupId int64, name string, parentKey string) (*model.Collection, error) {
+	colls, err := s.collections(groupId, func(row *collectionRow) bool { return !row.deleted })
+	if err != nil {
+		return nil, err
+	}
+	for _, coll := range colls {
+		if coll.Data.Name == name && string(coll.Data.ParentCollection) == parentKey {
+			return coll, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Store) GetCollectionByName(ctx context.Context, groupId int64, name string, parentKey string) (*model.Collection, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.collectionByName(groupId, name, parentKey)
+}
+
+func (s *Store) UpdateCollection(ctx context.Context, groupId int64, collection *model.Collection) error {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("Updating Collection [#%s]", collection.Key)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	return s.writeCollection(groupId, collection)
+}
+
+func (s *Store) writeCollection(groupId int64, collection *model.Collection) error {
+	data, err := json.Marshal(collection.Data)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal data %v", collection.Data)
+	}
+	meta, err := json.Marshal(collection.Meta)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal meta %v", collection.Meta)
+	}
+	row, ok := s.library(groupId).collections[collection.Key]
+	if !ok {
+		return nil
+	}
+	s.updateCollectionRow(groupId, row, func(row *collectionRow) {
+		row.version = collection.Version
+		row.sync = collection.Status
+		row.data = data
+		row.meta = meta
+		row.deleted = collection.Deleted
+		row.modified = time.Now()
+	})
+	return nil
+}
+
+// deleteCollections marks the collections as deleted and returns their number
+func (s *Store) deleteCollections(groupId int64, keys []string) int64 {
+	var num int64
+	lib := s.library(groupId)
+	for _, key := range keys {
+		row, ok := lib.collections[key]
+		if !ok {
+			continue
+		}
+		s.updateCollectionRow(groupId, row, func(row *collectionRow) {
+			row.deleted = true
+			row.sync = model.SyncStatus_Modified
+			row.modified = time.Now()
+		})
+		num++
+	}
+	return num
+}
+
+func (s *Store) DeleteCollection(ctx context.Context, groupId int64, key string) error {
+	s.mu.Lock()
+	defer s.unlock()
+	s.deleteCollections(groupId, []string{key})
+	return nil
+}
+
+// DeleteCollections marks all given collections as deleted. It returns the
+// number of affected collections.
+func (s *Store) DeleteCollections(ctx context.Context, groupId int64, keys []string) (int64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.deleteCollections(groupId, slices.Compact(slices.Sorted(slices.Values(keys)))), nil
+}
+
+func (s *Store) IterateCollections(ctx context.Context, groupId int64, after *time.Time, f func(coll *model.Collection) error) error {
+	return s.iterateCollections(groupId, func(row *collectionRow) bool {
+		return !row.deleted && modifiedAfter(row.modified, after)
+	}, f)
+}
+
+func (s *Store) IterateCollectionsAll(ctx context.Context, groupId int64, after *time.Time, f func(coll *model.Collection) error) error {
+	return s.iterateCollections(groupId, func(row *collectionRow) bool {
+		return modifiedAfter(row.modified, after)
+	}, f)
+}
+
+func (s *Store) iterateCollections(groupId int64, filter func(row *collectionRow) bool, f func(coll *model.Collection) error) error {
+	s.mu.Lock()
+	colls, err := s.collections(groupId, filter)
+	s.unlock()
+	if err != nil {
+		return errors.Wrapf(err, "cannot get collection")
+	}
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("%v collections found", len(colls))
+	}
+	for _, coll := range colls {
+		if err := f(coll); err != nil {
+			return errors.Wrapf(err, "error in callback for %v", coll.Key)
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetModifiedCollections(ctx context.Context, groupId int64) ([]*model.Collection, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.collections(groupId, func(row *collectionRow) bool {
+		return row.sync == model.SyncStatus_New || row.sync == model.SyncStatus_Modified
+	})
+}
+
+func (s *Store) UpdateCollectionsGitlabTimestamp(ctx context.Context, groupId int64, now time.Time, gitlab *time.Time) error {
+	s.mu.Lock()
+	defer s.unlock()
+	now = now.Truncate(time.Second)
+	for _, row := range s.library(groupId).collections {
+		if gitlabDue(row.gitlab, now, gitlab) {
+			t := now
+			row.gitlab = &t
+		}
+	}
+	return nil
+}
+
+// EnsureCollectionPath returns the key of the collection at path, e.g.
+// []string{"Videos", "1998", "Class A"}, creating missing levels with
+// SyncStatus_New.
+func (s *Store) EnsureCollectionPath(ctx context.Context, groupId int64, path []string) (string, error) {
+	if len(path) == 0 {
+		return "", errors.New("empty collection path")
+	}
+	for _, name := range path {
+		if strings.TrimSpace(name) == "" {
+			return "", errors.Errorf("empty collection name in path %v", path)
+		}
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	key := ""
+	for _, name := range path {
+		coll, err := s.collectionByName(groupId, name, key)
+		if err != nil {
+			return "", errors.Wrapf(err, "cannot resolve collection path %v", path)
+		}
+		if coll != nil {
+			key = coll.Key
+			continue
+		}
+		data := &model.CollectionData{
+			Key:              model.CreateKey(),
+			Name:             name,
+			Relations:        model.RelationList{},
+			ParentCollection: model.Parent(key),
+		}
+		jsonstr, err := json.Marshal(data)
+		if err != nil {
+			return "", errors.Wrapf(err, "cannot marshal collection data %v", data)
+		}
+		if err := s.insertCollection(groupId, &collectionRow{key: data.Key, data: jsonstr, sync: model.SyncStatus_New}); err != nil {
+			return "", err
+		}
+		if s.Logger != nil {
+			s.Logger.Info().Msgf("created collection %s [#%s]", name, data.Key)
+		}
+		key = data.Key
+	}
+	return key, nil
+}
+
+// subtree returns the collection key, or all top-level collections for an
+// empty key, with their descendants ordered by depth, name and key. Deleted
+// collections and their subtrees are left out.
+func (s *Store) subtree(groupId int64, key string) ([]*model.Collection, error) {
+	colls, err := s.collections(groupId, func(row *collectionRow) bool { return !row.deleted })
+	if err != nil {
+		return nil, err
+	}
+	byName := func(a, b *model.Collection) int {
+		return cmp.Or(strings.Compare(a.Data.Name, b.Data.Name), strings.Compare(a.Key, b.Key))
+	}
+	var level []*model.Collection
+	for _, coll := range colls {
+		if (key == "" && coll.Data.ParentCollection == "") || (key != "" && coll.Key == key) {
+			level = append(level, coll)
+		}
+	}
+	result := []*model.Collection{}
+	seen := map[string]bool{}
+	for len(level) > 0 {
+		slices.SortFunc(level, byName)
+		var next []*model.Collection
+		for _, coll := range level {
+			seen[coll.Key] = true
+			result = append(result, coll)
+		}
+		for _, coll := range colls {
+			if !seen[coll.Key] && slices.ContainsFunc(level, func(parent *model.Collection) bool {
+				return string(coll.Data.ParentCollection) == parent.Key
+			}) {
+				next = append(next, coll)
+			}
+		}
+		level = next
+	}
+	return result, nil
+}
+
+// GetCollectionTree returns the collection key with all its descendants. With
+// an empty key the trees of all top-level collections are returned. Deleted
+// collections and their subtrees are left out.
+func (s *Store) GetCollectionTree(ctx context.Context, groupId int64, key string) ([]*model.CollectionNode, error) {
+	s.mu.Lock()
+	colls, err := s.subtree(groupId, key)
+	s.unlock()
+	if err != nil {
+		return nil, err
+	}
+	// colls are ordered by depth, so parents are always seen before children
+	nodes := map[string]*model.CollectionNode{}
+	roots := []*model.CollectionNode{}
+	for _, coll := range colls {
+		node := &model.CollectionNode{Collection: coll}
+		nodes[coll.Key] = node
+		if parent, ok := nodes[string(coll.Data.ParentCollection)]; ok && coll.Key != key {
+			parent.Children = append(parent.Children, node)
+			continue
+		}
+		roots = append(roots, node)
+	}
+	return roots, nil
+}
+
+// collectionPath returns the ancestors of key starting at the top level and
+// ending with the collection itself
+func (s *Store) collectionPath(groupId int64, key string) ([]*model.Collection, error) {
+	lib := s.library(groupId)
+	result := []*model.Collection{}
+	seen := map[string]bool{}
+	for key != "" && !seen[key] {
+		seen[key] = true
+		row, ok := lib.collections[key]
+		if !ok {
+			break
+		}
+		coll, err := collectionFromRow(groupId, row)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot decode collection %s", key)
+		}
+		if coll == nil {
+			break
+		}
+		result = append(result, coll)
+		key = string(coll.Data.ParentCollection)
+	}
+	slices.Reverse(result)
+	return result, nil
+}
+
+// GetCollectionPath returns the ancestors of the collection key starting at
+// the top level and ending with the collection itself. If the collection does
+// not exist, the result is empty.
+func (s *Store) GetCollectionPath(ctx context.Context, groupId int64, key string) ([]*model.Collection, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.collectionPath(groupId, key)
+}
+
+// GetItemsInCollection returns the items of the collection key. With recursive
+// set, items of all descendant collections are included. Trashed and deleted
+// items are skipped.
+func (s *Store) GetItemsInCollection(ctx context.Context, groupId int64, key string, recursive bool) ([]*model.Item, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	keys := []string{key}
+	if recursive {
+		colls, err := s.subtree(groupId, key)
+		if err != nil {
+			return nil, err
+		}
+		keys = keys[:0]
+		for _, coll := range colls {
+			keys = append(keys, coll.Key)
+		}
+	}
+	return s.items(groupId, func(row *itemRow) bool {
+		if row.deleted || row.trashed || row.data == nil {
+			return false
+		}
+		var data struct {
+			Collections []string `json:"collections"`
+		}
+		if err := json.Unmarshal(row.data, &data); err != nil {
+			return false
+		}
+		return slices.ContainsFunc(data.Collections, func(c string) bool { return slices.Contains(keys, c) })
+	})
+}
+
+// GetCollectionChildren returns the subcollections of parentKey ordered by
+// name. An empty parentKey returns the top-level collections.
+func (s *Store) GetCollectionChildren(ctx context.Context, groupId int64, parentKey string) ([]*model.Collection, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	colls, err := s.collections(groupId, func(row *collectionRow) bool { return !row.deleted })
+	if err != nil {
+		return nil, err
+	}
+	colls = slices.DeleteFunc(colls, func(coll *model.Collection) bool {
+		return string(coll.Data.ParentCollection) != parentKey
+	})
+	slices.SortStableFunc(colls, func(a, b *model.Collection) int {
+		return strings.Compare(a.Data.Name, b.Data.Name)
+	})
+	return colls, nil
+}
+
+// ModifyCollection loads the collection key and calls f to change it. If f
+// moves the collection, the new parent must exist and must not be the
+// collection itself or one of its descendants. It returns nil if the
+// collection does not exist.
+func (s *Store) ModifyCollection(ctx context.Context, groupId int64, key string, f func(coll *model.Collection) error) (*model.Collection, error) {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("modifying collection [#%s]", key)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	row, ok := s.library(groupId).collections[key]
+	if !ok {
+		return nil, nil
+	}
+	coll, err := collectionFromRow(groupId, row)
+	if err != nil || coll == nil {
+		return nil, err
+	}
+	oldParent := coll.Data.ParentCollection
+	if err := f(coll); err != nil {
+		return nil, err
+	}
+	if parent := string(coll.Data.ParentCollection); parent != "" && coll.Data.ParentCollection != oldParent {
+		path, err := s.collectionPath(groupId, parent)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot load path of %s", parent)
+		}
+		if len(path) == 0 || path[len(path)-1].Key != parent {
+			return nil, errors.Wrapf(storage.ErrInvalidParent, "collection %s not found", parent)
+		}
+		for _, ancestor := range path {
+			if ancestor.Key == coll.Key {
+				return nil, errors.Wrapf(storage.ErrCollectionCycle, "%s is a descendant of %s", parent, coll.Key)
+			}
+			if ancestor.Deleted {
+				return nil, errors.Wrapf(storage.ErrInvalidParent, "collection %s is deleted", ancestor.Key)
+			}
+		}
+	}
+	if err := s.writeCollection(groupId, coll); err != nil {
+		return nil, err
+	}
+	return coll, nil
+}
+
+// DeleteCollectionTree marks the collection key as deleted and removes it
+// from its items, which are marked as modified. With recursive set all
+// descendants are deleted as well; otherwise a collection with
+// subcollections is rejected with storage.ErrCollectionNotEmpty. It returns
+// the keys of the deleted collections, or nil if the collection does not
+// exist.
+func (s *Store) DeleteCollectionTree(ctx context.Context, groupId int64, key string, recursive bool) ([]string, error) {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("deleting collection [#%s] (recursive: %v)", key, recursive)
+	}
+	if key == "" {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	colls, err := s.subtree(groupId, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(colls) == 0 {
+		return nil, nil
+	}
+	if len(colls) > 1 && !recursive {
+		return nil, errors.Wrapf(storage.ErrCollectionNotEmpty, "collection %s has %d descendants", key, len(colls)-1)
+	}
+	keys := make([]string, 0, len(colls))
+	for _, coll := range colls {
+		keys = append(keys, coll.Key)
+	}
+	s.deleteCollections(groupId, keys)
+	for _, row := range s.library(groupId).sortedItems() {
+		if row.deleted || row.data == nil {
+			continue
+		}
+		item, err := itemFromRow(groupId, row)
+		if err != nil || item == nil {
+			continue
+		}
+		if !slices.ContainsFunc(item.Data.Collections, func(c string) bool { return slices.Contains(keys, c) }) {
+			continue
+		}
+		item.Data.Collections = slices.DeleteFunc(item.Data.Collections, func(c string) bool { return slices.Contains(keys, c) })
+		data, err := json.Marshal(item.Data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot marshal data %v", item.Data)
+		}
+		s.updateItemRow(groupId, row, func(row *itemRow) {
+			row.data = data
+			if row.sync != model.SyncStatus_New {
+				row.sync = model.SyncStatus_Modified
+			}
+			row.modified = time.Now()
+		})
+	}
+	return keys, nil
+}
@@ -0,0 +1,3 @@
+// Package memory implements storage.Store in memory, e.g. for tests and for
+// embedding zsync without PostgreSQL.
+package memory
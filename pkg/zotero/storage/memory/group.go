@@ -0,0 +1,152 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// toGroup returns a copy of the stored group
+func (row *groupRow) toGroup() *model.Group {
+	group := row.group
+	group.Data.Admins = slices.Clone(group.Data.Admins)
+	if group.Gitlab != nil {
+		gitlab := *group.Gitlab
+		group.Gitlab = &gitlab
+	}
+	group.Init()
+	return &group
+}
+
+// createEmptyGroup adds groupId with the default sync settings
+func (s *Store) createEmptyGroup(groupId int64) *groupRow {
+	now := time.Now()
+	row := &groupRow{group: model.Group{
+		Id:        groupId,
+		Active:    s.newGroupActive,
+		Direction: model.SyncDirection_ToLocal,
+		Meta: model.GroupMeta{
+			Created:      now,
+			LastModified: now,
+		},
+	}}
+	s.groups[groupId] = row
+	return row
+}
+
+// GetGroup returns the group groupId. Unknown groups are created with the
+// default sync settings.
+func (s *Store) GetGroup(ctx context.Context, groupId int64) (*model.Group, error) {
+	if s.Logger != nil {
+		s.Logger.Debug().Msgf("loading Group #%v", groupId)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	row, ok := s.groups[groupId]
+	if !ok {
+		row = s.createEmptyGroup(groupId)
+	}
+	group := row.toGroup()
+	group.Deleted = false
+	return group, nil
+}
+
+// GetGroups returns the active groups.
+func (s *Store) GetGroups(ctx context.Context) ([]*model.Group, error) {
+	groups, err := s.ListGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(groups, func(group *model.Group) bool { return !group.Active }), nil
+}
+
+func (s *Store) CreateEmptyGroup(ctx context.Context, groupId int64) (bool, model.SyncDirection, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	if _, ok := s.groups[groupId]; ok {
+		return false, model.SyncDirection_None, errors.Errorf("group %v already exists", groupId)
+	}
+	row := s.createEmptyGroup(groupId)
+	return row.group.Active, row.group.Direction, nil
+}
+
+// ListGroups returns all groups with their sync settings and cursors,
+// including inactive ones.
+func (s *Store) ListGroups(ctx context.Context) ([]*model.Group, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	grps := make([]*model.Group, 0, len(s.groups))
+	for _, row := range s.groups {
+		grps = append(grps, row.toGroup())
+	}
+	slices.SortFunc(grps, func(a, b *model.Group) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return grps, nil
+}
+
+// UpdateSyncGroup stores the sync settings Active, Direction and SyncTags of
+// group.
+func (s *Store) UpdateSyncGroup(ctx context.Context, group *model.Group) error {
+	if _, ok := model.SyncDirectionString[group.Direction]; !ok {
+		return errors.Errorf("invalid sync direction %v", group.Direction)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	row, ok := s.groups[group.Id]
+	if !ok {
+		return errors.Errorf("no sync settings for group %v", group.Id)
+	}
+	row.group.Active = group.Active
+	row.group.Direction = group.Direction
+	row.group.SyncTags = group.SyncTags
+	return nil
+}
+
+// ClearGroup resets the sync cursors of the group, so that the next sync
+// compares all objects with the cloud.
+func (s *Store) ClearGroup(ctx context.Context, groupId int64) error {
+	s.mu.Lock()
+	defer s.unlock()
+	if row, ok := s.groups[groupId]; ok {
+		row.group.Version = 0
+		row.group.Meta.LastModified = row.group.Meta.Created
+		row.group.ItemVersion = 0
+		row.group.CollectionVersion = 0
+		row.group.TagVersion = 0
+	}
+	return nil
+}
+
+func (s *Store) UpdateGroup(ctx context.Context, group *model.Group) error {
+	s.mu.Lock()
+	defer s.unlock()
+	row, ok := s.groups[group.Id]
+	if !ok {
+		return nil
+	}
+	row.group.Version = group.Version
+	row.group.Meta.Created = group.Meta.Created
+	row.group.Meta.LastModified = group.Meta.LastModified
+	row.group.Data = group.Data
+	row.group.Data.Admins = slices.Clone(group.Data.Admins)
+	row.group.Deleted = group.Deleted
+	row.group.ItemVersion = group.ItemVersion
+	row.group.CollectionVersion = group.CollectionVersion
+	row.group.TagVersion = group.TagVersion
+	return nil
+}
+
+func (s *Store) UpdateGroupGitlabTimestamp(ctx context.Context, groupId int64, t time.Time) error {
+	s.mu.Lock()
+	defer s.unlock()
+	if row, ok := s.groups[groupId]; ok {
+		t = t.Truncate(time.Second)
+		row.group.Gitlab = &t
+	}
+	return nil
+}
@@ -0,0 +1,498 @@
+package memory
+
+import (
+	"context"
+	"encoding/json/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+var errEmptyItem = errors.New("item has no data")
+
+func itemFromRow(groupId int64, row *itemRow) (*model.Item, error) {
+	item := &model.Item{
+		Key:     row.key,
+		Version: row.version,
+		Trashed: row.trashed,
+		Deleted: row.deleted,
+		Status:  row.sync,
+		MD5:     row.md5,
+		OldId:   row.oldid,
+	}
+	if row.gitlab != nil {
+		gitlab := *row.gitlab
+		item.Gitlab = &gitlab
+	}
+	item.Library.Id = groupId
+	item.Library.Type = "group"
+	if row.data == nil {
+		if item.Deleted || item.Status == model.SyncStatus_Incomplete {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(errEmptyItem, "item has no data %v.%v", groupId, item.Key)
+	}
+	if err := json.Unmarshal(row.data, &item.Data); err != nil {
+		return nil, errors.Wrapf(err, "cannot unmarshal data %s", row.data)
+	}
+	if item.Data.Collections == nil {
+		item.Data.Collections = []string{}
+	}
+	if row.meta != nil {
+		if err := json.Unmarshal(row.meta, &item.Meta); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal meta %s", row.meta)
+		}
+	}
+	item.Data.ItemDataBase.Key = item.Key
+	item.Data.ItemDataBase.Version = item.Version
+	return item, nil
+}
+
+// sortedItems returns the rows of the library ordered by key
+func (lib *library) sortedItems() []*itemRow {
+	rows := make([]*itemRow, 0, len(lib.items))
+	for _, row := range lib.items {
+		rows = append(rows, row)
+	}
+	slices.SortFunc(rows, func(a, b *itemRow) int {
+		return strings.Compare(a.key, b.key)
+	})
+	return rows
+}
+
+// items decodes the rows selected by filter, skipping empty items like
+// storage.Storage.
+func (s *Store) items(groupId int64, filter func(row *itemRow) bool) ([]*model.Item, error) {
+	items := []*model.Item{}
+	for _, row := range s.library(groupId).sortedItems() {
+		if filter != nil && !filter(row) {
+			continue
+		}
+		item, err := itemFromRow(groupId, row)
+		if err != nil {
+			if errors.Is(err, errEmptyItem) {
+				if s.Logger != nil {
+					s.Logger.Warn().Err(err).Msg("item is empty. skipping")
+				}
+				continue
+			}
+			return nil, err
+		}
+		if item == nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// insertItem adds row to the library and logs the change
+func (s *Store) insertItem(groupId int64, row *itemRow) error {
+	lib := s.library(groupId)
+	if _, ok := lib.items[row.key]; ok {
+		return errors.Errorf("item %v.%v already exists", groupId, row.key)
+	}
+	if row.oldid != "" {
+		for _, other := range lib.items {
+			if other.oldid == row.oldid {
+				return errors.Errorf("item with oldid %s already exists in group %v", row.oldid, groupId)
+			}
+		}
+	}
+	row.modified = time.Now()
+	lib.items[row.key] = row
+	s.logChange(groupId, "item", row.key, row.version, row.sync, model.ChangeType_Create)
+	s.itemEvents(groupId, nil, row)
+	return nil
+}
+
+// updateItemRow applies f to row, logs the change and writes its webhook
+// events
+func (s *Store) updateItemRow(groupId int64, row *itemRow, f func(row *itemRow)) {
+	old := *row
+	f(row)
+	if objectChanged(old.version, row.version, old.sync, row.sync, old.deleted, row.deleted, old.data, row.data) {
+		s.logChange(groupId, "item", row.key, row.version, row.sync, changeType(old.deleted, row.deleted))
+	}
+	s.itemEvents(groupId, &old, row)
+}
+
+func (s *Store) CreateItem(ctx context.Context, groupId int64, itemData *model.ItemGeneric, itemMeta *model.ItemMeta, oldId string) (*model.Item, error) {
+	if itemData.Key == "" {
+		itemData.Key = model.CreateKey()
+	}
+	if itemMeta == nil {
+		itemMeta = &model.ItemMeta{}
+	}
+	item := &model.Item{
+		Key:     itemData.Key,
+		Version: 0,
+		Library: model.Library{
+			Id:   groupId,
+			Type: "group",
+		},
+		Meta:   *itemMeta,
+		Data:   *itemData,
+		OldId:  oldId,
+		Status: model.SyncStatus_New,
+	}
+	data, err := json.Marshal(itemData)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot marshal item data %v", itemData)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	if existing := s.itemByOldid(groupId, oldId); existing != nil {
+		// like the unique constraint on oldid in PostgreSQL
+		item.Key = existing.key
+		item.Data.Key = item.Key
+		item.Version = existing.version
+		item.Status = model.SyncStatus_Modified
+		if err := s.writeItem(groupId, item); err != nil {
+			return nil, errors.Wrapf(err, "cannot update item %v", oldId)
+		}
+		return item, nil
+	}
+	if err := s.insertItem(groupId, &itemRow{key: item.Key, data: data, sync: model.SyncStatus_New, oldid: oldId}); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *Store) itemByOldid(groupId int64, oldid string) *itemRow {
+	if oldid == "" {
+		return nil
+	}
+	for _, row := range s.library(groupId).sortedItems() {
+		if row.oldid == oldid {
+			return row
+		}
+	}
+	return nil
+}
+
+func (s *Store) CreateEmptyItem(ctx context.Context, groupId int64, itemId string, oldId string) error {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.insertItem(groupId, &itemRow{key: itemId, sync: model.SyncStatus_Incomplete, oldid: oldId})
+}
+
+func (s *Store) GetItemVersion(ctx context.Context, groupId int64, itemId string, oldId string) (int64, model.SyncStatus, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	if row, ok := s.library(groupId).items[itemId]; ok {
+		return row.version, row.sync, nil
+	}
+	if err := s.insertItem(groupId, &itemRow{key: itemId, sync: model.SyncStatus_Incomplete, oldid: oldId}); err != nil {
+		return 0, model.SyncStatus_Incomplete, errors.Wrapf(err, "cannot create new item")
+	}
+	return 0, model.SyncStatus_Incomplete, nil
+}
+
+func (s *Store) GetItemsByKey(ctx context.Context, groupId int64, objectKeys []string) ([]model.Item, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	items, err := s.items(groupId, func(row *itemRow) bool {
+		return slices.Contains(objectKeys, row.key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]model.Item, 0, len(items))
+	for _, item := range items {
+		result = append(result, *item)
+	}
+	return result, nil
+}
+
+func (s *Store) GetItemVersions(ctx context.Context, groupId int64, sinceVersion int64, trashed bool) (map[string]int64, int64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	objects := map[string]int64{}
+	lastModifiedVersion := sinceVersion
+	for _, row := range s.library(groupId).items {
+		if row.version > sinceVersion && row.trashed == trashed {
+			objects[row.key] = row.version
+			lastModifiedVersion = max(lastModifiedVersion, row.version)
+		}
+	}
+	return objects, lastModifiedVersion, nil
+}
+
+func (s *Store) GetItemByKey(ctx context.Context, groupId int64, key string) (*model.Item, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	row, ok := s.library(groupId).items[key]
+	if !ok {
+		return nil, nil
+	}
+	return itemFromRow(groupId, row)
+}
+
+func (s *Store) GetItemByOldid(ctx context.Context, groupId int64, oldid string) (*model.Item, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	row := s.itemByOldid(groupId, oldid)
+	if row == nil {
+		return nil, nil
+	}
+	return itemFromRow(groupId, row)
+}
+
+func (s *Store) UpdateItem(ctx context.Context, groupId int64, item *model.Item) error {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("updating item [#%s]", item.Key)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	return s.writeItem(groupId, item)
+}
+
+// writeItem stores item like storage.Storage.UpdateItem; a version of 0
+// keeps the stored version.
+func (s *Store) writeItem(groupId int64, item *model.Item) error {
+	md5 := item.MD5
+	if md5 == "" && item.Data.ItemType == "attachment" {
+		md5 = item.Data.MD5
+	}
+	data, err := json.Marshal(item.Data)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal data %v", item.Data)
+	}
+	meta, err := json.Marshal(item.Meta)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal meta %v", item.Meta)
+	}
+	row, ok := s.library(groupId).items[item.Key]
+	if !ok {
+		return nil
+	}
+	s.updateItemRow(groupId, row, func(row *itemRow) {
+		if item.Version > 0 {
+			row.version = item.Version
+		}
+		row.data = data
+		row.meta = meta
+		row.trashed = item.Trashed
+		row.deleted = item.Deleted
+		row.sync = item.Status
+		row.md5 = md5
+		row.modified = time.Now()
+	})
+	return nil
+}
+
+// ModifyItem loads the item key and calls f to change it. The item is written
+// only if f returns nil. It returns nil if the item does not exist.
+func (s *Store) ModifyItem(ctx context.Context, groupId int64, key string, f func(item *model.Item) error) (*model.Item, error) {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("modifying item [#%s]", key)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	row, ok := s.library(groupId).items[key]
+	if !ok {
+		return nil, nil
+	}
+	item, err := itemFromRow(groupId, row)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	if err := f(item); err != nil {
+		return nil, err
+	}
+	if err := s.writeItem(groupId, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// deleteItems marks the items as deleted and returns their number
+func (s *Store) deleteItems(groupId int64, keys []string) int64 {
+	var num int64
+	lib := s.library(groupId)
+	for _, key := range keys {
+		row, ok := lib.items[key]
+		if !ok {
+			continue
+		}
+		s.updateItemRow(groupId, row, func(row *itemRow) {
+			row.deleted = true
+			row.sync = model.SyncStatus_Modified
+			row.modified = time.Now()
+		})
+		num++
+	}
+	return num
+}
+
+func (s *Store) DeleteItem(ctx context.Context, groupId int64, key string) error {
+	s.mu.Lock()
+	defer s.unlock()
+	s.deleteItems(groupId, []string{key})
+	return nil
+}
+
+// DeleteItems marks all given items as deleted and returns their number.
+func (s *Store) DeleteItems(ctx context.Context, groupId int64, keys []string) (int64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.deleteItems(groupId, slices.Compact(slices.Sorted(slices.Values(keys)))), nil
+}
+
+// children returns the items, which are neither trashed nor deleted, with
+// the parent item key
+func (s *Store) children(groupId int64, key string) ([]*model.Item, error) {
+	return s.items(groupId, func(row *itemRow) bool {
+		if row.trashed || row.deleted || row.data == nil {
+			return false
+		}
+		var parent struct {
+			ParentItem string `json:"parentItem"`
+		}
+		return json.Unmarshal(row.data, &parent) == nil && parent.ParentItem == key
+	})
+}
+
+func (s *Store) GetChildren(ctx context.Context, groupId int64, key string) ([]model.Item, error) {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("get children of item [#%s]", key)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	children, err := s.children(groupId, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get children of #%v", key)
+	}
+	result := make([]model.Item, 0, len(children))
+	for _, child := range children {
+		result = append(result, *child)
+	}
+	return result, nil
+}
+
+func (s *Store) DeleteItemRecursive(ctx context.Context, groupId int64, key string) error {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("recursively deleting item [#%s]", key)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	return s.deleteItemRecursive(groupId, key, []string{})
+}
+
+func (s *Store) deleteItemRecursive(groupId int64, key string, path []string) error {
+	if slices.Contains(path, key) {
+		return nil
+	}
+	children, err := s.children(groupId, key)
+	if err != nil {
+		return errors.Wrapf(err, "cannot get children of #%v", key)
+	}
+	for _, c := range children {
+		if err := s.deleteItemRecursive(groupId, c.Key, append(path, key)); err != nil {
+			return errors.Wrapf(err, "cannot delete child #%v of #%v", c.Key, key)
+		}
+	}
+	s.deleteItems(groupId, []string{key})
+	return nil
+}
+
+// modifiedAfter compares like the SQL statements, which format after with a
+// precision of seconds
+func modifiedAfter(modified time.Time, after *time.Time) bool {
+	return after == nil || modified.After(after.Truncate(time.Second))
+}
+
+func (s *Store) IterateItems(ctx context.Context, groupId int64, after *time.Time, f func(item *model.Item) error) error {
+	return s.iterateItems(groupId, func(row *itemRow) bool {
+		return !row.deleted && modifiedAfter(row.modified, after)
+	}, f)
+}
+
+func (s *Store) IterateItemsAll(ctx context.Context, groupId int64, after *time.Time, f func(item *model.Item) error) error {
+	return s.iterateItems(groupId, func(row *itemRow) bool {
+		return modifiedAfter(row.modified, after)
+	}, f)
+}
+
+func (s *Store) iterateItems(groupId int64, filter func(row *itemRow) bool, f func(item *model.Item) error) error {
+	s.mu.Lock()
+	items, err := s.items(groupId, filter)
+	s.unlock()
+	if err != nil {
+		return errors.Wrap(err, "cannot get item")
+	}
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("%v items found", len(items))
+	}
+	for _, item := range items {
+		if err := f(item); err != nil {
+			return errors.Wrapf(err, "error in callback for %v", item.Key)
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetModifiedItems(ctx context.Context, groupId int64) ([]*model.Item, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.items(groupId, func(row *itemRow) bool {
+		return row.sync == model.SyncStatus_New || row.sync == model.SyncStatus_Modified
+	})
+}
+
+// RefreshItemTypeHier does nothing, parents are resolved from the item data.
+func (s *Store) RefreshItemTypeHier(ctx context.Context) error {
+	return nil
+}
+
+// gitlabDue reports whether a backup timestamp has to be set to now like the
+// gitlab statements of storage.Storage
+func gitlabDue(current *time.Time, now time.Time, filter *time.Time) bool {
+	if current == nil {
+		return true
+	}
+	if !now.After(*current) {
+		return false
+	}
+	return filter == nil || !current.Before(*filter)
+}
+
+func (s *Store) UpdateItemsGitlabTimestamp(ctx context.Context, groupId int64, now time.Time, gitlab *time.Time) error {
+	s.mu.Lock()
+	defer s.unlock()
+	now = now.Truncate(time.Second)
+	for _, row := range s.library(groupId).items {
+		if gitlabDue(row.gitlab, now, gitlab) {
+			t := now
+			row.gitlab = &t
+		}
+	}
+	return nil
+}
+
+// QueryItems returns one page of the items of group groupId matching q and
+// the total number of matching items.
+func (s *Store) QueryItems(ctx context.Context, groupId int64, q *storage.ItemQuery) ([]*model.Item, int64, error) {
+	if err := q.Validate(); err != nil {
+		return nil, 0, err
+	}
+	s.mu.Lock()
+	items, err := s.items(groupId, func(row *itemRow) bool { return !row.deleted })
+	s.unlock()
+	if err != nil {
+		return nil, 0, err
+	}
+	items = slices.DeleteFunc(items, func(item *model.Item) bool { return !q.Match(item) })
+	slices.SortStableFunc(items, q.Compare)
+	total := int64(len(items))
+	if q.Start >= total {
+		return []*model.Item{}, total, nil
+	}
+	end := min(total, q.Start+q.PageLimit())
+	return items[q.Start:end], total, nil
+}
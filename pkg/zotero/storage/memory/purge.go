@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// PurgeItems removes the deleted and synced items modified before before.
+func (s *Store) PurgeItems(ctx context.Context, groupId int64, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	var num int64
+	lib := s.library(groupId)
+	for key, row := range lib.items {
+		if row.deleted && row.sync == model.SyncStatus_Synced && row.modified.Before(before) {
+			delete(lib.items, key)
+			num++
+		}
+	}
+	return num, nil
+}
+
+// PurgeCollections removes the deleted and synced collections modified
+// before before.
+func (s *Store) PurgeCollections(ctx context.Context, groupId int64, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	var num int64
+	lib := s.library(groupId)
+	for key, row := range lib.collections {
+		if row.deleted && row.sync == model.SyncStatus_Synced && row.modified.Before(before) {
+			delete(lib.collections, key)
+			num++
+		}
+	}
+	return num, nil
+}
@@ -0,0 +1,37 @@
+package memory
+
+import (
+	"context"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+// SearchItems matches the words of query exactly; the language of filter
+// is only validated.
+func (s *Store) SearchItems(ctx context.Context, groupId int64, query string, filter *storage.SearchFilter, page *storage.Page) ([]*storage.SearchResult, int64, error) {
+	s.mu.Lock()
+	fulltext := map[string]string{}
+	items, err := s.items(groupId, func(row *itemRow) bool {
+		if row.fulltext != "" {
+			fulltext[row.key] = row.fulltext
+		}
+		return !row.deleted
+	})
+	s.unlock()
+	if err != nil {
+		return nil, 0, err
+	}
+	return storage.SearchItemList(items, fulltext, query, filter, page)
+}
+
+func (s *Store) SetItemFulltext(ctx context.Context, groupId int64, key string, content string) error {
+	s.mu.Lock()
+	defer s.unlock()
+	row, ok := s.library(groupId).items[key]
+	if !ok || row.data == nil {
+		return errors.Errorf("item %v.%v not found", groupId, key)
+	}
+	row.fulltext = content
+	return nil
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// GetItemStates returns the sync state of all items of the group, including
+// deleted and empty ones, ordered by key.
+func (s *Store) GetItemStates(ctx context.Context, groupId int64) ([]model.ObjectState, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	states := []model.ObjectState{}
+	for _, row := range s.library(groupId).sortedItems() {
+		states = append(states, model.ObjectState{Key: row.key, Version: row.version, Status: row.sync, Trashed: row.trashed, Deleted: row.deleted})
+	}
+	return states, nil
+}
+
+// GetCollectionStates returns the sync state of all collections of the
+// group, including deleted and empty ones, ordered by key.
+func (s *Store) GetCollectionStates(ctx context.Context, groupId int64) ([]model.ObjectState, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	states := []model.ObjectState{}
+	for _, row := range s.library(groupId).collections {
+		states = append(states, model.ObjectState{Key: row.key, Version: row.version, Status: row.sync, Deleted: row.deleted})
+	}
+	slices.SortFunc(states, func(a, b model.ObjectState) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return states, nil
+}
+
+// ResetItems sets the version of the synced or incomplete items keys to 0
+// and marks them incomplete. Items with local changes are not touched.
+func (s *Store) ResetItems(ctx context.Context, groupId int64, keys []string) (int64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	var num int64
+	lib := s.library(groupId)
+	for _, key := range slices.Compact(slices.Sorted(slices.Values(keys))) {
+		row, ok := lib.items[key]
+		if !ok || !resettable(row.sync) {
+			continue
+		}
+		s.updateItemRow(groupId, row, func(row *itemRow) {
+			row.version = 0
+			row.sync = model.SyncStatus_Incomplete
+			row.modified = time.Now()
+		})
+		num++
+	}
+	return num, nil
+}
+
+// ResetCollections is ResetItems for collections.
+func (s *Store) ResetCollections(ctx context.Context, groupId int64, keys []string) (int64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	var num int64
+	lib := s.library(groupId)
+	for _, key := range slices.Compact(slices.Sorted(slices.Values(keys))) {
+		row, ok := lib.collections[key]
+		if !ok || !resettable(row.sync) {
+			continue
+		}
+		s.updateCollectionRow(groupId, row, func(row *collectionRow) {
+			row.version = 0
+			row.sync = model.SyncStatus_Incomplete
+			row.modified = time.Now()
+		})
+		num++
+	}
+	return num, nil
+}
+
+func resettable(sync model.SyncStatus) bool {
+	return sync == model.SyncStatus_Synced || sync == model.SyncStatus_Incomplete
+}
@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+// groupRow is a group together with its sync settings
+type groupRow struct {
+	group model.Group
+}
+
+// collectionRow mirrors a row of the collections table. data and meta hold
+// JSON like the database, so returned objects never share memory with the
+// store; data is nil for collections created by GetCollectionVersion.
+type collectionRow struct {
+	key      string
+	version  int64
+	data     []byte
+	meta     []byte
+	deleted  bool
+	sync     model.SyncStatus
+	modified time.Time
+	gitlab   *time.Time
+}
+
+// itemRow mirrors a row of the items table, see collectionRow
+type itemRow struct {
+	key      string
+	version  int64
+	data     []byte
+	meta     []byte
+	trashed  bool
+	deleted  bool
+	sync     model.SyncStatus
+	md5      string
+	oldid    string
+	modified time.Time
+	gitlab   *time.Time
+	// fulltext is the extracted text of an attachment
+	fulltext string
+}
+
+// library holds the objects of a group
+type library struct {
+	collections map[string]*collectionRow
+	items       map[string]*itemRow
+	tags        map[string]model.Tag
+}
+
+// Store implements storage.Store in memory. It is safe for concurrent use
+// and meant for tests and for embedding zsync without PostgreSQL. Callbacks
+// of the Modify methods must not call the store.
+type Store struct {
+	mu             sync.Mutex
+	newGroupActive bool
+	Logger         zLogger.ZLogger
+
+	groups    map[int64]*groupRow
+	libraries map[int64]*library
+	apiKeys   map[string]*model.ApiKey
+
+	syncRuns     []*model.SyncRun
+	lastSyncRun  int64
+	changes      []*model.Change
+	lastChange   int64
+	pending      []*model.Change
+	listeners    map[int64]func(library int64, seq int64)
+	lastListener int64
+	webhooks     map[int64]*model.Webhook
+	lastWebhook  int64
+	outbox       []*model.WebhookDelivery
+	lastDelivery int64
+}
+
+var _ storage.Store = (*Store)(nil)
+
+// NewStore creates an empty store. newGroupActive controls the default
+// active state of newly discovered groups, as in storage.NewStorage.
+func NewStore(newGroupActive bool, logger zLogger.ZLogger) *Store {
+	return &Store{
+		newGroupActive: newGroupActive,
+		Logger:         logger,
+		groups:         map[int64]*groupRow{},
+		libraries:      map[int64]*library{},
+		apiKeys:        map[string]*model.ApiKey{},
+		listeners:      map[int64]func(int64, int64){},
+		webhooks:       map[int64]*model.Webhook{},
+	}
+}
+
+// library returns the objects of groupId, creating them if necessary
+func (s *Store) library(groupId int64) *library {
+	lib, ok := s.libraries[groupId]
+	if !ok {
+		lib = &library{
+			collections: map[string]*collectionRow{},
+			items:       map[string]*itemRow{},
+			tags:        map[string]model.Tag{},
+		}
+		s.libraries[groupId] = lib
+	}
+	return lib
+}
+
+// objectChanged reports whether an update is a change of the object for the
+// change feed; bookkeeping like gitlab and meta is not.
+func objectChanged(oldVersion, newVersion int64, oldSync, newSync model.SyncStatus, oldDeleted, newDeleted bool, oldData, newData []byte) bool {
+	return oldVersion != newVersion || oldSync != newSync || oldDeleted != newDeleted || !bytes.Equal(oldData, newData)
+}
+
+// changeType returns the change feed type of an update
+func changeType(oldDeleted, newDeleted bool) model.ChangeType {
+	if newDeleted && !oldDeleted {
+		return model.ChangeType_Delete
+	}
+	return model.ChangeType_Update
+}
@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+func copySyncRun(run *model.SyncRun) *model.SyncRun {
+	result := *run
+	if run.Started != nil {
+		started := *run.Started
+		result.Started = &started
+	}
+	if run.Finished != nil {
+		finished := *run.Finished
+		result.Finished = &finished
+	}
+	return &result
+}
+
+func syncRunActive(run *model.SyncRun) bool {
+	return run.Status == model.SyncRunStatus_Queued || run.Status == model.SyncRunStatus_Running
+}
+
+// CreateSyncRun stores run as queued and sets its id and request time. Active
+// runs of the group requested or started before staleAfter are marked as
+// abandoned first; any other active run results in storage.ErrSyncRunActive.
+func (s *Store) CreateSyncRun(ctx context.Context, run *model.SyncRun, staleAfter time.Duration) error {
+	s.mu.Lock()
+	defer s.unlock()
+	now := time.Now()
+	for _, r := range s.syncRuns {
+		if r.GroupId != run.GroupId || !syncRunActive(r) {
+			continue
+		}
+		since := r.Requested
+		if r.Started != nil {
+			since = *r.Started
+		}
+		if staleAfter > 0 && since.Before(now.Add(-staleAfter)) {
+			if s.Logger != nil {
+				s.Logger.Warn().Msgf("abandoned stale sync run %v of group %v", r.Id, r.GroupId)
+			}
+			r.Status = model.SyncRunStatus_Failed
+			r.Finished = &now
+			r.Error = "abandoned"
+			continue
+		}
+		return errors.WithStack(storage.ErrSyncRunActive)
+	}
+	s.lastSyncRun++
+	run.Id = s.lastSyncRun
+	run.Status = model.SyncRunStatus_Queued
+	run.Requested = now
+	s.syncRuns = append(s.syncRuns, copySyncRun(run))
+	return nil
+}
+
+// UpdateSyncRun stores status, stage, timestamps, counters and error of run.
+func (s *Store) UpdateSyncRun(ctx context.Context, run *model.SyncRun) error {
+	s.mu.Lock()
+	defer s.unlock()
+	for i, r := range s.syncRuns {
+		if r.Id != run.Id {
+			continue
+		}
+		updated := copySyncRun(run)
+		updated.GroupId = r.GroupId
+		updated.Trigger = r.Trigger
+		updated.RequestedBy = r.RequestedBy
+		updated.Requested = r.Requested
+		s.syncRuns[i] = updated
+	}
+	return nil
+}
+
+// GetSyncRun returns the sync run with the given id or nil.
+func (s *Store) GetSyncRun(ctx context.Context, id int64) (*model.SyncRun, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	for _, r := range s.syncRuns {
+		if r.Id == id {
+			return copySyncRun(r), nil
+		}
+	}
+	return nil, nil
+}
+
+// GetSyncRuns returns the latest limit sync runs of the group, newest first.
+func (s *Store) GetSyncRuns(ctx context.Context, groupId int64, limit int64) ([]*model.SyncRun, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	runs := []*model.SyncRun{}
+	for _, r := range slices.Backward(s.syncRuns) {
+		if int64(len(runs)) >= limit {
+			break
+		}
+		if r.GroupId == groupId {
+			runs = append(runs, copySyncRun(r))
+		}
+	}
+	return runs, nil
+}
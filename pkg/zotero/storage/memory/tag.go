@@ -0,0 +1,183 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// CreateTag stores tag. Existing tags are kept unchanged.
+func (s *Store) CreateTag(ctx context.Context, groupId int64, tag model.Tag) error {
+	if s.Logger != nil {
+		s.Logger.Debug().Msgf("Creating Tag %s", tag.Tag)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	lib := s.library(groupId)
+	if _, ok := lib.tags[tag.Tag]; ok {
+		return nil
+	}
+	if tag.Meta != nil {
+		meta := *tag.Meta
+		tag.Meta = &meta
+	}
+	tag.Links = nil
+	lib.tags[tag.Tag] = tag
+	return nil
+}
+
+func (s *Store) DeleteTag(ctx context.Context, groupId int64, tag string) error {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("deleting Tag %s", tag)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	delete(s.library(groupId).tags, tag)
+	return nil
+}
+
+// DeleteTags removes all given tags. It returns the number of removed tags.
+func (s *Store) DeleteTags(ctx context.Context, groupId int64, tags []string) (int64, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	lib := s.library(groupId)
+	var num int64
+	for _, tag := range tags {
+		if _, ok := lib.tags[tag]; ok {
+			delete(lib.tags, tag)
+			num++
+		}
+	}
+	return num, nil
+}
+
+// GetTagUsage counts the tags of the items like storage.Storage.GetTagUsage.
+func (s *Store) GetTagUsage(ctx context.Context, groupId int64) ([]*model.Tag, error) {
+	s.mu.Lock()
+	items, err := s.items(groupId, func(row *itemRow) bool { return !row.deleted && !row.trashed })
+	s.unlock()
+	if err != nil {
+		return nil, err
+	}
+	type usage struct {
+		tag string
+		typ int64
+	}
+	counts := map[usage]int64{}
+	for _, item := range items {
+		seen := map[string]bool{}
+		for _, t := range item.Data.Tags {
+			if t.Tag == "" || seen[t.Tag] {
+				continue
+			}
+			seen[t.Tag] = true
+			counts[usage{tag: t.Tag, typ: t.Type}]++
+		}
+	}
+	tags := make([]*model.Tag, 0, len(counts))
+	for u, n := range counts {
+		tags = append(tags, &model.Tag{Tag: u.tag, Meta: &model.TagMeta{Type: u.typ, NumItems: n}})
+	}
+	slices.SortFunc(tags, func(a, b *model.Tag) int {
+		if c := strings.Compare(a.Tag, b.Tag); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Meta.Type, b.Meta.Type)
+	})
+	return tags, nil
+}
+
+// GetItemsByTag returns the items carrying tag ordered by key; trashed and
+// deleted items are skipped.
+func (s *Store) GetItemsByTag(ctx context.Context, groupId int64, tag string) ([]*model.Item, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.items(groupId, func(row *itemRow) bool { return !row.deleted && !row.trashed && rowHasTag(row, []string{tag}) })
+}
+
+// rowHasTag reports whether the data of row contains one of tags
+func rowHasTag(row *itemRow, tags []string) bool {
+	if row.data == nil {
+		return false
+	}
+	var data struct {
+		Tags []model.ItemTag `json:"tags"`
+	}
+	if err := json.Unmarshal(row.data, &data); err != nil {
+		return false
+	}
+	return slices.ContainsFunc(data.Tags, func(t model.ItemTag) bool { return slices.Contains(tags, t.Tag) })
+}
+
+func (s *Store) RenameTag(ctx context.Context, groupId int64, tag string, newName string) (int64, error) {
+	return s.MergeTags(ctx, groupId, []string{tag}, newName)
+}
+
+// MergeTags replaces tags by target in all items and in the tags of the
+// group like storage.Storage.MergeTags.
+func (s *Store) MergeTags(ctx context.Context, groupId int64, tags []string, target string) (int64, error) {
+	if target == "" {
+		return 0, errors.New("empty target tag")
+	}
+	tags = slices.DeleteFunc(slices.Clone(tags), func(tag string) bool { return tag == target })
+	if len(tags) == 0 {
+		return 0, nil
+	}
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("merging tags %v into %s", tags, target)
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	lib := s.library(groupId)
+	var num int64
+	for _, row := range lib.sortedItems() {
+		if row.deleted || !rowHasTag(row, tags) {
+			continue
+		}
+		item, err := itemFromRow(groupId, row)
+		if err != nil || item == nil {
+			continue
+		}
+		merged := make([]model.ItemTag, 0, len(item.Data.Tags))
+		for _, t := range item.Data.Tags {
+			if slices.Contains(tags, t.Tag) {
+				t.Tag = target
+			}
+			if !slices.ContainsFunc(merged, func(m model.ItemTag) bool { return m.Tag == t.Tag }) {
+				merged = append(merged, t)
+			}
+		}
+		item.Data.Tags = merged
+		data, err := json.Marshal(item.Data)
+		if err != nil {
+			return 0, errors.Wrapf(err, "cannot marshal data %v", item.Data)
+		}
+		s.updateItemRow(groupId, row, func(row *itemRow) {
+			row.data = data
+			if row.sync != model.SyncStatus_New {
+				row.sync = model.SyncStatus_Modified
+			}
+			row.modified = time.Now()
+		})
+		num++
+	}
+	if _, ok := lib.tags[target]; !ok {
+		for _, tag := range tags {
+			if t, ok := lib.tags[tag]; ok {
+				t.Tag = target
+				lib.tags[target] = t
+				break
+			}
+		}
+	}
+	for _, tag := range tags {
+		delete(lib.tags, tag)
+	}
+	return num, nil
+}
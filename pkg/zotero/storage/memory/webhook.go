@@ -0,0 +1,305 @@
+package memory
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"maps"
+	"slices"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+func copyWebhook(hook *model.Webhook) *model.Webhook {
+	result := *hook
+	result.Events = slices.Clone(hook.Events)
+	if result.Events == nil {
+		result.Events = []model.WebhookEvent{}
+	}
+	return &result
+}
+
+func copyWebhookDelivery(delivery *model.WebhookDelivery, withTarget bool) *model.WebhookDelivery {
+	result := *delivery
+	if delivery.Delivered != nil {
+		delivered := *delivery.Delivered
+		result.Delivered = &delivered
+	}
+	if withTarget {
+		result.Payload = slices.Clone(delivery.Payload)
+	} else {
+		result.Payload = nil
+		result.Url = ""
+		result.Secret = ""
+	}
+	return &result
+}
+
+// CreateWebhook stores hook and sets its id and creation time.
+func (s *Store) CreateWebhook(ctx context.Context, hook *model.Webhook) error {
+	s.mu.Lock()
+	defer s.unlock()
+	s.lastWebhook++
+	hook.Id = s.lastWebhook
+	hook.Created = time.Now()
+	s.webhooks[hook.Id] = copyWebhook(hook)
+	return nil
+}
+
+// UpdateWebhook stores url, events and active state of hook. The secret
+// cannot be changed.
+func (s *Store) UpdateWebhook(ctx context.Context, hook *model.Webhook) error {
+	s.mu.Lock()
+	defer s.unlock()
+	stored, ok := s.webhooks[hook.Id]
+	if !ok {
+		return errors.Errorf("webhook %v not found", hook.Id)
+	}
+	stored.Url = hook.Url
+	stored.Events = slices.Clone(hook.Events)
+	stored.Active = hook.Active
+	return nil
+}
+
+// DeleteWebhook removes the webhook and its pending deliveries.
+func (s *Store) DeleteWebhook(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.unlock()
+	delete(s.webhooks, id)
+	s.outbox = slices.DeleteFunc(s.outbox, func(delivery *model.WebhookDelivery) bool {
+		return delivery.WebhookId == id
+	})
+	return nil
+}
+
+// GetWebhook returns the webhook with the given id or nil.
+func (s *Store) GetWebhook(ctx context.Context, id int64) (*model.Webhook, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	hook, ok := s.webhooks[id]
+	if !ok {
+		return nil, nil
+	}
+	return copyWebhook(hook), nil
+}
+
+// GetWebhooks returns all webhooks of the group.
+func (s *Store) GetWebhooks(ctx context.Context, groupId int64) ([]*model.Webhook, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	hooks := []*model.Webhook{}
+	for _, hook := range s.webhooks {
+		if hook.GroupId == groupId {
+			hooks = append(hooks, copyWebhook(hook))
+		}
+	}
+	slices.SortFunc(hooks, func(a, b *model.Webhook) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return hooks, nil
+}
+
+// webhookEvent returns the event of a change of an item or collection like
+// the webhook triggers of the databases, "" if it is no change of the
+// object. oldData is nil for new objects; version only changes after an
+// upload are no change.
+func webhookEvent(oldData []byte, oldDeleted, oldTrashed bool, newData []byte, newDeleted, newTrashed bool) model.WebhookEvent {
+	switch {
+	case newData == nil:
+		return ""
+	case oldData == nil:
+		if newDeleted {
+			return ""
+		}
+		return model.WebhookEvent_Created
+	case newDeleted && !oldDeleted:
+		return model.WebhookEvent_Deleted
+	case newDeleted:
+		return ""
+	case oldDeleted || newTrashed != oldTrashed || !sameData(oldData, newData):
+		return model.WebhookEvent_Updated
+	}
+	return ""
+}
+
+// sameData reports whether the JSON objects a and b are equal except for
+// their version
+func sameData(a, b []byte) bool {
+	var objA, objB map[string]jsontext.Value
+	if json.Unmarshal(a, &objA) != nil || json.Unmarshal(b, &objB) != nil {
+		return bytes.Equal(a, b)
+	}
+	delete(objA, "version")
+	delete(objB, "version")
+	return maps.EqualFunc(objA, objB, func(x, y jsontext.Value) bool { return bytes.Equal(x, y) })
+}
+
+// itemEvents writes the webhook events of the change of an item from old,
+// nil for new items, to row. The store must be locked.
+func (s *Store) itemEvents(groupId int64, old, row *itemRow) {
+	var oldRow itemRow
+	if old != nil {
+		oldRow = *old
+	}
+	event := webhookEvent(oldRow.data, oldRow.deleted, oldRow.trashed, row.data, row.deleted, row.trashed)
+	// a new or changed file of an attachment
+	attachment := row.data != nil && !row.deleted && row.md5 != "" && row.md5 != oldRow.md5
+	if event == "" && !attachment {
+		return
+	}
+	item, err := itemFromRow(groupId, row)
+	if err != nil || item == nil {
+		if s.Logger != nil {
+			s.Logger.Error().Err(err).Msgf("cannot decode item %v.%v for webhooks", groupId, row.key)
+		}
+		return
+	}
+	payload := &model.WebhookPayload{
+		GroupId:    groupId,
+		ObjectType: "item",
+		Key:        item.Key,
+		Version:    item.Version,
+		Source:     model.WebhookSource(row.sync),
+		Timestamp:  time.Now(),
+		Item:       item,
+	}
+	if event != "" {
+		s.enqueueEvent(event, payload)
+	}
+	if attachment {
+		s.enqueueEvent(model.WebhookEvent_Attachment, payload)
+	}
+}
+
+// collectionEvents is itemEvents for collections
+func (s *Store) collectionEvents(groupId int64, old, row *collectionRow) {
+	var oldRow collectionRow
+	if old != nil {
+		oldRow = *old
+	}
+	event := webhookEvent(oldRow.data, oldRow.deleted, false, row.data, row.deleted, false)
+	if event == "" {
+		return
+	}
+	coll, err := collectionFromRow(groupId, row)
+	if err != nil || coll == nil {
+		if s.Logger != nil {
+			s.Logger.Error().Err(err).Msgf("cannot decode collection %v.%v for webhooks", groupId, row.key)
+		}
+		return
+	}
+	s.enqueueEvent(event, &model.WebhookPayload{
+		GroupId:    groupId,
+		ObjectType: "collection",
+		Key:        coll.Key,
+		Version:    coll.Version,
+		Source:     model.WebhookSource(row.sync),
+		Timestamp:  time.Now(),
+		Collection: coll,
+	})
+}
+
+// enqueueEvent writes payload with event to the outbox of every active
+// webhook of the group subscribed to it. The store must be locked.
+func (s *Store) enqueueEvent(event model.WebhookEvent, payload *model.WebhookPayload) {
+	payload.Event = event
+	data, err := json.Marshal(payload)
+	if err != nil {
+		if s.Logger != nil {
+			s.Logger.Error().Err(err).Msgf("cannot marshal %s event of %s %s", event, payload.ObjectType, payload.Key)
+		}
+		return
+	}
+	hooks := make([]*model.Webhook, 0)
+	for _, hook := range s.webhooks {
+		if hook.GroupId == payload.GroupId && hook.Subscribes(event) {
+			hooks = append(hooks, hook)
+		}
+	}
+	slices.SortFunc(hooks, func(a, b *model.Webhook) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	now := time.Now()
+	for _, hook := range hooks {
+		s.lastDelivery++
+		s.outbox = append(s.outbox, &model.WebhookDelivery{
+			Id:          s.lastDelivery,
+			WebhookId:   hook.Id,
+			Event:       event,
+			Status:      model.WebhookDeliveryStatus_Pending,
+			NextAttempt: now,
+			Created:     now,
+			Payload:     data,
+		})
+	}
+}
+
+// ClaimWebhookDeliveries returns at most limit pending deliveries, which are
+// due, with payload and target. They are not due again for lease.
+func (s *Store) ClaimWebhookDeliveries(ctx context.Context, limit int64, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	now := time.Now()
+	deliveries := []*model.WebhookDelivery{}
+	for _, delivery := range s.outbox {
+		if int64(len(deliveries)) >= limit {
+			break
+		}
+		if delivery.Status != model.WebhookDeliveryStatus_Pending || delivery.NextAttempt.After(now) {
+			continue
+		}
+		hook, ok := s.webhooks[delivery.WebhookId]
+		if !ok {
+			continue
+		}
+		delivery.NextAttempt = now.Add(lease)
+		claimed := copyWebhookDelivery(delivery, true)
+		claimed.Url = hook.Url
+		claimed.Secret = hook.Secret
+		deliveries = append(deliveries, claimed)
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery stores the result of a delivery attempt.
+func (s *Store) UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.unlock()
+	for _, stored := range s.outbox {
+		if stored.Id != delivery.Id {
+			continue
+		}
+		stored.Status = delivery.Status
+		stored.Attempts = delivery.Attempts
+		stored.NextAttempt = delivery.NextAttempt
+		stored.ResponseStatus = delivery.ResponseStatus
+		stored.LastError = delivery.LastError
+		stored.Delivered = nil
+		if delivery.Delivered != nil {
+			delivered := *delivery.Delivered
+			stored.Delivered = &delivered
+		}
+	}
+	return nil
+}
+
+// GetWebhookDeliveries returns the latest limit deliveries of the webhook,
+// newest first and without payload.
+func (s *Store) GetWebhookDeliveries(ctx context.Context, webhookId int64, limit int64) ([]*model.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	deliveries := []*model.WebhookDelivery{}
+	for _, delivery := range slices.Backward(s.outbox) {
+		if int64(len(deliveries)) >= limit {
+			break
+		}
+		if delivery.WebhookId == webhookId {
+			deliveries = append(deliveries, copyWebhookDelivery(delivery, false))
+		}
+	}
+	return deliveries, nil
+}
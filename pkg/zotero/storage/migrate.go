@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"embed"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var (
+	// ErrSchemaOutdated is returned by VerifySchema if migrations are pending
+	ErrSchemaOutdated = errors.New("database schema is outdated")
+	// ErrSchemaNewer is returned by VerifySchema if the database has been
+	// migrated by a newer release
+	ErrSchemaNewer = errors.New("database schema is newer than this release")
+)
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a versioned schema change with its up and down statements.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a migration together with the time it has been applied,
+// which is nil for pending migrations.
+type MigrationState struct {
+	Version int64      `json:"version"`
+	Name    string     `json:"name"`
+	Applied *time.Time `json:"applied,omitempty"`
+	// Unknown is set for migrations applied by a newer release
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// LoadMigrations reads the migrations in the directory migrations of fsys,
+// ordered by version. Every migration needs an up and a down file and
+// versions must be unique. Other backends use it for their own migrations.
+func LoadMigrations(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read migrations")
+	}
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		matches := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, errors.Errorf("invalid migration file name %s", entry.Name())
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, errors.Errorf("invalid migration version in %s", entry.Name())
+		}
+		data, err := fs.ReadFile(fsys, path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read migration %s", entry.Name())
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, errors.Errorf("migration %d has different names %s and %s", version, m.Name, matches[2])
+		}
+		if matches[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, errors.Errorf("migration %d_%s needs an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	slices.SortFunc(migrations, func(a, b *Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
+
+// Migrations returns the migrations embedded into this release, ordered by
+// version.
+func Migrations() ([]*Migration, error) {
+	return LoadMigrations(migrationFiles)
+}
+
+// LatestSchemaVersion returns the schema version this release expects.
+func LatestSchemaVersion() (int64, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// appliedMigrations returns the applied versions with their time. A database
+// without schema_migrations has no applied migrations.
+func (s *Storage) appliedMigrations(ctx context.Context, conn dbConn) (map[int64]*MigrationState, error) {
+	var exists bool
+	if err := conn.QueryRow(ctx, SQLSchemaMigrationsExists).Scan(&exists); err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLSchemaMigrationsExists)
+	}
+	applied := map[int64]*MigrationState{}
+	if !exists {
+		return applied, nil
+	}
+	rows, err := conn.Query(ctx, SQLGetSchemaMigrations)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetSchemaMigrations)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		state := &MigrationState{}
+		var appliedAt time.Time
+		if err := rows.Scan(&state.Version, &state.Name, &appliedAt); err != nil {
+			return nil, errors.Wrap(err, "cannot scan schema migration")
+		}
+		state.Applied = &appliedAt
+		applied[state.Version] = state
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate schema migrations")
+	}
+	return applied, nil
+}
+
+// SchemaVersion returns the highest applied migration or 0 for a database
+// without migrations.
+func (s *Storage) SchemaVersion(ctx context.Context) (int64, error) {
+	applied, err := s.appliedMigrations(ctx, s.db)
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// VerifySchema checks the schema version of the database against
+// LatestSchemaVersion. It returns ErrSchemaOutdated if migrations are pending
+// and ErrSchemaNewer if the database has been migrated by a newer release.
+// It is meant to be called right after NewStorage.
+func (s *Storage) VerifySchema(ctx context.Context) error {
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	current, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case current < latest:
+		return errors.Wrapf(ErrSchemaOutdated, "schema version %d, expected %d", current, latest)
+	case current > latest:
+		return errors.Wrapf(ErrSchemaNewer, "schema version %d, expected %d", current, latest)
+	}
+	return nil
+}
+
+// MigrationStatus returns all embedded migrations with their applied time
+// and the migrations applied by newer releases.
+func (s *Storage) MigrationStatus(ctx context.Context) ([]*MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]*MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := &MigrationState{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			state.Applied = a.Applied
+			delete(applied, m.Version)
+		}
+		states = append(states, state)
+	}
+	for _, a := range applied {
+		a.Unknown = true
+		states = append(states, a)
+	}
+	slices.SortFunc(states, func(a, b *MigrationState) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return states, nil
+}
+
+// migrate runs fn in a transaction, which holds the migration lock, so
+// concurrent migrations wait for each other.
+func (s *Storage) migrate(ctx context.Context, fn func(tx pgx.Tx, applied map[int64]*MigrationState) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, SQLLockSchemaMigrations); err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLLockSchemaMigrations)
+	}
+	if _, err := tx.Exec(ctx, SQLCreateSchemaMigrations); err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLCreateSchemaMigrations)
+	}
+	applied, err := s.appliedMigrations(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx, applied); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "cannot commit migrations")
+	}
+	return nil
+}
+
+// MigrateUp applies all pending migrations up to target, or all if target is
+// 0, and returns the applied ones. All migrations run in one transaction, so
+// either all of them are applied or none.
+func (s *Storage) MigrateUp(ctx context.Context, target int64) ([]*Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var done []*Migration
+	err = s.migrate(ctx, func(tx pgx.Tx, applied map[int64]*MigrationState) error {
+		for _, m := range migrations {
+			if target > 0 && m.Version > target {
+				break
+			}
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if s.Logger != nil {
+				s.Logger.Info().Msgf("applying migration %d_%s", m.Version, m.Name)
+			}
+			if _, err := tx.Exec(ctx, m.Up); err != nil {
+				return errors.Wrapf(err, "cannot apply migration %d_%s", m.Version, m.Name)
+			}
+			if _, err := tx.Exec(ctx, SQLInsertSchemaMigration, pgx.NamedArgs{"version": m.Version, "name": m.Name}); err != nil {
+				return errors.Wrapf(err, "cannot execute %s", SQLInsertSchemaMigration)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the latest steps applied migrations and returns the
+// reverted ones. Migrations applied by a newer release cannot be reverted.
+func (s *Storage) MigrateDown(ctx context.Context, steps int) ([]*Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var done []*Migration
+	err = s.migrate(ctx, func(tx pgx.Tx, applied map[int64]*MigrationState) error {
+		for _, a := range applied {
+			if !slices.ContainsFunc(migrations, func(m *Migration) bool { return m.Version == a.Version }) {
+				return errors.Wrapf(ErrSchemaNewer, "migration %d_%s is unknown", a.Version, a.Name)
+			}
+		}
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if s.Logger != nil {
+				s.Logger.Info().Msgf("reverting migration %d_%s", m.Version, m.Name)
+			}
+			if _, err := tx.Exec(ctx, m.Down); err != nil {
+				return errors.Wrapf(err, "cannot revert migration %d_%s", m.Version, m.Name)
+			}
+			if _, err := tx.Exec(ctx, SQLDeleteSchemaMigration, pgx.NamedArgs{"version": m.Version}); err != nil {
+				return errors.Wrapf(err, "cannot execute %s", SQLDeleteSchemaMigration)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
@@ -0,0 +1,8 @@
+-- The base schema holds the tables that existed before schema_migrations and
+-- was adopted by "migrate up", so reverting it would drop the data of
+-- existing installations. Only the migrations on top of it can be reverted.
+DO $$
+BEGIN
+    RAISE EXCEPTION 'base schema cannot be reverted';
+END
+$$;
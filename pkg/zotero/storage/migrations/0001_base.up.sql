@@ -0,0 +1,98 @@
+--
+-- Base schema of groups, items, collections and tags.
+-- Databases created before the migrations were introduced already contain
+-- these objects, so everything is created only if it is missing.
+--
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'syncdirection' AND typnamespace = 'public'::regnamespace) THEN
+        CREATE TYPE public.syncdirection AS ENUM ('none', 'tocloud', 'tolocal', 'bothcloud', 'bothlocal', 'bothmanual');
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'syncstatus' AND typnamespace = 'public'::regnamespace) THEN
+        CREATE TYPE public.syncstatus AS ENUM ('new', 'synced', 'modified', 'incomplete');
+    END IF;
+END;
+$$;
+
+CREATE TABLE IF NOT EXISTS public.groups (
+    id bigint NOT NULL,
+    version bigint NOT NULL,
+    created timestamp without time zone NOT NULL,
+    modified timestamp without time zone NOT NULL,
+    data jsonb,
+    deleted boolean DEFAULT false NOT NULL,
+    CONSTRAINT groups_pkey PRIMARY KEY (id)
+);
+
+ALTER TABLE public.groups ADD COLUMN IF NOT EXISTS itemversion bigint DEFAULT 0 NOT NULL;
+ALTER TABLE public.groups ADD COLUMN IF NOT EXISTS collectionversion bigint DEFAULT 0 NOT NULL;
+ALTER TABLE public.groups ADD COLUMN IF NOT EXISTS tagversion bigint DEFAULT 0 NOT NULL;
+ALTER TABLE public.groups ADD COLUMN IF NOT EXISTS gitlab timestamp without time zone;
+
+CREATE TABLE IF NOT EXISTS public.syncgroups (
+    id bigint NOT NULL,
+    active boolean DEFAULT true NOT NULL,
+    direction public.syncdirection DEFAULT 'none'::public.syncdirection NOT NULL,
+    tags boolean DEFAULT false NOT NULL,
+    CONSTRAINT syncgroups_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS public.collections (
+    key character(8) NOT NULL,
+    version bigint NOT NULL,
+    data jsonb,
+    library bigint NOT NULL,
+    deleted boolean DEFAULT false NOT NULL,
+    sync public.syncstatus DEFAULT 'incomplete'::public.syncstatus,
+    meta jsonb,
+    CONSTRAINT pkey PRIMARY KEY (key, library)
+);
+
+ALTER TABLE public.collections ADD COLUMN IF NOT EXISTS modified timestamp without time zone DEFAULT now() NOT NULL;
+ALTER TABLE public.collections ADD COLUMN IF NOT EXISTS gitlab timestamp without time zone;
+
+CREATE TABLE IF NOT EXISTS public.items (
+    key character(8) NOT NULL,
+    version bigint DEFAULT 0 NOT NULL,
+    meta jsonb,
+    data jsonb,
+    library bigint NOT NULL,
+    trashed boolean DEFAULT false NOT NULL,
+    deleted boolean DEFAULT false NOT NULL,
+    sync public.syncstatus DEFAULT 'new'::public.syncstatus NOT NULL,
+    md5 character varying(126),
+    oldid character varying,
+    CONSTRAINT items_primary PRIMARY KEY (key, library),
+    CONSTRAINT items_oldid_constraint UNIQUE (library, oldid)
+);
+
+ALTER TABLE public.items ADD COLUMN IF NOT EXISTS modified timestamp without time zone DEFAULT now() NOT NULL;
+ALTER TABLE public.items ADD COLUMN IF NOT EXISTS gitlab timestamp without time zone;
+
+CREATE INDEX IF NOT EXISTS itemd_oldid_idx ON public.items USING btree (oldid);
+
+CREATE TABLE IF NOT EXISTS public.tags (
+    tag character varying(255) NOT NULL,
+    meta jsonb,
+    library bigint NOT NULL,
+    CONSTRAINT pk_tags PRIMARY KEY (tag, library)
+);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS public.collection_name_hier AS
+    SELECT key, library, data->>'name' AS name, data->>'parentCollection' AS parent
+    FROM public.collections
+    WHERE data IS NOT NULL;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS public.item_type_hier AS
+    SELECT key, library, data->>'itemType' AS type, data->>'parentItem' AS parent
+    FROM public.items
+    WHERE data IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION public.refresh_item_type_hier() RETURNS void
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    REFRESH MATERIALIZED VIEW public.item_type_hier WITH DATA;
+END;
+$$;
@@ -0,0 +1,17 @@
+--
+-- Local API keys for the REST service (cmd/rest).
+-- tokenhash is the hex encoded SHA-256 of the token, see storage.HashApiToken.
+-- access uses the Zotero key format:
+--   {"groups": {"all": {"library": true}, "1234": {"library": true, "write": true}}}
+--
+
+CREATE TABLE IF NOT EXISTS public.apikeys (
+    tokenhash text NOT NULL,
+    name text NOT NULL,
+    userid bigint DEFAULT 0 NOT NULL,
+    username text,
+    access jsonb DEFAULT '{}'::jsonb NOT NULL,
+    active boolean DEFAULT true NOT NULL,
+    created timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT apikeys_pkey PRIMARY KEY (tokenhash)
+);
@@ -0,0 +1,28 @@
+--
+-- History of group synchronizations (pkg/zotero/sync.Runner).
+-- At most one queued or running run per group is enforced by sync_runs_active.
+--
+
+CREATE TABLE IF NOT EXISTS public.sync_runs (
+    id bigserial NOT NULL,
+    groupid bigint NOT NULL,
+    status text DEFAULT 'queued' NOT NULL,
+    trigger text NOT NULL,
+    requestedby text,
+    requested timestamp with time zone DEFAULT now() NOT NULL,
+    started timestamp with time zone,
+    finished timestamp with time zone,
+    stage text,
+    collections bigint DEFAULT 0 NOT NULL,
+    uploaded bigint DEFAULT 0 NOT NULL,
+    downloaded bigint DEFAULT 0 NOT NULL,
+    tags bigint DEFAULT 0 NOT NULL,
+    deleted bigint DEFAULT 0 NOT NULL,
+    error text,
+    CONSTRAINT sync_runs_pkey PRIMARY KEY (id),
+    CONSTRAINT sync_runs_status_check CHECK (status IN ('queued', 'running', 'succeeded', 'failed'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS sync_runs_active ON public.sync_runs USING btree (groupid) WHERE status IN ('queued', 'running');
+
+CREATE INDEX IF NOT EXISTS sync_runs_groupid ON public.sync_runs USING btree (groupid, id DESC);
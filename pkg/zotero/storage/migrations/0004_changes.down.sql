@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS collections_changes ON public.collections;
+DROP TRIGGER IF EXISTS items_changes ON public.items;
+DROP FUNCTION IF EXISTS public.log_change();
+DROP TABLE IF EXISTS public.changes;
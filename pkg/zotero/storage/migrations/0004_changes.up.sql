@@ -0,0 +1,68 @@
+--
+-- Change log of items and collections for the change feed of the rest
+-- service (GET /{groupid}/changes).
+-- Every insert, update and delete appends a row and notifies the channel
+-- zsync_changes with {"library": ..., "seq": ...} on commit.
+-- Writers of the same library are serialized by an advisory lock, so seq
+-- grows in commit order and a reader never misses a change behind its cursor.
+--
+
+CREATE TABLE IF NOT EXISTS public.changes (
+    seq bigserial NOT NULL,
+    library bigint NOT NULL,
+    objecttype text NOT NULL,
+    key character(8) NOT NULL,
+    version bigint NOT NULL,
+    sync public.syncstatus,
+    changetype text NOT NULL,
+    changed timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT changes_pkey PRIMARY KEY (seq),
+    CONSTRAINT changes_objecttype_check CHECK (objecttype IN ('item', 'collection')),
+    CONSTRAINT changes_changetype_check CHECK (changetype IN ('create', 'update', 'delete'))
+);
+
+CREATE INDEX IF NOT EXISTS changes_library ON public.changes USING btree (library, seq);
+
+CREATE OR REPLACE FUNCTION public.log_change() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+    rec record;
+    kind text;
+    newseq bigint;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        rec := OLD;
+        kind := 'delete';
+    ELSIF TG_OP = 'INSERT' THEN
+        rec := NEW;
+        kind := 'create';
+    ELSE
+        -- bookkeeping columns like gitlab and meta are no change of the object
+        IF NEW.version IS NOT DISTINCT FROM OLD.version AND NEW.sync IS NOT DISTINCT FROM OLD.sync
+            AND NEW.deleted = OLD.deleted AND NEW.data IS NOT DISTINCT FROM OLD.data THEN
+            RETURN NULL;
+        END IF;
+        rec := NEW;
+        IF NEW.deleted AND NOT OLD.deleted THEN
+            kind := 'delete';
+        ELSE
+            kind := 'update';
+        END IF;
+    END IF;
+    PERFORM pg_advisory_xact_lock(hashtextextended('changes:' || rec.library, 0));
+    INSERT INTO public.changes (library, objecttype, key, version, sync, changetype)
+        VALUES (rec.library, TG_ARGV[0], rec.key, rec.version, rec.sync, kind)
+        RETURNING seq INTO newseq;
+    PERFORM pg_notify('zsync_changes', json_build_object('library', rec.library, 'seq', newseq)::text);
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS items_changes ON public.items;
+CREATE TRIGGER items_changes AFTER INSERT OR DELETE OR UPDATE ON public.items
+    FOR EACH ROW EXECUTE FUNCTION public.log_change('item');
+
+DROP TRIGGER IF EXISTS collections_changes ON public.collections;
+CREATE TRIGGER collections_changes AFTER INSERT OR DELETE OR UPDATE ON public.collections
+    FOR EACH ROW EXECUTE FUNCTION public.log_change('collection');
@@ -0,0 +1,39 @@
+--
+-- Webhook subscriptions per group and their outbox (pkg/zotero/webhook).
+-- Events are written to webhook_outbox by the sync and the rest service and
+-- delivered with retries by webhook.Dispatcher.
+--
+
+CREATE TABLE IF NOT EXISTS public.webhooks (
+    id bigserial NOT NULL,
+    groupid bigint NOT NULL,
+    url text NOT NULL,
+    secret text NOT NULL,
+    events text[] NOT NULL,
+    active boolean DEFAULT true NOT NULL,
+    created timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT webhooks_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_groupid ON public.webhooks USING btree (groupid);
+
+CREATE TABLE IF NOT EXISTS public.webhook_outbox (
+    id bigserial NOT NULL,
+    webhookid bigint NOT NULL,
+    event text NOT NULL,
+    payload jsonb NOT NULL,
+    status text DEFAULT 'pending' NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    nextattempt timestamp with time zone DEFAULT now() NOT NULL,
+    responsestatus integer,
+    lasterror text,
+    created timestamp with time zone DEFAULT now() NOT NULL,
+    delivered timestamp with time zone,
+    CONSTRAINT webhook_outbox_pkey PRIMARY KEY (id),
+    CONSTRAINT webhook_outbox_webhookid_fkey FOREIGN KEY (webhookid) REFERENCES public.webhooks(id) ON DELETE CASCADE,
+    CONSTRAINT webhook_outbox_status_check CHECK (status IN ('pending', 'delivered', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS webhook_outbox_pending ON public.webhook_outbox USING btree (nextattempt) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS webhook_outbox_webhookid ON public.webhook_outbox USING btree (webhookid, id DESC);
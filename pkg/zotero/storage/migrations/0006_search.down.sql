@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS items_search ON public.items;
+DROP FUNCTION IF EXISTS public.item_search_update();
+DROP FUNCTION IF EXISTS public.item_search_upsert(text, bigint, jsonb);
+DROP TABLE IF EXISTS public.item_search;
+DROP FUNCTION IF EXISTS public.item_search_document();
+DROP FUNCTION IF EXISTS public.search_config(text);
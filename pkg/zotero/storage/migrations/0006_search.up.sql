@@ -0,0 +1,106 @@
+--
+-- Full-text search over items (Storage.SearchItems).
+-- item_search holds the searchable text of every item with data and is kept
+-- current by a trigger on items. The document combines the stemmed words of
+-- the language of the item with the unstemmed words of the configuration
+-- simple, so queries without a language match exact words of every item.
+-- Weights: A title, B creators and tags, C abstract and note, D attachment
+-- full text set by Storage.SetItemFulltext.
+--
+
+CREATE OR REPLACE FUNCTION public.search_config(lang text) RETURNS regconfig
+    LANGUAGE sql IMMUTABLE
+    AS $$
+SELECT (CASE
+    WHEN l IN ('danish', 'dansk') OR p = 'da' THEN 'danish'
+    WHEN l IN ('german', 'deutsch') OR p = 'de' THEN 'german'
+    WHEN l = 'english' OR p = 'en' THEN 'english'
+    WHEN l IN ('spanish', 'español') OR p = 'es' THEN 'spanish'
+    WHEN l IN ('finnish', 'suomi') OR p = 'fi' THEN 'finnish'
+    WHEN l IN ('french', 'français') OR p = 'fr' THEN 'french'
+    WHEN l IN ('hungarian', 'magyar') OR p = 'hu' THEN 'hungarian'
+    WHEN l IN ('italian', 'italiano') OR p = 'it' THEN 'italian'
+    WHEN l IN ('dutch', 'nederlands') OR p = 'nl' THEN 'dutch'
+    WHEN l IN ('norwegian', 'norsk') OR p IN ('no', 'nb', 'nn') THEN 'norwegian'
+    WHEN l IN ('portuguese', 'português') OR p = 'pt' THEN 'portuguese'
+    WHEN l IN ('romanian', 'română') OR p = 'ro' THEN 'romanian'
+    WHEN l IN ('russian', 'русский') OR p = 'ru' THEN 'russian'
+    WHEN l IN ('swedish', 'svenska') OR p = 'sv' THEN 'swedish'
+    WHEN l IN ('turkish', 'türkçe') OR p = 'tr' THEN 'turkish'
+    ELSE 'simple'
+END)::regconfig
+FROM (SELECT lower(trim(COALESCE(lang, ''))) AS l) s
+CROSS JOIN LATERAL (SELECT split_part(split_part(s.l, '-', 1), '_', 1) AS p) c;
+$$;
+
+CREATE TABLE IF NOT EXISTS public.item_search (
+    key character(8) NOT NULL,
+    library bigint NOT NULL,
+    config regconfig DEFAULT 'simple'::regconfig NOT NULL,
+    title text DEFAULT '' NOT NULL,
+    creators text DEFAULT '' NOT NULL,
+    body text DEFAULT '' NOT NULL,
+    fulltext text DEFAULT '' NOT NULL,
+    document tsvector NOT NULL,
+    CONSTRAINT item_search_pkey PRIMARY KEY (key, library),
+    CONSTRAINT item_search_items_fkey FOREIGN KEY (key, library) REFERENCES public.items (key, library) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS item_search_document ON public.item_search USING gin (document);
+
+-- the full text is cut, because a tsvector is limited to 1MB
+CREATE OR REPLACE FUNCTION public.item_search_document() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+    ft text;
+BEGIN
+    ft := left(NEW.fulltext, 200000);
+    NEW.document :=
+        setweight(to_tsvector(NEW.config, NEW.title), 'A') || setweight(to_tsvector('simple', NEW.title), 'A') ||
+        setweight(to_tsvector(NEW.config, NEW.creators), 'B') || setweight(to_tsvector('simple', NEW.creators), 'B') ||
+        setweight(to_tsvector(NEW.config, NEW.body), 'C') || setweight(to_tsvector('simple', NEW.body), 'C') ||
+        setweight(to_tsvector(NEW.config, ft), 'D') || setweight(to_tsvector('simple', ft), 'D');
+    RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS item_search_document ON public.item_search;
+CREATE TRIGGER item_search_document BEFORE INSERT OR UPDATE ON public.item_search
+    FOR EACH ROW EXECUTE FUNCTION public.item_search_document();
+
+-- item_search_upsert stores the searchable text of an item; the full text
+-- of attachments is kept.
+CREATE OR REPLACE FUNCTION public.item_search_upsert(itemkey text, lib bigint, d jsonb) RETURNS void
+    LANGUAGE sql
+    AS $$
+INSERT INTO public.item_search (key, library, config, title, creators, body)
+SELECT itemkey, lib, public.search_config(d->>'language'), COALESCE(d->>'title', ''),
+    concat_ws(' ',
+        (SELECT string_agg(concat_ws(' ', c->>'firstName', c->>'lastName', c->>'name'), ' ')
+            FROM jsonb_array_elements(CASE WHEN jsonb_typeof(d->'creators') = 'array' THEN d->'creators' ELSE '[]'::jsonb END) c),
+        (SELECT string_agg(t->>'tag', ' ')
+            FROM jsonb_array_elements(CASE WHEN jsonb_typeof(d->'tags') = 'array' THEN d->'tags' ELSE '[]'::jsonb END) t)),
+    concat_ws(' ', d->>'abstractNote', regexp_replace(d->>'note', '<[^>]*>', ' ', 'g'))
+ON CONFLICT (key, library) DO UPDATE SET config = EXCLUDED.config, title = EXCLUDED.title,
+    creators = EXCLUDED.creators, body = EXCLUDED.body;
+$$;
+
+CREATE OR REPLACE FUNCTION public.item_search_update() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    IF NEW.data IS NULL THEN
+        DELETE FROM public.item_search WHERE key = NEW.key AND library = NEW.library;
+    ELSE
+        PERFORM public.item_search_upsert(NEW.key, NEW.library, NEW.data);
+    END IF;
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS items_search ON public.items;
+CREATE TRIGGER items_search AFTER INSERT OR UPDATE OF data ON public.items
+    FOR EACH ROW EXECUTE FUNCTION public.item_search_update();
+
+SELECT public.item_search_upsert(key, library, data) FROM public.items WHERE data IS NOT NULL;
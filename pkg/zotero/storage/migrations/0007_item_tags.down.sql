@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS items_tags ON public.items;
+DROP FUNCTION IF EXISTS public.item_tags_update();
+DROP FUNCTION IF EXISTS public.item_tags_set(text, bigint, jsonb);
+DROP TABLE IF EXISTS public.item_tags;
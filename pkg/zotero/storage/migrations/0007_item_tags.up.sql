@@ -0,0 +1,44 @@
+--
+-- Relation of items and their tags (GetItemsByTag, GetTagUsage, MergeTags).
+-- item_tags holds one row per tag in items.data->tags and is kept current by
+-- a trigger on items.
+--
+
+CREATE TABLE IF NOT EXISTS public.item_tags (
+    key character(8) NOT NULL,
+    library bigint NOT NULL,
+    tag text NOT NULL,
+    type integer DEFAULT 0 NOT NULL,
+    CONSTRAINT item_tags_pkey PRIMARY KEY (library, key, tag),
+    CONSTRAINT item_tags_items_fkey FOREIGN KEY (key, library) REFERENCES public.items (key, library) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS item_tags_tag ON public.item_tags USING btree (library, tag);
+
+-- item_tags_set replaces the tags of an item; duplicate names keep the first
+-- type.
+CREATE OR REPLACE FUNCTION public.item_tags_set(itemkey text, lib bigint, d jsonb) RETURNS void
+    LANGUAGE sql
+    AS $$
+DELETE FROM public.item_tags WHERE key = itemkey AND library = lib;
+INSERT INTO public.item_tags (key, library, tag, type)
+SELECT DISTINCT ON (t.value->>'tag') itemkey, lib, t.value->>'tag', COALESCE((t.value->>'type')::integer, 0)
+FROM jsonb_array_elements(CASE WHEN jsonb_typeof(d->'tags') = 'array' THEN d->'tags' ELSE '[]'::jsonb END) WITH ORDINALITY t(value, ord)
+WHERE COALESCE(t.value->>'tag', '') <> ''
+ORDER BY t.value->>'tag', t.ord;
+$$;
+
+CREATE OR REPLACE FUNCTION public.item_tags_update() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    PERFORM public.item_tags_set(NEW.key, NEW.library, NEW.data);
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS items_tags ON public.items;
+CREATE TRIGGER items_tags AFTER INSERT OR UPDATE OF data ON public.items
+    FOR EACH ROW EXECUTE FUNCTION public.item_tags_update();
+
+SELECT public.item_tags_set(key, library, data) FROM public.items WHERE data IS NOT NULL;
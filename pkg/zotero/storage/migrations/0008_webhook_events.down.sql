@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS collections_webhooks ON public.collections;
+DROP TRIGGER IF EXISTS items_webhooks ON public.items;
+DROP FUNCTION IF EXISTS public.webhook_collection_events();
+DROP FUNCTION IF EXISTS public.webhook_item_events();
+DROP FUNCTION IF EXISTS public.webhook_event(text, jsonb, boolean, boolean, jsonb, boolean, boolean);
+DROP FUNCTION IF EXISTS public.webhook_enqueue(bigint, text, jsonb);
@@ -0,0 +1,116 @@
+--
+-- Webhook events of items and collections. Triggers write the events to
+-- webhook_outbox in the transaction of the change, so an event is stored if
+-- and only if its change is committed, whoever wrote it.
+-- Changes of objects in sync with Zotero, i.e. downloaded by the syncer, have
+-- the source "sync", all others "local". Placeholders without data have no
+-- events; version only changes after an upload are no change of the object.
+--
+
+-- webhook_enqueue writes payload with event ev to the outbox of every active
+-- webhook of the library subscribed to ev.
+CREATE OR REPLACE FUNCTION public.webhook_enqueue(lib bigint, ev text, payload jsonb) RETURNS void
+    LANGUAGE sql
+    AS $$
+    INSERT INTO public.webhook_outbox (webhookid, event, payload)
+        SELECT id, ev, payload || jsonb_build_object('event', ev)
+        FROM public.webhooks
+        WHERE groupid = lib AND active AND ev = ANY(events)
+        ORDER BY id;
+$$;
+
+-- webhook_event returns the event of a change of an item or collection or
+-- NULL if it is no change of the object.
+CREATE OR REPLACE FUNCTION public.webhook_event(op text, olddata jsonb, olddeleted boolean, oldtrashed boolean, newdata jsonb, newdeleted boolean, newtrashed boolean) RETURNS text
+    LANGUAGE sql IMMUTABLE
+    AS $$
+    SELECT CASE
+        WHEN newdata IS NULL THEN NULL
+        WHEN op = 'INSERT' OR olddata IS NULL THEN CASE WHEN newdeleted THEN NULL ELSE 'created' END
+        WHEN newdeleted AND NOT olddeleted THEN 'deleted'
+        WHEN newdeleted THEN NULL
+        WHEN olddeleted OR newtrashed <> oldtrashed OR newdata - 'version' IS DISTINCT FROM olddata - 'version' THEN 'updated'
+    END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.webhook_item_events() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+    event text;
+    attachment boolean;
+    payload jsonb;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        event := public.webhook_event(TG_OP, NULL, false, false, NEW.data, NEW.deleted, NEW.trashed);
+        attachment := NEW.md5 IS NOT NULL;
+    ELSE
+        event := public.webhook_event(TG_OP, OLD.data, OLD.deleted, OLD.trashed, NEW.data, NEW.deleted, NEW.trashed);
+        attachment := NEW.md5 IS NOT NULL AND NEW.md5 IS DISTINCT FROM OLD.md5;
+    END IF;
+    -- a new or changed file of an attachment
+    attachment := attachment AND NEW.data IS NOT NULL AND NOT NEW.deleted;
+    IF event IS NULL AND NOT attachment THEN
+        RETURN NULL;
+    END IF;
+    payload := jsonb_build_object(
+        'groupId', NEW.library,
+        'objectType', 'item',
+        'key', NEW.key,
+        'version', NEW.version,
+        'source', CASE WHEN NEW.sync = 'synced' THEN 'sync' ELSE 'local' END,
+        'timestamp', now(),
+        'item', jsonb_build_object(
+            'key', NEW.key,
+            'version', NEW.version,
+            'library', jsonb_build_object('type', 'group', 'id', NEW.library, 'name', '', 'links', NULL),
+            'meta', COALESCE(NEW.meta, '{}'::jsonb),
+            'data', NEW.data || jsonb_build_object('key', NEW.key, 'version', NEW.version)));
+    IF event IS NOT NULL THEN
+        PERFORM public.webhook_enqueue(NEW.library, event, payload);
+    END IF;
+    IF attachment THEN
+        PERFORM public.webhook_enqueue(NEW.library, 'attachment', payload);
+    END IF;
+    RETURN NULL;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.webhook_collection_events() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+    event text;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        event := public.webhook_event(TG_OP, NULL, false, false, NEW.data, NEW.deleted, false);
+    ELSE
+        event := public.webhook_event(TG_OP, OLD.data, OLD.deleted, false, NEW.data, NEW.deleted, false);
+    END IF;
+    IF event IS NULL THEN
+        RETURN NULL;
+    END IF;
+    PERFORM public.webhook_enqueue(NEW.library, event, jsonb_build_object(
+        'groupId', NEW.library,
+        'objectType', 'collection',
+        'key', NEW.key,
+        'version', NEW.version,
+        'source', CASE WHEN NEW.sync = 'synced' THEN 'sync' ELSE 'local' END,
+        'timestamp', now(),
+        'collection', jsonb_build_object(
+            'key', NEW.key,
+            'version', NEW.version,
+            'library', jsonb_build_object('type', 'group', 'id', NEW.library, 'name', '', 'links', NULL),
+            'meta', COALESCE(NEW.meta, '{}'::jsonb),
+            'data', NEW.data)));
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS items_webhooks ON public.items;
+CREATE TRIGGER items_webhooks AFTER INSERT OR UPDATE ON public.items
+    FOR EACH ROW EXECUTE FUNCTION public.webhook_item_events();
+
+DROP TRIGGER IF EXISTS collections_webhooks ON public.collections;
+CREATE TRIGGER collections_webhooks AFTER INSERT OR UPDATE ON public.collections
+    FOR EACH ROW EXECUTE FUNCTION public.webhook_collection_events();
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// PurgeItems removes the items of the group that are marked as deleted,
+// synced and last modified before before. Their search and tag index rows
+// are removed with them.
+func (s *Storage) PurgeItems(ctx context.Context, groupId int64, before time.Time) (int64, error) {
+	return s.purge(ctx, SQLPurgeItems, groupId, before)
+}
+
+// PurgeCollections removes the collections of the group that are marked as
+// deleted, synced and last modified before before.
+func (s *Storage) PurgeCollections(ctx context.Context, groupId int64, before time.Time) (int64, error) {
+	return s.purge(ctx, SQLPurgeCollections, groupId, before)
+}
+
+func (s *Storage) purge(ctx context.Context, sqlstr string, groupId int64, before time.Time) (int64, error) {
+	params := pgx.NamedArgs{
+		"library": groupId,
+		"sync":    model.SyncStatusString[model.SyncStatus_Synced],
+		"before":  before.Format("2006-01-02 15:04:05"),
+	}
+	tag, err := s.db.Exec(ctx, sqlstr, params)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot execute %s: %v", sqlstr, params)
+	}
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("%v rows of group %v purged", tag.RowsAffected(), groupId)
+	}
+	return tag.RowsAffected(), nil
+}
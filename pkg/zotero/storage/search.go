@@ -0,0 +1,467 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"emperror.dev/errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// SearchLanguages maps language codes and names of the item field language
+// to PostgreSQL text search configurations. It mirrors the function
+// search_config of migration 0006; everything else is indexed with the
+// configuration simple.
+var SearchLanguages = map[string]string{
+	"da": "danish", "danish": "danish", "dansk": "danish",
+	"de": "german", "german": "german", "deutsch": "german",
+	"en": "english", "english": "english",
+	"es": "spanish", "spanish": "spanish", "español": "spanish",
+	"fi": "finnish", "finnish": "finnish", "suomi": "finnish",
+	"fr": "french", "french": "french", "français": "french",
+	"hu": "hungarian", "hungarian": "hungarian", "magyar": "hungarian",
+	"it": "italian", "italian": "italian", "italiano": "italian",
+	"nl": "dutch", "dutch": "dutch", "nederlands": "dutch",
+	"no": "norwegian", "nb": "norwegian", "nn": "norwegian", "norwegian": "norwegian", "norsk": "norwegian",
+	"pt": "portuguese", "portuguese": "portuguese", "português": "portuguese",
+	"ro": "romanian", "romanian": "romanian", "română": "romanian",
+	"ru": "russian", "russian": "russian", "русский": "russian",
+	"sv": "swedish", "swedish": "swedish", "svenska": "swedish",
+	"tr": "turkish", "turkish": "turkish", "türkçe": "turkish",
+}
+
+// SearchConfig returns the text search configuration of a language like
+// "en-US", "de" or "German" and whether the language is known.
+func SearchConfig(language string) (string, bool) {
+	lang := strings.ToLower(strings.TrimSpace(language))
+	if config, ok := SearchLanguages[lang]; ok {
+		return config, true
+	}
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		if config, ok := SearchLanguages[lang[:i]]; ok {
+			return config, true
+		}
+	}
+	return "simple", false
+}
+
+// SearchFilter restricts the items of SearchItems like the filters of
+// ItemQuery.
+type SearchFilter struct {
+	ItemType       string
+	Tags           []string
+	Collection     string
+	IncludeTrashed bool
+	// Language parses the query with the stemming of a language, e.g. "en"
+	// or "german". Without it words must match exactly.
+	Language string
+}
+
+// ItemQuery returns the ItemQuery with the filters of f. f may be nil.
+func (f *SearchFilter) ItemQuery() *ItemQuery {
+	if f == nil {
+		return &ItemQuery{}
+	}
+	return &ItemQuery{
+		ItemType:       f.ItemType,
+		Tags:           f.Tags,
+		Collection:     f.Collection,
+		IncludeTrashed: f.IncludeTrashed,
+	}
+}
+
+// config returns the text search configuration of the query
+func (f *SearchFilter) config() (string, error) {
+	if f == nil || f.Language == "" {
+		return "simple", nil
+	}
+	config, ok := SearchConfig(f.Language)
+	if !ok {
+		return "", errors.Wrapf(ErrInvalidQuery, "unsupported language %q", f.Language)
+	}
+	return config, nil
+}
+
+// Page selects a window of a result list.
+type Page struct {
+	Start int64
+	Limit int64
+}
+
+// PageLimit returns Limit bounded by DefaultQueryLimit and MaxQueryLimit.
+// p may be nil.
+func (p *Page) PageLimit() int64 {
+	if p == nil {
+		return DefaultQueryLimit
+	}
+	return pageLimit(p.Limit)
+}
+
+// Offset returns Start; p may be nil.
+func (p *Page) Offset() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.Start
+}
+
+// SearchHighlights contains the matching words of a search result marked
+// with <b> and </b>.
+type SearchHighlights struct {
+	Title string `json:"title,omitempty"`
+	// Snippet is an excerpt of abstract, note or attachment full text
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// SearchResult is an item found by SearchItems.
+type SearchResult struct {
+	Item       *model.Item      `json:"item"`
+	Rank       float64          `json:"rank"`
+	Highlights SearchHighlights `json:"highlights"`
+}
+
+// SearchStore provides the full-text search over items. Besides the item
+// data it indexes the full text of attachments set with SetItemFulltext.
+type SearchStore interface {
+	SearchItems(ctx context.Context, groupId int64, query string, filter *SearchFilter, page *Page) ([]*SearchResult, int64, error)
+	SetItemFulltext(ctx context.Context, groupId int64, key string, content string) error
+}
+
+// SearchItems returns one page of the items of group groupId matching the
+// web search syntax query ("quoted phrases", or, -excluded) ordered by rank,
+// and the total number of matching items.
+func (s *Storage) SearchItems(ctx context.Context, groupId int64, query string, filter *SearchFilter, page *Page) ([]*SearchResult, int64, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, 0, errors.Wrap(ErrInvalidQuery, "empty search query")
+	}
+	if page.Offset() < 0 {
+		return nil, 0, errors.Wrapf(ErrInvalidQuery, "invalid start %d", page.Offset())
+	}
+	config, err := filter.config()
+	if err != nil {
+		return nil, 0, err
+	}
+	params := pgx.NamedArgs{
+		"library": groupId,
+		"query":   query,
+		"config":  config,
+	}
+	where, err := filter.ItemQuery().where(params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	countstr := SQLSearchItemsCount + where
+	var total int64
+	if err := s.db.QueryRow(ctx, countstr, params).Scan(&total); err != nil {
+		return nil, 0, errors.Wrapf(err, "cannot execute %s: %v", countstr, params)
+	}
+	if total == 0 || page.Offset() >= total {
+		return []*SearchResult{}, total, nil
+	}
+
+	params["start"] = page.Offset()
+	params["limit"] = page.PageLimit()
+	sqlstr := SQLSearchItems + where + " ORDER BY rank DESC, i.key OFFSET @start LIMIT @limit"
+	rows, err := s.db.Query(ctx, sqlstr, params)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "cannot execute %s: %v", sqlstr, params)
+	}
+	defer rows.Close()
+	results := []*SearchResult{}
+	for rows.Next() {
+		result := &SearchResult{}
+		item, err := s.itemFromRow(groupId, searchRow{row: rows, result: result})
+		if err != nil {
+			if errors.Is(err, errEmptyItem) {
+				if s.Logger != nil {
+					s.Logger.Warn().Err(err).Msg("item is empty. skipping")
+				}
+				continue
+			}
+			return nil, 0, errors.Wrapf(err, "cannot scan row")
+		}
+		if item == nil {
+			continue
+		}
+		result.Item = item
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, errors.Wrapf(err, "cannot read rows of %s", sqlstr)
+	}
+	return results, total, nil
+}
+
+// searchRow scans the item columns of SQLSearchItems for itemFromRow and the
+// rank and highlights into result.
+type searchRow struct {
+	row    pgx.Row
+	result *SearchResult
+}
+
+func (r searchRow) Scan(dest ...any) error {
+	return r.row.Scan(append(dest, &r.result.Rank, &r.result.Highlights.Title, &r.result.Highlights.Snippet)...)
+}
+
+// SetItemFulltext sets the extracted text of an attachment, which is
+// indexed together with the item data. The item must exist.
+func (s *Storage) SetItemFulltext(ctx context.Context, groupId int64, key string, content string) error {
+	params := pgx.NamedArgs{
+		"library": groupId,
+		"key":     key,
+		"content": content,
+	}
+	tag, err := s.db.Exec(ctx, SQLSetItemFulltext, params)
+	if err != nil {
+		return errors.Wrapf(err, "cannot execute %s: %v", SQLSetItemFulltext, params)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.Errorf("item %v.%v not found", groupId, key)
+	}
+	return nil
+}
+
+// searchTerm is a word or phrase of a search query, or the operator or
+type searchTerm struct {
+	words  []string
+	negate bool
+	or     bool
+}
+
+// SearchMatcher evaluates a search query on items for stores without a
+// text search index. It understands the web search syntax of SearchItems
+// but matches words exactly, like the configuration simple.
+type SearchMatcher struct {
+	// clauses must all match; each clause matches if one of its terms does
+	clauses [][]searchTerm
+	words   map[string]bool
+}
+
+// searchWords splits s into lower case words with their byte offsets
+func searchWords(s string) ([]string, [][2]int) {
+	var words []string
+	var spans [][2]int
+	start := -1
+	for i, r := range s {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			words = append(words, strings.ToLower(s[start:i]))
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, strings.ToLower(s[start:]))
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return words, spans
+}
+
+// parseSearchTerms splits query into words, "quoted phrases" and the
+// operator or; a leading "-" negates a word or phrase.
+func parseSearchTerms(query string) []searchTerm {
+	var terms []searchTerm
+	negateNext := false
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			if words, _ := searchWords(part); len(words) > 0 {
+				terms = append(terms, searchTerm{words: words, negate: negateNext})
+			}
+			negateNext = false
+			continue
+		}
+		negateNext = false
+		for _, field := range strings.Fields(part) {
+			if strings.EqualFold(field, "or") {
+				terms = append(terms, searchTerm{or: true})
+				continue
+			}
+			if words, _ := searchWords(field); len(words) > 0 {
+				terms = append(terms, searchTerm{words: words, negate: strings.HasPrefix(field, "-")})
+			}
+		}
+		// "-" right before a quote negates the phrase
+		negateNext = strings.HasSuffix(part, "-")
+	}
+	return terms
+}
+
+// NewSearchMatcher parses query. It returns ErrInvalidQuery if the query
+// contains no words.
+func NewSearchMatcher(query string) (*SearchMatcher, error) {
+	m := &SearchMatcher{words: map[string]bool{}}
+	or := false
+	for _, t := range parseSearchTerms(query) {
+		if t.or {
+			or = len(m.clauses) > 0
+			continue
+		}
+		if or {
+			last := len(m.clauses) - 1
+			m.clauses[last] = append(m.clauses[last], t)
+		} else {
+			m.clauses = append(m.clauses, []searchTerm{t})
+		}
+		or = false
+		if !t.negate {
+			for _, w := range t.words {
+				m.words[w] = true
+			}
+		}
+	}
+	if len(m.clauses) == 0 {
+		return nil, errors.Wrapf(ErrInvalidQuery, "no words in search query %q", query)
+	}
+	return m, nil
+}
+
+// countPhrase returns the number of occurrences of phrase in words
+func countPhrase(words []string, phrase []string) int {
+	var n int
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(phrase)], phrase) {
+			n++
+		}
+	}
+	return n
+}
+
+var htmlTagRegexp = regexp.MustCompile(`<[^>]*>`)
+
+// searchFields returns the text of item weighted like the index of
+// migration 0006: title, creators and tags, abstract and note, full text.
+func searchFields(item *model.Item, fulltext string) [4]string {
+	var creators []string
+	for _, c := range item.Data.Creators {
+		creators = append(creators, c.FirstName, c.LastName, c.Name)
+	}
+	for _, t := range item.Data.Tags {
+		creators = append(creators, t.Tag)
+	}
+	body := strings.TrimSpace(item.Data.AbstractNote + " " + htmlTagRegexp.ReplaceAllString(item.Data.Note, " "))
+	return [4]string{item.Data.Title, strings.Join(creators, " "), body, fulltext}
+}
+
+// searchWeights are the default weights of ts_rank_cd for A to D
+var searchWeights = [4]float64{1.0, 0.4, 0.2, 0.1}
+
+// Result returns the search result of item with the attachment full text
+// fulltext or nil if it does not match.
+func (m *SearchMatcher) Result(item *model.Item, fulltext string) *SearchResult {
+	fields := searchFields(item, fulltext)
+	var words [4][]string
+	for i, f := range fields {
+		words[i], _ = searchWords(f)
+	}
+	var rank float64
+	for _, clause := range m.clauses {
+		matched := false
+		for _, t := range clause {
+			var score float64
+			for i := range words {
+				score += float64(countPhrase(words[i], t.words)) * searchWeights[i]
+			}
+			if (score > 0) != t.negate {
+				matched = true
+				rank += score
+			}
+		}
+		if !matched {
+			return nil
+		}
+	}
+	return &SearchResult{
+		Item: item,
+		Rank: rank,
+		Highlights: SearchHighlights{
+			Title:   m.highlight(fields[0], 0, -1),
+			Snippet: m.snippet(strings.TrimSpace(fields[2] + " " + fields[3])),
+		},
+	}
+}
+
+// highlight marks the query words of s between the words from and to,
+// to < 0 is the end.
+func (m *SearchMatcher) highlight(s string, from, to int) string {
+	words, spans := searchWords(s)
+	if to < 0 || to > len(words) {
+		to = len(words)
+	}
+	if from >= to {
+		return ""
+	}
+	var sb strings.Builder
+	pos := spans[from][0]
+	for i := from; i < to; i++ {
+		if !m.words[words[i]] {
+			continue
+		}
+		sb.WriteString(s[pos:spans[i][0]])
+		sb.WriteString("<b>" + s[spans[i][0]:spans[i][1]] + "</b>")
+		pos = spans[i][1]
+	}
+	sb.WriteString(s[pos:spans[to-1][1]])
+	return sb.String()
+}
+
+// snippet returns about 20 words of s around the first query word
+func (m *SearchMatcher) snippet(s string) string {
+	words, _ := searchWords(s)
+	first := slices.IndexFunc(words, func(w string) bool { return m.words[w] })
+	from := max(0, first-5)
+	return m.highlight(s, from, from+20)
+}
+
+// SortSearchResults orders results like SearchItems by rank and key.
+func SortSearchResults(results []*SearchResult) {
+	slices.SortStableFunc(results, func(a, b *SearchResult) int {
+		if c := cmp.Compare(b.Rank, a.Rank); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Item.Key, b.Item.Key)
+	})
+}
+
+// SearchItemList is SearchItems on a list of items for stores without a
+// text search index. fulltext maps item keys to attachment full text.
+func SearchItemList(items []*model.Item, fulltext map[string]string, query string, filter *SearchFilter, page *Page) ([]*SearchResult, int64, error) {
+	if page.Offset() < 0 {
+		return nil, 0, errors.Wrapf(ErrInvalidQuery, "invalid start %d", page.Offset())
+	}
+	if _, err := filter.config(); err != nil {
+		return nil, 0, err
+	}
+	q := filter.ItemQuery()
+	if err := q.Validate(); err != nil {
+		return nil, 0, err
+	}
+	m, err := NewSearchMatcher(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	results := []*SearchResult{}
+	for _, item := range items {
+		if !q.Match(item) {
+			continue
+		}
+		if result := m.Result(item, fulltext[item.Key]); result != nil {
+			results = append(results, result)
+		}
+	}
+	SortSearchResults(results)
+	total := int64(len(results))
+	if page.Offset() >= total {
+		return []*SearchResult{}, total, nil
+	}
+	end := min(total, page.Offset()+page.PageLimit())
+	return results[page.Offset():end], total, nil
+}
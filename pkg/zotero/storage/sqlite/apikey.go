@@ -0,0 +1,35 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json/v2"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+// GetApiKey returns the active local API key for token, or nil if there is
+// none. Keys are stored like in storage.Storage, see storage.HashApiToken.
+func (s *Storage) GetApiKey(ctx context.Context, token string) (*model.ApiKey, error) {
+	params := namedArgs{
+		"tokenhash": storage.HashApiToken(token),
+	}
+	key := &model.ApiKey{}
+	var username sql.NullString
+	var accessstr sql.NullString
+	if err := s.db.QueryRowContext(ctx, SQLGetApiKey, params.args()...).Scan(&key.UserId, &username, &accessstr); err != nil {
+		if storage.IsEmptyResult(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetApiKey)
+	}
+	key.Username = username.String
+	if accessstr.Valid {
+		if err := json.Unmarshal([]byte(accessstr.String), &key.Access); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal access %s", accessstr.String)
+		}
+	}
+	return key, nil
+}
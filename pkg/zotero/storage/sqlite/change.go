@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+func changeFromRow(row rowScanner) (*model.Change, error) {
+	change := &model.Change{}
+	var sync sql.NullString
+	var changeType string
+	var changed nullTime
+	if err := row.Scan(&change.Seq, &change.Library, &change.ObjectType, &change.Key, &change.Version, &sync, &changeType, &changed); err != nil {
+		return nil, errors.Wrap(err, "cannot scan change")
+	}
+	change.Sync = sync.String
+	change.Type = model.ChangeType(changeType)
+	change.Changed = changed.Time
+	return change, nil
+}
+
+// GetChanges returns at most limit changes of the group with a sequence
+// number greater than after, oldest first.
+func (s *Storage) GetChanges(ctx context.Context, groupId int64, after int64, limit int64) ([]*model.Change, error) {
+	params := namedArgs{
+		"library": groupId,
+		"after":   after,
+		"limit":   limit,
+	}
+	rows, err := s.db.QueryContext(ctx, SQLGetChanges, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetChanges)
+	}
+	defer rows.Close()
+	changes := []*model.Change{}
+	for rows.Next() {
+		change, err := changeFromRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate changes")
+	}
+	return changes, nil
+}
+
+// LatestChangeSeq returns the sequence number of the newest change of the
+// group or 0 if there is none.
+func (s *Storage) LatestChangeSeq(ctx context.Context, groupId int64) (int64, error) {
+	params := namedArgs{"library": groupId}
+	var seq int64
+	if err := s.db.QueryRowContext(ctx, SQLLatestChangeSeq, params.args()...).Scan(&seq); err != nil {
+		return 0, errors.Wrapf(err, "cannot execute %s", SQLLatestChangeSeq)
+	}
+	return seq, nil
+}
+
+// ListenChanges calls fn with library and sequence number of every change
+// committed after the call until ctx is done. SQLite has no notifications,
+// so the changes table is polled every PollInterval; changes of other
+// processes are seen as well.
+func (s *Storage) ListenChanges(ctx context.Context, fn func(library int64, seq int64)) error {
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	var after int64
+	if err := s.db.QueryRowContext(ctx, SQLMaxChangeSeq).Scan(&after); err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLMaxChangeSeq)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		notifications, err := s.pollChanges(ctx, after)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		for _, n := range notifications {
+			fn(n.library, n.seq)
+			after = n.seq
+		}
+	}
+}
+
+type changeNotification struct {
+	library int64
+	seq     int64
+}
+
+// pollChanges returns library and sequence number of the changes after seq
+func (s *Storage) pollChanges(ctx context.Context, after int64) ([]changeNotification, error) {
+	params := namedArgs{"after": after}
+	rows, err := s.db.QueryContext(ctx, SQLPollChanges, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLPollChanges)
+	}
+	defer rows.Close()
+	notifications := []changeNotification{}
+	for rows.Next() {
+		var n changeNotification
+		if err := rows.Scan(&n.library, &n.seq); err != nil {
+			return nil, errors.Wrap(err, "cannot scan change")
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate changes")
+	}
+	return notifications, nil
+}
@@ -0,0 +1,619 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json/v2"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+func (s *Storage) collectionFromRow(groupId int64, row rowScanner) (*model.Collection, error) {
+	coll := model.Collection{}
+	var datastr sql.NullString
+	var metastr sql.NullString
+	var sync string
+	var gitlab nullTime
+	if err := row.Scan(&coll.Key, &coll.Version, &datastr, &metastr, &coll.Deleted, &sync, &gitlab); err != nil {
+		if storage.IsEmptyResult(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "cannot scan row")
+	}
+	coll.Gitlab = gitlab.ptr()
+	coll.Status = model.SyncStatusId[sync]
+	if datastr.Valid {
+		if err := json.Unmarshal([]byte(datastr.String), &coll.Data); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal data %s", datastr.String)
+		}
+	} else {
+		if coll.Deleted || coll.Status == model.SyncStatus_Incomplete {
+			return nil, nil
+		}
+		return nil, errors.Errorf("collection has no data %v.%v", groupId, coll.Key)
+	}
+	if metastr.Valid {
+		if err := json.Unmarshal([]byte(metastr.String), &coll.Meta); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal meta %s", metastr.String)
+		}
+	}
+	if coll.Data.Name == "" {
+		coll.Data.Name = coll.Key
+	}
+	coll.Library.Id = groupId
+	coll.Library.Type = "group"
+	return &coll, nil
+}
+
+// collections reads all collections of rows
+func (s *Storage) collections(groupId int64, rows *sql.Rows) ([]*model.Collection, error) {
+	defer rows.Close()
+	colls := []*model.Collection{}
+	for rows.Next() {
+		coll, err := s.collectionFromRow(groupId, rows)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot scan row")
+		}
+		if coll == nil {
+			continue
+		}
+		colls = append(colls, coll)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate collections")
+	}
+	return colls, nil
+}
+
+func (s *Storage) CreateCollection(ctx context.Context, groupId int64, collectionData *model.CollectionData) (*model.Collection, error) {
+	if collectionData.Key == "" {
+		collectionData.Key = model.CreateKey()
+	}
+	coll := &model.Collection{
+		Key:     collectionData.Key,
+		Version: 0,
+		Library: model.Library{
+			Id:   groupId,
+			Type: "group",
+		},
+		Meta: model.CollectionMeta{},
+		Data: *collectionData,
+	}
+	jsonstr, err := json.Marshal(collectionData)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot marshal collection data %v", collectionData)
+	}
+	params := namedArgs{
+		"key":     coll.Key,
+		"version": 0,
+		"library": coll.Library.Id,
+		"sync":    model.SyncStatusString[model.SyncStatus_New],
+		"data":    string(jsonstr),
+	}
+	if _, err := s.db.ExecContext(ctx, SQLInsertCollection, params.args()...); err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLInsertCollection, params)
+	}
+	return coll, nil
+}
+
+// RefreshCollectionNameHier does nothing, the hierarchy is resolved with
+// recursive queries on the collections table.
+func (s *Storage) RefreshCollectionNameHier(ctx context.Context) error {
+	return nil
+}
+
+func (s *Storage) CreateEmptyCollection(ctx context.Context, groupId int64, collectionId string) error {
+	params := namedArgs{
+		"key":     collectionId,
+		"library": groupId,
+		"sync":    model.SyncStatusString[model.SyncStatus_Incomplete],
+	}
+	if _, err := s.db.ExecContext(ctx, SQLInsertEmptyCollection, params.args()...); err != nil {
+		return errors.Wrapf(err, "cannot execute %s: %v", SQLInsertEmptyCollection, params)
+	}
+	return nil
+}
+
+func (s *Storage) GetCollectionVersion(ctx context.Context, groupId int64, collectionId string) (int64, model.SyncStatus, error) {
+	params := namedArgs{
+		"library": groupId,
+		"key":     collectionId,
+	}
+	var version int64
+	var sync string
+	err := s.db.QueryRowContext(ctx, SQLGetCollectionVersion, params.args()...).Scan(&version, &sync)
+	switch {
+	case storage.IsEmptyResult(err):
+		if err := s.CreateEmptyCollection(ctx, groupId, collectionId); err != nil {
+			return 0, model.SyncStatus_Incomplete, errors.Wrapf(err, "cannot create new collection")
+		}
+		return 0, model.SyncStatus_Incomplete, nil
+	case err != nil:
+		return 0, model.SyncStatus_Incomplete, errors.Wrapf(err, "cannot execute %s: %v", SQLGetCollectionVersion, params)
+	}
+	return version, model.SyncStatusId[sync], nil
+}
+
+func (s *Storage) GetCollectionsByKey(ctx context.Context, groupId int64, objectKeys []string) ([]model.Collection, error) {
+	if len(objectKeys) == 0 {
+		return []model.Collection{}, nil
+	}
+	keys, err := jsonArray(objectKeys)
+	if err != nil {
+		return nil, err
+	}
+	params := namedArgs{
+		"library": groupId,
+		"keys":    keys,
+	}
+	rows, err := s.db.QueryContext(ctx, SQLGetCollections, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetCollections, params)
+	}
+	colls, err := s.collections(groupId, rows)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]model.Collection, 0, len(colls))
+	for _, coll := range colls {
+		result = append(result, *coll)
+	}
+	return result, nil
+}
+
+func (s *Storage) GetCollectionVersions(ctx context.Context, groupId int64, sinceVersion int64) (map[string]int64, int64, error) {
+	params := namedArgs{
+		"library":      groupId,
+		"sinceVersion": sinceVersion,
+	}
+	rows, err := s.db.QueryContext(ctx, SQLGetCollectionVersions, params.args()...)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "cannot execute %s: %v", SQLGetCollectionVersions, params)
+	}
+	return versions(rows, sinceVersion)
+}
+
+// versions reads key and version of rows and returns them with the highest
+// version
+func versions(rows *sql.Rows, sinceVersion int64) (map[string]int64, int64, error) {
+	defer rows.Close()
+	objects := map[string]int64{}
+	lastModifiedVersion := sinceVersion
+	for rows.Next() {
+		var key string
+		var version int64
+		if err := rows.Scan(&key, &version); err != nil {
+			return nil, 0, errors.Wrap(err, "cannot scan row")
+		}
+		objects[key] = version
+		lastModifiedVersion = max(lastModifiedVersion, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, errors.Wrap(err, "cannot iterate versions")
+	}
+	return objects, lastModifiedVersion, nil
+}
+
+func (s *Storage) GetCollectionByKey(ctx context.Context, groupId int64, key string) (*model.Collection, error) {
+	params := namedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	coll, err := s.collectionFromRow(groupId, s.db.QueryRowContext(ctx, SQLGetCollectionByKey, params.args()...))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get collection: %v - %v", SQLGetCollectionByKey, params)
+	}
+	return coll, nil
+}
+
+// GetCollectionByName returns the collection name below parentKey or at the
+// top level if parentKey is empty.
+func (s *Storage) GetCollectionByName(ctx context.Context, groupId int64, name string, parentKey string) (*model.Collection, error) {
+	params := namedArgs{
+		"library": groupId,
+		"name":    name,
+		"parent":  parentKey,
+	}
+	coll, err := s.collectionFromRow(groupId, s.db.QueryRowContext(ctx, SQLGetCollectionByName, params.args()...))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get collection: %v - %v", SQLGetCollectionByName, params)
+	}
+	return coll, nil
+}
+
+func (s *Storage) UpdateCollection(ctx context.Context, groupId int64, collection *model.Collection) error {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("Updating Collection [#%s]", collection.Key)
+	}
+	return updateCollection(ctx, s.db, groupId, collection)
+}
+
+func updateCollection(ctx context.Context, db dbConn, groupId int64, collection *model.Collection) error {
+	data, err := json.Marshal(collection.Data)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal data %v", collection.Data)
+	}
+	meta, err := json.Marshal(collection.Meta)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal meta %v", collection.Meta)
+	}
+	params := namedArgs{
+		"version": collection.Version,
+		"sync":    model.SyncStatusString[collection.Status],
+		"data":    string(data),
+		"meta":    string(meta),
+		"deleted": collection.Deleted,
+		"library": groupId,
+		"key":     collection.Key,
+	}
+	if _, err := db.ExecContext(ctx, SQLUpdateCollection, params.args()...); err != nil {
+		return errors.Wrapf(err, "cannot execute %s: %v", SQLUpdateCollection, params)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteCollection(ctx context.Context, groupId int64, key string) error {
+	params := namedArgs{
+		"sync":    model.SyncStatusString[model.SyncStatus_Modified],
+		"library": groupId,
+		"key":     key,
+	}
+	if _, err := s.db.ExecContext(ctx, SQLDeleteCollection, params.args()...); err != nil {
+		return errors.Wrapf(err, "error executing %s: %v", SQLDeleteCollection, params)
+	}
+	return nil
+}
+
+// DeleteCollections marks all given collections as deleted in a single
+// statement. It returns the number of affected rows.
+func (s *Storage) DeleteCollections(ctx context.Context, groupId int64, keys []string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	return deleteCollections(ctx, s.db, groupId, keys)
+}
+
+func deleteCollections(ctx context.Context, db dbConn, groupId int64, keys []string) (int64, error) {
+	keyArray, err := jsonArray(keys)
+	if err != nil {
+		return 0, err
+	}
+	params := namedArgs{
+		"sync":    model.SyncStatusString[model.SyncStatus_Modified],
+		"library": groupId,
+		"keys":    keyArray,
+	}
+	result, err := db.ExecContext(ctx, SQLDeleteCollections, params.args()...)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error executing %s: %v", SQLDeleteCollections, params)
+	}
+	return result.RowsAffected()
+}
+
+func (s *Storage) IterateCollections(ctx context.Context, groupId int64, after *time.Time, f func(coll *model.Collection) error) error {
+	return s.iterateCollections(ctx, groupId, SQLIterateCollections, after, f)
+}
+
+func (s *Storage) IterateCollectionsAll(ctx context.Context, groupId int64, after *time.Time, f func(coll *model.Collection) error) error {
+	return s.iterateCollections(ctx, groupId, SQLIterateCollectionsAll, after, f)
+}
+
+// iterateCollections loads the collections before calling f, so f may use
+// the storage.
+func (s *Storage) iterateCollections(ctx context.Context, groupId int64, sqlstr string, after *time.Time, f func(coll *model.Collection) error) error {
+	params := namedArgs{
+		"library": groupId,
+		"after":   formatAfter(after),
+	}
+	rows, err := s.db.QueryContext(ctx, sqlstr, params.args()...)
+	if err != nil {
+		return errors.Wrapf(err, "cannot execute %s", sqlstr)
+	}
+	colls, err := s.collections(groupId, rows)
+	if err != nil {
+		return errors.Wrapf(err, "cannot get collection")
+	}
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("%v collections found", len(colls))
+	}
+	for _, coll := range colls {
+		if err := f(coll); err != nil {
+			return errors.Wrapf(err, "error in callback for %v", coll.Key)
+		}
+	}
+	return nil
+}
+
+func (s *Storage) GetModifiedCollections(ctx context.Context, groupId int64) ([]*model.Collection, error) {
+	params := namedArgs{
+		"library":      groupId,
+		"syncNew":      model.SyncStatusString[model.SyncStatus_New],
+		"syncModified": model.SyncStatusString[model.SyncStatus_Modified],
+	}
+	rows, err := s.db.QueryContext(ctx, SQLGetModifiedCollections, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetModifiedCollections, params)
+	}
+	return s.collections(groupId, rows)
+}
+
+func (s *Storage) UpdateCollectionsGitlabTimestamp(ctx context.Context, groupId int64, now time.Time, gitlab *time.Time) error {
+	return updateGitlab(ctx, s.db, SQLUpdateCollectionsGitlab, SQLUpdateCollectionsGitlabFilter, groupId, now, gitlab)
+}
+
+// walkCollectionPath follows path from the top level as far as it exists. It
+// returns the key of the deepest existing level and the number of levels found.
+func walkCollectionPath(ctx context.Context, db dbConn, groupId int64, path []string) (string, int, error) {
+	parent := ""
+	for i, name := range path {
+		params := namedArgs{
+			"library": groupId,
+			"name":    name,
+			"parent":  parent,
+		}
+		var key string
+		if err := db.QueryRowContext(ctx, SQLGetCollectionKeyByName, params.args()...).Scan(&key); err != nil {
+			if storage.IsEmptyResult(err) {
+				return parent, i, nil
+			}
+			return "", 0, errors.Wrapf(err, "cannot execute %s: %v", SQLGetCollectionKeyByName, params)
+		}
+		parent = strings.TrimSpace(key)
+	}
+	return parent, len(path), nil
+}
+
+// EnsureCollectionPath returns the key of the collection at path, e.g.
+// []string{"Videos", "1998", "Class A"}, creating missing levels with
+// SyncStatus_New. The path is resolved in a write transaction, so concurrent
+// callers never create it twice.
+func (s *Storage) EnsureCollectionPath(ctx context.Context, groupId int64, path []string) (string, error) {
+	if len(path) == 0 {
+		return "", errors.New("empty collection path")
+	}
+	for _, name := range path {
+		if strings.TrimSpace(name) == "" {
+			return "", errors.Errorf("empty collection name in path %v", path)
+		}
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+	key, found, err := walkCollectionPath(ctx, tx, groupId, path)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot resolve collection path %v", path)
+	}
+	for _, name := range path[found:] {
+		data := &model.CollectionData{
+			Key:              model.CreateKey(),
+			Name:             name,
+			Relations:        model.RelationList{},
+			ParentCollection: model.Parent(key),
+		}
+		jsonstr, err := json.Marshal(data)
+		if err != nil {
+			return "", errors.Wrapf(err, "cannot marshal collection data %v", data)
+		}
+		params := namedArgs{
+			"key":     data.Key,
+			"version": 0,
+			"library": groupId,
+			"sync":    model.SyncStatusString[model.SyncStatus_New],
+			"data":    string(jsonstr),
+		}
+		if _, err := tx.ExecContext(ctx, SQLInsertCollection, params.args()...); err != nil {
+			return "", errors.Wrapf(err, "cannot execute %s: %v", SQLInsertCollection, params)
+		}
+		if s.Logger != nil {
+			s.Logger.Info().Msgf("created collection %s [#%s]", name, data.Key)
+		}
+		key = data.Key
+	}
+	if err := tx.Commit(); err != nil {
+		return "", errors.Wrap(err, "cannot commit transaction")
+	}
+	return key, nil
+}
+
+// GetCollectionTree returns the collection key with all its descendants. With
+// an empty key the trees of all top-level collections are returned. Deleted
+// collections and their subtrees are left out.
+func (s *Storage) GetCollectionTree(ctx context.Context, groupId int64, key string) ([]*model.CollectionNode, error) {
+	sqlstr := SQLGetCollectionTree
+	if key == "" {
+		sqlstr = SQLGetCollectionTreeTop
+	}
+	params := namedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	rows, err := s.db.QueryContext(ctx, sqlstr, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", sqlstr, params)
+	}
+	colls, err := s.collections(groupId, rows)
+	if err != nil {
+		return nil, err
+	}
+	// rows are ordered by depth, so parents are always seen before children
+	nodes := map[string]*model.CollectionNode{}
+	roots := []*model.CollectionNode{}
+	for _, coll := range colls {
+		node := &model.CollectionNode{Collection: coll}
+		nodes[coll.Key] = node
+		if parent, ok := nodes[string(coll.Data.ParentCollection)]; ok && coll.Key != key {
+			parent.Children = append(parent.Children, node)
+			continue
+		}
+		roots = append(roots, node)
+	}
+	return roots, nil
+}
+
+// GetCollectionPath returns the ancestors of the collection key starting at
+// the top level and ending with the collection itself. If the collection does
+// not exist, the result is empty.
+func (s *Storage) GetCollectionPath(ctx context.Context, groupId int64, key string) ([]*model.Collection, error) {
+	return s.collectionPath(ctx, s.db, groupId, key)
+}
+
+func (s *Storage) collectionPath(ctx context.Context, db dbConn, groupId int64, key string) ([]*model.Collection, error) {
+	params := namedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	rows, err := db.QueryContext(ctx, SQLGetCollectionPath, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetCollectionPath, params)
+	}
+	return s.collections(groupId, rows)
+}
+
+// GetItemsInCollection returns the items of the collection key. With recursive
+// set, items of all descendant collections are included; an item that belongs
+// to several of them is returned once. Trashed and deleted items are skipped.
+func (s *Storage) GetItemsInCollection(ctx context.Context, groupId int64, key string, recursive bool) ([]*model.Item, error) {
+	sqlstr := SQLGetItemsInCollection
+	if recursive {
+		sqlstr = SQLGetItemsInCollectionRecursive
+	}
+	params := namedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	rows, err := s.db.QueryContext(ctx, sqlstr, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", sqlstr, params)
+	}
+	return s.items(groupId, rows)
+}
+
+// GetCollectionChildren returns the subcollections of parentKey ordered by
+// name. An empty parentKey returns the top-level collections.
+func (s *Storage) GetCollectionChildren(ctx context.Context, groupId int64, parentKey string) ([]*model.Collection, error) {
+	params := namedArgs{
+		"library": groupId,
+		"parent":  parentKey,
+	}
+	rows, err := s.db.QueryContext(ctx, SQLGetCollectionChildren, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetCollectionChildren, params)
+	}
+	return s.collections(groupId, rows)
+}
+
+// ModifyCollection loads the collection key and calls f to change it. If f
+// moves the collection, the new parent must exist and must not be the
+// collection itself or one of its descendants. f runs in a write transaction,
+// so concurrent moves cannot create a cycle. It returns nil if the collection
+// does not exist.
+func (s *Storage) ModifyCollection(ctx context.Context, groupId int64, key string, f func(coll *model.Collection) error) (*model.Collection, error) {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("modifying collection [#%s]", key)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+	params := namedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	coll, err := s.collectionFromRow(groupId, tx.QueryRowContext(ctx, SQLGetCollectionByKey, params.args()...))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetCollectionByKey, params)
+	}
+	if coll == nil {
+		return nil, nil
+	}
+	oldParent := coll.Data.ParentCollection
+	if err := f(coll); err != nil {
+		return nil, err
+	}
+	if parent := string(coll.Data.ParentCollection); parent != "" && coll.Data.ParentCollection != oldParent {
+		path, err := s.collectionPath(ctx, tx, groupId, parent)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot load path of %s", parent)
+		}
+		if len(path) == 0 || path[len(path)-1].Key != parent {
+			return nil, errors.Wrapf(storage.ErrInvalidParent, "collection %s not found", parent)
+		}
+		for _, ancestor := range path {
+			if ancestor.Key == coll.Key {
+				return nil, errors.Wrapf(storage.ErrCollectionCycle, "%s is a descendant of %s", parent, coll.Key)
+			}
+			if ancestor.Deleted {
+				return nil, errors.Wrapf(storage.ErrInvalidParent, "collection %s is deleted", ancestor.Key)
+			}
+		}
+	}
+	if err := updateCollection(ctx, tx, groupId, coll); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "cannot commit transaction")
+	}
+	return coll, nil
+}
+
+// DeleteCollectionTree marks the collection key as deleted and removes it
+// from its items, which are marked as modified. With recursive set all
+// descendants are deleted as well; otherwise a collection with
+// subcollections is rejected with storage.ErrCollectionNotEmpty. It returns
+// the keys of the deleted collections, or nil if the collection does not
+// exist.
+func (s *Storage) DeleteCollectionTree(ctx context.Context, groupId int64, key string, recursive bool) ([]string, error) {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("deleting collection [#%s] (recursive: %v)", key, recursive)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+	params := namedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	rows, err := tx.QueryContext(ctx, SQLGetCollectionSubtreeKeys, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetCollectionSubtreeKeys, params)
+	}
+	keys, err := scanStrings(rows)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read rows of %s", SQLGetCollectionSubtreeKeys)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if len(keys) > 1 && !recursive {
+		return nil, errors.Wrapf(storage.ErrCollectionNotEmpty, "collection %s has %d descendants", key, len(keys)-1)
+	}
+	if _, err := deleteCollections(ctx, tx, groupId, keys); err != nil {
+		return nil, err
+	}
+	keyArray, err := jsonArray(keys)
+	if err != nil {
+		return nil, err
+	}
+	params = namedArgs{
+		"library":      groupId,
+		"keys":         keyArray,
+		"syncNew":      model.SyncStatusString[model.SyncStatus_New],
+		"syncModified": model.SyncStatusString[model.SyncStatus_Modified],
+	}
+	if _, err := tx.ExecContext(ctx, SQLRemoveCollectionsFromItems, params.args()...); err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLRemoveCollectionsFromItems, params)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "cannot commit transaction")
+	}
+	return keys, nil
+}
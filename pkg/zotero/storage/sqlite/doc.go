@@ -0,0 +1,6 @@
+// Package sqlite implements storage.Store on SQLite with the semantics of
+// storage.Storage, e.g. for single-host installations without PostgreSQL.
+// JSON is stored as text and queried with JSON1 functions, and the
+// collection hierarchy is resolved with recursive queries instead of
+// materialized views.
+package sqlite
@@ -0,0 +1,222 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+func (s *Storage) GetGroup(ctx context.Context, groupId int64) (*model.Group, error) {
+	group := &model.Group{
+		Id: groupId,
+	}
+	if s.Logger != nil {
+		s.Logger.Debug().Msgf("loading Group #%v from database", groupId)
+	}
+	params := namedArgs{"id": groupId}
+	var jsonstr sql.NullString
+	var directionstr string
+	var created, modified, gitlab nullTime
+	err := s.db.QueryRowContext(ctx, SQLGetGroup, params.args()...).Scan(&group.Version,
+		&created,
+		&modified,
+		&jsonstr,
+		&group.Active,
+		&directionstr,
+		&group.SyncTags,
+		&group.ItemVersion,
+		&group.CollectionVersion,
+		&group.TagVersion,
+		&gitlab)
+	if err != nil {
+		if !storage.IsEmptyResult(err) {
+			return nil, errors.Wrapf(err, "error scanning result of %s: %v", SQLGetGroup, groupId)
+		}
+		active, direction, err := s.CreateEmptyGroup(ctx, groupId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot create empty Group %v", groupId)
+		}
+		group.Active = active
+		group.Direction = direction
+	} else {
+		group.Meta.Created = created.Time
+		group.Meta.LastModified = modified.Time
+		group.Gitlab = gitlab.ptr()
+		group.Direction = model.SyncDirectionId[directionstr]
+	}
+	if jsonstr.Valid {
+		if err := json.Unmarshal([]byte(jsonstr.String), &group.Data); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal Group data %s", jsonstr.String)
+		}
+	}
+	group.Init()
+	return group, nil
+}
+
+func (s *Storage) GetGroups(ctx context.Context) ([]*model.Group, error) {
+	if s.Logger != nil {
+		s.Logger.Debug().Msgf("loading Groups from database")
+	}
+	rows, err := s.db.QueryContext(ctx, SQLGetGroups)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error executing sql query: %v", SQLGetGroups)
+	}
+	// the ids are read completely, the database has a single connection
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, errors.Wrap(err, "cannot scan row")
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	grps := []*model.Group{}
+	for _, id := range ids {
+		grp, err := s.GetGroup(ctx, id)
+		if err != nil {
+			if s.Logger != nil {
+				s.Logger.Error().Msgf("error loading Group #%v: %v", id, err)
+			}
+			continue
+		}
+		if s.Logger != nil {
+			s.Logger.Info().Msgf("Group #%v - %v loaded", grp.Id, grp.Data.Name)
+		}
+		grps = append(grps, grp)
+	}
+	return grps, nil
+}
+
+// CreateEmptyGroup creates the group with default sync settings unless it
+// exists and returns its active state and direction.
+func (s *Storage) CreateEmptyGroup(ctx context.Context, groupId int64) (bool, model.SyncDirection, error) {
+	paramsGroup := namedArgs{"id": groupId}
+	if _, err := s.db.ExecContext(ctx, SQLInsertEmptyGroup, paramsGroup.args()...); err != nil {
+		return false, model.SyncDirection_None, errors.Wrapf(err, "cannot execute %s: %v", SQLInsertEmptyGroup, groupId)
+	}
+	paramsSyncGroup := namedArgs{
+		"id":        groupId,
+		"active":    s.newGroupActive,
+		"direction": model.SyncDirectionString[model.SyncDirection_ToLocal],
+	}
+	if _, err := s.db.ExecContext(ctx, SQLInsertEmptySyncGroup, paramsSyncGroup.args()...); err != nil {
+		return false, model.SyncDirection_None, errors.Wrapf(err, "cannot execute %s: %v", SQLInsertEmptySyncGroup, paramsSyncGroup)
+	}
+	var active bool
+	var dirstr string
+	if err := s.db.QueryRowContext(ctx, SQLGetSyncGroupActiveDirection, paramsGroup.args()...).Scan(&active, &dirstr); err != nil {
+		return false, model.SyncDirection_None, errors.Wrapf(err, "cannot execute %s: %v", SQLGetSyncGroupActiveDirection, groupId)
+	}
+	return active, model.SyncDirectionId[dirstr], nil
+}
+
+// ListGroups returns all groups with their sync settings and cursors,
+// including inactive ones.
+func (s *Storage) ListGroups(ctx context.Context) ([]*model.Group, error) {
+	rows, err := s.db.QueryContext(ctx, SQLListGroups)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLListGroups)
+	}
+	defer rows.Close()
+	grps := []*model.Group{}
+	for rows.Next() {
+		group := &model.Group{}
+		var datastr sql.NullString
+		var directionstr string
+		var created, modified, gitlab nullTime
+		if err := rows.Scan(&group.Id, &group.Version, &created, &modified, &datastr, &group.Deleted,
+			&group.Active, &directionstr, &group.SyncTags, &group.ItemVersion, &group.CollectionVersion, &group.TagVersion, &gitlab); err != nil {
+			return nil, errors.Wrap(err, "cannot scan row")
+		}
+		if datastr.Valid {
+			if err := json.Unmarshal([]byte(datastr.String), &group.Data); err != nil {
+				return nil, errors.Wrapf(err, "cannot unmarshal Group data %s", datastr.String)
+			}
+		}
+		group.Meta.Created = created.Time
+		group.Meta.LastModified = modified.Time
+		group.Gitlab = gitlab.ptr()
+		group.Direction = model.SyncDirectionId[directionstr]
+		group.Init()
+		grps = append(grps, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate groups")
+	}
+	return grps, nil
+}
+
+// UpdateSyncGroup stores the sync settings Active, Direction and SyncTags of
+// group.
+func (s *Storage) UpdateSyncGroup(ctx context.Context, group *model.Group) error {
+	direction, ok := model.SyncDirectionString[group.Direction]
+	if !ok {
+		return errors.Errorf("invalid sync direction %v", group.Direction)
+	}
+	params := namedArgs{
+		"id":        group.Id,
+		"active":    group.Active,
+		"direction": direction,
+		"tags":      group.SyncTags,
+	}
+	result, err := s.db.ExecContext(ctx, SQLUpdateSyncGroup, params.args()...)
+	if err != nil {
+		return errors.Wrapf(err, "cannot execute %s: %v", SQLUpdateSyncGroup, params)
+	}
+	if num, err := result.RowsAffected(); err == nil && num == 0 {
+		return errors.Errorf("no sync settings for group %v", group.Id)
+	}
+	return nil
+}
+
+// ClearGroup resets the sync cursors of the group, so that the next sync
+// compares all objects with the cloud.
+func (s *Storage) ClearGroup(ctx context.Context, groupId int64) error {
+	params := namedArgs{"id": groupId}
+	if _, err := s.db.ExecContext(ctx, SQLClearGroup, params.args()...); err != nil {
+		return errors.Wrapf(err, "cannot execute %s: %v", SQLClearGroup, groupId)
+	}
+	return nil
+}
+
+func (s *Storage) UpdateGroup(ctx context.Context, group *model.Group) error {
+	data, err := json.Marshal(group.Data, jsontext.WithIndent("  "))
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal Group data")
+	}
+	params := namedArgs{
+		"version":           group.Version,
+		"created":           formatTime(group.Meta.Created),
+		"modified":          formatTime(group.Meta.LastModified),
+		"data":              string(data),
+		"deleted":           group.Deleted,
+		"itemversion":       group.ItemVersion,
+		"collectionversion": group.CollectionVersion,
+		"tagversion":        group.TagVersion,
+		"id":                group.Id,
+	}
+	if _, err := s.db.ExecContext(ctx, SQLUpdateGroup, params.args()...); err != nil {
+		return errors.Wrapf(err, "cannot execute %s: %v", SQLUpdateGroup, params)
+	}
+	return nil
+}
+
+func (s *Storage) UpdateGroupGitlabTimestamp(ctx context.Context, groupId int64, t time.Time) error {
+	params := namedArgs{
+		"gitlab": formatTime(t.Truncate(time.Second)),
+		"id":     groupId,
+	}
+	if _, err := s.db.ExecContext(ctx, SQLUpdateGroupGitlabTimestamp, params.args()...); err != nil {
+		return errors.Wrapf(err, "cannot update timestamp for group #%v", groupId)
+	}
+	return nil
+}
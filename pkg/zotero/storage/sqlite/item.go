@@ -0,0 +1,465 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json/v2"
+	"slices"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+var errEmptyItem = errors.New("item has no data")
+
+func (s *Storage) itemFromRow(groupId int64, row rowScanner) (*model.Item, error) {
+	item := &model.Item{}
+	var datastr sql.NullString
+	var metastr sql.NullString
+	var sync string
+	var md5str sql.NullString
+	var gitlab nullTime
+	if err := row.Scan(&(item.Key), &(item.Version), &datastr, &metastr, &(item.Trashed), &(item.Deleted), &sync, &md5str, &gitlab); err != nil {
+		if storage.IsEmptyResult(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "cannot scan row")
+	}
+	item.MD5 = md5str.String
+	item.Gitlab = gitlab.ptr()
+	item.Status = model.SyncStatusId[sync]
+	item.Library.Id = groupId
+	item.Library.Type = "group"
+	if !datastr.Valid {
+		if item.Deleted || item.Status == model.SyncStatus_Incomplete {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(errEmptyItem, "item has no data %v.%v", groupId, item.Key)
+	}
+	if err := json.Unmarshal([]byte(datastr.String), &(item.Data)); err != nil {
+		return nil, errors.Wrapf(err, "cannot unmarshal data %s", datastr.String)
+	}
+	if item.Data.Collections == nil {
+		item.Data.Collections = []string{}
+	}
+	if metastr.Valid {
+		if err := json.Unmarshal([]byte(metastr.String), &(item.Meta)); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal meta %s", metastr.String)
+		}
+	}
+	item.Data.ItemDataBase.Key = item.Key
+	item.Data.ItemDataBase.Version = item.Version
+	return item, nil
+}
+
+// items reads all items of rows, skipping empty items like storage.Storage
+func (s *Storage) items(groupId int64, rows *sql.Rows) ([]*model.Item, error) {
+	defer rows.Close()
+	items := []*model.Item{}
+	for rows.Next() {
+		item, err := s.itemFromRow(groupId, rows)
+		if err != nil {
+			if errors.Is(err, errEmptyItem) {
+				if s.Logger != nil {
+					s.Logger.Warn().Err(err).Msg("item is empty. skipping")
+				}
+				continue
+			}
+			return nil, errors.Wrapf(err, "cannot scan row")
+		}
+		if item == nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate items")
+	}
+	return items, nil
+}
+
+// CreateItem stores a new item. If an item with oldId exists, it is updated
+// and marked as modified instead.
+func (s *Storage) CreateItem(ctx context.Context, groupId int64, itemData *model.ItemGeneric, itemMeta *model.ItemMeta, oldId string) (*model.Item, error) {
+	if itemData.Key == "" {
+		itemData.Key = model.CreateKey()
+	}
+	if itemMeta == nil {
+		itemMeta = &model.ItemMeta{}
+	}
+	item := &model.Item{
+		Key:     itemData.Key,
+		Version: 0,
+		Library: model.Library{
+			Id:   groupId,
+			Type: "group",
+		},
+		Meta:   *itemMeta,
+		Data:   *itemData,
+		OldId:  oldId,
+		Status: model.SyncStatus_New,
+	}
+	jsonstr, err := json.Marshal(itemData)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot marshal item data %v", itemData)
+	}
+	params := namedArgs{
+		"key":     item.Key,
+		"version": 0,
+		"library": item.Library.Id,
+		"sync":    model.SyncStatusString[model.SyncStatus_New],
+		"data":    string(jsonstr),
+		"oldid":   nullString(oldId),
+	}
+	_, err = s.db.ExecContext(ctx, SQLInsertItem, params.args()...)
+	if IsUniqueViolation(err, "items.library, items.oldid") {
+		item2, err := s.GetItemByOldid(ctx, groupId, oldId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot load item %v", oldId)
+		}
+		if item2 == nil {
+			return nil, errors.Errorf("cannot load item %v", oldId)
+		}
+		item.Key = item2.Key
+		item.Data.Key = item.Key
+		item.Version = item2.Version
+		item.Status = model.SyncStatus_Modified
+		if err := s.UpdateItem(ctx, groupId, item); err != nil {
+			return nil, errors.Wrapf(err, "cannot update item %v", oldId)
+		}
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLInsertItem, params)
+	}
+	return item, nil
+}
+
+func (s *Storage) CreateEmptyItem(ctx context.Context, groupId int64, itemId string, oldId string) error {
+	params := namedArgs{
+		"key":     itemId,
+		"library": groupId,
+		"sync":    model.SyncStatusString[model.SyncStatus_Incomplete],
+		"oldid":   nullString(oldId),
+	}
+	if _, err := s.db.ExecContext(ctx, SQLInsertEmptyItem, params.args()...); err != nil {
+		return errors.Wrapf(err, "cannot execute %s: %v", SQLInsertEmptyItem, params)
+	}
+	return nil
+}
+
+func (s *Storage) GetItemVersion(ctx context.Context, groupId int64, itemId string, oldId string) (int64, model.SyncStatus, error) {
+	params := namedArgs{
+		"library": groupId,
+		"key":     itemId,
+	}
+	var version int64
+	var syncstr string
+	err := s.db.QueryRowContext(ctx, SQLGetItemVersion, params.args()...).Scan(&version, &syncstr)
+	switch {
+	case storage.IsEmptyResult(err):
+		if err := s.CreateEmptyItem(ctx, groupId, itemId, oldId); err != nil {
+			return 0, model.SyncStatus_Incomplete, errors.Wrapf(err, "cannot create new item")
+		}
+		return 0, model.SyncStatus_Incomplete, nil
+	case err != nil:
+		return 0, model.SyncStatus_Incomplete, errors.Wrapf(err, "cannot execute %s: %v", SQLGetItemVersion, params)
+	}
+	return version, model.SyncStatusId[syncstr], nil
+}
+
+func (s *Storage) GetItemsByKey(ctx context.Context, groupId int64, objectKeys []string) ([]model.Item, error) {
+	if len(objectKeys) == 0 {
+		return []model.Item{}, nil
+	}
+	keys, err := jsonArray(objectKeys)
+	if err != nil {
+		return nil, err
+	}
+	params := namedArgs{
+		"library": groupId,
+		"keys":    keys,
+	}
+	rows, err := s.db.QueryContext(ctx, SQLGetItems, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetItems, params)
+	}
+	items, err := s.items(groupId, rows)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]model.Item, 0, len(items))
+	for _, item := range items {
+		result = append(result, *item)
+	}
+	return result, nil
+}
+
+func (s *Storage) GetItemVersions(ctx context.Context, groupId int64, sinceVersion int64, trashed bool) (map[string]int64, int64, error) {
+	params := namedArgs{
+		"library":      groupId,
+		"sinceVersion": sinceVersion,
+		"trashed":      trashed,
+	}
+	rows, err := s.db.QueryContext(ctx, SQLGetItemVersions, params.args()...)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "cannot execute %s: %v", SQLGetItemVersions, params)
+	}
+	return versions(rows, sinceVersion)
+}
+
+func (s *Storage) GetItemByKey(ctx context.Context, groupId int64, key string) (*model.Item, error) {
+	params := namedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	item, err := s.itemFromRow(groupId, s.db.QueryRowContext(ctx, SQLGetItemByKey, params.args()...))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetItemByKey, params)
+	}
+	return item, nil
+}
+
+func (s *Storage) GetItemByOldid(ctx context.Context, groupId int64, oldid string) (*model.Item, error) {
+	params := namedArgs{
+		"library": groupId,
+		"oldid":   oldid,
+	}
+	item, err := s.itemFromRow(groupId, s.db.QueryRowContext(ctx, SQLGetItemByOldid, params.args()...))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetItemByOldid, params)
+	}
+	return item, nil
+}
+
+func (s *Storage) UpdateItem(ctx context.Context, groupId int64, item *model.Item) error {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("updating item [#%s]", item.Key)
+	}
+	return updateItem(ctx, s.db, groupId, item)
+}
+
+// ModifyItem loads the item key and calls f to change it in a write
+// transaction. The item is written only if f returns nil, and no other
+// ModifyItem call can change it in between. It returns nil if the item does
+// not exist.
+func (s *Storage) ModifyItem(ctx context.Context, groupId int64, key string, f func(item *model.Item) error) (*model.Item, error) {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("modifying item [#%s]", key)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+	params := namedArgs{
+		"library": groupId,
+		"key":     key,
+	}
+	item, err := s.itemFromRow(groupId, tx.QueryRowContext(ctx, SQLGetItemByKey, params.args()...))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetItemByKey, params)
+	}
+	if item == nil {
+		return nil, nil
+	}
+	if err := f(item); err != nil {
+		return nil, err
+	}
+	if err := updateItem(ctx, tx, groupId, item); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "cannot commit transaction")
+	}
+	return item, nil
+}
+
+// updateItem writes item; a version of 0 keeps the stored version.
+func updateItem(ctx context.Context, db dbConn, groupId int64, item *model.Item) error {
+	md5 := item.MD5
+	if md5 == "" && item.Data.ItemType == "attachment" {
+		md5 = item.Data.MD5
+	}
+	data, err := json.Marshal(item.Data)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal data %v", item.Data)
+	}
+	meta, err := json.Marshal(item.Meta)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal meta %v", item.Meta)
+	}
+	sqlstr := SQLUpdateItemVersion0
+	params := namedArgs{
+		"data":    string(data),
+		"meta":    string(meta),
+		"trashed": item.Trashed,
+		"deleted": item.Deleted,
+		"sync":    model.SyncStatusString[item.Status],
+		"md5":     nullString(md5),
+		"library": groupId,
+		"key":     item.Key,
+	}
+	if item.Version > 0 {
+		sqlstr = SQLUpdateItem
+		params["version"] = item.Version
+	}
+	if _, err := db.ExecContext(ctx, sqlstr, params.args()...); err != nil {
+		return errors.Wrapf(err, "cannot execute %s: %v", sqlstr, params)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteItem(ctx context.Context, groupId int64, key string) error {
+	params := namedArgs{
+		"sync":    model.SyncStatusString[model.SyncStatus_Modified],
+		"key":     key,
+		"library": groupId,
+	}
+	if _, err := s.db.ExecContext(ctx, SQLDeleteItem, params.args()...); err != nil {
+		return errors.Wrapf(err, "error executing %s: %v", SQLDeleteItem, params)
+	}
+	return nil
+}
+
+// DeleteItems marks all given items as deleted in a single statement.
+// It returns the number of affected rows.
+func (s *Storage) DeleteItems(ctx context.Context, groupId int64, keys []string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	keyArray, err := jsonArray(keys)
+	if err != nil {
+		return 0, err
+	}
+	params := namedArgs{
+		"sync":    model.SyncStatusString[model.SyncStatus_Modified],
+		"keys":    keyArray,
+		"library": groupId,
+	}
+	result, err := s.db.ExecContext(ctx, SQLDeleteItems, params.args()...)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error executing %s: %v", SQLDeleteItems, params)
+	}
+	return result.RowsAffected()
+}
+
+func (s *Storage) GetChildren(ctx context.Context, groupId int64, key string) ([]model.Item, error) {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("get children of item [#%s]", key)
+	}
+	params := namedArgs{
+		"library": groupId,
+		"parent":  key,
+	}
+	rows, err := s.db.QueryContext(ctx, SQLGetChildren, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetChildren, params)
+	}
+	children, err := s.items(groupId, rows)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]model.Item, 0, len(children))
+	for _, child := range children {
+		items = append(items, *child)
+	}
+	return items, nil
+}
+
+func (s *Storage) DeleteItemRecursive(ctx context.Context, groupId int64, key string) error {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("recursively deleting item [#%s]", key)
+	}
+	children, err := s.GetChildren(ctx, groupId, key)
+	if err != nil {
+		return errors.Wrapf(err, "cannot get children of #%v", key)
+	}
+	for _, c := range children {
+		if err := s.DeleteItemRecursive(ctx, groupId, c.Key); err != nil {
+			return errors.Wrapf(err, "cannot delete child #%v of #%v", c.Key, key)
+		}
+	}
+	return s.DeleteItem(ctx, groupId, key)
+}
+
+func (s *Storage) IterateItems(ctx context.Context, groupId int64, after *time.Time, f func(item *model.Item) error) error {
+	return s.iterateItems(ctx, groupId, SQLIterateItems, after, f)
+}
+
+func (s *Storage) IterateItemsAll(ctx context.Context, groupId int64, after *time.Time, f func(item *model.Item) error) error {
+	return s.iterateItems(ctx, groupId, SQLIterateItemsAll, after, f)
+}
+
+// iterateItems loads the items before calling f, so f may use the storage.
+func (s *Storage) iterateItems(ctx context.Context, groupId int64, sqlstr string, after *time.Time, f func(item *model.Item) error) error {
+	params := namedArgs{
+		"library": groupId,
+		"after":   formatAfter(after),
+	}
+	rows, err := s.db.QueryContext(ctx, sqlstr, params.args()...)
+	if err != nil {
+		return errors.Wrapf(err, "cannot execute %s", sqlstr)
+	}
+	items, err := s.items(groupId, rows)
+	if err != nil {
+		return errors.Wrapf(err, "cannot get item")
+	}
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("%v items found", len(items))
+	}
+	for _, item := range items {
+		if err := f(item); err != nil {
+			return errors.Wrapf(err, "error in callback for %v", item.Key)
+		}
+	}
+	return nil
+}
+
+func (s *Storage) GetModifiedItems(ctx context.Context, groupId int64) ([]*model.Item, error) {
+	params := namedArgs{
+		"library":      groupId,
+		"syncNew":      model.SyncStatusString[model.SyncStatus_New],
+		"syncModified": model.SyncStatusString[model.SyncStatus_Modified],
+	}
+	rows, err := s.db.QueryContext(ctx, SQLGetModifiedItems, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetModifiedItems, params)
+	}
+	return s.items(groupId, rows)
+}
+
+// RefreshItemTypeHier does nothing, parents are read from the item data.
+func (s *Storage) RefreshItemTypeHier(ctx context.Context) error {
+	return nil
+}
+
+func (s *Storage) UpdateItemsGitlabTimestamp(ctx context.Context, groupId int64, now time.Time, gitlab *time.Time) error {
+	return updateGitlab(ctx, s.db, SQLUpdateItemsGitlab, SQLUpdateItemsGitlabFilter, groupId, now, gitlab)
+}
+
+// QueryItems returns one page of the items of group groupId matching q and
+// the total number of matching items. Filters and sorting are applied to the
+// items of the group in memory.
+func (s *Storage) QueryItems(ctx context.Context, groupId int64, q *storage.ItemQuery) ([]*model.Item, int64, error) {
+	if err := q.Validate(); err != nil {
+		return nil, 0, err
+	}
+	params := namedArgs{"library": groupId}
+	rows, err := s.db.QueryContext(ctx, SQLQueryItems, params.args()...)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "cannot execute %s", SQLQueryItems)
+	}
+	items, err := s.items(groupId, rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	items = slices.DeleteFunc(items, func(item *model.Item) bool { return !q.Match(item) })
+	slices.SortStableFunc(items, q.Compare)
+	total := int64(len(items))
+	if q.Start >= total {
+		return []*model.Item{}, total, nil
+	}
+	end := min(total, q.Start+q.PageLimit())
+	return items[q.Start:end], total, nil
+}
@@ -0,0 +1,156 @@
+package sqlite
+
+import (
+	"context"
+	"embed"
+	"slices"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations returns the SQLite migrations embedded into this release,
+// ordered by version.
+func Migrations() ([]*storage.Migration, error) {
+	return storage.LoadMigrations(migrationFiles)
+}
+
+// appliedMigrations returns the applied versions
+func appliedMigrations(ctx context.Context, conn dbConn) (map[int64]*storage.MigrationState, error) {
+	rows, err := conn.QueryContext(ctx, SQLGetSchemaMigrations)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetSchemaMigrations)
+	}
+	defer rows.Close()
+	applied := map[int64]*storage.MigrationState{}
+	for rows.Next() {
+		state := &storage.MigrationState{}
+		var appliedAt nullTime
+		if err := rows.Scan(&state.Version, &state.Name, &appliedAt); err != nil {
+			return nil, errors.Wrap(err, "cannot scan schema migration")
+		}
+		state.Applied = appliedAt.ptr()
+		applied[state.Version] = state
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate schema migrations")
+	}
+	return applied, nil
+}
+
+// SchemaVersion returns the highest applied migration or 0 for a new
+// database.
+func (s *Storage) SchemaVersion(ctx context.Context) (int64, error) {
+	if _, err := s.db.ExecContext(ctx, SQLCreateSchemaMigrations); err != nil {
+		return 0, errors.Wrapf(err, "cannot execute %s", SQLCreateSchemaMigrations)
+	}
+	applied, err := appliedMigrations(ctx, s.db)
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// MigrateUp applies all pending migrations in one transaction and returns
+// them. Open calls it, so SQLite databases never need a separate migration
+// step. It returns storage.ErrSchemaNewer if the database has been migrated
+// by a newer release.
+func (s *Storage) MigrateUp(ctx context.Context) ([]*storage.Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, SQLCreateSchemaMigrations); err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLCreateSchemaMigrations)
+	}
+	applied, err := appliedMigrations(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range applied {
+		if !slices.ContainsFunc(migrations, func(m *storage.Migration) bool { return m.Version == a.Version }) {
+			return nil, errors.Wrapf(storage.ErrSchemaNewer, "migration %d_%s is unknown", a.Version, a.Name)
+		}
+	}
+	var done []*storage.Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if s.Logger != nil {
+			s.Logger.Info().Msgf("applying migration %d_%s", m.Version, m.Name)
+		}
+		if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+			return nil, errors.Wrapf(err, "cannot apply migration %d_%s", m.Version, m.Name)
+		}
+		params := namedArgs{"version": m.Version, "name": m.Name}
+		if _, err := tx.ExecContext(ctx, SQLInsertSchemaMigration, params.args()...); err != nil {
+			return nil, errors.Wrapf(err, "cannot execute %s", SQLInsertSchemaMigration)
+		}
+		done = append(done, m)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "cannot commit migrations")
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the latest steps applied migrations in one transaction
+// and returns the reverted ones. The base migration cannot be reverted.
+func (s *Storage) MigrateDown(ctx context.Context, steps int) ([]*storage.Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, SQLCreateSchemaMigrations); err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLCreateSchemaMigrations)
+	}
+	applied, err := appliedMigrations(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range applied {
+		if !slices.ContainsFunc(migrations, func(m *storage.Migration) bool { return m.Version == a.Version }) {
+			return nil, errors.Wrapf(storage.ErrSchemaNewer, "migration %d_%s is unknown", a.Version, a.Name)
+		}
+	}
+	var done []*storage.Migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if s.Logger != nil {
+			s.Logger.Info().Msgf("reverting migration %d_%s", m.Version, m.Name)
+		}
+		if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+			return nil, errors.Wrapf(err, "cannot revert migration %d_%s", m.Version, m.Name)
+		}
+		params := namedArgs{"version": m.Version}
+		if _, err := tx.ExecContext(ctx, SQLDeleteSchemaMigration, params.args()...); err != nil {
+			return nil, errors.Wrapf(err, "cannot execute %s", SQLDeleteSchemaMigration)
+		}
+		done = append(done, m)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "cannot commit migrations")
+	}
+	return done, nil
+}
@@ -0,0 +1,9 @@
+-- The base schema holds the data of the database, so reverting it would drop
+-- everything. SQLite has no RAISE outside of triggers, so a temporary trigger
+-- aborts the down step; MigrateDown rolls the temporary objects back.
+CREATE TEMP TABLE base_schema_guard (id integer);
+CREATE TEMP TRIGGER base_schema_guard BEFORE INSERT ON base_schema_guard
+BEGIN
+    SELECT RAISE(ABORT, 'base schema cannot be reverted');
+END;
+INSERT INTO base_schema_guard (id) VALUES (1);
@@ -0,0 +1,191 @@
+--
+-- Base schema of the SQLite backend. It mirrors the PostgreSQL schema with
+-- JSON text instead of jsonb and UTC timestamps as text in the format
+-- YYYY-MM-DD HH:MM:SS.SSS, which sorts like the time.
+--
+
+CREATE TABLE IF NOT EXISTS groups (
+    id integer NOT NULL PRIMARY KEY,
+    version integer DEFAULT 0 NOT NULL,
+    created text NOT NULL,
+    modified text NOT NULL,
+    data text,
+    deleted integer DEFAULT 0 NOT NULL,
+    itemversion integer DEFAULT 0 NOT NULL,
+    collectionversion integer DEFAULT 0 NOT NULL,
+    tagversion integer DEFAULT 0 NOT NULL,
+    gitlab text
+);
+
+CREATE TABLE IF NOT EXISTS syncgroups (
+    id integer NOT NULL PRIMARY KEY,
+    active integer DEFAULT 0 NOT NULL,
+    direction text DEFAULT 'tolocal' NOT NULL,
+    tags integer DEFAULT 0 NOT NULL,
+    CHECK (direction IN ('none', 'tocloud', 'tolocal', 'bothcloud', 'bothlocal', 'bothmanual'))
+);
+
+CREATE TABLE IF NOT EXISTS collections (
+    key text NOT NULL,
+    version integer DEFAULT 0 NOT NULL,
+    library integer NOT NULL,
+    data text,
+    meta text,
+    deleted integer DEFAULT 0 NOT NULL,
+    sync text NOT NULL,
+    modified text DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')) NOT NULL,
+    gitlab text,
+    PRIMARY KEY (library, key),
+    CHECK (sync IN ('new', 'synced', 'modified', 'incomplete'))
+);
+
+CREATE TABLE IF NOT EXISTS items (
+    key text NOT NULL,
+    version integer DEFAULT 0 NOT NULL,
+    library integer NOT NULL,
+    data text,
+    meta text,
+    trashed integer DEFAULT 0 NOT NULL,
+    deleted integer DEFAULT 0 NOT NULL,
+    sync text NOT NULL,
+    md5 text,
+    oldid text,
+    modified text DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')) NOT NULL,
+    gitlab text,
+    PRIMARY KEY (library, key),
+    CHECK (sync IN ('new', 'synced', 'modified', 'incomplete'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS items_oldid ON items (library, oldid);
+
+CREATE INDEX IF NOT EXISTS items_parent ON items (library, json_extract(data, '$.parentItem'));
+
+CREATE TABLE IF NOT EXISTS tags (
+    tag text NOT NULL,
+    library integer NOT NULL,
+    meta text,
+    PRIMARY KEY (library, tag)
+);
+
+CREATE TABLE IF NOT EXISTS apikeys (
+    tokenhash text NOT NULL PRIMARY KEY,
+    name text NOT NULL,
+    userid integer DEFAULT 0 NOT NULL,
+    username text,
+    access text DEFAULT '{}' NOT NULL,
+    active integer DEFAULT 1 NOT NULL,
+    created text DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sync_runs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    groupid integer NOT NULL,
+    status text DEFAULT 'queued' NOT NULL,
+    trigger text NOT NULL,
+    requestedby text,
+    requested text DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')) NOT NULL,
+    started text,
+    finished text,
+    stage text,
+    collections integer DEFAULT 0 NOT NULL,
+    uploaded integer DEFAULT 0 NOT NULL,
+    downloaded integer DEFAULT 0 NOT NULL,
+    tags integer DEFAULT 0 NOT NULL,
+    deleted integer DEFAULT 0 NOT NULL,
+    error text,
+    CHECK (status IN ('queued', 'running', 'succeeded', 'failed'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS sync_runs_active ON sync_runs (groupid) WHERE status IN ('queued', 'running');
+
+CREATE INDEX IF NOT EXISTS sync_runs_groupid ON sync_runs (groupid, id DESC);
+
+--
+-- Change log of items and collections, see 0004_changes of the PostgreSQL
+-- backend. SQLite has no notifications; ListenChanges polls this table.
+--
+
+CREATE TABLE IF NOT EXISTS changes (
+    seq integer PRIMARY KEY AUTOINCREMENT,
+    library integer NOT NULL,
+    objecttype text NOT NULL,
+    key text NOT NULL,
+    version integer NOT NULL,
+    sync text,
+    changetype text NOT NULL,
+    changed text DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')) NOT NULL,
+    CHECK (objecttype IN ('item', 'collection')),
+    CHECK (changetype IN ('create', 'update', 'delete'))
+);
+
+CREATE INDEX IF NOT EXISTS changes_library ON changes (library, seq);
+
+CREATE TRIGGER IF NOT EXISTS items_changes_insert AFTER INSERT ON items
+BEGIN
+    INSERT INTO changes (library, objecttype, key, version, sync, changetype)
+        VALUES (NEW.library, 'item', NEW.key, NEW.version, NEW.sync, 'create');
+END;
+
+-- bookkeeping columns like gitlab and meta are no change of the object
+CREATE TRIGGER IF NOT EXISTS items_changes_update AFTER UPDATE ON items
+WHEN NEW.version IS NOT OLD.version OR NEW.sync IS NOT OLD.sync OR NEW.deleted IS NOT OLD.deleted OR NEW.data IS NOT OLD.data
+BEGIN
+    INSERT INTO changes (library, objecttype, key, version, sync, changetype)
+        VALUES (NEW.library, 'item', NEW.key, NEW.version, NEW.sync, CASE WHEN NEW.deleted AND NOT OLD.deleted THEN 'delete' ELSE 'update' END);
+END;
+
+CREATE TRIGGER IF NOT EXISTS items_changes_delete AFTER DELETE ON items
+BEGIN
+    INSERT INTO changes (library, objecttype, key, version, sync, changetype)
+        VALUES (OLD.library, 'item', OLD.key, OLD.version, OLD.sync, 'delete');
+END;
+
+CREATE TRIGGER IF NOT EXISTS collections_changes_insert AFTER INSERT ON collections
+BEGIN
+    INSERT INTO changes (library, objecttype, key, version, sync, changetype)
+        VALUES (NEW.library, 'collection', NEW.key, NEW.version, NEW.sync, 'create');
+END;
+
+CREATE TRIGGER IF NOT EXISTS collections_changes_update AFTER UPDATE ON collections
+WHEN NEW.version IS NOT OLD.version OR NEW.sync IS NOT OLD.sync OR NEW.deleted IS NOT OLD.deleted OR NEW.data IS NOT OLD.data
+BEGIN
+    INSERT INTO changes (library, objecttype, key, version, sync, changetype)
+        VALUES (NEW.library, 'collection', NEW.key, NEW.version, NEW.sync, CASE WHEN NEW.deleted AND NOT OLD.deleted THEN 'delete' ELSE 'update' END);
+END;
+
+CREATE TRIGGER IF NOT EXISTS collections_changes_delete AFTER DELETE ON collections
+BEGIN
+    INSERT INTO changes (library, objecttype, key, version, sync, changetype)
+        VALUES (OLD.library, 'collection', OLD.key, OLD.version, OLD.sync, 'delete');
+END;
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    groupid integer NOT NULL,
+    url text NOT NULL,
+    secret text NOT NULL,
+    events text DEFAULT '[]' NOT NULL,
+    active integer DEFAULT 1 NOT NULL,
+    created text DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_groupid ON webhooks (groupid);
+
+CREATE TABLE IF NOT EXISTS webhook_outbox (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    webhookid integer NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event text NOT NULL,
+    payload text NOT NULL,
+    status text DEFAULT 'pending' NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    nextattempt text DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')) NOT NULL,
+    responsestatus integer,
+    lasterror text,
+    created text DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')) NOT NULL,
+    delivered text,
+    CHECK (status IN ('pending', 'delivered', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS webhook_outbox_pending ON webhook_outbox (nextattempt) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS webhook_outbox_webhookid ON webhook_outbox (webhookid, id DESC);
@@ -0,0 +1,12 @@
+--
+-- Extracted text of attachments for SearchItems, which matches it together
+-- with the item data in Go.
+--
+
+CREATE TABLE IF NOT EXISTS item_fulltext (
+    library integer NOT NULL,
+    key text NOT NULL,
+    content text NOT NULL,
+    PRIMARY KEY (library, key),
+    FOREIGN KEY (library, key) REFERENCES items (library, key) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS items_tags_update;
+DROP TRIGGER IF EXISTS items_tags_insert;
+DROP TABLE IF EXISTS item_tags;
@@ -0,0 +1,38 @@
+--
+-- Relation of items and their tags, kept current by triggers on items like
+-- the PostgreSQL table item_tags. Duplicate names keep the first type.
+--
+
+CREATE TABLE IF NOT EXISTS item_tags (
+    library integer NOT NULL,
+    key text NOT NULL,
+    tag text NOT NULL,
+    type integer DEFAULT 0 NOT NULL,
+    PRIMARY KEY (library, key, tag),
+    FOREIGN KEY (library, key) REFERENCES items (library, key) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS item_tags_tag ON item_tags (library, tag);
+
+CREATE TRIGGER IF NOT EXISTS items_tags_insert AFTER INSERT ON items
+WHEN json_type(NEW.data, '$.tags') = 'array'
+BEGIN
+    INSERT OR IGNORE INTO item_tags (library, key, tag, type)
+        SELECT NEW.library, NEW.key, json_extract(t.value, '$.tag'), COALESCE(json_extract(t.value, '$.type'), 0)
+        FROM json_each(NEW.data, '$.tags') t
+        WHERE COALESCE(json_extract(t.value, '$.tag'), '') <> '';
+END;
+
+CREATE TRIGGER IF NOT EXISTS items_tags_update AFTER UPDATE OF data ON items
+BEGIN
+    DELETE FROM item_tags WHERE library = NEW.library AND key = NEW.key;
+    INSERT OR IGNORE INTO item_tags (library, key, tag, type)
+        SELECT NEW.library, NEW.key, json_extract(t.value, '$.tag'), COALESCE(json_extract(t.value, '$.type'), 0)
+        FROM json_each(NEW.data, '$.tags') t
+        WHERE json_type(NEW.data, '$.tags') = 'array' AND COALESCE(json_extract(t.value, '$.tag'), '') <> '';
+END;
+
+INSERT OR IGNORE INTO item_tags (library, key, tag, type)
+    SELECT i.library, i.key, json_extract(t.value, '$.tag'), COALESCE(json_extract(t.value, '$.type'), 0)
+    FROM items i, json_each(i.data, '$.tags') t
+    WHERE json_type(i.data, '$.tags') = 'array' AND COALESCE(json_extract(t.value, '$.tag'), '') <> '';
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS collections_webhooks_update;
+DROP TRIGGER IF EXISTS collections_webhooks_insert;
+DROP TRIGGER IF EXISTS items_webhooks_update;
+DROP TRIGGER IF EXISTS items_webhooks_insert;
+DROP VIEW IF EXISTS webhook_collection_payloads;
+DROP VIEW IF EXISTS webhook_item_payloads;
+DROP VIEW IF EXISTS webhook_subscriptions;
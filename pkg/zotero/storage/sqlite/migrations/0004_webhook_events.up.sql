@@ -0,0 +1,101 @@
+--
+-- Webhook events of items and collections, written by triggers in the
+-- transaction of the change like 0008_webhook_events of the PostgreSQL
+-- backend.
+--
+
+CREATE VIEW IF NOT EXISTS webhook_subscriptions AS
+    SELECT w.id, w.groupid, e.value AS event
+    FROM webhooks w, json_each(w.events) e
+    WHERE w.active = 1;
+
+-- the payloads lack event and timestamp, which the triggers add
+CREATE VIEW IF NOT EXISTS webhook_item_payloads AS
+    SELECT library, key, json_object(
+        'groupId', library,
+        'objectType', 'item',
+        'key', key,
+        'version', version,
+        'source', CASE WHEN sync = 'synced' THEN 'sync' ELSE 'local' END,
+        'item', json_object(
+            'key', key,
+            'version', version,
+            'library', json_object('type', 'group', 'id', library, 'name', '', 'links', json('null')),
+            'meta', json(COALESCE(meta, '{}')),
+            'data', json_set(data, '$.key', key, '$.version', version))) AS payload
+    FROM items
+    WHERE data IS NOT NULL;
+
+CREATE VIEW IF NOT EXISTS webhook_collection_payloads AS
+    SELECT library, key, json_object(
+        'groupId', library,
+        'objectType', 'collection',
+        'key', key,
+        'version', version,
+        'source', CASE WHEN sync = 'synced' THEN 'sync' ELSE 'local' END,
+        'collection', json_object(
+            'key', key,
+            'version', version,
+            'library', json_object('type', 'group', 'id', library, 'name', '', 'links', json('null')),
+            'meta', json(COALESCE(meta, '{}')),
+            'data', json(data))) AS payload
+    FROM collections
+    WHERE data IS NOT NULL;
+
+CREATE TRIGGER IF NOT EXISTS items_webhooks_insert AFTER INSERT ON items
+WHEN NEW.data IS NOT NULL AND NOT NEW.deleted
+BEGIN
+    INSERT INTO webhook_outbox (webhookid, event, payload)
+        SELECT s.id, s.event, json_set(p.payload, '$.event', s.event, '$.timestamp', strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+        FROM webhook_subscriptions s, webhook_item_payloads p
+        WHERE s.groupid = NEW.library AND p.library = NEW.library AND p.key = NEW.key
+            AND s.event IN ('created', CASE WHEN NEW.md5 IS NOT NULL THEN 'attachment' END)
+        ORDER BY s.event = 'attachment', s.id;
+END;
+
+-- version only changes after an upload are no change of the object
+CREATE TRIGGER IF NOT EXISTS items_webhooks_update AFTER UPDATE ON items
+WHEN NEW.data IS NOT NULL
+BEGIN
+    INSERT INTO webhook_outbox (webhookid, event, payload)
+        SELECT s.id, s.event, json_set(p.payload, '$.event', s.event, '$.timestamp', strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+        FROM webhook_subscriptions s, webhook_item_payloads p
+        WHERE s.groupid = NEW.library AND p.library = NEW.library AND p.key = NEW.key
+            AND s.event IN (
+                CASE
+                    WHEN OLD.data IS NULL THEN CASE WHEN NEW.deleted THEN NULL ELSE 'created' END
+                    WHEN NEW.deleted AND NOT OLD.deleted THEN 'deleted'
+                    WHEN NEW.deleted THEN NULL
+                    WHEN OLD.deleted OR NEW.trashed IS NOT OLD.trashed
+                        OR json_remove(NEW.data, '$.version') IS NOT json_remove(OLD.data, '$.version') THEN 'updated'
+                END,
+                CASE WHEN NOT NEW.deleted AND NEW.md5 IS NOT NULL AND NEW.md5 IS NOT OLD.md5 THEN 'attachment' END)
+        ORDER BY s.event = 'attachment', s.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS collections_webhooks_insert AFTER INSERT ON collections
+WHEN NEW.data IS NOT NULL AND NOT NEW.deleted
+BEGIN
+    INSERT INTO webhook_outbox (webhookid, event, payload)
+        SELECT s.id, s.event, json_set(p.payload, '$.event', s.event, '$.timestamp', strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+        FROM webhook_subscriptions s, webhook_collection_payloads p
+        WHERE s.groupid = NEW.library AND p.library = NEW.library AND p.key = NEW.key
+            AND s.event = 'created'
+        ORDER BY s.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS collections_webhooks_update AFTER UPDATE ON collections
+WHEN NEW.data IS NOT NULL
+BEGIN
+    INSERT INTO webhook_outbox (webhookid, event, payload)
+        SELECT s.id, s.event, json_set(p.payload, '$.event', s.event, '$.timestamp', strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+        FROM webhook_subscriptions s, webhook_collection_payloads p
+        WHERE s.groupid = NEW.library AND p.library = NEW.library AND p.key = NEW.key
+            AND s.event = CASE
+                WHEN OLD.data IS NULL THEN CASE WHEN NEW.deleted THEN NULL ELSE 'created' END
+                WHEN NEW.deleted AND NOT OLD.deleted THEN 'deleted'
+                WHEN NEW.deleted THEN NULL
+                WHEN OLD.deleted OR json_remove(NEW.data, '$.version') IS NOT json_remove(OLD.data, '$.version') THEN 'updated'
+            END
+        ORDER BY s.id;
+END;
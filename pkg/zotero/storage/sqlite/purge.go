@@ -0,0 +1,34 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// PurgeItems removes the deleted and synced items modified before before,
+// with their full text and tag rows.
+func (s *Storage) PurgeItems(ctx context.Context, groupId int64, before time.Time) (int64, error) {
+	return s.purge(ctx, SQLPurgeItems, groupId, before)
+}
+
+// PurgeCollections removes the deleted and synced collections modified
+// before before.
+func (s *Storage) PurgeCollections(ctx context.Context, groupId int64, before time.Time) (int64, error) {
+	return s.purge(ctx, SQLPurgeCollections, groupId, before)
+}
+
+func (s *Storage) purge(ctx context.Context, sqlstr string, groupId int64, before time.Time) (int64, error) {
+	params := namedArgs{
+		"library": groupId,
+		"sync":    model.SyncStatusString[model.SyncStatus_Synced],
+		"before":  formatTime(before),
+	}
+	result, err := s.db.ExecContext(ctx, sqlstr, params.args()...)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot execute %s", sqlstr)
+	}
+	return result.RowsAffected()
+}
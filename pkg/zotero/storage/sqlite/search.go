@@ -0,0 +1,61 @@
+package sqlite
+
+import (
+	"context"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+// SearchItems matches the words of query exactly; the language of filter
+// is only validated. See storage.SearchItemList.
+func (s *Storage) SearchItems(ctx context.Context, groupId int64, query string, filter *storage.SearchFilter, page *storage.Page) ([]*storage.SearchResult, int64, error) {
+	params := namedArgs{"library": groupId}
+	rows, err := s.db.QueryContext(ctx, SQLQueryItems, params.args()...)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "cannot execute %s", SQLQueryItems)
+	}
+	items, err := s.items(groupId, rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	fulltext, err := s.itemFulltexts(ctx, groupId)
+	if err != nil {
+		return nil, 0, err
+	}
+	return storage.SearchItemList(items, fulltext, query, filter, page)
+}
+
+// itemFulltexts returns the attachment full texts of the group by item key
+func (s *Storage) itemFulltexts(ctx context.Context, groupId int64) (map[string]string, error) {
+	params := namedArgs{"library": groupId}
+	rows, err := s.db.QueryContext(ctx, SQLGetItemFulltexts, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetItemFulltexts)
+	}
+	defer rows.Close()
+	fulltext := map[string]string{}
+	for rows.Next() {
+		var key, content string
+		if err := rows.Scan(&key, &content); err != nil {
+			return nil, errors.Wrap(err, "cannot scan item full text")
+		}
+		fulltext[key] = content
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate item full texts")
+	}
+	return fulltext, nil
+}
+
+func (s *Storage) SetItemFulltext(ctx context.Context, groupId int64, key string, content string) error {
+	params := namedArgs{"library": groupId, "key": key, "content": content}
+	result, err := s.db.ExecContext(ctx, SQLSetItemFulltext, params.args()...)
+	if err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLSetItemFulltext)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return errors.Errorf("item %v.%v not found", groupId, key)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package sqlite
+
+import (
+	"context"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// GetItemStates returns the sync state of all items of the group, including
+// deleted and empty ones, ordered by key.
+func (s *Storage) GetItemStates(ctx context.Context, groupId int64) ([]model.ObjectState, error) {
+	return s.states(ctx, SQLGetItemStates, groupId)
+}
+
+// GetCollectionStates returns the sync state of all collections of the
+// group, including deleted and empty ones, ordered by key.
+func (s *Storage) GetCollectionStates(ctx context.Context, groupId int64) ([]model.ObjectState, error) {
+	return s.states(ctx, SQLGetCollectionStates, groupId)
+}
+
+// ResetItems sets the version of the synced or incomplete items keys to 0
+// and marks them incomplete. Items with local changes are not touched.
+func (s *Storage) ResetItems(ctx context.Context, groupId int64, keys []string) (int64, error) {
+	return s.reset(ctx, SQLResetItems, groupId, keys)
+}
+
+// ResetCollections is ResetItems for collections.
+func (s *Storage) ResetCollections(ctx context.Context, groupId int64, keys []string) (int64, error) {
+	return s.reset(ctx, SQLResetCollections, groupId, keys)
+}
+
+func (s *Storage) states(ctx context.Context, sqlstr string, groupId int64) ([]model.ObjectState, error) {
+	params := namedArgs{
+		"library": groupId,
+	}
+	rows, err := s.db.QueryContext(ctx, sqlstr, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", sqlstr, params)
+	}
+	defer rows.Close()
+	states := []model.ObjectState{}
+	for rows.Next() {
+		var state model.ObjectState
+		var sync string
+		if err := rows.Scan(&state.Key, &state.Version, &sync, &state.Trashed, &state.Deleted); err != nil {
+			return nil, errors.Wrap(err, "cannot scan row")
+		}
+		state.Status = model.SyncStatusId[sync]
+		states = append(states, state)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "cannot read rows of %s", sqlstr)
+	}
+	return states, nil
+}
+
+func (s *Storage) reset(ctx context.Context, sqlstr string, groupId int64, keys []string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	keyArray, err := jsonArray(keys)
+	if err != nil {
+		return 0, err
+	}
+	params := namedArgs{
+		"library":        groupId,
+		"keys":           keyArray,
+		"syncSynced":     model.SyncStatusString[model.SyncStatus_Synced],
+		"syncIncomplete": model.SyncStatusString[model.SyncStatus_Incomplete],
+	}
+	result, err := s.db.ExecContext(ctx, sqlstr, params.args()...)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot execute %s: %v", sqlstr, params)
+	}
+	return result.RowsAffected()
+}
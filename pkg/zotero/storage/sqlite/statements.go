@@ -0,0 +1,138 @@
+package sqlite
+
+const (
+	// Collection statements
+	SQLInsertCollection              = `INSERT INTO collections (key, version, library, sync, data, deleted) VALUES (@key, @version, @library, @sync, @data, 0)`
+	SQLInsertEmptyCollection         = `INSERT INTO collections (key, version, library, sync) VALUES (@key, 0, @library, @sync)`
+	SQLGetCollectionVersion          = `SELECT version, sync FROM collections WHERE library = @library AND key = @key`
+	SQLGetCollections                = `SELECT ` + sqlCollectionFields + ` FROM collections WHERE library = @library AND key IN (SELECT value FROM json_each(@keys)) ORDER BY key`
+	SQLGetCollectionVersions         = `SELECT key, version FROM collections WHERE library = @library AND version > @sinceVersion`
+	SQLGetCollectionByKey            = `SELECT ` + sqlCollectionFields + ` FROM collections WHERE library = @library AND key = @key`
+	SQLGetCollectionByName           = `SELECT ` + sqlCollectionFields + ` FROM collections WHERE library = @library AND deleted = 0 AND json_extract(data, '$.name') = @name AND ` + sqlParentCollection + ` = @parent ORDER BY key LIMIT 1`
+	SQLGetCollectionKeyByName        = `SELECT key FROM collections WHERE library = @library AND deleted = 0 AND json_extract(data, '$.name') = @name AND ` + sqlParentCollection + ` = @parent ORDER BY key LIMIT 1`
+	SQLGetCollectionTree             = sqlCollectionSubtree + `SELECT key, version, data, meta, deleted, sync, gitlab FROM tree ORDER BY depth, json_extract(data, '$.name'), key`
+	SQLGetCollectionTreeTop          = sqlCollectionSubtreeTop + `SELECT key, version, data, meta, deleted, sync, gitlab FROM tree ORDER BY depth, json_extract(data, '$.name'), key`
+	SQLGetCollectionPath             = `WITH RECURSIVE anc(key, version, data, meta, deleted, sync, gitlab, depth, path) AS (SELECT key, version, data, meta, deleted, sync, gitlab, 0, ',' || key || ',' FROM collections WHERE library = @library AND key = @key UNION ALL SELECT c.key, c.version, c.data, c.meta, c.deleted, c.sync, c.gitlab, a.depth + 1, a.path || c.key || ',' FROM collections c JOIN anc a ON c.key = json_extract(a.data, '$.parentCollection') WHERE c.library = @library AND instr(a.path, ',' || c.key || ',') = 0) SELECT key, version, data, meta, deleted, sync, gitlab FROM anc ORDER BY depth DESC`
+	SQLGetCollectionChildren         = `SELECT ` + sqlCollectionFields + ` FROM collections WHERE library = @library AND deleted = 0 AND data IS NOT NULL AND ` + sqlParentCollection + ` = @parent ORDER BY json_extract(data, '$.name'), key`
+	SQLGetCollectionSubtreeKeys      = sqlCollectionSubtree + `SELECT key FROM tree`
+	SQLRemoveCollectionsFromItems    = `UPDATE items SET data = json_set(data, '$.collections', json((SELECT json_group_array(c.value) FROM json_each(items.data, '$.collections') c WHERE c.value NOT IN (SELECT value FROM json_each(@keys))))), sync = CASE WHEN sync = @syncNew THEN sync ELSE @syncModified END, modified = ` + sqlNow + ` WHERE library = @library AND deleted = 0 AND EXISTS (SELECT 1 FROM json_each(items.data, '$.collections') c WHERE c.value IN (SELECT value FROM json_each(@keys)))`
+	SQLUpdateCollection              = `UPDATE collections SET version = @version, sync = @sync, data = @data, meta = @meta, deleted = @deleted, modified = ` + sqlNow + ` WHERE library = @library AND key = @key`
+	SQLDeleteCollection              = `UPDATE collections SET deleted = 1, sync = @sync, modified = ` + sqlNow + ` WHERE library = @library AND key = @key`
+	SQLDeleteCollections             = `UPDATE collections SET deleted = 1, sync = @sync, modified = ` + sqlNow + ` WHERE library = @library AND key IN (SELECT value FROM json_each(@keys))`
+	SQLPurgeCollections              = `DELETE FROM collections WHERE library = @library AND deleted = 1 AND sync = @sync AND modified < @before`
+	SQLGetCollectionStates           = `SELECT key, version, sync, 0, deleted FROM collections WHERE library = @library ORDER BY key`
+	SQLResetCollections              = `UPDATE collections SET version = 0, sync = @syncIncomplete, modified = ` + sqlNow + ` WHERE library = @library AND key IN (SELECT value FROM json_each(@keys)) AND (sync = @syncSynced OR sync = @syncIncomplete)`
+	SQLIterateCollections            = `SELECT ` + sqlCollectionFields + ` FROM collections WHERE library = @library AND deleted = 0 AND modified > @after ORDER BY key`
+	SQLIterateCollectionsAll         = `SELECT ` + sqlCollectionFields + ` FROM collections WHERE library = @library AND modified > @after ORDER BY key`
+	SQLGetModifiedCollections        = `SELECT ` + sqlCollectionFields + ` FROM collections WHERE library = @library AND (sync = @syncNew OR sync = @syncModified) ORDER BY key`
+	SQLUpdateCollectionsGitlab       = `UPDATE collections SET gitlab = @now WHERE library = @library AND (gitlab IS NULL OR @now > gitlab)`
+	SQLUpdateCollectionsGitlabFilter = `UPDATE collections SET gitlab = @now WHERE library = @library AND (gitlab IS NULL OR @now > gitlab) AND (gitlab IS NULL OR gitlab >= @gitlab)`
+
+	// Group statements
+	SQLGetGroup                    = `SELECT version, created, modified, data, active, direction, tags, itemversion, collectionversion, tagversion, gitlab FROM groups g, syncgroups sg WHERE g.id = sg.id AND g.id = @id`
+	SQLGetGroups                   = `SELECT id FROM syncgroups WHERE active = 1 ORDER BY id`
+	SQLInsertEmptyGroup            = `INSERT INTO groups (id, version, created, modified) VALUES (@id, 0, ` + sqlNow + `, ` + sqlNow + `) ON CONFLICT (id) DO NOTHING`
+	SQLInsertEmptySyncGroup        = `INSERT INTO syncgroups (id, active, direction) VALUES (@id, @active, @direction) ON CONFLICT (id) DO NOTHING`
+	SQLGetSyncGroupActiveDirection = `SELECT active, direction FROM syncgroups WHERE id = @id`
+	SQLClearGroup                  = `UPDATE groups SET version = 0, modified = created, itemversion = 0, collectionversion = 0, tagversion = 0 WHERE id = @id`
+	SQLListGroups                  = `SELECT g.id, version, created, modified, data, deleted, active, direction, tags, itemversion, collectionversion, tagversion, gitlab FROM groups g, syncgroups sg WHERE g.id = sg.id ORDER BY g.id`
+	SQLUpdateSyncGroup             = `UPDATE syncgroups SET active = @active, direction = @direction, tags = @tags WHERE id = @id`
+	SQLUpdateGroup                 = `UPDATE groups SET version = @version, created = @created, modified = @modified, data = @data, deleted = @deleted, itemversion = @itemversion, collectionversion = @collectionversion, tagversion = @tagversion WHERE id = @id`
+	SQLUpdateGroupGitlabTimestamp  = `UPDATE groups SET gitlab = @gitlab WHERE id = @id`
+
+	// Item statements
+	SQLInsertItem                    = `INSERT INTO items (key, version, library, sync, data, oldid) VALUES (@key, @version, @library, @sync, @data, @oldid)`
+	SQLInsertEmptyItem               = `INSERT INTO items (key, version, library, sync, oldid) VALUES (@key, 0, @library, @sync, @oldid)`
+	SQLGetItemVersion                = `SELECT version, sync FROM items WHERE library = @library AND key = @key`
+	SQLGetItemVersions               = `SELECT key, version FROM items WHERE library = @library AND version > @sinceVersion AND trashed = @trashed`
+	SQLGetItems                      = `SELECT ` + sqlItemFields + ` FROM items WHERE library = @library AND key IN (SELECT value FROM json_each(@keys)) ORDER BY key`
+	SQLGetItemByKey                  = `SELECT ` + sqlItemFields + ` FROM items WHERE library = @library AND key = @key`
+	SQLGetItemByOldid                = `SELECT ` + sqlItemFields + ` FROM items WHERE library = @library AND oldid = @oldid`
+	SQLUpdateItem                    = `UPDATE items SET version = @version, data = @data, meta = @meta, trashed = @trashed, deleted = @deleted, sync = @sync, md5 = @md5, modified = ` + sqlNow + ` WHERE library = @library AND key = @key`
+	SQLUpdateItemVersion0            = `UPDATE items SET data = @data, meta = @meta, trashed = @trashed, deleted = @deleted, sync = @sync, md5 = @md5, modified = ` + sqlNow + ` WHERE library = @library AND key = @key`
+	SQLDeleteItem                    = `UPDATE items SET deleted = 1, sync = @sync, modified = ` + sqlNow + ` WHERE library = @library AND key = @key`
+	SQLDeleteItems                   = `UPDATE items SET deleted = 1, sync = @sync, modified = ` + sqlNow + ` WHERE library = @library AND key IN (SELECT value FROM json_each(@keys))`
+	SQLPurgeItems                    = `DELETE FROM items WHERE library = @library AND deleted = 1 AND sync = @sync AND modified < @before`
+	SQLGetItemStates                 = `SELECT key, version, sync, trashed, deleted FROM items WHERE library = @library ORDER BY key`
+	SQLResetItems                    = `UPDATE items SET version = 0, sync = @syncIncomplete, modified = ` + sqlNow + ` WHERE library = @library AND key IN (SELECT value FROM json_each(@keys)) AND (sync = @syncSynced OR sync = @syncIncomplete)`
+	SQLGetChildren                   = `SELECT ` + sqlItemFields + ` FROM items WHERE library = @library AND trashed = 0 AND deleted = 0 AND json_extract(data, '$.parentItem') = @parent ORDER BY key`
+	SQLIterateItems                  = `SELECT ` + sqlItemFields + ` FROM items WHERE library = @library AND deleted = 0 AND modified > @after ORDER BY key`
+	SQLIterateItemsAll               = `SELECT ` + sqlItemFields + ` FROM items WHERE library = @library AND modified > @after ORDER BY key`
+	SQLGetModifiedItems              = `SELECT ` + sqlItemFields + ` FROM items WHERE library = @library AND (sync = @syncNew OR sync = @syncModified) ORDER BY key`
+	SQLGetItemsInCollection          = `SELECT ` + sqlItemFields + ` FROM items WHERE library = @library AND deleted = 0 AND trashed = 0 AND EXISTS (SELECT 1 FROM json_each(items.data, '$.collections') c WHERE c.value = @key) ORDER BY key`
+	SQLGetItemsInCollectionRecursive = sqlCollectionSubtree + `SELECT ` + sqlItemFields + ` FROM items WHERE library = @library AND deleted = 0 AND trashed = 0 AND EXISTS (SELECT 1 FROM json_each(items.data, '$.collections') c WHERE c.value IN (SELECT key FROM tree)) ORDER BY key`
+	SQLQueryItems                    = `SELECT ` + sqlItemFields + ` FROM items WHERE library = @library AND deleted = 0`
+	SQLGetItemFulltexts              = `SELECT key, content FROM item_fulltext WHERE library = @library`
+	SQLSetItemFulltext               = `INSERT INTO item_fulltext (library, key, content) SELECT library, key, @content FROM items WHERE library = @library AND key = @key AND data IS NOT NULL ON CONFLICT (library, key) DO UPDATE SET content = excluded.content`
+	SQLUpdateItemsGitlab             = `UPDATE items SET gitlab = @now WHERE library = @library AND (gitlab IS NULL OR @now > gitlab)`
+	SQLUpdateItemsGitlabFilter       = `UPDATE items SET gitlab = @now WHERE library = @library AND (gitlab IS NULL OR @now > gitlab) AND (gitlab IS NULL OR gitlab >= @gitlab)`
+
+	// Tag statements
+	SQLInsertTag     = `INSERT INTO tags (tag, meta, library) VALUES (@tag, @meta, @library) ON CONFLICT (library, tag) DO NOTHING`
+	SQLDeleteTag     = `DELETE FROM tags WHERE tag = @tag AND library = @library`
+	SQLDeleteTags    = `DELETE FROM tags WHERE library = @library AND tag IN (SELECT value FROM json_each(@tags))`
+	SQLGetTagUsage   = `SELECT t.tag, t.type, COUNT(*) FROM item_tags t JOIN items i ON i.library = t.library AND i.key = t.key WHERE t.library = @library AND i.deleted = 0 AND i.trashed = 0 GROUP BY t.tag, t.type ORDER BY t.tag, t.type`
+	SQLGetItemsByTag = `SELECT ` + sqlItemFields + ` FROM items WHERE library = @library AND deleted = 0 AND trashed = 0 AND key IN (SELECT key FROM item_tags WHERE library = @library AND tag = @tag) ORDER BY key`
+	// SQLMergeTagsInItems replaces the tags @tags of all items by @target and
+	// keeps the first of duplicate tags
+	SQLMergeTagsInItems = `UPDATE items SET data = json_set(data, '$.tags', json((SELECT json_group_array(json(m.v) ORDER BY m.ord) FROM (SELECT CASE WHEN json_extract(t.value, '$.tag') IN (SELECT value FROM json_each(@tags)) THEN json_set(t.value, '$.tag', @target) ELSE t.value END AS v, MIN(t.key) AS ord FROM json_each(items.data, '$.tags') t GROUP BY CASE WHEN json_extract(t.value, '$.tag') IN (SELECT value FROM json_each(@tags)) THEN @target ELSE json_extract(t.value, '$.tag') END) m))), sync = CASE WHEN sync = @syncNew THEN sync ELSE @syncModified END, modified = ` + sqlNow + ` WHERE library = @library AND deleted = 0 AND key IN (SELECT key FROM item_tags WHERE library = @library AND tag IN (SELECT value FROM json_each(@tags)))`
+	SQLMergeTagRows     = `INSERT INTO tags (tag, meta, library) SELECT @target, meta, library FROM tags WHERE library = @library AND tag IN (SELECT value FROM json_each(@tags)) LIMIT 1 ON CONFLICT (library, tag) DO NOTHING`
+
+	// API key statements
+	SQLGetApiKey = `SELECT userid, username, access FROM apikeys WHERE tokenhash = @tokenhash AND active = 1`
+
+	// Sync run statements
+	SQLAbandonSyncRuns = `UPDATE sync_runs SET status = 'failed', finished = ` + sqlNow + `, error = 'abandoned' WHERE groupid = @groupid AND status IN ('queued', 'running') AND COALESCE(started, requested) < @before`
+	SQLInsertSyncRun   = `INSERT INTO sync_runs (groupid, status, trigger, requestedby) VALUES (@groupid, @status, @trigger, @requestedby) RETURNING id, requested`
+	SQLUpdateSyncRun   = `UPDATE sync_runs SET status = @status, started = @started, finished = @finished, stage = @stage, collections = @collections, uploaded = @uploaded, downloaded = @downloaded, tags = @tags, deleted = @deleted, error = @error WHERE id = @id`
+	SQLGetSyncRun      = `SELECT ` + sqlSyncRunFields + ` FROM sync_runs WHERE id = @id`
+	SQLGetSyncRuns     = `SELECT ` + sqlSyncRunFields + ` FROM sync_runs WHERE groupid = @groupid ORDER BY id DESC LIMIT @limit`
+
+	// Change feed statements
+	SQLGetChanges      = `SELECT seq, library, objecttype, key, version, sync, changetype, changed FROM changes WHERE library = @library AND seq > @after ORDER BY seq LIMIT @limit`
+	SQLLatestChangeSeq = `SELECT COALESCE(MAX(seq), 0) FROM changes WHERE library = @library`
+	SQLMaxChangeSeq    = `SELECT COALESCE(MAX(seq), 0) FROM changes`
+	SQLPollChanges     = `SELECT library, seq FROM changes WHERE seq > @after ORDER BY seq`
+
+	// Schema migration statements
+	SQLCreateSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (version integer NOT NULL PRIMARY KEY, name text NOT NULL, applied text DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')) NOT NULL)`
+	SQLGetSchemaMigrations    = `SELECT version, name, applied FROM schema_migrations ORDER BY version`
+	SQLInsertSchemaMigration  = `INSERT INTO schema_migrations (version, name) VALUES (@version, @name)`
+	SQLDeleteSchemaMigration  = `DELETE FROM schema_migrations WHERE version = @version`
+
+	// Webhook statements
+	SQLInsertWebhook          = `INSERT INTO webhooks (groupid, url, secret, events, active) VALUES (@groupid, @url, @secret, @events, @active) RETURNING id, created`
+	SQLUpdateWebhook          = `UPDATE webhooks SET url = @url, events = @events, active = @active WHERE id = @id`
+	SQLDeleteWebhook          = `DELETE FROM webhooks WHERE id = @id`
+	SQLGetWebhook             = `SELECT ` + sqlWebhookFields + ` FROM webhooks WHERE id = @id`
+	SQLGetWebhooks            = `SELECT ` + sqlWebhookFields + ` FROM webhooks WHERE groupid = @groupid ORDER BY id`
+	SQLGetDueWebhookDelivery  = `SELECT ` + sqlWebhookDeliveryFields + `, o.payload, w.url, w.secret FROM webhook_outbox o, webhooks w WHERE w.id = o.webhookid AND o.status = 'pending' AND o.nextattempt <= ` + sqlNow + ` ORDER BY o.id LIMIT @limit`
+	SQLLeaseWebhookDeliveries = `UPDATE webhook_outbox SET nextattempt = @lease WHERE id IN (SELECT value FROM json_each(@ids))`
+	SQLUpdateWebhookDelivery  = `UPDATE webhook_outbox SET status = @status, attempts = @attempts, nextattempt = @nextattempt, responsestatus = @responsestatus, lasterror = @lasterror, delivered = @delivered WHERE id = @id`
+	SQLGetWebhookDeliveries   = `SELECT ` + sqlWebhookDeliveryFields + ` FROM webhook_outbox o WHERE o.webhookid = @webhookid ORDER BY o.id DESC LIMIT @limit`
+)
+
+// sqlNow is the current time in the format of all timestamps
+const sqlNow = `strftime('%Y-%m-%d %H:%M:%f', 'now')`
+
+// sqlParentCollection is the parent key of a collection or an empty string
+// for top-level collections, which store false
+const sqlParentCollection = `CASE json_type(data, '$.parentCollection') WHEN 'text' THEN json_extract(data, '$.parentCollection') ELSE '' END`
+
+const sqlCollectionFields = `key, version, data, meta, deleted, sync, gitlab`
+
+const sqlItemFields = `key, version, data, meta, trashed, deleted, sync, md5, gitlab`
+
+const sqlWebhookFields = `id, groupid, url, secret, events, active, created`
+
+const sqlWebhookDeliveryFields = `o.id, o.webhookid, o.event, o.status, o.attempts, o.nextattempt, o.responsestatus, o.lasterror, o.created, o.delivered`
+
+const sqlSyncRunFields = `id, groupid, status, trigger, requestedby, requested, started, finished, stage, collections, uploaded, downloaded, tags, deleted, error`
+
+// sqlCollectionSubtree selects the collection @key and all its descendants
+// into the CTE tree. The path column stops the recursion on cyclic data.
+const sqlCollectionSubtree = `WITH RECURSIVE tree(key, version, data, meta, deleted, sync, gitlab, depth, path) AS (SELECT key, version, data, meta, deleted, sync, gitlab, 0, ',' || key || ',' FROM collections WHERE library = @library AND key = @key AND deleted = 0 AND data IS NOT NULL UNION ALL SELECT c.key, c.version, c.data, c.meta, c.deleted, c.sync, c.gitlab, t.depth + 1, t.path || c.key || ',' FROM collections c JOIN tree t ON json_extract(c.data, '$.parentCollection') = t.key WHERE c.library = @library AND c.deleted = 0 AND instr(t.path, ',' || c.key || ',') = 0) `
+
+// sqlCollectionSubtreeTop is sqlCollectionSubtree starting at all top-level
+// collections of the library.
+const sqlCollectionSubtreeTop = `WITH RECURSIVE tree(key, version, data, meta, deleted, sync, gitlab, depth, path) AS (SELECT key, version, data, meta, deleted, sync, gitlab, 0, ',' || key || ',' FROM collections WHERE library = @library AND deleted = 0 AND data IS NOT NULL AND ` + sqlParentCollection + ` = '' UNION ALL SELECT c.key, c.version, c.data, c.meta, c.deleted, c.sync, c.gitlab, t.depth + 1, t.path || c.key || ',' FROM collections c JOIN tree t ON json_extract(c.data, '$.parentCollection') = t.key WHERE c.library = @library AND c.deleted = 0 AND instr(t.path, ',' || c.key || ',') = 0) `
@@ -0,0 +1,251 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json/v2"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DefaultPollInterval is the default interval in which ListenChanges looks
+// for new changes.
+const DefaultPollInterval = time.Second
+
+// timeFormat is the format of all timestamps. They are stored in UTC, so
+// they sort like the time and compare with strftime('%Y-%m-%d %H:%M:%f').
+const timeFormat = "2006-01-02 15:04:05.000"
+
+// defaultDSNOptions are added to the DSN unless it sets them itself. Write
+// transactions take the database lock when they begin, so concurrent
+// processes wait for each other instead of failing on lock upgrades.
+var defaultDSNOptions = []struct{ name, option string }{
+	{"foreign_keys", "_pragma=foreign_keys(1)"},
+	{"busy_timeout", "_pragma=busy_timeout(10000)"},
+	{"journal_mode", "_pragma=journal_mode(WAL)"},
+	{"_txlock", "_txlock=immediate"},
+}
+
+// Storage provides SQLite persistence for Zotero groups and their child
+// objects with the semantics of storage.Storage.
+type Storage struct {
+	db             *sql.DB
+	newGroupActive bool
+	Logger         zLogger.ZLogger
+	// PollInterval is the interval in which ListenChanges looks for new
+	// changes, DefaultPollInterval if 0
+	PollInterval time.Duration
+}
+
+var _ storage.Store = (*Storage)(nil)
+
+// Open opens the SQLite database dsn, e.g. a file name or
+// "file:zotero.db?_pragma=busy_timeout(5000)", and applies pending
+// migrations. newGroupActive controls the default active state of newly
+// discovered groups.
+func Open(ctx context.Context, dsn string, newGroupActive bool, logger zLogger.ZLogger) (*Storage, error) {
+	db, err := sql.Open("sqlite", dsnWithDefaults(dsn))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open sqlite database %s", dsn)
+	}
+	// a single connection serializes the writers of this process and keeps
+	// in-memory databases alive
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "cannot open sqlite database %s", dsn)
+	}
+	s := &Storage{
+		db:             db,
+		newGroupActive: newGroupActive,
+		Logger:         logger,
+	}
+	if _, err := s.MigrateUp(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// dsnWithDefaults adds the defaultDSNOptions not set in dsn
+func dsnWithDefaults(dsn string) string {
+	for _, def := range defaultDSNOptions {
+		if strings.Contains(dsn, def.name) {
+			continue
+		}
+		if strings.Contains(dsn, "?") {
+			dsn += "&" + def.option
+		} else {
+			dsn += "?" + def.option
+		}
+	}
+	return dsn
+}
+
+// Close closes the database.
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+func (s *Storage) GetDB() *sql.DB {
+	return s.db
+}
+
+// dbConn is implemented by sql.DB and sql.Tx, so helpers can run inside or
+// outside a transaction.
+type dbConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// rowScanner is implemented by sql.Row and sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// namedArgs are the @name parameters of a statement
+type namedArgs map[string]any
+
+func (p namedArgs) args() []any {
+	args := make([]any, 0, len(p))
+	for name, value := range p {
+		args = append(args, sql.Named(name, value))
+	}
+	return args
+}
+
+// IsUniqueViolation reports whether err is SQLite's unique-constraint
+// violation, optionally restricted to the columns, e.g. "items.library,
+// items.oldid".
+func IsUniqueViolation(err error, columns string) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	if sqliteErr.Code() != sqlite3.SQLITE_CONSTRAINT_UNIQUE && sqliteErr.Code() != sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY {
+		return false
+	}
+	return columns == "" || strings.Contains(sqliteErr.Error(), columns)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// formatTimePtr returns the stored form of t or nil
+func formatTimePtr(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return formatTime(*t)
+}
+
+// nullTime scans a timestamp column
+type nullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (nt *nullTime) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		nt.Time, nt.Valid = time.Time{}, false
+		return nil
+	case time.Time:
+		nt.Time, nt.Valid = v, true
+		return nil
+	case string:
+		return nt.parse(v)
+	case []byte:
+		return nt.parse(string(v))
+	}
+	return errors.Errorf("cannot scan %T into timestamp", src)
+}
+
+func (nt *nullTime) parse(str string) error {
+	t, err := time.ParseInLocation(timeFormat, str, time.UTC)
+	if err != nil {
+		// values written by other tools, e.g. CURRENT_TIMESTAMP
+		if t, err = time.ParseInLocation(time.DateTime, str, time.UTC); err != nil {
+			return errors.Wrapf(err, "invalid timestamp %q", str)
+		}
+	}
+	nt.Time, nt.Valid = t, true
+	return nil
+}
+
+// ptr returns the time or nil
+func (nt nullTime) ptr() *time.Time {
+	if !nt.Valid {
+		return nil
+	}
+	t := nt.Time
+	return &t
+}
+
+// formatAfter returns the lower bound of the modification time for the
+// iterate statements. Like storage.Storage it has a precision of seconds; nil
+// selects everything.
+func formatAfter(after *time.Time) string {
+	if after == nil {
+		return ""
+	}
+	return formatTime(after.Truncate(time.Second))
+}
+
+// jsonArray returns values as JSON array for json_each
+func jsonArray(values []string) (string, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot marshal %v", values)
+	}
+	return string(data), nil
+}
+
+// scanStrings reads the single text column of rows
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	result := []string{}
+	for rows.Next() {
+		var str string
+		if err := rows.Scan(&str); err != nil {
+			return nil, errors.Wrap(err, "cannot scan row")
+		}
+		result = append(result, str)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate rows")
+	}
+	return result, nil
+}
+
+// updateGitlab sets the backup timestamp of the objects of the group to now
+// with sqlstr, or with sqlFilter if gitlab is given, like the gitlab
+// statements of storage.Storage.
+func updateGitlab(ctx context.Context, db dbConn, sqlstr, sqlFilter string, groupId int64, now time.Time, gitlab *time.Time) error {
+	params := namedArgs{
+		"now":     formatTime(now.Truncate(time.Second)),
+		"library": groupId,
+	}
+	if gitlab != nil {
+		sqlstr = sqlFilter
+		params["gitlab"] = formatTime(gitlab.Truncate(time.Second))
+	}
+	if _, err := db.ExecContext(ctx, sqlstr, params.args()...); err != nil {
+		return errors.Wrapf(err, "cannot execute %v - %v", sqlstr, params)
+	}
+	return nil
+}
+
+// nullString returns s or NULL for empty strings
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,730 @@
+package sqlite_test
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/sqlite"
+)
+
+const testGroup int64 = 4711
+
+func newItem(title string, collections ...string) *model.ItemGeneric {
+	return &model.ItemGeneric{
+		ItemDataBase: model.ItemDataBase{
+			ItemType:    "book",
+			Collections: collections,
+		},
+		Title: title,
+	}
+}
+
+// newStorage opens a new database in a temporary directory
+func newStorage(t *testing.T, newGroupActive bool) *sqlite.Storage {
+	t.Helper()
+	st, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "zotero.db"), newGroupActive, nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func TestItems(t *testing.T) {
+	ctx := context.Background()
+	st := newStorage(t, false)
+
+	item, err := st.CreateItem(ctx, testGroup, newItem("First"), nil, "src:1")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	got, err := st.GetItemByKey(ctx, testGroup, item.Key)
+	if err != nil || got == nil {
+		t.Fatalf("GetItemByKey: %v, %v", got, err)
+	}
+	if got.Data.Title != "First" || got.Status != model.SyncStatus_New {
+		t.Errorf("unexpected item %+v", got)
+	}
+
+	// a second item with the same oldid updates the first one
+	second, err := st.CreateItem(ctx, testGroup, newItem("Second"), nil, "src:1")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	if second.Key != item.Key || second.Status != model.SyncStatus_Modified {
+		t.Errorf("expected update of %s, got %s (%v)", item.Key, second.Key, second.Status)
+	}
+	byOldid, err := st.GetItemByOldid(ctx, testGroup, "src:1")
+	if err != nil || byOldid == nil || byOldid.Data.Title != "Second" {
+		t.Errorf("GetItemByOldid: %v, %v", byOldid, err)
+	}
+
+	if _, err := st.ModifyItem(ctx, testGroup, item.Key, func(item *model.Item) error {
+		item.Version = 7
+		item.Status = model.SyncStatus_Synced
+		return nil
+	}); err != nil {
+		t.Fatalf("ModifyItem: %v", err)
+	}
+	versions, last, err := st.GetItemVersions(ctx, testGroup, 0, false)
+	if err != nil || last != 7 || versions[item.Key] != 7 {
+		t.Errorf("GetItemVersions: %v, %v, %v", versions, last, err)
+	}
+
+	// missing items are created incomplete and are not returned
+	version, status, err := st.GetItemVersion(ctx, testGroup, "MISSING1", "")
+	if err != nil || version != 0 || status != model.SyncStatus_Incomplete {
+		t.Errorf("GetItemVersion: %v, %v, %v", version, status, err)
+	}
+	if missing, err := st.GetItemByKey(ctx, testGroup, "MISSING1"); err != nil || missing != nil {
+		t.Errorf("expected no incomplete item, got %v, %v", missing, err)
+	}
+
+	if err := st.DeleteItem(ctx, testGroup, item.Key); err != nil {
+		t.Fatalf("DeleteItem: %v", err)
+	}
+	if deleted, _ := st.GetItemByKey(ctx, testGroup, item.Key); !deleted.Deleted || deleted.Status != model.SyncStatus_Modified {
+		t.Errorf("expected deleted and modified item, got %+v", deleted)
+	}
+	var num int
+	if err := st.IterateItems(ctx, testGroup, nil, func(item *model.Item) error { num++; return nil }); err != nil || num != 0 {
+		t.Errorf("IterateItems: %v items, %v", num, err)
+	}
+}
+
+func TestCollections(t *testing.T) {
+	ctx := context.Background()
+	st := newStorage(t, false)
+
+	key, err := st.EnsureCollectionPath(ctx, testGroup, []string{"Videos", "1998", "Class A"})
+	if err != nil {
+		t.Fatalf("EnsureCollectionPath: %v", err)
+	}
+	again, err := st.EnsureCollectionPath(ctx, testGroup, []string{"Videos", "1998", "Class A"})
+	if err != nil || again != key {
+		t.Fatalf("EnsureCollectionPath created %s instead of %s: %v", again, key, err)
+	}
+	path, err := st.GetCollectionPath(ctx, testGroup, key)
+	if err != nil || len(path) != 3 || path[0].Data.Name != "Videos" || path[2].Key != key {
+		t.Fatalf("GetCollectionPath: %v, %v", path, err)
+	}
+	top := path[0].Key
+	tree, err := st.GetCollectionTree(ctx, testGroup, "")
+	if err != nil || len(tree) != 1 || len(tree[0].Children) != 1 || len(tree[0].Children[0].Children) != 1 {
+		t.Fatalf("GetCollectionTree: %v, %v", tree, err)
+	}
+
+	item, err := st.CreateItem(ctx, testGroup, newItem("In Class A", key), nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	items, err := st.GetItemsInCollection(ctx, testGroup, top, true)
+	if err != nil || len(items) != 1 || items[0].Key != item.Key {
+		t.Fatalf("GetItemsInCollection: %v, %v", items, err)
+	}
+	if items, _ := st.GetItemsInCollection(ctx, testGroup, top, false); len(items) != 0 {
+		t.Errorf("expected no direct items in %s, got %d", top, len(items))
+	}
+
+	_, err = st.ModifyCollection(ctx, testGroup, top, func(coll *model.Collection) error {
+		coll.Data.ParentCollection = model.Parent(key)
+		return nil
+	})
+	if !errors.Is(err, storage.ErrCollectionCycle) {
+		t.Errorf("expected ErrCollectionCycle, got %v", err)
+	}
+	if _, err := st.DeleteCollectionTree(ctx, testGroup, top, false); !errors.Is(err, storage.ErrCollectionNotEmpty) {
+		t.Errorf("expected ErrCollectionNotEmpty, got %v", err)
+	}
+	keys, err := st.DeleteCollectionTree(ctx, testGroup, top, true)
+	if err != nil || len(keys) != 3 {
+		t.Fatalf("DeleteCollectionTree: %v, %v", keys, err)
+	}
+	updated, _ := st.GetItemByKey(ctx, testGroup, item.Key)
+	if len(updated.Data.Collections) != 0 || updated.Status != model.SyncStatus_New {
+		t.Errorf("expected item without collections, got %v (%v)", updated.Data.Collections, updated.Status)
+	}
+	if tree, _ := st.GetCollectionTree(ctx, testGroup, ""); len(tree) != 0 {
+		t.Errorf("expected empty tree, got %v", tree)
+	}
+}
+
+func TestQueryItems(t *testing.T) {
+	ctx := context.Background()
+	st := newStorage(t, false)
+	for _, title := range []string{"Charlie", "alpha", "Bravo"} {
+		if _, err := st.CreateItem(ctx, testGroup, newItem(title), nil, ""); err != nil {
+			t.Fatalf("CreateItem: %v", err)
+		}
+	}
+	items, total, err := st.QueryItems(ctx, testGroup, &storage.ItemQuery{Sort: "title", Direction: "asc", Limit: 2})
+	if err != nil {
+		t.Fatalf("QueryItems: %v", err)
+	}
+	if total != 3 || len(items) != 2 || items[0].Data.Title != "alpha" || items[1].Data.Title != "Bravo" {
+		t.Errorf("unexpected page %v of %d", items, total)
+	}
+	items, total, err = st.QueryItems(ctx, testGroup, &storage.ItemQuery{Q: "rav"})
+	if err != nil || total != 1 || items[0].Data.Title != "Bravo" {
+		t.Errorf("QueryItems q: %v, %d, %v", items, total, err)
+	}
+	if _, _, err := st.QueryItems(ctx, testGroup, &storage.ItemQuery{Sort: "unknown"}); !errors.Is(err, storage.ErrInvalidQuery) {
+		t.Errorf("expected ErrInvalidQuery, got %v", err)
+	}
+}
+
+func TestSearchItems(t *testing.T) {
+	ctx := context.Background()
+	st := newStorage(t, false)
+	report, err := st.CreateItem(ctx, testGroup, newItem("Annual Report"), nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	pdf, err := st.CreateItem(ctx, testGroup, &model.ItemGeneric{ItemDataBase: model.ItemDataBase{ItemType: "attachment", ParentItem: report.Key}, Title: "PDF"}, nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	if err := st.SetItemFulltext(ctx, testGroup, pdf.Key, "the annual budget in detail"); err != nil {
+		t.Fatalf("SetItemFulltext: %v", err)
+	}
+	if err := st.SetItemFulltext(ctx, testGroup, "MISSING1", "text"); err == nil {
+		t.Error("expected error for missing item")
+	}
+	results, total, err := st.SearchItems(ctx, testGroup, "annual", nil, &storage.Page{Limit: 1})
+	if err != nil {
+		t.Fatalf("SearchItems: %v", err)
+	}
+	if total != 2 || len(results) != 1 || results[0].Item.Key != report.Key || results[0].Highlights.Title != "<b>Annual</b> Report" {
+		t.Errorf("unexpected results %v of %d", results, total)
+	}
+	results, total, err = st.SearchItems(ctx, testGroup, "budget", &storage.SearchFilter{ItemType: "attachment"}, nil)
+	if err != nil || total != 1 || results[0].Highlights.Snippet != "the annual <b>budget</b> in detail" {
+		t.Errorf("SearchItems full text: %v, %d, %v", results, total, err)
+	}
+	if _, _, err := st.SearchItems(ctx, testGroup, "", nil, nil); !errors.Is(err, storage.ErrInvalidQuery) {
+		t.Errorf("expected ErrInvalidQuery, got %v", err)
+	}
+}
+
+func TestItemTags(t *testing.T) {
+	ctx := context.Background()
+	st := newStorage(t, false)
+	tagged := func(title string, tags ...model.ItemTag) *model.Item {
+		data := newItem(title)
+		data.Tags = tags
+		item, err := st.CreateItem(ctx, testGroup, data, nil, "")
+		if err != nil {
+			t.Fatalf("CreateItem: %v", err)
+		}
+		return item
+	}
+	first := tagged("First", model.ItemTag{Tag: "history"}, model.ItemTag{Tag: "auto", Type: 1})
+	second := tagged("Second", model.ItemTag{Tag: "History"}, model.ItemTag{Tag: "history"})
+	tagged("Third", model.ItemTag{Tag: "auto"})
+	if err := st.CreateTag(ctx, testGroup, model.Tag{Tag: "History", Meta: &model.TagMeta{}}); err != nil {
+		t.Fatalf("CreateTag: %v", err)
+	}
+
+	items, err := st.GetItemsByTag(ctx, testGroup, "history")
+	if err != nil || len(items) != 2 {
+		t.Fatalf("GetItemsByTag: %v, %v", items, err)
+	}
+	usage, err := st.GetTagUsage(ctx, testGroup)
+	if err != nil {
+		t.Fatalf("GetTagUsage: %v", err)
+	}
+	var counts []string
+	for _, tag := range usage {
+		counts = append(counts, fmt.Sprintf("%s/%d:%d", tag.Tag, tag.Meta.Type, tag.Meta.NumItems))
+	}
+	if strings.Join(counts, " ") != "History/0:1 auto/0:1 auto/1:1 history/0:2" {
+		t.Errorf("unexpected tag usage %v", counts)
+	}
+
+	// updates keep the relation current
+	first.Data.Tags = []model.ItemTag{{Tag: "auto", Type: 1}}
+	if err := st.UpdateItem(ctx, testGroup, first); err != nil {
+		t.Fatalf("UpdateItem: %v", err)
+	}
+	if items, _ := st.GetItemsByTag(ctx, testGroup, "history"); len(items) != 1 || items[0].Key != second.Key {
+		t.Errorf("expected only %s with history, got %v", second.Key, items)
+	}
+
+	num, err := st.MergeTags(ctx, testGroup, []string{"History", "history"}, "Geschichte")
+	if err != nil || num != 1 {
+		t.Fatalf("MergeTags: %d, %v", num, err)
+	}
+	merged, err := st.GetItemByKey(ctx, testGroup, second.Key)
+	if err != nil || len(merged.Data.Tags) != 1 || merged.Data.Tags[0].Tag != "Geschichte" || merged.Status != model.SyncStatus_New {
+		t.Errorf("unexpected merged item %+v, %v", merged, err)
+	}
+	if items, _ := st.GetItemsByTag(ctx, testGroup, "Geschichte"); len(items) != 1 {
+		t.Errorf("expected 1 item with merged tag, got %d", len(items))
+	}
+
+	// renamed items become modified unless they are new
+	if _, err := st.ModifyItem(ctx, testGroup, first.Key, func(item *model.Item) error {
+		item.Status = model.SyncStatus_Synced
+		return nil
+	}); err != nil {
+		t.Fatalf("ModifyItem: %v", err)
+	}
+	if num, err := st.RenameTag(ctx, testGroup, "auto", "automatic"); err != nil || num != 2 {
+		t.Fatalf("RenameTag: %d, %v", num, err)
+	}
+	renamed, _ := st.GetItemByKey(ctx, testGroup, first.Key)
+	if renamed.Status != model.SyncStatus_Modified || renamed.Data.Tags[0].Tag != "automatic" || renamed.Data.Tags[0].Type != 1 {
+		t.Errorf("unexpected renamed item %+v", renamed)
+	}
+	if num, err := st.RenameTag(ctx, testGroup, "missing", "other"); err != nil || num != 0 {
+		t.Errorf("RenameTag of missing tag: %d, %v", num, err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+	st := newStorage(t, false)
+	item, err := st.CreateItem(ctx, testGroup, newItem("Purged"), nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	if err := st.SetItemFulltext(ctx, testGroup, item.Key, "text"); err != nil {
+		t.Fatalf("SetItemFulltext: %v", err)
+	}
+	kept, err := st.CreateItem(ctx, testGroup, newItem("Kept"), nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	coll, err := st.CreateCollection(ctx, testGroup, &model.CollectionData{Name: "Purged"})
+	if err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	if _, err := st.DeleteItems(ctx, testGroup, []string{item.Key, kept.Key}); err != nil {
+		t.Fatalf("DeleteItems: %v", err)
+	}
+	if err := st.DeleteCollection(ctx, testGroup, coll.Key); err != nil {
+		t.Fatalf("DeleteCollection: %v", err)
+	}
+	if _, err := st.ModifyItem(ctx, testGroup, item.Key, func(item *model.Item) error {
+		item.Status = model.SyncStatus_Synced
+		return nil
+	}); err != nil {
+		t.Fatalf("ModifyItem: %v", err)
+	}
+	coll.Status = model.SyncStatus_Synced
+	coll.Deleted = true
+	if err := st.UpdateCollection(ctx, testGroup, coll); err != nil {
+		t.Fatalf("UpdateCollection: %v", err)
+	}
+
+	if num, err := st.PurgeItems(ctx, testGroup, time.Now().Add(-time.Hour)); err != nil || num != 0 {
+		t.Errorf("expected no purge of recent deletions, got %d (%v)", num, err)
+	}
+	before := time.Now().Add(time.Second)
+	if num, err := st.PurgeItems(ctx, testGroup, before); err != nil || num != 1 {
+		t.Errorf("expected 1 purged item, got %d (%v)", num, err)
+	}
+	if num, err := st.PurgeCollections(ctx, testGroup, before); err != nil || num != 1 {
+		t.Errorf("expected 1 purged collection, got %d (%v)", num, err)
+	}
+	if found, _ := st.GetItemByKey(ctx, testGroup, item.Key); found != nil {
+		t.Errorf("purged item still exists")
+	}
+	if found, _ := st.GetItemByKey(ctx, testGroup, kept.Key); found == nil {
+		t.Errorf("deletion that is not synced was purged")
+	}
+}
+
+func TestObjectStates(t *testing.T) {
+	ctx := context.Background()
+	st := newStorage(t, false)
+	synced, err := st.CreateItem(ctx, testGroup, newItem("Synced"), nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	synced.Version = 7
+	synced.Status = model.SyncStatus_Synced
+	if err := st.UpdateItem(ctx, testGroup, synced); err != nil {
+		t.Fatalf("UpdateItem: %v", err)
+	}
+	modified, err := st.CreateItem(ctx, testGroup, newItem("Modified"), nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	if err := st.CreateEmptyItem(ctx, testGroup, "EMPTY001", ""); err != nil {
+		t.Fatalf("CreateEmptyItem: %v", err)
+	}
+	coll, err := st.CreateCollection(ctx, testGroup, &model.CollectionData{Name: "Synced"})
+	if err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	coll.Version = 3
+	coll.Status = model.SyncStatus_Synced
+	if err := st.UpdateCollection(ctx, testGroup, coll); err != nil {
+		t.Fatalf("UpdateCollection: %v", err)
+	}
+
+	states, err := st.GetItemStates(ctx, testGroup)
+	if err != nil || len(states) != 3 {
+		t.Fatalf("GetItemStates: %v, %v", states, err)
+	}
+	byKey := map[string]model.ObjectState{}
+	for _, state := range states {
+		byKey[state.Key] = state
+	}
+	if state := byKey[synced.Key]; state.Version != 7 || state.Status != model.SyncStatus_Synced {
+		t.Errorf("unexpected state %+v", state)
+	}
+	if state := byKey["EMPTY001"]; state.Version != 0 || state.Status != model.SyncStatus_Incomplete {
+		t.Errorf("unexpected state of empty item %+v", state)
+	}
+
+	num, err := st.ResetItems(ctx, testGroup, []string{synced.Key, modified.Key, "EMPTY001", "MISSING1"})
+	if err != nil || num != 2 {
+		t.Fatalf("expected 2 reset items, got %d (%v)", num, err)
+	}
+	if version, sync, _ := st.GetItemVersion(ctx, testGroup, synced.Key, ""); version != 0 || sync != model.SyncStatus_Incomplete {
+		t.Errorf("item not reset: %d %v", version, sync)
+	}
+	if _, sync, _ := st.GetItemVersion(ctx, testGroup, modified.Key, ""); sync != model.SyncStatus_New {
+		t.Errorf("item with local changes was reset: %v", sync)
+	}
+
+	if num, err := st.ResetCollections(ctx, testGroup, []string{coll.Key}); err != nil || num != 1 {
+		t.Fatalf("expected 1 reset collection, got %d (%v)", num, err)
+	}
+	colls, err := st.GetCollectionStates(ctx, testGroup)
+	if err != nil || len(colls) != 1 || colls[0].Version != 0 || colls[0].Status != model.SyncStatus_Incomplete {
+		t.Errorf("unexpected collection states %+v (%v)", colls, err)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	st := newStorage(t, false)
+	st.PollInterval = 5 * time.Millisecond
+
+	notified := make(chan int64, 10)
+	done := make(chan error)
+	go func() {
+		done <- st.ListenChanges(ctx, func(library int64, seq int64) { notified <- seq })
+	}()
+	// wait until the listener is registered
+	for {
+		if _, err := st.CreateItem(ctx, testGroup, newItem("probe"), nil, ""); err != nil {
+			t.Fatalf("CreateItem: %v", err)
+		}
+		select {
+		case <-notified:
+		case <-time.After(50 * time.Millisecond):
+			continue
+		}
+		break
+	}
+	before, err := st.LatestChangeSeq(ctx, testGroup)
+	if err != nil {
+		t.Fatalf("LatestChangeSeq: %v", err)
+	}
+	item, err := st.CreateItem(ctx, testGroup, newItem("watched"), nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	// meta only changes are no changes of the item
+	if _, err := st.ModifyItem(ctx, testGroup, item.Key, func(item *model.Item) error {
+		item.Meta.CreatorSummary = "Someone"
+		return nil
+	}); err != nil {
+		t.Fatalf("ModifyItem: %v", err)
+	}
+	if err := st.DeleteItem(ctx, testGroup, item.Key); err != nil {
+		t.Fatalf("DeleteItem: %v", err)
+	}
+	changes, err := st.GetChanges(ctx, testGroup, before, 100)
+	if err != nil {
+		t.Fatalf("GetChanges: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Type != model.ChangeType_Create || changes[1].Type != model.ChangeType_Delete || changes[1].Key != item.Key {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+	for _, change := range changes {
+		select {
+		case seq := <-notified:
+			if seq != change.Seq {
+				t.Errorf("expected notification %d, got %d", change.Seq, seq)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no notification for %d", change.Seq)
+		}
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSyncRuns(t *testing.T) {
+	ctx := context.Background()
+	st := newStorage(t, false)
+	run := &model.SyncRun{GroupId: testGroup, Trigger: "api"}
+	if err := st.CreateSyncRun(ctx, run, time.Hour); err != nil {
+		t.Fatalf("CreateSyncRun: %v", err)
+	}
+	if run.Id == 0 || run.Status != model.SyncRunStatus_Queued {
+		t.Errorf("unexpected run %+v", run)
+	}
+	if err := st.CreateSyncRun(ctx, &model.SyncRun{GroupId: testGroup}, time.Hour); !errors.Is(err, storage.ErrSyncRunActive) {
+		t.Errorf("expected ErrSyncRunActive, got %v", err)
+	}
+	// with staleAfter shorter than the age of the run it is abandoned
+	time.Sleep(2 * time.Millisecond)
+	if err := st.CreateSyncRun(ctx, &model.SyncRun{GroupId: testGroup}, time.Millisecond); err != nil {
+		t.Fatalf("CreateSyncRun: %v", err)
+	}
+	old, err := st.GetSyncRun(ctx, run.Id)
+	if err != nil || old.Status != model.SyncRunStatus_Failed || old.Error != "abandoned" {
+		t.Errorf("expected abandoned run, got %+v, %v", old, err)
+	}
+	runs, err := st.GetSyncRuns(ctx, testGroup, 10)
+	if err != nil || len(runs) != 2 || runs[0].Id <= runs[1].Id {
+		t.Errorf("GetSyncRuns: %v, %v", runs, err)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+	st := newStorage(t, false)
+	hook := &model.Webhook{GroupId: testGroup, Url: "http://localhost/hook", Secret: "s3cret", Events: []model.WebhookEvent{model.WebhookEvent_Created}, Active: true}
+	if err := st.CreateWebhook(ctx, hook); err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	// the item is created with its event, the deletion is not subscribed
+	item, err := st.CreateItem(ctx, testGroup, newItem("Hooked"), nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	if err := st.DeleteItem(ctx, testGroup, item.Key); err != nil {
+		t.Fatalf("DeleteItem: %v", err)
+	}
+	claimed, err := st.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("ClaimWebhookDeliveries: %v, %v", claimed, err)
+	}
+	var payload model.WebhookPayload
+	if err := json.Unmarshal(claimed[0].Payload, &payload); err != nil {
+		t.Fatalf("cannot decode payload: %v", err)
+	}
+	if claimed[0].Url != hook.Url || claimed[0].Secret != hook.Secret || payload.Event != model.WebhookEvent_Created || payload.Key != item.Key || payload.Source != model.WebhookSource_Local || payload.Item == nil || payload.Item.Data.Title != "Hooked" {
+		t.Errorf("unexpected delivery %+v: %s", claimed[0], claimed[0].Payload)
+	}
+	// claimed deliveries are leased
+	if again, _ := st.ClaimWebhookDeliveries(ctx, 10, time.Minute); len(again) != 0 {
+		t.Errorf("expected leased delivery, got %v", again)
+	}
+	now := time.Now()
+	claimed[0].Status = model.WebhookDeliveryStatus_Delivered
+	claimed[0].Attempts = 1
+	claimed[0].Delivered = &now
+	if err := st.UpdateWebhookDelivery(ctx, claimed[0]); err != nil {
+		t.Fatalf("UpdateWebhookDelivery: %v", err)
+	}
+	deliveries, err := st.GetWebhookDeliveries(ctx, hook.Id, 10)
+	if err != nil || len(deliveries) != 1 || deliveries[0].Status != model.WebhookDeliveryStatus_Delivered || deliveries[0].Payload != nil {
+		t.Errorf("GetWebhookDeliveries: %v, %v", deliveries, err)
+	}
+}
+
+func TestWebhookEvents(t *testing.T) {
+	ctx := context.Background()
+	st := newStorage(t, false)
+	if err := st.CreateWebhook(ctx, &model.Webhook{GroupId: testGroup, Url: "http://localhost/hook", Secret: "s3cret", Events: model.WebhookEvents, Active: true}); err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	expect := func(step string, want ...string) {
+		t.Helper()
+		claimed, err := st.ClaimWebhookDeliveries(ctx, 100, time.Minute)
+		if err != nil {
+			t.Fatalf("%s: ClaimWebhookDeliveries: %v", step, err)
+		}
+		got := []string{}
+		for _, delivery := range claimed {
+			var payload model.WebhookPayload
+			if err := json.Unmarshal(delivery.Payload, &payload); err != nil {
+				t.Fatalf("%s: cannot decode payload: %v", step, err)
+			}
+			got = append(got, fmt.Sprintf("%s %s %s", payload.Event, payload.ObjectType, payload.Source))
+		}
+		if strings.Join(got, ", ") != strings.Join(want, ", ") {
+			t.Errorf("%s: expected events %v, got %v", step, want, got)
+		}
+	}
+
+	item, err := st.CreateItem(ctx, testGroup, newItem("Hooked"), nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	expect("create", "created item local")
+	steps := []struct {
+		name   string
+		change func(item *model.Item)
+		want   []string
+	}{
+		{"upload", func(item *model.Item) { item.Version, item.Data.Version, item.Status = 5, 5, model.SyncStatus_Synced }, nil},
+		{"download", func(item *model.Item) { item.Version, item.Data.Title = 6, "Downloaded" }, []string{"updated item sync"}},
+		{"file", func(item *model.Item) {
+			item.MD5, item.Status = "0123456789abcdef0123456789abcdef", model.SyncStatus_Modified
+		}, []string{"attachment item local"}},
+		{"trash", func(item *model.Item) { item.Trashed = true }, []string{"updated item local"}},
+		{"delete", func(item *model.Item) { item.Deleted = true }, []string{"deleted item local"}},
+		{"deleted change", func(item *model.Item) { item.Data.Title = "Gone" }, nil},
+	}
+	for _, step := range steps {
+		step.change(item)
+		if err := st.UpdateItem(ctx, testGroup, item); err != nil {
+			t.Fatalf("%s: UpdateItem: %v", step.name, err)
+		}
+		expect(step.name, step.want...)
+	}
+
+	coll, err := st.CreateCollection(ctx, testGroup, &model.CollectionData{Name: "Hooked"})
+	if err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	if err := st.DeleteCollection(ctx, testGroup, coll.Key); err != nil {
+		t.Fatalf("DeleteCollection: %v", err)
+	}
+	expect("collection", "created collection local", "deleted collection local")
+}
+
+func TestGroupsAndApiKeys(t *testing.T) {
+	ctx := context.Background()
+	st := newStorage(t, true)
+	group, err := st.GetGroup(ctx, testGroup)
+	if err != nil || !group.Active || group.Direction != model.SyncDirection_ToLocal {
+		t.Fatalf("GetGroup: %+v, %v", group, err)
+	}
+	group.Active = false
+	if err := st.UpdateSyncGroup(ctx, group); err != nil {
+		t.Fatalf("UpdateSyncGroup: %v", err)
+	}
+	if groups, _ := st.GetGroups(ctx); len(groups) != 0 {
+		t.Errorf("expected no active groups, got %v", groups)
+	}
+	if err := st.UpdateSyncGroup(ctx, &model.Group{Id: 1, Direction: model.SyncDirection_ToLocal}); err == nil {
+		t.Errorf("expected error for unknown group")
+	}
+
+	if _, err := st.GetDB().ExecContext(ctx, `INSERT INTO apikeys (tokenhash, name, userid, username, access) VALUES (?, 'test', 1, 'user', '{}')`, storage.HashApiToken("token")); err != nil {
+		t.Fatalf("cannot insert api key: %v", err)
+	}
+	key, err := st.GetApiKey(ctx, "token")
+	if err != nil || key == nil || key.Username != "user" {
+		t.Errorf("GetApiKey: %v, %v", key, err)
+	}
+	if key, _ := st.GetApiKey(ctx, "other"); key != nil {
+		t.Errorf("expected no key, got %v", key)
+	}
+}
+
+func TestGitlabTimestamps(t *testing.T) {
+	ctx := context.Background()
+	st := newStorage(t, false)
+	item, err := st.CreateItem(ctx, testGroup, newItem("Backup"), nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	first := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := st.UpdateItemsGitlabTimestamp(ctx, testGroup, first, nil); err != nil {
+		t.Fatalf("UpdateItemsGitlabTimestamp: %v", err)
+	}
+	got, _ := st.GetItemByKey(ctx, testGroup, item.Key)
+	if got.Gitlab == nil || !got.Gitlab.Equal(first) {
+		t.Fatalf("expected gitlab %v, got %v", first, got.Gitlab)
+	}
+	// older timestamps and timestamps before the filter are kept
+	if err := st.UpdateItemsGitlabTimestamp(ctx, testGroup, first.Add(-time.Hour), nil); err != nil {
+		t.Fatalf("UpdateItemsGitlabTimestamp: %v", err)
+	}
+	filter := first.Add(time.Minute)
+	if err := st.UpdateItemsGitlabTimestamp(ctx, testGroup, first.Add(time.Hour), &filter); err != nil {
+		t.Fatalf("UpdateItemsGitlabTimestamp: %v", err)
+	}
+	if got, _ := st.GetItemByKey(ctx, testGroup, item.Key); !got.Gitlab.Equal(first) {
+		t.Errorf("expected unchanged gitlab %v, got %v", first, got.Gitlab)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "zotero.db")
+	st, err := sqlite.Open(ctx, dsn, false, nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	item, err := st.CreateItem(ctx, testGroup, newItem("Persistent"), nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	st.Close()
+
+	st, err = sqlite.Open(ctx, dsn, false, nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer st.Close()
+	if got, err := st.GetItemByKey(ctx, testGroup, item.Key); err != nil || got == nil || got.Data.Title != "Persistent" {
+		t.Errorf("GetItemByKey: %v, %v", got, err)
+	}
+	migrations, err := sqlite.Migrations()
+	if err != nil {
+		t.Fatalf("Migrations: %v", err)
+	}
+	if version, err := st.SchemaVersion(ctx); err != nil || version != migrations[len(migrations)-1].Version {
+		t.Errorf("SchemaVersion: %v, %v", version, err)
+	}
+}
+
+func TestMigrateDown(t *testing.T) {
+	ctx := context.Background()
+	st := newStorage(t, false)
+	migrations, err := sqlite.Migrations()
+	if err != nil {
+		t.Fatalf("Migrations: %v", err)
+	}
+	item, err := st.CreateItem(ctx, testGroup, newItem("Kept"), nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+
+	// reverting past the base fails and leaves every migration applied
+	if _, err := st.MigrateDown(ctx, len(migrations)); err == nil || !strings.Contains(err.Error(), "base schema cannot be reverted") {
+		t.Fatalf("expected MigrateDown past the base to fail, got %v", err)
+	}
+	latest := migrations[len(migrations)-1].Version
+	if version, err := st.SchemaVersion(ctx); err != nil || version != latest {
+		t.Errorf("SchemaVersion: %v, %v", version, err)
+	}
+	if got, err := st.GetItemByKey(ctx, testGroup, item.Key); err != nil || got == nil {
+		t.Errorf("GetItemByKey: %v, %v", got, err)
+	}
+
+	// the migrations on top of the base can be reverted and applied again
+	reverted, err := st.MigrateDown(ctx, len(migrations)-1)
+	if err != nil || len(reverted) != len(migrations)-1 || reverted[0].Version != latest {
+		t.Fatalf("MigrateDown: %v, %v", reverted, err)
+	}
+	if version, err := st.SchemaVersion(ctx); err != nil || version != migrations[0].Version {
+		t.Errorf("SchemaVersion: %v, %v", version, err)
+	}
+	if applied, err := st.MigrateUp(ctx); err != nil || len(applied) != len(migrations)-1 {
+		t.Errorf("MigrateUp: %v, %v", applied, err)
+	}
+}
@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+func syncRunFromRow(row rowScanner) (*model.SyncRun, error) {
+	run := &model.SyncRun{}
+	var status string
+	var requestedBy, stage, errstr sql.NullString
+	var requested, started, finished nullTime
+	if err := row.Scan(&run.Id, &run.GroupId, &status, &run.Trigger, &requestedBy, &requested, &started, &finished, &stage,
+		&run.Collections, &run.Uploaded, &run.Downloaded, &run.Tags, &run.Deleted, &errstr); err != nil {
+		if storage.IsEmptyResult(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "cannot scan sync run")
+	}
+	run.Status = model.SyncRunStatus(status)
+	run.RequestedBy = requestedBy.String
+	run.Stage = stage.String
+	run.Error = errstr.String
+	run.Requested = requested.Time
+	run.Started = started.ptr()
+	run.Finished = finished.ptr()
+	return run, nil
+}
+
+// CreateSyncRun stores run as queued and sets its id and request time. Active
+// runs of the group requested or started before staleAfter are marked as
+// abandoned first; any other active run results in storage.ErrSyncRunActive.
+func (s *Storage) CreateSyncRun(ctx context.Context, run *model.SyncRun, staleAfter time.Duration) error {
+	if staleAfter > 0 {
+		params := namedArgs{
+			"groupid": run.GroupId,
+			"before":  formatTime(time.Now().Add(-staleAfter)),
+		}
+		result, err := s.db.ExecContext(ctx, SQLAbandonSyncRuns, params.args()...)
+		if err != nil {
+			return errors.Wrapf(err, "cannot execute %s", SQLAbandonSyncRuns)
+		}
+		if num, err := result.RowsAffected(); err == nil && num > 0 && s.Logger != nil {
+			s.Logger.Warn().Msgf("abandoned %d stale sync runs of group %v", num, run.GroupId)
+		}
+	}
+	run.Status = model.SyncRunStatus_Queued
+	params := namedArgs{
+		"groupid":     run.GroupId,
+		"status":      string(run.Status),
+		"trigger":     run.Trigger,
+		"requestedby": nullString(run.RequestedBy),
+	}
+	var requested nullTime
+	if err := s.db.QueryRowContext(ctx, SQLInsertSyncRun, params.args()...).Scan(&run.Id, &requested); err != nil {
+		if IsUniqueViolation(err, "sync_runs.groupid") {
+			return errors.WithStack(storage.ErrSyncRunActive)
+		}
+		return errors.Wrapf(err, "cannot execute %s", SQLInsertSyncRun)
+	}
+	run.Requested = requested.Time
+	return nil
+}
+
+// UpdateSyncRun stores status, stage, timestamps, counters and error of run.
+func (s *Storage) UpdateSyncRun(ctx context.Context, run *model.SyncRun) error {
+	params := namedArgs{
+		"id":          run.Id,
+		"status":      string(run.Status),
+		"started":     formatTimePtr(run.Started),
+		"finished":    formatTimePtr(run.Finished),
+		"stage":       nullString(run.Stage),
+		"collections": run.Collections,
+		"uploaded":    run.Uploaded,
+		"downloaded":  run.Downloaded,
+		"tags":        run.Tags,
+		"deleted":     run.Deleted,
+		"error":       nullString(run.Error),
+	}
+	if _, err := s.db.ExecContext(ctx, SQLUpdateSyncRun, params.args()...); err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLUpdateSyncRun)
+	}
+	return nil
+}
+
+// GetSyncRun returns the sync run with the given id or nil.
+func (s *Storage) GetSyncRun(ctx context.Context, id int64) (*model.SyncRun, error) {
+	params := namedArgs{"id": id}
+	run, err := syncRunFromRow(s.db.QueryRowContext(ctx, SQLGetSyncRun, params.args()...))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get sync run %v", id)
+	}
+	return run, nil
+}
+
+// GetSyncRuns returns the latest limit sync runs of the group, newest first.
+func (s *Storage) GetSyncRuns(ctx context.Context, groupId int64, limit int64) ([]*model.SyncRun, error) {
+	params := namedArgs{
+		"groupid": groupId,
+		"limit":   limit,
+	}
+	rows, err := s.db.QueryContext(ctx, SQLGetSyncRuns, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetSyncRuns)
+	}
+	defer rows.Close()
+	runs := []*model.SyncRun{}
+	for rows.Next() {
+		run, err := syncRunFromRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate sync runs")
+	}
+	return runs, nil
+}
@@ -0,0 +1,152 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json/v2"
+	"slices"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// CreateTag stores tag unless the group has it already.
+func (s *Storage) CreateTag(ctx context.Context, groupId int64, tag model.Tag) error {
+	if s.Logger != nil {
+		s.Logger.Debug().Msgf("Creating Tag %s", tag.Tag)
+	}
+	metastr, err := json.Marshal(tag.Meta)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal meta %v", tag.Meta)
+	}
+	params := namedArgs{
+		"tag":     tag.Tag,
+		"meta":    string(metastr),
+		"library": groupId,
+	}
+	if _, err := s.db.ExecContext(ctx, SQLInsertTag, params.args()...); err != nil {
+		return errors.Wrapf(err, "cannot execute %s: %v", SQLInsertTag, params)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteTag(ctx context.Context, groupId int64, tag string) error {
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("deleting Tag %s", tag)
+	}
+	params := namedArgs{
+		"tag":     tag,
+		"library": groupId,
+	}
+	if _, err := s.db.ExecContext(ctx, SQLDeleteTag, params.args()...); err != nil {
+		return errors.Wrapf(err, "error executing %s: %v", SQLDeleteTag, params)
+	}
+	return nil
+}
+
+// DeleteTags removes all given tags in a single statement.
+// It returns the number of affected rows.
+func (s *Storage) DeleteTags(ctx context.Context, groupId int64, tags []string) (int64, error) {
+	if len(tags) == 0 {
+		return 0, nil
+	}
+	tagArray, err := jsonArray(tags)
+	if err != nil {
+		return 0, err
+	}
+	params := namedArgs{
+		"tags":    tagArray,
+		"library": groupId,
+	}
+	result, err := s.db.ExecContext(ctx, SQLDeleteTags, params.args()...)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error executing %s: %v", SQLDeleteTags, params)
+	}
+	return result.RowsAffected()
+}
+
+// GetTagUsage returns the tags of the items of the group with their number
+// of items, once per tag type. Trashed and deleted items are not counted.
+func (s *Storage) GetTagUsage(ctx context.Context, groupId int64) ([]*model.Tag, error) {
+	params := namedArgs{"library": groupId}
+	rows, err := s.db.QueryContext(ctx, SQLGetTagUsage, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetTagUsage, params)
+	}
+	defer rows.Close()
+	tags := []*model.Tag{}
+	for rows.Next() {
+		tag := &model.Tag{Meta: &model.TagMeta{}}
+		if err := rows.Scan(&tag.Tag, &tag.Meta.Type, &tag.Meta.NumItems); err != nil {
+			return nil, errors.Wrap(err, "cannot scan tag usage")
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate tag usage")
+	}
+	return tags, nil
+}
+
+// GetItemsByTag returns the items carrying tag ordered by key; trashed and
+// deleted items are skipped.
+func (s *Storage) GetItemsByTag(ctx context.Context, groupId int64, tag string) ([]*model.Item, error) {
+	params := namedArgs{"library": groupId, "tag": tag}
+	rows, err := s.db.QueryContext(ctx, SQLGetItemsByTag, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetItemsByTag, params)
+	}
+	return s.items(groupId, rows)
+}
+
+func (s *Storage) RenameTag(ctx context.Context, groupId int64, tag string, newName string) (int64, error) {
+	return s.MergeTags(ctx, groupId, []string{tag}, newName)
+}
+
+// MergeTags replaces tags by target in all items and in the tags of the
+// group like storage.Storage.MergeTags.
+func (s *Storage) MergeTags(ctx context.Context, groupId int64, tags []string, target string) (int64, error) {
+	if target == "" {
+		return 0, errors.New("empty target tag")
+	}
+	tags = slices.DeleteFunc(slices.Clone(tags), func(tag string) bool { return tag == target })
+	if len(tags) == 0 {
+		return 0, nil
+	}
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("merging tags %v into %s", tags, target)
+	}
+	tagArray, err := jsonArray(tags)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+	params := namedArgs{
+		"library":      groupId,
+		"tags":         tagArray,
+		"target":       target,
+		"syncNew":      model.SyncStatusString[model.SyncStatus_New],
+		"syncModified": model.SyncStatusString[model.SyncStatus_Modified],
+	}
+	result, err := tx.ExecContext(ctx, SQLMergeTagsInItems, params.args()...)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot execute %s: %v", SQLMergeTagsInItems, params)
+	}
+	num, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot get number of merged items")
+	}
+	if _, err := tx.ExecContext(ctx, SQLMergeTagRows, params.args()...); err != nil {
+		return 0, errors.Wrapf(err, "cannot execute %s: %v", SQLMergeTagRows, params)
+	}
+	if _, err := tx.ExecContext(ctx, SQLDeleteTags, params.args()...); err != nil {
+		return 0, errors.Wrapf(err, "cannot execute %s: %v", SQLDeleteTags, params)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "cannot commit transaction")
+	}
+	return num, nil
+}
@@ -0,0 +1,244 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json/v2"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+func webhookFromRow(row rowScanner) (*model.Webhook, error) {
+	hook := &model.Webhook{}
+	var events string
+	var created nullTime
+	if err := row.Scan(&hook.Id, &hook.GroupId, &hook.Url, &hook.Secret, &events, &hook.Active, &created); err != nil {
+		if storage.IsEmptyResult(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "cannot scan webhook")
+	}
+	hook.Created = created.Time
+	hook.Events = []model.WebhookEvent{}
+	if err := json.Unmarshal([]byte(events), &hook.Events); err != nil {
+		return nil, errors.Wrapf(err, "cannot unmarshal events %s", events)
+	}
+	return hook, nil
+}
+
+// webhookEvents returns the events of hook as JSON array
+func webhookEvents(hook *model.Webhook) (string, error) {
+	events := hook.Events
+	if events == nil {
+		events = []model.WebhookEvent{}
+	}
+	data, err := json.Marshal(events)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot marshal events %v", events)
+	}
+	return string(data), nil
+}
+
+// CreateWebhook stores hook and sets its id and creation time.
+func (s *Storage) CreateWebhook(ctx context.Context, hook *model.Webhook) error {
+	events, err := webhookEvents(hook)
+	if err != nil {
+		return err
+	}
+	params := namedArgs{
+		"groupid": hook.GroupId,
+		"url":     hook.Url,
+		"secret":  hook.Secret,
+		"events":  events,
+		"active":  hook.Active,
+	}
+	var created nullTime
+	if err := s.db.QueryRowContext(ctx, SQLInsertWebhook, params.args()...).Scan(&hook.Id, &created); err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLInsertWebhook)
+	}
+	hook.Created = created.Time
+	return nil
+}
+
+// UpdateWebhook stores url, events and active state of hook. The secret
+// cannot be changed.
+func (s *Storage) UpdateWebhook(ctx context.Context, hook *model.Webhook) error {
+	events, err := webhookEvents(hook)
+	if err != nil {
+		return err
+	}
+	params := namedArgs{
+		"id":     hook.Id,
+		"url":    hook.Url,
+		"events": events,
+		"active": hook.Active,
+	}
+	result, err := s.db.ExecContext(ctx, SQLUpdateWebhook, params.args()...)
+	if err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLUpdateWebhook)
+	}
+	if num, err := result.RowsAffected(); err == nil && num == 0 {
+		return errors.Errorf("webhook %v not found", hook.Id)
+	}
+	return nil
+}
+
+// DeleteWebhook removes the webhook and its pending deliveries.
+func (s *Storage) DeleteWebhook(ctx context.Context, id int64) error {
+	params := namedArgs{"id": id}
+	if _, err := s.db.ExecContext(ctx, SQLDeleteWebhook, params.args()...); err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLDeleteWebhook)
+	}
+	return nil
+}
+
+// GetWebhook returns the webhook with the given id or nil.
+func (s *Storage) GetWebhook(ctx context.Context, id int64) (*model.Webhook, error) {
+	params := namedArgs{"id": id}
+	hook, err := webhookFromRow(s.db.QueryRowContext(ctx, SQLGetWebhook, params.args()...))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get webhook %v", id)
+	}
+	return hook, nil
+}
+
+// GetWebhooks returns all webhooks of the group.
+func (s *Storage) GetWebhooks(ctx context.Context, groupId int64) ([]*model.Webhook, error) {
+	params := namedArgs{"groupid": groupId}
+	rows, err := s.db.QueryContext(ctx, SQLGetWebhooks, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetWebhooks)
+	}
+	defer rows.Close()
+	hooks := []*model.Webhook{}
+	for rows.Next() {
+		hook, err := webhookFromRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate webhooks")
+	}
+	return hooks, nil
+}
+
+func webhookDeliveryFromRow(row rowScanner, withTarget bool) (*model.WebhookDelivery, error) {
+	delivery := &model.WebhookDelivery{}
+	var event, status string
+	var responseStatus sql.NullInt64
+	var lastError sql.NullString
+	var nextAttempt, created, delivered nullTime
+	dest := []any{&delivery.Id, &delivery.WebhookId, &event, &status, &delivery.Attempts, &nextAttempt,
+		&responseStatus, &lastError, &created, &delivered}
+	if withTarget {
+		dest = append(dest, &delivery.Payload, &delivery.Url, &delivery.Secret)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, errors.Wrap(err, "cannot scan webhook delivery")
+	}
+	delivery.Event = model.WebhookEvent(event)
+	delivery.Status = model.WebhookDeliveryStatus(status)
+	delivery.NextAttempt = nextAttempt.Time
+	delivery.ResponseStatus = responseStatus.Int64
+	delivery.LastError = lastError.String
+	delivery.Created = created.Time
+	delivery.Delivered = delivered.ptr()
+	return delivery, nil
+}
+
+// ClaimWebhookDeliveries returns at most limit pending deliveries, which are
+// due, with payload and target. They are not due again for lease, so other
+// processes do not deliver them in the meantime.
+func (s *Storage) ClaimWebhookDeliveries(ctx context.Context, limit int64, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback()
+	params := namedArgs{"limit": limit}
+	rows, err := tx.QueryContext(ctx, SQLGetDueWebhookDelivery, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetDueWebhookDelivery)
+	}
+	defer rows.Close()
+	deliveries := []*model.WebhookDelivery{}
+	ids := []int64{}
+	for rows.Next() {
+		delivery, err := webhookDeliveryFromRow(rows, true)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+		ids = append(ids, delivery.Id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate webhook deliveries")
+	}
+	rows.Close()
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+	idArray, err := json.Marshal(ids)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot marshal %v", ids)
+	}
+	params = namedArgs{
+		"ids":   string(idArray),
+		"lease": formatTime(time.Now().Add(lease)),
+	}
+	if _, err := tx.ExecContext(ctx, SQLLeaseWebhookDeliveries, params.args()...); err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLLeaseWebhookDeliveries)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "cannot commit transaction")
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery stores the result of a delivery attempt.
+func (s *Storage) UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	params := namedArgs{
+		"id":             delivery.Id,
+		"status":         string(delivery.Status),
+		"attempts":       delivery.Attempts,
+		"nextattempt":    formatTime(delivery.NextAttempt),
+		"responsestatus": sql.NullInt64{Int64: delivery.ResponseStatus, Valid: delivery.ResponseStatus != 0},
+		"lasterror":      nullString(delivery.LastError),
+		"delivered":      formatTimePtr(delivery.Delivered),
+	}
+	if _, err := s.db.ExecContext(ctx, SQLUpdateWebhookDelivery, params.args()...); err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLUpdateWebhookDelivery)
+	}
+	return nil
+}
+
+// GetWebhookDeliveries returns the latest limit deliveries of the webhook,
+// newest first and without payload.
+func (s *Storage) GetWebhookDeliveries(ctx context.Context, webhookId int64, limit int64) ([]*model.WebhookDelivery, error) {
+	params := namedArgs{
+		"webhookid": webhookId,
+		"limit":     limit,
+	}
+	rows, err := s.db.QueryContext(ctx, SQLGetWebhookDeliveries, params.args()...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetWebhookDeliveries)
+	}
+	defer rows.Close()
+	deliveries := []*model.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := webhookDeliveryFromRow(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate webhook deliveries")
+	}
+	return deliveries, nil
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 
@@ -28,6 +29,14 @@ func NewStorage(db *pgxpool.Pool, newGroupActive bool, logger zLogger.ZLogger) *
 	}
 }
 
+// dbConn is implemented by pgxpool.Pool and pgx.Tx, so helpers can run
+// inside or outside a transaction.
+type dbConn interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 func (s *Storage) GetDB() *pgxpool.Pool {
 	return s.db
 }
@@ -9,11 +9,23 @@ const (
 	SQLGetCollections                             = `SELECT key, version, data, meta, deleted, sync, gitlab FROM collections WHERE library = @library AND key = ANY(@keys)`
 	SQLGetCollectionVersions                      = `SELECT key, version FROM collections WHERE library = @library AND version > @sinceVersion`
 	SQLGetCollectionByKey                         = `SELECT cs.key, cs.version, cs.data, cs.meta, cs.deleted, cs.sync, cs.gitlab FROM collections cs WHERE cs.library = @library AND cs.key = @key`
-	SQLGetCollectionByName                        = `SELECT cs.key, cs.version, cs.data, cs.meta, cs.deleted, cs.sync, cs.gitlab FROM collections cs, collection_name_hier cnh WHERE cs.key = cnh.key AND cs.library = @library AND cnh.name = @name AND cnh.parent = @parent`
-	SQLGetCollectionByNameTop                     = `SELECT cs.key, cs.version, cs.data, cs.meta, cs.deleted, cs.sync, cs.gitlab FROM collections cs, collection_name_hier cnh WHERE cs.key = cnh.key AND cs.library = @library AND cnh.name = @name AND cnh.parent IS NULL`
+	SQLGetCollectionByName                        = `SELECT cs.key, cs.version, cs.data, cs.meta, cs.deleted, cs.sync, cs.gitlab FROM collections cs, collection_name_hier cnh WHERE cs.key = cnh.key AND cs.library = cnh.library AND cs.library = @library AND cs.deleted = false AND cnh.name = @name AND cnh.parent = @parent`
+	SQLGetCollectionByNameTop                     = `SELECT cs.key, cs.version, cs.data, cs.meta, cs.deleted, cs.sync, cs.gitlab FROM collections cs, collection_name_hier cnh WHERE cs.key = cnh.key AND cs.library = cnh.library AND cs.library = @library AND cs.deleted = false AND cnh.name = @name AND (cnh.parent IS NULL OR cnh.parent = 'false' OR cnh.parent = '')`
+	SQLGetCollectionKeyByNameHier                 = `SELECT cnh.key FROM collection_name_hier cnh, collections cs WHERE cs.key = cnh.key AND cs.library = cnh.library AND cnh.library = @library AND cs.deleted = false AND cnh.name = @name AND COALESCE(NULLIF(cnh.parent, 'false'), '') = @parent ORDER BY cnh.key LIMIT 1`
+	SQLGetCollectionKeyByName                     = `SELECT key FROM collections WHERE library = @library AND deleted = false AND data->>'name' = @name AND COALESCE(NULLIF(data->>'parentCollection', 'false'), '') = @parent ORDER BY key LIMIT 1`
+	SQLLockCollections                            = `SELECT pg_advisory_xact_lock(hashtextextended('collections:' || @library::text, 0))`
+	SQLGetCollectionTree                          = sqlCollectionSubtree + `SELECT key, version, data, meta, deleted, sync, gitlab FROM tree ORDER BY depth, data->>'name', key`
+	SQLGetCollectionTreeTop                       = sqlCollectionSubtreeTop + `SELECT key, version, data, meta, deleted, sync, gitlab FROM tree ORDER BY depth, data->>'name', key`
+	SQLGetCollectionPath                          = `WITH RECURSIVE anc AS (SELECT key, version, data, meta, deleted, sync, gitlab, 0 AS depth, ARRAY[key::text] AS path FROM collections WHERE library = @library AND key = @key UNION ALL SELECT c.key, c.version, c.data, c.meta, c.deleted, c.sync, c.gitlab, a.depth + 1, a.path || c.key::text FROM collections c JOIN anc a ON c.key::text = a.data->>'parentCollection' WHERE c.library = @library AND NOT c.key::text = ANY(a.path)) SELECT key, version, data, meta, deleted, sync, gitlab FROM anc ORDER BY depth DESC`
+	SQLGetCollectionChildren                      = `SELECT key, version, data, meta, deleted, sync, gitlab FROM collections WHERE library = @library AND deleted = false AND data IS NOT NULL AND COALESCE(NULLIF(data->>'parentCollection', 'false'), '') = @parent ORDER BY data->>'name', key`
+	SQLGetCollectionSubtreeKeys                   = sqlCollectionSubtree + `SELECT key FROM tree`
+	SQLRemoveCollectionsFromItems                 = `UPDATE items SET data = jsonb_set(data, '{collections}', (SELECT COALESCE(jsonb_agg(c), '[]'::jsonb) FROM jsonb_array_elements(data->'collections') c WHERE NOT (c #>> '{}') = ANY(@keys))), sync = CASE WHEN sync = @syncNew THEN sync ELSE @syncModified END, modified = NOW() WHERE library = @library AND deleted = false AND data->'collections' ?| @keys`
 	SQLUpdateCollection                           = `UPDATE collections SET version = @version, sync = @sync, data = @data, meta = @meta, deleted = @deleted, modified = NOW() WHERE library = @library AND key = @key`
 	SQLDeleteCollection                           = `UPDATE collections SET deleted = true, sync = @sync, modified = NOW() WHERE library = @library AND key = @key`
 	SQLDeleteCollections                          = `UPDATE collections SET deleted = true, sync = @sync, modified = NOW() WHERE library = @library AND key = ANY(@keys)`
+	SQLPurgeCollections                           = `DELETE FROM collections WHERE library = @library AND deleted = true AND sync = @sync AND modified < TO_TIMESTAMP(@before, 'YYYY-MM-DD HH24:MI:SS')`
+	SQLGetCollectionStates                        = `SELECT key, version, sync, false, deleted FROM collections WHERE library = @library ORDER BY key`
+	SQLResetCollections                           = `UPDATE collections SET version = 0, sync = @syncIncomplete, modified = NOW() WHERE library = @library AND key = ANY(@keys) AND (sync = @syncSynced OR sync = @syncIncomplete)`
 	SQLIterateCollectionsCount                    = `SELECT COUNT(*) FROM collections WHERE library = @library AND deleted = false`
 	SQLIterateCollectionsAfterCount               = `SELECT COUNT(*) FROM collections WHERE library = @library AND deleted = false AND (modified > TO_TIMESTAMP(@after, 'YYYY-MM-DD HH24:MI:SS'))`
 	SQLIterateCollections                         = `SELECT key, version, data, meta, deleted, sync, gitlab FROM collections WHERE library = @library AND deleted = false`
@@ -32,7 +44,9 @@ const (
 	SQLInsertEmptyGroup            = `INSERT INTO groups (id, version, created, modified) VALUES (@id, 0, NOW(), NOW())`
 	SQLInsertEmptySyncGroup        = `INSERT INTO syncgroups (id, active, direction) VALUES (@id, @active, @direction)`
 	SQLGetSyncGroupActiveDirection = `SELECT active, direction FROM syncgroups WHERE id = @id`
-	SQLClearGroup                  = `UPDATE groups SET version = 0, modified = created, itemversion = 0, collectionversion = 0 WHERE id = @id`
+	SQLClearGroup                  = `UPDATE groups SET version = 0, modified = created, itemversion = 0, collectionversion = 0, tagversion = 0 WHERE id = @id`
+	SQLListGroups                  = `SELECT g.id, version, created, modified, data, COALESCE(deleted, false), active, direction, tags, itemversion, collectionversion, tagversion, gitlab FROM groups g, syncgroups sg WHERE g.id = sg.id ORDER BY g.id`
+	SQLUpdateSyncGroup             = `UPDATE syncgroups SET active = @active, direction = @direction, tags = @tags WHERE id = @id`
 	SQLUpdateGroup                 = `UPDATE groups SET version = @version, created = @created, modified = @modified, data = @data, deleted = @deleted, itemversion = @itemversion, collectionversion = @collectionversion, tagversion = @tagversion WHERE id = @id`
 	SQLUpdateGroupGitlabTimestamp  = `UPDATE groups SET gitlab = TO_TIMESTAMP(@gitlab, 'YYYY-MM-DD HH24:MI:SS') WHERE id = @id`
 
@@ -43,11 +57,15 @@ const (
 	SQLGetItemVersions                      = `SELECT key, version FROM items WHERE library = @library AND version > @sinceVersion AND trashed = @trashed`
 	SQLGetItems                             = `SELECT key, version, data, meta, trashed, deleted, sync, md5, gitlab FROM items WHERE library = @library AND key = ANY(@keys)`
 	SQLGetItemByKey                         = `SELECT key, version, data, meta, trashed, deleted, sync, md5, gitlab FROM items WHERE library = @library AND key = @key`
+	SQLGetItemByKeyForUpdate                = `SELECT key, version, data, meta, trashed, deleted, sync, md5, gitlab FROM items WHERE library = @library AND key = @key FOR UPDATE`
 	SQLGetItemByOldid                       = `SELECT key, version, data, meta, trashed, deleted, sync, md5, gitlab FROM items WHERE library = @library AND oldid = @oldid`
 	SQLUpdateItem                           = `UPDATE items SET version = @version, data = @data, meta = @meta, trashed = @trashed, deleted = @deleted, sync = @sync, md5 = @md5, modified = NOW() WHERE library = @library AND key = @key`
 	SQLUpdateItemVersion0                   = `UPDATE items SET data = @data, meta = @meta, trashed = @trashed, deleted = @deleted, sync = @sync, md5 = @md5, modified = NOW() WHERE library = @library AND key = @key`
 	SQLDeleteItem                           = `UPDATE items SET deleted = true, sync = @sync, modified = NOW() WHERE key = @key AND library = @library`
 	SQLDeleteItems                          = `UPDATE items SET deleted = true, sync = @sync, modified = NOW() WHERE library = @library AND key = ANY(@keys)`
+	SQLPurgeItems                           = `DELETE FROM items WHERE library = @library AND deleted = true AND sync = @sync AND modified < TO_TIMESTAMP(@before, 'YYYY-MM-DD HH24:MI:SS')`
+	SQLGetItemStates                        = `SELECT key, version, sync, trashed, deleted FROM items WHERE library = @library ORDER BY key`
+	SQLResetItems                           = `UPDATE items SET version = 0, sync = @syncIncomplete, modified = NOW() WHERE library = @library AND key = ANY(@keys) AND (sync = @syncSynced OR sync = @syncIncomplete)`
 	SQLGetChildren                          = `SELECT i.key, i.version, i.data, i.meta, i.trashed, i.deleted, i.sync, i.md5, i.gitlab FROM items i, item_type_hier ith WHERE i.trashed = false AND i.deleted = false AND i.key = ith.key AND i.library = ith.library AND i.library = @library AND ith.parent = @parent`
 	SQLIterateItemsCount                    = `SELECT COUNT(*) FROM items WHERE library = @library AND deleted = false`
 	SQLIterateItemsAfterCount               = `SELECT COUNT(*) FROM items WHERE library = @library AND deleted = false AND (modified > TO_TIMESTAMP(@after, 'YYYY-MM-DD HH24:MI:SS'))`
@@ -58,12 +76,72 @@ const (
 	SQLIterateItemsAll                      = `SELECT key, version, data, meta, trashed, deleted, sync, md5, gitlab FROM items WHERE library = @library`
 	SQLIterateItemsAllAfter                 = `SELECT key, version, data, meta, trashed, deleted, sync, md5, gitlab FROM items WHERE library = @library AND (modified > TO_TIMESTAMP(@after, 'YYYY-MM-DD HH24:MI:SS'))`
 	SQLGetModifiedItems                     = `SELECT key, version, data, meta, trashed, deleted, sync, md5, gitlab FROM items WHERE library = @library AND (sync = @syncNew OR sync = @syncModified)`
+	SQLGetItemsInCollection                 = `SELECT key, version, data, meta, trashed, deleted, sync, md5, gitlab FROM items WHERE library = @library AND deleted = false AND trashed = false AND data->'collections' ? @key::text ORDER BY key`
+	SQLGetItemsInCollectionRecursive        = sqlCollectionSubtree + `SELECT key, version, data, meta, trashed, deleted, sync, md5, gitlab FROM items WHERE library = @library AND deleted = false AND trashed = false AND data->'collections' ?| ARRAY(SELECT key::text FROM tree) ORDER BY key`
+	SQLQueryItems                           = `SELECT key, version, data, meta, trashed, deleted, sync, md5, gitlab FROM items WHERE library = @library AND deleted = false`
+	SQLQueryItemsCount                      = `SELECT COUNT(*) FROM items WHERE library = @library AND deleted = false`
 	SQLRefreshItemTypeHier                  = `SELECT refresh_item_type_hier()`
+	SQLSearchItems                          = `SELECT i.key, i.version, i.data, i.meta, i.trashed, i.deleted, i.sync, i.md5, i.gitlab, ts_rank_cd(s.document, q.query) AS rank, ts_headline(q.config, s.title, q.query, 'HighlightAll=true'), ts_headline(q.config, concat_ws(' ', NULLIF(s.body, ''), NULLIF(s.fulltext, '')), q.query, 'MaxFragments=2, MaxWords=20, MinWords=5') FROM items i JOIN item_search s ON s.key = i.key AND s.library = i.library CROSS JOIN (SELECT websearch_to_tsquery(@config::text::regconfig, @query) AS query, @config::text::regconfig AS config) q WHERE i.library = @library AND i.deleted = false AND s.document @@ q.query`
+	SQLSearchItemsCount                     = `SELECT COUNT(*) FROM items i JOIN item_search s ON s.key = i.key AND s.library = i.library WHERE i.library = @library AND i.deleted = false AND s.document @@ websearch_to_tsquery(@config::text::regconfig, @query)`
+	SQLSetItemFulltext                      = `UPDATE item_search SET fulltext = @content WHERE library = @library AND key = @key`
 	SQLUpdateItemsGitlabTimestamp           = `UPDATE items SET gitlab = TO_TIMESTAMP(@now, 'YYYY-MM-DD HH24:MI:SS') WHERE library = @library AND (TO_TIMESTAMP(@now, 'YYYY-MM-DD HH24:MI:SS') > gitlab OR gitlab IS NULL)`
 	SQLUpdateItemsGitlabTimestampWithFilter = `UPDATE items SET gitlab = TO_TIMESTAMP(@now, 'YYYY-MM-DD HH24:MI:SS') WHERE library = @library AND (TO_TIMESTAMP(@now, 'YYYY-MM-DD HH24:MI:SS') > gitlab OR gitlab IS NULL) AND (gitlab >= TO_TIMESTAMP(@gitlab, 'YYYY-MM-DD HH24:MI:SS') OR gitlab IS NULL)`
 
 	// Tag statements
-	SQLInsertTag  = `INSERT INTO tags (tag, meta, library) VALUES (@tag, @meta, @library)`
-	SQLDeleteTag  = `DELETE FROM tags WHERE tag = @tag AND library = @library`
-	SQLDeleteTags = `DELETE FROM tags WHERE library = @library AND tag = ANY(@tags)`
+	SQLInsertTag     = `INSERT INTO tags (tag, meta, library) VALUES (@tag, @meta, @library)`
+	SQLDeleteTag     = `DELETE FROM tags WHERE tag = @tag AND library = @library`
+	SQLDeleteTags    = `DELETE FROM tags WHERE library = @library AND tag = ANY(@tags)`
+	SQLGetTagUsage   = `SELECT t.tag, t.type, COUNT(*) FROM item_tags t JOIN items i ON i.key = t.key AND i.library = t.library WHERE t.library = @library AND i.deleted = false AND i.trashed = false GROUP BY t.tag, t.type ORDER BY t.tag, t.type`
+	SQLGetItemsByTag = `SELECT i.key, i.version, i.data, i.meta, i.trashed, i.deleted, i.sync, i.md5, i.gitlab FROM items i JOIN item_tags t ON t.key = i.key AND t.library = i.library WHERE t.library = @library AND t.tag = @tag AND i.deleted = false AND i.trashed = false ORDER BY i.key`
+	// SQLMergeTagsInItems replaces the tags @tags of all items by @target and
+	// keeps the first of duplicate tags
+	SQLMergeTagsInItems = `UPDATE items SET data = jsonb_set(data, '{tags}', (SELECT COALESCE(jsonb_agg(m.t ORDER BY m.ord), '[]'::jsonb) FROM (SELECT DISTINCT ON (n.name) n.t, n.ord FROM (SELECT CASE WHEN e.t->>'tag' = ANY(@tags) THEN jsonb_set(e.t, '{tag}', to_jsonb(@target::text)) ELSE e.t END AS t, CASE WHEN e.t->>'tag' = ANY(@tags) THEN @target::text ELSE e.t->>'tag' END AS name, e.ord FROM jsonb_array_elements(data->'tags') WITH ORDINALITY e(t, ord)) n ORDER BY n.name, n.ord) m)), sync = CASE WHEN sync = @syncNew THEN sync ELSE @syncModified END, modified = NOW() WHERE library = @library AND deleted = false AND key IN (SELECT key FROM item_tags WHERE library = @library AND tag = ANY(@tags))`
+	SQLMergeTagRows     = `INSERT INTO tags (tag, meta, library) SELECT @target, meta, library FROM tags WHERE library = @library AND tag = ANY(@tags) LIMIT 1 ON CONFLICT (tag, library) DO NOTHING`
+
+	// API key statements
+	SQLGetApiKey = `SELECT userid, username, access FROM apikeys WHERE tokenhash = @tokenhash AND active = true`
+
+	// Sync run statements
+	SQLAbandonSyncRuns = `UPDATE sync_runs SET status = 'failed', finished = NOW(), error = 'abandoned' WHERE groupid = @groupid AND status IN ('queued', 'running') AND COALESCE(started, requested) < @before`
+	SQLInsertSyncRun   = `INSERT INTO sync_runs (groupid, status, trigger, requestedby) VALUES (@groupid, @status, @trigger, @requestedby) RETURNING id, requested`
+	SQLUpdateSyncRun   = `UPDATE sync_runs SET status = @status, started = @started, finished = @finished, stage = @stage, collections = @collections, uploaded = @uploaded, downloaded = @downloaded, tags = @tags, deleted = @deleted, error = @error WHERE id = @id`
+	SQLGetSyncRun      = `SELECT ` + sqlSyncRunFields + ` FROM sync_runs WHERE id = @id`
+	SQLGetSyncRuns     = `SELECT ` + sqlSyncRunFields + ` FROM sync_runs WHERE groupid = @groupid ORDER BY id DESC LIMIT @limit`
+
+	// Change feed statements
+	SQLGetChanges      = `SELECT seq, library, objecttype, key, version, sync, changetype, changed FROM changes WHERE library = @library AND seq > @after ORDER BY seq LIMIT @limit`
+	SQLLatestChangeSeq = `SELECT COALESCE(MAX(seq), 0) FROM changes WHERE library = @library`
+	SQLListenChanges   = `LISTEN ` + ChangesChannel
+
+	// Schema migration statements
+	SQLSchemaMigrationsExists = `SELECT to_regclass('public.schema_migrations') IS NOT NULL`
+	SQLCreateSchemaMigrations = `CREATE TABLE IF NOT EXISTS public.schema_migrations (version bigint NOT NULL PRIMARY KEY, name text NOT NULL, applied timestamp with time zone DEFAULT now() NOT NULL)`
+	SQLLockSchemaMigrations   = `SELECT pg_advisory_xact_lock(hashtextextended('schema_migrations', 0))`
+	SQLGetSchemaMigrations    = `SELECT version, name, applied FROM schema_migrations ORDER BY version`
+	SQLInsertSchemaMigration  = `INSERT INTO schema_migrations (version, name) VALUES (@version, @name)`
+	SQLDeleteSchemaMigration  = `DELETE FROM schema_migrations WHERE version = @version`
+
+	// Webhook statements
+	SQLInsertWebhook         = `INSERT INTO webhooks (groupid, url, secret, events, active) VALUES (@groupid, @url, @secret, @events, @active) RETURNING id, created`
+	SQLUpdateWebhook         = `UPDATE webhooks SET url = @url, events = @events, active = @active WHERE id = @id`
+	SQLDeleteWebhook         = `DELETE FROM webhooks WHERE id = @id`
+	SQLGetWebhook            = `SELECT ` + sqlWebhookFields + ` FROM webhooks WHERE id = @id`
+	SQLGetWebhooks           = `SELECT ` + sqlWebhookFields + ` FROM webhooks WHERE groupid = @groupid ORDER BY id`
+	SQLClaimWebhookDelivery  = `UPDATE webhook_outbox o SET nextattempt = @lease FROM webhooks w WHERE w.id = o.webhookid AND o.id IN (SELECT id FROM webhook_outbox WHERE status = 'pending' AND nextattempt <= NOW() ORDER BY id LIMIT @limit FOR UPDATE SKIP LOCKED) RETURNING ` + sqlWebhookDeliveryFields + `, o.payload, w.url, w.secret`
+	SQLUpdateWebhookDelivery = `UPDATE webhook_outbox SET status = @status, attempts = @attempts, nextattempt = @nextattempt, responsestatus = @responsestatus, lasterror = @lasterror, delivered = @delivered WHERE id = @id`
+	SQLGetWebhookDeliveries  = `SELECT ` + sqlWebhookDeliveryFields + ` FROM webhook_outbox o WHERE o.webhookid = @webhookid ORDER BY o.id DESC LIMIT @limit`
 )
+
+const sqlWebhookFields = `id, groupid, url, secret, events, active, created`
+
+const sqlWebhookDeliveryFields = `o.id, o.webhookid, o.event, o.status, o.attempts, o.nextattempt, o.responsestatus, o.lasterror, o.created, o.delivered`
+
+const sqlSyncRunFields = `id, groupid, status, trigger, requestedby, requested, started, finished, stage, collections, uploaded, downloaded, tags, deleted, error`
+
+// sqlCollectionSubtree selects the collection @key and all its descendants
+// into the CTE tree. The path column stops the recursion on cyclic data.
+const sqlCollectionSubtree = `WITH RECURSIVE tree AS (SELECT key, version, data, meta, deleted, sync, gitlab, 0 AS depth, ARRAY[key::text] AS path FROM collections WHERE library = @library AND key = @key AND deleted = false AND data IS NOT NULL UNION ALL SELECT c.key, c.version, c.data, c.meta, c.deleted, c.sync, c.gitlab, t.depth + 1, t.path || c.key::text FROM collections c JOIN tree t ON c.data->>'parentCollection' = t.key::text WHERE c.library = @library AND c.deleted = false AND NOT c.key::text = ANY(t.path)) `
+
+// sqlCollectionSubtreeTop is sqlCollectionSubtree starting at all top-level
+// collections of the library.
+const sqlCollectionSubtreeTop = `WITH RECURSIVE tree AS (SELECT key, version, data, meta, deleted, sync, gitlab, 0 AS depth, ARRAY[key::text] AS path FROM collections WHERE library = @library AND deleted = false AND data IS NOT NULL AND COALESCE(NULLIF(data->>'parentCollection', 'false'), '') = '' UNION ALL SELECT c.key, c.version, c.data, c.meta, c.deleted, c.sync, c.gitlab, t.depth + 1, t.path || c.key::text FROM collections c JOIN tree t ON c.data->>'parentCollection' = t.key::text WHERE c.library = @library AND c.deleted = false AND NOT c.key::text = ANY(t.path)) `
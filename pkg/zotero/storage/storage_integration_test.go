@@ -2,6 +2,11 @@ package storage
 
 import (
 	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -300,3 +305,812 @@ func TestIntegration_TagLifecycle(t *testing.T) {
 		t.Fatalf("DeleteTag failed: %v", err)
 	}
 }
+
+func TestIntegration_EnsureCollectionPath(t *testing.T) {
+	st, groupID, cleanup := getTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, _, err := st.CreateEmptyGroup(ctx, groupID)
+	if err != nil {
+		t.Fatalf("failed to create test group: %v", err)
+	}
+
+	path := []string{"Import", "1998", "Class A"}
+	const workers = 8
+	keys := make([]string, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keys[i], errs[i] = st.EnsureCollectionPath(ctx, groupID, path)
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < workers; i++ {
+		if errs[i] != nil {
+			t.Fatalf("EnsureCollectionPath failed: %v", errs[i])
+		}
+		if keys[i] != keys[0] {
+			t.Errorf("concurrent calls returned different keys: %v", keys)
+		}
+	}
+
+	count := 0
+	if err := st.IterateCollections(ctx, groupID, nil, func(c *model.Collection) error {
+		count++
+		if c.Status != model.SyncStatus_New {
+			t.Errorf("expected status New for %s, got %v", c.Data.Name, c.Status)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("IterateCollections failed: %v", err)
+	}
+	if count != len(path) {
+		t.Errorf("expected %d collections, got %d", len(path), count)
+	}
+
+	leaf, err := st.GetCollectionByKey(ctx, groupID, keys[0])
+	if err != nil {
+		t.Fatalf("GetCollectionByKey failed: %v", err)
+	}
+	if leaf == nil || leaf.Data.Name != "Class A" {
+		t.Fatalf("unexpected leaf collection: %+v", leaf)
+	}
+
+	// extending an existing path only creates the new level
+	sub, err := st.EnsureCollectionPath(ctx, groupID, append(path, "Sub"))
+	if err != nil {
+		t.Fatalf("EnsureCollectionPath failed: %v", err)
+	}
+	subColl, err := st.GetCollectionByKey(ctx, groupID, sub)
+	if err != nil {
+		t.Fatalf("GetCollectionByKey failed: %v", err)
+	}
+	if subColl == nil || string(subColl.Data.ParentCollection) != keys[0] {
+		t.Errorf("expected parent %s, got %+v", keys[0], subColl)
+	}
+
+	if _, err := st.EnsureCollectionPath(ctx, groupID, nil); err == nil {
+		t.Error("expected error for empty path")
+	}
+}
+
+func TestIntegration_CollectionTree(t *testing.T) {
+	st, groupID, cleanup := getTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, _, err := st.CreateEmptyGroup(ctx, groupID)
+	if err != nil {
+		t.Fatalf("failed to create test group: %v", err)
+	}
+
+	for _, c := range []*model.CollectionData{
+		sampleCollectionData("TREEROOT", "Root", ""),
+		sampleCollectionData("TREEKID1", "Child 1", "TREEROOT"),
+		sampleCollectionData("TREEKID2", "Child 2", "TREEROOT"),
+		sampleCollectionData("TREEGKID", "Grandchild", "TREEKID1"),
+	} {
+		if _, err := st.CreateCollection(ctx, groupID, c); err != nil {
+			t.Fatalf("CreateCollection failed: %v", err)
+		}
+	}
+	for key, colls := range map[string][]string{
+		"TREEITM1": {"TREEROOT"},
+		"TREEITM2": {"TREEGKID"},
+		"TREEITM3": {"TREEKID2", "TREEGKID"},
+	} {
+		data := sampleItemData(key, "Item "+key, "book")
+		data.Collections = colls
+		if _, err := st.CreateItem(ctx, groupID, data, &model.ItemMeta{}, "tree-"+key); err != nil {
+			t.Fatalf("CreateItem failed: %v", err)
+		}
+	}
+
+	// 1. GetCollectionTree
+	roots, err := st.GetCollectionTree(ctx, groupID, "")
+	if err != nil {
+		t.Fatalf("GetCollectionTree failed: %v", err)
+	}
+	if len(roots) != 1 || roots[0].Collection.Key != "TREEROOT" {
+		t.Fatalf("expected single root TREEROOT, got %+v", roots)
+	}
+	if len(roots[0].Children) != 2 || roots[0].Children[0].Collection.Key != "TREEKID1" {
+		t.Fatalf("unexpected children %+v", roots[0].Children)
+	}
+	if kids := roots[0].Children[0].Children; len(kids) != 1 || kids[0].Collection.Key != "TREEGKID" {
+		t.Errorf("unexpected grandchildren %+v", kids)
+	}
+
+	sub, err := st.GetCollectionTree(ctx, groupID, "TREEKID1")
+	if err != nil {
+		t.Fatalf("GetCollectionTree failed: %v", err)
+	}
+	if len(sub) != 1 || len(sub[0].Children) != 1 {
+		t.Errorf("unexpected subtree %+v", sub)
+	}
+
+	// 2. GetCollectionPath
+	path, err := st.GetCollectionPath(ctx, groupID, "TREEGKID")
+	if err != nil {
+		t.Fatalf("GetCollectionPath failed: %v", err)
+	}
+	if len(path) != 3 || path[0].Key != "TREEROOT" || path[2].Key != "TREEGKID" {
+		t.Errorf("unexpected path %+v", path)
+	}
+
+	// 3. GetItemsInCollection
+	items, err := st.GetItemsInCollection(ctx, groupID, "TREEROOT", false)
+	if err != nil {
+		t.Fatalf("GetItemsInCollection failed: %v", err)
+	}
+	if len(items) != 1 || items[0].Key != "TREEITM1" {
+		t.Errorf("unexpected direct items %+v", items)
+	}
+	items, err = st.GetItemsInCollection(ctx, groupID, "TREEROOT", true)
+	if err != nil {
+		t.Fatalf("GetItemsInCollection recursive failed: %v", err)
+	}
+	if len(items) != 3 {
+		t.Errorf("expected 3 items in subtree, got %d", len(items))
+	}
+}
+
+func TestIntegration_QueryItems(t *testing.T) {
+	st, groupID, cleanup := getTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, _, err := st.CreateEmptyGroup(ctx, groupID)
+	if err != nil {
+		t.Fatalf("failed to create test group: %v", err)
+	}
+	for i, title := range []string{"Alpha", "Beta", "Gamma"} {
+		data := sampleItemData(fmt.Sprintf("QUERYIT%d", i), title, "book")
+		data.Tags = []model.ItemTag{{Tag: "even"}}
+		if i%2 == 1 {
+			data.Tags = []model.ItemTag{{Tag: "odd"}}
+			data.ItemType = "journalArticle"
+		}
+		if _, err := st.CreateItem(ctx, groupID, data, &model.ItemMeta{}, fmt.Sprintf("query-%d", i)); err != nil {
+			t.Fatalf("CreateItem failed: %v", err)
+		}
+	}
+
+	items, total, err := st.QueryItems(ctx, groupID, &ItemQuery{Sort: "title", Limit: 2})
+	if err != nil {
+		t.Fatalf("QueryItems failed: %v", err)
+	}
+	if total != 3 || len(items) != 2 || items[0].Data.Title != "Alpha" {
+		t.Errorf("unexpected first page: total=%d items=%d", total, len(items))
+	}
+	items, _, err = st.QueryItems(ctx, groupID, &ItemQuery{Sort: "title", Start: 2})
+	if err != nil {
+		t.Fatalf("QueryItems failed: %v", err)
+	}
+	if len(items) != 1 || items[0].Data.Title != "Gamma" {
+		t.Errorf("unexpected second page %+v", items)
+	}
+
+	_, total, err = st.QueryItems(ctx, groupID, &ItemQuery{Tags: []string{"even"}, ItemType: "book"})
+	if err != nil {
+		t.Fatalf("QueryItems failed: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("expected 2 even books, got %d", total)
+	}
+	_, total, err = st.QueryItems(ctx, groupID, &ItemQuery{Q: "amm"})
+	if err != nil {
+		t.Fatalf("QueryItems failed: %v", err)
+	}
+	if total != 1 {
+		t.Errorf("expected 1 match for q, got %d", total)
+	}
+}
+
+func TestIntegration_SearchItems(t *testing.T) {
+	st, groupID, cleanup := getTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, _, err := st.CreateEmptyGroup(ctx, groupID)
+	if err != nil {
+		t.Fatalf("failed to create test group: %v", err)
+	}
+	book := sampleItemData("SEARCH01", "Running with Databases", "book")
+	book.ExtraFields = map[string]string{"language": "en"}
+	book.AbstractNote = "How indexes make queries fast."
+	book.Tags = []model.ItemTag{{Tag: "postgres"}}
+	if _, err := st.CreateItem(ctx, groupID, book, &model.ItemMeta{}, "search-1"); err != nil {
+		t.Fatalf("CreateItem failed: %v", err)
+	}
+	pdf := sampleItemData("SEARCH02", "Full Text", "attachment")
+	pdf.Creators = nil
+	if _, err := st.CreateItem(ctx, groupID, pdf, &model.ItemMeta{}, "search-2"); err != nil {
+		t.Fatalf("CreateItem failed: %v", err)
+	}
+	if err := st.SetItemFulltext(ctx, groupID, "SEARCH02", "Indexes are stored as trees"); err != nil {
+		t.Fatalf("SetItemFulltext failed: %v", err)
+	}
+	if err := st.SetItemFulltext(ctx, groupID, "MISSING1", "nothing"); err == nil {
+		t.Error("expected error for full text of a missing item")
+	}
+
+	results, total, err := st.SearchItems(ctx, groupID, "indexes", nil, nil)
+	if err != nil {
+		t.Fatalf("SearchItems failed: %v", err)
+	}
+	if total != 2 || len(results) != 2 || results[0].Item.Key != "SEARCH01" {
+		t.Fatalf("unexpected results for indexes: total=%d %+v", total, results)
+	}
+	if !strings.Contains(results[0].Highlights.Snippet, "<b>indexes</b>") {
+		t.Errorf("expected highlighted snippet, got %q", results[0].Highlights.Snippet)
+	}
+
+	// stemming needs the language of the query
+	_, total, err = st.SearchItems(ctx, groupID, "run", nil, nil)
+	if err != nil || total != 0 {
+		t.Errorf("expected no exact match for run, got %d (%v)", total, err)
+	}
+	results, total, err = st.SearchItems(ctx, groupID, "run", &SearchFilter{Language: "en"}, nil)
+	if err != nil || total != 1 || results[0].Highlights.Title != "<b>Running</b> with Databases" {
+		t.Errorf("expected stemmed match for run, got %d %+v (%v)", total, results, err)
+	}
+
+	_, total, err = st.SearchItems(ctx, groupID, "postgres author", &SearchFilter{ItemType: "book"}, &Page{Limit: 1})
+	if err != nil || total != 1 {
+		t.Errorf("expected tag and creator match, got %d (%v)", total, err)
+	}
+
+	// updates of the item data are indexed
+	book.Title = "Walking with Databases"
+	if err := st.UpdateItem(ctx, groupID, &model.Item{Key: "SEARCH01", Version: 1, Data: *book, Status: model.SyncStatus_Modified}); err != nil {
+		t.Fatalf("UpdateItem failed: %v", err)
+	}
+	_, total, err = st.SearchItems(ctx, groupID, "walking", nil, nil)
+	if err != nil || total != 1 {
+		t.Errorf("expected updated title to be found, got %d (%v)", total, err)
+	}
+}
+
+func TestIntegration_ItemTags(t *testing.T) {
+	st, groupID, cleanup := getTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, _, err := st.CreateEmptyGroup(ctx, groupID)
+	if err != nil {
+		t.Fatalf("failed to create test group: %v", err)
+	}
+	first := sampleItemData("TAGITEM1", "First", "book")
+	first.Tags = []model.ItemTag{{Tag: "history"}, {Tag: "auto", Type: 1}}
+	if _, err := st.CreateItem(ctx, groupID, first, &model.ItemMeta{}, "tags-1"); err != nil {
+		t.Fatalf("CreateItem failed: %v", err)
+	}
+	second := sampleItemData("TAGITEM2", "Second", "book")
+	second.Tags = []model.ItemTag{{Tag: "History"}, {Tag: "history"}}
+	if _, err := st.CreateItem(ctx, groupID, second, &model.ItemMeta{}, "tags-2"); err != nil {
+		t.Fatalf("CreateItem failed: %v", err)
+	}
+
+	items, err := st.GetItemsByTag(ctx, groupID, "history")
+	if err != nil || len(items) != 2 {
+		t.Fatalf("expected 2 items with history, got %d (%v)", len(items), err)
+	}
+	usage, err := st.GetTagUsage(ctx, groupID)
+	if err != nil {
+		t.Fatalf("GetTagUsage failed: %v", err)
+	}
+	if len(usage) != 3 || usage[2].Tag != "history" || usage[2].Meta.NumItems != 2 {
+		t.Errorf("unexpected tag usage %+v", usage)
+	}
+
+	num, err := st.MergeTags(ctx, groupID, []string{"History", "history"}, "Geschichte")
+	if err != nil || num != 2 {
+		t.Fatalf("expected 2 merged items, got %d (%v)", num, err)
+	}
+	merged, err := st.GetItemByKey(ctx, groupID, "TAGITEM2")
+	if err != nil || len(merged.Data.Tags) != 1 || merged.Data.Tags[0].Tag != "Geschichte" {
+		t.Errorf("unexpected merged item %+v (%v)", merged, err)
+	}
+	items, err = st.GetItemsByTag(ctx, groupID, "Geschichte")
+	if err != nil || len(items) != 2 {
+		t.Errorf("expected 2 items with Geschichte, got %d (%v)", len(items), err)
+	}
+	if num, err := st.RenameTag(ctx, groupID, "auto", "automatic"); err != nil || num != 1 {
+		t.Errorf("expected 1 renamed item, got %d (%v)", num, err)
+	}
+}
+
+func TestIntegration_Purge(t *testing.T) {
+	st, groupID, cleanup := getTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, _, err := st.CreateEmptyGroup(ctx, groupID)
+	if err != nil {
+		t.Fatalf("failed to create test group: %v", err)
+	}
+	for _, key := range []string{"PURGED01", "UNSYNCED"} {
+		data := sampleItemData(key, "Purge "+key, "book")
+		data.Tags = []model.ItemTag{{Tag: "purge"}}
+		if _, err := st.CreateItem(ctx, groupID, data, &model.ItemMeta{}, "purge-"+key); err != nil {
+			t.Fatalf("CreateItem failed: %v", err)
+		}
+	}
+	if _, err := st.DeleteItems(ctx, groupID, []string{"PURGED01", "UNSYNCED"}); err != nil {
+		t.Fatalf("DeleteItems failed: %v", err)
+	}
+	if _, err := st.ModifyItem(ctx, groupID, "PURGED01", func(item *model.Item) error {
+		item.Status = model.SyncStatus_Synced
+		return nil
+	}); err != nil {
+		t.Fatalf("ModifyItem failed: %v", err)
+	}
+
+	if num, err := st.PurgeItems(ctx, groupID, time.Now().Add(-time.Hour)); err != nil || num != 0 {
+		t.Errorf("expected no purge of recent deletions, got %d (%v)", num, err)
+	}
+	num, err := st.PurgeItems(ctx, groupID, time.Now().Add(time.Minute))
+	if err != nil || num != 1 {
+		t.Fatalf("expected 1 purged item, got %d (%v)", num, err)
+	}
+	if item, err := st.GetItemByKey(ctx, groupID, "PURGED01"); err != nil || item != nil {
+		t.Errorf("purged item still exists: %v (%v)", item, err)
+	}
+	if item, err := st.GetItemByKey(ctx, groupID, "UNSYNCED"); err != nil || item == nil {
+		t.Errorf("deletion that is not synced was purged (%v)", err)
+	}
+}
+
+func TestIntegration_ObjectStates(t *testing.T) {
+	st, groupID, cleanup := getTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, _, err := st.CreateEmptyGroup(ctx, groupID)
+	if err != nil {
+		t.Fatalf("failed to create test group: %v", err)
+	}
+	item, err := st.CreateItem(ctx, groupID, sampleItemData("STATE001", "State", "book"), &model.ItemMeta{}, "state-1")
+	if err != nil {
+		t.Fatalf("CreateItem failed: %v", err)
+	}
+	item.Version = 7
+	item.Status = model.SyncStatus_Synced
+	if err := st.UpdateItem(ctx, groupID, item); err != nil {
+		t.Fatalf("UpdateItem failed: %v", err)
+	}
+	if err := st.CreateEmptyItem(ctx, groupID, "STATE002", "state-2"); err != nil {
+		t.Fatalf("CreateEmptyItem failed: %v", err)
+	}
+
+	states, err := st.GetItemStates(ctx, groupID)
+	if err != nil || len(states) != 2 || states[0].Version != 7 || states[1].Status != model.SyncStatus_Incomplete {
+		t.Fatalf("unexpected states %+v (%v)", states, err)
+	}
+	if num, err := st.ResetItems(ctx, groupID, []string{"STATE001", "STATE002"}); err != nil || num != 2 {
+		t.Fatalf("expected 2 reset items, got %d (%v)", num, err)
+	}
+	if version, sync, err := st.GetItemVersion(ctx, groupID, "STATE001", ""); err != nil || version != 0 || sync != model.SyncStatus_Incomplete {
+		t.Errorf("item not reset: %d %v (%v)", version, sync, err)
+	}
+}
+
+func TestIntegration_CollectionMoveAndDelete(t *testing.T) {
+	st, groupID, cleanup := getTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, _, err := st.CreateEmptyGroup(ctx, groupID)
+	if err != nil {
+		t.Fatalf("failed to create test group: %v", err)
+	}
+	for _, c := range []*model.CollectionData{
+		sampleCollectionData("MOVEROOT", "Root", ""),
+		sampleCollectionData("MOVEKID1", "Child", "MOVEROOT"),
+		sampleCollectionData("MOVEGKID", "Grandchild", "MOVEKID1"),
+	} {
+		if _, err := st.CreateCollection(ctx, groupID, c); err != nil {
+			t.Fatalf("CreateCollection failed: %v", err)
+		}
+	}
+	data := sampleItemData("MOVEITEM", "Member", "book")
+	data.Collections = []string{"MOVEGKID"}
+	if _, err := st.CreateItem(ctx, groupID, data, &model.ItemMeta{}, "move-item"); err != nil {
+		t.Fatalf("CreateItem failed: %v", err)
+	}
+
+	// 1. moving a collection below its descendant is a cycle
+	_, err = st.ModifyCollection(ctx, groupID, "MOVEROOT", func(coll *model.Collection) error {
+		coll.Data.ParentCollection = "MOVEGKID"
+		return nil
+	})
+	if !errors.Is(err, ErrCollectionCycle) {
+		t.Errorf("expected ErrCollectionCycle, got %v", err)
+	}
+
+	// 2. rename and move to the top level
+	coll, err := st.ModifyCollection(ctx, groupID, "MOVEGKID", func(coll *model.Collection) error {
+		coll.Data.Name = "Moved"
+		coll.Data.ParentCollection = ""
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ModifyCollection failed: %v", err)
+	}
+	if coll.Data.Name != "Moved" {
+		t.Errorf("unexpected collection %+v", coll)
+	}
+	top, err := st.GetCollectionChildren(ctx, groupID, "")
+	if err != nil {
+		t.Fatalf("GetCollectionChildren failed: %v", err)
+	}
+	if len(top) != 2 {
+		t.Errorf("expected 2 top-level collections, got %d", len(top))
+	}
+
+	// 3. delete without recursion is rejected for non-empty collections
+	if _, err := st.DeleteCollectionTree(ctx, groupID, "MOVEROOT", false); !errors.Is(err, ErrCollectionNotEmpty) {
+		t.Errorf("expected ErrCollectionNotEmpty, got %v", err)
+	}
+	keys, err := st.DeleteCollectionTree(ctx, groupID, "MOVEGKID", false)
+	if err != nil {
+		t.Fatalf("DeleteCollectionTree failed: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("expected 1 deleted collection, got %v", keys)
+	}
+	item, err := st.GetItemByKey(ctx, groupID, "MOVEITEM")
+	if err != nil {
+		t.Fatalf("GetItemByKey failed: %v", err)
+	}
+	if len(item.Data.Collections) != 0 {
+		t.Errorf("expected item to be removed from collection, got %v", item.Data.Collections)
+	}
+	keys, err = st.DeleteCollectionTree(ctx, groupID, "MOVEROOT", true)
+	if err != nil {
+		t.Fatalf("DeleteCollectionTree recursive failed: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("expected 2 deleted collections, got %v", keys)
+	}
+}
+
+func TestIntegration_SyncRuns(t *testing.T) {
+	st, groupID, cleanup := getTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	run := &model.SyncRun{GroupId: groupID, Trigger: "test", RequestedBy: "tester"}
+	if err := st.CreateSyncRun(ctx, run, time.Hour); err != nil {
+		t.Fatalf("CreateSyncRun failed: %v", err)
+	}
+	if run.Id == 0 || run.Status != model.SyncRunStatus_Queued {
+		t.Fatalf("unexpected run %+v", run)
+	}
+
+	// only one active run per group
+	second := &model.SyncRun{GroupId: groupID, Trigger: "test"}
+	if err := st.CreateSyncRun(ctx, second, time.Hour); !errors.Is(err, ErrSyncRunActive) {
+		t.Fatalf("expected ErrSyncRunActive, got %v", err)
+	}
+
+	now := time.Now()
+	run.Status = model.SyncRunStatus_Succeeded
+	run.Started = &now
+	run.Finished = &now
+	run.Downloaded = 5
+	if err := st.UpdateSyncRun(ctx, run); err != nil {
+		t.Fatalf("UpdateSyncRun failed: %v", err)
+	}
+	stored, err := st.GetSyncRun(ctx, run.Id)
+	if err != nil {
+		t.Fatalf("GetSyncRun failed: %v", err)
+	}
+	if stored == nil || stored.Status != model.SyncRunStatus_Succeeded || stored.Downloaded != 5 || stored.Finished == nil {
+		t.Errorf("unexpected stored run %+v", stored)
+	}
+
+	// a run without update for longer than staleAfter is abandoned
+	if err := st.CreateSyncRun(ctx, second, time.Hour); err != nil {
+		t.Fatalf("CreateSyncRun failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	third := &model.SyncRun{GroupId: groupID, Trigger: "test"}
+	if err := st.CreateSyncRun(ctx, third, time.Millisecond); err != nil {
+		t.Fatalf("CreateSyncRun with stale run failed: %v", err)
+	}
+
+	runs, err := st.GetSyncRuns(ctx, groupID, 10)
+	if err != nil {
+		t.Fatalf("GetSyncRuns failed: %v", err)
+	}
+	if len(runs) != 3 || runs[0].Id != third.Id {
+		t.Fatalf("unexpected runs %+v", runs)
+	}
+	if runs[1].Status != model.SyncRunStatus_Failed || runs[1].Error != "abandoned" {
+		t.Errorf("expected abandoned run, got %+v", runs[1])
+	}
+}
+
+func TestIntegration_GroupAdmin(t *testing.T) {
+	st, groupID, cleanup := getTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	group, err := st.GetGroup(ctx, groupID)
+	if err != nil {
+		t.Fatalf("GetGroup failed: %v", err)
+	}
+	group.Active = false
+	group.Direction = model.SyncDirection_BothLocal
+	group.SyncTags = true
+	if err := st.UpdateSyncGroup(ctx, group); err != nil {
+		t.Fatalf("UpdateSyncGroup failed: %v", err)
+	}
+	group.ItemVersion = 10
+	group.CollectionVersion = 11
+	group.TagVersion = 12
+	if err := st.UpdateGroup(ctx, group); err != nil {
+		t.Fatalf("UpdateGroup failed: %v", err)
+	}
+
+	groups, err := st.ListGroups(ctx)
+	if err != nil {
+		t.Fatalf("ListGroups failed: %v", err)
+	}
+	var listed *model.Group
+	for _, g := range groups {
+		if g.Id == groupID {
+			listed = g
+		}
+	}
+	if listed == nil {
+		t.Fatal("inactive group missing in ListGroups")
+	}
+	if listed.Active || listed.Direction != model.SyncDirection_BothLocal || !listed.SyncTags || listed.TagVersion != 12 {
+		t.Errorf("unexpected group %+v", listed)
+	}
+
+	if err := st.ClearGroup(ctx, groupID); err != nil {
+		t.Fatalf("ClearGroup failed: %v", err)
+	}
+	group, err = st.GetGroup(ctx, groupID)
+	if err != nil {
+		t.Fatalf("GetGroup failed: %v", err)
+	}
+	if group.ItemVersion != 0 || group.CollectionVersion != 0 || group.TagVersion != 0 {
+		t.Errorf("expected reset cursors, got %+v", group)
+	}
+	if group.Active || !group.SyncTags {
+		t.Errorf("ClearGroup changed settings: %+v", group)
+	}
+}
+
+func TestIntegration_Changes(t *testing.T) {
+	st, groupID, cleanup := getTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	if _, _, err := st.CreateEmptyGroup(ctx, groupID); err != nil {
+		t.Fatalf("failed to create test group: %v", err)
+	}
+	latest, err := st.LatestChangeSeq(ctx, groupID)
+	if err != nil {
+		t.Fatalf("LatestChangeSeq failed: %v", err)
+	}
+
+	listenCtx, stopListen := context.WithCancel(ctx)
+	defer stopListen()
+	notified := make(chan int64, 10)
+	listening := make(chan error, 1)
+	go func() {
+		listening <- st.ListenChanges(listenCtx, func(library int64, seq int64) {
+			if library == groupID {
+				notified <- seq
+			}
+		})
+	}()
+	// give LISTEN time to be executed
+	time.Sleep(200 * time.Millisecond)
+
+	item, err := st.CreateItem(ctx, groupID, sampleItemData("CHANGEK1", "Change Feed", "book"), &model.ItemMeta{}, "")
+	if err != nil {
+		t.Fatalf("CreateItem failed: %v", err)
+	}
+	select {
+	case seq := <-notified:
+		if seq <= latest {
+			t.Errorf("expected sequence after %d, got %d", latest, seq)
+		}
+	case err := <-listening:
+		t.Fatalf("ListenChanges failed: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change notification")
+	}
+
+	// bookkeeping updates are no changes
+	if err := st.UpdateItemsGitlabTimestamp(ctx, groupID, time.Now(), nil); err != nil {
+		t.Fatalf("UpdateItemsGitlabTimestamp failed: %v", err)
+	}
+	if err := st.DeleteItem(ctx, groupID, item.Key); err != nil {
+		t.Fatalf("DeleteItem failed: %v", err)
+	}
+
+	changes, err := st.GetChanges(ctx, groupID, latest, 100)
+	if err != nil {
+		t.Fatalf("GetChanges failed: %v", err)
+	}
+	var types []model.ChangeType
+	for i, change := range changes {
+		if change.Key != "CHANGEK1" || change.ObjectType != "item" {
+			t.Errorf("unexpected change %+v", change)
+		}
+		if i > 0 && change.Seq <= changes[i-1].Seq {
+			t.Errorf("sequence not monotonic: %d after %d", change.Seq, changes[i-1].Seq)
+		}
+		types = append(types, change.Type)
+	}
+	if len(types) != 2 || types[0] != model.ChangeType_Create || types[1] != model.ChangeType_Delete {
+		t.Errorf("expected create and delete, got %v", types)
+	}
+
+	// resume after the first change
+	rest, err := st.GetChanges(ctx, groupID, changes[0].Seq, 100)
+	if err != nil {
+		t.Fatalf("GetChanges failed: %v", err)
+	}
+	if len(rest) != 1 || rest[0].Seq != changes[1].Seq {
+		t.Errorf("expected only the delete, got %+v", rest)
+	}
+}
+
+func TestIntegration_Webhooks(t *testing.T) {
+	st, groupID, cleanup := getTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	hook := &model.Webhook{
+		GroupId: groupID,
+		Url:     "http://localhost/hook",
+		Secret:  "secret",
+		Events:  []model.WebhookEvent{model.WebhookEvent_Created, model.WebhookEvent_Deleted},
+		Active:  true,
+	}
+	if err := st.CreateWebhook(ctx, hook); err != nil {
+		t.Fatalf("CreateWebhook failed: %v", err)
+	}
+	hooks, err := st.GetWebhooks(ctx, groupID)
+	if err != nil {
+		t.Fatalf("GetWebhooks failed: %v", err)
+	}
+	if len(hooks) != 1 || hooks[0].Id != hook.Id || len(hooks[0].Events) != 2 || hooks[0].Secret != "secret" {
+		t.Fatalf("unexpected webhooks %+v", hooks)
+	}
+
+	// the triggers write the events with the change
+	item, err := st.CreateItem(ctx, groupID, &model.ItemGeneric{ItemDataBase: model.ItemDataBase{ItemType: "book"}, Title: "Hooked"}, nil, "")
+	if err != nil {
+		t.Fatalf("CreateItem failed: %v", err)
+	}
+	// not subscribed
+	item.Data.Title = "Changed"
+	if err := st.UpdateItem(ctx, groupID, item); err != nil {
+		t.Fatalf("UpdateItem failed: %v", err)
+	}
+	// a rolled back change has no event
+	tx, err := st.GetDB().Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if _, err := tx.Exec(ctx, "UPDATE items SET deleted = true WHERE library = $1 AND key = $2", groupID, item.Key); err != nil {
+		t.Fatalf("cannot delete item: %v", err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	claimed, err := st.ClaimWebhookDeliveries(ctx, 100, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimWebhookDeliveries failed: %v", err)
+	}
+	var delivery *model.WebhookDelivery
+	for _, d := range claimed {
+		if d.WebhookId == hook.Id {
+			if delivery != nil {
+				t.Fatalf("unexpected second delivery %+v", d)
+			}
+			delivery = d
+		}
+	}
+	if delivery == nil || delivery.Event != model.WebhookEvent_Created || delivery.Url != hook.Url || delivery.Secret != "secret" {
+		t.Fatalf("unexpected claimed deliveries %+v", claimed)
+	}
+	var payload model.WebhookPayload
+	if err := json.Unmarshal(delivery.Payload, &payload); err != nil {
+		t.Fatalf("cannot unmarshal payload: %v", err)
+	}
+	if payload.Key != item.Key || payload.GroupId != groupID || payload.Source != model.WebhookSource_Local || payload.Item == nil || payload.Item.Data.Title != "Hooked" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+
+	// leased deliveries are not claimed twice
+	again, err := st.ClaimWebhookDeliveries(ctx, 100, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimWebhookDeliveries failed: %v", err)
+	}
+	for _, d := range again {
+		if d.Id == delivery.Id {
+			t.Errorf("delivery %v claimed twice", d.Id)
+		}
+	}
+
+	now := time.Now()
+	delivery.Status = model.WebhookDeliveryStatus_Delivered
+	delivery.Attempts = 1
+	delivery.ResponseStatus = 204
+	delivery.Delivered = &now
+	if err := st.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		t.Fatalf("UpdateWebhookDelivery failed: %v", err)
+	}
+	deliveries, err := st.GetWebhookDeliveries(ctx, hook.Id, 10)
+	if err != nil {
+		t.Fatalf("GetWebhookDeliveries failed: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != model.WebhookDeliveryStatus_Delivered || deliveries[0].ResponseStatus != 204 {
+		t.Errorf("unexpected deliveries %+v", deliveries)
+	}
+
+	hook.Active = false
+	if err := st.UpdateWebhook(ctx, hook); err != nil {
+		t.Fatalf("UpdateWebhook failed: %v", err)
+	}
+	if err := st.DeleteWebhook(ctx, hook.Id); err != nil {
+		t.Fatalf("DeleteWebhook failed: %v", err)
+	}
+	if deleted, err := st.GetWebhook(ctx, hook.Id); err != nil || deleted != nil {
+		t.Errorf("expected deleted webhook, got %+v, %v", deleted, err)
+	}
+}
+
+func TestIntegration_Migrations(t *testing.T) {
+	st, _, cleanup := getTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// the migrations create missing objects only, so they can be applied to
+	// the existing test database
+	if _, err := st.MigrateUp(ctx, 0); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+	if err := st.VerifySchema(ctx); err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	applied, err := st.MigrateUp(ctx, 0)
+	if err != nil {
+		t.Fatalf("second MigrateUp failed: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("expected no pending migrations, got %d", len(applied))
+	}
+	states, err := st.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus failed: %v", err)
+	}
+	for _, state := range states {
+		if state.Applied == nil || state.Unknown {
+			t.Errorf("unexpected migration state %+v", state)
+		}
+	}
+	// reverting past the base fails and rolls back the reverted migrations
+	if _, err := st.MigrateDown(ctx, len(states)); err == nil || !strings.Contains(err.Error(), "base schema cannot be reverted") {
+		t.Fatalf("expected MigrateDown past the base to fail, got %v", err)
+	}
+	if err := st.VerifySchema(ctx); err != nil {
+		t.Errorf("VerifySchema after failed MigrateDown: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -474,3 +475,426 @@ func TestPgMock_CreateEmptyGroup(t *testing.T) {
 		t.Errorf("expected direction ToLocal, got %v", direction)
 	}
 }
+
+func TestPgMock_EnsureCollectionPathExisting(t *testing.T) {
+	script := &pgmock.Script{
+		Steps: append(
+			pgmock.AcceptUnauthenticatedConnRequestSteps(),
+			pgmock.ExpectAnyMessage(&pgproto3.Parse{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Describe{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.ParseComplete{}),
+			pgmock.SendMessage(&pgproto3.ParameterDescription{ParameterOIDs: []uint32{20, 25, 25}}), // int8, text, text
+			pgmock.SendMessage(&pgproto3.RowDescription{
+				Fields: []pgproto3.FieldDescription{
+					{Name: []byte("key"), DataTypeOID: 1043},
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+			pgmock.ExpectAnyMessage(&pgproto3.Bind{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Execute{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.BindComplete{}),
+			pgmock.SendMessage(&pgproto3.DataRow{
+				Values: [][]byte{encodeText("TOPCOLL1")},
+			}),
+			pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+		),
+	}
+
+	st, cleanup := startMockServer(t, script)
+	defer cleanup()
+
+	key, err := st.EnsureCollectionPath(context.Background(), 12345, []string{"Top"})
+	if err != nil {
+		t.Fatalf("EnsureCollectionPath failed: %v", err)
+	}
+	if key != "TOPCOLL1" {
+		t.Errorf("expected key 'TOPCOLL1', got %q", key)
+	}
+}
+
+func TestPgMock_GetCollectionPath(t *testing.T) {
+	script := &pgmock.Script{
+		Steps: append(
+			pgmock.AcceptUnauthenticatedConnRequestSteps(),
+			pgmock.ExpectAnyMessage(&pgproto3.Parse{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Describe{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.ParseComplete{}),
+			pgmock.SendMessage(&pgproto3.ParameterDescription{ParameterOIDs: []uint32{20, 1043}}), // int8, varchar
+			pgmock.SendMessage(&pgproto3.RowDescription{
+				Fields: []pgproto3.FieldDescription{
+					{Name: []byte("key"), DataTypeOID: 1043},
+					{Name: []byte("version"), DataTypeOID: 20},
+					{Name: []byte("data"), DataTypeOID: 25},
+					{Name: []byte("meta"), DataTypeOID: 25},
+					{Name: []byte("deleted"), DataTypeOID: 16},
+					{Name: []byte("sync"), DataTypeOID: 1043},
+					{Name: []byte("gitlab"), DataTypeOID: 1184},
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+			pgmock.ExpectAnyMessage(&pgproto3.Bind{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Execute{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.BindComplete{}),
+			pgmock.SendMessage(&pgproto3.DataRow{
+				Values: [][]byte{
+					encodeText("ROOTCOLL"),
+					encodeInt8(1),
+					encodeText(`{"key":"ROOTCOLL","name":"Root","parentCollection":false}`),
+					nil,
+					encodeBool(false),
+					encodeText("synced"),
+					nil,
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.DataRow{
+				Values: [][]byte{
+					encodeText("LEAFCOLL"),
+					encodeInt8(2),
+					encodeText(`{"key":"LEAFCOLL","name":"Leaf","parentCollection":"ROOTCOLL"}`),
+					nil,
+					encodeBool(false),
+					encodeText("synced"),
+					nil,
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 2")}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+		),
+	}
+
+	st, cleanup := startMockServer(t, script)
+	defer cleanup()
+
+	path, err := st.GetCollectionPath(context.Background(), 12345, "LEAFCOLL")
+	if err != nil {
+		t.Fatalf("GetCollectionPath failed: %v", err)
+	}
+	if len(path) != 2 {
+		t.Fatalf("expected 2 collections, got %d", len(path))
+	}
+	if path[0].Data.Name != "Root" || path[1].Data.Name != "Leaf" {
+		t.Errorf("unexpected path order: %q, %q", path[0].Data.Name, path[1].Data.Name)
+	}
+	if string(path[1].Data.ParentCollection) != "ROOTCOLL" {
+		t.Errorf("expected parent 'ROOTCOLL', got %q", path[1].Data.ParentCollection)
+	}
+}
+
+func TestPgMock_GetApiKey(t *testing.T) {
+	script := &pgmock.Script{
+		Steps: append(
+			pgmock.AcceptUnauthenticatedConnRequestSteps(),
+			pgmock.ExpectAnyMessage(&pgproto3.Parse{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Describe{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.ParseComplete{}),
+			pgmock.SendMessage(&pgproto3.ParameterDescription{ParameterOIDs: []uint32{25}}), // text
+			pgmock.SendMessage(&pgproto3.RowDescription{
+				Fields: []pgproto3.FieldDescription{
+					{Name: []byte("userid"), DataTypeOID: 20},
+					{Name: []byte("username"), DataTypeOID: 25},
+					{Name: []byte("access"), DataTypeOID: 25},
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+			pgmock.ExpectAnyMessage(&pgproto3.Bind{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Execute{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.BindComplete{}),
+			pgmock.SendMessage(&pgproto3.DataRow{
+				Values: [][]byte{
+					encodeInt8(7),
+					encodeText("importer"),
+					encodeText(`{"groups":{"12345":{"library":true,"write":true}}}`),
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+		),
+	}
+
+	st, cleanup := startMockServer(t, script)
+	defer cleanup()
+
+	key, err := st.GetApiKey(context.Background(), "secret")
+	if err != nil {
+		t.Fatalf("GetApiKey failed: %v", err)
+	}
+	if key == nil {
+		t.Fatal("expected non-nil key")
+	}
+	if key.UserId != 7 || key.Username != "importer" {
+		t.Errorf("unexpected key %+v", key)
+	}
+	if !key.Access.CanWrite(12345) || key.Access.CanRead(54321) {
+		t.Errorf("unexpected access %+v", key.Access)
+	}
+}
+
+func TestPgMock_GetSyncRuns(t *testing.T) {
+	requested := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	script := &pgmock.Script{
+		Steps: append(
+			pgmock.AcceptUnauthenticatedConnRequestSteps(),
+			pgmock.ExpectAnyMessage(&pgproto3.Parse{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Describe{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.ParseComplete{}),
+			pgmock.SendMessage(&pgproto3.ParameterDescription{ParameterOIDs: []uint32{20, 20}}),
+			pgmock.SendMessage(&pgproto3.RowDescription{
+				Fields: []pgproto3.FieldDescription{
+					{Name: []byte("id"), DataTypeOID: 20},
+					{Name: []byte("groupid"), DataTypeOID: 20},
+					{Name: []byte("status"), DataTypeOID: 25},
+					{Name: []byte("trigger"), DataTypeOID: 25},
+					{Name: []byte("requestedby"), DataTypeOID: 25},
+					{Name: []byte("requested"), DataTypeOID: 1184},
+					{Name: []byte("started"), DataTypeOID: 1184},
+					{Name: []byte("finished"), DataTypeOID: 1184},
+					{Name: []byte("stage"), DataTypeOID: 25},
+					{Name: []byte("collections"), DataTypeOID: 20},
+					{Name: []byte("uploaded"), DataTypeOID: 20},
+					{Name: []byte("downloaded"), DataTypeOID: 20},
+					{Name: []byte("tags"), DataTypeOID: 20},
+					{Name: []byte("deleted"), DataTypeOID: 20},
+					{Name: []byte("error"), DataTypeOID: 25},
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+			pgmock.ExpectAnyMessage(&pgproto3.Bind{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Execute{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.BindComplete{}),
+			pgmock.SendMessage(&pgproto3.DataRow{
+				Values: [][]byte{
+					encodeInt8(2), encodeInt8(12345), encodeText("running"), encodeText("rest"), encodeText("editor"),
+					encodeTimestamp(requested.Add(time.Hour)), encodeTimestamp(requested.Add(time.Hour)), nil, encodeText("download"),
+					encodeInt8(3), encodeInt8(0), encodeInt8(0), encodeInt8(0), encodeInt8(0), nil,
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.DataRow{
+				Values: [][]byte{
+					encodeInt8(1), encodeInt8(12345), encodeText("failed"), encodeText("cli"), nil,
+					encodeTimestamp(requested), encodeTimestamp(requested), encodeTimestamp(requested.Add(time.Minute)), encodeText("upload"),
+					encodeInt8(1), encodeInt8(0), encodeInt8(0), encodeInt8(0), encodeInt8(0), encodeText("cannot sync items"),
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 2")}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+		),
+	}
+
+	st, cleanup := startMockServer(t, script)
+	defer cleanup()
+
+	runs, err := st.GetSyncRuns(context.Background(), 12345, 10)
+	if err != nil {
+		t.Fatalf("GetSyncRuns failed: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %d", len(runs))
+	}
+	if !runs[0].Status.Active() || runs[0].Finished != nil || runs[0].RequestedBy != "editor" || runs[0].Stage != "download" || runs[0].Collections != 3 {
+		t.Errorf("unexpected running run %+v", runs[0])
+	}
+	if runs[1].Status != model.SyncRunStatus_Failed || runs[1].Finished == nil || runs[1].Error != "cannot sync items" || runs[1].RequestedBy != "" {
+		t.Errorf("unexpected failed run %+v", runs[1])
+	}
+	if !runs[1].Requested.Equal(requested) {
+		t.Errorf("expected requested %v, got %v", requested, runs[1].Requested)
+	}
+}
+
+func TestPgMock_GetChanges(t *testing.T) {
+	changed := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	script := &pgmock.Script{
+		Steps: append(
+			pgmock.AcceptUnauthenticatedConnRequestSteps(),
+			pgmock.ExpectAnyMessage(&pgproto3.Parse{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Describe{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.ParseComplete{}),
+			pgmock.SendMessage(&pgproto3.ParameterDescription{ParameterOIDs: []uint32{20, 20, 20}}),
+			pgmock.SendMessage(&pgproto3.RowDescription{
+				Fields: []pgproto3.FieldDescription{
+					{Name: []byte("seq"), DataTypeOID: 20},
+					{Name: []byte("library"), DataTypeOID: 20},
+					{Name: []byte("objecttype"), DataTypeOID: 25},
+					{Name: []byte("key"), DataTypeOID: 25},
+					{Name: []byte("version"), DataTypeOID: 20},
+					{Name: []byte("sync"), DataTypeOID: 25},
+					{Name: []byte("changetype"), DataTypeOID: 25},
+					{Name: []byte("changed"), DataTypeOID: 1184},
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+			pgmock.ExpectAnyMessage(&pgproto3.Bind{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Execute{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.BindComplete{}),
+			pgmock.SendMessage(&pgproto3.DataRow{
+				Values: [][]byte{
+					encodeInt8(11), encodeInt8(12345), encodeText("item"), encodeText("ITEMKEY1"), encodeInt8(0),
+					encodeText("new"), encodeText("create"), encodeTimestamp(changed),
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.DataRow{
+				Values: [][]byte{
+					encodeInt8(12), encodeInt8(12345), encodeText("collection"), encodeText("COLLKEY1"), encodeInt8(7),
+					nil, encodeText("delete"), encodeTimestamp(changed.Add(time.Second)),
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 2")}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+		),
+	}
+
+	st, cleanup := startMockServer(t, script)
+	defer cleanup()
+
+	changes, err := st.GetChanges(context.Background(), 12345, 10, 100)
+	if err != nil {
+		t.Fatalf("GetChanges failed: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(changes))
+	}
+	if changes[0].Seq != 11 || changes[0].ObjectType != "item" || changes[0].Key != "ITEMKEY1" || changes[0].Sync != "new" || changes[0].Type != model.ChangeType_Create {
+		t.Errorf("unexpected item change %+v", changes[0])
+	}
+	if changes[1].Seq != 12 || changes[1].Version != 7 || changes[1].Sync != "" || changes[1].Type != model.ChangeType_Delete {
+		t.Errorf("unexpected collection change %+v", changes[1])
+	}
+	if !changes[0].Changed.Equal(changed) {
+		t.Errorf("expected changed %v, got %v", changed, changes[0].Changed)
+	}
+}
+
+func TestPgMock_GetWebhookDeliveries(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	script := &pgmock.Script{
+		Steps: append(
+			pgmock.AcceptUnauthenticatedConnRequestSteps(),
+			pgmock.ExpectAnyMessage(&pgproto3.Parse{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Describe{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.ParseComplete{}),
+			pgmock.SendMessage(&pgproto3.ParameterDescription{ParameterOIDs: []uint32{20, 20}}),
+			pgmock.SendMessage(&pgproto3.RowDescription{
+				Fields: []pgproto3.FieldDescription{
+					{Name: []byte("id"), DataTypeOID: 20},
+					{Name: []byte("webhookid"), DataTypeOID: 20},
+					{Name: []byte("event"), DataTypeOID: 25},
+					{Name: []byte("status"), DataTypeOID: 25},
+					{Name: []byte("attempts"), DataTypeOID: 20},
+					{Name: []byte("nextattempt"), DataTypeOID: 1184},
+					{Name: []byte("responsestatus"), DataTypeOID: 20},
+					{Name: []byte("lasterror"), DataTypeOID: 25},
+					{Name: []byte("created"), DataTypeOID: 1184},
+					{Name: []byte("delivered"), DataTypeOID: 1184},
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+			pgmock.ExpectAnyMessage(&pgproto3.Bind{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Execute{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.BindComplete{}),
+			pgmock.SendMessage(&pgproto3.DataRow{
+				Values: [][]byte{
+					encodeInt8(2), encodeInt8(5), encodeText("deleted"), encodeText("pending"), encodeInt8(1),
+					encodeTimestamp(created.Add(time.Minute)), encodeInt8(503), encodeText("responded with 503"), encodeTimestamp(created), nil,
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.DataRow{
+				Values: [][]byte{
+					encodeInt8(1), encodeInt8(5), encodeText("created"), encodeText("delivered"), encodeInt8(1),
+					encodeTimestamp(created), encodeInt8(200), nil, encodeTimestamp(created), encodeTimestamp(created),
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 2")}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+		),
+	}
+
+	st, cleanup := startMockServer(t, script)
+	defer cleanup()
+
+	deliveries, err := st.GetWebhookDeliveries(context.Background(), 5, 10)
+	if err != nil {
+		t.Fatalf("GetWebhookDeliveries failed: %v", err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", len(deliveries))
+	}
+	if deliveries[0].Status != model.WebhookDeliveryStatus_Pending || deliveries[0].Event != model.WebhookEvent_Deleted ||
+		deliveries[0].ResponseStatus != 503 || deliveries[0].LastError == "" || deliveries[0].Delivered != nil {
+		t.Errorf("unexpected pending delivery %+v", deliveries[0])
+	}
+	if deliveries[1].Status != model.WebhookDeliveryStatus_Delivered || deliveries[1].Delivered == nil || deliveries[1].LastError != "" {
+		t.Errorf("unexpected delivered delivery %+v", deliveries[1])
+	}
+	if deliveries[0].Payload != nil || deliveries[0].Url != "" {
+		t.Errorf("deliveries must not contain payload and target: %+v", deliveries[0])
+	}
+}
+
+func TestPgMock_VerifySchema(t *testing.T) {
+	applied := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	script := &pgmock.Script{
+		Steps: append(
+			pgmock.AcceptUnauthenticatedConnRequestSteps(),
+			pgmock.ExpectAnyMessage(&pgproto3.Parse{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Describe{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.ParseComplete{}),
+			pgmock.SendMessage(&pgproto3.ParameterDescription{}),
+			pgmock.SendMessage(&pgproto3.RowDescription{
+				Fields: []pgproto3.FieldDescription{
+					{Name: []byte("exists"), DataTypeOID: 16},
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+			pgmock.ExpectAnyMessage(&pgproto3.Bind{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Execute{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.BindComplete{}),
+			pgmock.SendMessage(&pgproto3.DataRow{Values: [][]byte{encodeBool(true)}}),
+			pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+			pgmock.ExpectAnyMessage(&pgproto3.Parse{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Describe{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.ParseComplete{}),
+			pgmock.SendMessage(&pgproto3.ParameterDescription{}),
+			pgmock.SendMessage(&pgproto3.RowDescription{
+				Fields: []pgproto3.FieldDescription{
+					{Name: []byte("version"), DataTypeOID: 20},
+					{Name: []byte("name"), DataTypeOID: 25},
+					{Name: []byte("applied"), DataTypeOID: 1184},
+				},
+			}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+			pgmock.ExpectAnyMessage(&pgproto3.Bind{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Execute{}),
+			pgmock.ExpectAnyMessage(&pgproto3.Sync{}),
+			pgmock.SendMessage(&pgproto3.BindComplete{}),
+			pgmock.SendMessage(&pgproto3.DataRow{Values: [][]byte{encodeInt8(1), encodeText("base"), encodeTimestamp(applied)}}),
+			pgmock.SendMessage(&pgproto3.DataRow{Values: [][]byte{encodeInt8(2), encodeText("apikeys"), encodeTimestamp(applied)}}),
+			pgmock.SendMessage(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 2")}),
+			pgmock.SendMessage(&pgproto3.ReadyForQuery{TxStatus: 'I'}),
+		),
+	}
+
+	st, cleanup := startMockServer(t, script)
+	defer cleanup()
+
+	err := st.VerifySchema(context.Background())
+	if !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("expected ErrSchemaOutdated, got %v", err)
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
 )
 
 func TestIsEmptyResult(t *testing.T) {
@@ -71,3 +74,191 @@ func TestStorageAccessors(t *testing.T) {
 		t.Errorf("expected GetDB() to be nil")
 	}
 }
+
+func TestItemQueryClauses(t *testing.T) {
+	params := pgx.NamedArgs{}
+	q := &ItemQuery{
+		ItemType:   "-attachment || note",
+		Tags:       []string{"a || b", "-c"},
+		Collection: "ABCD1234",
+		Q:          "50%",
+		Since:      7,
+	}
+	where, err := q.where(params)
+	if err != nil {
+		t.Fatalf("where failed: %v", err)
+	}
+	for _, part := range []string{
+		"trashed = false",
+		"NOT data->>'itemType' = ANY(@itemTypes)",
+		"(data->'tags' @> jsonb_build_array(jsonb_build_object('tag', @tag0_0::text)) OR data->'tags' @> jsonb_build_array(jsonb_build_object('tag', @tag0_1::text)))",
+		"NOT (data->'tags' @> jsonb_build_array(jsonb_build_object('tag', @tag1_0::text)))",
+		"data->'collections' ? @collection::text",
+		"version > @since",
+	} {
+		if !strings.Contains(where, part) {
+			t.Errorf("expected %q in %q", part, where)
+		}
+	}
+	if types, ok := params["itemTypes"].([]string); !ok || len(types) != 2 {
+		t.Errorf("unexpected itemTypes param %v", params["itemTypes"])
+	}
+	if params["q"] != `%50\%%` {
+		t.Errorf("expected escaped q, got %v", params["q"])
+	}
+
+	if _, err := (&ItemQuery{ItemType: "bogus"}).where(pgx.NamedArgs{}); err == nil {
+		t.Error("expected error for invalid item type")
+	}
+
+	order, err := (&ItemQuery{}).orderBy()
+	if err != nil || order != " ORDER BY data->>'dateModified' desc NULLS LAST, key desc" {
+		t.Errorf("unexpected default order %q (%v)", order, err)
+	}
+	order, err = (&ItemQuery{Sort: "title"}).orderBy()
+	if err != nil || !strings.Contains(order, "lower(data->>'title') asc") {
+		t.Errorf("unexpected title order %q (%v)", order, err)
+	}
+	if _, err := (&ItemQuery{Sort: "key; DROP TABLE items"}).orderBy(); err == nil {
+		t.Error("expected error for invalid sort field")
+	}
+	if _, err := (&ItemQuery{Direction: "sideways"}).orderBy(); err == nil {
+		t.Error("expected error for invalid direction")
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %s has version %d, expected %d", m.Name, m.Version, i+1)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d_%s has empty statements", m.Version, m.Name)
+		}
+	}
+	if base := migrations[0]; strings.Contains(base.Down, "DROP ") || !strings.Contains(base.Down, "RAISE EXCEPTION") {
+		t.Errorf("base migration must refuse to be reverted: %s", base.Down)
+	}
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		t.Fatalf("LatestSchemaVersion failed: %v", err)
+	}
+	if latest != migrations[len(migrations)-1].Version {
+		t.Errorf("unexpected latest schema version %d", latest)
+	}
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"missing down": {
+			"migrations/0001_base.up.sql": {Data: []byte("SELECT 1")},
+		},
+		"invalid name": {
+			"migrations/base.sql": {Data: []byte("SELECT 1")},
+		},
+		"different names": {
+			"migrations/0001_base.up.sql":    {Data: []byte("SELECT 1")},
+			"migrations/0001_other.down.sql": {Data: []byte("SELECT 1")},
+		},
+	}
+	for name, fsys := range cases {
+		if _, err := LoadMigrations(fsys); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	migrations, err := LoadMigrations(fstest.MapFS{
+		"migrations/0010_b.up.sql":   {Data: []byte("SELECT 10")},
+		"migrations/0010_b.down.sql": {Data: []byte("SELECT -10")},
+		"migrations/0002_a.up.sql":   {Data: []byte("SELECT 2")},
+		"migrations/0002_a.down.sql": {Data: []byte("SELECT -2")},
+	})
+	if err != nil {
+		t.Fatalf("LoadMigrations failed: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 2 || migrations[1].Version != 10 || migrations[1].Down != "SELECT -10" {
+		t.Errorf("unexpected migrations %+v", migrations)
+	}
+}
+
+func TestSearchConfig(t *testing.T) {
+	for lang, expected := range map[string]string{
+		"en-US":   "english",
+		"German":  "german",
+		"de_CH":   "german",
+		"fr":      "french",
+		"klingon": "simple",
+		"":        "simple",
+	} {
+		if config, _ := SearchConfig(lang); config != expected {
+			t.Errorf("SearchConfig(%q) = %q, expected %q", lang, config, expected)
+		}
+	}
+}
+
+func TestSearchItemList(t *testing.T) {
+	newItem := func(key, itemType, title string) *model.Item {
+		item := &model.Item{Key: key}
+		item.Data.ItemType = itemType
+		item.Data.Title = title
+		return item
+	}
+	book := newItem("BOOK0001", "book", "The Theory of Search")
+	book.Data.Creators = []model.ItemDataPerson{{CreatorType: "author", LastName: "Salton"}}
+	book.Data.AbstractNote = "Ranking documents by the weight of their terms."
+	note := newItem("NOTE0001", "note", "")
+	note.Data.Note = "<p>Reading notes on <b>ranking</b> and recall</p>"
+	pdf := newItem("ATTA0001", "attachment", "Full Text PDF")
+	trashed := newItem("TRSH0001", "book", "Search in the trash")
+	trashed.Trashed = true
+	items := []*model.Item{book, note, pdf, trashed}
+	fulltext := map[string]string{pdf.Key: "An introduction to information retrieval and ranking"}
+
+	results, total, err := SearchItemList(items, fulltext, "ranking", nil, nil)
+	if err != nil {
+		t.Fatalf("SearchItemList failed: %v", err)
+	}
+	if total != 3 || len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", total)
+	}
+	// abstract and note weigh more than attachment text
+	if results[2].Item.Key != pdf.Key {
+		t.Errorf("expected attachment last, got %s", results[2].Item.Key)
+	}
+	if results[0].Highlights.Snippet != "<b>Ranking</b> documents by the weight of their terms" {
+		t.Errorf("unexpected snippet %q", results[0].Highlights.Snippet)
+	}
+
+	results, total, err = SearchItemList(items, fulltext, `search -"in the trash"`, &SearchFilter{IncludeTrashed: true}, nil)
+	if err != nil {
+		t.Fatalf("SearchItemList failed: %v", err)
+	}
+	if total != 1 || results[0].Item.Key != book.Key || results[0].Highlights.Title != "The Theory of <b>Search</b>" {
+		t.Errorf("unexpected results for negated phrase: %d %+v", total, results)
+	}
+
+	_, total, err = SearchItemList(items, fulltext, "salton or recall", &SearchFilter{ItemType: "-attachment"}, &Page{Limit: 1})
+	if err != nil || total != 2 {
+		t.Errorf("expected 2 results for or, got %d (%v)", total, err)
+	}
+	_, total, err = SearchItemList(items, fulltext, "salton recall", nil, nil)
+	if err != nil || total != 0 {
+		t.Errorf("expected no result for and, got %d (%v)", total, err)
+	}
+
+	for query, filter := range map[string]*SearchFilter{
+		" - ": nil,
+		"x":   {Language: "klingon"},
+		"y":   {ItemType: "bogus"},
+	} {
+		if _, _, err := SearchItemList(items, fulltext, query, filter, nil); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("expected ErrInvalidQuery for %q, got %v", query, err)
+		}
+	}
+}
@@ -96,9 +96,12 @@ func getTestStorage(t *testing.T) (*Storage, int64, func()) {
 
 	cleanupGroup := func() {
 		bgCtx := context.Background()
+		_, _ = pool.Exec(bgCtx, "DELETE FROM sync_runs WHERE groupid=$1", testGroupID)
+		_, _ = pool.Exec(bgCtx, "DELETE FROM webhooks WHERE groupid=$1", testGroupID)
 		_, _ = pool.Exec(bgCtx, "DELETE FROM tags WHERE library=$1", testGroupID)
 		_, _ = pool.Exec(bgCtx, "DELETE FROM items WHERE library=$1", testGroupID)
 		_, _ = pool.Exec(bgCtx, "DELETE FROM collections WHERE library=$1", testGroupID)
+		_, _ = pool.Exec(bgCtx, "DELETE FROM changes WHERE library=$1", testGroupID)
 		_, _ = pool.Exec(bgCtx, "DELETE FROM syncgroups WHERE id=$1", testGroupID)
 		_, _ = pool.Exec(bgCtx, "DELETE FROM groups WHERE id=$1", testGroupID)
 	}
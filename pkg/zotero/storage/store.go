@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// GroupStore persists groups with their sync settings and cursors.
+type GroupStore interface {
+	GetGroup(ctx context.Context, groupId int64) (*model.Group, error)
+	GetGroups(ctx context.Context) ([]*model.Group, error)
+	CreateEmptyGroup(ctx context.Context, groupId int64) (bool, model.SyncDirection, error)
+	ListGroups(ctx context.Context) ([]*model.Group, error)
+	UpdateSyncGroup(ctx context.Context, group *model.Group) error
+	ClearGroup(ctx context.Context, groupId int64) error
+	UpdateGroup(ctx context.Context, group *model.Group) error
+	UpdateGroupGitlabTimestamp(ctx context.Context, groupId int64, t time.Time) error
+}
+
+// CollectionStore persists the collections of a group.
+type CollectionStore interface {
+	CreateCollection(ctx context.Context, groupId int64, collectionData *model.CollectionData) (*model.Collection, error)
+	CreateEmptyCollection(ctx context.Context, groupId int64, collectionId string) error
+	GetCollectionVersion(ctx context.Context, groupId int64, collectionId string) (int64, model.SyncStatus, error)
+	GetCollectionsByKey(ctx context.Context, groupId int64, objectKeys []string) ([]model.Collection, error)
+	GetCollectionVersions(ctx context.Context, groupId int64, sinceVersion int64) (map[string]int64, int64, error)
+	GetCollectionByKey(ctx context.Context, groupId int64, key string) (*model.Collection, error)
+	GetCollectionByName(ctx context.Context, groupId int64, name string, parentKey string) (*model.Collection, error)
+	UpdateCollection(ctx context.Context, groupId int64, collection *model.Collection) error
+	DeleteCollection(ctx context.Context, groupId int64, key string) error
+	DeleteCollections(ctx context.Context, groupId int64, keys []string) (int64, error)
+	IterateCollections(ctx context.Context, groupId int64, after *time.Time, f func(coll *model.Collection) error) error
+	IterateCollectionsAll(ctx context.Context, groupId int64, after *time.Time, f func(coll *model.Collection) error) error
+	GetModifiedCollections(ctx context.Context, groupId int64) ([]*model.Collection, error)
+	UpdateCollectionsGitlabTimestamp(ctx context.Context, groupId int64, now time.Time, gitlab *time.Time) error
+	EnsureCollectionPath(ctx context.Context, groupId int64, path []string) (string, error)
+	GetCollectionTree(ctx context.Context, groupId int64, key string) ([]*model.CollectionNode, error)
+	GetCollectionPath(ctx context.Context, groupId int64, key string) ([]*model.Collection, error)
+	GetItemsInCollection(ctx context.Context, groupId int64, key string, recursive bool) ([]*model.Item, error)
+	GetCollectionChildren(ctx context.Context, groupId int64, parentKey string) ([]*model.Collection, error)
+	ModifyCollection(ctx context.Context, groupId int64, key string, f func(coll *model.Collection) error) (*model.Collection, error)
+	DeleteCollectionTree(ctx context.Context, groupId int64, key string, recursive bool) ([]string, error)
+	// RefreshCollectionNameHier updates derived lookup data after bulk
+	// changes; stores without such data return nil.
+	RefreshCollectionNameHier(ctx context.Context) error
+}
+
+// ItemStore persists the items of a group.
+type ItemStore interface {
+	CreateItem(ctx context.Context, groupId int64, itemData *model.ItemGeneric, itemMeta *model.ItemMeta, oldId string) (*model.Item, error)
+	CreateEmptyItem(ctx context.Context, groupId int64, itemId string, oldId string) error
+	GetItemVersion(ctx context.Context, groupId int64, itemId string, oldId string) (int64, model.SyncStatus, error)
+	GetItemsByKey(ctx context.Context, groupId int64, objectKeys []string) ([]model.Item, error)
+	GetItemVersions(ctx context.Context, groupId int64, sinceVersion int64, trashed bool) (map[string]int64, int64, error)
+	GetItemByKey(ctx context.Context, groupId int64, key string) (*model.Item, error)
+	GetItemByOldid(ctx context.Context, groupId int64, oldid string) (*model.Item, error)
+	UpdateItem(ctx context.Context, groupId int64, item *model.Item) error
+	ModifyItem(ctx context.Context, groupId int64, key string, f func(item *model.Item) error) (*model.Item, error)
+	DeleteItem(ctx context.Context, groupId int64, key string) error
+	DeleteItems(ctx context.Context, groupId int64, keys []string) (int64, error)
+	GetChildren(ctx context.Context, groupId int64, key string) ([]model.Item, error)
+	DeleteItemRecursive(ctx context.Context, groupId int64, key string) error
+	IterateItems(ctx context.Context, groupId int64, after *time.Time, f func(item *model.Item) error) error
+	IterateItemsAll(ctx context.Context, groupId int64, after *time.Time, f func(item *model.Item) error) error
+	GetModifiedItems(ctx context.Context, groupId int64) ([]*model.Item, error)
+	UpdateItemsGitlabTimestamp(ctx context.Context, groupId int64, now time.Time, gitlab *time.Time) error
+	QueryItems(ctx context.Context, groupId int64, q *ItemQuery) ([]*model.Item, int64, error)
+	// RefreshItemTypeHier updates derived lookup data after bulk changes;
+	// stores without such data return nil.
+	RefreshItemTypeHier(ctx context.Context) error
+}
+
+// TagStore persists the tags of a group and looks up items by tag.
+type TagStore interface {
+	CreateTag(ctx context.Context, groupId int64, tag model.Tag) error
+	DeleteTag(ctx context.Context, groupId int64, tag string) error
+	DeleteTags(ctx context.Context, groupId int64, tags []string) (int64, error)
+	GetTagUsage(ctx context.Context, groupId int64) ([]*model.Tag, error)
+	GetItemsByTag(ctx context.Context, groupId int64, tag string) ([]*model.Item, error)
+	RenameTag(ctx context.Context, groupId int64, tag string, newName string) (int64, error)
+	MergeTags(ctx context.Context, groupId int64, tags []string, target string) (int64, error)
+}
+
+// PurgeStore removes objects that are marked as deleted.
+type PurgeStore interface {
+	PurgeItems(ctx context.Context, groupId int64, before time.Time) (int64, error)
+	PurgeCollections(ctx context.Context, groupId int64, before time.Time) (int64, error)
+}
+
+// StateStore lists the sync state of all objects of a group and resets
+// objects, so that the next sync downloads them again.
+type StateStore interface {
+	GetItemStates(ctx context.Context, groupId int64) ([]model.ObjectState, error)
+	GetCollectionStates(ctx context.Context, groupId int64) ([]model.ObjectState, error)
+	ResetItems(ctx context.Context, groupId int64, keys []string) (int64, error)
+	ResetCollections(ctx context.Context, groupId int64, keys []string) (int64, error)
+}
+
+// SyncRunStore persists the history of group synchronizations.
+type SyncRunStore interface {
+	CreateSyncRun(ctx context.Context, run *model.SyncRun, staleAfter time.Duration) error
+	UpdateSyncRun(ctx context.Context, run *model.SyncRun) error
+	GetSyncRun(ctx context.Context, id int64) (*model.SyncRun, error)
+	GetSyncRuns(ctx context.Context, groupId int64, limit int64) ([]*model.SyncRun, error)
+}
+
+// ApiKeyStore looks up local API keys of the rest service.
+type ApiKeyStore interface {
+	GetApiKey(ctx context.Context, token string) (*model.ApiKey, error)
+}
+
+// ChangeStore provides the change feed of items and collections.
+type ChangeStore interface {
+	GetChanges(ctx context.Context, groupId int64, after int64, limit int64) ([]*model.Change, error)
+	LatestChangeSeq(ctx context.Context, groupId int64) (int64, error)
+	ListenChanges(ctx context.Context, fn func(library int64, seq int64)) error
+}
+
+// WebhookStore persists webhooks and their outbox. It includes
+// webhook.Outbox; the events are written by the stores with every change of
+// an item or collection.
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, hook *model.Webhook) error
+	UpdateWebhook(ctx context.Context, hook *model.Webhook) error
+	DeleteWebhook(ctx context.Context, id int64) error
+	GetWebhook(ctx context.Context, id int64) (*model.Webhook, error)
+	GetWebhooks(ctx context.Context, groupId int64) ([]*model.Webhook, error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int64, lease time.Duration) ([]*model.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	GetWebhookDeliveries(ctx context.Context, webhookId int64, limit int64) ([]*model.WebhookDelivery, error)
+}
+
+// Store is the persistence used by sync.Syncer, the rest service and the
+// importers. Storage implements it on PostgreSQL, memory.Store keeps
+// everything in memory.
+type Store interface {
+	GroupStore
+	CollectionStore
+	ItemStore
+	TagStore
+	PurgeStore
+	StateStore
+	SyncRunStore
+	ApiKeyStore
+	ChangeStore
+	WebhookStore
+	SearchStore
+}
+
+var _ Store = (*Storage)(nil)
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// ErrSyncRunActive is returned by CreateSyncRun if the group already has a
+// queued or running sync run.
+var ErrSyncRunActive = errors.New("sync run already active")
+
+func syncRunFromRow(row pgx.Row) (*model.SyncRun, error) {
+	run := &model.SyncRun{}
+	var status string
+	var requestedBy, stage, errstr sql.NullString
+	var started, finished sql.NullTime
+	if err := row.Scan(&run.Id, &run.GroupId, &status, &run.Trigger, &requestedBy, &run.Requested, &started, &finished, &stage,
+		&run.Collections, &run.Uploaded, &run.Downloaded, &run.Tags, &run.Deleted, &errstr); err != nil {
+		if IsEmptyResult(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "cannot scan sync run")
+	}
+	run.Status = model.SyncRunStatus(status)
+	run.RequestedBy = requestedBy.String
+	run.Stage = stage.String
+	run.Error = errstr.String
+	if started.Valid {
+		run.Started = &started.Time
+	}
+	if finished.Valid {
+		run.Finished = &finished.Time
+	}
+	return run, nil
+}
+
+// CreateSyncRun stores run as queued and sets its id and request time. Active
+// runs of the group requested or started before staleAfter are marked as
+// abandoned first; any other active run results in ErrSyncRunActive.
+func (s *Storage) CreateSyncRun(ctx context.Context, run *model.SyncRun, staleAfter time.Duration) error {
+	if staleAfter > 0 {
+		params := pgx.NamedArgs{
+			"groupid": run.GroupId,
+			"before":  time.Now().Add(-staleAfter),
+		}
+		tag, err := s.db.Exec(ctx, SQLAbandonSyncRuns, params)
+		if err != nil {
+			return errors.Wrapf(err, "cannot execute %s", SQLAbandonSyncRuns)
+		}
+		if tag.RowsAffected() > 0 && s.Logger != nil {
+			s.Logger.Warn().Msgf("abandoned %d stale sync runs of group %v", tag.RowsAffected(), run.GroupId)
+		}
+	}
+	run.Status = model.SyncRunStatus_Queued
+	params := pgx.NamedArgs{
+		"groupid":     run.GroupId,
+		"status":      string(run.Status),
+		"trigger":     run.Trigger,
+		"requestedby": sql.NullString{String: run.RequestedBy, Valid: run.RequestedBy != ""},
+	}
+	if err := s.db.QueryRow(ctx, SQLInsertSyncRun, params).Scan(&run.Id, &run.Requested); err != nil {
+		if IsUniqueViolation(err, "sync_runs_active") {
+			return errors.WithStack(ErrSyncRunActive)
+		}
+		return errors.Wrapf(err, "cannot execute %s", SQLInsertSyncRun)
+	}
+	return nil
+}
+
+// UpdateSyncRun stores status, stage, timestamps, counters and error of run.
+func (s *Storage) UpdateSyncRun(ctx context.Context, run *model.SyncRun) error {
+	params := pgx.NamedArgs{
+		"id":          run.Id,
+		"status":      string(run.Status),
+		"started":     run.Started,
+		"finished":    run.Finished,
+		"stage":       sql.NullString{String: run.Stage, Valid: run.Stage != ""},
+		"collections": run.Collections,
+		"uploaded":    run.Uploaded,
+		"downloaded":  run.Downloaded,
+		"tags":        run.Tags,
+		"deleted":     run.Deleted,
+		"error":       sql.NullString{String: run.Error, Valid: run.Error != ""},
+	}
+	if _, err := s.db.Exec(ctx, SQLUpdateSyncRun, params); err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLUpdateSyncRun)
+	}
+	return nil
+}
+
+// GetSyncRun returns the sync run with the given id or nil.
+func (s *Storage) GetSyncRun(ctx context.Context, id int64) (*model.SyncRun, error) {
+	params := pgx.NamedArgs{"id": id}
+	run, err := syncRunFromRow(s.db.QueryRow(ctx, SQLGetSyncRun, params))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get sync run %v", id)
+	}
+	return run, nil
+}
+
+// GetSyncRuns returns the latest limit sync runs of the group, newest first.
+func (s *Storage) GetSyncRuns(ctx context.Context, groupId int64, limit int64) ([]*model.SyncRun, error) {
+	params := pgx.NamedArgs{
+		"groupid": groupId,
+		"limit":   limit,
+	}
+	rows, err := s.db.Query(ctx, SQLGetSyncRuns, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetSyncRuns)
+	}
+	defer rows.Close()
+	runs := []*model.SyncRun{}
+	for rows.Next() {
+		run, err := syncRunFromRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate sync runs")
+	}
+	return runs, nil
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"encoding/json/v2"
+	"slices"
 
 	"emperror.dev/errors"
 	"github.com/jackc/pgx/v5"
@@ -62,3 +63,113 @@ func (s *Storage) DeleteTags(ctx context.Context, groupId int64, tags []string)
 	}
 	return tag.RowsAffected(), nil
 }
+
+// GetTagUsage returns the tags of the items of the group with the number of
+// items carrying them in Meta.NumItems. A tag used both manually and
+// automatically is returned once per type in Meta.Type. Trashed and deleted
+// items are not counted.
+func (s *Storage) GetTagUsage(ctx context.Context, groupId int64) ([]*model.Tag, error) {
+	params := pgx.NamedArgs{
+		"library": groupId,
+	}
+	rows, err := s.db.Query(ctx, SQLGetTagUsage, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetTagUsage, params)
+	}
+	defer rows.Close()
+	tags := []*model.Tag{}
+	for rows.Next() {
+		tag := &model.Tag{Meta: &model.TagMeta{}}
+		if err := rows.Scan(&tag.Tag, &tag.Meta.Type, &tag.Meta.NumItems); err != nil {
+			return nil, errors.Wrap(err, "cannot scan row")
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "cannot read rows of %s", SQLGetTagUsage)
+	}
+	return tags, nil
+}
+
+// GetItemsByTag returns the items of the group carrying tag, ordered by key.
+// Trashed and deleted items are skipped.
+func (s *Storage) GetItemsByTag(ctx context.Context, groupId int64, tag string) ([]*model.Item, error) {
+	params := pgx.NamedArgs{
+		"library": groupId,
+		"tag":     tag,
+	}
+	rows, err := s.db.Query(ctx, SQLGetItemsByTag, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s: %v", SQLGetItemsByTag, params)
+	}
+	defer rows.Close()
+	items := []*model.Item{}
+	for rows.Next() {
+		item, err := s.itemFromRow(groupId, rows)
+		if err != nil {
+			if errors.Is(err, errEmptyItem) {
+				if s.Logger != nil {
+					s.Logger.Warn().Err(err).Msg("item is empty. skipping")
+				}
+				continue
+			}
+			return nil, errors.Wrapf(err, "cannot scan row")
+		}
+		if item == nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "cannot read rows of %s", SQLGetItemsByTag)
+	}
+	return items, nil
+}
+
+// RenameTag renames tag in all items of the group, see MergeTags.
+func (s *Storage) RenameTag(ctx context.Context, groupId int64, tag string, newName string) (int64, error) {
+	return s.MergeTags(ctx, groupId, []string{tag}, newName)
+}
+
+// MergeTags replaces the tags in all items of the group by target. Items
+// carrying several of them keep one, and the changed items are marked as
+// modified. The tags are replaced by target in the tags table as well. It
+// returns the number of changed items.
+func (s *Storage) MergeTags(ctx context.Context, groupId int64, tags []string, target string) (int64, error) {
+	if target == "" {
+		return 0, errors.New("empty target tag")
+	}
+	tags = slices.DeleteFunc(slices.Clone(tags), func(tag string) bool { return tag == target })
+	if len(tags) == 0 {
+		return 0, nil
+	}
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("merging tags %v into %s", tags, target)
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot begin transaction")
+	}
+	defer tx.Rollback(ctx)
+	params := pgx.NamedArgs{
+		"library":      groupId,
+		"tags":         tags,
+		"target":       target,
+		"syncNew":      model.SyncStatusString[model.SyncStatus_New],
+		"syncModified": model.SyncStatusString[model.SyncStatus_Modified],
+	}
+	result, err := tx.Exec(ctx, SQLMergeTagsInItems, params)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot execute %s: %v", SQLMergeTagsInItems, params)
+	}
+	if _, err := tx.Exec(ctx, SQLMergeTagRows, params); err != nil {
+		return 0, errors.Wrapf(err, "cannot execute %s: %v", SQLMergeTagRows, params)
+	}
+	if _, err := tx.Exec(ctx, SQLDeleteTags, params); err != nil {
+		return 0, errors.Wrapf(err, "cannot execute %s: %v", SQLDeleteTags, params)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, errors.Wrap(err, "cannot commit transaction")
+	}
+	return result.RowsAffected(), nil
+}
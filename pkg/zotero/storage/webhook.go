@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+func webhookFromRow(row pgx.Row) (*model.Webhook, error) {
+	hook := &model.Webhook{}
+	var events []string
+	if err := row.Scan(&hook.Id, &hook.GroupId, &hook.Url, &hook.Secret, &events, &hook.Active, &hook.Created); err != nil {
+		if IsEmptyResult(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "cannot scan webhook")
+	}
+	hook.Events = make([]model.WebhookEvent, 0, len(events))
+	for _, event := range events {
+		hook.Events = append(hook.Events, model.WebhookEvent(event))
+	}
+	return hook, nil
+}
+
+func webhookEvents(hook *model.Webhook) []string {
+	events := make([]string, 0, len(hook.Events))
+	for _, event := range hook.Events {
+		events = append(events, string(event))
+	}
+	return events
+}
+
+// CreateWebhook stores hook and sets its id and creation time.
+func (s *Storage) CreateWebhook(ctx context.Context, hook *model.Webhook) error {
+	params := pgx.NamedArgs{
+		"groupid": hook.GroupId,
+		"url":     hook.Url,
+		"secret":  hook.Secret,
+		"events":  webhookEvents(hook),
+		"active":  hook.Active,
+	}
+	if err := s.db.QueryRow(ctx, SQLInsertWebhook, params).Scan(&hook.Id, &hook.Created); err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLInsertWebhook)
+	}
+	return nil
+}
+
+// UpdateWebhook stores url, events and active state of hook. The secret
+// cannot be changed.
+func (s *Storage) UpdateWebhook(ctx context.Context, hook *model.Webhook) error {
+	params := pgx.NamedArgs{
+		"id":     hook.Id,
+		"url":    hook.Url,
+		"events": webhookEvents(hook),
+		"active": hook.Active,
+	}
+	tag, err := s.db.Exec(ctx, SQLUpdateWebhook, params)
+	if err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLUpdateWebhook)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.Errorf("webhook %v not found", hook.Id)
+	}
+	return nil
+}
+
+// DeleteWebhook removes the webhook and its pending deliveries.
+func (s *Storage) DeleteWebhook(ctx context.Context, id int64) error {
+	if _, err := s.db.Exec(ctx, SQLDeleteWebhook, pgx.NamedArgs{"id": id}); err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLDeleteWebhook)
+	}
+	return nil
+}
+
+// GetWebhook returns the webhook with the given id or nil.
+func (s *Storage) GetWebhook(ctx context.Context, id int64) (*model.Webhook, error) {
+	hook, err := webhookFromRow(s.db.QueryRow(ctx, SQLGetWebhook, pgx.NamedArgs{"id": id}))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get webhook %v", id)
+	}
+	return hook, nil
+}
+
+// GetWebhooks returns all webhooks of the group.
+func (s *Storage) GetWebhooks(ctx context.Context, groupId int64) ([]*model.Webhook, error) {
+	rows, err := s.db.Query(ctx, SQLGetWebhooks, pgx.NamedArgs{"groupid": groupId})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetWebhooks)
+	}
+	defer rows.Close()
+	hooks := []*model.Webhook{}
+	for rows.Next() {
+		hook, err := webhookFromRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate webhooks")
+	}
+	return hooks, nil
+}
+
+func webhookDeliveryFromRow(row pgx.Row, withTarget bool) (*model.WebhookDelivery, error) {
+	delivery := &model.WebhookDelivery{}
+	var event, status string
+	var responseStatus sql.NullInt64
+	var lastError sql.NullString
+	var delivered sql.NullTime
+	dest := []any{&delivery.Id, &delivery.WebhookId, &event, &status, &delivery.Attempts, &delivery.NextAttempt,
+		&responseStatus, &lastError, &delivery.Created, &delivered}
+	if withTarget {
+		dest = append(dest, &delivery.Payload, &delivery.Url, &delivery.Secret)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, errors.Wrap(err, "cannot scan webhook delivery")
+	}
+	delivery.Event = model.WebhookEvent(event)
+	delivery.Status = model.WebhookDeliveryStatus(status)
+	delivery.ResponseStatus = responseStatus.Int64
+	delivery.LastError = lastError.String
+	if delivered.Valid {
+		delivery.Delivered = &delivered.Time
+	}
+	return delivery, nil
+}
+
+// ClaimWebhookDeliveries returns at most limit pending deliveries, which are
+// due, with payload and target. They are not due again for lease, so other
+// processes do not deliver them in the meantime.
+func (s *Storage) ClaimWebhookDeliveries(ctx context.Context, limit int64, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	params := pgx.NamedArgs{
+		"limit": limit,
+		"lease": time.Now().Add(lease),
+	}
+	rows, err := s.db.Query(ctx, SQLClaimWebhookDelivery, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLClaimWebhookDelivery)
+	}
+	defer rows.Close()
+	deliveries := []*model.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := webhookDeliveryFromRow(rows, true)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate webhook deliveries")
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery stores the result of a delivery attempt.
+func (s *Storage) UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	params := pgx.NamedArgs{
+		"id":             delivery.Id,
+		"status":         string(delivery.Status),
+		"attempts":       delivery.Attempts,
+		"nextattempt":    delivery.NextAttempt,
+		"responsestatus": sql.NullInt64{Int64: delivery.ResponseStatus, Valid: delivery.ResponseStatus != 0},
+		"lasterror":      sql.NullString{String: delivery.LastError, Valid: delivery.LastError != ""},
+		"delivered":      delivery.Delivered,
+	}
+	if _, err := s.db.Exec(ctx, SQLUpdateWebhookDelivery, params); err != nil {
+		return errors.Wrapf(err, "cannot execute %s", SQLUpdateWebhookDelivery)
+	}
+	return nil
+}
+
+// GetWebhookDeliveries returns the latest limit deliveries of the webhook,
+// newest first and without payload.
+func (s *Storage) GetWebhookDeliveries(ctx context.Context, webhookId int64, limit int64) ([]*model.WebhookDelivery, error) {
+	params := pgx.NamedArgs{
+		"webhookid": webhookId,
+		"limit":     limit,
+	}
+	rows, err := s.db.Query(ctx, SQLGetWebhookDeliveries, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot execute %s", SQLGetWebhookDeliveries)
+	}
+	defer rows.Close()
+	deliveries := []*model.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := webhookDeliveryFromRow(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate webhook deliveries")
+	}
+	return deliveries, nil
+}
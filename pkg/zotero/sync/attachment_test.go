@@ -0,0 +1,190 @@
+package sync
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/je4/zsync/v2/pkg/filesystem"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/memory"
+)
+
+func TestSyncer_DownloadAttachments_FsFailures(t *testing.T) {
+	const groupId = 12345
+	content := []byte("attachment content")
+	sum := md5.Sum(content)
+	contentMD5 := hex.EncodeToString(sum[:])
+
+	st := memory.NewStore(true, nil)
+	if _, _, err := st.CreateEmptyGroup(testCtx, groupId); err != nil {
+		t.Fatalf("CreateEmptyGroup: %v", err)
+	}
+	fs := filesystem.NewMemFs()
+	if err := fs.FolderCreate(testCtx, groupBucket(groupId), filesystem.FolderCreateOptions{}); err != nil {
+		t.Fatalf("FolderCreate: %v", err)
+	}
+
+	attachments := []string{"ATTACH01", "ATTACH02"}
+	c, closeServer := startMockZoteroCloudServer(t, "test-key", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified-Version", "20")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/file"):
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("ETag", contentMD5)
+			_, _ = w.Write(content)
+		case strings.Contains(r.URL.Path, "/trash"), strings.Contains(r.URL.Path, "/collections"):
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.MarshalWrite(w, map[string]int64{})
+		case r.URL.Query().Get("format") == "versions":
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.MarshalWrite(w, map[string]int64{"ATTACH01": 20, "ATTACH02": 20})
+		default:
+			keys := strings.Split(r.URL.Query().Get("itemKey"), ",")
+			items := []model.Item{}
+			for _, key := range attachments {
+				if !slices.Contains(keys, key) {
+					continue
+				}
+				items = append(items, model.Item{Key: key, Version: 20, Data: model.ItemGeneric{
+					ItemDataBase: model.ItemDataBase{Key: key, Version: 20, ItemType: "attachment"},
+					LinkMode:     "imported_file",
+					ContentType:  "application/octet-stream",
+					MD5:          contentMD5,
+				}})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.MarshalWrite(w, items)
+		}
+	})
+	defer closeServer()
+
+	syncer := NewSyncer(c, st, fs, nil)
+	download := func(faults filesystem.MemFsFaults) {
+		t.Helper()
+		fs.SetFaults(faults)
+		group, err := st.GetGroup(testCtx, groupId)
+		if err != nil {
+			t.Fatalf("GetGroup: %v", err)
+		}
+		group.Direction = model.SyncDirection_BothCloud
+		if _, _, err := syncer.DownloadItems(testCtx, group); err != nil {
+			t.Fatalf("DownloadItems: %v", err)
+		}
+		fs.SetFaults(filesystem.MemFsFaults{})
+	}
+	verify := func(repair bool) map[string]string {
+		t.Helper()
+		report, err := syncer.Verify(testCtx, groupId, repair)
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+		issues := map[string]string{}
+		for _, issue := range report.Issues {
+			issues[issue.Key] = issue.Kind
+		}
+		return issues
+	}
+
+	// calls per attachment: FolderExists of the bucket, FilePut of the file
+	download(filesystem.MemFsFaults{FailCall: 2})
+	if found, _ := fs.FileExists(testCtx, groupBucket(groupId), "ATTACH01"); found {
+		t.Errorf("failed file ATTACH01 exists")
+	}
+	if issues := verify(true); len(issues) != 1 || issues["ATTACH01"] != IssueFileMissing {
+		t.Errorf("unexpected issues %v", issues)
+	}
+
+	// the repaired download stores a truncated file
+	download(filesystem.MemFsFaults{PartialWrite: 4})
+	if info, err := fs.FileStat(testCtx, groupBucket(groupId), "ATTACH01", filesystem.FileStatOptions{}); err != nil || info.Size() != 4 {
+		t.Errorf("expected truncated file: %v %v", info, err)
+	}
+	if issues := verify(true); len(issues) != 1 || issues["ATTACH01"] != IssueMD5Mismatch {
+		t.Errorf("unexpected issues %v", issues)
+	}
+
+	download(filesystem.MemFsFaults{})
+	if issues := verify(false); len(issues) != 0 {
+		t.Errorf("unexpected issues after repair %v", issues)
+	}
+	if data, err := fs.FileGet(testCtx, groupBucket(groupId), "ATTACH01", filesystem.FileGetOptions{}); err != nil || string(data) != string(content) {
+		t.Errorf("ATTACH01 contains %q (%v)", data, err)
+	}
+}
+
+func TestSyncer_DownloadAttachments_Fulltext(t *testing.T) {
+	const groupId = 12345
+	content := []byte("minutes of the annual budget meeting")
+	sum := md5.Sum(content)
+	contentMD5 := hex.EncodeToString(sum[:])
+
+	st := memory.NewStore(true, nil)
+	if _, _, err := st.CreateEmptyGroup(testCtx, groupId); err != nil {
+		t.Fatalf("CreateEmptyGroup: %v", err)
+	}
+	fs := filesystem.NewMemFs()
+	c, closeServer := startMockZoteroCloudServer(t, "test-key", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified-Version", "20")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/file"):
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("ETag", contentMD5)
+			_, _ = w.Write(content)
+		case strings.Contains(r.URL.Path, "/trash"), strings.Contains(r.URL.Path, "/collections"):
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.MarshalWrite(w, map[string]int64{})
+		case r.URL.Query().Get("format") == "versions":
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.MarshalWrite(w, map[string]int64{"ATTACH01": 20})
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.MarshalWrite(w, []model.Item{{Key: "ATTACH01", Version: 20, Data: model.ItemGeneric{
+				ItemDataBase: model.ItemDataBase{Key: "ATTACH01", Version: 20, ItemType: "attachment"},
+				Title:        "Minutes",
+				LinkMode:     "imported_file",
+				ContentType:  "text/plain; charset=utf-8",
+				MD5:          contentMD5,
+			}}})
+		}
+	})
+	defer closeServer()
+
+	group, err := st.GetGroup(testCtx, groupId)
+	if err != nil {
+		t.Fatalf("GetGroup: %v", err)
+	}
+	group.Direction = model.SyncDirection_BothCloud
+	if _, _, err := NewSyncer(c, st, fs, nil).DownloadItems(testCtx, group); err != nil {
+		t.Fatalf("DownloadItems: %v", err)
+	}
+	results, total, err := st.SearchItems(testCtx, groupId, "budget", nil, nil)
+	if err != nil {
+		t.Fatalf("SearchItems: %v", err)
+	}
+	if total != 1 || len(results) != 1 || results[0].Item.Key != "ATTACH01" {
+		t.Errorf("attachment text not indexed: %d results", total)
+	}
+}
+
+func TestReadFulltext(t *testing.T) {
+	cases := []struct {
+		contentType, content, want string
+	}{
+		{"text/plain", "plain text", "plain text"},
+		{"text/plain; charset=utf-8", "caf\xc3\xa9 \xff", "café "},
+		{"application/pdf", "%PDF-1.7", ""},
+		{"", "unknown", ""},
+		{"text/plain", strings.Repeat("a", MaxFulltextSize+10), strings.Repeat("a", MaxFulltextSize)},
+	}
+	for _, c := range cases {
+		got, err := ReadFulltext(c.contentType, strings.NewReader(c.content))
+		if err != nil || got != c.want {
+			t.Errorf("ReadFulltext(%q) = %.20q, %v; want %.20q", c.contentType, got, err, c.want)
+		}
+	}
+}
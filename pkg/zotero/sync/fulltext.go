@@ -0,0 +1,59 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/storage"
+)
+
+// MaxFulltextSize is the number of bytes of an attachment indexed for the
+// full-text search, like the default limit of the Zotero client.
+const MaxFulltextSize = 500000
+
+// FulltextContentType reports whether the text of attachments of
+// contentType is indexed. Only plain text is read; other formats would
+// need an extractor.
+func FulltextContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "text/plain"
+}
+
+// ReadFulltext reads the text of an attachment of contentType from r, at
+// most MaxFulltextSize bytes. It returns an empty string for content types
+// that are not indexed.
+func ReadFulltext(contentType string, r io.Reader) (string, error) {
+	if !FulltextContentType(contentType) {
+		return "", nil
+	}
+	data, err := io.ReadAll(io.LimitReader(r, MaxFulltextSize))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot read attachment text")
+	}
+	return strings.ToValidUTF8(string(data), ""), nil
+}
+
+// StoreFulltext indexes the text of the attachment item key for the
+// full-text search. Attachments whose content type is not indexed get an
+// empty text, so the text of a replaced file does not remain.
+func StoreFulltext(ctx context.Context, st storage.Store, groupId int64, key, contentType string, r io.Reader) error {
+	content, err := ReadFulltext(contentType, r)
+	if err != nil {
+		return errors.Wrapf(err, "cannot read text of attachment %v.%v", groupId, key)
+	}
+	if err := st.SetItemFulltext(ctx, groupId, key, content); err != nil {
+		return errors.Wrapf(err, "cannot store text of attachment %v.%v", groupId, key)
+	}
+	return nil
+}
+
+// storeFulltext indexes a downloaded attachment file, failures are logged
+func (s *Syncer) storeFulltext(ctx context.Context, groupId int64, key, contentType string, data []byte) {
+	if err := StoreFulltext(ctx, s.Storage, groupId, key, contentType, bytes.NewReader(data)); err != nil && s.Logger != nil {
+		s.Logger.Warn().Err(err).Msgf("cannot index attachment file of item %v", key)
+	}
+}
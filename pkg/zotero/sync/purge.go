@@ -0,0 +1,128 @@
+package sync
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// PurgeDeleted removes the items and collections of the group that are
+// marked as deleted, synced, and were last modified more than retention ago.
+// Deletions that are not uploaded yet are kept.
+func (s *Syncer) PurgeDeleted(ctx context.Context, groupId int64, retention time.Duration) (int64, int64, error) {
+	before := time.Now().Add(-retention)
+	items, err := s.Storage.PurgeItems(ctx, groupId, before)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "cannot purge items of group %v", groupId)
+	}
+	collections, err := s.Storage.PurgeCollections(ctx, groupId, before)
+	if err != nil {
+		return items, 0, errors.Wrapf(err, "cannot purge collections of group %v", groupId)
+	}
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("purged %v items and %v collections of group %v", items, collections, groupId)
+	}
+	return items, collections, nil
+}
+
+// GCObject is a file of an attachment bucket without attachment item.
+type GCObject struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	// Pending is set for files younger than the grace period
+	Pending bool `json:"pending,omitempty"`
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// GCReport is the result of CollectGarbage.
+type GCReport struct {
+	GroupId int64      `json:"groupId"`
+	Bucket  string     `json:"bucket"`
+	DryRun  bool       `json:"dryRun"`
+	Files   int64      `json:"files"`
+	Orphans []GCObject `json:"orphans"`
+	Deleted int64      `json:"deleted"`
+	Freed   int64      `json:"freed"`
+}
+
+// Orphans returns the files of the group bucket that belong to no
+// attachment item. Items in the trash keep their files; files of deleted
+// items are orphans. Orphans modified within grace are marked as pending,
+// as they may belong to an upload in progress. files must be listed before
+// Orphans is called, so that files of attachments created in between are
+// not orphans.
+func (s *Syncer) Orphans(ctx context.Context, groupId int64, files []GCObject, grace time.Duration) ([]GCObject, error) {
+	attachments := map[string]bool{}
+	if err := s.Storage.IterateItems(ctx, groupId, nil, func(item *model.Item) error {
+		if item.Data.ItemType == "attachment" {
+			attachments[item.Key] = true
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "cannot read items of group %v", groupId)
+	}
+	orphans := []GCObject{}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if attachments[file.Name] {
+			continue
+		}
+		file.Pending = time.Since(file.ModTime) < grace
+		orphans = append(orphans, file)
+	}
+	return orphans, nil
+}
+
+// CollectGarbage removes the orphans of the group bucket that are older
+// than grace. With dryRun nothing is removed.
+func (s *Syncer) CollectGarbage(ctx context.Context, groupId int64, grace time.Duration, dryRun bool) (*GCReport, error) {
+	if s.Fs == nil {
+		return nil, errors.New("no filesystem configured")
+	}
+	report := &GCReport{
+		GroupId: groupId,
+		Bucket:  groupBucket(groupId),
+		DryRun:  dryRun,
+		Orphans: []GCObject{},
+	}
+	found, err := s.Fs.FolderExists(ctx, report.Bucket)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot check bucket %s", report.Bucket)
+	}
+	if !found {
+		return report, nil
+	}
+
+	var files []GCObject
+	for entry, err := range s.Fs.FileList(ctx, report.Bucket, "") {
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot list files of %s", report.Bucket)
+		}
+		files = append(files, GCObject{Name: entry.Name, Size: entry.Size, ModTime: entry.ModTime})
+	}
+	report.Files = int64(len(files))
+	orphans, err := s.Orphans(ctx, groupId, files, grace)
+	if err != nil {
+		return nil, err
+	}
+	for _, orphan := range orphans {
+		if !orphan.Pending && !dryRun {
+			if err := s.Fs.FileDelete(ctx, report.Bucket, orphan.Name); err != nil {
+				return report, errors.Wrapf(err, "cannot delete %s/%s", report.Bucket, orphan.Name)
+			}
+			orphan.Deleted = true
+			report.Deleted++
+			report.Freed += orphan.Size
+		}
+		report.Orphans = append(report.Orphans, orphan)
+	}
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("%v of %v files in %s are orphans, %v deleted", len(report.Orphans), report.Files, report.Bucket, report.Deleted)
+	}
+	return report, nil
+}
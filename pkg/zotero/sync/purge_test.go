@@ -0,0 +1,163 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/je4/zsync/v2/pkg/filesystem"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/memory"
+	"github.com/op/go-logging"
+)
+
+func TestPurgeDeleted(t *testing.T) {
+	const groupId = 4711
+	st := memory.NewStore(false, nil)
+	syncer := NewSyncer(nil, st, nil, nil)
+	for _, key := range []string{"KEEP0001", "DELETED1", "UNSYNCED"} {
+		if _, err := st.CreateItem(testCtx, groupId, &model.ItemGeneric{ItemDataBase: model.ItemDataBase{Key: key, ItemType: "book"}}, nil, ""); err != nil {
+			t.Fatalf("CreateItem: %v", err)
+		}
+	}
+	if _, err := st.DeleteItems(testCtx, groupId, []string{"DELETED1", "UNSYNCED"}); err != nil {
+		t.Fatalf("DeleteItems: %v", err)
+	}
+	// the deletion of DELETED1 has been uploaded
+	if _, err := st.ModifyItem(testCtx, groupId, "DELETED1", func(item *model.Item) error {
+		item.Status = model.SyncStatus_Synced
+		return nil
+	}); err != nil {
+		t.Fatalf("ModifyItem: %v", err)
+	}
+
+	if items, _, err := syncer.PurgeDeleted(testCtx, groupId, time.Hour); err != nil || items != 0 {
+		t.Errorf("expected no purge within retention, got %d (%v)", items, err)
+	}
+	items, collections, err := syncer.PurgeDeleted(testCtx, groupId, 0)
+	if err != nil || items != 1 || collections != 0 {
+		t.Fatalf("expected 1 purged item, got %d/%d (%v)", items, collections, err)
+	}
+	for key, exists := range map[string]bool{"KEEP0001": true, "DELETED1": false, "UNSYNCED": true} {
+		if item, _ := st.GetItemByKey(testCtx, groupId, key); (item != nil) != exists {
+			t.Errorf("item %s exists: %v", key, item != nil)
+		}
+	}
+}
+
+func TestOrphans(t *testing.T) {
+	const groupId = 4711
+	st := memory.NewStore(false, nil)
+	syncer := NewSyncer(nil, st, nil, nil)
+	for key, itemType := range map[string]string{"ATTACH01": "attachment", "ATTACH02": "attachment", "TRASHED1": "attachment", "BOOK0001": "book"} {
+		if _, err := st.CreateItem(testCtx, groupId, &model.ItemGeneric{ItemDataBase: model.ItemDataBase{Key: key, ItemType: itemType}}, nil, ""); err != nil {
+			t.Fatalf("CreateItem: %v", err)
+		}
+	}
+	if err := st.DeleteItem(testCtx, groupId, "ATTACH02"); err != nil {
+		t.Fatalf("DeleteItem: %v", err)
+	}
+	if _, err := st.ModifyItem(testCtx, groupId, "TRASHED1", func(item *model.Item) error {
+		item.Trashed = true
+		return nil
+	}); err != nil {
+		t.Fatalf("ModifyItem: %v", err)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	var files []GCObject
+	for _, name := range []string{"ATTACH01", "ATTACH02", "TRASHED1", "BOOK0001", "UNKNOWN1"} {
+		files = append(files, GCObject{Name: name, Size: int64(len(name)), ModTime: old})
+	}
+	files = append(files, GCObject{Name: "UPLOAD01", Size: 8, ModTime: time.Now()})
+
+	orphans, err := syncer.Orphans(testCtx, groupId, files, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Orphans: %v", err)
+	}
+	var names, pending []string
+	for _, orphan := range orphans {
+		names = append(names, orphan.Name)
+		if orphan.Pending {
+			pending = append(pending, orphan.Name)
+		}
+	}
+	if !slices.Equal(names, []string{"ATTACH02", "BOOK0001", "UNKNOWN1", "UPLOAD01"}) || !slices.Equal(pending, []string{"UPLOAD01"}) {
+		t.Errorf("unexpected orphans %v, pending %v", names, pending)
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	const groupId = 4711
+	st := memory.NewStore(false, nil)
+	basepath := t.TempDir()
+	fs, err := filesystem.NewLocalFs(basepath, logging.MustGetLogger("test"))
+	if err != nil {
+		t.Fatalf("NewLocalFs: %v", err)
+	}
+	syncer := NewSyncer(nil, st, fs, nil)
+
+	if report, err := syncer.CollectGarbage(testCtx, groupId, 0, false); err != nil || report.Files != 0 {
+		t.Fatalf("expected empty report without bucket, got %+v (%v)", report, err)
+	}
+
+	for key, itemType := range map[string]string{"ATTACH01": "attachment", "ATTACH02": "attachment", "BOOK0001": "book"} {
+		if _, err := st.CreateItem(testCtx, groupId, &model.ItemGeneric{ItemDataBase: model.ItemDataBase{Key: key, ItemType: itemType}}, nil, ""); err != nil {
+			t.Fatalf("CreateItem: %v", err)
+		}
+	}
+	if err := st.DeleteItem(testCtx, groupId, "ATTACH02"); err != nil {
+		t.Fatalf("DeleteItem: %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"ATTACH01", "ATTACH02", "BOOK0001", "UNKNOWN1", "UPLOAD01"} {
+		if err := fs.FilePut(testCtx, groupBucket(groupId), name, []byte(name), filesystem.FilePutOptions{}); err != nil {
+			t.Fatalf("FilePut: %v", err)
+		}
+		if name != "UPLOAD01" {
+			if err := os.Chtimes(filepath.Join(basepath, groupBucket(groupId), name), old, old); err != nil {
+				t.Fatalf("Chtimes: %v", err)
+			}
+		}
+	}
+
+	orphans := func(report *GCReport) (names []string) {
+		for _, orphan := range report.Orphans {
+			names = append(names, orphan.Name)
+		}
+		slices.Sort(names)
+		return names
+	}
+	report, err := syncer.CollectGarbage(testCtx, groupId, 24*time.Hour, true)
+	if err != nil {
+		t.Fatalf("CollectGarbage: %v", err)
+	}
+	if report.Files != 5 || report.Deleted != 0 || !slices.Equal(orphans(report), []string{"ATTACH02", "BOOK0001", "UNKNOWN1", "UPLOAD01"}) {
+		t.Errorf("unexpected dry run report %+v", report)
+	}
+	files := func() (names []string) {
+		for entry, err := range fs.FileList(testCtx, groupBucket(groupId), "") {
+			if err != nil {
+				t.Fatalf("FileList: %v", err)
+			}
+			names = append(names, entry.Name)
+		}
+		return names
+	}
+	if names := files(); len(names) != 5 {
+		t.Errorf("dry run deleted files: %v", names)
+	}
+
+	report, err = syncer.CollectGarbage(testCtx, groupId, 24*time.Hour, false)
+	if err != nil {
+		t.Fatalf("CollectGarbage: %v", err)
+	}
+	if report.Deleted != 3 || report.Freed != 24 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if names := files(); !slices.Equal(names, []string{"ATTACH01", "UPLOAD01"}) {
+		t.Errorf("unexpected files after collection: %v", names)
+	}
+}
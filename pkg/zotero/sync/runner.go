@@ -0,0 +1,152 @@
+package sync
+
+import (
+	"context"
+	stdSync "sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// DefaultStaleAfter is the age after which an unfinished sync run is
+// considered abandoned, e.g. because its process was killed.
+const DefaultStaleAfter = 6 * time.Hour
+
+// Runner executes SyncGroup runs and records them in the sync_runs table.
+// The table allows only one active run per group, across all processes
+// sharing the database.
+type Runner struct {
+	syncer     *Syncer
+	staleAfter time.Duration
+	slots      chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         stdSync.WaitGroup
+}
+
+// NewRunner creates a runner executing at most parallel runs at the same
+// time. Runs older than staleAfter do not block new runs of their group.
+func NewRunner(syncer *Syncer, parallel int, staleAfter time.Duration) *Runner {
+	if parallel < 1 {
+		parallel = 1
+	}
+	if staleAfter <= 0 {
+		staleAfter = DefaultStaleAfter
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		syncer:     syncer,
+		staleAfter: staleAfter,
+		slots:      make(chan struct{}, parallel),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+func (r *Runner) newRun(ctx context.Context, group *model.Group, trigger, requestedBy string) (*model.SyncRun, error) {
+	if r.syncer.Storage == nil {
+		return nil, errors.New("no storage configured for sync runs")
+	}
+	run := &model.SyncRun{
+		GroupId:     group.Id,
+		Trigger:     trigger,
+		RequestedBy: requestedBy,
+	}
+	if err := r.syncer.Storage.CreateSyncRun(ctx, run, r.staleAfter); err != nil {
+		return nil, errors.Wrapf(err, "cannot create sync run for group %v", group.Id)
+	}
+	return run, nil
+}
+
+// Enqueue records a queued run of group and executes it in the background.
+// It returns storage.ErrSyncRunActive if the group is already being synced.
+func (r *Runner) Enqueue(ctx context.Context, group *model.Group, trigger, requestedBy string) (*model.SyncRun, error) {
+	run, err := r.newRun(ctx, group, trigger, requestedBy)
+	if err != nil {
+		return nil, err
+	}
+	// the goroutine gets its own copy, the caller may read the returned run
+	queued := *run
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		_ = r.execute(r.ctx, group, &queued)
+	}()
+	return run, nil
+}
+
+// Run records and executes a run of group and waits for its end. The
+// returned run is also set if the synchronization failed.
+func (r *Runner) Run(ctx context.Context, group *model.Group, trigger, requestedBy string) (*model.SyncRun, error) {
+	run, err := r.newRun(ctx, group, trigger, requestedBy)
+	if err != nil {
+		return nil, err
+	}
+	return run, r.execute(ctx, group, run)
+}
+
+// Shutdown cancels the running background runs and waits until they are
+// recorded as failed or ctx is done.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.cancel()
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Runner) execute(ctx context.Context, group *model.Group, run *model.SyncRun) error {
+	logger := r.syncer.Logger
+	st := r.syncer.Storage
+	// the final state is stored even if ctx has been canceled
+	update := func() {
+		if err := st.UpdateSyncRun(context.WithoutCancel(ctx), run); err != nil && logger != nil {
+			logger.Error().Err(err).Msgf("cannot update sync run %v of group %v", run.Id, run.GroupId)
+		}
+	}
+
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		run.Status = model.SyncRunStatus_Failed
+		run.Error = ctx.Err().Error()
+		now := time.Now()
+		run.Finished = &now
+		update()
+		return ctx.Err()
+	}
+
+	started := time.Now()
+	run.Started = &started
+	run.Status = model.SyncRunStatus_Running
+	update()
+
+	err := r.syncer.SyncGroupRun(ctx, group, run, func(*model.SyncRun) { update() })
+	finished := time.Now()
+	run.Finished = &finished
+	if err != nil {
+		// Stage keeps the failed stage
+		run.Status = model.SyncRunStatus_Failed
+		run.Error = err.Error()
+		if logger != nil {
+			logger.Error().Err(err).Msgf("sync run %v of group %v failed", run.Id, run.GroupId)
+		}
+	} else {
+		run.Status = model.SyncRunStatus_Succeeded
+		run.Stage = ""
+		if logger != nil {
+			logger.Info().Msgf("sync run %v of group %v done in %v", run.Id, run.GroupId, finished.Sub(started))
+		}
+	}
+	update()
+	return err
+}
@@ -341,7 +341,7 @@ func TestSyncer_Integration_Database_LocalClient(t *testing.T) {
 	}
 
 	groupFolder := fmt.Sprintf("%d", groupID)
-	groupExists, err := backupFs.FileExists(groupFolder, "group.json")
+	groupExists, err := backupFs.FileExists(testCtx, groupFolder, "group.json")
 	if err != nil || !groupExists {
 		t.Errorf("expected backup file %s/group.json to exist", groupFolder)
 	}
@@ -411,7 +411,7 @@ func TestSyncer_Integration_Database_CloudClient(t *testing.T) {
 	}
 
 	groupFolder := fmt.Sprintf("%d", groupID)
-	groupExists, err := backupFs.FileExists(groupFolder, "group.json")
+	groupExists, err := backupFs.FileExists(testCtx, groupFolder, "group.json")
 	if err != nil || !groupExists {
 		t.Errorf("expected backup file %s/group.json to exist", groupFolder)
 	}
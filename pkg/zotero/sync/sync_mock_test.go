@@ -355,11 +355,15 @@ func TestSyncer_Mock_Cloud_DownloadAndUploadItems(t *testing.T) {
 					// 3. UpdateItem for ATTACH01
 					append(
 						mockExecSteps([]uint32{20, 25, 25, 16, 16, 1043, 1043, 20, 1043}, "UPDATE 1"),
-						// 4. UpdateItem for ITEMKEY01
+						// 4. SetItemFulltext for ATTACH01
 						append(
-							mockExecSteps([]uint32{20, 25, 25, 16, 16, 1043, 1043, 20, 1043}, "UPDATE 1"),
-							// 5. RefreshItemTypeHier
-							mockSimpleExecSteps("SELECT 1")...,
+							mockExecSteps([]uint32{25, 20, 1042}, "UPDATE 1"),
+							// 5. UpdateItem for ITEMKEY01
+							append(
+								mockExecSteps([]uint32{20, 25, 25, 16, 16, 1043, 1043, 20, 1043}, "UPDATE 1"),
+								// 6. RefreshItemTypeHier
+								mockSimpleExecSteps("SELECT 1")...,
+							)...,
 						)...,
 					)...,
 				)...,
@@ -458,14 +462,15 @@ func TestSyncer_Mock_Cloud_DownloadAndUploadItems(t *testing.T) {
 		t.Errorf("expected lastModifiedVersion 20, got %d", lastModVersion)
 	}
 
-	bucket, err := syncer.GetGroupBucket(groupId)
+	bucket, err := syncer.GetGroupBucket(testCtx, groupId)
 	if err != nil {
 		t.Fatalf("GetGroupBucket failed: %v", err)
 	}
-	exists, err := fs.FileExists(bucket, attachKey)
+	exists, err := fs.FileExists(testCtx, bucket, attachKey)
 	if err != nil || !exists {
 		t.Errorf("expected attachment file %s to exist in fs bucket %s", attachKey, bucket)
 	}
+
 }
 
 func TestSyncer_Mock_SyncTagsAndDeleted(t *testing.T) {
@@ -589,7 +594,7 @@ func TestSyncer_Mock_BackupLocal(t *testing.T) {
 	}
 
 	bucket := fmt.Sprintf("zotero-%d", groupId)
-	if err := sourceFs.FilePut(bucket, attachKey, attachContent, filesystem.FilePutOptions{}); err != nil {
+	if err := sourceFs.FilePut(testCtx, bucket, attachKey, attachContent, filesystem.FilePutOptions{}); err != nil {
 		t.Fatalf("failed to write source attachment: %v", err)
 	}
 
@@ -704,24 +709,24 @@ func TestSyncer_Mock_BackupLocal(t *testing.T) {
 
 	// Verify generated backup files in backupFs (folder is <groupId>/collections, <groupId>/items, <groupId>)
 	collFolder := fmt.Sprintf("%d/collections", groupId)
-	collExists, err := backupFs.FileExists(collFolder, collKey+".json")
+	collExists, err := backupFs.FileExists(testCtx, collFolder, collKey+".json")
 	if err != nil || !collExists {
 		t.Errorf("expected collection backup file %s/%s.json to exist", collFolder, collKey)
 	}
 
 	itemFolder := fmt.Sprintf("%d/items", groupId)
-	itemExists, err := backupFs.FileExists(itemFolder, itemKey+".json")
+	itemExists, err := backupFs.FileExists(testCtx, itemFolder, itemKey+".json")
 	if err != nil || !itemExists {
 		t.Errorf("expected item backup file %s/%s.json to exist", itemFolder, itemKey)
 	}
 
-	binExists, err := backupFs.FileExists(itemFolder, attachKey+".bin")
+	binExists, err := backupFs.FileExists(testCtx, itemFolder, attachKey+".bin")
 	if err != nil || !binExists {
 		t.Errorf("expected binary attachment file %s/%s.bin to exist in backup", itemFolder, attachKey)
 	}
 
 	groupFolder := fmt.Sprintf("%d", groupId)
-	groupExists, err := backupFs.FileExists(groupFolder, "group.json")
+	groupExists, err := backupFs.FileExists(testCtx, groupFolder, "group.json")
 	if err != nil || !groupExists {
 		t.Errorf("expected group backup file %s/group.json to exist", groupFolder)
 	}
@@ -1043,3 +1048,87 @@ func TestSyncer_Mock_BidirectionalSync_Roundtrip(t *testing.T) {
 		t.Errorf("expected dlVer 20, got %d", dlVer)
 	}
 }
+
+func TestSyncer_Mock_SyncGroupRun_Progress(t *testing.T) {
+	groupId := int64(12345)
+
+	collectionFields := []pgproto3.FieldDescription{
+		{Name: []byte("key"), DataTypeOID: 1043},
+		{Name: []byte("version"), DataTypeOID: 20},
+		{Name: []byte("data"), DataTypeOID: 25},
+		{Name: []byte("meta"), DataTypeOID: 25},
+		{Name: []byte("deleted"), DataTypeOID: 16},
+		{Name: []byte("sync"), DataTypeOID: 1043},
+		{Name: []byte("gitlab"), DataTypeOID: 1184},
+	}
+	itemFields := []pgproto3.FieldDescription{
+		{Name: []byte("key"), DataTypeOID: 1043},
+		{Name: []byte("version"), DataTypeOID: 20},
+		{Name: []byte("data"), DataTypeOID: 25},
+		{Name: []byte("meta"), DataTypeOID: 25},
+		{Name: []byte("trashed"), DataTypeOID: 16},
+		{Name: []byte("deleted"), DataTypeOID: 16},
+		{Name: []byte("sync"), DataTypeOID: 1043},
+		{Name: []byte("md5"), DataTypeOID: 1043},
+		{Name: []byte("gitlab"), DataTypeOID: 1184},
+	}
+
+	steps := pgmock.AcceptUnauthenticatedConnRequestSteps()
+	steps = append(steps, mockQuerySteps([]uint32{20, 25, 25}, collectionFields, nil)...)
+	steps = append(steps, mockQuerySteps([]uint32{20, 25, 25}, itemFields, nil)...)
+	steps = append(steps, mockExecSteps([]uint32{1043, 25, 20}, "INSERT 0 1")...)
+	steps = append(steps, mockExecSteps([]uint32{20, 1184, 1184, 25, 16, 20, 20, 20, 20}, "UPDATE 1")...)
+	st, cleanupDB := startMockDatabase(t, &pgmock.Script{Steps: steps})
+	defer cleanupDB()
+
+	cl, cleanupHTTP := startMockZoteroCloudServer(t, "test-api-key", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified-Version", "100")
+		w.Header().Set("Total-Results", "0")
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.Contains(r.URL.RawQuery, "format=versions"):
+			_ = json.MarshalWrite(w, map[string]int64{})
+		case strings.Contains(r.URL.Path, "/tags"):
+			w.Header().Set("Total-Results", "1")
+			_ = json.MarshalWrite(w, []model.Tag{{Tag: "synced-tag", Meta: &model.TagMeta{NumItems: 1}}})
+		case strings.Contains(r.URL.Path, "/deleted"):
+			_ = json.MarshalWrite(w, model.Delete{})
+		default:
+			_, _ = w.Write([]byte("[]"))
+		}
+	})
+	defer cleanupHTTP()
+
+	zlog := zerolog.Nop()
+	syncer := NewSyncer(cl, st, nil, &zlog)
+
+	group := &model.Group{
+		Id:                groupId,
+		Active:            true,
+		Direction:         model.SyncDirection_BothCloud,
+		CollectionVersion: 50,
+		ItemVersion:       50,
+		TagVersion:        50,
+		Version:           50,
+		SyncTags:          true,
+	}
+
+	run := &model.SyncRun{GroupId: groupId}
+	stages := []string{}
+	if err := syncer.SyncGroupRun(testCtx, group, run, func(r *model.SyncRun) {
+		stages = append(stages, r.Stage)
+	}); err != nil {
+		t.Fatalf("SyncGroupRun failed: %v", err)
+	}
+
+	expected := []string{StageCollections, StageUpload, StageDownload, StageTags, StageDeleted, StageCursors}
+	if strings.Join(stages, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected stages %v, got %v", expected, stages)
+	}
+	if run.Tags != 1 {
+		t.Errorf("expected 1 synced tag, got %d", run.Tags)
+	}
+	if run.Collections != 0 || run.Uploaded != 0 || run.Downloaded != 0 || run.Deleted != 0 {
+		t.Errorf("unexpected counters %+v", run)
+	}
+}
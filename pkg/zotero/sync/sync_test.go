@@ -26,7 +26,7 @@ func TestSyncerInit(t *testing.T) {
 		t.Fatal("expected non-nil Syncer")
 	}
 
-	bucket, err := syncer.GetGroupBucket(12345)
+	bucket, err := syncer.GetGroupBucket(testCtx, 12345)
 	if err != nil {
 		t.Fatalf("unexpected error getting group bucket: %v", err)
 	}
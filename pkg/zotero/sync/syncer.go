@@ -19,11 +19,11 @@ import (
 	"github.com/je4/zsync/v2/pkg/zotero/storage"
 )
 
-// Syncer coordinates synchronization between Zotero, PostgreSQL, and the
+// Syncer coordinates synchronization between Zotero, the local store, and the
 // optional attachment filesystem.
 type Syncer struct {
 	Client  *client.Client
-	Storage *storage.Storage
+	Storage storage.Store
 	Fs      filesystem.FileSystem
 	Logger  zLogger.ZLogger
 }
@@ -31,7 +31,7 @@ type Syncer struct {
 // NewSyncer creates a synchronizer from its transport, persistence, filesystem,
 // and logging dependencies. Client, storage, and filesystem may be nil when a
 // caller only needs the corresponding subset of functionality.
-func NewSyncer(client *client.Client, storage *storage.Storage, fs filesystem.FileSystem, logger zLogger.ZLogger) *Syncer {
+func NewSyncer(client *client.Client, storage storage.Store, fs filesystem.FileSystem, logger zLogger.ZLogger) *Syncer {
 	return &Syncer{
 		Client:  client,
 		Storage: storage,
@@ -42,55 +42,93 @@ func NewSyncer(client *client.Client, storage *storage.Storage, fs filesystem.Fi
 
 // GetGroupBucket returns, and creates when necessary, the attachment bucket
 // belonging to a Zotero group.
-func (s *Syncer) GetGroupBucket(groupId int64) (string, error) {
+func (s *Syncer) GetGroupBucket(ctx context.Context, groupId int64) (string, error) {
 	if s.Fs == nil {
 		return "", errors.New("no filesystem configured")
 	}
-	bucket := fmt.Sprintf("zotero-%v", groupId)
-	found, err := s.Fs.FolderExists(bucket)
+	bucket := groupBucket(groupId)
+	found, err := s.Fs.FolderExists(ctx, bucket)
 	if err != nil {
 		return "", errors.Wrap(err, "cannot check bucket existence")
 	}
 	if !found {
-		if err := s.Fs.FolderCreate(bucket, filesystem.FolderCreateOptions{}); err != nil {
+		if err := s.Fs.FolderCreate(ctx, bucket, filesystem.FolderCreateOptions{}); err != nil {
 			return "", errors.Wrapf(err, "cannot create bucket %s", bucket)
 		}
 	}
 	return bucket, nil
 }
 
+// groupBucket is the name of the attachment bucket of a group
+func groupBucket(groupId int64) string {
+	return fmt.Sprintf("zotero-%v", groupId)
+}
+
 // SyncGroup runs the complete group pipeline and persists new synchronization
 // cursors only after all stages succeed.
 func (s *Syncer) SyncGroup(ctx context.Context, group *model.Group) error {
+	return s.SyncGroupRun(ctx, group, &model.SyncRun{GroupId: group.Id}, nil)
+}
+
+// Stages of SyncGroupRun as reported in SyncRun.Stage
+const (
+	StageCollections = "collections"
+	StageUpload      = "upload"
+	StageDownload    = "download"
+	StageTags        = "tags"
+	StageDeleted     = "deleted"
+	StageCursors     = "cursors"
+)
+
+// SyncGroupRun is SyncGroup recording the current stage and the number of
+// changes in run. progress, if not nil, is called whenever a stage starts.
+func (s *Syncer) SyncGroupRun(ctx context.Context, group *model.Group, run *model.SyncRun, progress func(run *model.SyncRun)) error {
 	if s.Logger != nil {
 		s.Logger.Info().Msgf("Syncing Group #%v - %v", group.Id, group.Data.Name)
 	}
+	stage := func(name string) {
+		run.Stage = name
+		if progress != nil {
+			progress(run)
+		}
+	}
 
-	_, collectionVersion, err := s.SyncCollections(ctx, group)
+	stage(StageCollections)
+	collections, collectionVersion, err := s.SyncCollections(ctx, group)
 	if err != nil {
 		return errors.Wrapf(err, "cannot sync collections of Group %v", group.Id)
 	}
+	run.Collections = collections
 
-	_, itemVersion, err := s.UploadItems(ctx, group)
+	stage(StageUpload)
+	uploaded, itemVersion, err := s.UploadItems(ctx, group)
 	if err != nil {
 		return errors.Wrapf(err, "cannot sync items of Group %v", group.Id)
 	}
+	run.Uploaded = uploaded
 
-	_, itemVersion, err = s.DownloadItems(ctx, group)
+	stage(StageDownload)
+	downloaded, itemVersion, err := s.DownloadItems(ctx, group)
 	if err != nil {
 		return errors.Wrapf(err, "cannot sync items of Group %v", group.Id)
 	}
+	run.Downloaded = downloaded
 
-	_, tagVersion, err := s.SyncTags(ctx, group)
+	stage(StageTags)
+	tags, tagVersion, err := s.SyncTags(ctx, group)
 	if err != nil {
 		return errors.Wrapf(err, "cannot sync tags of Group %v", group.Id)
 	}
+	run.Tags = tags
 
-	_, err = s.SyncDeleted(ctx, group)
+	stage(StageDeleted)
+	deleted, err := s.SyncDeleted(ctx, group)
 	if err != nil {
 		return errors.Wrapf(err, "cannot sync deleted of Group %v", group.Id)
 	}
+	run.Deleted = deleted
 
+	stage(StageCursors)
 	// change to new version if everything was ok
 	if collectionVersion > group.CollectionVersion {
 		group.CollectionVersion = collectionVersion
@@ -291,16 +329,16 @@ func (s *Syncer) syncModifiedItems(ctx context.Context, group *model.Group, last
 
 		// Handle attachment upload if needed
 		if item.Data.ItemType == "attachment" && item.Data.LinkMode == "imported_file" && s.Fs != nil {
-			bucket, err := s.GetGroupBucket(group.Id)
+			bucket, err := s.GetGroupBucket(ctx, group.Id)
 			if err != nil {
 				return 0, errors.Wrap(err, "cannot get group bucket")
 			}
-			fileReader, err := s.Fs.FileOpenRead(bucket, item.Key, filesystem.FileGetOptions{})
+			fileReader, err := s.Fs.FileOpenRead(ctx, bucket, item.Key, filesystem.FileGetOptions{})
 			if err == nil {
 				defer fileReader.Close()
 				data, readErr := io.ReadAll(fileReader)
 				if readErr == nil {
-					fInfo, statErr := s.Fs.FileStat(bucket, item.Key, filesystem.FileStatOptions{})
+					fInfo, statErr := s.Fs.FileStat(ctx, bucket, item.Key, filesystem.FileStatOptions{})
 					var mtime int64
 					if statErr == nil && fInfo != nil {
 						mtime = fInfo.ModTime().UnixNano() / int64(time.Millisecond)
@@ -428,13 +466,27 @@ func (s *Syncer) syncItems(ctx context.Context, group *model.Group, trashed bool
 			item.Trashed = trashed
 
 			// Download attachment file if it's an imported_file attachment
+			var fileChanged bool
+			var file []byte
+			var fileContentType string
 			if item.Data.ItemType == "attachment" && item.Data.LinkMode == "imported_file" && s.Fs != nil {
-				bucket, err := s.GetGroupBucket(group.Id)
+				bucket, err := s.GetGroupBucket(ctx, group.Id)
 				if err == nil {
 					body, contentType, md5str, dlErr := s.Client.DownloadAttachment(ctx, group.Id, item.Key)
 					if dlErr == nil {
-						_ = s.Fs.FilePut(bucket, item.Key, body, filesystem.FilePutOptions{ContentType: contentType})
-						item.MD5 = md5str
+						// a file that cannot be stored is reported by Verify
+						if putErr := s.Fs.FilePut(ctx, bucket, item.Key, body, filesystem.FilePutOptions{ContentType: contentType}); putErr != nil {
+							if s.Logger != nil {
+								s.Logger.Warn().Err(putErr).Msgf("cannot store attachment file of item %v", item.Key)
+							}
+						} else {
+							item.MD5 = md5str
+							fileChanged = true
+							file, fileContentType = body, item.Data.ContentType
+							if fileContentType == "" {
+								fileContentType = contentType
+							}
+						}
 					}
 				}
 			}
@@ -443,6 +495,8 @@ func (s *Syncer) syncItems(ctx context.Context, group *model.Group, trashed bool
 				if s.Logger != nil {
 					s.Logger.Error().Msgf("cannot update item: %v", err)
 				}
+			} else if fileChanged {
+				s.storeFulltext(ctx, group.Id, item.Key, fileContentType, file)
 			}
 			counter++
 		}
@@ -542,7 +596,7 @@ func (s *Syncer) BackupLocal(ctx context.Context, group *model.Group, backupFs f
 		if err != nil {
 			return errors.Wrapf(err, "cannot marshal collection backup data %v", data)
 		}
-		if err := backupFs.FilePut(folder, fname, b, filesystem.FilePutOptions{}); err != nil {
+		if err := backupFs.FilePut(ctx, folder, fname, b, filesystem.FilePutOptions{}); err != nil {
 			return errors.Wrap(err, "cannot write collection backup file")
 		}
 		return nil
@@ -575,17 +629,17 @@ func (s *Syncer) BackupLocal(ctx context.Context, group *model.Group, backupFs f
 		if err != nil {
 			return errors.Wrapf(err, "cannot marshal item backup data %v", data)
 		}
-		if err := backupFs.FilePut(folder, fname, b, filesystem.FilePutOptions{}); err != nil {
+		if err := backupFs.FilePut(ctx, folder, fname, b, filesystem.FilePutOptions{}); err != nil {
 			return errors.Wrap(err, "cannot write item backup file")
 		}
 
 		if strings.ToLower(item.Data.ItemType) == "attachment" && s.Fs != nil {
-			bucket, err := s.GetGroupBucket(groupId)
+			bucket, err := s.GetGroupBucket(ctx, groupId)
 			if err == nil {
-				file, err := s.Fs.FileOpenRead(bucket, item.Key, filesystem.FileGetOptions{})
+				file, err := s.Fs.FileOpenRead(ctx, bucket, item.Key, filesystem.FileGetOptions{})
 				if err == nil {
 					defer file.Close()
-					_ = backupFs.FileWrite(folder, fmt.Sprintf("%v.bin", item.Key), file, -1, filesystem.FilePutOptions{})
+					_ = backupFs.FileWrite(ctx, folder, fmt.Sprintf("%v.bin", item.Key), file, -1, filesystem.FilePutOptions{})
 				}
 			}
 		}
@@ -618,7 +672,7 @@ func (s *Syncer) BackupLocal(ctx context.Context, group *model.Group, backupFs f
 	if err != nil {
 		return errors.Wrapf(err, "cannot marshal group backup data %v", groupData)
 	}
-	if err := backupFs.FilePut(groupFolder, fname, b, filesystem.FilePutOptions{}); err != nil {
+	if err := backupFs.FilePut(ctx, groupFolder, fname, b, filesystem.FilePutOptions{}); err != nil {
 		return errors.Wrap(err, "cannot write group backup file")
 	}
 
@@ -0,0 +1,325 @@
+package sync
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"emperror.dev/errors"
+	"github.com/je4/zsync/v2/pkg/filesystem"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// kinds of VerifyIssue
+const (
+	// the object is in the cloud but not in the database
+	IssueMissingLocal = "missing_local"
+	// a synced object of the database is not in the cloud
+	IssueMissingRemote = "missing_remote"
+	// a synced object has another version than in the cloud
+	IssueVersionMismatch = "version_mismatch"
+	// the object was never downloaded completely
+	IssueIncomplete = "incomplete"
+	// the file of an imported attachment is not in the bucket
+	IssueFileMissing = "file_missing"
+	// the file of an imported attachment is empty
+	IssueFileEmpty = "file_empty"
+	// the file of an imported attachment does not match the stored md5
+	IssueMD5Mismatch = "md5_mismatch"
+	// the parent item of a child item does not exist
+	IssueDanglingParent = "dangling_parent"
+	// the parent collection of a collection does not exist
+	IssueMissingParentCollection = "missing_parent_collection"
+)
+
+// object types of VerifyIssue
+const (
+	ObjectItem       = "item"
+	ObjectCollection = "collection"
+)
+
+// VerifyIssue is an inconsistency found by Verify. RemoteVersion is only
+// set if the object is in the cloud. Scheduled is set if the repair
+// scheduled a download of the object.
+type VerifyIssue struct {
+	Kind          string `json:"kind"`
+	Object        string `json:"object"`
+	Key           string `json:"key"`
+	LocalVersion  int64  `json:"localVersion"`
+	RemoteVersion int64  `json:"remoteVersion,omitempty"`
+	Detail        string `json:"detail,omitempty"`
+	Scheduled     bool   `json:"scheduled,omitempty"`
+}
+
+// VerifyReport is the result of Verify. Remote is set if the versions were
+// compared with the cloud, Files if the attachment files were checked.
+type VerifyReport struct {
+	GroupId     int64         `json:"groupId"`
+	Remote      bool          `json:"remote"`
+	Files       bool          `json:"files"`
+	Repair      bool          `json:"repair"`
+	Items       int64         `json:"items"`
+	Collections int64         `json:"collections"`
+	Attachments int64         `json:"attachments"`
+	Issues      []VerifyIssue `json:"issues"`
+	Scheduled   int64         `json:"scheduled"`
+}
+
+// Verify checks the consistency of group groupId. It compares the versions
+// of the stored items and collections with the cloud, reports objects that
+// are still incomplete, child items without parent and collections without
+// parent collection, and checks the files of imported attachments against
+// their md5. The cloud is skipped without Client, the files without Fs.
+//
+// With repair, objects that are in the cloud and have no local changes are
+// reset, and the sync cursors of the group are cleared, so that the next
+// sync downloads them again. Objects that are missing in the cloud are only
+// reported.
+func (s *Syncer) Verify(ctx context.Context, groupId int64, repair bool) (*VerifyReport, error) {
+	report := &VerifyReport{
+		GroupId: groupId,
+		Remote:  s.Client != nil,
+		Files:   s.Fs != nil,
+		Repair:  repair,
+		Issues:  []VerifyIssue{},
+	}
+
+	var remoteItems, remoteCollections map[string]int64
+	if s.Client != nil {
+		var err error
+		if remoteItems, _, err = s.Client.GetItemVersions(ctx, groupId, 0, false); err != nil {
+			return nil, errors.Wrapf(err, "cannot get item versions of group %v", groupId)
+		}
+		trashed, _, err := s.Client.GetItemVersions(ctx, groupId, 0, true)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get trashed item versions of group %v", groupId)
+		}
+		for key, version := range trashed {
+			remoteItems[key] = version
+		}
+		if remoteCollections, _, err = s.Client.GetCollectionVersions(ctx, groupId, 0); err != nil {
+			return nil, errors.Wrapf(err, "cannot get collection versions of group %v", groupId)
+		}
+	}
+
+	collections, err := s.Storage.GetCollectionStates(ctx, groupId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get collection states of group %v", groupId)
+	}
+	items, err := s.Storage.GetItemStates(ctx, groupId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get item states of group %v", groupId)
+	}
+	resetCollections := report.compareStates(ObjectCollection, collections, remoteCollections)
+	resetItems := report.compareStates(ObjectItem, items, remoteItems)
+
+	collectionKeys := existingKeys(collections)
+	if err := s.Storage.IterateCollections(ctx, groupId, nil, func(coll *model.Collection) error {
+		report.Collections++
+		if parent := string(coll.Data.ParentCollection); parent != "" && !collectionKeys[parent] {
+			report.Issues = append(report.Issues, VerifyIssue{
+				Kind:         IssueMissingParentCollection,
+				Object:       ObjectCollection,
+				Key:          coll.Key,
+				LocalVersion: coll.Version,
+				Detail:       fmt.Sprintf("parent collection %s", parent),
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "cannot read collections of group %v", groupId)
+	}
+
+	itemKeys := existingKeys(items)
+	var attachments []*model.Item
+	if err := s.Storage.IterateItems(ctx, groupId, nil, func(item *model.Item) error {
+		report.Items++
+		if parent := item.Data.ParentItem; parent != "" && !itemKeys[parent] {
+			report.Issues = append(report.Issues, VerifyIssue{
+				Kind:         IssueDanglingParent,
+				Object:       ObjectItem,
+				Key:          item.Key,
+				LocalVersion: item.Version,
+				Detail:       fmt.Sprintf("parent item %s", parent),
+			})
+		}
+		if item.Data.ItemType == "attachment" && item.Data.LinkMode == "imported_file" {
+			attachments = append(attachments, item)
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "cannot read items of group %v", groupId)
+	}
+	report.Attachments = int64(len(attachments))
+
+	if s.Fs != nil {
+		bucket := groupBucket(groupId)
+		for _, item := range attachments {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			issue, err := s.verifyFile(ctx, bucket, item)
+			if err != nil {
+				return nil, err
+			}
+			if issue == nil {
+				continue
+			}
+			if _, ok := remoteItems[item.Key]; ok && resettable(item.Status) {
+				issue.RemoteVersion = remoteItems[item.Key]
+				resetItems = append(resetItems, item.Key)
+			}
+			report.Issues = append(report.Issues, *issue)
+		}
+	}
+
+	if repair {
+		if err := s.scheduleDownloads(ctx, report, resetItems, resetCollections); err != nil {
+			return report, err
+		}
+	}
+	if s.Logger != nil {
+		s.Logger.Info().Msgf("verified group %v: %v issues, %v downloads scheduled", groupId, len(report.Issues), report.Scheduled)
+	}
+	return report, nil
+}
+
+// compareStates reports incomplete objects and compares the stored versions
+// with remote, if set. It returns the keys of stored objects that a repair
+// resets.
+func (report *VerifyReport) compareStates(object string, states []model.ObjectState, remote map[string]int64) []string {
+	var reset []string
+	local := map[string]bool{}
+	for _, state := range states {
+		local[state.Key] = true
+		if state.Deleted {
+			continue
+		}
+		remoteVersion, inRemote := remote[state.Key]
+		issue := VerifyIssue{Object: object, Key: state.Key, LocalVersion: state.Version, RemoteVersion: remoteVersion}
+		switch {
+		case state.Status == model.SyncStatus_Incomplete:
+			issue.Kind = IssueIncomplete
+		case remote == nil || !resettable(state.Status):
+			continue
+		case !inRemote:
+			if state.Version > 0 {
+				report.Issues = append(report.Issues, VerifyIssue{Kind: IssueMissingRemote, Object: object, Key: state.Key, LocalVersion: state.Version})
+			}
+			continue
+		case state.Version != remoteVersion:
+			issue.Kind = IssueVersionMismatch
+		default:
+			continue
+		}
+		if inRemote {
+			reset = append(reset, state.Key)
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+	for _, key := range slices.Sorted(maps.Keys(remote)) {
+		if !local[key] {
+			report.Issues = append(report.Issues, VerifyIssue{Kind: IssueMissingLocal, Object: object, Key: key, RemoteVersion: remote[key]})
+		}
+	}
+	return reset
+}
+
+// verifyFile checks the file of an imported attachment. It returns nil if
+// the file is fine.
+func (s *Syncer) verifyFile(ctx context.Context, bucket string, item *model.Item) (*VerifyIssue, error) {
+	issue := &VerifyIssue{Object: ObjectItem, Key: item.Key, LocalVersion: item.Version}
+	found, err := s.Fs.FileExists(ctx, bucket, item.Key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot check file %s/%s", bucket, item.Key)
+	}
+	if !found {
+		issue.Kind = IssueFileMissing
+		return issue, nil
+	}
+	info, err := s.Fs.FileStat(ctx, bucket, item.Key, filesystem.FileStatOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot stat file %s/%s", bucket, item.Key)
+	}
+	if info.Size() == 0 {
+		issue.Kind = IssueFileEmpty
+		return issue, nil
+	}
+	expected := item.MD5
+	if expected == "" {
+		expected = item.Data.MD5
+	}
+	if expected == "" {
+		return nil, nil
+	}
+	r, err := s.Fs.FileOpenRead(ctx, bucket, item.Key, filesystem.FileGetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open file %s/%s", bucket, item.Key)
+	}
+	defer r.Close()
+	hash := md5.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return nil, errors.Wrapf(err, "cannot read file %s/%s", bucket, item.Key)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		issue.Kind = IssueMD5Mismatch
+		issue.Detail = fmt.Sprintf("md5 %s, expected %s", actual, expected)
+		return issue, nil
+	}
+	return nil, nil
+}
+
+// scheduleDownloads resets the objects and clears the sync cursors of the
+// group, so that the next sync compares all versions with the cloud. Objects
+// that are missing locally are created by that sync.
+func (s *Syncer) scheduleDownloads(ctx context.Context, report *VerifyReport, items, collections []string) error {
+	var scheduled []VerifyIssue
+	for i, issue := range report.Issues {
+		switch {
+		case issue.Kind == IssueMissingLocal,
+			issue.Object == ObjectItem && slices.Contains(items, issue.Key),
+			issue.Object == ObjectCollection && slices.Contains(collections, issue.Key):
+			report.Issues[i].Scheduled = true
+			scheduled = append(scheduled, issue)
+		}
+	}
+	if len(scheduled) == 0 {
+		return nil
+	}
+	if _, err := s.Storage.ResetCollections(ctx, report.GroupId, collections); err != nil {
+		return errors.Wrapf(err, "cannot reset collections of group %v", report.GroupId)
+	}
+	if _, err := s.Storage.ResetItems(ctx, report.GroupId, items); err != nil {
+		return errors.Wrapf(err, "cannot reset items of group %v", report.GroupId)
+	}
+	if err := s.Storage.ClearGroup(ctx, report.GroupId); err != nil {
+		return errors.Wrapf(err, "cannot clear sync cursors of group %v", report.GroupId)
+	}
+	seen := map[string]bool{}
+	for _, issue := range scheduled {
+		if !seen[issue.Object+issue.Key] {
+			seen[issue.Object+issue.Key] = true
+			report.Scheduled++
+		}
+	}
+	return nil
+}
+
+// existingKeys returns the keys of the objects that are not deleted
+func existingKeys(states []model.ObjectState) map[string]bool {
+	keys := map[string]bool{}
+	for _, state := range states {
+		if !state.Deleted {
+			keys[state.Key] = true
+		}
+	}
+	return keys
+}
+
+func resettable(sync model.SyncStatus) bool {
+	return sync == model.SyncStatus_Synced || sync == model.SyncStatus_Incomplete
+}
@@ -0,0 +1,175 @@
+package sync
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json/v2"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/je4/zsync/v2/pkg/filesystem"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+	"github.com/je4/zsync/v2/pkg/zotero/storage/memory"
+	"github.com/op/go-logging"
+)
+
+func TestVerify(t *testing.T) {
+	const groupId = 12345
+	content := []byte("attachment content")
+	sum := md5.Sum(content)
+	contentMD5 := hex.EncodeToString(sum[:])
+
+	st := memory.NewStore(true, nil)
+	if _, _, err := st.CreateEmptyGroup(testCtx, groupId); err != nil {
+		t.Fatalf("CreateEmptyGroup: %v", err)
+	}
+	group, _ := st.GetGroup(testCtx, groupId)
+	group.ItemVersion = 50
+	group.CollectionVersion = 50
+	if err := st.UpdateGroup(testCtx, group); err != nil {
+		t.Fatalf("UpdateGroup: %v", err)
+	}
+
+	createItem := func(data *model.ItemGeneric, version int64, status model.SyncStatus, md5str string) {
+		item, err := st.CreateItem(testCtx, groupId, data, nil, "")
+		if err != nil {
+			t.Fatalf("CreateItem: %v", err)
+		}
+		item.Version = version
+		item.Status = status
+		item.MD5 = md5str
+		if err := st.UpdateItem(testCtx, groupId, item); err != nil {
+			t.Fatalf("UpdateItem: %v", err)
+		}
+	}
+	book := func(key string) *model.ItemGeneric {
+		return &model.ItemGeneric{ItemDataBase: model.ItemDataBase{Key: key, ItemType: "book"}}
+	}
+	attachment := func(key string) *model.ItemGeneric {
+		return &model.ItemGeneric{ItemDataBase: model.ItemDataBase{Key: key, ItemType: "attachment"}, LinkMode: "imported_file"}
+	}
+	createItem(book("BOOK0001"), 10, model.SyncStatus_Synced, "")
+	createItem(book("BOOK0002"), 10, model.SyncStatus_Synced, "")
+	createItem(book("BOOK0003"), 10, model.SyncStatus_Modified, "")
+	createItem(book("GONE0001"), 5, model.SyncStatus_Synced, "")
+	note := &model.ItemGeneric{ItemDataBase: model.ItemDataBase{Key: "NOTE0001", ItemType: "note", ParentItem: "MISSING1"}}
+	createItem(note, 10, model.SyncStatus_Synced, "")
+	createItem(attachment("ATTACH01"), 10, model.SyncStatus_Synced, contentMD5)
+	createItem(attachment("ATTACH02"), 10, model.SyncStatus_Synced, "0123456789abcdef0123456789abcdef")
+	createItem(attachment("ATTACH03"), 10, model.SyncStatus_Synced, "")
+	if err := st.CreateEmptyItem(testCtx, groupId, "EMPTY001", ""); err != nil {
+		t.Fatalf("CreateEmptyItem: %v", err)
+	}
+	for key, parent := range map[string]string{"COLL0001": "", "COLL0002": "MISSING2"} {
+		coll, err := st.CreateCollection(testCtx, groupId, &model.CollectionData{Key: key, Name: key, ParentCollection: model.Parent(parent)})
+		if err != nil {
+			t.Fatalf("CreateCollection: %v", err)
+		}
+		coll.Version = 4
+		coll.Status = model.SyncStatus_Synced
+		if err := st.UpdateCollection(testCtx, groupId, coll); err != nil {
+			t.Fatalf("UpdateCollection: %v", err)
+		}
+	}
+
+	fs, err := filesystem.NewLocalFs(t.TempDir(), logging.MustGetLogger("test"))
+	if err != nil {
+		t.Fatalf("NewLocalFs: %v", err)
+	}
+	if err := fs.FolderCreate(testCtx, groupBucket(groupId), filesystem.FolderCreateOptions{}); err != nil {
+		t.Fatalf("FolderCreate: %v", err)
+	}
+	for _, name := range []string{"ATTACH01", "ATTACH02"} {
+		if err := fs.FilePut(testCtx, groupBucket(groupId), name, content, filesystem.FilePutOptions{}); err != nil {
+			t.Fatalf("FilePut: %v", err)
+		}
+	}
+
+	c, closeServer := startMockZoteroCloudServer(t, "test-key", func(w http.ResponseWriter, r *http.Request) {
+		versions := map[string]int64{}
+		switch {
+		case strings.Contains(r.URL.Path, "/items/trash"):
+			versions = map[string]int64{"ATTACH01": 10}
+		case strings.Contains(r.URL.Path, "/items"):
+			versions = map[string]int64{"BOOK0001": 10, "BOOK0002": 12, "BOOK0003": 12, "NOTE0001": 10,
+				"ATTACH02": 10, "ATTACH03": 10, "EMPTY001": 3, "NEW00001": 7}
+		case strings.Contains(r.URL.Path, "/collections"):
+			versions = map[string]int64{"COLL0001": 4, "COLL0002": 4}
+		}
+		w.Header().Set("Last-Modified-Version", "20")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.MarshalWrite(w, versions)
+	})
+	defer closeServer()
+
+	kinds := func(report *VerifyReport) map[string]string {
+		result := map[string]string{}
+		for _, issue := range report.Issues {
+			result[issue.Key] = issue.Kind
+		}
+		return result
+	}
+	expected := map[string]string{
+		"BOOK0002": IssueVersionMismatch,
+		"GONE0001": IssueMissingRemote,
+		"EMPTY001": IssueIncomplete,
+		"NEW00001": IssueMissingLocal,
+		"NOTE0001": IssueDanglingParent,
+		"ATTACH02": IssueMD5Mismatch,
+		"ATTACH03": IssueFileMissing,
+		"COLL0002": IssueMissingParentCollection,
+	}
+
+	local := NewSyncer(nil, st, nil, nil)
+	report, err := local.Verify(testCtx, groupId, true)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if report.Remote || report.Files || report.Scheduled != 0 || len(report.Issues) != 3 {
+		t.Errorf("unexpected local report %+v", report)
+	}
+
+	syncer := NewSyncer(c, st, fs, nil)
+	report, err = syncer.Verify(testCtx, groupId, false)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got := kinds(report); len(got) != len(expected) || report.Items != 8 || report.Collections != 2 || report.Attachments != 3 {
+		t.Errorf("unexpected report %+v", report)
+	} else {
+		for key, kind := range expected {
+			if got[key] != kind {
+				t.Errorf("issue of %s is %q, expected %q", key, got[key], kind)
+			}
+		}
+	}
+	if version, _, _ := st.GetItemVersion(testCtx, groupId, "BOOK0002", ""); version != 10 {
+		t.Errorf("verify without repair changed version to %d", version)
+	}
+
+	report, err = syncer.Verify(testCtx, groupId, true)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	var scheduled []string
+	for _, issue := range report.Issues {
+		if issue.Scheduled {
+			scheduled = append(scheduled, issue.Key)
+		}
+	}
+	if report.Scheduled != 5 || len(scheduled) != 5 {
+		t.Errorf("unexpected scheduled downloads %v in %+v", scheduled, report)
+	}
+	for _, key := range []string{"BOOK0002", "ATTACH02", "ATTACH03"} {
+		if version, sync, _ := st.GetItemVersion(testCtx, groupId, key, ""); version != 0 || sync != model.SyncStatus_Incomplete {
+			t.Errorf("item %s not reset: %d %v", key, version, sync)
+		}
+	}
+	if version, sync, _ := st.GetItemVersion(testCtx, groupId, "BOOK0003", ""); version != 10 || sync != model.SyncStatus_Modified {
+		t.Errorf("modified item was reset: %d %v", version, sync)
+	}
+	if group, _ := st.GetGroup(testCtx, groupId); group.ItemVersion != 0 || group.CollectionVersion != 0 {
+		t.Errorf("sync cursors not cleared: %+v", group)
+	}
+}
@@ -0,0 +1,182 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+const (
+	// DefaultMaxAttempts is the number of attempts before a delivery fails
+	DefaultMaxAttempts = 10
+	// DefaultInterval is the interval in which Run looks for due deliveries
+	DefaultInterval = 10 * time.Second
+	// batchSize is the number of deliveries claimed at once
+	batchSize = 20
+	// lease is the time a claimed delivery is hidden from other dispatchers
+	lease = 5 * time.Minute
+	// maxBackoff limits the delay between attempts
+	maxBackoff = 6 * time.Hour
+)
+
+// Outbox is the persistence of the dispatcher, implemented by
+// storage.Storage.
+type Outbox interface {
+	ClaimWebhookDeliveries(ctx context.Context, limit int64, lease time.Duration) ([]*model.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+}
+
+// Dispatcher posts the pending deliveries of the outbox to their webhooks and
+// schedules retries with exponential backoff.
+type Dispatcher struct {
+	outbox      Outbox
+	client      *http.Client
+	logger      zLogger.ZLogger
+	wake        chan struct{}
+	MaxAttempts int64
+	// Backoff returns the delay after the given number of failed attempts
+	Backoff func(attempts int64) time.Duration
+}
+
+// NewDispatcher creates a dispatcher for outbox. client may be nil for
+// NewClient with a timeout of 30 seconds.
+func NewDispatcher(outbox Outbox, client *http.Client, logger zLogger.ZLogger) *Dispatcher {
+	if client == nil {
+		client = NewClient(30 * time.Second)
+	}
+	return &Dispatcher{
+		outbox:      outbox,
+		client:      client,
+		logger:      logger,
+		wake:        make(chan struct{}, 1),
+		MaxAttempts: DefaultMaxAttempts,
+		Backoff:     Backoff,
+	}
+}
+
+// Backoff waits 30 seconds after the first failed attempt and doubles the
+// delay for every further attempt up to six hours.
+func Backoff(attempts int64) time.Duration {
+	delay := 30 * time.Second
+	for i := int64(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
+
+// Notify makes Run look for due deliveries immediately, e.g. after events
+// have been published.
+func (d *Dispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers due deliveries every interval or after Notify until ctx is
+// done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.DeliverPending(ctx); err != nil && ctx.Err() == nil && d.logger != nil {
+			d.logger.Error().Err(err).Msg("cannot deliver webhooks")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// DeliverPending delivers all due deliveries and returns the number of
+// successful ones. Failed attempts are scheduled for a retry.
+func (d *Dispatcher) DeliverPending(ctx context.Context) (int64, error) {
+	var delivered int64
+	for {
+		deliveries, err := d.outbox.ClaimWebhookDeliveries(ctx, batchSize, lease)
+		if err != nil {
+			return delivered, errors.Wrap(err, "cannot claim webhook deliveries")
+		}
+		for _, delivery := range deliveries {
+			if d.deliver(ctx, delivery) {
+				delivered++
+			}
+			// the result is stored even if ctx has been canceled
+			if err := d.outbox.UpdateWebhookDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+				return delivered, errors.Wrapf(err, "cannot update webhook delivery %v", delivery.Id)
+			}
+		}
+		if len(deliveries) < batchSize || ctx.Err() != nil {
+			return delivered, ctx.Err()
+		}
+	}
+}
+
+// deliver posts delivery and updates its state. It reports whether the
+// webhook accepted the request.
+func (d *Dispatcher) deliver(ctx context.Context, delivery *model.WebhookDelivery) bool {
+	delivery.Attempts++
+	status, err := d.post(ctx, delivery)
+	delivery.ResponseStatus = int64(status)
+	if err == nil {
+		now := time.Now()
+		delivery.Status = model.WebhookDeliveryStatus_Delivered
+		delivery.Delivered = &now
+		delivery.LastError = ""
+		return true
+	}
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.MaxAttempts {
+		delivery.Status = model.WebhookDeliveryStatus_Failed
+		if d.logger != nil {
+			d.logger.Error().Err(err).Msgf("webhook delivery %v to %s failed after %d attempts", delivery.Id, delivery.Url, delivery.Attempts)
+		}
+		return false
+	}
+	delivery.NextAttempt = time.Now().Add(d.Backoff(delivery.Attempts))
+	if d.logger != nil {
+		d.logger.Warn().Err(err).Msgf("webhook delivery %v to %s failed, retry at %v", delivery.Id, delivery.Url, delivery.NextAttempt)
+	}
+	return false
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery *model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot create request for %s", delivery.Url)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "zsync-webhook")
+	req.Header.Set(EventHeader, string(delivery.Event))
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, delivery.Payload))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot post to %s", delivery.Url)
+	}
+	defer resp.Body.Close()
+	// allow the connection to be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.Errorf("%s responded with %s", delivery.Url, resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,3 @@
+// Package webhook delivers the events of the webhook outbox as signed HTTP
+// callbacks.
+package webhook
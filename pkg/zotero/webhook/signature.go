@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// EventHeader names the event of the payload
+	EventHeader = "X-Zsync-Event"
+	// DeliveryHeader is the id of the delivery, which stays the same for
+	// retries
+	DeliveryHeader = "X-Zsync-Delivery"
+	// TimestampHeader is the unix time of the request
+	TimestampHeader = "X-Zsync-Timestamp"
+	// SignatureHeader is "sha256=" followed by the hex encoded HMAC-SHA256 of
+	// timestamp, "." and body with the webhook secret as key
+	SignatureHeader = "X-Zsync-Signature"
+)
+
+// Sign returns the value of SignatureHeader for body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks signature and timestamp header values of a received body.
+// Requests older than tolerance are rejected to prevent replays; a tolerance
+// of 0 accepts any age.
+func Verify(secret string, timestamp string, signature string, body []byte, tolerance time.Duration) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if tolerance > 0 {
+		age := time.Since(time.Unix(ts, 0))
+		if age > tolerance || age < -tolerance {
+			return false
+		}
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
+
+// NewSecret returns a random secret for a new webhook.
+func NewSecret() string {
+	return rand.Text()
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+// ErrForbiddenTarget is returned for webhook urls and connections to
+// addresses of the local host or network.
+var ErrForbiddenTarget = errors.New("webhook target not allowed")
+
+// AllowedIP reports whether webhooks may be delivered to ip. Loopback,
+// private, link-local (e.g. the cloud metadata service 169.254.169.254),
+// multicast and unspecified addresses are refused.
+func AllowedIP(ip net.IP) bool {
+	return ip != nil &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified()
+}
+
+// CheckUrl returns an error if str is no absolute http or https url or if
+// its host resolves to an address refused by AllowedIP.
+func CheckUrl(ctx context.Context, str string) error {
+	u, err := url.Parse(str)
+	if err != nil {
+		return errors.Wrapf(err, "invalid url %q", str)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.Errorf("invalid url %q: no absolute http or https url", str)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return errors.Wrapf(err, "cannot resolve %s", u.Hostname())
+	}
+	// every address may be used by the dispatcher
+	for _, addr := range addrs {
+		if !AllowedIP(addr.IP) {
+			return errors.Wrapf(ErrForbiddenTarget, "%s resolves to %s", u.Hostname(), addr.IP)
+		}
+	}
+	return nil
+}
+
+// dialControl refuses connections to addresses refused by AllowedIP. It
+// checks the address actually dialed, so a host name, which resolved to a
+// public address when the webhook was created, cannot be rebound to a local
+// one.
+func dialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrapf(err, "invalid address %s", address)
+	}
+	if !AllowedIP(net.ParseIP(host)) {
+		return errors.Wrapf(ErrForbiddenTarget, "address %s", host)
+	}
+	return nil
+}
+
+// NewClient returns the http client used by NewDispatcher by default. It
+// connects only to addresses allowed by AllowedIP and ignores proxies, which
+// would hide the target address from the check.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,193 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/je4/zsync/v2/pkg/zotero/model"
+)
+
+// memoryOutbox hands out its pending deliveries once and records updates
+type memoryOutbox struct {
+	mu       sync.Mutex
+	pending  []*model.WebhookDelivery
+	finished []*model.WebhookDelivery
+}
+
+func (o *memoryOutbox) ClaimWebhookDeliveries(ctx context.Context, limit int64, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := min(int(limit), len(o.pending))
+	claimed := o.pending[:n]
+	o.pending = o.pending[n:]
+	return claimed, nil
+}
+
+func (o *memoryOutbox) UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	copied := *delivery
+	o.finished = append(o.finished, &copied)
+	return nil
+}
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, status int) (*httptest.Server, chan received) {
+	t.Helper()
+	requests := make(chan received, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header.Clone(), body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event":"created"}`)
+	now := time.Now().Unix()
+	signature := Sign("secret", now, body)
+	ts := strconv.FormatInt(now, 10)
+	if !Verify("secret", ts, signature, body, time.Minute) {
+		t.Error("valid signature rejected")
+	}
+	if Verify("other", ts, signature, body, time.Minute) {
+		t.Error("signature with wrong secret accepted")
+	}
+	if Verify("secret", ts, signature, []byte(`{"event":"deleted"}`), time.Minute) {
+		t.Error("signature of modified body accepted")
+	}
+	old := now - 3600
+	if Verify("secret", strconv.FormatInt(old, 10), Sign("secret", old, body), body, time.Minute) {
+		t.Error("outdated signature accepted")
+	}
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	server, requests := newReceiver(t, http.StatusNoContent)
+	payload := []byte(`{"event":"updated","groupId":1,"objectType":"item","key":"ITEMKEY1"}`)
+	outbox := &memoryOutbox{pending: []*model.WebhookDelivery{
+		{Id: 7, WebhookId: 1, Event: model.WebhookEvent_Updated, Status: model.WebhookDeliveryStatus_Pending, Payload: payload, Url: server.URL, Secret: "s3cret"},
+	}}
+	d := NewDispatcher(outbox, server.Client(), nil)
+
+	delivered, err := d.DeliverPending(context.Background())
+	if err != nil {
+		t.Fatalf("DeliverPending failed: %v", err)
+	}
+	if delivered != 1 {
+		t.Fatalf("expected 1 delivery, got %d", delivered)
+	}
+	req := <-requests
+	if string(req.body) != string(payload) {
+		t.Errorf("unexpected body %s", req.body)
+	}
+	if req.header.Get(EventHeader) != "updated" || req.header.Get(DeliveryHeader) != "7" {
+		t.Errorf("unexpected headers %v", req.header)
+	}
+	if !Verify("s3cret", req.header.Get(TimestampHeader), req.header.Get(SignatureHeader), req.body, time.Minute) {
+		t.Error("invalid signature")
+	}
+	if len(outbox.finished) != 1 {
+		t.Fatalf("expected 1 update, got %d", len(outbox.finished))
+	}
+	result := outbox.finished[0]
+	if result.Status != model.WebhookDeliveryStatus_Delivered || result.Attempts != 1 || result.ResponseStatus != http.StatusNoContent || result.Delivered == nil {
+		t.Errorf("unexpected delivery state %+v", result)
+	}
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	server, requests := newReceiver(t, http.StatusServiceUnavailable)
+	outbox := &memoryOutbox{pending: []*model.WebhookDelivery{
+		{Id: 1, Event: model.WebhookEvent_Created, Status: model.WebhookDeliveryStatus_Pending, Payload: []byte(`{}`), Url: server.URL, Secret: "x"},
+		{Id: 2, Event: model.WebhookEvent_Deleted, Status: model.WebhookDeliveryStatus_Pending, Attempts: 2, Payload: []byte(`{}`), Url: server.URL, Secret: "x"},
+	}}
+	d := NewDispatcher(outbox, server.Client(), nil)
+	d.MaxAttempts = 3
+
+	before := time.Now()
+	delivered, err := d.DeliverPending(context.Background())
+	if err != nil {
+		t.Fatalf("DeliverPending failed: %v", err)
+	}
+	if delivered != 0 {
+		t.Errorf("expected no successful delivery, got %d", delivered)
+	}
+	if len(requests) != 2 {
+		t.Errorf("expected 2 requests, got %d", len(requests))
+	}
+	retry := outbox.finished[0]
+	if retry.Status != model.WebhookDeliveryStatus_Pending || retry.Attempts != 1 || retry.ResponseStatus != http.StatusServiceUnavailable || retry.LastError == "" {
+		t.Errorf("unexpected retry state %+v", retry)
+	}
+	if retry.NextAttempt.Before(before.Add(Backoff(1))) {
+		t.Errorf("next attempt %v not delayed", retry.NextAttempt)
+	}
+	failed := outbox.finished[1]
+	if failed.Status != model.WebhookDeliveryStatus_Failed || failed.Attempts != 3 {
+		t.Errorf("unexpected failed state %+v", failed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if Backoff(1) != 30*time.Second || Backoff(2) != time.Minute || Backoff(3) != 2*time.Minute {
+		t.Errorf("unexpected backoff %v %v %v", Backoff(1), Backoff(2), Backoff(3))
+	}
+	if Backoff(100) != maxBackoff {
+		t.Errorf("backoff not limited: %v", Backoff(100))
+	}
+}
+
+func TestCheckUrl(t *testing.T) {
+	for str, allowed := range map[string]bool{
+		"https://93.184.215.14/hook":               true,
+		"http://[2606:4700::1111]/hook":            true,
+		"http://127.0.0.1:8080/hook":               false,
+		"http://localhost/hook":                    false,
+		"http://[::1]/hook":                        false,
+		"http://169.254.169.254/latest/meta-data/": false,
+		"http://10.1.2.3/hook":                     false,
+		"http://192.168.0.1/hook":                  false,
+		"http://[fd00::1]/hook":                    false,
+		"http://0.0.0.0/hook":                      false,
+		"ftp://93.184.215.14/hook":                 false,
+		"/hook":                                    false,
+	} {
+		if err := CheckUrl(context.Background(), str); (err == nil) != allowed {
+			t.Errorf("CheckUrl(%q): %v", str, err)
+		}
+	}
+}
+
+func TestDispatcher_ForbiddenTarget(t *testing.T) {
+	// the receiver resolves to a loopback address like a rebound host name
+	server, requests := newReceiver(t, http.StatusNoContent)
+	outbox := &memoryOutbox{pending: []*model.WebhookDelivery{
+		{Id: 1, Event: model.WebhookEvent_Created, Status: model.WebhookDeliveryStatus_Pending, Payload: []byte(`{}`), Url: server.URL, Secret: "x"},
+	}}
+	d := NewDispatcher(outbox, nil, nil)
+
+	delivered, err := d.DeliverPending(context.Background())
+	if err != nil {
+		t.Fatalf("DeliverPending failed: %v", err)
+	}
+	if delivered != 0 || len(requests) != 0 {
+		t.Errorf("loopback target received %d requests", len(requests))
+	}
+	if result := outbox.finished[0]; result.Status != model.WebhookDeliveryStatus_Pending || !strings.Contains(result.LastError, ErrForbiddenTarget.Error()) {
+		t.Errorf("unexpected delivery state %+v", result)
+	}
+}